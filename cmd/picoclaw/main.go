@@ -34,7 +34,6 @@ import (
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/migrate"
 	"github.com/sipeed/picoclaw/pkg/providers"
-	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -475,8 +474,7 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		response, err := processInteractive(agentLoop, input, sessionKey)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -486,6 +484,19 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 }
 
+// processInteractive handles one line of interactive input. Ctrl+C while it
+// runs cancels just this message, including any knowledge base search in
+// flight, and returns to the prompt.
+func processInteractive(agentLoop *agent.AgentLoop, input, sessionKey string) (string, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+	if err != nil && ctx.Err() != nil {
+		return "", fmt.Errorf("cancelled")
+	}
+	return response, err
+}
+
 func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	reader := bufio.NewReader(os.Stdin)
 	for {
@@ -510,8 +521,7 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 			return
 		}
 
-		ctx := context.Background()
-		response, err := agentLoop.ProcessDirect(ctx, input, sessionKey)
+		response, err := processInteractive(agentLoop, input, sessionKey)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -641,7 +651,11 @@ func gatewayCmd() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	startRagAutoIndex(ctx, cfg)
+	ragRunner := startRagAutoIndex(ctx, cfg, msgBus)
+	if ragRunner != nil {
+		agentLoop.SetRagIndexRunner(ragRunner)
+	}
+	startRagDigest(ctx, cfg, provider, msgBus)
 
 	if err := cronService.Start(); err != nil {
 		fmt.Printf("Error starting cron service: %v\n", err)
@@ -670,6 +684,9 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	if ragRunner != nil {
+		registerRagAdmin(healthServer, cfg, ragRunner)
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
@@ -684,67 +701,20 @@ func gatewayCmd() {
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
+	if ragRunner != nil {
+		stopRagIndexRunner(ragRunner, cancel)
+	}
+	// Before cancel, so per-user index runs get to finish their current file.
+	agentLoop.Stop()
 	cancel()
 	healthServer.Stop(context.Background())
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
-	agentLoop.Stop()
 	channelManager.StopAll(ctx)
 	fmt.Println("✓ Gateway stopped")
 }
 
-func startRagAutoIndex(ctx context.Context, cfg *config.Config) {
-	if !cfg.RAG.Enabled || !cfg.RAG.AutoIndex.Enabled {
-		return
-	}
-
-	intervalHours := cfg.RAG.AutoIndex.IntervalHours
-	if intervalHours <= 0 {
-		intervalHours = 12
-	}
-
-	service, err := rag.NewService(cfg, cfg.WorkspacePath())
-	if err != nil {
-		logger.WarnCF("rag", "Auto index disabled due to config error", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	logger.InfoCF("rag", "Auto index scheduled", map[string]interface{}{
-		"interval_hours": intervalHours,
-	})
-
-	interval := time.Duration(intervalHours) * time.Hour
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				summary, err := service.Index(ctx, rag.IndexOptions{ReindexAll: false})
-				if err != nil {
-					logger.WarnCF("rag", "Auto index failed", map[string]interface{}{
-						"error": err.Error(),
-					})
-					continue
-				}
-				logger.InfoCF("rag", "Auto index completed", map[string]interface{}{
-					"total_files":   summary.TotalFiles,
-					"indexed_files": summary.IndexedFiles,
-					"updated_files": summary.UpdatedFiles,
-					"removed_files": summary.RemovedFiles,
-					"skipped_files": summary.SkippedFiles,
-					"chunks":        summary.Chunks,
-				})
-			}
-		}
-	}()
-}
-
 func statusCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
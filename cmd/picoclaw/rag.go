@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/rag"
 )
 
@@ -19,6 +24,44 @@ func ragCmd() {
 	switch subcommand {
 	case "index":
 		ragIndexCmd(os.Args[3:])
+	case "search":
+		ragSearchCmd(os.Args[3:])
+	case "serve":
+		ragServeCmd(os.Args[3:])
+	case "bootstrap":
+		ragBootstrapCmd(os.Args[3:])
+	case "init":
+		ragInitCmd()
+	case "bench":
+		ragBenchCmd(os.Args[3:])
+	case "tune":
+		ragTuneCmd(os.Args[3:])
+	case "check":
+		ragCheckCmd(os.Args[3:])
+	case "migrate-store":
+		ragMigrateStoreCmd(os.Args[3:])
+	case "collections":
+		ragCollectionsCmd(os.Args[3:])
+	case "digest":
+		ragDigestCmd(os.Args[3:])
+	case "keywords":
+		ragKeywordsCmd(os.Args[3:])
+	case "coverage":
+		ragCoverageCmd(os.Args[3:])
+	case "diff":
+		ragDiffCmd(os.Args[3:])
+	case "clean":
+		ragCleanCmd(os.Args[3:])
+	case "audit":
+		ragAuditCmd(os.Args[3:])
+	case "undo-delete":
+		ragUndoDeleteCmd(os.Args[3:])
+	case "lint-vault":
+		ragLintVaultCmd(os.Args[3:])
+	case "feedback":
+		ragFeedbackCmd(os.Args[3:])
+	case "routes":
+		ragRoutesCmd(os.Args[3:])
 	default:
 		fmt.Printf("Unknown rag command: %s\n", subcommand)
 		ragHelp()
@@ -27,21 +70,194 @@ func ragCmd() {
 
 func ragHelp() {
 	fmt.Println("\nRAG commands:")
+	fmt.Println("  init         Set up the rag config interactively")
 	fmt.Println("  index        Build or update the knowledge base index")
+	fmt.Println("  search       Search the knowledge base")
+	fmt.Println("  serve        Keep the index up to date and serve health/admin endpoints")
+	fmt.Println("  bootstrap    Generate a docker-compose file for Qdrant and configure RAG")
+	fmt.Println("  bench        Measure embedding and vector store speed and suggest settings")
+	fmt.Println("  tune         Compare chunk_size/chunk_overlap settings on a sample of the vault")
+	fmt.Println("  check        Exit non-zero when the index is stale (for CI and hooks)")
+	fmt.Println("  migrate-store Copy the index to another vector store without re-embedding")
+	fmt.Println("  collections  List Qdrant collections, or prune the ones picoclaw no longer uses")
+	fmt.Println("  digest       Summarize the notes changed recently, grouped by topic")
+	fmt.Println("  keywords     Suggest auto-trigger keywords from what the vault contains")
+	fmt.Println("  coverage     Report which notes searches retrieve, miss or never reach")
+	fmt.Println("  diff         List the notes added, removed or modified in the index since a date")
+	fmt.Println("  clean        Show the disk use of the RAG data directory and free space")
+	fmt.Println("  audit        List the note content sent to LLMs, or purge the audit log")
+	fmt.Println("  undo-delete  Restore the deleted vectors of a note from the trash, or list the trash")
+	fmt.Println("  lint-vault   Flag notes likely to retrieve poorly, with examples")
+	fmt.Println("  feedback     Mark notes good or bad for ranking, list the learned boosts or reset them")
+	fmt.Println("  routes       Summarize where rag.router sent messages: vault, web or direct")
 	fmt.Println()
-	fmt.Println("Options:")
+	fmt.Println("Index options:")
 	fmt.Println("  --full       Rebuild all vectors from scratch")
+	fmt.Println("  --fail-fast  Stop at the first file that cannot be indexed")
+	fmt.Println("  --force      Index even if the projected size exceeds the memory or disk available")
+	fmt.Println("  --verbose    List every file and what happened to it")
+	fmt.Println("  --nice       Throttle the run as with rag.index.nice")
+	fmt.Println("  --allow-mass-delete  Remove missing notes even beyond rag.safety.max_removed_fraction")
+	fmt.Println("  --user U     Index the knowledge base of user U (channel:sender_id) under rag.per_user")
+	fmt.Println()
+	fmt.Println("Search options:")
+	fmt.Println("  --limit N    Results per page (default: top_k)")
+	fmt.Println("  --offset N   Skip the first N matches")
+	fmt.Println("  --page TOKEN Continue from a previous page")
+	fmt.Println("  --heading H  Only match chunks under heading H (or heading:H in the query)")
+	fmt.Println("  --book B     Only match chunks of the book titled B (or book:\"B\" in the query)")
+	fmt.Println("  --preset P   Use the retrieval settings of rag.presets entry P")
+	fmt.Println("  --follow-ups Suggest questions from matches below the results, with the agent's LLM")
+	fmt.Println()
+	fmt.Println("Bootstrap options:")
+	fmt.Println("  --dir DIR           Where to write " + bootstrapComposeFile + " (default: .)")
+	fmt.Println("  --vault PATH        Set rag.vault_path")
+	fmt.Println("  --local-embeddings  Add a local embedding server instead of a hosted API")
+	fmt.Println("  --model NAME        Model for the local embedding server (default: " + bootstrapEmbeddingModel + ")")
+	fmt.Println("  --up                Start the containers, wait until ready and run the first index")
+	fmt.Println("  --force             Overwrite an existing compose file")
+	fmt.Println()
+	fmt.Println("Bench options:")
+	fmt.Println("  --samples N   Texts to embed per measurement (default: 64)")
+	fmt.Println("  --searches N  Search requests to time (default: 20)")
+	fmt.Println()
+	fmt.Println("Tune options:")
+	fmt.Println("  --eval FILE  Eval set: JSON lines of {\"query\": ..., \"paths\": [...]} (default: generated)")
+	fmt.Println("  --notes N    Notes to sample (default: 50)")
+	fmt.Println()
+	fmt.Println("Check options:")
+	fmt.Println("  --max-staleness D  Fail when the last index run is older than D (e.g. 24h)")
+	fmt.Println("  --max-pending N    Fail when more than N files are new, modified or deleted")
+	fmt.Println()
+	fmt.Println("Migrate-store options:")
+	fmt.Println("  --from NAME        Source provider (default: qdrant)")
+	fmt.Println("  --to NAME          Destination provider (default: qdrant; the only one in this build)")
+	fmt.Println("  --url URL          Destination server (default: rag.vector_db.url)")
+	fmt.Println("  --collection NAME  Destination collection (default: rag.vector_db.collection)")
+	fmt.Println("  --batch N          Points per request (default: 256)")
+	fmt.Println()
+	fmt.Println("Collections options:")
+	fmt.Println("  list   Show every collection with its size and whether picoclaw uses it")
+	fmt.Println("  prune  Delete unused picoclaw collections (asks first unless --yes)")
+	fmt.Println()
+	fmt.Println("Digest options:")
+	fmt.Println("  --since D  Include notes modified in the last D (default: 24h)")
+	fmt.Println("  --write    Save the digest into rag.digest.folder and index it")
+	fmt.Println()
+	fmt.Println("Keywords options:")
+	fmt.Println("  suggest    Rank the terms of the indexed notes by TF-IDF")
+	fmt.Println("  --limit N  Number of keywords to suggest (default: 30)")
+	fmt.Println("  --write    Add them to rag.trigger.auto_keywords (asks first unless --yes)")
+	fmt.Println()
+	fmt.Println("Coverage options:")
+	fmt.Println("  --since DURATION  Only count searches this recent, e.g. 720h (default: all)")
+	fmt.Println("  --top N           Notes to list per section (default: 10)")
+	fmt.Println()
+	fmt.Println("Diff options:")
+	fmt.Println("  --since DATE  Compare with the index as of DATE, e.g. 2024-05-01 (required)")
+	fmt.Println("  --until DATE  Compare up to DATE instead of the last index run")
+	fmt.Println()
+	fmt.Println("Clean options:")
+	fmt.Println("  --remove LIST          Remove categories: state, reports, caches, remote, logs, trash")
+	fmt.Println("  --logs-older-than AGE  Drop query log entries older than AGE, e.g. 30d or 72h")
+	fmt.Println("  --yes                  Do not ask for confirmation")
+	fmt.Println()
+	fmt.Println("Audit options:")
+	fmt.Println("  purge              Delete the audit log (asks first unless --yes)")
+	fmt.Println("  --since AGE        Only list entries this recent, e.g. 7d")
+	fmt.Println("  --conversation ID  Only list entries of conversation ID")
+	fmt.Println("  --older-than AGE   With purge, drop only entries older than AGE")
+	fmt.Println("  --user U           Use the audit log of user U (channel:sender_id) under rag.per_user")
+	fmt.Println()
+	fmt.Println("Lint-vault options:")
+	fmt.Println("  --examples N  Notes to show per problem (default: 5)")
+	fmt.Println()
+	fmt.Println("Undo-delete options:")
+	fmt.Println("  PATH      Note to restore, as listed; without it the trash is listed")
+	fmt.Println("  --user U  Use the index of user U (channel:sender_id) under rag.per_user")
+	fmt.Println()
+	fmt.Println("Feedback options:")
+	fmt.Println("  good|bad PATH...  Mark notes as good or bad results")
+	fmt.Println("  --reset [PATH]    Forget the marks of the given notes, or of every note")
+	fmt.Println("  --user U          Use the index of user U (channel:sender_id) under rag.per_user")
+	fmt.Println("  Without options the learned boosts are listed.")
+	fmt.Println()
+	fmt.Println("Routes options:")
+	fmt.Println("  --since AGE  Only count decisions this recent, e.g. 7d")
+	fmt.Println("  --limit N    Latest decisions to list (default: 20)")
+	fmt.Println("  --user U     Use the route log of user U (channel:sender_id) under rag.per_user")
+	fmt.Println()
+	fmt.Println("Serve options:")
+	fmt.Println("  --listen ADDR  host:port for /healthz, /readyz and /admin/index (default: gateway address)")
+	fmt.Println("  --daemon       Run under a service manager: notify systemd when ready, log only")
 	fmt.Println()
 	fmt.Println("Examples:")
+	fmt.Println("  picoclaw rag init")
+	fmt.Println("  picoclaw rag check --max-staleness 24h --max-pending 20")
 	fmt.Println("  picoclaw rag index")
 	fmt.Println("  picoclaw rag index --full")
+	fmt.Println("  picoclaw rag index --verbose")
+	fmt.Println("  picoclaw rag index --user telegram:123456")
+	fmt.Println("  picoclaw rag migrate-store --url http://nas:6333")
+	fmt.Println("  picoclaw rag collections prune")
+	fmt.Println("  picoclaw rag digest --since 24h --write")
+	fmt.Println("  picoclaw rag keywords suggest --limit 20 --write")
+	fmt.Println("  picoclaw rag coverage --since 720h")
+	fmt.Println("  picoclaw rag diff --since 2024-05-01")
+	fmt.Println("  picoclaw rag clean --remove caches --logs-older-than 30d")
+	fmt.Println("  picoclaw rag audit --since 7d")
+	fmt.Println("  picoclaw rag audit purge --older-than 30d")
+	fmt.Println("  picoclaw rag routes --since 7d")
+	fmt.Println("  picoclaw rag search \"sepsis fluids\" --limit 10")
+	fmt.Println("  picoclaw rag search heading:API \"rate limits\"")
+	fmt.Println("  picoclaw rag search book:\"Deep Work\" email")
+	fmt.Println("  picoclaw rag search --preset research \"pricing history\"")
+	fmt.Println("  picoclaw rag search \"sepsis fluids\" --follow-ups")
+	fmt.Println("  picoclaw rag serve --daemon --listen 127.0.0.1:18791")
+	fmt.Println("  picoclaw rag bootstrap --local-embeddings --vault ~/notes --up")
+}
+
+// userRagService opens the knowledge base of user, given as
+// "channel:sender_id", under rag.per_user.
+func userRagService(cfg *config.Config, user string) (*rag.Service, error) {
+	if !cfg.RAG.PerUser.Enabled {
+		return nil, fmt.Errorf("--user needs rag.per_user.enabled")
+	}
+	key, err := rag.ParseUserKey(user)
+	if err != nil {
+		return nil, err
+	}
+	users, err := rag.NewUserServices(cfg, cfg.WorkspacePath())
+	if err != nil {
+		return nil, err
+	}
+	return users.For(key)
 }
 
 func ragIndexCmd(args []string) {
-	reindexAll := false
-	for _, arg := range args {
-		if arg == "--full" {
-			reindexAll = true
+	opts := rag.IndexOptions{ContinueOnError: true}
+	force := false
+	nice := false
+	user := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--full":
+			opts.ReindexAll = true
+		case "--nice":
+			nice = true
+		case "--allow-mass-delete":
+			opts.AllowMassDelete = true
+		case "--force":
+			force = true
+		case "--fail-fast":
+			opts.ContinueOnError = false
+		case "--verbose", "-v":
+			opts.Detail = true
+		case "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
 		}
 	}
 
@@ -55,19 +271,44 @@ func ragIndexCmd(args []string) {
 		fmt.Println("RAG is disabled in config.")
 		return
 	}
+	if nice {
+		cfg.RAG.Index.Nice = true
+	}
 
-	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	var service *rag.Service
+	if user != "" {
+		service, err = userRagService(cfg, user)
+	} else {
+		service, err = rag.NewService(cfg, cfg.WorkspacePath())
+	}
 	if err != nil {
 		fmt.Printf("RAG initialization failed: %v\n", err)
 		return
 	}
+	if err := setRagSummarizer(cfg, service); err != nil {
+		fmt.Printf("⚠ Summary levels will not be built: %v\n", err)
+	}
+
+	if !checkIndexCapacity(service, force) {
+		return
+	}
 
 	fmt.Println("Indexing knowledge base...")
 	start := time.Now()
 
-	summary, err := service.Index(context.Background(), rag.IndexOptions{ReindexAll: reindexAll})
+	summary, err := service.Index(context.Background(), opts)
+	if errors.Is(err, rag.ErrMassDelete) {
+		fmt.Printf("⚠ %v\n", err)
+		if promptYes(bufio.NewReader(os.Stdin), "Remove them from the index anyway?", false) {
+			opts.AllowMassDelete = true
+			summary, err = service.Index(context.Background(), opts)
+		}
+	}
 	if err != nil {
 		fmt.Printf("Index failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
 		return
 	}
 
@@ -75,4 +316,193 @@ func ragIndexCmd(args []string) {
 	fmt.Printf("  Files: %d total, %d new, %d updated, %d removed, %d skipped\n",
 		summary.TotalFiles, summary.IndexedFiles, summary.UpdatedFiles, summary.RemovedFiles, summary.SkippedFiles)
 	fmt.Printf("  Chunks: %d\n", summary.Chunks)
+	if summary.FullReindexReason != "" {
+		fmt.Printf("  Full rebuild: %s\n", summary.FullReindexReason)
+	}
+
+	if opts.Detail && len(summary.Files) > 0 {
+		fmt.Println()
+		for _, f := range summary.Files {
+			if f.Action == rag.IndexActionFailed {
+				continue
+			}
+			fmt.Printf("  %-8s %s (%d chunks, %s)\n", f.Action, f.Path, f.Chunks, f.Duration.Truncate(time.Millisecond))
+		}
+	}
+	if len(summary.Failures) > 0 {
+		fmt.Printf("\n✗ %d file(s) failed and will be retried on the next run:\n", len(summary.Failures))
+		for _, f := range summary.Failures {
+			fmt.Printf("  %s: %s\n", f.Path, f.Error)
+		}
+	}
+	fmt.Printf("\nReport: %s\n", rag.IndexReportPath(cfg.RagDataDir()))
+}
+
+// checkIndexCapacity prints the projected size of the index and reports
+// whether indexing should go ahead: not when the projection is over the
+// memory or disk available, unless force is set.
+func checkIndexCapacity(service *rag.Service, force bool) bool {
+	forecast, err := service.ForecastIndex(context.Background())
+	if err != nil {
+		// Indexing reports the same problem with more context.
+		return true
+	}
+	fmt.Printf("Forecast: %s\n", forecast)
+	for _, w := range forecast.Warnings() {
+		fmt.Printf("⚠ %s\n", w)
+	}
+	if !forecast.Exceeds() {
+		return true
+	}
+	if force {
+		fmt.Println("⚠ Indexing anyway (--force)")
+		return true
+	}
+	fmt.Println("✗ The index would not fit. Exclude folders, raise rag.chunk_size, or run with --force.")
+	return false
+}
+
+func ragSearchCmd(args []string) {
+	var queryParts []string
+	opts := rag.SearchPageOptions{}
+	followUps := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--limit":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.Limit)
+				i++
+			}
+		case "--offset":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.Offset)
+				i++
+			}
+		case "--page":
+			if i+1 < len(args) {
+				opts.PageToken = args[i+1]
+				i++
+			}
+		case "--heading":
+			if i+1 < len(args) {
+				opts.Filter.UnderHeading = args[i+1]
+				i++
+			}
+		case "--book":
+			if i+1 < len(args) {
+				opts.Filter.Book = args[i+1]
+				i++
+			}
+		case "--preset":
+			if i+1 < len(args) {
+				opts.Filter.Preset = args[i+1]
+				i++
+			}
+		case "--follow-ups":
+			followUps = true
+		default:
+			queryParts = append(queryParts, args[i])
+		}
+	}
+	query := strings.Join(queryParts, " ")
+	if strings.TrimSpace(query) == "" {
+		fmt.Println("Usage: picoclaw rag search <query> [--limit N] [--offset N] [--page TOKEN] [--heading H] [--book B] [--preset P] [--follow-ups]")
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		return
+	}
+
+	page, err := service.SearchPage(context.Background(), query, opts)
+	if err != nil {
+		fmt.Printf("Search failed: %v\n", err)
+		if errors.Is(err, rag.ErrUnknownPreset) {
+			if names := service.Presets(); len(names) > 0 {
+				fmt.Printf("  Configured presets: %s\n", strings.Join(names, ", "))
+			} else {
+				fmt.Println("  No presets are configured; add them under rag.presets.")
+			}
+		} else if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+
+	if len(page.Results) == 0 {
+		fmt.Println("No matches.")
+		return
+	}
+	for idx, r := range page.Results {
+		fmt.Printf("[%d] %.3f %s\n", page.Offset+idx+1, r.Score, rag.FormatSource(r))
+	}
+	if page.NextPageToken != "" {
+		next := fmt.Sprintf("picoclaw rag search %q --page %s", query, page.NextPageToken)
+		if opts.Filter.UnderHeading != "" {
+			next += fmt.Sprintf(" --heading %q", opts.Filter.UnderHeading)
+		}
+		if opts.Filter.Book != "" {
+			next += fmt.Sprintf(" --book %q", opts.Filter.Book)
+		}
+		if opts.Filter.Preset != "" {
+			next += fmt.Sprintf(" --preset %q", opts.Filter.Preset)
+		}
+		fmt.Printf("\nMore results: %s\n", next)
+	}
+	if followUps {
+		printFollowUps(cfg, service, query, page.Results)
+	}
+}
+
+// printFollowUps prints questions about the matches that did not make the
+// page, written by the agent's LLM.
+func printFollowUps(cfg *config.Config, service *rag.Service, query string, shown []rag.SearchResult) {
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("\nFollow-up questions need an LLM provider: %v\n", err)
+		return
+	}
+	questions, err := service.SuggestFollowUps(context.Background(), query, nil, shown, ragSummarizer(provider, cfg.Agents.Defaults.Model))
+	if err != nil {
+		fmt.Printf("\nFollow-up questions failed: %v\n", err)
+		return
+	}
+	if len(questions) > 0 {
+		fmt.Println("\n" + rag.FormatFollowUps(questions))
+	}
+}
+
+func ragErrorHint(err error) string {
+	var rateLimit *rag.RateLimitError
+	var providerErr *rag.ProviderError
+	switch {
+	case errors.Is(err, rag.ErrVaultNotFound):
+		return "Check rag.vault_path in your config."
+	case errors.Is(err, rag.ErrDimensionMismatch):
+		return "rag.embedding.dimension does not match the model output; fix it or set it to 0."
+	case errors.Is(err, rag.ErrMassDelete):
+		return "Mount the vault if it is on an encrypted or network volume; if the notes were deleted on purpose, run picoclaw rag index --allow-mass-delete."
+	case errors.Is(err, rag.ErrIncompatibleIndex):
+		return "Point rag.vector_db.collection at your own collection, or set rag.vault_id to share one between devices."
+	case errors.Is(err, rag.ErrUnavailable):
+		return "The embedding API or vector store kept failing; try again shortly."
+	case errors.As(err, &rateLimit):
+		return "The embedding API is rate limiting requests; lower rag.embedding.batch_size or retry later."
+	case errors.As(err, &providerErr) && providerErr.StatusCode == 401:
+		return fmt.Sprintf("The %s API rejected the credentials; check the api_key.", providerErr.Provider)
+	}
+	return ""
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragAuditCmd lists the note content rag.audit_log recorded as sent to LLMs,
+// or purges it with "purge".
+func ragAuditCmd(args []string) {
+	purge := false
+	if len(args) > 0 && args[0] == "purge" {
+		purge = true
+		args = args[1:]
+	}
+	var since time.Time
+	var olderThan time.Duration
+	var conversation, user, age string
+	yes := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since", "--older-than":
+			if i+1 < len(args) {
+				d, err := parseAge(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Invalid %s %q\n", args[i], args[i+1])
+					os.Exit(1)
+				}
+				if args[i] == "--since" {
+					since = time.Now().Add(-d)
+				} else {
+					olderThan, age = d, args[i+1]
+				}
+				i++
+			}
+		case "--conversation":
+			if i+1 < len(args) {
+				conversation = args[i+1]
+				i++
+			}
+		case "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
+		case "--yes", "-y":
+			yes = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	dataDir := cfg.RagDataDir()
+	if user != "" {
+		key, err := rag.ParseUserKey(user)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		dataDir = filepath.Join(dataDir, "users", key)
+	}
+
+	if purge {
+		var cutoff time.Time
+		action := "Delete the whole context audit log"
+		if olderThan > 0 {
+			cutoff = time.Now().Add(-olderThan)
+			action = "Drop context audit log entries older than " + age
+		}
+		if !yes && !promptYes(bufio.NewReader(os.Stdin), action+"?", false) {
+			return
+		}
+		dropped, freed, err := rag.PurgeAuditLog(dataDir, cutoff)
+		if err != nil {
+			fmt.Printf("Purging the audit log failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Dropped %d audit log entries, freed %s\n", dropped, rag.FormatBytes(freed))
+		return
+	}
+
+	entries, err := rag.ReadAuditLog(dataDir, since)
+	if err != nil {
+		fmt.Printf("Reading the audit log failed: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.AuditLog.Enabled {
+		fmt.Println("rag.audit_log.enabled is off; no new entries are recorded.")
+	}
+	shown := 0
+	for _, e := range entries {
+		if conversation != "" && e.Conversation != conversation {
+			continue
+		}
+		shown++
+		model := e.Model
+		if model == "" {
+			model = "-"
+		}
+		fmt.Printf("%s  %s  %s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Conversation, model, rag.FormatBytes(int64(len(e.Content))))
+		for _, src := range e.Sources {
+			if src.Heading != "" {
+				fmt.Printf("    %.2f  %s#%s\n", src.Score, src.Path, src.Heading)
+			} else {
+				fmt.Printf("    %.2f  %s\n", src.Score, src.Path)
+			}
+		}
+	}
+	fmt.Printf("%d entries\n", shown)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+func ragBenchCmd(args []string) {
+	var opts rag.BenchOptions
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--samples":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.Samples)
+				i++
+			}
+		case "--searches":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.Searches)
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+
+	fmt.Println("Benchmarking RAG backends...")
+	report, err := rag.RunBench(context.Background(), cfg.RAG, opts, func(step string) {
+		fmt.Printf("  %s\n", step)
+	})
+	if report != nil {
+		fmt.Printf("\nEmbedding (%s, %d texts):\n", cfg.RAG.Embedding.Model, report.Samples)
+		fmt.Printf("  %-6s %-11s %-9s %-12s %s\n", "batch", "concurrency", "requests", "latency", "texts/s")
+		for _, r := range report.Embedding {
+			if r.Error != "" {
+				fmt.Printf("  %-6d %-11d failed: %s\n", r.BatchSize, r.Concurrency, r.Error)
+				continue
+			}
+			fmt.Printf("  %-6d %-11d %-9d %-12s %.1f\n",
+				r.BatchSize, r.Concurrency, r.Requests, r.Latency.Truncate(time.Millisecond), r.TextsPerSecond)
+		}
+	}
+	if err != nil {
+		fmt.Printf("\nBenchmark failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+
+	s := report.Store
+	fmt.Printf("\nVector store (%d dimensions, %d points):\n", s.Dimension, s.Points)
+	if s.Error != "" {
+		fmt.Printf("  failed: %s\n", s.Error)
+	} else {
+		fmt.Printf("  upsert: %s per request\n", s.UpsertLatency.Truncate(time.Millisecond))
+		fmt.Printf("  search: p50 %s, p95 %s\n", s.SearchP50.Truncate(time.Millisecond), s.SearchP95.Truncate(time.Millisecond))
+	}
+
+	fmt.Println("\nRecommended settings for this machine:")
+	fmt.Printf("  rag.embedding.batch_size:  %d (current %d)\n", report.RecommendedBatchSize, cfg.RAG.Embedding.BatchSize)
+	fmt.Printf("  rag.embedding.concurrency: %d (current %d)\n", report.RecommendedConcurrency, cfg.RAG.Embedding.Concurrency)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const (
+	bootstrapComposeFile    = "docker-compose.rag.yml"
+	bootstrapQdrantImage    = "qdrant/qdrant:v1.9.3"
+	bootstrapEmbeddingImage = "ghcr.io/huggingface/text-embeddings-inference:cpu-1.5"
+	bootstrapEmbeddingModel = "BAAI/bge-small-en-v1.5"
+	bootstrapQdrantURL      = "http://127.0.0.1:6333"
+	bootstrapEmbeddingURL   = "http://127.0.0.1:8081"
+	bootstrapWaitTimeout    = 5 * time.Minute
+)
+
+type bootstrapOptions struct {
+	dir             string
+	vault           string
+	localEmbeddings bool
+	model           string
+	up              bool
+	force           bool
+}
+
+func ragBootstrapCmd(args []string) {
+	opts := bootstrapOptions{dir: ".", model: bootstrapEmbeddingModel}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dir":
+			if i+1 < len(args) {
+				opts.dir = args[i+1]
+				i++
+			}
+		case "--vault":
+			if i+1 < len(args) {
+				opts.vault = args[i+1]
+				i++
+			}
+		case "--model":
+			if i+1 < len(args) {
+				opts.model = args[i+1]
+				i++
+			}
+		case "--local-embeddings":
+			opts.localEmbeddings = true
+		case "--up":
+			opts.up = true
+		case "--force":
+			opts.force = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	composePath, err := writeBootstrapFiles(cfg, getConfigPath(), opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Wrote %s\n", composePath)
+	fmt.Printf("✓ Updated rag section of %s\n", getConfigPath())
+	if cfg.RAG.Embedding.APIBase == "" || cfg.RAG.Embedding.Model == "" {
+		fmt.Println("  Set rag.embedding.api_base, api_key and model, or rerun with --local-embeddings.")
+	}
+
+	if !opts.up {
+		fmt.Println("\nNext steps:")
+		fmt.Printf("  docker compose -f %s up -d\n", composePath)
+		fmt.Println("  picoclaw rag index")
+		return
+	}
+
+	fmt.Println("Starting containers...")
+	cmd := exec.Command("docker", "compose", "-f", composePath, "up", "-d")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("docker compose failed: %v\n", err)
+		return
+	}
+
+	fmt.Println("Waiting for Qdrant...")
+	if err := waitForHTTP(bootstrapQdrantURL+"/readyz", bootstrapWaitTimeout); err != nil {
+		fmt.Printf("Qdrant did not become ready: %v\n", err)
+		return
+	}
+	if opts.localEmbeddings {
+		fmt.Println("Waiting for the embedding server (the first start downloads the model)...")
+		if err := waitForHTTP(bootstrapEmbeddingURL+"/health", bootstrapWaitTimeout); err != nil {
+			fmt.Printf("Embedding server did not become ready: %v\n", err)
+			return
+		}
+	}
+	fmt.Println("✓ RAG stack is up")
+
+	if cfg.RAG.Embedding.APIBase == "" || cfg.RAG.Embedding.Model == "" {
+		fmt.Println("Skipping the first index until an embedding provider is configured.")
+		return
+	}
+	ragIndexCmd(nil)
+}
+
+// writeBootstrapFiles writes the compose file into opts.dir and saves cfg,
+// pointed at the stack, to configPath. It returns the compose file's path.
+// An existing compose file is only replaced with opts.force, and the config
+// is left alone when the compose file cannot be written.
+func writeBootstrapFiles(cfg *config.Config, configPath string, opts bootstrapOptions) (string, error) {
+	composePath := filepath.Join(config.ExpandPath(opts.dir), bootstrapComposeFile)
+	if _, err := os.Stat(composePath); err == nil && !opts.force {
+		return "", fmt.Errorf("%s already exists; use --force to overwrite it", composePath)
+	}
+	if err := os.MkdirAll(filepath.Dir(composePath), 0755); err != nil {
+		return "", fmt.Errorf("creating %s: %w", filepath.Dir(composePath), err)
+	}
+	if err := os.WriteFile(composePath, []byte(bootstrapCompose(opts)), 0644); err != nil {
+		return "", fmt.Errorf("writing %s: %w", composePath, err)
+	}
+	applyBootstrapConfig(cfg, opts)
+	if err := config.SaveConfig(configPath, cfg); err != nil {
+		return "", fmt.Errorf("saving config: %w", err)
+	}
+	return composePath, nil
+}
+
+// bootstrapCompose renders the compose file for the RAG stack. Ports are
+// only published on loopback since picoclaw runs on the host.
+func bootstrapCompose(opts bootstrapOptions) string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by `picoclaw rag bootstrap`.\n")
+	sb.WriteString("services:\n")
+	sb.WriteString("  qdrant:\n")
+	sb.WriteString("    image: " + bootstrapQdrantImage + "\n")
+	sb.WriteString("    restart: unless-stopped\n")
+	sb.WriteString("    ports:\n")
+	sb.WriteString("      - \"127.0.0.1:6333:6333\"\n")
+	sb.WriteString("    volumes:\n")
+	sb.WriteString("      - qdrant-data:/qdrant/storage\n")
+	if opts.localEmbeddings {
+		sb.WriteString("\n  embeddings:\n")
+		sb.WriteString("    image: " + bootstrapEmbeddingImage + "\n")
+		sb.WriteString("    restart: unless-stopped\n")
+		sb.WriteString(fmt.Sprintf("    command: [\"--model-id\", %q]\n", opts.model))
+		sb.WriteString("    ports:\n")
+		sb.WriteString("      - \"127.0.0.1:8081:80\"\n")
+		sb.WriteString("    volumes:\n")
+		sb.WriteString("      - embedding-models:/data\n")
+	}
+	sb.WriteString("\nvolumes:\n")
+	sb.WriteString("  qdrant-data:\n")
+	if opts.localEmbeddings {
+		sb.WriteString("  embedding-models:\n")
+	}
+	return sb.String()
+}
+
+// applyBootstrapConfig points the rag config at the generated stack.
+func applyBootstrapConfig(cfg *config.Config, opts bootstrapOptions) {
+	cfg.RAG.Enabled = true
+	cfg.RAG.VectorDB.URL = bootstrapQdrantURL
+	if opts.vault != "" {
+		cfg.RAG.VaultPath = config.VaultPaths{opts.vault}
+	}
+	if opts.localEmbeddings {
+		cfg.RAG.Embedding.APIBase = bootstrapEmbeddingURL + "/v1"
+		cfg.RAG.Embedding.APIKey = ""
+		cfg.RAG.Embedding.Model = opts.model
+		// Detected from the first response; models differ in output size.
+		cfg.RAG.Embedding.Dimension = 0
+	}
+}
+
+// waitForHTTP polls url until it answers 200 or timeout passes.
+func waitForHTTP(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		lastErr = err
+		time.Sleep(2 * time.Second)
+	}
+	return fmt.Errorf("timed out after %s: %w", timeout, lastErr)
+}
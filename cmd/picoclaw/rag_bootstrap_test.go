@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestWriteBootstrapFiles(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.RAG.Embedding.APIBase = "https://api.openai.com/v1"
+	cfg.RAG.Embedding.Model = "text-embedding-3-small"
+	opts := bootstrapOptions{dir: filepath.Join(dir, "stack"), vault: "~/notes", model: bootstrapEmbeddingModel}
+
+	composePath, err := writeBootstrapFiles(cfg, configPath, opts)
+	if err != nil {
+		t.Fatalf("writeBootstrapFiles() error: %v", err)
+	}
+	compose, err := os.ReadFile(composePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(compose), bootstrapQdrantImage) || strings.Contains(string(compose), "embeddings:") {
+		t.Errorf("compose file without --local-embeddings:\n%s", compose)
+	}
+
+	saved, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("saved config does not load: %v", err)
+	}
+	if !saved.RAG.Enabled || saved.RAG.VectorDB.URL != bootstrapQdrantURL || saved.RAG.VaultPath[0] != "~/notes" {
+		t.Errorf("saved rag config = %+v", saved.RAG)
+	}
+	if saved.RAG.Embedding.Model != "text-embedding-3-small" {
+		t.Errorf("embedding model = %q, want the configured provider kept", saved.RAG.Embedding.Model)
+	}
+
+	// An existing compose file is kept without --force, and so is the config.
+	os.WriteFile(composePath, []byte("mine"), 0644)
+	os.Remove(configPath)
+	if _, err := writeBootstrapFiles(cfg, configPath, opts); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("writeBootstrapFiles() over an existing file error = %v, want a hint at --force", err)
+	}
+	if data, _ := os.ReadFile(composePath); string(data) != "mine" {
+		t.Error("existing compose file overwritten without --force")
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Error("config saved although the compose file was not written")
+	}
+
+	opts.force = true
+	opts.localEmbeddings = true
+	if _, err := writeBootstrapFiles(cfg, configPath, opts); err != nil {
+		t.Fatalf("writeBootstrapFiles() with --force error: %v", err)
+	}
+	compose, _ = os.ReadFile(composePath)
+	if !strings.Contains(string(compose), `"--model-id", "BAAI/bge-small-en-v1.5"`) {
+		t.Errorf("compose file with --local-embeddings:\n%s", compose)
+	}
+	saved, _ = config.LoadConfig(configPath)
+	if saved.RAG.Embedding.APIBase != bootstrapEmbeddingURL+"/v1" || saved.RAG.Embedding.Model != bootstrapEmbeddingModel {
+		t.Errorf("embedding config = %+v, want the local server", saved.RAG.Embedding)
+	}
+}
+
+func TestBootstrapComposeLoopbackOnly(t *testing.T) {
+	compose := bootstrapCompose(bootstrapOptions{localEmbeddings: true, model: "m"})
+	for _, line := range strings.Split(compose, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "- \"") && strings.Contains(line, ":") && !strings.HasPrefix(line, "- \"127.0.0.1:") {
+			t.Errorf("port published beyond loopback: %s", line)
+		}
+	}
+}
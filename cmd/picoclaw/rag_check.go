@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragCheckCmd exits 0 when the index is fresh, 1 when it is stale and 2 when
+// freshness could not be determined, so scripts and CI can gate on it.
+func ragCheckCmd(args []string) {
+	var maxStaleness time.Duration
+	maxPending := -1
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--max-staleness":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					fmt.Printf("Invalid --max-staleness %q: %v\n", args[i+1], err)
+					os.Exit(2)
+				}
+				maxStaleness = d
+				i++
+			}
+		case "--max-pending":
+			if i+1 < len(args) {
+				if _, err := fmt.Sscanf(args[i+1], "%d", &maxPending); err != nil {
+					fmt.Printf("Invalid --max-pending %q\n", args[i+1])
+					os.Exit(2)
+				}
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(2)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(2)
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(2)
+	}
+
+	// With rag.shared_state the index may have been built on another device.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := service.PullState(ctx); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	cancel()
+
+	f, err := service.Freshness()
+	if errors.Is(err, rag.ErrIndexNotBuilt) {
+		fmt.Println("✗ Index has not been built; run: picoclaw rag index")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Check failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		os.Exit(2)
+	}
+
+	age := time.Since(f.UpdatedAt)
+	fmt.Printf("Last indexed: %s (%s ago)\n", f.UpdatedAt.Local().Format(time.RFC3339), age.Truncate(time.Second))
+	fmt.Printf("Pending: %d new, %d modified, %d deleted\n", f.NewFiles, f.ModifiedFiles, f.DeletedFiles)
+
+	var problems []string
+	if maxStaleness > 0 && age > maxStaleness {
+		problems = append(problems, fmt.Sprintf("index is older than %s", maxStaleness))
+	}
+	if maxPending >= 0 && f.PendingFiles() > maxPending {
+		problems = append(problems, fmt.Sprintf("%d pending file(s) exceed the limit of %d", f.PendingFiles(), maxPending))
+	}
+	if f.FullReindexReason != "" {
+		problems = append(problems, "full rebuild pending: "+f.FullReindexReason)
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("✗ %s\n", p)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("✓ Index is fresh")
+}
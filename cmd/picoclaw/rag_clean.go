@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+var ragDataDescriptions = map[string]string{
+	rag.DataState:   "index state, anonymization map and feedback marks; removing it forces a full reindex",
+	rag.DataReports: "report of the last index run",
+	rag.DataCaches:  "transcripts, summaries, spelling vocabulary; rebuilt with API calls",
+	rag.DataRemote:  "remote vault mirrors; downloaded again in full",
+	rag.DataLogs:    "query log for rag coverage, context audit log",
+	rag.DataTrash:   "deleted points kept for rag undo-delete",
+	rag.DataOther:   "not created by picoclaw; never removed",
+}
+
+// ragCleanCmd reports the disk use of the RAG data directory and removes
+// the categories given with --remove, or the old query log entries.
+func ragCleanCmd(args []string) {
+	var remove []string
+	var logsOlderThan time.Duration
+	var logsAge string
+	yes := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--remove":
+			if i+1 < len(args) {
+				for _, c := range strings.Split(args[i+1], ",") {
+					if c = strings.TrimSpace(c); c != "" {
+						remove = append(remove, c)
+					}
+				}
+				i++
+			}
+		case "--logs-older-than":
+			if i+1 < len(args) {
+				d, err := parseAge(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Invalid --logs-older-than %q\n", args[i+1])
+					os.Exit(1)
+				}
+				logsOlderThan, logsAge = d, args[i+1]
+				i++
+			}
+		case "--yes", "-y":
+			yes = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	dataDir := cfg.RagDataDir()
+	usage, err := rag.DataDirUsage(dataDir)
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", dataDir, err)
+		os.Exit(1)
+	}
+	fmt.Printf("RAG data directory: %s\n\n", dataDir)
+	var total int64
+	for _, u := range usage {
+		total += u.Bytes
+		fmt.Printf("  %-8s %10s  %5d files  %s\n", u.Category, rag.FormatBytes(u.Bytes), u.Files, ragDataDescriptions[u.Category])
+	}
+	fmt.Printf("  %-8s %10s\n", "total", rag.FormatBytes(total))
+	if len(remove) == 0 && logsOlderThan == 0 {
+		fmt.Println("\nUse --remove <categories> or --logs-older-than <age> to free space.")
+		return
+	}
+
+	var actions []string
+	if len(remove) > 0 {
+		actions = append(actions, "remove "+strings.Join(remove, ", "))
+	}
+	if logsOlderThan > 0 {
+		actions = append(actions, "drop query log entries older than "+logsAge)
+	}
+	fmt.Println()
+	if !yes && !promptYes(bufio.NewReader(os.Stdin), strings.Join(actions, " and ")+"?", false) {
+		return
+	}
+	if len(remove) > 0 {
+		freed, err := rag.CleanDataDir(dataDir, remove)
+		if err != nil {
+			fmt.Printf("Clean failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Removed %s, freed %s\n", strings.Join(remove, ", "), rag.FormatBytes(freed))
+	}
+	if logsOlderThan > 0 {
+		dropped, freed, err := rag.TrimQueryLog(dataDir, time.Now().Add(-logsOlderThan))
+		if err != nil {
+			fmt.Printf("Trimming the query log failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Dropped %d query log entries, freed %s\n", dropped, rag.FormatBytes(freed))
+	}
+}
+
+// parseAge is time.ParseDuration that also accepts whole days, e.g. "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
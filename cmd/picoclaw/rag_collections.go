@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragCollectionsCmd lists the collections on the Qdrant server and prunes
+// the ones picoclaw no longer uses.
+func ragCollectionsCmd(args []string) {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "prune") {
+		fmt.Println("Usage: picoclaw rag collections list|prune [--yes]")
+		return
+	}
+	yes := false
+	for _, arg := range args[1:] {
+		if arg == "--yes" || arg == "-y" {
+			yes = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+	infos, err := service.Collections(ctx)
+	if err != nil {
+		fmt.Printf("Listing collections failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+
+	var prunable []string
+	for _, info := range infos {
+		status := "not picoclaw"
+		switch {
+		case info.InUse:
+			status = "in use"
+		case info.Picoclaw:
+			status = "unused"
+			prunable = append(prunable, info.Name)
+		}
+		fmt.Printf("  %-32s %8d points  %s\n", info.Name, info.Points, status)
+	}
+	if args[0] == "list" {
+		return
+	}
+
+	if len(prunable) == 0 {
+		fmt.Println("Nothing to prune.")
+		return
+	}
+	if !yes && !promptYes(bufio.NewReader(os.Stdin), fmt.Sprintf("Delete %d unused collection(s)?", len(prunable)), false) {
+		return
+	}
+	pruned, err := service.PruneCollections(ctx)
+	for _, name := range pruned {
+		fmt.Printf("✓ Deleted %s\n", name)
+	}
+	if err != nil {
+		fmt.Printf("Prune failed: %v\n", err)
+	}
+}
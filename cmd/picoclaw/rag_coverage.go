@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragCoverageCmd reports which notes the logged searches retrieve, only
+// come close to, or never reach.
+func ragCoverageCmd(args []string) {
+	var since time.Time
+	top := 10
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Invalid --since %q\n", args[i+1])
+					os.Exit(1)
+				}
+				since = time.Now().Add(-d)
+				i++
+			}
+		case "--top":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &top)
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(1)
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	report, err := service.Coverage(since)
+	if err != nil {
+		fmt.Printf("Coverage failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	notes := len(report.Retrieved) + len(report.BelowThreshold) + len(report.Never)
+	fmt.Printf("%d searches, %d of %d notes retrieved\n", report.Queries, len(report.Retrieved), notes)
+
+	fmt.Println("\nFolders:")
+	for _, f := range report.Folders {
+		share := float64(f.Retrieved) / float64(f.Notes)
+		fmt.Printf("  %-10s %3d/%-3d notes  %5d hits  %s\n", coverageBar(share), f.Retrieved, f.Notes, f.Hits, f.Folder)
+	}
+
+	fmt.Println("\nMost retrieved:")
+	for idx, n := range report.Retrieved {
+		if idx == top {
+			break
+		}
+		fmt.Printf("  %5d  %s\n", n.Hits, n.Path)
+	}
+	if len(report.BelowThreshold) > 0 {
+		fmt.Printf("\nOnly below min_similarity (%.2f):\n", cfg.RAG.MinSimilarity)
+		for idx, n := range report.BelowThreshold {
+			if idx == top {
+				fmt.Printf("  ... and %d more\n", len(report.BelowThreshold)-top)
+				break
+			}
+			fmt.Printf("  %5d  best %.2f  %s\n", n.NearMisses, n.BestMiss, n.Path)
+		}
+	}
+	if len(report.Never) > 0 {
+		fmt.Println("\nNever retrieved:")
+		for idx, p := range report.Never {
+			if idx == top {
+				fmt.Printf("  ... and %d more\n", len(report.Never)-top)
+				break
+			}
+			fmt.Printf("  %s\n", p)
+		}
+	}
+}
+
+// coverageBar draws share, from 0 to 1, as a ten-cell bar.
+func coverageBar(share float64) string {
+	filled := int(share*10 + 0.5)
+	bar := make([]rune, 10)
+	for idx := range bar {
+		bar[idx] = '░'
+		if idx < filled {
+			bar[idx] = '█'
+		}
+	}
+	return string(bar)
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/health"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// startRagAutoIndex sets up background indexing for the gateway: on the
+// auto_index schedule when enabled, and on SIGUSR1 whenever RAG is enabled.
+// The returned runner is nil when RAG is disabled or misconfigured.
+func startRagAutoIndex(ctx context.Context, cfg *config.Config, msgBus *bus.MessageBus) *rag.IndexRunner {
+	if !cfg.RAG.Enabled {
+		return nil
+	}
+
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		logger.WarnCF("rag", "Background index disabled due to config error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	return startRagIndexRunner(ctx, cfg, service, msgBus)
+}
+
+// startRagIndexRunner wires the schedule and SIGUSR1 to a runner for service.
+// msgBus may be nil when no chat channels are running.
+func startRagIndexRunner(ctx context.Context, cfg *config.Config, service *rag.Service, msgBus *bus.MessageBus) *rag.IndexRunner {
+	if err := setRagSummarizer(cfg, service); err != nil {
+		logger.WarnCF("rag", "Summary levels disabled: no LLM provider", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	notifications := cfg.RAG.Notifications
+	runner := rag.NewIndexRunner(ctx, service, func(trigger string, summary *rag.IndexSummary, err error) {
+		logRagIndexRun(trigger, summary, err)
+		notifyRagIndexRun(ctx, notifications, msgBus, rag.NewIndexNotification(trigger, summary, err))
+	})
+
+	sigChan := make(chan os.Signal, 1)
+	if notifyIndexSignal(sigChan) {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-sigChan:
+					triggerRagIndex(runner, rag.IndexTriggerSignal)
+				}
+			}
+		}()
+	}
+
+	if !cfg.RAG.AutoIndex.Enabled {
+		return runner
+	}
+
+	intervalHours := cfg.RAG.AutoIndex.IntervalHours
+	if intervalHours <= 0 {
+		intervalHours = 12
+	}
+
+	logger.InfoCF("rag", "Auto index scheduled", map[string]interface{}{
+		"interval_hours": intervalHours,
+	})
+
+	interval := time.Duration(intervalHours) * time.Hour
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				triggerRagIndex(runner, rag.IndexTriggerSchedule)
+			}
+		}
+	}()
+	return runner
+}
+
+func triggerRagIndex(runner *rag.IndexRunner, trigger string) {
+	if runner.Trigger(trigger) {
+		logger.InfoCF("rag", "Index run started", map[string]interface{}{"trigger": trigger})
+		return
+	}
+	logger.InfoCF("rag", "Index run already in progress", map[string]interface{}{"trigger": trigger})
+}
+
+func logRagIndexRun(trigger string, summary *rag.IndexSummary, err error) {
+	if err != nil {
+		logger.WarnCF("rag", "Index run failed", map[string]interface{}{
+			"trigger": trigger,
+			"error":   err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("rag", "Index run completed", map[string]interface{}{
+		"trigger":       trigger,
+		"total_files":   summary.TotalFiles,
+		"indexed_files": summary.IndexedFiles,
+		"updated_files": summary.UpdatedFiles,
+		"removed_files": summary.RemovedFiles,
+		"skipped_files": summary.SkippedFiles,
+		"chunks":        summary.Chunks,
+		"failed_files":  summary.FailedFiles,
+		"full_reindex":  summary.FullReindexReason,
+	})
+	for _, f := range summary.Failures {
+		logger.WarnCF("rag", "Index run skipped file", map[string]interface{}{
+			"trigger": trigger,
+			"path":    f.Path,
+			"error":   f.Error,
+		})
+	}
+}
+
+// notifyRagIndexRun sends n to the configured webhook and chat channels.
+func notifyRagIndexRun(ctx context.Context, cfg config.RagNotificationsConfig, msgBus *bus.MessageBus, n rag.IndexNotification) {
+	if (n.HasFailures() && !cfg.OnFailure) || (!n.HasFailures() && !cfg.OnSuccess) {
+		return
+	}
+	if cfg.WebhookURL != "" {
+		if err := rag.PostIndexWebhook(ctx, cfg.WebhookURL, n); err != nil {
+			logger.WarnCF("rag", "Index notification webhook failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	sendRagChannels(cfg.Channels, msgBus, n.Text())
+}
+
+// sendRagChannels publishes content to "platform:chat_id" targets through the
+// gateway's channels.
+func sendRagChannels(targets []string, msgBus *bus.MessageBus, content string) {
+	for _, target := range targets {
+		platform, chatID, ok := strings.Cut(target, ":")
+		if !ok || platform == "" || chatID == "" {
+			logger.WarnCF("rag", "Invalid notification channel, expected platform:chat_id", map[string]interface{}{
+				"channel": target,
+			})
+			continue
+		}
+		if msgBus == nil {
+			logger.WarnCF("rag", "Channel notifications need the gateway", map[string]interface{}{
+				"channel": target,
+			})
+			continue
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: platform,
+			ChatID:  chatID,
+			Content: content,
+		})
+	}
+}
+
+// registerRagAdmin exposes POST /admin/index and GET /admin/index/status on
+// the gateway's health server, with the destructive POST /admin/purge and
+// POST /admin/collections/prune.
+func registerRagAdmin(server *health.Server, cfg *config.Config, runner *rag.IndexRunner) {
+	token := cfg.RAG.AutoIndex.AdminToken
+	opToken := cfg.RAG.Guardrails.AdminToken
+
+	server.Handle("/admin/index", func(w http.ResponseWriter, r *http.Request) {
+		full, _ := strconv.ParseBool(r.URL.Query().Get("full"))
+		if full {
+			if !ragAdminOpAuthorized(w, r, opToken) {
+				return
+			}
+		} else if !ragAdminAuthorized(r, token) {
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if full && !authorizeRagAdminOp(w, r, runner.Service(), rag.OpFullReindex) {
+			return
+		}
+		trigger := runner.Trigger
+		if full {
+			trigger = runner.TriggerFull
+		}
+		status := http.StatusAccepted
+		if !trigger(rag.IndexTriggerAdmin) {
+			status = http.StatusConflict
+		} else {
+			logger.InfoCF("rag", "Index run started", map[string]interface{}{"trigger": rag.IndexTriggerAdmin, "full": full})
+		}
+		writeAdminJSON(w, status, runner.Status())
+	})
+
+	server.Handle("/admin/purge", func(w http.ResponseWriter, r *http.Request) {
+		if !ragAdminOpAuthorized(w, r, opToken) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorizeRagAdminOp(w, r, runner.Service(), rag.OpPurge) {
+			return
+		}
+		if runner.Status().Running {
+			writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "an index run is in progress"})
+			return
+		}
+		if err := runner.Service().Purge(r.Context()); err != nil {
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]bool{"purged": true})
+	})
+
+	server.Handle("/admin/collections/prune", func(w http.ResponseWriter, r *http.Request) {
+		if !ragAdminOpAuthorized(w, r, opToken) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorizeRagAdminOp(w, r, runner.Service(), rag.OpPruneCollections) {
+			return
+		}
+		pruned, err := runner.Service().PruneCollections(r.Context())
+		if err != nil {
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "pruned": pruned})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"pruned": pruned})
+	})
+
+	server.Handle("/admin/index/status", func(w http.ResponseWriter, r *http.Request) {
+		if !ragAdminAuthorized(r, token) {
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, runner.Status())
+	})
+}
+
+// ragAdminAuthorized checks the bearer token, or without one configured,
+// that the request comes from the same host.
+func ragAdminAuthorized(r *http.Request, token string) bool {
+	if token != "" {
+		return ragBearerMatches(r, token)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func ragBearerMatches(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// ragAdminOpAuthorized checks the bearer token of a destructive admin
+// request, rag.guardrails.admin_token, which is required even from the same
+// host. Without one configured the endpoints refuse every request.
+func ragAdminOpAuthorized(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		writeAdminJSON(w, http.StatusForbidden, map[string]string{"error": "rag.guardrails.admin_token is not set"})
+		return false
+	}
+	if !ragBearerMatches(r, token) {
+		writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return false
+	}
+	return true
+}
+
+// authorizeRagAdminOp applies rag.guardrails to a destructive admin request,
+// already authorized by ragAdminOpAuthorized. Without a valid "confirm" query
+// parameter it answers 428 with a token to repeat the request with.
+func authorizeRagAdminOp(w http.ResponseWriter, r *http.Request, service *rag.Service, op rag.Operation) bool {
+	err := service.Authorize(op, rag.Caller{Channel: "http", Trusted: true}, r.URL.Query().Get("confirm"))
+	var confirm *rag.ConfirmationError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &confirm):
+		writeAdminJSON(w, http.StatusPreconditionRequired, map[string]interface{}{
+			"error":      "confirmation required",
+			"operation":  confirm.Operation,
+			"confirm":    confirm.Token,
+			"expires_at": confirm.Expires,
+		})
+	default:
+		writeAdminJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	return false
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ragShutdownTimeout bounds how long shutdown waits for an index run to
+// finish its current file before aborting it.
+const ragShutdownTimeout = 30 * time.Second
+
+// stopRagIndexRunner lets the run in progress finish its current file, and
+// aborts it via cancel if that takes longer than ragShutdownTimeout.
+func stopRagIndexRunner(runner *rag.IndexRunner, cancel context.CancelFunc) {
+	shutdownCtx, done := context.WithTimeout(context.Background(), ragShutdownTimeout)
+	defer done()
+	if err := runner.Shutdown(shutdownCtx); err != nil {
+		logger.WarnCF("rag", "Index run did not stop in time, aborting", map[string]interface{}{
+			"timeout": ragShutdownTimeout.String(),
+		})
+		cancel()
+		runner.Wait()
+	}
+}
+
+// ragReadyInterval is how often rag serve re-checks readiness.
+const ragReadyInterval = 15 * time.Second
+
+func ragServeCmd(args []string) {
+	daemon := false
+	listen := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--daemon":
+			daemon = true
+		case "--listen":
+			if i+1 < len(args) {
+				listen = args[i+1]
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(1)
+	}
+
+	host, port := cfg.Gateway.Host, cfg.Gateway.Port
+	if listen != "" {
+		h, p, err := net.SplitHostPort(listen)
+		if err == nil {
+			port, err = strconv.Atoi(p)
+		}
+		if err != nil {
+			fmt.Printf("Invalid --listen address %q: expected host:port\n", listen)
+			os.Exit(1)
+		}
+		host = h
+	}
+
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := startRagIndexRunner(ctx, cfg, service, nil)
+
+	server := health.NewServer(host, port)
+	registerRagAdmin(server, cfg, runner)
+	// Not ready until the first readiness check passes.
+	server.RegisterCheck("rag", func() (bool, string) { return false, "starting" })
+	go func() {
+		if err := server.Start(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	if !daemon {
+		fmt.Printf("✓ RAG server listening on http://%s:%d (/healthz, /readyz, /admin/index)\n", host, port)
+		fmt.Println("Press Ctrl+C to stop")
+	}
+
+	go watchRagReady(ctx, service, server, runner, daemon)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	logger.InfoC("rag", "Shutting down RAG server")
+	if daemon {
+		sdNotify("STOPPING=1")
+	}
+	server.SetReady(false)
+	stopRagIndexRunner(runner, cancel)
+	cancel()
+	server.Stop(context.Background())
+	if !daemon {
+		fmt.Println("✓ RAG server stopped")
+	}
+}
+
+// watchRagReady re-checks readiness periodically, building the index first
+// if there is none yet. Under --daemon it tells the service manager once the
+// service first becomes ready.
+func watchRagReady(ctx context.Context, service *rag.Service, server *health.Server, runner *rag.IndexRunner, daemon bool) {
+	err := checkRagReady(ctx, service, server)
+	if errors.Is(err, rag.ErrIndexNotBuilt) {
+		triggerRagIndex(runner, rag.IndexTriggerStartup)
+	}
+	notified := false
+	ticker := time.NewTicker(ragReadyInterval)
+	defer ticker.Stop()
+	for {
+		if err == nil && daemon && !notified {
+			if _, err := sdNotify("READY=1"); err != nil {
+				logger.WarnCF("rag", "sd_notify failed", map[string]interface{}{"error": err.Error()})
+			}
+			notified = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err = checkRagReady(ctx, service, server)
+	}
+}
+
+// checkRagReady records the service's readiness as the "rag" health check.
+func checkRagReady(ctx context.Context, service *rag.Service, server *health.Server) error {
+	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := service.CheckReady(checkCtx)
+	server.RegisterCheck("rag", func() (bool, string) {
+		if err != nil {
+			return false, err.Error()
+		}
+		return true, "index loaded, vector store reachable"
+	})
+	return err
+}
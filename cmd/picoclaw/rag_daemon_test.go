@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRagAdminOpRequiresToken(t *testing.T) {
+	request := func(auth string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/admin/purge", nil)
+		r.RemoteAddr = "127.0.0.1:40000"
+		if auth != "" {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		}
+		return r
+	}
+	for _, tc := range []struct {
+		token, auth string
+		ok          bool
+		status      int
+	}{
+		{token: "", auth: "", status: http.StatusForbidden},
+		{token: "", auth: "anything", status: http.StatusForbidden},
+		{token: "s3cret", auth: "", status: http.StatusUnauthorized},
+		{token: "s3cret", auth: "wrong", status: http.StatusUnauthorized},
+		{token: "s3cret", auth: "s3cret", ok: true, status: http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		if ok := ragAdminOpAuthorized(w, request(tc.auth), tc.token); ok != tc.ok || w.Code != tc.status {
+			t.Errorf("token %q, bearer %q from loopback: ok = %v, status %d; want %v, %d",
+				tc.token, tc.auth, ok, w.Code, tc.ok, tc.status)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragDiffCmd lists the notes added, removed and modified in the index between
+// two dates, from the snapshots kept by rag.state_history.
+func ragDiffCmd(args []string) {
+	var since, until time.Time
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since", "--until":
+			if i+1 >= len(args) {
+				fmt.Printf("%s needs a date\n", args[i])
+				os.Exit(1)
+			}
+			t, err := parseDiffDate(args[i+1])
+			if err != nil {
+				fmt.Printf("Invalid %s %q: use 2006-01-02, \"2006-01-02 15:04\" or RFC 3339\n", args[i], args[i+1])
+				os.Exit(1)
+			}
+			if args[i] == "--since" {
+				since = t
+			} else {
+				until = t
+			}
+			i++
+		}
+	}
+	if since.IsZero() {
+		fmt.Println("Usage: picoclaw rag diff --since DATE [--until DATE]")
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(1)
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	diff, err := service.Diff(since, until)
+	if err != nil {
+		fmt.Printf("Diff failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Index changes from %s to %s\n", diff.From.Local().Format("2006-01-02 15:04"), diff.To.Local().Format("2006-01-02 15:04"))
+	printDiffSection("Added", "+", diff.Added)
+	printDiffSection("Removed", "-", diff.Removed)
+	printDiffSection("Modified", "~", diff.Modified)
+	if len(diff.Added)+len(diff.Removed)+len(diff.Modified) == 0 {
+		fmt.Println("\nNo notes changed.")
+	}
+	fmt.Printf("\nChunks: %d -> %d (%+d)\n", diff.ChunksBefore, diff.ChunksAfter, diff.ChunksAfter-diff.ChunksBefore)
+}
+
+func printDiffSection(title, mark string, changes []rag.DocumentChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d):\n", title, len(changes))
+	for _, c := range changes {
+		fmt.Printf("  %s %s  %s\n", mark, c.Path, chunkDelta(c))
+	}
+}
+
+// chunkDelta describes how the chunk count of a note changed, with "?" for
+// counts from before they were recorded.
+func chunkDelta(c rag.DocumentChange) string {
+	count := func(n int) string {
+		if n < 0 {
+			return "?"
+		}
+		return fmt.Sprint(n)
+	}
+	if c.ChunksBefore < 0 || c.ChunksAfter < 0 {
+		return fmt.Sprintf("(%s -> %s chunks)", count(c.ChunksBefore), count(c.ChunksAfter))
+	}
+	return fmt.Sprintf("(%d -> %d chunks, %+d)", c.ChunksBefore, c.ChunksAfter, c.ChunksAfter-c.ChunksBefore)
+}
+
+// parseDiffDate reads a date, a local date and time, or an RFC 3339 time.
+func parseDiffDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragDigestCmd prints a digest of the notes changed in the last --since,
+// and with --write saves it into the vault.
+func ragDigestCmd(args []string) {
+	since := 24 * time.Hour
+	write := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Invalid --since %q\n", args[i+1])
+					os.Exit(1)
+				}
+				since = d
+				i++
+			}
+		case "--write":
+			write = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(1)
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	service.SetTargetModel(cfg.Agents.Defaults.Model)
+	ctx := context.Background()
+	digest, err := service.Digest(ctx, rag.DigestOptions{Since: since}, ragSummarizer(provider, cfg.Agents.Defaults.Model))
+	if err != nil {
+		fmt.Printf("Digest failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		os.Exit(1)
+	}
+	fmt.Print(digest.Markdown())
+	if write && digest.Notes() > 0 {
+		rel, err := service.WriteDigest(ctx, digest)
+		if err != nil {
+			fmt.Printf("Writing the digest failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n✓ Saved to %s\n", rel)
+	}
+}
+
+// ragSummarizer runs digest prompts through the agent's provider and model.
+func ragSummarizer(provider providers.LLMProvider, model string) rag.Summarizer {
+	return func(ctx context.Context, prompt string) (string, error) {
+		resp, err := provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, model, map[string]interface{}{
+			"max_tokens":  1024,
+			"temperature": 0.3,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Content, nil
+	}
+}
+
+// setRagSummarizer gives service the agent's LLM for the summary levels of
+// rag.hierarchical. It does nothing when they are off.
+func setRagSummarizer(cfg *config.Config, service *rag.Service) error {
+	if !cfg.RAG.Hierarchical.Enabled {
+		return nil
+	}
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		return err
+	}
+	// The model is recorded with the summary prompts in rag.audit_log.
+	service.SetTargetModel(cfg.Agents.Defaults.Model)
+	service.SetSummarizer(ragSummarizer(provider, cfg.Agents.Defaults.Model))
+	return nil
+}
+
+// startRagDigest builds a digest every rag.digest.interval_hours in the
+// gateway, writes it into the vault when rag.digest.write is set and sends it
+// to rag.digest.channels. Empty digests are skipped.
+func startRagDigest(ctx context.Context, cfg *config.Config, provider providers.LLMProvider, msgBus *bus.MessageBus) {
+	if !cfg.RAG.Enabled || !cfg.RAG.Digest.Enabled {
+		return
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		logger.WarnCF("rag", "Digest disabled due to config error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	intervalHours := cfg.RAG.Digest.IntervalHours
+	if intervalHours <= 0 {
+		intervalHours = 24
+	}
+	interval := time.Duration(intervalHours) * time.Hour
+	service.SetTargetModel(cfg.Agents.Defaults.Model)
+	summarize := ragSummarizer(provider, cfg.Agents.Defaults.Model)
+	logger.InfoCF("rag", "Digest scheduled", map[string]interface{}{
+		"interval_hours": intervalHours,
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runRagDigest(ctx, cfg.RAG.Digest, service, interval, summarize, msgBus)
+			}
+		}
+	}()
+}
+
+func runRagDigest(ctx context.Context, cfg config.RagDigestConfig, service *rag.Service, since time.Duration, summarize rag.Summarizer, msgBus *bus.MessageBus) {
+	digest, err := service.Digest(ctx, rag.DigestOptions{Since: since}, summarize)
+	if err != nil {
+		logger.WarnCF("rag", "Digest failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if digest.Notes() == 0 {
+		return
+	}
+	if cfg.Write {
+		rel, err := service.WriteDigest(ctx, digest)
+		if err != nil {
+			logger.WarnCF("rag", "Writing the digest failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			logger.InfoCF("rag", "Digest written", map[string]interface{}{
+				"path":  rel,
+				"notes": digest.Notes(),
+			})
+		}
+	}
+	sendRagChannels(cfg.Channels, msgBus, digest.Markdown())
+}
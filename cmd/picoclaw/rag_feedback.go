@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragFeedbackCmd marks notes good or bad for rag.feedback, lists the learned
+// weights, or resets them.
+func ragFeedbackCmd(args []string) {
+	var (
+		mark  string
+		paths []string
+		user  string
+		reset bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
+		case "--reset":
+			reset = true
+		case "good", "bad":
+			if mark == "" && len(paths) == 0 && !reset {
+				mark = args[i]
+				continue
+			}
+			paths = append(paths, args[i])
+		default:
+			paths = append(paths, args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	var service *rag.Service
+	if user != "" {
+		service, err = userRagService(cfg, user)
+	} else {
+		service, err = rag.NewService(cfg, cfg.WorkspacePath())
+	}
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case reset:
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		removed := 0
+		for _, p := range paths {
+			n, err := service.ResetFeedback(p)
+			if err != nil {
+				fmt.Printf("Reset failed: %v\n", err)
+				os.Exit(1)
+			}
+			removed += n
+		}
+		fmt.Printf("✓ Forgot the feedback for %d notes\n", removed)
+	case mark != "":
+		if len(paths) == 0 {
+			fmt.Printf("Usage: picoclaw rag feedback %s PATH...\n", mark)
+			os.Exit(1)
+		}
+		results := make([]rag.SearchResult, len(paths))
+		for idx, p := range paths {
+			results[idx] = rag.SearchResult{Path: p}
+		}
+		marked, err := service.RecordFeedback(results, mark == "good")
+		if err != nil {
+			fmt.Printf("Recording feedback failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Marked %d notes %s\n", marked, mark)
+	default:
+		printFeedbackWeights(cfg.RAG, service)
+	}
+}
+
+func printFeedbackWeights(cfg config.RagConfig, service *rag.Service) {
+	weights, err := service.FeedbackWeights()
+	if err != nil {
+		fmt.Printf("Reading the feedback failed: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.Feedback.Enabled {
+		fmt.Println("rag.feedback.enabled is off; these weights are not applied.")
+	}
+	if len(weights) == 0 {
+		fmt.Println("No feedback recorded yet.")
+		return
+	}
+	fmt.Printf("%8s  %4s  %4s  %-10s  %s\n", "BOOST", "GOOD", "BAD", "LAST MARK", "NOTE")
+	for _, w := range weights {
+		fmt.Printf("%+8.4f  %4d  %4d  %-10s  %s\n", w.Boost, w.Good, w.Bad, w.Updated.Local().Format("2006-01-02"), w.Path)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+type embeddingPreset struct {
+	name    string
+	apiBase string
+	model   string
+	needKey bool
+}
+
+var embeddingPresets = []embeddingPreset{
+	{name: "OpenAI", apiBase: "https://api.openai.com/v1", model: "text-embedding-3-small", needKey: true},
+	{name: "SiliconFlow", apiBase: "https://api.siliconflow.cn/v1", model: "BAAI/bge-m3", needKey: true},
+	{name: "Ollama (local)", apiBase: "http://127.0.0.1:11434/v1", model: "nomic-embed-text"},
+	{name: "rag bootstrap --local-embeddings", apiBase: bootstrapEmbeddingURL + "/v1", model: bootstrapEmbeddingModel},
+	{name: "Other OpenAI-compatible API", needKey: true},
+}
+
+var vectorDBPresets = []struct {
+	name string
+	url  string
+}{
+	{name: "Qdrant on this machine", url: bootstrapQdrantURL},
+	{name: "Qdrant in the picoclaw docker-compose", url: "http://qdrant:6333"},
+	{name: "Other Qdrant URL"},
+}
+
+const ragProbeTimeout = 30 * time.Second
+
+// ragInitCmd walks through the rag section of the config interactively and
+// checks each backend before saving it.
+func ragInitCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	rc := cfg.RAG
+
+	fmt.Println("RAG setup. Press Enter to keep the value in brackets.")
+
+	// Vault
+	fmt.Println("\n1. Notes")
+	for {
+		current := ""
+		if len(rc.VaultPath) > 0 {
+			current = rc.VaultPath[0]
+		}
+		rc.VaultPath = config.VaultPaths{promptLine(in, "Vault path", current)}
+		stats, err := rag.ScanVault(rc)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		rc.ChunkSize, rc.ChunkOverlap = rag.SuggestChunking(stats)
+		fmt.Printf("  ✓ %d notes, %.1f MB; using chunk_size %d, chunk_overlap %d\n",
+			stats.Notes, float64(stats.Bytes)/(1<<20), rc.ChunkSize, rc.ChunkOverlap)
+		break
+	}
+
+	// Embedding
+	fmt.Println("\n2. Embedding provider")
+	for idx, p := range embeddingPresets {
+		fmt.Printf("  %d) %s\n", idx+1, p.name)
+	}
+	preset := embeddingPresets[promptChoice(in, len(embeddingPresets))-1]
+	if preset.apiBase != "" {
+		rc.Embedding.APIBase = preset.apiBase
+		rc.Embedding.Model = preset.model
+	}
+	if !preset.needKey {
+		rc.Embedding.APIKey = ""
+	}
+	for {
+		rc.Embedding.APIBase = promptLine(in, "API base", rc.Embedding.APIBase)
+		if preset.needKey {
+			rc.Embedding.APIKey = promptLine(in, "API key", rc.Embedding.APIKey)
+		}
+		rc.Embedding.Model = promptLine(in, "Model", rc.Embedding.Model)
+		fmt.Println("  Checking embedding API...")
+		ctx, cancel := context.WithTimeout(context.Background(), ragProbeTimeout)
+		dim, err := rag.ProbeEmbedding(ctx, rc.Embedding)
+		cancel()
+		if err == nil {
+			rc.Embedding.Dimension = dim
+			fmt.Printf("  ✓ %s returns %d-dimensional vectors\n", rc.Embedding.Model, dim)
+			break
+		}
+		fmt.Printf("  ✗ %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("    %s\n", hint)
+		}
+		if !promptYes(in, "Try again?", true) {
+			rc.Embedding.Dimension = 0
+			break
+		}
+	}
+
+	// Vector store
+	fmt.Println("\n3. Vector store")
+	for idx, p := range vectorDBPresets {
+		fmt.Printf("  %d) %s\n", idx+1, p.name)
+	}
+	if url := vectorDBPresets[promptChoice(in, len(vectorDBPresets))-1].url; url != "" {
+		rc.VectorDB.URL = url
+	}
+	for {
+		rc.VectorDB.URL = promptLine(in, "Qdrant URL", rc.VectorDB.URL)
+		rc.VectorDB.Collection = promptLine(in, "Collection", rc.VectorDB.Collection)
+		fmt.Println("  Checking vector store...")
+		ctx, cancel := context.WithTimeout(context.Background(), ragProbeTimeout)
+		err := rag.ProbeVectorDB(ctx, rc.VectorDB)
+		cancel()
+		if err == nil {
+			fmt.Println("  ✓ Qdrant is reachable")
+			break
+		}
+		fmt.Printf("  ✗ %v\n", err)
+		if !promptYes(in, "Try again?", true) {
+			break
+		}
+	}
+
+	rc.Enabled = true
+	cfg.RAG = rc
+	if err := config.SaveConfig(getConfigPath(), cfg); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		return
+	}
+	fmt.Printf("\n✓ Saved the rag section to %s\n", getConfigPath())
+	fmt.Println("Next: picoclaw rag index")
+}
+
+func promptLine(in *bufio.Reader, label, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	line, err := in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		fmt.Println("Aborted.")
+		os.Exit(1)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func promptChoice(in *bufio.Reader, n int) int {
+	for {
+		choice, err := strconv.Atoi(promptLine(in, "Choose", "1"))
+		if err == nil && choice >= 1 && choice <= n {
+			return choice
+		}
+		fmt.Printf("  Enter a number from 1 to %d\n", n)
+	}
+}
+
+func promptYes(in *bufio.Reader, label string, def bool) bool {
+	d := "n"
+	if def {
+		d = "y"
+	}
+	answer := strings.ToLower(promptLine(in, label+" (y/n)", d))
+	return answer == "y" || answer == "yes"
+}
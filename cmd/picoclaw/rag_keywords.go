@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragKeywordsCmd proposes rag.trigger.auto_keywords from the indexed notes
+// and, with --write, adds them to the config after confirmation.
+func ragKeywordsCmd(args []string) {
+	if len(args) == 0 || args[0] != "suggest" {
+		fmt.Println("Usage: picoclaw rag keywords suggest [--limit N] [--write] [--yes]")
+		return
+	}
+	limit := 30
+	write, yes := false, false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--limit":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &limit)
+				i++
+			}
+		case "--write":
+			write = true
+		case "--yes", "-y":
+			yes = true
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		return
+	}
+
+	suggestions, err := service.SuggestKeywords(context.Background(), limit)
+	if err != nil {
+		fmt.Printf("Keyword analysis failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+	if len(suggestions) == 0 {
+		fmt.Println("No new keywords found; index more notes or check rag.trigger.auto_keywords.")
+		return
+	}
+	fmt.Printf("  %-24s %8s  %s\n", "keyword", "score", "chunks")
+	terms := make([]string, len(suggestions))
+	for idx, s := range suggestions {
+		terms[idx] = s.Term
+		fmt.Printf("  %-24s %8.1f  %d\n", s.Term, s.Score, s.Chunks)
+	}
+	if !cfg.RAG.Trigger.Auto {
+		fmt.Println("\nNote: rag.trigger.auto is off, so auto_keywords are not used yet.")
+	}
+	if !write {
+		fmt.Println("\nRun with --write to add them to rag.trigger.auto_keywords.")
+		return
+	}
+	if !yes && !promptYes(bufio.NewReader(os.Stdin), fmt.Sprintf("Add %d keyword(s) to rag.trigger.auto_keywords?", len(terms)), false) {
+		return
+	}
+	cfg.RAG.Trigger.AutoKeywords = append(cfg.RAG.Trigger.AutoKeywords, terms...)
+	if err := config.SaveConfig(getConfigPath(), cfg); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Added %s to %s\n", strings.Join(terms, ", "), getConfigPath())
+}
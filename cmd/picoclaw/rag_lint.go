@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+var lintDescriptions = map[string]string{
+	rag.LintEmpty:             "empty notes; nothing to retrieve",
+	rag.LintHuge:              "enormous notes; thousands of chunks crowd out the rest",
+	rag.LintBrokenFrontmatter: "broken frontmatter; title, tags and aliases may be lost",
+	rag.LintNoHeadings:        "long notes without headings; their chunks cannot be told apart",
+	rag.LintLongLines:         "extremely long lines; chunks end at line breaks, so they become oversized chunks",
+	rag.LintDuplicateTitle:    "duplicated titles; sources and wikilinks are ambiguous",
+	rag.LintUnreadable:        "notes that could not be read or converted",
+}
+
+// ragLintVaultCmd lists the notes of the vault likely to retrieve poorly.
+func ragLintVaultCmd(args []string) {
+	examples := 5
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--examples":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &examples)
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		os.Exit(1)
+	}
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	report, err := service.LintVault(examples)
+	if err != nil {
+		fmt.Printf("Lint failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		os.Exit(1)
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Printf("✓ %d notes checked, nothing to fix\n", report.Notes)
+		return
+	}
+	fmt.Printf("%d notes checked\n", report.Notes)
+	for _, f := range report.Findings {
+		fmt.Printf("\n%5d  %s\n", f.Notes, lintDescriptions[f.Kind])
+		for _, e := range f.Examples {
+			if e.Detail != "" {
+				fmt.Printf("       %s (%s)\n", e.Path, e.Detail)
+			} else {
+				fmt.Printf("       %s\n", e.Path)
+			}
+		}
+		if more := f.Notes - len(f.Examples); more > 0 {
+			fmt.Printf("       ... and %d more\n", more)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragMigrateStoreCmd copies the index to another vector store and switches
+// the config over to it.
+func ragMigrateStoreCmd(args []string) {
+	opts := rag.MigrateStoreOptions{From: rag.StoreQdrant, To: rag.StoreQdrant}
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			break
+		}
+		switch args[i] {
+		case "--from":
+			opts.From = args[i+1]
+		case "--to":
+			opts.To = args[i+1]
+		case "--url":
+			opts.Target.URL = args[i+1]
+		case "--collection":
+			opts.Target.Collection = args[i+1]
+		case "--batch":
+			fmt.Sscanf(args[i+1], "%d", &opts.BatchSize)
+		default:
+			continue
+		}
+		i++
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	source := cfg.RAG.VectorDB
+	target := source
+	if opts.Target.URL != "" {
+		target.URL = opts.Target.URL
+	}
+	if opts.Target.Collection != "" {
+		target.Collection = opts.Target.Collection
+	}
+	if target.URL == source.URL && target.Collection == source.Collection {
+		fmt.Println("Choose a different --url or --collection to migrate to.")
+		return
+	}
+	opts.Target = target
+
+	service, err := rag.NewService(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Copying %s (%s) to %s (%s)...\n", source.Collection, source.URL, target.Collection, target.URL)
+	migrated, err := service.MigrateStore(context.Background(), opts, func(collection string, copied int) {
+		fmt.Printf("\r  %s: %d points", collection, copied)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Migration failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+	for _, m := range migrated {
+		fmt.Printf("✓ %s -> %s: %d points\n", m.Source, m.Target, m.Points)
+	}
+
+	cfg.RAG.VectorDB = target
+	if err := config.SaveConfig(getConfigPath(), cfg); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		fmt.Printf("Set rag.vector_db.url to %s and rag.vector_db.collection to %s by hand.\n", target.URL, target.Collection)
+		return
+	}
+	fmt.Printf("✓ Switched rag.vector_db in %s to the new store\n", getConfigPath())
+	fmt.Println("The old collections were left in place; delete them once the new store works.")
+}
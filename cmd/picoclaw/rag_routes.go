@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragRoutesCmd summarizes the decisions of rag.router and lists the latest.
+func ragRoutesCmd(args []string) {
+	var since time.Time
+	var user string
+	limit := 20
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since":
+			if i+1 < len(args) {
+				d, err := parseAge(args[i+1])
+				if err != nil || d <= 0 {
+					fmt.Printf("Invalid --since %q\n", args[i+1])
+					os.Exit(1)
+				}
+				since = time.Now().Add(-d)
+				i++
+			}
+		case "--limit":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &limit)
+				i++
+			}
+		case "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	var service *rag.Service
+	if user != "" {
+		service, err = userRagService(cfg, user)
+	} else {
+		service, err = rag.NewService(cfg, cfg.WorkspacePath())
+	}
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	records, err := service.Routes(since)
+	if err != nil {
+		fmt.Printf("Reading the route log failed: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Router.Enabled {
+		fmt.Println("rag.router.enabled is off; no new decisions are recorded.")
+	}
+	if len(records) == 0 {
+		fmt.Println("No routing decisions recorded yet.")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, r := range records {
+		counts[r.Route+" "+r.Method]++
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if counts[keys[a]] != counts[keys[b]] {
+			return counts[keys[a]] > counts[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	fmt.Printf("%d messages routed\n\n", len(records))
+	fmt.Printf("%-8s  %-10s  %6s\n", "ROUTE", "METHOD", "COUNT")
+	for _, k := range keys {
+		route, method, _ := strings.Cut(k, " ")
+		fmt.Printf("%-8s  %-10s  %6d\n", route, method, counts[k])
+	}
+
+	if limit <= 0 {
+		return
+	}
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	fmt.Printf("\nLatest %d:\n", len(records))
+	for _, r := range records {
+		how := r.Method
+		if r.Reason != "" {
+			how += ", " + r.Reason
+		}
+		line := fmt.Sprintf("%s  %-6s", r.Time.Local().Format("2006-01-02 15:04"), r.Route)
+		if r.Message != "" {
+			line += "  " + truncateRunes(r.Message, 60)
+		}
+		fmt.Printf("%s  (%s)\n", line, how)
+	}
+}
+
+// truncateRunes shortens s to n runes, marking the cut with "…".
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
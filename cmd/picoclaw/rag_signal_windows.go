@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyIndexSignal reports false: Windows has no SIGUSR1, so use
+// POST /admin/index instead.
+func notifyIndexSignal(ch chan<- os.Signal) bool {
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// ragUndoDeleteCmd restores the points rag.trash kept for a note, or lists
+// the trash without a path.
+func ragUndoDeleteCmd(args []string) {
+	path, user := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
+		default:
+			path = args[i]
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	var service *rag.Service
+	if user != "" {
+		service, err = userRagService(cfg, user)
+	} else {
+		service, err = rag.NewService(cfg, cfg.WorkspacePath())
+	}
+	if err != nil {
+		fmt.Printf("RAG initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if path == "" {
+		entries, err := service.Trash()
+		if err != nil {
+			fmt.Printf("Reading the trash failed: %v\n", err)
+			os.Exit(1)
+		}
+		if !cfg.RAG.Trash.Enabled {
+			fmt.Println("rag.trash.enabled is off; deleted points are not kept.")
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %-7s  %4d points  %s\n", e.DeletedAt.Local().Format("2006-01-02 15:04:05"), e.Reason, e.Points, e.Path)
+		}
+		fmt.Printf("%d notes in the trash\n", len(entries))
+		return
+	}
+
+	restored, err := service.UndoDelete(context.Background(), path)
+	if err != nil {
+		fmt.Printf("Undo failed: %v\n", err)
+		if errors.Is(err, rag.ErrNotInTrash) {
+			fmt.Println("  Run picoclaw rag undo-delete without a path to list the trash.")
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Restored %d points of %s\n", restored, path)
+	fmt.Println("  Unless the note is back in the vault as it was, the next index run removes or re-indexes it.")
+}
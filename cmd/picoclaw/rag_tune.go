@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+func ragTuneCmd(args []string) {
+	var opts rag.TuneOptions
+	evalPath := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--eval":
+			if i+1 < len(args) {
+				evalPath = args[i+1]
+				i++
+			}
+		case "--notes":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.SampleNotes)
+				i++
+			}
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if !cfg.RAG.Enabled {
+		fmt.Println("RAG is disabled in config.")
+		return
+	}
+	if evalPath != "" {
+		if opts.EvalSet, err = rag.LoadEvalSet(evalPath); err != nil {
+			fmt.Printf("Error loading eval set: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Println("Tuning chunk settings...")
+	report, err := rag.RunTune(context.Background(), cfg.RAG, opts, func(step string) {
+		fmt.Printf("  %s\n", step)
+	})
+	if err != nil {
+		fmt.Printf("Tune failed: %v\n", err)
+		if hint := ragErrorHint(err); hint != "" {
+			fmt.Printf("  %s\n", hint)
+		}
+		return
+	}
+
+	source := "from " + evalPath
+	if report.Generated {
+		source = "generated from the notes"
+	}
+	fmt.Printf("\n%d notes, %d queries (%s)\n", report.Notes, report.Cases, source)
+	k := report.Best.Metrics.K
+	fmt.Printf("  %-6s %-8s %-7s %-9s %s\n", "size", "overlap", "chunks", fmt.Sprintf("recall@%d", k), "MRR")
+	for _, r := range report.Results {
+		marker := " "
+		if r == report.Best {
+			marker = "*"
+		}
+		fmt.Printf("%s %-6d %-8d %-7d %-9.3f %.3f\n", marker, r.ChunkSize, r.ChunkOverlap, r.Chunks, r.Metrics.RecallAtK, r.Metrics.MRR)
+	}
+
+	fmt.Println("\nBest configuration:")
+	fmt.Printf("  rag.chunk_size:    %d (current %d)\n", report.Best.ChunkSize, cfg.RAG.ChunkSize)
+	fmt.Printf("  rag.chunk_overlap: %d (current %d)\n", report.Best.ChunkOverlap, cfg.RAG.ChunkOverlap)
+	if report.Best.ChunkSize != cfg.RAG.ChunkSize || report.Best.ChunkOverlap != cfg.RAG.ChunkOverlap {
+		fmt.Println("Changing these settings re-embeds every note on the next index run.")
+	}
+}
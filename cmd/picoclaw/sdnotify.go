@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// sdNotify sends a state such as "READY=1" to the service manager named in
+// NOTIFY_SOCKET. It reports false without error when not run under systemd.
+func sdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading '@' names a Linux abstract socket.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
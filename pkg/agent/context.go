@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
@@ -266,3 +269,56 @@ func (cb *ContextBuilder) GetSkillsInfo() map[string]interface{} {
 		"names":     skillNames,
 	}
 }
+
+// ragSearchToolName names the synthetic tool call that carries retrieved
+// notes in the "assistant_tool_result" injection mode.
+const ragSearchToolName = "knowledge_base_search"
+
+// injectRagContext places ragContext into messages built by BuildMessages,
+// whose last message is the current question, according to cfg.
+func injectRagContext(messages []providers.Message, ragContext, query string, cfg config.RagInjectionConfig) []providers.Message {
+	if ragContext == "" || len(messages) == 0 {
+		return messages
+	}
+	last := len(messages) - 1
+	switch cfg.Mode {
+	case rag.InjectionUserPrefix:
+		messages[last].Content = ragContext + "\n\n" + messages[last].Content
+		return messages
+	case rag.InjectionSystem:
+		if cfg.Position == rag.InjectionAfterSystem && messages[0].Role == "system" {
+			messages[0].Content += "\n\n" + ragContext
+			return messages
+		}
+		return insertMessages(messages, last, providers.Message{Role: "system", Content: ragContext})
+	case rag.InjectionAssistantToolResult:
+		args, _ := json.Marshal(map[string]string{"query": query})
+		call := providers.Message{
+			Role: "assistant",
+			ToolCalls: []providers.ToolCall{{
+				ID:   "call_" + ragSearchToolName,
+				Type: "function",
+				Function: &providers.FunctionCall{
+					Name:      ragSearchToolName,
+					Arguments: string(args),
+				},
+			}},
+		}
+		result := providers.Message{Role: "tool", Content: ragContext, ToolCallID: call.ToolCalls[0].ID}
+		at := last
+		if cfg.Position == rag.InjectionAfterSystem && messages[0].Role == "system" {
+			at = 1
+		}
+		return insertMessages(messages, at, call, result)
+	default:
+		messages[last].Content += "\n\n" + ragContext
+		return messages
+	}
+}
+
+func insertMessages(messages []providers.Message, at int, inserted ...providers.Message) []providers.Message {
+	out := make([]providers.Message, 0, len(messages)+len(inserted))
+	out = append(out, messages[:at]...)
+	out = append(out, inserted...)
+	return append(out, messages[at:]...)
+}
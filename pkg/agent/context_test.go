@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestInjectRagContext(t *testing.T) {
+	build := func() []providers.Message {
+		return []providers.Message{
+			{Role: "system", Content: "sys"},
+			{Role: "user", Content: "earlier"},
+			{Role: "assistant", Content: "reply"},
+			{Role: "user", Content: "question"},
+		}
+	}
+	roles := func(messages []providers.Message) string {
+		var s string
+		for _, m := range messages {
+			s += m.Role[:1]
+		}
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		cfg       config.RagInjectionConfig
+		wantRoles string
+		check     func([]providers.Message) bool
+	}{
+		{"user suffix", config.RagInjectionConfig{Mode: "user_suffix"}, "suau",
+			func(m []providers.Message) bool { return m[3].Content == "question\n\nNOTES" }},
+		{"user prefix", config.RagInjectionConfig{Mode: "user_prefix"}, "suau",
+			func(m []providers.Message) bool { return m[3].Content == "NOTES\n\nquestion" }},
+		{"system before user", config.RagInjectionConfig{Mode: "system", Position: "before_user"}, "suasu",
+			func(m []providers.Message) bool { return m[3].Content == "NOTES" && m[4].Content == "question" }},
+		{"system after system", config.RagInjectionConfig{Mode: "system", Position: "after_system"}, "suau",
+			func(m []providers.Message) bool { return m[0].Content == "sys\n\nNOTES" }},
+		{"tool result before user", config.RagInjectionConfig{Mode: "assistant_tool_result", Position: "before_user"}, "suaatu",
+			func(m []providers.Message) bool {
+				return len(m[3].ToolCalls) == 1 && m[4].ToolCallID == m[3].ToolCalls[0].ID && m[4].Content == "NOTES"
+			}},
+		{"tool result after system", config.RagInjectionConfig{Mode: "assistant_tool_result", Position: "after_system"}, "satuau",
+			func(m []providers.Message) bool { return m[2].Content == "NOTES" }},
+	}
+	for _, tt := range tests {
+		got := injectRagContext(build(), "NOTES", "question", tt.cfg)
+		if roles(got) != tt.wantRoles || !tt.check(got) {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+}
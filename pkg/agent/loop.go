@@ -9,7 +9,9 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -43,11 +45,25 @@ type AgentLoop struct {
 	contextBuilder *ContextBuilder
 	tools          *tools.ToolRegistry
 	ragService     *rag.Service
+	ragRunner      *rag.IndexRunner  // Starts /kb index runs; nil outside the gateway
+	ragUsers       *rag.UserServices // Per-user knowledge bases; nil unless rag.per_user is enabled
+	ragUserRunners sync.Map          // *rag.IndexRunner of /kb index in per-user mode, by user key
+	ragUserCtx     context.Context   // Context of the per-user runners, cancelled with Run's
+	ragUserCancel  context.CancelFunc
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	active         sync.Map // Cancel funcs of the messages being processed, by session key
+	answers        sync.Map // Last kbAnswer by session key, kept for saveCommand and /kb good|bad
 	channelManager *channels.Manager
 }
 
+// kbAnswer is the last knowledge base answer of a session. saved is set once
+// /save wrote it, which leaves it to /kb good and /kb bad.
+type kbAnswer struct {
+	rag.Answer
+	saved bool
+}
+
 // processOptions configures how a message is processed
 type processOptions struct {
 	SessionKey      string // Session identifier for history/context
@@ -58,6 +74,7 @@ type processOptions struct {
 	EnableSummary   bool   // Whether to trigger summarization
 	SendResponse    bool   // Whether to send response via bus
 	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SenderID        string // Sender, whose knowledge base is searched under rag.per_user
 }
 
 // createToolRegistry creates a tool registry with common tools.
@@ -75,16 +92,19 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Shell execution
 	registry.Register(tools.NewExecTool(workspace, restrict))
 
-	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
-		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
-		BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
-		BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
-		DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
-		DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
-	}); searchTool != nil {
-		registry.Register(searchTool)
+	// rag.local_only keeps the agent from pulling web content next to the notes.
+	if !cfg.RAG.Enabled || !cfg.RAG.LocalOnly {
+		if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+			BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
+			BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
+			BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
+			DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
+			DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
+		}); searchTool != nil {
+			registry.Register(searchTool)
+		}
+		registry.Register(tools.NewWebFetchTool(50000))
 	}
-	registry.Register(tools.NewWebFetchTool(50000))
 
 	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 	registry.Register(tools.NewI2CTool())
@@ -141,6 +161,7 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	var ragService *rag.Service
 	if cfg.RAG.Enabled {
 		if svc, err := rag.NewService(cfg, workspace); err == nil {
+			svc.SetTargetModel(cfg.Agents.Defaults.Model)
 			ragService = svc
 		} else {
 			logger.WarnCF("rag", "RAG disabled due to config error", map[string]interface{}{
@@ -148,6 +169,12 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 			})
 		}
 	}
+	var ragUsers *rag.UserServices
+	if ragService != nil && cfg.RAG.PerUser.Enabled {
+		ragUsers, _ = rag.NewUserServices(cfg, workspace)
+	}
+
+	ragUserCtx, ragUserCancel := context.WithCancel(context.Background())
 
 	return &AgentLoop{
 		bus:            msgBus,
@@ -161,24 +188,48 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
 		ragService:     ragService,
+		ragUsers:       ragUsers,
+		ragUserCtx:     ragUserCtx,
+		ragUserCancel:  ragUserCancel,
 		summarizing:    sync.Map{},
 	}
 }
 
+// stopCommand cancels the message currently being processed for the session
+// it is sent from.
+const stopCommand = "/stop"
+
+// saveCommand confirms the last answer drawn from the knowledge base and
+// appends it to the rag.answers note.
+const saveCommand = "/save"
+
+// webRouteInstruction is added to messages rag.router sends to the web.
+const webRouteInstruction = "Use the web_search tool to answer this; it needs current or public information."
+
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	defer context.AfterFunc(ctx, al.ragUserCancel)()
+
+	// Messages are read in a separate goroutine so a /stop can reach the
+	// message it cancels while that message is still being processed.
+	queue := make(chan bus.InboundMessage, 100)
+	go al.consumeInbound(ctx, queue)
 
 	for al.running.Load() {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
-			if !ok {
+		case msg := <-queue:
+			msgCtx, cancel := context.WithCancel(ctx)
+			al.active.Store(msg.SessionKey, cancel)
+			response, err := al.processMessage(msgCtx, msg)
+			al.active.Delete(msg.SessionKey)
+			stopped := msgCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+			if err != nil && stopped {
+				// Stopped by the user, who has already been told.
 				continue
 			}
-
-			response, err := al.processMessage(ctx, msg)
 			if err != nil {
 				response = fmt.Sprintf("Error processing message: %v", err)
 			}
@@ -207,8 +258,68 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 	return nil
 }
 
+// consumeInbound moves inbound messages to queue, handling /stop on the way.
+func (al *AgentLoop) consumeInbound(ctx context.Context, queue chan<- bus.InboundMessage) {
+	for {
+		msg, ok := al.bus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		if strings.TrimSpace(msg.Content) == stopCommand && al.CancelSession(msg.SessionKey) {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: "Stopped.",
+			})
+			continue
+		}
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CancelSession cancels the message being processed for sessionKey, which
+// aborts its in-flight knowledge base search and LLM calls. It reports
+// whether a message was running.
+func (al *AgentLoop) CancelSession(sessionKey string) bool {
+	cancel, ok := al.active.LoadAndDelete(sessionKey)
+	if !ok {
+		return false
+	}
+	cancel.(context.CancelFunc)()
+	return true
+}
+
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	al.stopRagUserRunners()
+}
+
+// ragUserShutdownTimeout bounds how long Stop waits for the per-user index
+// runs to finish their current file before aborting them.
+const ragUserShutdownTimeout = 30 * time.Second
+
+// stopRagUserRunners shuts down the /kb index runners of rag.per_user like
+// the gateway does its own: runs in progress finish their current file, and
+// are aborted if that takes longer than ragUserShutdownTimeout.
+func (al *AgentLoop) stopRagUserRunners() {
+	shutdownCtx, done := context.WithTimeout(context.Background(), ragUserShutdownTimeout)
+	defer done()
+	al.ragUserRunners.Range(func(key, value interface{}) bool {
+		runner := value.(*rag.IndexRunner)
+		if err := runner.Shutdown(shutdownCtx); err != nil {
+			logger.WarnCF("rag", "Index run did not stop in time, aborting", map[string]interface{}{
+				"user":    key,
+				"timeout": ragUserShutdownTimeout.String(),
+			})
+			al.ragUserCancel()
+			runner.Wait()
+		}
+		return true
+	})
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -297,6 +408,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		SenderID:        msg.SenderID,
 	})
 }
 
@@ -369,6 +481,36 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	// 1. Update tool contexts
 	al.updateToolContexts(opts.Channel, opts.ChatID)
 
+	// Start knowledge base retrieval early so it overlaps with loading history
+	userMessage := opts.UserMessage
+	llmMessage := opts.UserMessage
+	var ragPrefetch *rag.Prefetch
+	var ragNoHit string
+	var ragPinned []rag.SearchResult
+	ragService := al.ragServiceFor(opts.Channel, opts.SenderID)
+	if ragService != nil && !opts.NoHistory {
+		_, web := al.tools.Get("web_search")
+		decision := ragService.Route(ctx, userMessage, rag.RouteOptions{Classify: al.ragSummarize, Web: web})
+		ragNoHit = decision.NoHit
+		if !decision.Skipped {
+			ragPinned = ragService.Pinned(decision.Pins)
+		}
+		if decision.CleanedMessage != "" {
+			userMessage = decision.CleanedMessage
+			llmMessage = decision.CleanedMessage
+		}
+		if instruction := decision.Directives.Instruction(); instruction != "" {
+			llmMessage += "\n\n" + instruction
+		}
+		if decision.Route == rag.RouteWeb {
+			llmMessage += "\n\n" + webRouteInstruction
+		}
+		if decision.ShouldSearch {
+			ragPrefetch = ragService.Prefetch(ctx, userMessage, decision.Filter)
+			defer ragPrefetch.Cancel()
+		}
+	}
+
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
 	var summary string
@@ -376,36 +518,45 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		history = al.sessions.GetHistory(opts.SessionKey)
 		summary = al.sessions.GetSummary(opts.SessionKey)
 	}
-	userMessage := opts.UserMessage
-	llmMessage := opts.UserMessage
 	var ragSources []rag.SearchResult
-	if al.ragService != nil && !opts.NoHistory {
-		decision := al.ragService.TriggerDecision(userMessage)
-		if decision.CleanedMessage != "" {
-			userMessage = decision.CleanedMessage
-			llmMessage = decision.CleanedMessage
+	if ragPrefetch != nil {
+		results, err := ragPrefetch.Wait(ctx)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
-		if decision.ShouldSearch {
-			results, err := al.ragService.Search(ctx, userMessage)
-			if err != nil {
-				logger.WarnCF("rag", "RAG search failed", map[string]interface{}{
-					"error": err.Error(),
-				})
-			} else if len(results) == 0 {
-				if !al.ragService.Config().FallbackToLLM {
-					finalContent := "未在你的知识库中找到相关内容。你可以尝试换一种问法，或使用“不查：”让我直接回答。"
-					al.sessions.AddMessage(opts.SessionKey, "user", userMessage)
-					al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
-					al.sessions.Save(opts.SessionKey)
-					return finalContent, nil
-				}
-			} else {
-				ragSources = results
-				ragContext := al.ragService.FormatContext(results)
-				llmMessage = userMessage + "\n\n" + ragContext
+		if errors.Is(err, rag.ErrUnavailable) || errors.Is(err, rag.ErrBudgetExceeded) {
+			logger.InfoCF("rag", "RAG skipped, answering without notes", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else if errors.Is(err, rag.ErrCollectionMissing) {
+			logger.WarnCF("rag", "Knowledge base not indexed yet, run 'picoclaw rag index'", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else if err != nil {
+			logger.WarnCF("rag", "RAG search failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else if len(results) == 0 {
+			if ragNoHit == rag.NoHitNotifyUser {
+				finalContent := "未在你的知识库中找到相关内容。你可以尝试换一种问法，或使用“不查：”让我直接回答。"
+				al.sessions.AddMessage(opts.SessionKey, "user", userMessage)
+				al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
+				al.sessions.Save(opts.SessionKey)
+				return finalContent, nil
 			}
+		} else {
+			ragSources = results
+			confidence := ragService.Confidence(results)
+			logger.InfoCF("rag", "Knowledge base notes retrieved", map[string]interface{}{
+				"results":    len(results),
+				"confidence": confidence.Level,
+				"top_score":  confidence.TopScore,
+			})
 		}
 	}
+	if len(ragPinned) > 0 {
+		ragSources = append(ragPinned, ragSources...)
+	}
 
 	messages := al.contextBuilder.BuildMessages(
 		history,
@@ -415,6 +566,15 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		opts.Channel,
 		opts.ChatID,
 	)
+	ragRetrieved := ragSources
+	if len(ragSources) > 0 {
+		var ragContext string
+		ragContext, ragSources = al.fitRagContext(ragService, messages, ragSources)
+		if ragContext != "" {
+			messages = injectRagContext(messages, ragContext, userMessage, ragService.Injection())
+			ragService.AuditContext(opts.SessionKey, al.model, ragContext, ragSources)
+		}
+	}
 
 	// 3. Save user message to session
 	al.sessions.AddMessage(opts.SessionKey, "user", userMessage)
@@ -435,12 +595,27 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		finalContent = opts.DefaultResponse
 	}
 
-	if al.ragService != nil && al.ragService.Config().AnswerWithSources && len(ragSources) > 0 {
-		if !strings.Contains(finalContent, "Sources:") && !strings.Contains(finalContent, "来源:") {
-			finalContent = finalContent + "\n\n" + al.ragService.FormatSources(ragSources)
+	if ragService != nil && (ragService.Config().Answers.Enabled || ragService.Config().Feedback.Enabled) {
+		if len(ragSources) > 0 {
+			al.answers.Store(opts.SessionKey, &kbAnswer{Answer: rag.Answer{
+				Question: userMessage,
+				Answer:   finalContent,
+				Sources:  ragSources,
+				Time:     time.Now(),
+			}})
+		} else {
+			al.answers.Delete(opts.SessionKey)
 		}
 	}
 
+	if ragService != nil && ragService.Config().AnswerWithSources {
+		finalContent = ragService.AttachSources(finalContent, ragSources)
+	}
+
+	if ragService != nil && ragService.Config().FollowUps.Enabled && len(ragSources) > 0 {
+		finalContent = al.appendFollowUps(ctx, ragService, finalContent, userMessage, ragRetrieved, ragSources)
+	}
+
 	// 6. Save final assistant message to session
 	al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	al.sessions.Save(opts.SessionKey)
@@ -1020,6 +1195,76 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 	return response.Content, nil
 }
 
+// ragSummarize runs a prompt of the knowledge base, such as a routing
+// decision or follow-up questions, through the agent's model.
+func (al *AgentLoop) ragSummarize(ctx context.Context, prompt string) (string, error) {
+	resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// appendFollowUps ends answer with follow-up questions drawn from the notes
+// retrieved for question that did not fit in the context. Failures are
+// logged and leave the answer as it is.
+func (al *AgentLoop) appendFollowUps(ctx context.Context, ragService *rag.Service, answer, question string, retrieved, used []rag.SearchResult) string {
+	questions, err := ragService.SuggestFollowUps(ctx, question, retrieved, used, al.ragSummarize)
+	if err != nil {
+		logger.WarnCF("rag", "Follow-up questions failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return answer
+	}
+	if len(questions) == 0 {
+		return answer
+	}
+	return answer + "\n\n" + rag.FormatFollowUps(questions)
+}
+
+// fitRagContext formats retrieved notes within the room the conversation
+// leaves in the context window, keeping a quarter of the window for the
+// answer. It returns the context and the results it kept.
+func (al *AgentLoop) fitRagContext(ragService *rag.Service, messages []providers.Message, results []rag.SearchResult) (string, []rag.SearchResult) {
+	if al.contextWindow <= 0 {
+		return ragService.FitContext(results, math.MaxInt)
+	}
+	budget := al.contextWindow - al.estimateTokens(messages) - al.contextWindow/4
+	ragContext, kept := ragService.FitContext(results, budget)
+	if len(kept) < len(results) {
+		logger.InfoCF("rag", "Trimmed knowledge base context to fit the context window", map[string]interface{}{
+			"budget_tokens": budget,
+			"results":       len(results),
+			"kept":          len(kept),
+		})
+	}
+	return ragContext, kept
+}
+
+// ragServiceFor returns the knowledge base messages from senderID on channel
+// are answered from: the sender's own under rag.per_user, otherwise the
+// shared one. It returns nil when the knowledge base is off or the sender's
+// cannot be opened.
+func (al *AgentLoop) ragServiceFor(channel, senderID string) *rag.Service {
+	if al.ragUsers == nil || senderID == "" {
+		return al.ragService
+	}
+	svc, err := al.ragUsers.For(rag.UserKey(channel, senderID))
+	if err != nil {
+		logger.WarnCF("rag", "Could not open the sender's knowledge base", map[string]interface{}{
+			"channel": channel,
+			"sender":  senderID,
+			"error":   err.Error(),
+		})
+		return nil
+	}
+	svc.SetTargetModel(al.model)
+	return svc
+}
+
 // estimateTokens estimates the number of tokens in a message list.
 // Uses a safe heuristic of 2.5 characters per token to account for CJK and other
 // overheads better than the previous 3 chars/token.
@@ -1092,6 +1337,9 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		case "model":
 			oldModel := al.model
 			al.model = value
+			if al.ragService != nil {
+				al.ragService.SetTargetModel(value)
+			}
 			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
 		case "channel":
 			// This changes the 'default' channel for some operations, or effectively redirects output?
@@ -1110,6 +1358,36 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		default:
 			return fmt.Sprintf("Unknown switch target: %s", target), true
 		}
+
+	case stopCommand:
+		// A running message is stopped before it reaches the queue.
+		return "Nothing to stop.", true
+
+	case saveCommand:
+		ragService := al.ragServiceFor(msg.Channel, msg.SenderID)
+		if ragService == nil || !ragService.Config().Answers.Enabled {
+			return "Saving answers is off; enable rag.answers to use /save.", true
+		}
+		value, ok := al.answers.Load(msg.SessionKey)
+		if !ok {
+			return "No knowledge base answer to save yet.", true
+		}
+		answer := value.(*kbAnswer)
+		if answer.saved {
+			return "The last answer is already saved.", true
+		}
+		rel, err := ragService.SaveAnswer(ctx, answer.Answer)
+		if err != nil {
+			return fmt.Sprintf("Could not save the answer: %v", err), true
+		}
+		// A newer answer may have replaced this one meanwhile.
+		saved := *answer
+		saved.saved = true
+		al.answers.CompareAndSwap(msg.SessionKey, answer, &saved)
+		return fmt.Sprintf("Saved to %s.", rel), true
+
+	case kbCommand:
+		return al.handleKBCommand(ctx, msg, args), true
 	}
 
 	return "", false
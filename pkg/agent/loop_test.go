@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -624,3 +626,241 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+func TestAgentLoop_CancelSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	al.active.Store("cli:direct", cancel)
+
+	if !al.CancelSession("cli:direct") {
+		t.Fatal("Expected CancelSession to report a running message")
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected the message context to be cancelled")
+	}
+	if al.CancelSession("cli:direct") {
+		t.Error("Expected nothing left to cancel")
+	}
+
+	response, handled := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/stop"})
+	if !handled || response != "Nothing to stop." {
+		t.Errorf("handleCommand(/stop) = %q, %v", response, handled)
+	}
+}
+
+func TestAgentLoop_SaveCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	vault := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{vault}
+	cfg.RAG.DataDir = tmpDir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	msg := bus.InboundMessage{Content: "/save", SessionKey: "cli:direct"}
+
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.Contains(response, "off") {
+		t.Errorf("handleCommand(/save) with answers off = %q", response)
+	}
+	cfg.RAG.Answers.Enabled = true
+	al = NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	if response, _ := al.handleCommand(context.Background(), msg); response != "No knowledge base answer to save yet." {
+		t.Errorf("handleCommand(/save) without an answer = %q", response)
+	}
+	al.answers.Store("cli:direct", &kbAnswer{Answer: rag.Answer{Question: "q", Answer: "a", Sources: []rag.SearchResult{{Path: "n.md"}}}})
+	if response, _ := al.handleCommand(context.Background(), msg); response != "Saved to AI answers.md." {
+		t.Errorf("handleCommand(/save) = %q", response)
+	}
+	if _, err := os.Stat(filepath.Join(vault, "AI answers.md")); err != nil {
+		t.Errorf("answers note not written: %v", err)
+	}
+	if response, _ := al.handleCommand(context.Background(), msg); response != "The last answer is already saved." {
+		t.Errorf("second handleCommand(/save) = %q", response)
+	}
+
+	// The saved answer can still be marked for rag.feedback.
+	cfg.RAG.Feedback.Enabled = true
+	cfg.RAG.ChatCommands.Enabled = true
+	value, _ := al.answers.Load("cli:direct")
+	al = NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	al.answers.Store("cli:direct", value)
+	msg.Content = "/kb good"
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.HasPrefix(response, "Marked 1 notes as helpful") {
+		t.Errorf("handleCommand(/kb good) after /save = %q", response)
+	}
+}
+
+func TestAgentLoop_KBCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = tmpDir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	user := bus.InboundMessage{Channel: "telegram", SenderID: "42|alice", Content: "/kb status"}
+
+	if response, handled := al.handleCommand(context.Background(), user); !handled || !strings.Contains(response, "off") {
+		t.Errorf("handleCommand(/kb status) with commands off = %q, %v", response, handled)
+	}
+	cfg.RAG.ChatCommands.Enabled = true
+	cfg.RAG.ChatCommands.Admins = config.FlexibleStringSlice{"telegram:7"}
+	cfg.RAG.Guardrails.Admins = config.FlexibleStringSlice{"telegram:7"}
+	al = NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	if response, _ := al.handleCommand(context.Background(), user); response != "The knowledge base has not been indexed yet." {
+		t.Errorf("handleCommand(/kb status) = %q", response)
+	}
+	user.Content = "/kb index"
+	if response, _ := al.handleCommand(context.Background(), user); !strings.HasPrefix(response, "Only rag.chat_commands.admins") {
+		t.Errorf("handleCommand(/kb index) by a user = %q", response)
+	}
+	admin := bus.InboundMessage{Channel: "telegram", SenderID: "7", Content: "/kb index"}
+	if response, _ := al.handleCommand(context.Background(), admin); !strings.Contains(response, "need the gateway") {
+		t.Errorf("handleCommand(/kb index) without a runner = %q", response)
+	}
+	admin.Content = "/kb reindex"
+	if response, _ := al.handleCommand(context.Background(), admin); response != kbUsage {
+		t.Errorf("handleCommand(/kb reindex) = %q", response)
+	}
+
+	user.Content = "/kb purge"
+	if response, _ := al.handleCommand(context.Background(), user); response != "Only rag.guardrails.admins can use /kb purge." {
+		t.Errorf("handleCommand(/kb purge) by a user = %q", response)
+	}
+	admin.Content = "/kb purge"
+	response, _ := al.handleCommand(context.Background(), admin)
+	if !strings.Contains(response, "Send /kb purge confirm ") {
+		t.Fatalf("handleCommand(/kb purge) by an admin = %q", response)
+	}
+	admin.Content = "/kb purge confirm wrong"
+	if again, _ := al.handleCommand(context.Background(), admin); again == response || !strings.Contains(again, "Send /kb purge confirm ") {
+		t.Errorf("handleCommand(/kb purge) with a wrong token = %q", again)
+	}
+	admin.Content = "/kb index full"
+	if response, _ := al.handleCommand(context.Background(), admin); !strings.Contains(response, "need the gateway") {
+		t.Errorf("handleCommand(/kb index full) without a runner = %q", response)
+	}
+}
+
+func TestAgentLoop_KBFeedback(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = tmpDir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	cfg.RAG.ChatCommands.Enabled = true
+	cfg.RAG.Feedback.Enabled = true
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "42", SessionKey: "s1", Content: "/kb good"}
+
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.HasPrefix(response, "No knowledge base answer") {
+		t.Errorf("handleCommand(/kb good) before an answer = %q", response)
+	}
+	al.answers.Store("s1", &kbAnswer{Answer: rag.Answer{
+		Answer:  "See [2].",
+		Sources: []rag.SearchResult{{Path: "a.md"}, {Path: "b.md"}},
+	}})
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.HasPrefix(response, "Marked 1 notes as helpful") {
+		t.Errorf("handleCommand(/kb good) = %q", response)
+	}
+	msg.Content = "/kb bad 1 2"
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.HasPrefix(response, "Marked 2 notes as unhelpful") {
+		t.Errorf("handleCommand(/kb bad 1 2) = %q", response)
+	}
+	msg.Content = "/kb bad 3"
+	if response, _ := al.handleCommand(context.Background(), msg); !strings.HasPrefix(response, "No source 3") {
+		t.Errorf("handleCommand(/kb bad 3) = %q", response)
+	}
+	weights, err := al.ragService.FeedbackWeights()
+	if err != nil || len(weights) != 2 {
+		t.Fatalf("FeedbackWeights() = %+v, %v", weights, err)
+	}
+	for _, w := range weights {
+		if w.Path == "b.md" && (w.Good != 1 || w.Bad != 1) {
+			t.Errorf("b.md marks = %+v", w)
+		}
+	}
+}
+
+func TestAgentLoop_RagServicePerUser(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	cfg.RAG.PerUser.Enabled = true
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	if got := al.ragServiceFor("telegram", ""); got != al.ragService {
+		t.Error("ragServiceFor() without a sender did not return the shared knowledge base")
+	}
+	alice := al.ragServiceFor("telegram", "42|alice")
+	if alice == nil || alice == al.ragService {
+		t.Fatalf("ragServiceFor(telegram, 42|alice) = %p, want a per-user service", alice)
+	}
+	if want := filepath.Join(tmpDir, "vaults", "telegram_42"); alice.Config().VaultPath[0] != want {
+		t.Errorf("per-user vault = %v, want %s", alice.Config().VaultPath, want)
+	}
+	if al.ragServiceFor("telegram", "42|renamed") != alice {
+		t.Error("a renamed sender got a different knowledge base")
+	}
+	if al.ragServiceFor("discord", "42") == alice {
+		t.Error("the same ID on another channel shares a knowledge base")
+	}
+
+	cfg.RAG.ChatCommands.Enabled = true
+	al = NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "42", Content: "/kb index"}
+	if response, _ := al.handleCommand(context.Background(), msg); response != "Index run started. Send /kb status to follow it." {
+		t.Errorf("handleCommand(/kb index) on the sender's knowledge base = %q", response)
+	}
+	v, ok := al.ragUserRunners.Load("telegram_42")
+	if !ok {
+		t.Fatal("no runner kept for the sender's knowledge base")
+	}
+	al.Stop()
+	if v.(*rag.IndexRunner).Trigger(rag.IndexTriggerAdmin) {
+		t.Error("the sender's runner still starts index runs after Stop")
+	}
+}
+
+func TestIsRagAdmin(t *testing.T) {
+	admins := []string{"telegram:42", "discord:99", "slack-user"}
+	tests := []struct {
+		channel, sender string
+		want            bool
+	}{
+		{"telegram", "42|alice", true},
+		{"discord", "42", false},
+		{"discord", "99", true},
+		{"slack", "slack-user", true},
+		{"telegram", "", false},
+	}
+	for _, tt := range tests {
+		if got := isRagAdmin(admins, bus.InboundMessage{Channel: tt.channel, SenderID: tt.sender}); got != tt.want {
+			t.Errorf("isRagAdmin(%s:%s) = %v, want %v", tt.channel, tt.sender, got, tt.want)
+		}
+	}
+}
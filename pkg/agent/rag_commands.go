@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// kbCommand manages the knowledge base from chat when rag.chat_commands is
+// enabled: /kb status, /kb search <query>, /kb good and /kb bad (see
+// kbFeedback) and, for admins, /kb index. Under rag.per_user the commands
+// act on the sender's own knowledge base, which every user may index. The
+// destructive /kb index full, /kb purge and /kb prune are subject to
+// rag.guardrails.
+const kbCommand = "/kb"
+
+const kbUsage = "Usage: /kb status | /kb search <query> | /kb good|bad [n...] | /kb index [full] | /kb purge | /kb prune"
+
+// kbWarnings explains what each destructive /kb command does before asking
+// for confirmation.
+var kbWarnings = map[rag.Operation]string{
+	rag.OpFullReindex:      "This re-embeds every note, which takes a while and costs embedding API calls.",
+	rag.OpPurge:            "This deletes the index and its collections; searches find nothing until the next index run.",
+	rag.OpPruneCollections: "This deletes the collections picoclaw created that are no longer used.",
+}
+
+// kbSnippetChars bounds the excerpt shown for each /kb search result.
+const kbSnippetChars = 160
+
+// SetRagIndexRunner lets /kb index start background index runs. Without a
+// runner, as outside the gateway, /kb index is refused.
+func (al *AgentLoop) SetRagIndexRunner(runner *rag.IndexRunner) {
+	al.ragRunner = runner
+}
+
+func (al *AgentLoop) handleKBCommand(ctx context.Context, msg bus.InboundMessage, args []string) string {
+	svc := al.ragServiceFor(msg.Channel, msg.SenderID)
+	if svc == nil || !svc.Config().ChatCommands.Enabled {
+		return "Knowledge base commands are off; enable rag.chat_commands to use /kb."
+	}
+	if len(args) == 0 {
+		return kbUsage
+	}
+	runner := al.kbRunner(svc, msg)
+	switch args[0] {
+	case "status":
+		return kbStatus(svc, runner)
+	case "search":
+		query := strings.Join(args[1:], " ")
+		if query == "" {
+			return "Usage: /kb search <query>"
+		}
+		return kbSearch(ctx, svc, query)
+	case "good", "bad":
+		return al.kbFeedback(svc, msg, args[0] == "good", args[1:])
+	case "index":
+		if len(args) > 1 && args[1] == "full" {
+			return al.kbDestructive(ctx, svc, runner, msg, rag.OpFullReindex, "index full", args[2:])
+		}
+		if svc == al.ragService && !isRagAdmin(svc.Config().ChatCommands.Admins, msg) {
+			return "Only rag.chat_commands.admins can start an index run."
+		}
+		if runner == nil {
+			return "Index runs from chat need the gateway; run 'picoclaw rag index' instead."
+		}
+		if !runner.Trigger(rag.IndexTriggerChat) {
+			return "An index run is already in progress."
+		}
+		return "Index run started. Send /kb status to follow it."
+	case "purge":
+		return al.kbDestructive(ctx, svc, runner, msg, rag.OpPurge, "purge", args[1:])
+	case "prune":
+		return al.kbDestructive(ctx, svc, runner, msg, rag.OpPruneCollections, "prune", args[1:])
+	default:
+		return kbUsage
+	}
+}
+
+// kbFeedback marks the sources of the last answer in the session for
+// rag.feedback: those numbered in labels, as in the answer's [n] citations,
+// or else the sources the answer cites, or all of them when it cites none.
+func (al *AgentLoop) kbFeedback(svc *rag.Service, msg bus.InboundMessage, good bool, labels []string) string {
+	if !svc.Config().Feedback.Enabled {
+		return "Feedback is off; enable rag.feedback to use /kb good and /kb bad."
+	}
+	value, ok := al.answers.Load(msg.SessionKey)
+	if !ok {
+		return "No knowledge base answer to give feedback on yet."
+	}
+	answer := value.(*kbAnswer).Answer
+	var picked []rag.SearchResult
+	for _, label := range labels {
+		n, err := strconv.Atoi(strings.Trim(label, "[],"))
+		if err != nil || n < 1 || n > len(answer.Sources) {
+			return fmt.Sprintf("No source %s; the last answer has sources 1 to %d.", label, len(answer.Sources))
+		}
+		picked = append(picked, answer.Sources[n-1])
+	}
+	if len(labels) == 0 {
+		for _, n := range rag.CitedLabels(answer.Answer, len(answer.Sources)) {
+			picked = append(picked, answer.Sources[n-1])
+		}
+		if len(picked) == 0 {
+			picked = answer.Sources
+		}
+	}
+	marked, err := svc.RecordFeedback(picked, good)
+	if err != nil {
+		return fmt.Sprintf("Could not record the feedback: %v", err)
+	}
+	verdict := "helpful"
+	if !good {
+		verdict = "unhelpful"
+	}
+	return fmt.Sprintf("Marked %d notes as %s; they rank accordingly in future searches.", marked, verdict)
+}
+
+// kbDestructive runs op once rag.guardrails allow it. rest holds what
+// followed the command, "confirm <token>" when confirming.
+func (al *AgentLoop) kbDestructive(ctx context.Context, svc *rag.Service, runner *rag.IndexRunner, msg bus.InboundMessage, op rag.Operation, command string, rest []string) string {
+	if op == rag.OpFullReindex && runner == nil {
+		return "Index runs from chat need the gateway; run 'picoclaw rag index --full' instead."
+	}
+	confirmation := ""
+	if len(rest) == 2 && rest[0] == "confirm" {
+		confirmation = rest[1]
+	}
+	// The owner of a per-user knowledge base needs no allowlist entry.
+	caller := rag.Caller{Channel: msg.Channel, SenderID: msg.SenderID, Trusted: svc != al.ragService}
+	err := svc.Authorize(op, caller, confirmation)
+	var confirm *rag.ConfirmationError
+	switch {
+	case errors.As(err, &confirm):
+		return fmt.Sprintf("%s Send /kb %s confirm %s within %s to go ahead.",
+			kbWarnings[op], command, confirm.Token, time.Until(confirm.Expires).Round(time.Second))
+	case errors.Is(err, rag.ErrNotPermitted):
+		return fmt.Sprintf("Only rag.guardrails.admins can use /kb %s.", command)
+	case err != nil:
+		return fmt.Sprintf("Could not check the permission: %v", err)
+	}
+
+	switch op {
+	case rag.OpFullReindex:
+		if !runner.TriggerFull(rag.IndexTriggerChat) {
+			return "An index run is already in progress."
+		}
+		return "Full reindex started. Send /kb status to follow it."
+	case rag.OpPurge:
+		if runner != nil && runner.Status().Running {
+			return "An index run is in progress; purge once it has finished."
+		}
+		if err := svc.Purge(ctx); err != nil {
+			return fmt.Sprintf("Purge failed: %v", err)
+		}
+		return "Knowledge base purged. The next index run rebuilds it."
+	default:
+		pruned, err := svc.PruneCollections(ctx)
+		if err != nil {
+			return fmt.Sprintf("Prune failed: %v", err)
+		}
+		if len(pruned) == 0 {
+			return "No unused collections to prune."
+		}
+		return "Deleted collections: " + strings.Join(pruned, ", ")
+	}
+}
+
+// kbRunner returns the runner of svc: the gateway's for the shared knowledge
+// base and, under rag.per_user, one per user kept until Stop.
+func (al *AgentLoop) kbRunner(svc *rag.Service, msg bus.InboundMessage) *rag.IndexRunner {
+	if svc == al.ragService {
+		return al.ragRunner
+	}
+	key := rag.UserKey(msg.Channel, msg.SenderID)
+	runner, _ := al.ragUserRunners.LoadOrStore(key, rag.NewIndexRunner(al.ragUserCtx, svc, nil))
+	return runner.(*rag.IndexRunner)
+}
+
+func kbStatus(svc *rag.Service, runner *rag.IndexRunner) string {
+	var sb strings.Builder
+	states, err := svc.State()
+	switch {
+	case errors.Is(err, rag.ErrIndexNotBuilt):
+		sb.WriteString("The knowledge base has not been indexed yet.\n")
+	case err != nil:
+		fmt.Fprintf(&sb, "Could not read the index state: %v\n", err)
+	}
+	for _, st := range states {
+		name := st.Collection
+		if st.Language != "" {
+			name += " [" + st.Language + "]"
+		}
+		fmt.Fprintf(&sb, "Index %s: %d notes, %s, updated %s\n",
+			name, st.Files, st.EmbeddingModel, st.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if err == nil {
+		if f, err := svc.Freshness(); err == nil {
+			fmt.Fprintf(&sb, "Pending: %d new, %d modified, %d deleted\n", f.NewFiles, f.ModifiedFiles, f.DeletedFiles)
+			if f.FullReindexReason != "" {
+				fmt.Fprintf(&sb, "Full rebuild pending: %s\n", f.FullReindexReason)
+			}
+		}
+	}
+	if runner != nil {
+		run := runner.Status()
+		switch {
+		case run.Running:
+			fmt.Fprintf(&sb, "Index run in progress (%s, started %s ago)\n", run.Trigger, time.Since(run.StartedAt).Truncate(time.Second))
+		case run.Error != "":
+			fmt.Fprintf(&sb, "Last index run failed: %s\n", run.Error)
+		case !run.FinishedAt.IsZero():
+			fmt.Fprintf(&sb, "Last index run finished %s\n", run.FinishedAt.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func kbSearch(ctx context.Context, svc *rag.Service, query string) string {
+	results, err := svc.Search(ctx, query)
+	if err != nil {
+		return fmt.Sprintf("Search failed: %v", err)
+	}
+	if len(results) == 0 {
+		return "No matching notes."
+	}
+	var sb strings.Builder
+	for idx, r := range results {
+		fmt.Fprintf(&sb, "%d. %s (%.2f)\n", idx+1, rag.FormatSource(r), r.Score)
+		snippet := strings.Join(strings.Fields(r.Content), " ")
+		if utf8.RuneCountInString(snippet) > kbSnippetChars {
+			snippet = string([]rune(snippet)[:kbSnippetChars]) + "…"
+		}
+		sb.WriteString("   " + snippet + "\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// isRagAdmin reports whether the sender of msg is listed in admins; see
+// rag.IsAdmin.
+func isRagAdmin(admins []string, msg bus.InboundMessage) bool {
+	return rag.IsAdmin(admins, msg.Channel, msg.SenderID)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/caarlos0/env/v11"
@@ -43,6 +45,36 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// VaultPaths lists one or more vault directories. A single JSON string is
+// accepted for older configs. Entries may be written as "name=path" to pick
+// the prefix that disambiguates notes when several vaults share one index.
+type VaultPaths []string
+
+func (v *VaultPaths) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single == "" {
+			*v = VaultPaths{}
+		} else {
+			*v = VaultPaths{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*v = list
+	return nil
+}
+
+func (v VaultPaths) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
 type Config struct {
 	Agents    AgentsConfig    `json:"agents"`
 	Channels  ChannelsConfig  `json:"channels"`
@@ -217,21 +249,94 @@ type ToolsConfig struct {
 }
 
 type RagConfig struct {
-	Enabled           bool             `json:"enabled" env:"PICOCLAW_RAG_ENABLED"`
-	VaultPath         string           `json:"vault_path" env:"PICOCLAW_RAG_VAULT_PATH"`
-	ChunkSize         int              `json:"chunk_size" env:"PICOCLAW_RAG_CHUNK_SIZE"`
-	ChunkOverlap      int              `json:"chunk_overlap" env:"PICOCLAW_RAG_CHUNK_OVERLAP"`
-	TopK              int              `json:"top_k" env:"PICOCLAW_RAG_TOP_K"`
-	MinSimilarity     float64          `json:"min_similarity" env:"PICOCLAW_RAG_MIN_SIMILARITY"`
-	SnippetMaxChars   int              `json:"snippet_max_chars" env:"PICOCLAW_RAG_SNIPPET_MAX_CHARS"`
-	IncludePatterns   []string         `json:"include_patterns" env:"PICOCLAW_RAG_INCLUDE_PATTERNS"`
-	ExcludePatterns   []string         `json:"exclude_patterns" env:"PICOCLAW_RAG_EXCLUDE_PATTERNS"`
-	AnswerWithSources bool             `json:"answer_with_sources" env:"PICOCLAW_RAG_ANSWER_WITH_SOURCES"`
-	FallbackToLLM     bool             `json:"fallback_to_llm" env:"PICOCLAW_RAG_FALLBACK_TO_LLM"`
-	Trigger           RagTriggerConfig `json:"trigger"`
-	Embedding         RagEmbeddingConfig `json:"embedding"`
-	VectorDB          RagVectorDBConfig  `json:"vector_db"`
-	AutoIndex         RagAutoIndexConfig `json:"auto_index"`
+	Enabled           bool                       `json:"enabled" env:"PICOCLAW_RAG_ENABLED"`
+	VaultPath         VaultPaths                 `json:"vault_path" env:"PICOCLAW_RAG_VAULT_PATH"`
+	VaultID           string                     `json:"vault_id" env:"PICOCLAW_RAG_VAULT_ID"` // defaults to the vault directory names
+	DataDir           string                     `json:"data_dir" env:"PICOCLAW_RAG_DATA_DIR"` // defaults to <workspace>/rag
+	ChunkSize         int                        `json:"chunk_size" env:"PICOCLAW_RAG_CHUNK_SIZE"`
+	ChunkOverlap      int                        `json:"chunk_overlap" env:"PICOCLAW_RAG_CHUNK_OVERLAP"`
+	MinChunkChars     int                        `json:"min_chunk_chars" env:"PICOCLAW_RAG_MIN_CHUNK_CHARS"` // smaller chunks are merged into the previous one
+	TopK              int                        `json:"top_k" env:"PICOCLAW_RAG_TOP_K"`
+	MinSimilarity     float64                    `json:"min_similarity" env:"PICOCLAW_RAG_MIN_SIMILARITY"`
+	SnippetMaxChars   int                        `json:"snippet_max_chars" env:"PICOCLAW_RAG_SNIPPET_MAX_CHARS"`
+	SnippetBoundary   string                     `json:"snippet_boundary" env:"PICOCLAW_RAG_SNIPPET_BOUNDARY"` // "sentence", "paragraph" or "none"
+	SnippetStops      []string                   `json:"snippet_stops" env:"PICOCLAW_RAG_SNIPPET_STOPS"`       // extra sentence ends for snippet cuts
+	SnippetMetadata   []string                   `json:"snippet_metadata" env:"PICOCLAW_RAG_SNIPPET_METADATA"` // "modified", "tags", "vault" on each source line
+	IncludePatterns   []string                   `json:"include_patterns" env:"PICOCLAW_RAG_INCLUDE_PATTERNS"`
+	ExcludePatterns   []string                   `json:"exclude_patterns" env:"PICOCLAW_RAG_EXCLUDE_PATTERNS"`
+	AnswerWithSources bool                       `json:"answer_with_sources" env:"PICOCLAW_RAG_ANSWER_WITH_SOURCES"`
+	FallbackToLLM     bool                       `json:"fallback_to_llm" env:"PICOCLAW_RAG_FALLBACK_TO_LLM"`
+	StaleCheck        bool                       `json:"stale_check" env:"PICOCLAW_RAG_STALE_CHECK"`
+	ReindexStale      bool                       `json:"reindex_stale" env:"PICOCLAW_RAG_REINDEX_STALE"`
+	LazyIndex         bool                       `json:"lazy_index" env:"PICOCLAW_RAG_LAZY_INDEX"`
+	IndexHTML         bool                       `json:"index_html" env:"PICOCLAW_RAG_INDEX_HTML"` // also index .html/.htm pages, e.g. a Notion export
+	IndexEPUB         bool                       `json:"index_epub" env:"PICOCLAW_RAG_INDEX_EPUB"` // also index .epub books
+	SharedState       bool                       `json:"shared_state" env:"PICOCLAW_RAG_SHARED_STATE"`
+	SearchBudgetMs    int                        `json:"search_budget_ms" env:"PICOCLAW_RAG_SEARCH_BUDGET_MS"`
+	SearchTimeoutMs   int                        `json:"search_timeout_ms" env:"PICOCLAW_RAG_SEARCH_TIMEOUT_MS"`
+	GroupByDocument   bool                       `json:"group_by_document" env:"PICOCLAW_RAG_GROUP_BY_DOCUMENT"`
+	MaxChunksPerDoc   int                        `json:"max_chunks_per_doc" env:"PICOCLAW_RAG_MAX_CHUNKS_PER_DOC"`
+	DateAware         bool                       `json:"date_aware" env:"PICOCLAW_RAG_DATE_AWARE"`
+	DailyNoteFormat   string                     `json:"daily_note_format" env:"PICOCLAW_RAG_DAILY_NOTE_FORMAT"` // Go time layout of daily note file names
+	QueryLog          bool                       `json:"query_log" env:"PICOCLAW_RAG_QUERY_LOG"`                 // record searches in query_log.jsonl for rag coverage
+	StateHistory      int                        `json:"state_history" env:"PICOCLAW_RAG_STATE_HISTORY"`         // index state snapshots kept for rag diff; 0 keeps none
+	LocalOnly         bool                       `json:"local_only" env:"PICOCLAW_RAG_LOCAL_ONLY"`               // refuse endpoints off this machine and LAN, disable web tools
+	Index             RagIndexConfig             `json:"index"`
+	Trigger           RagTriggerConfig           `json:"trigger"`
+	Router            RagRouterConfig            `json:"router"`
+	Embedding         RagEmbeddingConfig         `json:"embedding"`
+	Transcription     RagTranscriptionConfig     `json:"transcription"`
+	VectorDB          RagVectorDBConfig          `json:"vector_db"`
+	Capacity          RagCapacityConfig          `json:"capacity"`
+	AutoIndex         RagAutoIndexConfig         `json:"auto_index"`
+	Hierarchical      RagHierarchicalConfig      `json:"hierarchical"`
+	TwoStage          RagTwoStageConfig          `json:"two_stage"`
+	CircuitBreaker    RagCircuitBreakerConfig    `json:"circuit_breaker"`
+	LanguageRoutes    []RagLanguageRouteConfig   `json:"language_routes"`
+	Ensemble          RagEnsembleConfig          `json:"ensemble"`
+	RemoteVaults      []RagRemoteVaultConfig     `json:"remote_vaults"`
+	Boilerplate       RagBoilerplateConfig       `json:"boilerplate"`
+	Notifications     RagNotificationsConfig     `json:"notifications"`
+	Digest            RagDigestConfig            `json:"digest"`
+	Answers           RagAnswersConfig           `json:"answers"`
+	ChatCommands      RagChatCommandsConfig      `json:"chat_commands"`
+	PerUser           RagPerUserConfig           `json:"per_user"`
+	Guardrails        RagGuardrailsConfig        `json:"guardrails"`
+	Safety            RagSafetyConfig            `json:"safety"`
+	Trash             RagTrashConfig             `json:"trash"`
+	Feedback          RagFeedbackConfig          `json:"feedback"`
+	FollowUps         RagFollowUpsConfig         `json:"follow_ups"`
+	AuditLog          RagAuditLogConfig          `json:"audit_log"`
+	Anonymize         RagAnonymizeConfig         `json:"anonymize"`
+	HTTP              RagHTTPConfig              `json:"http"`
+	PostProcess       RagPostProcessConfig       `json:"post_process"`
+	Injection         RagInjectionConfig         `json:"injection"`
+	Sources           RagSourcesConfig           `json:"sources"`
+	Confidence        RagConfidenceConfig        `json:"confidence"`
+	NoHit             RagNoHitConfig             `json:"no_hit"`
+	Pinned            RagPinnedConfig            `json:"pinned"`
+	Presets           map[string]RagPresetConfig `json:"presets"`
+	Spelling          RagSpellingConfig          `json:"spelling"`
+	Synonyms          map[string]string          `json:"synonyms"`                                               // shorthand -> full term, e.g. "k8s": "kubernetes"
+	SynonymsInIndex   bool                       `json:"synonyms_in_index" env:"PICOCLAW_RAG_SYNONYMS_IN_INDEX"` // also expand indexed text before embedding
+	FormatProfiles    []RagFormatProfileConfig   `json:"format_profiles"`
+}
+
+// RagIndexConfig shapes index runs. Nice throttles them for small devices
+// such as ARM boards, so background indexing does not starve the chat
+// agent: it pauses NiceSleepMs before each file it indexes, sends one
+// embedding request at a time and caps batches at NiceBatchSize.
+// MaxMemoryMB, when set, is a memory ceiling for the process during index
+// runs: the chunks and vectors held at once are kept under half of it, by
+// embedding and writing large notes in smaller steps, and the Go runtime is
+// asked to stay under it. WriteIDs writes each markdown note's document ID
+// into its frontmatter as "id:", so the ID survives a lost index state.
+type RagIndexConfig struct {
+	Nice          bool `json:"nice" env:"PICOCLAW_RAG_INDEX_NICE"`
+	NiceSleepMs   int  `json:"nice_sleep_ms" env:"PICOCLAW_RAG_INDEX_NICE_SLEEP_MS"`
+	NiceBatchSize int  `json:"nice_batch_size" env:"PICOCLAW_RAG_INDEX_NICE_BATCH_SIZE"`
+	MaxMemoryMB   int  `json:"max_memory_mb" env:"PICOCLAW_RAG_INDEX_MAX_MEMORY_MB"`
+	WriteIDs      bool `json:"write_ids" env:"PICOCLAW_RAG_INDEX_WRITE_IDS"`
 }
 
 type RagTriggerConfig struct {
@@ -239,26 +344,454 @@ type RagTriggerConfig struct {
 	ForcePrefixes []string `json:"force_prefixes" env:"PICOCLAW_RAG_TRIGGER_FORCE_PREFIXES"`
 	SkipPrefixes  []string `json:"skip_prefixes" env:"PICOCLAW_RAG_TRIGGER_SKIP_PREFIXES"`
 	AutoKeywords  []string `json:"auto_keywords" env:"PICOCLAW_RAG_TRIGGER_AUTO_KEYWORDS"`
+	// TagPrefix starts a tag-scoped search, e.g. "kb#projectX: question".
+	TagPrefix string `json:"tag_prefix" env:"PICOCLAW_RAG_TRIGGER_TAG_PREFIX"`
+	// PresetPrefix starts a search with a rag.presets entry, e.g.
+	// "kb@research: question".
+	PresetPrefix string `json:"preset_prefix" env:"PICOCLAW_RAG_TRIGGER_PRESET_PREFIX"`
+}
+
+// RagRouterConfig replaces the keyword check of rag.trigger.auto with a
+// decision, for each message without a force or skip prefix, between
+// searching the vault, the web_search tool and the model alone. Mode
+// "heuristic" decides from rag.trigger.auto_keywords and the cue lists and
+// falls back to Default; "llm" asks the agent's LLM and uses the heuristic
+// when that fails. Decisions are appended to routes.jsonl in the data
+// directory; the messages themselves only with LogMessages.
+type RagRouterConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_RAG_ROUTER_ENABLED"`
+	Mode    string `json:"mode" env:"PICOCLAW_RAG_ROUTER_MODE"`
+	// Default is "vault", "web" or "direct".
+	Default    string   `json:"default" env:"PICOCLAW_RAG_ROUTER_DEFAULT"`
+	VaultCues  []string `json:"vault_cues" env:"PICOCLAW_RAG_ROUTER_VAULT_CUES"`
+	WebCues    []string `json:"web_cues" env:"PICOCLAW_RAG_ROUTER_WEB_CUES"`
+	DirectCues []string `json:"direct_cues" env:"PICOCLAW_RAG_ROUTER_DIRECT_CUES"`
+	// LogMessages records the text of each routed message in routes.jsonl.
+	LogMessages bool `json:"log_messages" env:"PICOCLAW_RAG_ROUTER_LOG_MESSAGES"`
 }
 
 type RagEmbeddingConfig struct {
-	APIKey         string `json:"api_key" env:"PICOCLAW_RAG_EMBEDDING_API_KEY"`
-	APIBase        string `json:"api_base" env:"PICOCLAW_RAG_EMBEDDING_API_BASE"`
-	Model          string `json:"model" env:"PICOCLAW_RAG_EMBEDDING_MODEL"`
-	Dimension      int    `json:"dimension" env:"PICOCLAW_RAG_EMBEDDING_DIMENSION"`
-	BatchSize      int    `json:"batch_size" env:"PICOCLAW_RAG_EMBEDDING_BATCH_SIZE"`
-	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_RAG_EMBEDDING_TIMEOUT_SECONDS"`
+	APIKey    string `json:"api_key" env:"PICOCLAW_RAG_EMBEDDING_API_KEY"`
+	APIBase   string `json:"api_base" env:"PICOCLAW_RAG_EMBEDDING_API_BASE"`
+	Model     string `json:"model" env:"PICOCLAW_RAG_EMBEDDING_MODEL"`
+	Dimension int    `json:"dimension" env:"PICOCLAW_RAG_EMBEDDING_DIMENSION"`
+	BatchSize int    `json:"batch_size" env:"PICOCLAW_RAG_EMBEDDING_BATCH_SIZE"`
+	// Concurrency is how many embedding requests indexing keeps in flight.
+	Concurrency           int `json:"concurrency" env:"PICOCLAW_RAG_EMBEDDING_CONCURRENCY"`
+	TimeoutSeconds        int `json:"timeout_seconds" env:"PICOCLAW_RAG_EMBEDDING_TIMEOUT_SECONDS"`
+	TimeoutPerInputMs     int `json:"timeout_per_input_ms" env:"PICOCLAW_RAG_EMBEDDING_TIMEOUT_PER_INPUT_MS"`
+	ConnectTimeoutSeconds int `json:"connect_timeout_seconds" env:"PICOCLAW_RAG_EMBEDDING_CONNECT_TIMEOUT_SECONDS"`
+	TLSTimeoutSeconds     int `json:"tls_timeout_seconds" env:"PICOCLAW_RAG_EMBEDDING_TLS_TIMEOUT_SECONDS"`
+	// CompressRequests gzips request bodies; see RagVectorDBConfig.
+	CompressRequests bool `json:"compress_requests" env:"PICOCLAW_RAG_EMBEDDING_COMPRESS_REQUESTS"`
+	// AdaptiveBatch replaces BatchSize, used as the starting point, with a
+	// size that keeps each request near TargetBatchMs and under
+	// MaxBatchTokens (estimated), between MinBatchSize and MaxBatchSize.
+	AdaptiveBatch  bool `json:"adaptive_batch" env:"PICOCLAW_RAG_EMBEDDING_ADAPTIVE_BATCH"`
+	TargetBatchMs  int  `json:"target_batch_ms" env:"PICOCLAW_RAG_EMBEDDING_TARGET_BATCH_MS"`
+	MaxBatchTokens int  `json:"max_batch_tokens" env:"PICOCLAW_RAG_EMBEDDING_MAX_BATCH_TOKENS"`
+	MinBatchSize   int  `json:"min_batch_size" env:"PICOCLAW_RAG_EMBEDDING_MIN_BATCH_SIZE"`
+	MaxBatchSize   int  `json:"max_batch_size" env:"PICOCLAW_RAG_EMBEDDING_MAX_BATCH_SIZE"`
+}
+
+// RagTranscriptionConfig turns audio notes, such as voice memos, into
+// transcripts with a Whisper-compatible /audio/transcriptions endpoint.
+type RagTranscriptionConfig struct {
+	Enabled        bool   `json:"enabled" env:"PICOCLAW_RAG_TRANSCRIPTION_ENABLED"`
+	APIKey         string `json:"api_key" env:"PICOCLAW_RAG_TRANSCRIPTION_API_KEY"`
+	APIBase        string `json:"api_base" env:"PICOCLAW_RAG_TRANSCRIPTION_API_BASE"`
+	Model          string `json:"model" env:"PICOCLAW_RAG_TRANSCRIPTION_MODEL"`
+	Language       string `json:"language" env:"PICOCLAW_RAG_TRANSCRIPTION_LANGUAGE"` // ISO-639-1 hint; empty lets the model detect it
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_RAG_TRANSCRIPTION_TIMEOUT_SECONDS"`
 }
 
 type RagVectorDBConfig struct {
-	URL            string `json:"url" env:"PICOCLAW_RAG_VECTOR_DB_URL"`
-	Collection     string `json:"collection" env:"PICOCLAW_RAG_VECTOR_DB_COLLECTION"`
-	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_RAG_VECTOR_DB_TIMEOUT_SECONDS"`
+	URL                   string `json:"url" env:"PICOCLAW_RAG_VECTOR_DB_URL"`
+	Collection            string `json:"collection" env:"PICOCLAW_RAG_VECTOR_DB_COLLECTION"`
+	TimeoutSeconds        int    `json:"timeout_seconds" env:"PICOCLAW_RAG_VECTOR_DB_TIMEOUT_SECONDS"`
+	ConnectTimeoutSeconds int    `json:"connect_timeout_seconds" env:"PICOCLAW_RAG_VECTOR_DB_CONNECT_TIMEOUT_SECONDS"`
+	TLSTimeoutSeconds     int    `json:"tls_timeout_seconds" env:"PICOCLAW_RAG_VECTOR_DB_TLS_TIMEOUT_SECONDS"`
+	// CompressRequests sends request bodies of 1 KB or more gzipped
+	// (Content-Encoding: gzip). A server that turns a compressed request
+	// down gets it again uncompressed, and compression is then dropped.
+	CompressRequests bool `json:"compress_requests" env:"PICOCLAW_RAG_VECTOR_DB_COMPRESS_REQUESTS"`
+	// BinaryQuantization keeps one bit per dimension, the sign, of every
+	// vector in memory: 32 times less than the float32 vectors, which move to
+	// disk. Searches compare the bits; with Rescore, the best Oversampling
+	// times as many candidates as requested are then re-ranked with the full
+	// vectors. An existing collection is converted in place.
+	BinaryQuantization bool    `json:"binary_quantization" env:"PICOCLAW_RAG_VECTOR_DB_BINARY_QUANTIZATION"`
+	Rescore            bool    `json:"rescore" env:"PICOCLAW_RAG_VECTOR_DB_RESCORE"`
+	Oversampling       float64 `json:"oversampling" env:"PICOCLAW_RAG_VECTOR_DB_OVERSAMPLING"`
+}
+
+// RagCapacityConfig limits the memory and disk the vector collection may
+// use, for the size forecast picoclaw rag index shows before indexing. When
+// both are 0 the limits are derived from what the Qdrant server reports.
+type RagCapacityConfig struct {
+	MemoryMB int `json:"memory_mb" env:"PICOCLAW_RAG_CAPACITY_MEMORY_MB"`
+	DiskMB   int `json:"disk_mb" env:"PICOCLAW_RAG_CAPACITY_DISK_MB"`
+}
+
+// RagRemoteVaultConfig mirrors the notes in cloud storage into the data
+// directory before each index run; they are then indexed like a vault_path
+// entry named Name. Type is "s3" for S3-compatible buckets, "webdav", e.g.
+// Nextcloud, or "confluence" for the pages of a Confluence space. For s3, URL
+// is the endpoint; for webdav, the folder URL; for confluence, the site URL
+// (with /wiki on Confluence Cloud).
+type RagRemoteVaultConfig struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Token     string `json:"token"` // confluence API token; sent with Username, or as a bearer token without it
+	Space     string `json:"space"` // confluence space key
+	CQL       string `json:"cql"`   // extra confluence CQL filter, e.g. label = "kb"
+}
+
+// RagEnsembleConfig searches more collections along with the vault's, such
+// as a collection of agent memories indexed by another picoclaw setup, and
+// fuses the results: each score is multiplied by the weight of its
+// collection and the best TopK of all are kept, instead of appending one
+// list to the other. TopK of 0 uses rag.top_k.
+type RagEnsembleConfig struct {
+	VaultWeight float64                       `json:"vault_weight" env:"PICOCLAW_RAG_ENSEMBLE_VAULT_WEIGHT"`
+	TopK        int                           `json:"top_k" env:"PICOCLAW_RAG_ENSEMBLE_TOP_K"`
+	Collections []RagEnsembleCollectionConfig `json:"collections"`
+}
+
+// RagEnsembleCollectionConfig is one collection of rag.ensemble. Name labels
+// its results in sources; an empty collection defaults to
+// "<collection>_<name>", and a Weight of 0 to 1. Empty embedding fields
+// inherit from rag.embedding; with none set, the query is embedded once for
+// the vault and this collection.
+type RagEnsembleCollectionConfig struct {
+	Name       string             `json:"name"`
+	Collection string             `json:"collection"`
+	Weight     float64            `json:"weight"`
+	Embedding  RagEmbeddingConfig `json:"embedding"`
+}
+
+// RagLanguageRouteConfig sends notes and queries in one language to their own
+// embedding model and collection. Empty embedding fields inherit from
+// rag.embedding; an empty collection defaults to "<collection>_<language>".
+type RagLanguageRouteConfig struct {
+	Language   string             `json:"language"`
+	Embedding  RagEmbeddingConfig `json:"embedding"`
+	Collection string             `json:"collection"`
+}
+
+// RagNotificationsConfig reports background index runs (schedule, SIGUSR1,
+// admin endpoint) to a webhook and/or chat channels. Channels are
+// "platform:chat_id" targets such as "telegram:123456", delivered through the
+// gateway's enabled channels.
+type RagNotificationsConfig struct {
+	WebhookURL string   `json:"webhook_url" env:"PICOCLAW_RAG_NOTIFICATIONS_WEBHOOK_URL"`
+	Channels   []string `json:"channels" env:"PICOCLAW_RAG_NOTIFICATIONS_CHANNELS"`
+	OnSuccess  bool     `json:"on_success" env:"PICOCLAW_RAG_NOTIFICATIONS_ON_SUCCESS"`
+	// OnFailure covers failed runs and runs where some files failed.
+	OnFailure bool `json:"on_failure" env:"PICOCLAW_RAG_NOTIFICATIONS_ON_FAILURE"`
+}
+
+// RagDigestConfig controls `picoclaw rag digest`, a summary of the notes
+// changed in a recent window grouped into topics, and the gateway's scheduled
+// digest. Folder is the vault folder digests are written to, e.g. "Digests",
+// or "work/Digests" with several vault roots; notes in it are left out of
+// later digests. With Enabled, the gateway builds a digest of the last
+// IntervalHours every IntervalHours, writes it when Write is set and sends it
+// to Channels ("platform:chat_id", as in notifications).
+type RagDigestConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_RAG_DIGEST_ENABLED"`
+	IntervalHours int      `json:"interval_hours" env:"PICOCLAW_RAG_DIGEST_INTERVAL_HOURS"`
+	Folder        string   `json:"folder" env:"PICOCLAW_RAG_DIGEST_FOLDER"`
+	Write         bool     `json:"write" env:"PICOCLAW_RAG_DIGEST_WRITE"`
+	Channels      []string `json:"channels" env:"PICOCLAW_RAG_DIGEST_CHANNELS"`
+	MaxTopics     int      `json:"max_topics" env:"PICOCLAW_RAG_DIGEST_MAX_TOPICS"`
+}
+
+// RagAnswersConfig lets chat users keep answers drawn from the knowledge
+// base: "/save" after such an answer appends the question, the answer, its
+// sources and the date to Note, a vault path such as "AI answers.md", which is
+// then indexed like any other note.
+type RagAnswersConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_RAG_ANSWERS_ENABLED"`
+	Note    string `json:"note" env:"PICOCLAW_RAG_ANSWERS_NOTE"`
+}
+
+// RagChatCommandsConfig enables the /kb commands in chat channels. Anyone
+// who may talk to the agent can search and check the status; only Admins,
+// given as "channel:sender_id" or a bare sender ID, can start an index run.
+type RagChatCommandsConfig struct {
+	Enabled bool                `json:"enabled" env:"PICOCLAW_RAG_CHAT_COMMANDS_ENABLED"`
+	Admins  FlexibleStringSlice `json:"admins" env:"PICOCLAW_RAG_CHAT_COMMANDS_ADMINS"`
+}
+
+// RagPerUserConfig gives every chat user a knowledge base of their own.
+// Each sender gets a vault under VaultRoot (default "<workspace>/vaults")
+// named after the channel and sender ID, its own collection and its own
+// index state under "<rag data dir>/users", and chat messages are answered
+// from the sender's knowledge base only.
+type RagPerUserConfig struct {
+	Enabled   bool   `json:"enabled" env:"PICOCLAW_RAG_PER_USER_ENABLED"`
+	VaultRoot string `json:"vault_root" env:"PICOCLAW_RAG_PER_USER_VAULT_ROOT"`
+}
+
+// RagSafetyConfig guards the index against sync glitches and unmounted
+// vaults. An index run that would remove more than MaxRemovedFraction of
+// the indexed notes stops before removing anything; 0 turns the check off.
+// It applies to indexes of 10 notes or more.
+type RagSafetyConfig struct {
+	MaxRemovedFraction float64 `json:"max_removed_fraction" env:"PICOCLAW_RAG_SAFETY_MAX_REMOVED_FRACTION"`
+}
+
+// RagTrashConfig keeps the points an index run deletes, for notes removed
+// from the vault or indexed again after a change, in the data directory for
+// RetentionDays, so picoclaw rag undo-delete can put them back without
+// embedding the notes again. Only the latest deletion of each note is kept,
+// and a full rebuild of the collection is not trashed.
+type RagTrashConfig struct {
+	Enabled       bool `json:"enabled" env:"PICOCLAW_RAG_TRASH_ENABLED"`
+	RetentionDays int  `json:"retention_days" env:"PICOCLAW_RAG_TRASH_RETENTION_DAYS"`
+}
+
+// RagFeedbackConfig learns per-note ranking boosts from good and bad marks,
+// given with /kb good and /kb bad in chat or picoclaw rag feedback. Each mark
+// counts for the note of the marked result and fades with a half-life of
+// HalfLifeDays; a note's boost approaches MaxBoost, or -MaxBoost, as marks of
+// one kind accumulate, and is added to the scores of its results.
+type RagFeedbackConfig struct {
+	Enabled      bool    `json:"enabled" env:"PICOCLAW_RAG_FEEDBACK_ENABLED"`
+	MaxBoost     float64 `json:"max_boost" env:"PICOCLAW_RAG_FEEDBACK_MAX_BOOST"`
+	HalfLifeDays int     `json:"half_life_days" env:"PICOCLAW_RAG_FEEDBACK_HALF_LIFE_DAYS"`
+}
+
+// RagFollowUpsConfig ends knowledge base answers with up to Count follow-up
+// questions, written by the LLM from notes the search found but the answer
+// did not use, so they lead to parts of the vault the user has not seen yet.
+type RagFollowUpsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_RAG_FOLLOW_UPS_ENABLED"`
+	Count   int  `json:"count" env:"PICOCLAW_RAG_FOLLOW_UPS_COUNT"`
+}
+
+// RagGuardrailsConfig protects the destructive operations reachable from
+// chat and the gateway's admin endpoints: full reindexing, purging the index
+// and pruning collections. From chat only Admins, given like
+// chat_commands.admins, may start them; the admin endpoints require
+// AdminToken as a bearer token and are off while it is empty. With Confirm
+// set, each request is first answered with a one-time token that must be
+// sent back within ConfirmTTLSeconds.
+type RagGuardrailsConfig struct {
+	Admins            FlexibleStringSlice `json:"admins" env:"PICOCLAW_RAG_GUARDRAILS_ADMINS"`
+	AdminToken        string              `json:"admin_token" env:"PICOCLAW_RAG_GUARDRAILS_ADMIN_TOKEN"`
+	Confirm           bool                `json:"confirm" env:"PICOCLAW_RAG_GUARDRAILS_CONFIRM"`
+	ConfirmTTLSeconds int                 `json:"confirm_ttl_seconds" env:"PICOCLAW_RAG_GUARDRAILS_CONFIRM_TTL_SECONDS"`
+}
+
+// RagAuditLogConfig records every piece of note content sent to an LLM,
+// with the time, the conversation and the model, in context_audit.jsonl in
+// the RAG data directory. The log moves to context_audit.jsonl.1 at
+// MaxSizeMB, and MaxFiles rotated files are kept.
+type RagAuditLogConfig struct {
+	Enabled   bool `json:"enabled" env:"PICOCLAW_RAG_AUDIT_LOG_ENABLED"`
+	MaxSizeMB int  `json:"max_size_mb" env:"PICOCLAW_RAG_AUDIT_LOG_MAX_SIZE_MB"`
+	MaxFiles  int  `json:"max_files" env:"PICOCLAW_RAG_AUDIT_LOG_MAX_FILES"`
+}
+
+// RagHTTPConfig tunes the connections to the embedding APIs and Qdrant.
+// HTTP2 lets TLS endpoints negotiate HTTP/2, which carries the parallel
+// requests of an index run over one connection. H2C speaks HTTP/2 to every
+// endpoint, with or without TLS, for local servers that support cleartext
+// HTTP/2; servers that only speak HTTP/1.1 then fail. MaxIdleConnsPerHost is
+// how many connections to one server stay open between requests,
+// MaxConnsPerHost caps the connections to one server (0 for no limit) and
+// IdleConnTimeoutSeconds closes connections idle for longer.
+type RagHTTPConfig struct {
+	HTTP2                  bool `json:"http2" env:"PICOCLAW_RAG_HTTP_HTTP2"`
+	H2C                    bool `json:"h2c" env:"PICOCLAW_RAG_HTTP_H2C"`
+	MaxIdleConnsPerHost    int  `json:"max_idle_conns_per_host" env:"PICOCLAW_RAG_HTTP_MAX_IDLE_CONNS_PER_HOST"`
+	MaxConnsPerHost        int  `json:"max_conns_per_host" env:"PICOCLAW_RAG_HTTP_MAX_CONNS_PER_HOST"`
+	IdleConnTimeoutSeconds int  `json:"idle_conn_timeout_seconds" env:"PICOCLAW_RAG_HTTP_IDLE_CONN_TIMEOUT_SECONDS"`
+}
+
+// RagAnonymizeConfig replaces personal names and IDs with placeholders such
+// as "[PERSON_1]" in the text sent to embedding APIs outside this machine
+// and the local network. Detect picks the built-in detectors ("email",
+// "phone", "id", "title_name" for names after Mr, Dr and the like, and
+// "mention" for @handles); Names are names to replace wherever they appear;
+// Patterns adds regular expressions under their own placeholder kind, e.g.
+// "CASE": "CASE-\\d+". The same value always gets the same placeholder, and
+// the mapping stays in the RAG data directory.
+type RagAnonymizeConfig struct {
+	Enabled  bool                `json:"enabled" env:"PICOCLAW_RAG_ANONYMIZE_ENABLED"`
+	Detect   FlexibleStringSlice `json:"detect" env:"PICOCLAW_RAG_ANONYMIZE_DETECT"`
+	Names    FlexibleStringSlice `json:"names" env:"PICOCLAW_RAG_ANONYMIZE_NAMES"`
+	Patterns map[string]string   `json:"patterns"`
+}
+
+// RagPostProcessConfig runs an external program on every result set before
+// it is turned into prompt context. Command is the program and its arguments;
+// it reads the results as a JSON array on stdin and writes the transformed
+// array to stdout.
+type RagPostProcessConfig struct {
+	Command        []string `json:"command" env:"PICOCLAW_RAG_POST_PROCESS_COMMAND"`
+	TimeoutSeconds int      `json:"timeout_seconds" env:"PICOCLAW_RAG_POST_PROCESS_TIMEOUT_SECONDS"`
+}
+
+// RagInjectionConfig controls where retrieved notes are placed in the
+// prompt. Mode is "user_suffix" (after the question), "user_prefix",
+// "system" or "assistant_tool_result" (a synthetic search tool call and its
+// result). Position applies to the last two: "before_user" puts the context
+// right before the question, "after_system" right after the system prompt,
+// ahead of the conversation history. Format is "text" (numbered prose
+// blocks) or "json" (a compact structure that tool-calling models tend to
+// ground on better).
+type RagInjectionConfig struct {
+	Mode     string `json:"mode" env:"PICOCLAW_RAG_INJECTION_MODE"`
+	Position string `json:"position" env:"PICOCLAW_RAG_INJECTION_POSITION"`
+	Format   string `json:"format" env:"PICOCLAW_RAG_INJECTION_FORMAT"`
+}
+
+// RagFormatProfileConfig adapts the prompt context to the model the agent
+// talks to. The first profile with a Models pattern matching the model name
+// is used; "*" in a pattern matches any text, e.g. "qwen2.5:*" or "*mini*".
+// Style "terse" replaces the instruction text with a one-line header, which
+// suits small local models; "verbose" (the default) keeps it. Header and
+// Footer override the instruction text, and zero limits keep the defaults.
+type RagFormatProfileConfig struct {
+	Models          []string `json:"models"`
+	Style           string   `json:"style"`
+	SnippetMaxChars int      `json:"snippet_max_chars"`
+	MaxResults      int      `json:"max_results"`
+	Header          string   `json:"header"`
+	Footer          string   `json:"footer"`
+}
+
+// RagSourcesConfig controls the Sources section added to answers when
+// answer_with_sources is on. CitedOnly lists only the [n] citations the
+// answer actually uses, replacing any Sources section the model wrote.
+// LinkStyle is "none", "obsidian" (obsidian://open links), "vscode"
+// (vscode://file links to the cited line) or "file" (file:// links).
+type RagSourcesConfig struct {
+	CitedOnly bool   `json:"cited_only" env:"PICOCLAW_RAG_SOURCES_CITED_ONLY"`
+	LinkStyle string `json:"link_style" env:"PICOCLAW_RAG_SOURCES_LINK_STYLE"`
+	// ObsidianVault is the vault name used in obsidian:// links. It
+	// defaults to the name of the vault directory.
+	ObsidianVault string `json:"obsidian_vault" env:"PICOCLAW_RAG_SOURCES_OBSIDIAN_VAULT"`
+}
+
+// RagConfidenceConfig rates how well the retrieved notes match a question.
+// Results scoring HighScore or more count as strong matches; when even the
+// best scores below LowScore, the notes likely do not answer it. With
+// Guidance on, the rating and what to do about it are added to the context.
+type RagConfidenceConfig struct {
+	Guidance  bool    `json:"guidance" env:"PICOCLAW_RAG_CONFIDENCE_GUIDANCE"`
+	HighScore float64 `json:"high_score" env:"PICOCLAW_RAG_CONFIDENCE_HIGH_SCORE"`
+	LowScore  float64 `json:"low_score" env:"PICOCLAW_RAG_CONFIDENCE_LOW_SCORE"`
+}
+
+// RagNoHitConfig chooses what happens when no note clears min_similarity.
+// Behavior is "silent" (answer without notes), "notify_user" (reply that
+// nothing was found), "fallback_keyword" (retry as a keyword search over the
+// indexed text) or "lower_threshold_once" (retry once with LowerThreshold as
+// min_similarity). When empty it follows fallback_to_llm: "silent" when set,
+// "notify_user" otherwise, which is also what happens when a retry finds
+// nothing.
+type RagNoHitConfig struct {
+	Behavior       string  `json:"behavior" env:"PICOCLAW_RAG_NO_HIT_BEHAVIOR"`
+	LowerThreshold float64 `json:"lower_threshold" env:"PICOCLAW_RAG_NO_HIT_LOWER_THRESHOLD"`
+}
+
+// RagPinnedConfig lists notes, as paths in the vault, that go into the
+// context of every message regardless of what the search finds, e.g. standing
+// instructions or a glossary. A message can pin more with pin:<note>.
+// Pinned notes share MaxTokens and come before the search results; they do
+// not count against top_k or a format profile's max_results.
+type RagPinnedConfig struct {
+	Notes     []string `json:"notes" env:"PICOCLAW_RAG_PINNED_NOTES"`
+	MaxTokens int      `json:"max_tokens" env:"PICOCLAW_RAG_PINNED_MAX_TOKENS"`
+}
+
+// RagSpellingConfig corrects typos in queries before they are embedded,
+// using the words of the vault as the dictionary. Words of MinWordLength
+// runes or more that the vault never uses are replaced with the most frequent
+// vault word within MaxEditDistance (1 or 2) edits. Languages limits it to
+// queries detected as those languages; Latin script counts as "en", and an
+// empty list means every language written with spaces.
+type RagSpellingConfig struct {
+	Enabled         bool     `json:"enabled" env:"PICOCLAW_RAG_SPELLING_ENABLED"`
+	Languages       []string `json:"languages" env:"PICOCLAW_RAG_SPELLING_LANGUAGES"`
+	MaxEditDistance int      `json:"max_edit_distance" env:"PICOCLAW_RAG_SPELLING_MAX_EDIT_DISTANCE"`
+	MinWordLength   int      `json:"min_word_length" env:"PICOCLAW_RAG_SPELLING_MIN_WORD_LENGTH"`
+}
+
+// RagPresetConfig is a named bundle of retrieval settings, chosen per search
+// with the trigger's preset prefix or "picoclaw rag search --preset". Zero
+// fields keep the rag-wide setting; MaxChunksPerDoc above 0 turns on
+// per-document grouping with that cap. The filters add to those of the
+// search.
+type RagPresetConfig struct {
+	TopK            int      `json:"top_k"`
+	MinSimilarity   float64  `json:"min_similarity"`
+	MaxChunksPerDoc int      `json:"max_chunks_per_doc"`
+	Tags            []string `json:"tags"`
+	ExcludePaths    []string `json:"exclude_paths"`
+	ExcludeTags     []string `json:"exclude_tags"`
+}
+
+// RagBoilerplateConfig removes template text (footers, navigation blocks)
+// from notes before they are chunked and embedded. Literals are matched
+// exactly and Patterns are regular expressions; both may span lines. When
+// AutoDetectPercent is set, lines found in more than that share of notes are
+// removed too, once the vault has at least AutoDetectMinDocs notes.
+type RagBoilerplateConfig struct {
+	Literals          []string `json:"literals" env:"PICOCLAW_RAG_BOILERPLATE_LITERALS"`
+	Patterns          []string `json:"patterns" env:"PICOCLAW_RAG_BOILERPLATE_PATTERNS"`
+	AutoDetectPercent int      `json:"auto_detect_percent" env:"PICOCLAW_RAG_BOILERPLATE_AUTO_DETECT_PERCENT"`
+	AutoDetectMinDocs int      `json:"auto_detect_min_docs" env:"PICOCLAW_RAG_BOILERPLATE_AUTO_DETECT_MIN_DOCS"`
+}
+
+type RagCircuitBreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold" env:"PICOCLAW_RAG_CIRCUIT_BREAKER_FAILURE_THRESHOLD"`
+	CooldownSeconds  int `json:"cooldown_seconds" env:"PICOCLAW_RAG_CIRCUIT_BREAKER_COOLDOWN_SECONDS"`
+}
+
+// RagHierarchicalConfig adds summary levels to the index, RAPTOR style. After
+// an index run that changed notes, the indexer clusters the chunks by
+// embedding, has the agent's model summarize each cluster and embeds the
+// summaries next to the chunks; each further level summarizes the clusters of
+// the level below. Searches match chunks and summaries alike, so a question
+// can retrieve both details and an overview. Summaries of unchanged clusters
+// are reused.
+type RagHierarchicalConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_RAG_HIERARCHICAL_ENABLED"`
+	// Levels is the number of summary levels above the chunks.
+	Levels int `json:"levels" env:"PICOCLAW_RAG_HIERARCHICAL_LEVELS"`
+	// ClusterSize is the largest number of chunks or summaries in a cluster.
+	ClusterSize int `json:"cluster_size" env:"PICOCLAW_RAG_HIERARCHICAL_CLUSTER_SIZE"`
+}
+
+// RagTwoStageConfig routes searches through a vector per note, the mean of
+// its chunk vectors. A search first picks the Documents notes closest to the
+// query, then searches the chunks of those notes only, which is faster on
+// very large collections and spreads the results over more notes.
+type RagTwoStageConfig struct {
+	Enabled   bool `json:"enabled" env:"PICOCLAW_RAG_TWO_STAGE_ENABLED"`
+	Documents int  `json:"documents" env:"PICOCLAW_RAG_TWO_STAGE_DOCUMENTS"`
 }
 
 type RagAutoIndexConfig struct {
 	Enabled       bool `json:"enabled" env:"PICOCLAW_RAG_AUTO_INDEX_ENABLED"`
 	IntervalHours int  `json:"interval_hours" env:"PICOCLAW_RAG_AUTO_INDEX_INTERVAL_HOURS"`
+	// AdminToken guards POST /admin/index on the gateway. When empty, the
+	// admin endpoints only accept requests from loopback addresses. The
+	// destructive ones need rag.guardrails.admin_token instead.
+	AdminToken string `json:"admin_token" env:"PICOCLAW_RAG_AUTO_INDEX_ADMIN_TOKEN"`
 }
 
 func DefaultConfig() *Config {
@@ -370,21 +903,51 @@ func DefaultConfig() *Config {
 			},
 		},
 		RAG: RagConfig{
-			Enabled:         false,
-			VaultPath:       "/vault",
-			ChunkSize:       800,
-			ChunkOverlap:    120,
-			TopK:            6,
-			MinSimilarity:   0.25,
-			SnippetMaxChars: 1200,
-			IncludePatterns: []string{},
-			ExcludePatterns: []string{".obsidian/**", ".trash/**"},
+			Enabled:           false,
+			VaultPath:         VaultPaths{"/vault"},
+			VaultID:           "",
+			DataDir:           "",
+			ChunkSize:         800,
+			ChunkOverlap:      120,
+			MinChunkChars:     0,
+			TopK:              6,
+			MinSimilarity:     0.25,
+			SnippetMaxChars:   1200,
+			SnippetBoundary:   "sentence",
+			SnippetStops:      []string{},
+			SnippetMetadata:   []string{"modified", "tags"},
+			IncludePatterns:   []string{},
+			ExcludePatterns:   []string{".obsidian/**", ".trash/**"},
 			AnswerWithSources: true,
 			FallbackToLLM:     false,
+			StaleCheck:        true,
+			ReindexStale:      false,
+			LazyIndex:         true,
+			IndexHTML:         false,
+			IndexEPUB:         false,
+			SharedState:       false,
+			SearchBudgetMs:    0,
+			SearchTimeoutMs:   30000,
+			GroupByDocument:   false,
+			MaxChunksPerDoc:   1,
+			DateAware:         true,
+			DailyNoteFormat:   "2006-01-02",
+			QueryLog:          false,
+			StateHistory:      20,
+			LocalOnly:         false,
+			Index: RagIndexConfig{
+				Nice:          false,
+				NiceSleepMs:   250,
+				NiceBatchSize: 4,
+				MaxMemoryMB:   0,
+				WriteIDs:      false,
+			},
 			Trigger: RagTriggerConfig{
 				Auto:          true,
 				ForcePrefixes: []string{"笔记:", "笔记："},
 				SkipPrefixes:  []string{"不查:", "不查："},
+				TagPrefix:     "kb#",
+				PresetPrefix:  "kb@",
 				AutoKeywords: []string{
 					"诊断", "鉴别", "治疗", "用药", "剂量", "不良反应", "适应症", "禁忌",
 					"指南", "病例", "症状", "体征", "检查", "影像", "化验", "血常规", "生化",
@@ -393,23 +956,187 @@ func DefaultConfig() *Config {
 					"symptom", "sign", "lab", "imaging", "prognosis",
 				},
 			},
+			Router: RagRouterConfig{
+				Enabled:     false,
+				Mode:        "heuristic",
+				Default:     "direct",
+				VaultCues:   []string{"我的笔记", "笔记里", "我记过", "my notes", "i wrote", "my vault", "i noted"},
+				WebCues:     []string{"最新", "新闻", "今天", "天气", "latest", "news", "today", "weather", "this week", "http://", "https://"},
+				DirectCues:  []string{"翻译", "润色", "你好", "谢谢", "translate", "rewrite", "hello", "thanks", "thank you"},
+				LogMessages: false,
+			},
 			Embedding: RagEmbeddingConfig{
-				APIBase:        "",
+				APIBase:               "",
+				APIKey:                "",
+				Model:                 "",
+				Dimension:             0,
+				BatchSize:             16,
+				Concurrency:           1,
+				TimeoutSeconds:        60,
+				TimeoutPerInputMs:     1000,
+				ConnectTimeoutSeconds: 10,
+				TLSTimeoutSeconds:     10,
+				CompressRequests:      false,
+				AdaptiveBatch:         false,
+				TargetBatchMs:         2000,
+				MaxBatchTokens:        8000,
+				MinBatchSize:          1,
+				MaxBatchSize:          256,
+			},
+			Transcription: RagTranscriptionConfig{
+				Enabled:        false,
 				APIKey:         "",
-				Model:          "",
-				Dimension:      0,
-				BatchSize:      16,
-				TimeoutSeconds: 60,
+				APIBase:        "",
+				Model:          "whisper-1",
+				Language:       "",
+				TimeoutSeconds: 300,
 			},
 			VectorDB: RagVectorDBConfig{
-				URL:            "http://qdrant:6333",
-				Collection:     "picoclaw_notes",
-				TimeoutSeconds: 30,
+				URL:                   "http://qdrant:6333",
+				Collection:            "picoclaw_notes",
+				TimeoutSeconds:        30,
+				ConnectTimeoutSeconds: 5,
+				TLSTimeoutSeconds:     10,
+				CompressRequests:      false,
+				BinaryQuantization:    false,
+				Rescore:               true,
+				Oversampling:          2.0,
+			},
+			Capacity: RagCapacityConfig{
+				MemoryMB: 0,
+				DiskMB:   0,
 			},
 			AutoIndex: RagAutoIndexConfig{
 				Enabled:       false,
 				IntervalHours: 12,
 			},
+			Hierarchical: RagHierarchicalConfig{
+				Enabled:     false,
+				Levels:      2,
+				ClusterSize: 10,
+			},
+			TwoStage: RagTwoStageConfig{
+				Enabled:   false,
+				Documents: 20,
+			},
+			CircuitBreaker: RagCircuitBreakerConfig{
+				FailureThreshold: 3,
+				CooldownSeconds:  30,
+			},
+			LanguageRoutes: []RagLanguageRouteConfig{},
+			Ensemble: RagEnsembleConfig{
+				VaultWeight: 1.0,
+				TopK:        0,
+				Collections: []RagEnsembleCollectionConfig{},
+			},
+			RemoteVaults: []RagRemoteVaultConfig{},
+			Boilerplate: RagBoilerplateConfig{
+				Literals:          []string{},
+				Patterns:          []string{},
+				AutoDetectPercent: 0,
+				AutoDetectMinDocs: 20,
+			},
+			Notifications: RagNotificationsConfig{
+				WebhookURL: "",
+				Channels:   []string{},
+				OnSuccess:  true,
+				OnFailure:  true,
+			},
+			Digest: RagDigestConfig{
+				Enabled:       false,
+				IntervalHours: 24,
+				Folder:        "Digests",
+				Write:         false,
+				Channels:      []string{},
+				MaxTopics:     8,
+			},
+			Answers: RagAnswersConfig{
+				Enabled: false,
+				Note:    "AI answers.md",
+			},
+			ChatCommands: RagChatCommandsConfig{
+				Enabled: false,
+				Admins:  FlexibleStringSlice{},
+			},
+			PerUser: RagPerUserConfig{
+				Enabled:   false,
+				VaultRoot: "",
+			},
+			Guardrails: RagGuardrailsConfig{
+				Admins:            FlexibleStringSlice{},
+				Confirm:           true,
+				ConfirmTTLSeconds: 120,
+			},
+			Safety: RagSafetyConfig{
+				MaxRemovedFraction: 0.5,
+			},
+			Trash: RagTrashConfig{
+				Enabled:       false,
+				RetentionDays: 7,
+			},
+			Feedback: RagFeedbackConfig{
+				Enabled:      false,
+				MaxBoost:     0.05,
+				HalfLifeDays: 30,
+			},
+			FollowUps: RagFollowUpsConfig{
+				Enabled: false,
+				Count:   3,
+			},
+			AuditLog: RagAuditLogConfig{
+				Enabled:   false,
+				MaxSizeMB: 10,
+				MaxFiles:  5,
+			},
+			Anonymize: RagAnonymizeConfig{
+				Enabled: false,
+				Detect:  FlexibleStringSlice{"email", "phone", "id", "title_name"},
+				Names:   FlexibleStringSlice{},
+			},
+			HTTP: RagHTTPConfig{
+				HTTP2:                  true,
+				H2C:                    false,
+				MaxIdleConnsPerHost:    64,
+				MaxConnsPerHost:        0,
+				IdleConnTimeoutSeconds: 90,
+			},
+			PostProcess: RagPostProcessConfig{
+				Command:        []string{},
+				TimeoutSeconds: 5,
+			},
+			Injection: RagInjectionConfig{
+				Mode:     "user_suffix",
+				Position: "before_user",
+				Format:   "text",
+			},
+			Sources: RagSourcesConfig{
+				CitedOnly:     true,
+				LinkStyle:     "none",
+				ObsidianVault: "",
+			},
+			Confidence: RagConfidenceConfig{
+				Guidance:  false,
+				HighScore: 0.6,
+				LowScore:  0.4,
+			},
+			NoHit: RagNoHitConfig{
+				Behavior:       "",
+				LowerThreshold: 0.15,
+			},
+			Pinned: RagPinnedConfig{
+				Notes:     []string{},
+				MaxTokens: 1000,
+			},
+			Presets:         map[string]RagPresetConfig{},
+			Synonyms:        map[string]string{},
+			SynonymsInIndex: false,
+			Spelling: RagSpellingConfig{
+				Enabled:         false,
+				Languages:       []string{"en"},
+				MaxEditDistance: 1,
+				MinWordLength:   4,
+			},
+			FormatProfiles: []RagFormatProfileConfig{},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
@@ -464,7 +1191,36 @@ func SaveConfig(path string, cfg *Config) error {
 func (c *Config) WorkspacePath() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return expandHome(c.Agents.Defaults.Workspace)
+	return ExpandPath(c.Agents.Defaults.Workspace)
+}
+
+// DefaultDataWorkspace is where RAG data goes when no workspace is
+// configured: $XDG_DATA_HOME/picoclaw/workspace, or ~/.picoclaw/workspace
+// when XDG_DATA_HOME is unset.
+func DefaultDataWorkspace() string {
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		return filepath.Join(ExpandPath(xdg), "picoclaw", "workspace")
+	}
+	return ExpandPath("~/.picoclaw/workspace")
+}
+
+func workspacePath(configured string) string {
+	if configured == "" {
+		return DefaultDataWorkspace()
+	}
+	return ExpandPath(configured)
+}
+
+// RagDataDir returns where the knowledge base keeps its index state and
+// reports: rag.data_dir if set, otherwise the "rag" directory in the
+// workspace, or in DefaultDataWorkspace when none is configured.
+func (c *Config) RagDataDir() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.RAG.DataDir != "" {
+		return ExpandPath(c.RAG.DataDir)
+	}
+	return filepath.Join(workspacePath(c.Agents.Defaults.Workspace), "rag")
 }
 
 func (c *Config) GetAPIKey() string {
@@ -515,16 +1271,39 @@ func (c *Config) GetAPIBase() string {
 	return ""
 }
 
-func expandHome(path string) string {
+var pathEnvPattern = regexp.MustCompile(`%[A-Za-z_][A-Za-z0-9_]*%|\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// ExpandPath expands a leading "~" and environment variable references
+// written as $VAR, ${VAR} or %VAR%. The Windows form is understood on every
+// platform so copied configs keep working, and HOME and USERPROFILE fall back
+// to the user's home directory when unset. Unknown variables are left as
+// written.
+func ExpandPath(path string) string {
 	if path == "" {
 		return path
 	}
-	if path[0] == '~' {
-		home, _ := os.UserHomeDir()
-		if len(path) > 1 && path[1] == '/' {
-			return home + path[1:]
+	path = pathEnvPattern.ReplaceAllStringFunc(path, func(ref string) string {
+		name := strings.Trim(ref, "%${}")
+		if v, ok := lookupPathEnv(name); ok {
+			return v
 		}
-		return home
+		return ref
+	})
+	if path[0] == '~' && (len(path) == 1 || path[1] == '/' || path[1] == '\\') {
+		home, _ := os.UserHomeDir()
+		return home + path[1:]
 	}
 	return path
 }
+
+func lookupPathEnv(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true
+	}
+	if name == "HOME" || name == "USERPROFILE" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home, true
+		}
+	}
+	return "", false
+}
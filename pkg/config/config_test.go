@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -21,7 +22,7 @@ func TestDefaultConfig_WorkspacePath(t *testing.T) {
 	cfg := DefaultConfig()
 
 	// Just verify the workspace is set, don't compare exact paths
-	// since expandHome behavior may differ based on environment
+	// since ExpandPath behavior may differ based on environment
 	if cfg.Agents.Defaults.Workspace == "" {
 		t.Error("Workspace should not be empty")
 	}
@@ -204,3 +205,83 @@ func TestConfig_Complete(t *testing.T) {
 		t.Error("Heartbeat should be enabled by default")
 	}
 }
+
+func TestVaultPaths_UnmarshalJSON(t *testing.T) {
+	var single VaultPaths
+	if err := json.Unmarshal([]byte(`"/vault"`), &single); err != nil {
+		t.Fatalf("unmarshal string: %v", err)
+	}
+	if len(single) != 1 || single[0] != "/vault" {
+		t.Errorf("single = %v", single)
+	}
+
+	var list VaultPaths
+	if err := json.Unmarshal([]byte(`["work=/a", "/b"]`), &list); err != nil {
+		t.Fatalf("unmarshal list: %v", err)
+	}
+	if len(list) != 2 || list[0] != "work=/a" {
+		t.Errorf("list = %v", list)
+	}
+
+	data, _ := json.Marshal(single)
+	if string(data) != `"/vault"` {
+		t.Errorf("single path should marshal as a string, got %s", data)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	t.Setenv("PICOCLAW_TEST_DIR", "/data")
+	t.Setenv("USERPROFILE", "")
+	os.Unsetenv("USERPROFILE")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"~", home},
+		{"~/vault", home + "/vault"},
+		{"$PICOCLAW_TEST_DIR/vault", "/data/vault"},
+		{"${PICOCLAW_TEST_DIR}/vault", "/data/vault"},
+		{"%PICOCLAW_TEST_DIR%/vault", "/data/vault"},
+		{"%USERPROFILE%/vault", home + "/vault"},
+		{"$PICOCLAW_UNSET_VAR/vault", "$PICOCLAW_UNSET_VAR/vault"},
+		{"~other/vault", "~other/vault"},
+	}
+	for _, tt := range tests {
+		if got := ExpandPath(tt.in); got != tt.want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWorkspacePath_XDGDefault(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/xdg")
+	if got := workspacePath(""); got != filepath.Join("/xdg", "picoclaw", "workspace") {
+		t.Errorf("workspacePath(\"\") = %q", got)
+	}
+	if got := workspacePath("/custom"); got != "/custom" {
+		t.Errorf("configured workspace should win, got %q", got)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Agents.Defaults.Workspace = ""
+	if got := cfg.WorkspacePath(); got != "" {
+		t.Errorf("WorkspacePath() without a workspace = %q, want it left empty", got)
+	}
+	if got := cfg.RagDataDir(); got != filepath.Join("/xdg", "picoclaw", "workspace", "rag") {
+		t.Errorf("RagDataDir() without a workspace = %q", got)
+	}
+	cfg.Agents.Defaults.Workspace = "/ws"
+	if got := cfg.RagDataDir(); got != filepath.Join("/ws", "rag") {
+		t.Errorf("RagDataDir() = %q", got)
+	}
+	cfg.RAG.DataDir = "$XDG_DATA_HOME/picoclaw/rag"
+	if got := cfg.RagDataDir(); got != "/xdg/picoclaw/rag" {
+		t.Errorf("RagDataDir() with data_dir = %q", got)
+	}
+}
@@ -314,10 +314,10 @@ func PrintSummary(result *Result) {
 
 func resolveOpenClawHome(override string) (string, error) {
 	if override != "" {
-		return expandHome(override), nil
+		return config.ExpandPath(override), nil
 	}
 	if envHome := os.Getenv("OPENCLAW_HOME"); envHome != "" {
-		return expandHome(envHome), nil
+		return config.ExpandPath(envHome), nil
 	}
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -328,10 +328,10 @@ func resolveOpenClawHome(override string) (string, error) {
 
 func resolvePicoClawHome(override string) (string, error) {
 	if override != "" {
-		return expandHome(override), nil
+		return config.ExpandPath(override), nil
 	}
 	if envHome := os.Getenv("PICOCLAW_HOME"); envHome != "" {
-		return expandHome(envHome), nil
+		return config.ExpandPath(envHome), nil
 	}
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -344,20 +344,6 @@ func resolveWorkspace(homeDir string) string {
 	return filepath.Join(homeDir, "workspace")
 }
 
-func expandHome(path string) string {
-	if path == "" {
-		return path
-	}
-	if path[0] == '~' {
-		home, _ := os.UserHomeDir()
-		if len(path) > 1 && path[1] == '/' {
-			return home + path[1:]
-		}
-		return home
-	}
-	return path
-}
-
 func backupFile(path string) error {
 	bakPath := path + ".bak"
 	return copyFile(path, bakPath)
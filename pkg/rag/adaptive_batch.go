@@ -0,0 +1,106 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// batchController sizes embedding batches for rag.embedding.adaptive_batch.
+// It keeps running averages of the latency per token and the tokens per
+// input, and after every request moves the batch size toward the largest
+// batch that stays within both the latency target and the token budget, at
+// most doubling or halving it at a time. A failed request halves it.
+type batchController struct {
+	min           int
+	max           int
+	targetLatency time.Duration
+	maxTokens     int
+
+	mu             sync.Mutex
+	size           int
+	msPerToken     float64
+	tokensPerInput float64
+}
+
+// ewmaWeight is how much a new observation moves the running averages.
+const ewmaWeight = 0.3
+
+// newBatchController returns nil when adaptive batching is off. It starts at
+// batch_size.
+func newBatchController(cfg config.RagEmbeddingConfig, start int) *batchController {
+	if !cfg.AdaptiveBatch {
+		return nil
+	}
+	b := &batchController{
+		min:           cfg.MinBatchSize,
+		max:           cfg.MaxBatchSize,
+		targetLatency: time.Duration(cfg.TargetBatchMs) * time.Millisecond,
+		maxTokens:     cfg.MaxBatchTokens,
+	}
+	if b.min <= 0 {
+		b.min = 1
+	}
+	if b.max < b.min {
+		b.max = max(b.min, 256)
+	}
+	if b.targetLatency <= 0 {
+		b.targetLatency = 2 * time.Second
+	}
+	b.size = min(max(start, b.min), b.max)
+	return b
+}
+
+func (b *batchController) current() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// observe records a request of inputs that took elapsed and ended with err.
+func (b *batchController) observe(inputs []string, elapsed time.Duration, err error) {
+	// Cancelled runs and an open circuit breaker say nothing about the
+	// batch size.
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrUnavailable) || len(inputs) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		// Timeouts, payload limits and rate limits all call for smaller
+		// requests; other errors cost little to retry smaller as well.
+		b.size = max(b.min, b.size/2)
+		return
+	}
+	tokens := 0
+	for _, text := range inputs {
+		tokens += EstimateTokens(text)
+	}
+	tokens = max(tokens, 1)
+	b.msPerToken = ewma(b.msPerToken, float64(elapsed.Milliseconds())/float64(tokens))
+	b.tokensPerInput = ewma(b.tokensPerInput, float64(tokens)/float64(len(inputs)))
+
+	want := math.Inf(1)
+	if b.msPerToken > 0 {
+		want = float64(b.targetLatency.Milliseconds()) / (b.msPerToken * b.tokensPerInput)
+	}
+	if b.maxTokens > 0 {
+		want = math.Min(want, float64(b.maxTokens)/b.tokensPerInput)
+	}
+	next := b.size * 2
+	if want < float64(next) {
+		next = int(want)
+	}
+	b.size = min(max(next, b.size/2, b.min), b.max)
+}
+
+func ewma(avg, sample float64) float64 {
+	if avg == 0 {
+		return sample
+	}
+	return avg + ewmaWeight*(sample-avg)
+}
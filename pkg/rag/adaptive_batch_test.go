@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBatchController(t *testing.T) {
+	if newBatchController(config.RagEmbeddingConfig{}, 16) != nil {
+		t.Fatal("controller created without adaptive_batch")
+	}
+	b := newBatchController(config.RagEmbeddingConfig{
+		AdaptiveBatch:  true,
+		TargetBatchMs:  1000,
+		MaxBatchTokens: 4000,
+		MinBatchSize:   2,
+		MaxBatchSize:   512,
+	}, 16)
+	// 100 estimated tokens per input.
+	text := strings.Repeat("x", 250)
+	batch := func(n int) []string {
+		inputs := make([]string, n)
+		for i := range inputs {
+			inputs[i] = text
+		}
+		return inputs
+	}
+
+	// Fast responses grow the batch by at most double per request, up to
+	// the token budget of 40 inputs.
+	b.observe(batch(16), 50*time.Millisecond, nil)
+	if got := b.current(); got != 32 {
+		t.Errorf("after a fast request size = %d, want 32", got)
+	}
+	b.observe(batch(32), 100*time.Millisecond, nil)
+	if got := b.current(); got != 40 {
+		t.Errorf("token budget size = %d, want 40", got)
+	}
+
+	// Slow responses shrink it toward the latency target, at most by half.
+	for n := 0; n < 10; n++ {
+		b.observe(batch(b.current()), time.Duration(b.current())*100*time.Millisecond, nil)
+	}
+	if got := b.current(); got < 9 || got > 11 {
+		t.Errorf("latency target size = %d, want about 10", got)
+	}
+
+	size := b.current()
+	b.observe(batch(size), time.Second, context.Canceled)
+	if b.current() != size {
+		t.Error("a cancelled request changed the size")
+	}
+	b.observe(batch(size), time.Second, errors.New("413 payload too large"))
+	if got := b.current(); got != size/2 {
+		t.Errorf("after a failure size = %d, want %d", got, size/2)
+	}
+	for n := 0; n < 5; n++ {
+		b.observe(batch(1), time.Second, errors.New("timeout"))
+	}
+	if got := b.current(); got != 2 {
+		t.Errorf("size = %d, want the minimum 2", got)
+	}
+}
+
+func TestEmbeddingClientAdaptiveBatchSize(t *testing.T) {
+	cfg := config.DefaultConfig().RAG.Embedding
+	cfg.APIBase = "http://localhost:1"
+	cfg.Model = "m"
+	cfg.BatchSize = 8
+	client, err := NewEmbeddingClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.batcher != nil || client.BatchSize() != 8 {
+		t.Errorf("fixed batch size = %d", client.BatchSize())
+	}
+	cfg.AdaptiveBatch = true
+	client, _ = NewEmbeddingClient(cfg)
+	if client.batcher == nil || client.BatchSize() != 8 {
+		t.Fatalf("adaptive client starts at %d, want batch_size", client.BatchSize())
+	}
+	client.batcher.observe([]string{"a"}, time.Second, errors.New("boom"))
+	if client.BatchSize() != 4 {
+		t.Errorf("BatchSize() = %d after a failure, want 4", client.BatchSize())
+	}
+}
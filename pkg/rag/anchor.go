@@ -0,0 +1,45 @@
+package rag
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// headingSlug turns a heading into the anchor GitHub and most markdown
+// renderers give it: lowercased, punctuation dropped and spaces replaced by
+// hyphens, so "Setup & Install" becomes "setup--install".
+func headingSlug(heading string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ':
+			sb.WriteByte('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// anchorSet hands out the anchors of a note's headings in order. A repeated
+// slug gets "-1", "-2", ... appended, as GitHub does.
+type anchorSet map[string]int
+
+func newAnchorSet() anchorSet {
+	return make(anchorSet)
+}
+
+func (a anchorSet) add(heading string) string {
+	slug := headingSlug(heading)
+	anchor := slug
+	for {
+		if _, taken := a[anchor]; !taken {
+			break
+		}
+		a[slug]++
+		anchor = slug + "-" + strconv.Itoa(a[slug])
+	}
+	a[anchor] = 0
+	return anchor
+}
@@ -0,0 +1,41 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHeadingSlug(t *testing.T) {
+	for heading, want := range map[string]string{
+		"Setup & Install":       "setup--install",
+		"  What's new in v2.1?": "whats-new-in-v21",
+		"snake_case-and-dash":   "snake_case-and-dash",
+		"Überblick Straße":      "überblick-straße",
+		"部署 指南":                 "部署-指南",
+		"`code` **bold**":       "code-bold",
+	} {
+		if got := headingSlug(heading); got != want {
+			t.Errorf("headingSlug(%q) = %q, want %q", heading, got, want)
+		}
+	}
+}
+
+func TestChunkAnchors(t *testing.T) {
+	content := "intro\n# Notes\na\n## Todo\nb\n# Log\nc\n## Todo\nd\n## Todo 1\ne\n## Todo\nf"
+	var got []string
+	for _, ch := range newChunker(1, 0).chunk("n.md", content) {
+		got = append(got, ch.Anchor)
+	}
+	want := []string{"", "notes", "notes", "todo", "todo", "log", "log", "todo-1", "todo-1", "todo-1-1", "todo-1-1", "todo-2", "todo-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("anchors = %q, want %q", got, want)
+	}
+
+	old := scoredPointsToResults([]qdrantScoredPoint{{Payload: map[string]interface{}{
+		"path":         "n.md",
+		"heading_path": []interface{}{"Log", "Todo"},
+	}}})
+	if old[0].Anchor != "todo" {
+		t.Errorf("anchor of a point without one = %q", old[0].Anchor)
+	}
+}
@@ -0,0 +1,231 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// anonymizeMapFile keeps the placeholders of rag.anonymize and what they
+// stand for. It never leaves the data directory.
+const anonymizeMapFile = "anonymize_map.json"
+
+// Detectors of rag.anonymize.detect.
+const (
+	DetectEmail     = "email"
+	DetectPhone     = "phone"
+	DetectID        = "id"
+	DetectTitleName = "title_name"
+	DetectMention   = "mention"
+)
+
+// anonymizeDetectors are the built-in detectors, in the order they run, with
+// the placeholder kind they produce. The ones that match a fixed shape run
+// before rag.anonymize.names, so a name inside an email address goes with
+// the address, and emails go before mentions so the host of an address is
+// not read as a handle.
+var anonymizeDetectors = []struct {
+	name   string
+	shaped bool
+	rule   anonymizeRule
+}{
+	{DetectEmail, true, anonymizeRule{kind: "EMAIL", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)}},
+	// International numbers, national ones with a leading 0 and the North
+	// American formats; fewer than 7 digits are rather dates or times.
+	{DetectPhone, true, anonymizeRule{kind: "PHONE", re: regexp.MustCompile(`(?:\+\d{1,3}|\(?\b0\d{1,4}\)?)(?:[ ./-]?\d{2,}){2,}|\(\d{3}\) ?\d{3}-\d{4}|\b\d{3}[.-]\d{3}[.-]\d{4}\b`), minDigits: 7}},
+	{DetectID, true, anonymizeRule{kind: "ID", re: regexp.MustCompile(`\b(?:[A-Z]{1,4}\d{6,}|\d{7,}|\d{3}-\d{2}-\d{4})\b`)}},
+	{DetectTitleName, false, anonymizeRule{kind: "PERSON", re: regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.? [A-Z][\p{L}'-]+(?: [A-Z][\p{L}'-]+)?`)}},
+	{DetectMention, false, anonymizeRule{kind: "HANDLE", re: regexp.MustCompile(`(?:^|\s)@[A-Za-z0-9_]{2,}`)}},
+}
+
+type anonymizeRule struct {
+	kind string
+	re   *regexp.Regexp
+	// minDigits skips matches with fewer digits.
+	minDigits int
+}
+
+// anonymizer replaces personal names and IDs with placeholders such as
+// "[PERSON_1]" before text is sent to a remote embedding API. The same value
+// always gets the same placeholder, in notes and in queries alike, so
+// retrieval still matches them; the mapping is saved in the data directory.
+type anonymizer struct {
+	rules   []anonymizeRule
+	storage func() Storage
+
+	mu      sync.Mutex
+	loaded  bool
+	byValue map[string]string // kind + ":" + normalized value -> placeholder
+	values  map[string]string // placeholder -> original text
+	next    map[string]int
+}
+
+// newAnonymizer returns nil when rag.anonymize is off.
+func newAnonymizer(cfg config.RagAnonymizeConfig) (*anonymizer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	a := &anonymizer{}
+	kinds := make([]string, 0, len(cfg.Patterns))
+	for kind := range cfg.Patterns {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		re, err := regexp.Compile(cfg.Patterns[kind])
+		if err != nil {
+			return nil, fmt.Errorf("rag.anonymize.patterns[%s]: %w", kind, err)
+		}
+		a.rules = append(a.rules, anonymizeRule{kind: strings.ToUpper(kind), re: re})
+	}
+	var names []string
+	for _, name := range cfg.Names {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	// Longer names first, so "Anna Schmidt" is not cut to "Anna".
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	addNames := func() {
+		if len(names) > 0 {
+			a.rules = append(a.rules, anonymizeRule{kind: "PERSON", re: regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)\b`)})
+			names = nil
+		}
+	}
+	detect := make(map[string]bool, len(cfg.Detect))
+	for _, d := range cfg.Detect {
+		detect[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+	for _, d := range anonymizeDetectors {
+		if !d.shaped {
+			addNames()
+		}
+		if detect[d.name] {
+			a.rules = append(a.rules, d.rule)
+			delete(detect, d.name)
+		}
+	}
+	addNames()
+	for d := range detect {
+		return nil, fmt.Errorf("rag.anonymize.detect: unknown detector %q", d)
+	}
+	return a, nil
+}
+
+// apply returns inputs with every detected value replaced by its
+// placeholder, saving the mapping when new placeholders were handed out.
+func (a *anonymizer) apply(inputs []string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	added := false
+	out := make([]string, len(inputs))
+	for i, text := range inputs {
+		for _, rule := range a.rules {
+			text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+				// Mentions match with the space before them.
+				lead := match[:len(match)-len(strings.TrimLeft(match, " \t\r\n"))]
+				value := match[len(lead):]
+				if rule.minDigits > 0 && countDigits(value) < rule.minDigits {
+					return match
+				}
+				key := rule.kind + ":" + normalizeAnonymized(rule.kind, value)
+				placeholder, ok := a.byValue[key]
+				if !ok {
+					a.next[rule.kind]++
+					placeholder = "[" + rule.kind + "_" + strconv.Itoa(a.next[rule.kind]) + "]"
+					a.byValue[key] = placeholder
+					a.values[placeholder] = value
+					added = true
+				}
+				return lead + placeholder
+			})
+		}
+		out[i] = text
+	}
+	if added {
+		if err := a.save(); err != nil {
+			return nil, fmt.Errorf("saving the anonymization map: %w", err)
+		}
+	}
+	return out, nil
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// normalizeAnonymized makes spellings of one value share a placeholder:
+// names and addresses ignore case, phone numbers their punctuation.
+func normalizeAnonymized(kind, value string) string {
+	if kind == "PHONE" {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' || r == '+' {
+				return r
+			}
+			return -1
+		}, value)
+	}
+	return strings.ToLower(value)
+}
+
+func (a *anonymizer) load() error {
+	if a.loaded {
+		return nil
+	}
+	a.byValue = make(map[string]string)
+	a.values = make(map[string]string)
+	a.next = make(map[string]int)
+	data, err := a.storage().ReadFile(anonymizeMapFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &a.values); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", anonymizeMapFile, err)
+		}
+	}
+	for placeholder, value := range a.values {
+		// Custom kinds may contain "_"; the number follows the last one.
+		name := strings.Trim(placeholder, "[]")
+		idx := strings.LastIndex(name, "_")
+		if idx < 0 {
+			continue
+		}
+		kind := name[:idx]
+		num, err := strconv.Atoi(name[idx+1:])
+		if err != nil {
+			continue
+		}
+		a.byValue[kind+":"+normalizeAnonymized(kind, value)] = placeholder
+		if num > a.next[kind] {
+			a.next[kind] = num
+		}
+	}
+	a.loaded = true
+	return nil
+}
+
+func (a *anonymizer) save() error {
+	data, err := json.MarshalIndent(a.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(a.storage(), anonymizeMapFile, data)
+}
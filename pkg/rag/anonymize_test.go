@@ -0,0 +1,150 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAnonymizer(t *testing.T) {
+	st := NewMemoryStorage()
+	cfg := config.RagAnonymizeConfig{
+		Enabled:  true,
+		Detect:   config.FlexibleStringSlice{DetectEmail, DetectPhone, DetectID, DetectTitleName, DetectMention},
+		Names:    config.FlexibleStringSlice{"Anna", "Anna Schmidt"},
+		Patterns: map[string]string{"case": `CASE-\d+`},
+	}
+	a, err := newAnonymizer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.storage = func() Storage { return st }
+
+	got, err := a.apply([]string{
+		"Anna Schmidt (anna@example.com, +49 151 2345 6789) asked about CASE-42.",
+		"Call +49 151 23456789 or ping @anna_s; Dr. Weber has ID 12345678. Met on 2024-05-01.",
+		"anna schmidt and Anna",
+	})
+	if err != nil {
+		t.Fatalf("apply() error: %v", err)
+	}
+	want := []string{
+		"[PERSON_1] ([EMAIL_1], [PHONE_1]) asked about [CASE_1].",
+		"Call [PHONE_1] or ping [HANDLE_1]; [PERSON_2] has ID [ID_1]. Met on 2024-05-01.",
+		"[PERSON_1] and [PERSON_3]",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("apply()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// A new anonymizer over the same storage hands out the same placeholders
+	// and continues the numbering.
+	again, _ := newAnonymizer(cfg)
+	again.storage = func() Storage { return st }
+	got, err = again.apply([]string{"Anna Schmidt met Dr. Brandt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != "[PERSON_1] met [PERSON_4]" {
+		t.Errorf("after reload apply() = %q", got[0])
+	}
+
+	if _, err := newAnonymizer(config.RagAnonymizeConfig{Enabled: true, Detect: config.FlexibleStringSlice{"ssn"}}); err == nil {
+		t.Error("newAnonymizer() accepted an unknown detector")
+	}
+	if a, err := newAnonymizer(config.RagAnonymizeConfig{}); a != nil || err != nil {
+		t.Errorf("newAnonymizer() when disabled = %v, %v", a, err)
+	}
+}
+
+func TestEmbeddingClientAnonymizes(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req.Input...)
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.Embedding.APIBase = "https://api.example.com/v1"
+	cfg.RAG.Embedding.Model = "text-embedding-3-small"
+	cfg.RAG.Anonymize.Enabled = true
+	s, err := NewService(cfg, t.TempDir(), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s.embedder.(*EmbeddingClient)
+	if client.anonymizer == nil || client.Model() != "text-embedding-3-small+anonymized" {
+		t.Fatalf("remote embedding client not anonymizing, model %q", client.Model())
+	}
+	client.apiBase = server.URL
+	if _, err := client.EmbedBatch(context.Background(), []string{"Mail bob@example.com"}); err != nil {
+		t.Fatalf("EmbedBatch() error: %v", err)
+	}
+	if len(sent) != 1 || sent[0] != "Mail [EMAIL_1]" {
+		t.Errorf("sent %q", sent)
+	}
+	if data, err := s.storage.ReadFile(anonymizeMapFile); err != nil || !strings.Contains(string(data), "bob@example.com") {
+		t.Errorf("mapping not saved locally: %s, %v", data, err)
+	}
+
+	cfg.RAG.Embedding.APIBase = "http://localhost:11434/v1"
+	s, err = NewService(cfg, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.embedder.(*EmbeddingClient).anonymizer != nil {
+		t.Error("local embedding client anonymizes")
+	}
+
+	// An ensemble collection with its own remote model is anonymized too.
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory", Embedding: config.RagEmbeddingConfig{APIBase: "https://api.example.com/v1"}}}
+	s, err = NewService(cfg, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ensemble[0].embedder.(*EmbeddingClient).anonymizer == nil {
+		t.Error("remote ensemble embedding client not anonymizing")
+	}
+}
+
+func TestAnonymizerMapFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permission bits are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	// A map written before is tightened on the next save.
+	os.WriteFile(filepath.Join(dir, anonymizeMapFile), []byte("{}"), 0o644)
+	a, err := newAnonymizer(config.RagAnonymizeConfig{Enabled: true, Detect: config.FlexibleStringSlice{DetectEmail}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewLocalStorage(dir)
+	a.storage = func() Storage { return st }
+	if _, err := a.apply([]string{"Mail bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, anonymizeMapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("%s has permission %04o, want 0600", anonymizeMapFile, perm)
+	}
+}
@@ -0,0 +1,95 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Answer is a chat answer drawn from the knowledge base.
+type Answer struct {
+	Question string
+	// Answer is the model's reply; a Sources section in it is replaced by
+	// links to Sources, numbered like the [n] citations.
+	Answer  string
+	Sources []SearchResult
+	Time    time.Time
+}
+
+// AnswersNote returns the vault path of the note answers are saved to.
+func (s *Service) AnswersNote() string {
+	if s.cfg.Answers.Note == "" {
+		return "AI answers.md"
+	}
+	return s.cfg.Answers.Note
+}
+
+// SaveAnswer appends a to the answers note, creating it if needed, and
+// indexes the note so later searches find the answer. It returns the note's
+// path in the vault.
+func (s *Service) SaveAnswer(ctx context.Context, a Answer) (string, error) {
+	if !s.cfg.Answers.Enabled {
+		return "", fmt.Errorf("saving answers is disabled (rag.answers.enabled)")
+	}
+	if a.Time.IsZero() {
+		a.Time = s.now()
+	}
+	rel := s.AnswersNote()
+	abs, err := s.vaultNotePath(rel, "rag.answers.note")
+	if err != nil {
+		return "", err
+	}
+
+	s.answersMu.Lock()
+	data, err := os.ReadFile(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		title := strings.TrimSuffix(path.Base(rel), ".md")
+		data, err = []byte("# "+title+"\n"), nil
+	}
+	if err == nil {
+		data = append(data, answerMarkdown(a)...)
+		err = writeFileAtomic(abs, data)
+	}
+	s.answersMu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to save answer: %w", err)
+	}
+
+	s.indexWrittenNote(ctx, rel)
+	return rel, nil
+}
+
+// answerMarkdown renders an answer as a section headed by its question, so
+// each saved answer is a chunk of its own that a search for the question
+// finds.
+func answerMarkdown(a Answer) string {
+	body, _ := splitSourcesSection(a.Answer)
+	var sb strings.Builder
+	sb.WriteString("\n## " + strings.Join(strings.Fields(a.Question), " ") + "\n\n")
+	sb.WriteString("*Answered " + a.Time.Format("2006-01-02 15:04") + "*\n\n")
+	sb.WriteString(strings.TrimSpace(body) + "\n")
+	if len(a.Sources) > 0 {
+		sb.WriteString("\nSources:\n")
+		for idx, r := range a.Sources {
+			sb.WriteString(fmt.Sprintf("- [%d] %s\n", idx+1, answerSourceLink(r)))
+		}
+	}
+	return sb.String()
+}
+
+// answerSourceLink renders a source as a wikilink to the heading its chunk is
+// under, or a summary as links to the notes it covers.
+func answerSourceLink(r SearchResult) string {
+	if r.SummaryLevel > 0 {
+		return digestLinks(r.SummaryOf)
+	}
+	target := strings.TrimSuffix(r.Path, ".md")
+	if n := len(r.HeadingPath); n > 0 {
+		target += "#" + r.HeadingPath[n-1]
+	}
+	return "[[" + target + "]]"
+}
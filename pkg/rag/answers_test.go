@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAnswerAppendsToNote(t *testing.T) {
+	vault := t.TempDir()
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	if _, err := s.SaveAnswer(t.Context(), Answer{Question: "q"}); err == nil {
+		t.Error("SaveAnswer() succeeded with rag.answers disabled")
+	}
+
+	s.cfg.Answers.Enabled = true
+	s.cfg.Answers.Note = "Inbox/AI answers.md"
+	answer := Answer{
+		Question: "How do we\nrotate keys?",
+		Answer:   "Monthly, by the on-call [1].\n\nSources:\n1. wrong.md",
+		Sources: []SearchResult{
+			{Path: "ops/keys.md", HeadingPath: []string{"Security", "Rotation"}},
+			{Path: "ops/oncall.md"},
+		},
+		Time: time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC),
+	}
+	for range 2 {
+		rel, err := s.SaveAnswer(t.Context(), answer)
+		if err != nil || rel != "Inbox/AI answers.md" {
+			t.Fatalf("SaveAnswer() = %q, %v", rel, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(vault, "Inbox", "AI answers.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := "\n## How do we rotate keys?\n\n*Answered 2026-03-02 09:30*\n\nMonthly, by the on-call [1].\n\n" +
+		"Sources:\n- [1] [[ops/keys#Rotation]]\n- [2] [[ops/oncall]]\n"
+	if want := "# AI answers\n" + entry + entry; string(data) != want {
+		t.Errorf("note = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,207 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// auditLogFile records the note content sent to LLMs under rag.audit_log,
+// one JSON object per line.
+const auditLogFile = "context_audit.jsonl"
+
+// AuditEntry is one prompt that carried note content.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Conversation is the session key of a chat, or "rag:summaries" and
+	// "rag:digest" for the prompts of summary levels and digests.
+	Conversation string `json:"conversation"`
+	Model        string `json:"model,omitempty"`
+	// Sources are the notes the content was taken from, when known.
+	Sources []AuditSource `json:"sources,omitempty"`
+	// Content is the text added to the prompt, exactly as sent.
+	Content string `json:"content"`
+}
+
+// AuditSource is a note chunk included in an audited prompt.
+type AuditSource struct {
+	Path    string  `json:"path"`
+	Heading string  `json:"heading,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+// AuditContext records that text, the context built from results, is sent
+// to model in conversation, when rag.audit_log is on. Failures are logged
+// and otherwise ignored.
+func (s *Service) AuditContext(conversation, model, text string, results []SearchResult) {
+	if !s.cfg.AuditLog.Enabled || text == "" {
+		return
+	}
+	entry := AuditEntry{Time: s.now(), Conversation: conversation, Model: model, Content: text}
+	for _, r := range results {
+		entry.Sources = append(entry.Sources, AuditSource{Path: r.Path, Heading: r.Heading, Score: r.Score})
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = s.appendAuditLog(append(data, '\n'))
+	}
+	if err != nil {
+		s.log.Warn("Failed to write the audit log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// auditSummarizer records every prompt of summarize in the audit log under
+// conversation, for the model given to SetTargetModel.
+func (s *Service) auditSummarizer(conversation string, summarize Summarizer) Summarizer {
+	if !s.cfg.AuditLog.Enabled || summarize == nil {
+		return summarize
+	}
+	return func(ctx context.Context, prompt string) (string, error) {
+		s.AuditContext(conversation, s.contextFormat().model, prompt, nil)
+		return summarize(ctx, prompt)
+	}
+}
+
+func (s *Service) appendAuditLog(line []byte) error {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	maxBytes := int64(s.cfg.AuditLog.MaxSizeMB) << 20
+	if maxBytes <= 0 {
+		maxBytes = 10 << 20
+	}
+	if info, err := s.storage.Stat(auditLogFile); err == nil && info.Size()+int64(len(line)) > maxBytes {
+		keep := s.cfg.AuditLog.MaxFiles
+		if keep <= 0 {
+			keep = 5
+		}
+		if err := rotateLog(s.storage, auditLogFile, keep); err != nil {
+			return err
+		}
+	}
+	return s.storage.AppendFile(auditLogFile, line)
+}
+
+// rotateLog moves name to name.1, name.1 to name.2 and so on, dropping the
+// file that would become name.<keep+1>.
+func rotateLog(st Storage, name string, keep int) error {
+	if err := st.RemoveAll(fmt.Sprintf("%s.%d", name, keep)); err != nil {
+		return err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		from := fmt.Sprintf("%s.%d", name, n)
+		if _, err := st.Stat(from); err != nil {
+			continue
+		}
+		if err := st.Rename(from, fmt.Sprintf("%s.%d", name, n+1)); err != nil {
+			return err
+		}
+	}
+	return st.Rename(name, name+".1")
+}
+
+// auditLogNames lists the audit log and its rotated files, oldest first.
+func auditLogNames(st Storage) []string {
+	names := []string{auditLogFile}
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s.%d", auditLogFile, n)
+		if _, err := st.Stat(name); err != nil {
+			return names
+		}
+		names = append([]string{name}, names...)
+	}
+}
+
+// ReadAuditLog returns the entries of the audit log in dataDir logged since
+// the given time, oldest first, including those in the rotated files.
+func ReadAuditLog(dataDir string, since time.Time) ([]AuditEntry, error) {
+	return readAuditLog(NewLocalStorage(dataDir), since)
+}
+
+func readAuditLog(st Storage, since time.Time) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := scanAuditLog(st, func(e AuditEntry, _ []byte) {
+		if !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	})
+	return entries, err
+}
+
+// scanAuditLog calls fn with every entry of the audit log and its line,
+// oldest first. Lines that do not parse are skipped.
+func scanAuditLog(st Storage, fn func(AuditEntry, []byte)) error {
+	for _, name := range auditLogNames(st) {
+		data, err := st.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil {
+				continue
+			}
+			fn(e, scanner.Bytes())
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeAuditLog drops the entries of the audit log in dataDir logged before
+// cutoff, or all of them when cutoff is zero, merging what is left of the
+// rotated files into the current one. It returns the number of entries
+// dropped and the bytes freed.
+func PurgeAuditLog(dataDir string, cutoff time.Time) (int, int64, error) {
+	return purgeAuditLog(NewLocalStorage(dataDir), cutoff)
+}
+
+func purgeAuditLog(st Storage, cutoff time.Time) (int, int64, error) {
+	names := auditLogNames(st)
+	var before int64
+	for _, name := range names {
+		if info, err := st.Stat(name); err == nil {
+			before += info.Size()
+		}
+	}
+	var kept bytes.Buffer
+	dropped := 0
+	err := scanAuditLog(st, func(e AuditEntry, line []byte) {
+		if cutoff.IsZero() || e.Time.Before(cutoff) {
+			dropped++
+			return
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if dropped == 0 {
+		return 0, 0, nil
+	}
+	for _, name := range names {
+		if err := st.RemoveAll(name); err != nil {
+			return 0, 0, err
+		}
+	}
+	if kept.Len() > 0 {
+		if err := st.WriteFile(auditLogFile, kept.Bytes()); err != nil {
+			return 0, 0, err
+		}
+	}
+	return dropped, before - int64(kept.Len()), nil
+}
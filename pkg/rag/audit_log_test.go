@@ -0,0 +1,89 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	st := NewMemoryStorage()
+	s.SetStorage(st)
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return clock }
+
+	s.AuditContext("cli:default", "gpt-4o", "ignored", nil)
+	if _, err := st.Stat(auditLogFile); err == nil {
+		t.Fatal("audit log written while rag.audit_log is off")
+	}
+
+	s.cfg.AuditLog.Enabled = true
+	results := []SearchResult{{Path: "a.md", Heading: "Intro", Score: 0.8}}
+	s.AuditContext("cli:default", "gpt-4o", "context one", results)
+	clock = clock.Add(48 * time.Hour)
+	s.SetTargetModel("gpt-4o-mini")
+	summarize := s.auditSummarizer("rag:digest", func(ctx context.Context, prompt string) (string, error) {
+		return "ok", nil
+	})
+	if _, err := summarize(context.Background(), "summary prompt"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readAuditLog(st, time.Time{})
+	if err != nil {
+		t.Fatalf("readAuditLog() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	first := entries[0]
+	if first.Conversation != "cli:default" || first.Model != "gpt-4o" || first.Content != "context one" ||
+		len(first.Sources) != 1 || first.Sources[0].Path != "a.md" || first.Sources[0].Heading != "Intro" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if second := entries[1]; second.Conversation != "rag:digest" || second.Model != "gpt-4o-mini" || second.Content != "summary prompt" {
+		t.Errorf("second entry = %+v", second)
+	}
+	if recent, _ := readAuditLog(st, clock.Add(-time.Hour)); len(recent) != 1 {
+		t.Errorf("entries since an hour ago = %d, want 1", len(recent))
+	}
+
+	dropped, freed, err := purgeAuditLog(st, clock.Add(-time.Hour))
+	if err != nil || dropped != 1 || freed <= 0 {
+		t.Errorf("purgeAuditLog(cutoff) = %d, %d, %v", dropped, freed, err)
+	}
+	if left, _ := readAuditLog(st, time.Time{}); len(left) != 1 || left[0].Conversation != "rag:digest" {
+		t.Errorf("entries after purge = %+v", left)
+	}
+	if dropped, _, err := purgeAuditLog(st, time.Time{}); err != nil || dropped != 1 {
+		t.Errorf("purgeAuditLog(zero) = %d, %v", dropped, err)
+	}
+	if _, err := st.Stat(auditLogFile); err == nil {
+		t.Error("audit log kept after purging everything")
+	}
+}
+
+func TestRotateLog(t *testing.T) {
+	st := NewMemoryStorage()
+	for n := 0; n < 4; n++ {
+		if err := st.WriteFile(auditLogFile, []byte(fmt.Sprintf("%d\n", n))); err != nil {
+			t.Fatal(err)
+		}
+		if err := rotateLog(st, auditLogFile, 2); err != nil {
+			t.Fatalf("rotateLog() error: %v", err)
+		}
+	}
+	for name, want := range map[string]string{auditLogFile + ".1": "3\n", auditLogFile + ".2": "2\n"} {
+		if data, err := st.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := st.Stat(auditLogFile + ".3"); err == nil {
+		t.Error("rotateLog() kept more files than asked")
+	}
+	if names := auditLogNames(st); len(names) != 3 || names[0] != auditLogFile+".2" {
+		t.Errorf("auditLogNames() = %v", names)
+	}
+}
@@ -0,0 +1,302 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// BenchOptions controls RunBench. Zero fields use the defaults.
+type BenchOptions struct {
+	// Samples is the number of texts embedded per measurement.
+	Samples     int
+	BatchSizes  []int
+	Concurrency []int
+	// Searches is the number of search requests timed against the store.
+	Searches int
+}
+
+// BenchEmbeddingResult is one embedding measurement.
+type BenchEmbeddingResult struct {
+	BatchSize   int
+	Concurrency int
+	Requests    int
+	// Latency is the mean time per embedding request.
+	Latency        time.Duration
+	TextsPerSecond float64
+	Error          string
+}
+
+// BenchStoreResult times the vector store with vectors of the embedding
+// model's dimension in a scratch collection.
+type BenchStoreResult struct {
+	Dimension int
+	Points    int
+	// UpsertLatency is the mean time per upsert request.
+	UpsertLatency time.Duration
+	SearchP50     time.Duration
+	SearchP95     time.Duration
+	Error         string
+}
+
+type BenchReport struct {
+	Samples                int
+	Embedding              []BenchEmbeddingResult
+	Store                  BenchStoreResult
+	RecommendedBatchSize   int
+	RecommendedConcurrency int
+}
+
+// benchTolerance is how close to the best throughput a setting must come to
+// be preferred for being smaller.
+const benchTolerance = 0.9
+
+// RunBench measures embedding throughput across batch sizes and concurrency
+// levels, then upsert and search latency in a scratch collection that is
+// deleted afterwards. progress, if set, receives a line per step.
+func RunBench(ctx context.Context, cfg config.RagConfig, opts BenchOptions, progress func(string)) (*BenchReport, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = 64
+	}
+	if len(opts.BatchSizes) == 0 {
+		opts.BatchSizes = []int{1, 4, 8, 16, 32, 64}
+	}
+	if len(opts.Concurrency) == 0 {
+		opts.Concurrency = []int{1, 2, 4, 8}
+	}
+	if opts.Searches <= 0 {
+		opts.Searches = 20
+	}
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	embedder, err := newEmbeddingClient(cfg.Embedding, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	texts := benchTexts(cfg, opts.Samples)
+	report := &BenchReport{Samples: len(texts)}
+
+	var vectors [][]float64
+	var byBatch []BenchEmbeddingResult
+	for _, size := range opts.BatchSizes {
+		if size > len(texts) {
+			break
+		}
+		progress(fmt.Sprintf("embedding: batch size %d", size))
+		result, embedded := benchEmbed(ctx, embedder, texts, size, 1)
+		report.Embedding = append(report.Embedding, result)
+		if result.Error != "" {
+			break
+		}
+		byBatch = append(byBatch, result)
+		if vectors == nil {
+			vectors = embedded
+		}
+	}
+	if len(byBatch) == 0 {
+		return report, fmt.Errorf("embedding failed: %s", report.Embedding[len(report.Embedding)-1].Error)
+	}
+	best := pickBenchResult(byBatch)
+	report.RecommendedBatchSize = best.BatchSize
+
+	byConcurrency := []BenchEmbeddingResult{best}
+	for _, n := range opts.Concurrency {
+		if n <= 1 {
+			continue
+		}
+		progress(fmt.Sprintf("embedding: batch size %d, concurrency %d", best.BatchSize, n))
+		result, _ := benchEmbed(ctx, embedder, texts, best.BatchSize, n)
+		report.Embedding = append(report.Embedding, result)
+		if result.Error != "" {
+			break
+		}
+		prev := byConcurrency[len(byConcurrency)-1]
+		byConcurrency = append(byConcurrency, result)
+		// Stop once more parallelism no longer pays off.
+		if result.TextsPerSecond*benchTolerance < prev.TextsPerSecond {
+			break
+		}
+	}
+	report.RecommendedConcurrency = pickBenchResult(byConcurrency).Concurrency
+
+	progress("vector store: upsert and search")
+	report.Store = benchStore(ctx, cfg.VectorDB, cfg.HTTP, vectors, report.RecommendedBatchSize, opts.Searches)
+	return report, nil
+}
+
+// pickBenchResult returns the smallest setting whose throughput is within
+// benchTolerance of the best; results must be in increasing setting order.
+func pickBenchResult(results []BenchEmbeddingResult) BenchEmbeddingResult {
+	var top float64
+	for _, r := range results {
+		if r.TextsPerSecond > top {
+			top = r.TextsPerSecond
+		}
+	}
+	for _, r := range results {
+		if r.TextsPerSecond >= top*benchTolerance {
+			return r
+		}
+	}
+	return results[len(results)-1]
+}
+
+// benchTexts returns n chunks from the vault, padded with synthetic text of
+// chunk_size characters when the vault is missing or small.
+func benchTexts(cfg config.RagConfig, n int) []string {
+	var texts []string
+	if v, err := newVault(cfg.VaultPath); err == nil && v.check() == nil {
+		v.formats = noteFormatsOf(cfg)
+		files, _ := v.list(cfg.IncludePatterns, cfg.ExcludePatterns)
+		c := newChunker(cfg.ChunkSize, cfg.ChunkOverlap)
+		for _, f := range files {
+			if len(texts) >= n {
+				break
+			}
+			content, err := readNote(ioPath(f.AbsPath), nil)
+			if err != nil {
+				continue
+			}
+			for _, ch := range c.chunk(f.RelPath, string(content)) {
+				texts = append(texts, ch.Content)
+			}
+		}
+	}
+	size := cfg.ChunkSize
+	if size <= 0 {
+		size = 800
+	}
+	filler := "The quick brown fox jumps over the lazy dog. "
+	for len(texts) < n {
+		text := strings.Repeat(filler, size/len(filler)+1)
+		texts = append(texts, fmt.Sprintf("%d %s", len(texts), text[:size]))
+	}
+	return texts[:n]
+}
+
+// benchEmbed embeds texts in batches of size with up to concurrency requests
+// in flight, and returns the vectors aligned with texts.
+func benchEmbed(ctx context.Context, embedder Embedder, texts []string, size, concurrency int) (BenchEmbeddingResult, [][]float64) {
+	result := BenchEmbeddingResult{BatchSize: size, Concurrency: concurrency}
+	type job struct{ start, end int }
+	jobs := make(chan job)
+	vectors := make([][]float64, len(texts))
+	var (
+		mu       sync.Mutex
+		total    time.Duration
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	started := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				reqStart := time.Now()
+				embeddings, err := embedder.EmbedBatch(ctx, texts[j.start:j.end])
+				elapsed := time.Since(reqStart)
+				mu.Lock()
+				result.Requests++
+				total += elapsed
+				if err == nil && len(embeddings) != j.end-j.start {
+					err = fmt.Errorf("embedding result size mismatch")
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					copy(vectors[j.start:j.end], embeddings)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		jobs <- job{start, end}
+	}
+	close(jobs)
+	wg.Wait()
+	wall := time.Since(started)
+
+	if firstErr != nil {
+		result.Error = firstErr.Error()
+		return result, nil
+	}
+	result.Latency = total / time.Duration(result.Requests)
+	result.TextsPerSecond = float64(len(texts)) / wall.Seconds()
+	return result, vectors
+}
+
+// benchStore times upserts and searches in "<collection>_bench", which is
+// dropped afterwards.
+func benchStore(ctx context.Context, cfg config.RagVectorDBConfig, tuning config.RagHTTPConfig, vectors [][]float64, batchSize, searches int) BenchStoreResult {
+	var result BenchStoreResult
+	if len(vectors) == 0 {
+		result.Error = "no vectors to write"
+		return result
+	}
+	result.Dimension = len(vectors[0])
+	cfg.Collection += "_bench"
+	store, err := newQdrantClient(cfg, tuning)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := store.EnsureCollection(ctx, result.Dimension, true); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer store.deleteCollection(context.Background())
+
+	var upsertTotal time.Duration
+	upserts := 0
+	for start := 0; start < len(vectors); start += batchSize {
+		end := start + batchSize
+		if end > len(vectors) {
+			end = len(vectors)
+		}
+		points := make([]QdrantPoint, 0, end-start)
+		for idx := start; idx < end; idx++ {
+			points = append(points, QdrantPoint{
+				ID:      hashPointID("bench", idx, idx),
+				Vector:  vectors[idx],
+				Payload: map[string]interface{}{"path": "bench"},
+			})
+		}
+		reqStart := time.Now()
+		if err := store.Upsert(ctx, points); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		upsertTotal += time.Since(reqStart)
+		upserts++
+		result.Points += len(points)
+	}
+	result.UpsertLatency = upsertTotal / time.Duration(upserts)
+
+	latencies := make([]time.Duration, 0, searches)
+	for n := 0; n < searches; n++ {
+		reqStart := time.Now()
+		if _, err := store.Search(ctx, StoreQuery{Vector: vectors[n%len(vectors)], Limit: 5}); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		latencies = append(latencies, time.Since(reqStart))
+	}
+	sort.Slice(latencies, func(a, b int) bool { return latencies[a] < latencies[b] })
+	result.SearchP50 = latencies[len(latencies)/2]
+	result.SearchP95 = latencies[(len(latencies)*95)/100]
+	return result
+}
@@ -0,0 +1,32 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPickBenchResult(t *testing.T) {
+	results := []BenchEmbeddingResult{
+		{BatchSize: 1, TextsPerSecond: 10},
+		{BatchSize: 8, TextsPerSecond: 95},
+		{BatchSize: 16, TextsPerSecond: 100},
+		{BatchSize: 32, TextsPerSecond: 60},
+	}
+	if got := pickBenchResult(results); got.BatchSize != 8 {
+		t.Errorf("pickBenchResult() batch size = %d, want 8 (within 10%% of the best)", got.BatchSize)
+	}
+}
+
+func TestBenchTextsPadsToChunkSize(t *testing.T) {
+	cfg := config.RagConfig{VaultPath: config.VaultPaths{t.TempDir() + "/missing"}, ChunkSize: 200}
+	texts := benchTexts(cfg, 3)
+	if len(texts) != 3 {
+		t.Fatalf("benchTexts() returned %d texts, want 3", len(texts))
+	}
+	for _, text := range texts {
+		if len(text) < cfg.ChunkSize {
+			t.Errorf("synthetic text has %d chars, want at least %d", len(text), cfg.ChunkSize)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// boilerplate blanks out template text before chunking. Removed text is
+// replaced by as many newlines as it spanned so chunk line numbers still
+// point at the right place in the note.
+type boilerplate struct {
+	literals []string
+	patterns []*regexp.Regexp
+	// lines holds auto-detected boilerplate lines, compared after trimming.
+	lines map[string]bool
+}
+
+func newBoilerplate(cfg config.RagBoilerplateConfig, detected []string) (*boilerplate, error) {
+	b := &boilerplate{lines: make(map[string]bool, len(detected))}
+	for _, lit := range cfg.Literals {
+		if lit != "" {
+			b.literals = append(b.literals, normalizeText(lit))
+		}
+	}
+	for _, pattern := range cfg.Patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rag.boilerplate.patterns: %w", err)
+		}
+		b.patterns = append(b.patterns, re)
+	}
+	for _, line := range detected {
+		b.lines[line] = true
+	}
+	return b, nil
+}
+
+func (b *boilerplate) strip(text string) string {
+	if b == nil {
+		return text
+	}
+	for _, lit := range b.literals {
+		text = strings.ReplaceAll(text, lit, blankLines(lit))
+	}
+	for _, re := range b.patterns {
+		text = re.ReplaceAllStringFunc(text, blankLines)
+	}
+	if len(b.lines) == 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if b.lines[strings.TrimSpace(line)] {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func blankLines(s string) string {
+	return strings.Repeat("\n", strings.Count(s, "\n"))
+}
+
+// boilerplateRules renders the configured literals and patterns so a change
+// can be detected against the index state.
+func boilerplateRules(cfg config.RagBoilerplateConfig) []string {
+	rules := make([]string, 0, len(cfg.Literals)+len(cfg.Patterns))
+	for _, lit := range cfg.Literals {
+		rules = append(rules, "literal:"+lit)
+	}
+	for _, pattern := range cfg.Patterns {
+		rules = append(rules, "regex:"+pattern)
+	}
+	return rules
+}
+
+// detectBoilerplateLines returns the lines that occur in more than percent of
+// the given notes, sorted. Headings and short lines are never reported since
+// they carry structure rather than template noise.
+func detectBoilerplateLines(files []fileEntry, percent, minDocs int) ([]string, error) {
+	if percent <= 0 || len(files) == 0 || len(files) < minDocs {
+		return nil, nil
+	}
+	counts := make(map[string]int)
+	for _, file := range files {
+		if isAudioFile(file.AbsPath) {
+			// Transcripts have no templates.
+			continue
+		}
+		content, err := readNote(ioPath(file.AbsPath), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.AbsPath, err)
+		}
+		seen := make(map[string]bool)
+		for _, line := range strings.Split(normalizeText(string(content)), "\n") {
+			line = strings.TrimSpace(line)
+			if !boilerplateCandidate(line) || seen[line] {
+				continue
+			}
+			seen[line] = true
+			counts[line]++
+		}
+	}
+	var lines []string
+	for line, n := range counts {
+		if n*100 > percent*len(files) {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+func boilerplateCandidate(line string) bool {
+	return len(line) >= 8 && !strings.HasPrefix(line, "#") && strings.Trim(line, "-") != ""
+}
@@ -0,0 +1,65 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBoilerplateStripKeepsLineNumbers(t *testing.T) {
+	b, err := newBoilerplate(config.RagBoilerplateConfig{
+		Literals: []string{"<< Prev | Next >>"},
+		Patterns: []string{`(?s)<!-- footer -->.*<!-- /footer -->`},
+	}, []string{"Exported from NoteApp"})
+	if err != nil {
+		t.Fatalf("newBoilerplate() error: %v", err)
+	}
+	text := "<< Prev | Next >>\n# Title\nBody\n  Exported from NoteApp\n<!-- footer -->\nline\n<!-- /footer -->\nEnd"
+	got := b.strip(text)
+	if strings.Count(got, "\n") != strings.Count(text, "\n") {
+		t.Errorf("line count changed: %q", got)
+	}
+	for _, gone := range []string{"Prev", "NoteApp", "footer"} {
+		if strings.Contains(got, gone) {
+			t.Errorf("%q not stripped: %q", gone, got)
+		}
+	}
+	if !strings.Contains(got, "# Title\nBody") || !strings.HasSuffix(got, "End") {
+		t.Errorf("content lost: %q", got)
+	}
+}
+
+func TestBoilerplateInvalidPattern(t *testing.T) {
+	if _, err := newBoilerplate(config.RagBoilerplateConfig{Patterns: []string{"("}}, nil); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestDetectBoilerplateLines(t *testing.T) {
+	dir := t.TempDir()
+	var files []fileEntry
+	for idx, body := range []string{"unique one", "unique two", "unique three", "other"} {
+		content := "# Shared heading\n" + body + "\nBack to index page\n"
+		if idx == 3 {
+			content = "# Shared heading\n" + body + "\n"
+		}
+		path := filepath.Join(dir, body+".md")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fileEntry{AbsPath: path, RelPath: body + ".md"})
+	}
+	lines, err := detectBoilerplateLines(files, 50, 2)
+	if err != nil {
+		t.Fatalf("detectBoilerplateLines() error: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "Back to index page" {
+		t.Errorf("unexpected boilerplate lines: %v", lines)
+	}
+	if lines, _ := detectBoilerplateLines(files, 50, 10); lines != nil {
+		t.Errorf("expected no detection below min docs, got %v", lines)
+	}
+}
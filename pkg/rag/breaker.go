@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after threshold consecutive failures and rejects calls
+// until cooldown has passed. After that a single probe call is let through;
+// its outcome either closes the breaker or restarts the cooldown.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *circuitBreaker) allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+		return &UnavailableError{Backend: b.name, RetryAfter: wait}
+	}
+	if b.probing {
+		return &UnavailableError{Backend: b.name}
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// recordError records a failed call, unless it failed because the caller
+// gave up: a cancelled search says nothing about the backend's health, so it
+// neither counts as a failure nor closes an open breaker.
+func (b *circuitBreaker) recordError(ctx context.Context) {
+	if ctx.Err() == nil {
+		b.record(true)
+		return
+	}
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
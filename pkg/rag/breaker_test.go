@@ -0,0 +1,78 @@
+package rag
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker("qdrant", 2, time.Minute)
+	b.record(true)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after one failure = %v, want closed", err)
+	}
+	b.record(true)
+	var unavailable *UnavailableError
+	if err := b.allow(); !errors.As(err, &unavailable) || unavailable.Backend != "qdrant" || unavailable.RetryAfter <= 0 {
+		t.Fatalf("allow() after two failures = %v, want UnavailableError with a retry time", err)
+	}
+
+	// A success in between resets the count.
+	b = newCircuitBreaker("qdrant", 2, time.Minute)
+	b.record(true)
+	b.record(false)
+	b.record(true)
+	if err := b.allow(); err != nil {
+		t.Errorf("allow() = %v, want failures counted only when consecutive", err)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b := newCircuitBreaker("embedding", 1, 20*time.Millisecond)
+	b.record(true)
+	if err := b.allow(); err == nil {
+		t.Fatal("allow() during the cooldown = nil, want rejected")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// One probe goes through; others wait for its outcome.
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("second call let through while probing")
+	}
+	// A failed probe restarts the cooldown.
+	b.record(true)
+	if err := b.allow(); err == nil {
+		t.Fatal("allow() after a failed probe = nil, want a new cooldown")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// A successful probe closes the breaker.
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	b.record(false)
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow() after a successful probe = %v, want closed", err)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	var b *circuitBreaker
+	b.record(true)
+	if err := b.allow(); err != nil {
+		t.Errorf("nil breaker allow() = %v", err)
+	}
+	b = newCircuitBreaker("qdrant", 0, time.Minute)
+	for i := 0; i < 5; i++ {
+		b.record(true)
+	}
+	if err := b.allow(); err != nil {
+		t.Errorf("allow() with threshold 0 = %v, want always closed", err)
+	}
+}
@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SearchWithBudget runs SearchFiltered but never waits longer than maxLatency. When
+// the budget runs out it returns the best result set produced so far, or
+// ErrBudgetExceeded if retrieval had not produced anything yet. A maxLatency
+// of zero or less disables the budget.
+func (s *Service) SearchWithBudget(ctx context.Context, query string, filter SearchFilter, maxLatency time.Duration) ([]SearchResult, error) {
+	if maxLatency <= 0 {
+		return s.SearchFiltered(ctx, query, filter)
+	}
+
+	budgetCtx, cancel := context.WithTimeout(ctx, maxLatency)
+	defer cancel()
+
+	type outcome struct {
+		results []SearchResult
+		err     error
+	}
+	var (
+		mu      sync.Mutex
+		partial []SearchResult
+	)
+	query, filter = s.beforeSearch(ctx, query, filter)
+	done := make(chan outcome, 1)
+	go func() {
+		results, err := s.retrieve(budgetCtx, query, filter, func(r []SearchResult) {
+			snapshot := append([]SearchResult(nil), r...)
+			mu.Lock()
+			partial = snapshot
+			mu.Unlock()
+		})
+		done <- outcome{results: results, err: err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return nil, out.err
+		}
+		return s.afterSearch(ctx, query, out.results), nil
+	case <-budgetCtx.Done():
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if partial == nil {
+		return nil, ErrBudgetExceeded
+	}
+	return s.afterSearch(ctx, query, partial), nil
+}
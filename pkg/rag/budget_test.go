@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// hangingStore blocks every search until its context is done.
+type hangingStore struct {
+	VectorStore
+}
+
+func (hangingStore) Collection() string { return "notes" }
+func (hangingStore) Search(ctx context.Context, _ StoreQuery) ([]SearchResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newBudgetTestService(t *testing.T, vault VectorStore) *Service {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory"}}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+	s.ensemble[0].store = hangingStore{}
+	return s
+}
+
+func TestSearchWithBudgetReturnsPartialResults(t *testing.T) {
+	vault := &resultStore{results: []SearchResult{{ID: "v1", Path: "a.md", Score: 0.8}}}
+	s := newBudgetTestService(t, vault)
+	start := time.Now()
+	results, err := s.SearchWithBudget(t.Context(), "what did we decide", SearchFilter{}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("SearchWithBudget() error: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "v1" {
+		t.Errorf("SearchWithBudget() = %+v, want the vault's results while the ensemble hangs", results)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SearchWithBudget() took %s with a 50ms budget", elapsed)
+	}
+}
+
+func TestSearchWithBudgetExceeded(t *testing.T) {
+	s := newBudgetTestService(t, hangingStore{})
+	_, err := s.SearchWithBudget(t.Context(), "what did we decide", SearchFilter{}, 50*time.Millisecond)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("SearchWithBudget() error = %v, want ErrBudgetExceeded", err)
+	}
+}
@@ -0,0 +1,114 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// newBlockingService returns a service whose embedding endpoint hangs until
+// the request is abandoned, then closes aborted.
+func newBlockingService(t *testing.T, timeoutMs int) (*Service, <-chan struct{}, <-chan struct{}) {
+	t.Helper()
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices a dropped connection once the body is read.
+		io.Copy(io.Discard, r.Body)
+		close(started)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = dir
+	cfg.RAG.Embedding.APIBase = server.URL
+	cfg.RAG.Embedding.Model = "m"
+	cfg.RAG.SearchTimeoutMs = timeoutMs
+	s, err := NewService(cfg, dir)
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	return s, started, aborted
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestSearchCancellationAbortsRequests(t *testing.T) {
+	s, started, aborted := newBlockingService(t, 0)
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Search(ctx, "hello")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Search() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Search() did not return after cancellation")
+	}
+	waitClosed(t, aborted, "the embedding request to be aborted")
+}
+
+func TestPrefetchCancelAbortsRequests(t *testing.T) {
+	s, started, aborted := newBlockingService(t, 0)
+	p := s.Prefetch(t.Context(), "hello", SearchFilter{})
+	waitClosed(t, started, "the embedding request")
+	p.Cancel()
+	waitClosed(t, aborted, "the embedding request to be aborted")
+}
+
+func TestSearchTimeout(t *testing.T) {
+	s, _, aborted := newBlockingService(t, 50)
+	start := time.Now()
+	_, err := s.Search(t.Context(), "hello")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Search() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Search() took %s with a 50ms timeout", elapsed)
+	}
+	waitClosed(t, aborted, "the embedding request to be aborted")
+}
+
+func TestBreakerIgnoresCancelledCalls(t *testing.T) {
+	b := newCircuitBreaker("embedding", 1, time.Minute)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() error: %v", err)
+	}
+	b.recordError(ctx)
+	if err := b.allow(); err != nil {
+		t.Errorf("a cancelled call opened the breaker: %v", err)
+	}
+	b.recordError(t.Context())
+	if err := b.allow(); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("allow() after a failure = %v, want ErrUnavailable", err)
+	}
+}
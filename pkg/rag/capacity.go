@@ -0,0 +1,176 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Rough sizing of a Qdrant collection: each vector takes dimension float32s,
+// plus about half again for the HNSW graph and segment bookkeeping, and each
+// point's payload holds its text and some metadata. With binary
+// quantization only one bit per dimension stays in memory, and the full
+// vectors are on disk next to the bits.
+const (
+	vectorOverhead       = 1.5
+	pointPayloadOverhead = 300
+	// guessedDimension is used when neither the config nor the index state
+	// knows the embedding dimension yet.
+	guessedDimension = 1536
+	// audioBytesPerChar converts a recording's size to the length of its
+	// transcript.
+	audioBytesPerChar = 1000
+	// qdrantShare is the part of the memory and disk Qdrant reports that the
+	// index may take when rag.capacity sets no limits; the rest is left to
+	// the system and other collections.
+	qdrantShare = 0.7
+	// capacityWarnShare of a limit triggers a warning.
+	capacityWarnShare = 0.8
+)
+
+// IndexForecast is the projected size of a full index of the vault.
+type IndexForecast struct {
+	Files  int
+	Points int
+	// Dimension is the embedding dimension used; DimensionGuessed is set
+	// when it is not known yet and guessedDimension was assumed.
+	Dimension        int
+	DimensionGuessed bool
+	MemoryBytes      int64
+	DiskBytes        int64
+	// MemoryLimit and DiskLimit are 0 when unknown. LimitSource says where
+	// they come from: "rag.capacity" or "qdrant".
+	MemoryLimit int64
+	DiskLimit   int64
+	LimitSource string
+}
+
+func (f *IndexForecast) String() string {
+	guess := ""
+	if f.DimensionGuessed {
+		guess = " (assumed)"
+	}
+	return fmt.Sprintf("%d files, ~%d vectors × %d dimensions%s, ~%s memory, ~%s disk",
+		f.Files, f.Points, f.Dimension, guess, FormatBytes(f.MemoryBytes), FormatBytes(f.DiskBytes))
+}
+
+// Exceeds reports whether the forecast is over a known limit.
+func (f *IndexForecast) Exceeds() bool {
+	return (f.MemoryLimit > 0 && f.MemoryBytes > f.MemoryLimit) ||
+		(f.DiskLimit > 0 && f.DiskBytes > f.DiskLimit)
+}
+
+// Warnings describes each resource the forecast uses more than
+// capacityWarnShare of.
+func (f *IndexForecast) Warnings() []string {
+	var out []string
+	check := func(name string, used, limit int64) {
+		if limit > 0 && float64(used) > float64(limit)*capacityWarnShare {
+			out = append(out, fmt.Sprintf("projected %s %s is %.0f%% of the %s available (%s)",
+				name, FormatBytes(used), float64(used)*100/float64(limit), FormatBytes(limit), f.LimitSource))
+		}
+	}
+	check("memory", f.MemoryBytes, f.MemoryLimit)
+	check("disk", f.DiskBytes, f.DiskLimit)
+	return out
+}
+
+// ForecastIndex estimates the size of the collection a full index of the
+// vault would build, and the memory and disk it may use: the limits of
+// rag.capacity, or else a share of what the Qdrant server reports having.
+// The chunk count is estimated from file sizes without reading the notes.
+func (s *Service) ForecastIndex(ctx context.Context) (*IndexForecast, error) {
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	v.formats = noteFormatsOf(s.cfg)
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+	files, err := v.list(s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	f := &IndexForecast{Files: len(files), Dimension: s.cfg.Embedding.Dimension}
+	if f.Dimension <= 0 {
+		if state, err := s.newBackendIndexer(s.backends()[0]).loadState(); err == nil {
+			f.Dimension = state.EmbeddingDimension
+		}
+	}
+	if f.Dimension <= 0 {
+		f.Dimension, f.DimensionGuessed = guessedDimension, true
+	}
+	var textBytes int64
+	for _, file := range files {
+		info, err := os.Stat(ioPath(file.AbsPath))
+		if err != nil {
+			continue
+		}
+		size := info.Size()
+		if isAudioFile(file.AbsPath) {
+			size /= audioBytesPerChar
+		}
+		f.Points += estimateChunks(size, s.cfg.ChunkSize, s.cfg.ChunkOverlap)
+		textBytes += size
+	}
+	if s.cfg.TwoStage.Enabled {
+		f.Points += len(files)
+	}
+	f.MemoryBytes = int64(float64(f.Points) * float64(f.Dimension) * 4 * vectorOverhead)
+	f.DiskBytes = f.MemoryBytes + textBytes + int64(f.Points)*pointPayloadOverhead
+	if s.cfg.VectorDB.BinaryQuantization {
+		f.MemoryBytes /= 32
+		f.DiskBytes += f.MemoryBytes
+	}
+
+	f.MemoryLimit, f.DiskLimit = capacityLimits(s.cfg.Capacity)
+	if f.MemoryLimit > 0 || f.DiskLimit > 0 {
+		f.LimitSource = "rag.capacity"
+		return f, nil
+	}
+	if store, ok := s.store.(*QdrantClient); ok {
+		if ram, disk, err := store.systemSize(ctx); err == nil && (ram > 0 || disk > 0) {
+			f.MemoryLimit = int64(float64(ram) * qdrantShare)
+			f.DiskLimit = int64(float64(disk) * qdrantShare)
+			f.LimitSource = "qdrant"
+		}
+	}
+	return f, nil
+}
+
+// estimateChunks is the number of chunks the chunker makes of size
+// characters.
+func estimateChunks(size int64, chunkSize, overlap int) int {
+	if size <= 0 {
+		return 1
+	}
+	c := newChunker(chunkSize, overlap)
+	stride := int64(c.chunkSize - c.chunkOverlap)
+	if size <= int64(c.chunkSize) {
+		return 1
+	}
+	return 1 + int((size-int64(c.chunkSize)+stride-1)/stride)
+}
+
+func capacityLimits(cfg config.RagCapacityConfig) (memory, disk int64) {
+	return int64(cfg.MemoryMB) << 20, int64(cfg.DiskMB) << 20
+}
+
+// FormatBytes renders n bytes in the largest binary unit not above it, e.g.
+// "1.5 MiB".
+func FormatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value, unit := float64(n), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[unit]
+}
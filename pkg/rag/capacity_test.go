@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimateChunks(t *testing.T) {
+	cases := []struct {
+		size int64
+		want int
+	}{{0, 1}, {800, 1}, {801, 2}, {1500, 2}, {1501, 3}}
+	for _, c := range cases {
+		if got := estimateChunks(c.size, 800, 100); got != c.want {
+			t.Errorf("estimateChunks(%d) = %d, want %d", c.size, got, c.want)
+		}
+	}
+}
+
+func TestForecastIndexAgainstQdrantSize(t *testing.T) {
+	vault := t.TempDir()
+	os.WriteFile(filepath.Join(vault, "a.md"), []byte(strings.Repeat("x", 1500)), 0o644)
+	os.WriteFile(filepath.Join(vault, "b.md"), []byte("short"), 0o644)
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	s.cfg.ChunkSize, s.cfg.ChunkOverlap = 800, 100
+	s.cfg.Embedding.Dimension = 1024
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/telemetry" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		// 16 KiB of RAM, 1 GiB of disk.
+		w.Write([]byte(`{"result":{"app":{"system":{"ram_size":16,"disk_size":1048576}}}}`))
+	})
+
+	f, err := s.ForecastIndex(t.Context())
+	if err != nil {
+		t.Fatalf("ForecastIndex() error: %v", err)
+	}
+	if f.Files != 2 || f.Points != 3 || f.Dimension != 1024 || f.DimensionGuessed {
+		t.Errorf("forecast = %+v", f)
+	}
+	if f.MemoryBytes != 3*1024*4*3/2 || f.DiskBytes != f.MemoryBytes+1505+3*pointPayloadOverhead {
+		t.Errorf("forecast sizes = %d memory, %d disk", f.MemoryBytes, f.DiskBytes)
+	}
+	if f.LimitSource != "qdrant" || f.MemoryLimit != 16<<10*7/10 || !f.Exceeds() {
+		t.Errorf("forecast limits = %+v", f)
+	}
+	if w := f.Warnings(); len(w) != 1 || !strings.Contains(w[0], "projected memory 18 KiB") {
+		t.Errorf("Warnings() = %q", w)
+	}
+
+	s.cfg.Capacity.MemoryMB = 1
+	if f, _ := s.ForecastIndex(t.Context()); f.LimitSource != "rag.capacity" || f.Exceeds() || len(f.Warnings()) != 0 {
+		t.Errorf("forecast with rag.capacity = %+v", f)
+	}
+}
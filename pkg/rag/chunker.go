@@ -6,14 +6,49 @@ import (
 )
 
 type chunk struct {
-	Path      string
-	Heading   string
+	Path string
+	// Heading is the " > "-joined heading path used for display.
+	Heading string
+	// HeadingPath lists the enclosing headings from outermost to innermost
+	// and is empty for text before the first heading.
+	HeadingPath  []string
+	HeadingLevel int
+	// Anchor is the slug of the innermost heading, as in "note.md#anchor".
+	Anchor    string
 	StartLine int
 	EndLine   int
 	Content   string
+	// Aliases is only set on the synthetic alias chunk of a note.
+	Aliases []string
 }
 
-func chunkMarkdown(path string, content string, chunkSize int, chunkOverlap int) []chunk {
+// headingPath is the stack of headings in effect at a line. Level is the
+// markdown level (1-6) of the innermost heading, or 0 when there is none.
+// Anchor is the innermost heading's slug, unique within the note.
+type headingPath struct {
+	Titles []string
+	Level  int
+	Anchor string
+}
+
+// chunker splits markdown into overlapping line-aligned chunks. The heading
+// resolution steps are plain functions so they can be swapped in tests; the
+// output depends only on the input text and these settings.
+type chunker struct {
+	chunkSize    int
+	chunkOverlap int
+	// minChunkChars merges a chunk shorter than this into the chunk before
+	// it. Zero disables merging.
+	minChunkChars int
+	// normalize canonicalizes line endings and Unicode form before splitting.
+	normalize func(text string) string
+	// headings returns the heading path in effect for every line.
+	headings func(lines []string) []headingPath
+	// fallbackHeading names chunks that appear before any heading.
+	fallbackHeading func(path string) string
+}
+
+func newChunker(chunkSize, chunkOverlap int) *chunker {
 	if chunkSize <= 0 {
 		chunkSize = 800
 	}
@@ -23,99 +58,157 @@ func chunkMarkdown(path string, content string, chunkSize int, chunkOverlap int)
 	if chunkOverlap >= chunkSize {
 		chunkOverlap = chunkSize / 2
 	}
+	return &chunker{
+		chunkSize:       chunkSize,
+		chunkOverlap:    chunkOverlap,
+		normalize:       normalizeText,
+		headings:        headingsByLine,
+		fallbackHeading: fileTitle,
+	}
+}
+
+func chunkMarkdown(path string, content string, chunkSize int, chunkOverlap int) []chunk {
+	return newChunker(chunkSize, chunkOverlap).chunk(path, content)
+}
 
-	lines := strings.Split(content, "\n")
-	headings := headingsByLine(lines)
+func (c *chunker) chunk(path string, content string) []chunk {
+	lines := strings.Split(c.normalize(content), "\n")
+	headings := c.headings(lines)
 
 	var chunks []chunk
 	i := 0
 	for i < len(lines) {
 		start := i
-		charCount := 0
-		for i < len(lines) {
-			lineLen := len(lines[i]) + 1
-			if charCount > 0 && charCount+lineLen > chunkSize {
-				break
-			}
-			charCount += lineLen
-			i++
-		}
+		i = c.chunkEnd(lines, start)
 		end := i - 1
 		if end < start {
 			break
 		}
-		heading := headings[start]
+		hp := headings[start]
+		heading := strings.Join(hp.Titles, headingSeparator)
 		if heading == "" {
-			heading = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			heading = c.fallbackHeading(path)
 		}
 		text := strings.TrimSpace(strings.Join(lines[start:i], "\n"))
-		if text != "" {
+		if text != "" && len(text) < c.minChunkChars && len(chunks) > 0 {
+			prev := &chunks[len(chunks)-1]
+			prev.EndLine = end + 1
+			prev.Content = strings.TrimSpace(strings.Join(lines[prev.StartLine-1:i], "\n"))
+		} else if text != "" {
 			chunks = append(chunks, chunk{
-				Path:      path,
-				Heading:   heading,
-				StartLine: start + 1,
-				EndLine:   end + 1,
-				Content:   text,
+				Path:         path,
+				Heading:      heading,
+				HeadingPath:  hp.Titles,
+				HeadingLevel: hp.Level,
+				Anchor:       hp.Anchor,
+				StartLine:    start + 1,
+				EndLine:      end + 1,
+				Content:      text,
 			})
 		}
 
 		if i >= len(lines) {
 			break
 		}
+		i = c.overlapStart(lines, start, i)
+	}
 
-		if chunkOverlap > 0 {
-			overlapChars := 0
-			j := i - 1
-			for j >= start {
-				overlapChars += len(lines[j]) + 1
-				if overlapChars >= chunkOverlap {
-					break
-				}
-				j--
-			}
-			if j < start {
-				j = start
-			}
-			if j < i {
-				i = j
-			}
+	return chunks
+}
+
+// chunkEnd returns the exclusive end line of a chunk starting at start. A
+// chunk always takes at least one line, even if that line alone is too long.
+func (c *chunker) chunkEnd(lines []string, start int) int {
+	i := start
+	charCount := 0
+	for i < len(lines) {
+		lineLen := len(lines[i]) + 1
+		if charCount > 0 && charCount+lineLen > c.chunkSize {
+			break
 		}
+		charCount += lineLen
+		i++
 	}
+	return i
+}
 
-	return chunks
+// overlapStart steps back from end so the next chunk repeats roughly
+// chunkOverlap characters. The next chunk always starts after start, otherwise
+// a chunk shorter than the overlap would be produced forever.
+func (c *chunker) overlapStart(lines []string, start, end int) int {
+	if c.chunkOverlap <= 0 {
+		return end
+	}
+	overlapChars := 0
+	j := end - 1
+	for j > start {
+		overlapChars += len(lines[j]) + 1
+		if overlapChars >= c.chunkOverlap {
+			break
+		}
+		j--
+	}
+	if j <= start {
+		j = start + 1
+	}
+	if j < end {
+		return j
+	}
+	return end
 }
 
-func headingsByLine(lines []string) []string {
-	headings := make([]string, len(lines))
+func fileTitle(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+const headingSeparator = " > "
+
+func headingsByLine(lines []string) []headingPath {
+	headings := make([]headingPath, len(lines))
 	stack := make([]string, 6)
+	anchors := newAnchorSet()
+	anchor := ""
 	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "#") {
-			level := 0
-			for level < len(trimmed) && trimmed[level] == '#' {
-				level++
-			}
-			if level > 0 && level <= 6 {
-				title := strings.TrimSpace(trimmed[level:])
-				if title != "" {
-					stack[level-1] = title
-					for j := level; j < len(stack); j++ {
-						stack[j] = ""
-					}
-				}
+		if level, title, ok := parseHeadingLine(line); ok {
+			stack[level-1] = title
+			for j := level; j < len(stack); j++ {
+				stack[j] = ""
 			}
+			anchor = anchors.add(title)
 		}
-		headings[i] = joinHeading(stack)
+		headings[i] = stackPath(stack)
+		headings[i].Anchor = anchor
 	}
 	return headings
 }
 
-func joinHeading(stack []string) string {
-	var parts []string
-	for _, h := range stack {
+// parseHeadingLine reports the level and title of an ATX heading line such
+// as "## Setup". Lines of only "#" characters are not headings.
+func parseHeadingLine(line string) (int, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	title := strings.TrimSpace(trimmed[level:])
+	if title == "" {
+		return 0, "", false
+	}
+	return level, title, true
+}
+
+// stackPath collapses the per-level heading stack, skipping levels that were
+// never set (e.g. a "###" directly under a "#").
+func stackPath(stack []string) headingPath {
+	var hp headingPath
+	for level, h := range stack {
 		if h != "" {
-			parts = append(parts, h)
+			hp.Titles = append(hp.Titles, h)
+			hp.Level = level + 1
 		}
 	}
-	return strings.Join(parts, " > ")
+	return hp
 }
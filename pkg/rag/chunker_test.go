@@ -0,0 +1,139 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Regenerate with: go test ./pkg/rag -run TestChunkerGolden -update
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+const (
+	goldenChunkSize    = 200
+	goldenChunkOverlap = 40
+)
+
+type goldenChunk struct {
+	Heading      string   `json:"heading"`
+	HeadingPath  []string `json:"heading_path"`
+	HeadingLevel int      `json:"heading_level"`
+	StartLine    int      `json:"start_line"`
+	EndLine      int      `json:"end_line"`
+	Content      string   `json:"content"`
+}
+
+func TestChunkerGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "chunker", "*.md"))
+	if err != nil {
+		t.Fatalf("glob fixtures: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no chunker fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".md")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			chunks := chunkMarkdown(filepath.Base(fixture), string(content), goldenChunkSize, goldenChunkOverlap)
+			got := make([]goldenChunk, 0, len(chunks))
+			for _, ch := range chunks {
+				got = append(got, goldenChunk{
+					Heading:      ch.Heading,
+					HeadingPath:  ch.HeadingPath,
+					HeadingLevel: ch.HeadingLevel,
+					StartLine:    ch.StartLine,
+					EndLine:      ch.EndLine,
+					Content:      ch.Content,
+				})
+			}
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(got); err != nil {
+				t.Fatalf("marshal chunks: %v", err)
+			}
+			gotJSON := buf.Bytes()
+
+			goldenPath := strings.TrimSuffix(fixture, ".md") + ".golden.json"
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, gotJSON, 0644); err != nil {
+					t.Fatalf("write golden: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read golden (run with -update to create): %v", err)
+			}
+			if string(want) != string(gotJSON) {
+				t.Errorf("chunks differ from %s; rerun with -update if the change is intended\ngot:\n%s", goldenPath, gotJSON)
+			}
+		})
+	}
+}
+
+func TestChunkerDeterministic(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "chunker", "nested_headings.md"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	first := chunkMarkdown("n.md", string(content), goldenChunkSize, goldenChunkOverlap)
+	for i := 0; i < 5; i++ {
+		again := chunkMarkdown("n.md", string(content), goldenChunkSize, goldenChunkOverlap)
+		if len(again) != len(first) {
+			t.Fatalf("run %d produced %d chunks, want %d", i, len(again), len(first))
+		}
+		for j := range first {
+			if !reflect.DeepEqual(again[j], first[j]) {
+				t.Fatalf("run %d chunk %d differs", i, j)
+			}
+		}
+	}
+}
+
+func TestChunkerInjectedHeadings(t *testing.T) {
+	c := newChunker(100, 0)
+	c.headings = func(lines []string) []headingPath {
+		out := make([]headingPath, len(lines))
+		for i := range out {
+			out[i] = headingPath{Titles: []string{"fixed", "inner"}, Level: 2}
+		}
+		return out
+	}
+	chunks := c.chunk("x.md", "one\ntwo")
+	if len(chunks) != 1 || chunks[0].Heading != "fixed > inner" || chunks[0].HeadingLevel != 2 {
+		t.Errorf("expected injected heading, got %+v", chunks)
+	}
+}
+
+func TestChunkerMergesSmallChunks(t *testing.T) {
+	content := "# A\n" + strings.Repeat("long line of text\n", 5) + "# B\nshort"
+	c := newChunker(100, 0)
+	if chunks := c.chunk("m.md", content); len(chunks) < 2 {
+		t.Fatalf("expected the fixture to split, got %d chunks", len(chunks))
+	}
+
+	c.minChunkChars = 20
+	chunks := c.chunk("m.md", content)
+	last := chunks[len(chunks)-1]
+	if !strings.HasSuffix(last.Content, "# B\nshort") {
+		t.Errorf("small chunk not merged into predecessor: %+v", chunks)
+	}
+	if last.EndLine != 8 {
+		t.Errorf("merged EndLine = %d, want 8", last.EndLine)
+	}
+	if last.StartLine >= 7 {
+		t.Errorf("merged StartLine = %d, want predecessor start", last.StartLine)
+	}
+}
@@ -0,0 +1,199 @@
+package rag
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Source link styles; see config.RagSourcesConfig.
+const (
+	LinkStyleNone     = "none"
+	LinkStyleObsidian = "obsidian"
+	LinkStyleVSCode   = "vscode"
+	LinkStyleFile     = "file"
+)
+
+// citationPattern matches "[2]" and "[1, 3]" style citations.
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*[,，]\s*\d+)*)\]`)
+
+func normalizeSources(cfg config.RagSourcesConfig) (config.RagSourcesConfig, error) {
+	switch cfg.LinkStyle {
+	case "":
+		cfg.LinkStyle = LinkStyleNone
+	case LinkStyleNone, LinkStyleObsidian, LinkStyleVSCode, LinkStyleFile:
+	default:
+		return cfg, fmt.Errorf("rag.sources.link_style: unknown style %q", cfg.LinkStyle)
+	}
+	return cfg, nil
+}
+
+// CitedLabels returns the 1-based source labels cited in answer that refer
+// to one of n sources, in order of first use.
+func CitedLabels(answer string, n int) []int {
+	var labels []int
+	seen := make(map[int]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, part := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == '，' || r == ' ' }) {
+			label, err := strconv.Atoi(part)
+			if err != nil || label < 1 || label > n || seen[label] {
+				continue
+			}
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// AttachSources appends a Sources section for results to a model answer.
+// With sources.cited_only, it lists only the sources the answer cites, under
+// their original labels, and replaces a Sources section written by the
+// model; an answer without citations gets every source. Otherwise every
+// source is listed unless the model already wrote a Sources section.
+func (s *Service) AttachSources(answer string, results []SearchResult) string {
+	if len(results) == 0 {
+		return answer
+	}
+	body, hadSection := splitSourcesSection(answer)
+	if !s.cfg.Sources.CitedOnly {
+		if hadSection {
+			return answer
+		}
+		return answer + "\n\n" + s.FormatSources(results)
+	}
+	labels := CitedLabels(body, len(results))
+	if len(labels) == 0 {
+		if hadSection {
+			return answer
+		}
+		return answer + "\n\n" + s.FormatSources(results)
+	}
+	return strings.TrimRight(body, " \n") + "\n\n" + s.formatSourceLabels(results, labels)
+}
+
+// splitSourcesSection cuts a trailing Sources section, starting at a line
+// that begins with a "Sources"/"来源" heading, from answer.
+func splitSourcesSection(answer string) (string, bool) {
+	lines := strings.Split(answer, "\n")
+	for idx := len(lines) - 1; idx >= 0; idx-- {
+		if isSourcesHeading(lines[idx]) {
+			return strings.Join(lines[:idx], "\n"), true
+		}
+	}
+	return answer, false
+}
+
+func isSourcesHeading(line string) bool {
+	line = strings.TrimLeft(strings.TrimSpace(line), "#* ")
+	for _, heading := range []string{"sources", "来源"} {
+		if len(line) < len(heading) || !strings.EqualFold(line[:len(heading)], heading) {
+			continue
+		}
+		rest := strings.TrimLeft(line[len(heading):], "* ")
+		if rest == "" || strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "：") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSourceLabels renders a Sources section for the given 1-based labels.
+func (s *Service) formatSourceLabels(results []SearchResult, labels []int) string {
+	var sb strings.Builder
+	sb.WriteString("Sources:\n")
+	for _, label := range labels {
+		sb.WriteString(fmt.Sprintf("[%d] %s\n", label, s.linkedSource(results[label-1])))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// linkedSource renders a source label, as a markdown link when a link style
+// is configured and the note can be located.
+func (s *Service) linkedSource(r SearchResult) string {
+	label := FormatSource(r)
+	if link := s.sourceLink(r); link != "" {
+		return fmt.Sprintf("[%s](%s)", label, link)
+	}
+	return label
+}
+
+func (s *Service) sourceLink(r SearchResult) string {
+	style := s.cfg.Sources.LinkStyle
+	if style == "" || style == LinkStyleNone || r.SummaryLevel > 0 || r.Namespace != "" {
+		return ""
+	}
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return ""
+	}
+	root, inner, ok := v.locate(r.Path)
+	if !ok {
+		return ""
+	}
+	abs := filepath.Join(root.path, filepath.FromSlash(inner))
+	switch style {
+	case LinkStyleObsidian:
+		name := s.cfg.Sources.ObsidianVault
+		if name == "" || len(v.roots) > 1 {
+			name = filepath.Base(root.path)
+		}
+		heading := ""
+		if len(r.HeadingPath) > 0 {
+			heading = r.HeadingPath[len(r.HeadingPath)-1]
+		}
+		return obsidianURL(name, inner, heading)
+	case LinkStyleVSCode:
+		return vscodeURL(abs, r.StartLine)
+	default:
+		link := fileURL(abs)
+		if r.Anchor != "" {
+			link += "#" + r.Anchor
+		}
+		return link
+	}
+}
+
+// obsidianURL opens file, a path inside the vault, in the named vault,
+// scrolled to heading when it is not empty. Obsidian resolves headings by
+// their text rather than by slug.
+func obsidianURL(vaultName, file, heading string) string {
+	if heading != "" {
+		file += "#" + heading
+	}
+	return "obsidian://open?vault=" + queryEscape(vaultName) + "&file=" + queryEscape(file)
+}
+
+// vscodeURL opens path at line in VS Code.
+func vscodeURL(path string, line int) string {
+	link := "vscode://file" + urlPath(path)
+	if line > 0 {
+		link += fmt.Sprintf(":%d", line)
+	}
+	return link
+}
+
+func fileURL(path string) string {
+	return "file://" + urlPath(path)
+}
+
+// urlPath escapes a file path for use as a URL path. Windows drive paths get
+// a leading slash: file:///C:/notes/a.md.
+func urlPath(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// queryEscape escapes spaces as %20 rather than "+", which Obsidian does not
+// decode.
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
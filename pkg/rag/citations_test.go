@@ -0,0 +1,88 @@
+package rag
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCitedLabels(t *testing.T) {
+	got := CitedLabels("Use X [2]. Also Y [1, 3] and again [2]; not [9] or [a].", 3)
+	if want := []int{2, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CitedLabels() = %v, want %v", got, want)
+	}
+}
+
+func TestAttachSources(t *testing.T) {
+	vault := t.TempDir()
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	results := []SearchResult{
+		{Path: "a.md", StartLine: 1, EndLine: 2},
+		{Path: "b.md", StartLine: 3, EndLine: 4},
+		{Path: "c.md", StartLine: 5, EndLine: 6},
+	}
+
+	got := s.AttachSources("Answer [3].\n\n## Sources\n[1] made up", results)
+	want := "Answer [3].\n\nSources:\n[3] c.md L5-L6"
+	if got != want {
+		t.Errorf("cited only: got %q, want %q", got, want)
+	}
+
+	got = s.AttachSources("No citations here.", results)
+	if !strings.Contains(got, "[1] a.md") || !strings.Contains(got, "[3] c.md") {
+		t.Errorf("uncited answer should list every source: %q", got)
+	}
+
+	s.cfg.Sources.CitedOnly = false
+	if got := s.AttachSources("Answer [1].\nSources: a.md", results); got != "Answer [1].\nSources: a.md" {
+		t.Errorf("existing Sources section should be kept: %q", got)
+	}
+
+	s.cfg.Sources.CitedOnly = true
+	s.cfg.Sources.LinkStyle = LinkStyleFile
+	got = s.AttachSources("Answer [1].", results)
+	link := fileURL(filepath.Join(vault, "a.md"))
+	if !strings.Contains(got, "[1] [a.md L1-L2]("+link+")") {
+		t.Errorf("expected a file link to %s: %q", link, got)
+	}
+}
+
+func TestSourceLinks(t *testing.T) {
+	if got := obsidianURL("My Notes", "daily/2024 01.md", ""); got != "obsidian://open?vault=My%20Notes&file=daily%2F2024%2001.md" {
+		t.Errorf("obsidianURL() = %q", got)
+	}
+	if got := vscodeURL("/notes/a b.md", 12); got != "vscode://file/notes/a%20b.md:12" {
+		t.Errorf("vscodeURL() = %q", got)
+	}
+	if got := fileURL("/notes/a.md"); got != "file:///notes/a.md" {
+		t.Errorf("fileURL() = %q", got)
+	}
+	if got := urlPath(`C:/notes/a.md`); got != "/C:/notes/a.md" {
+		t.Errorf("urlPath() = %q", got)
+	}
+
+	vault := filepath.Join(t.TempDir(), "brain")
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	s.cfg.Sources.LinkStyle = LinkStyleObsidian
+	r := SearchResult{Path: "ideas/x.md", StartLine: 3, EndLine: 4}
+	if got := s.sourceLink(r); got != "obsidian://open?vault=brain&file=ideas%2Fx.md" {
+		t.Errorf("sourceLink() = %q", got)
+	}
+	s.cfg.Sources.ObsidianVault = "Second Brain"
+	if got := s.sourceLink(r); got != "obsidian://open?vault=Second%20Brain&file=ideas%2Fx.md" {
+		t.Errorf("sourceLink() with obsidian_vault = %q", got)
+	}
+	if !strings.Contains(s.FormatSources([]SearchResult{r}), "(obsidian://open?vault=") {
+		t.Error("FormatSources() should link sources")
+	}
+
+	r.HeadingPath, r.Anchor = []string{"Plans", "Next Steps"}, "next-steps"
+	if got := s.sourceLink(r); got != "obsidian://open?vault=Second%20Brain&file=ideas%2Fx.md%23Next%20Steps" {
+		t.Errorf("sourceLink() to a heading = %q", got)
+	}
+	s.cfg.Sources.LinkStyle = LinkStyleFile
+	if got := s.sourceLink(r); got != fileURL(filepath.Join(vault, "ideas", "x.md"))+"#next-steps" {
+		t.Errorf("file sourceLink() to a heading = %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Categories of the files in the RAG data directory, for picoclaw rag clean.
+const (
+	// DataState is the index state, its history, the placeholders of
+	// rag.anonymize and the marks of rag.feedback; removing it makes the
+	// next run a full reindex.
+	DataState = "state"
+	// DataReports is the report of the last index run.
+	DataReports = "reports"
+	// DataCaches are rebuilt when missing, at the cost of API calls:
+	// transcripts, hierarchical summaries and the spelling vocabulary.
+	DataCaches = "caches"
+	// DataRemote are the mirrors of rag.remote_vaults, downloaded again in
+	// full when missing.
+	DataRemote = "remote"
+	// DataLogs are the query log of rag.query_log and the audit log of
+	// rag.audit_log.
+	DataLogs = "logs"
+	// DataTrash are the deleted points kept by rag.trash for picoclaw rag
+	// undo-delete.
+	DataTrash = "trash"
+	// DataOther is anything picoclaw does not recognize; it is never
+	// removed.
+	DataOther = "other"
+)
+
+// DataCategories lists the categories that can be removed, in report order.
+var DataCategories = []string{DataState, DataReports, DataCaches, DataRemote, DataLogs, DataTrash}
+
+// DataUsage is the disk use of one category of the RAG data directory.
+type DataUsage struct {
+	Category string
+	// Entries are the top-level files and directories in the category.
+	Entries []string
+	Files   int
+	Bytes   int64
+}
+
+// dataCategory classifies a top-level entry of the data directory.
+func dataCategory(name string) string {
+	switch {
+	case strings.HasPrefix(name, "index_state.") || name == stateHistoryDir || name == anonymizeMapFile || name == feedbackFile:
+		return DataState
+	case name == "last_index_report.json":
+		return DataReports
+	case name == vocabularyFile || name == "transcripts" ||
+		name == "summaries.json" || strings.HasPrefix(name, "summaries.") && strings.HasSuffix(name, ".json"):
+		return DataCaches
+	case name == "remote":
+		return DataRemote
+	case strings.HasPrefix(name, queryLogFile) || strings.HasPrefix(name, auditLogFile) || strings.HasPrefix(name, routeLogFile):
+		return DataLogs
+	case name == trashDir:
+		return DataTrash
+	}
+	return DataOther
+}
+
+// DataDirUsage reports the size of each category in the local data
+// directory dataDir, in the order
+// of DataCategories followed by DataOther. Categories without files are left
+// out; a missing directory has none.
+func DataDirUsage(dataDir string) ([]DataUsage, error) {
+	entries, err := os.ReadDir(dataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	byCategory := make(map[string]*DataUsage)
+	for _, e := range entries {
+		category := dataCategory(e.Name())
+		u := byCategory[category]
+		if u == nil {
+			u = &DataUsage{Category: category}
+			byCategory[category] = u
+		}
+		u.Entries = append(u.Entries, e.Name())
+		err := filepath.WalkDir(filepath.Join(dataDir, e.Name()), func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			u.Files++
+			u.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var usage []DataUsage
+	for _, category := range append(DataCategories, DataOther) {
+		if u := byCategory[category]; u != nil {
+			sort.Strings(u.Entries)
+			usage = append(usage, *u)
+		}
+	}
+	return usage, nil
+}
+
+// CleanDataDir removes the files of the given categories from dataDir and
+// returns the bytes freed. It must not run while an index run uses the
+// directory.
+func CleanDataDir(dataDir string, categories []string) (int64, error) {
+	remove := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		if !isDataCategory(c) {
+			return 0, fmt.Errorf("unknown category %q (use %s)", c, strings.Join(DataCategories, ", "))
+		}
+		remove[c] = true
+	}
+	usage, err := DataDirUsage(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	var freed int64
+	for _, u := range usage {
+		if !remove[u.Category] {
+			continue
+		}
+		for _, name := range u.Entries {
+			if err := os.RemoveAll(filepath.Join(dataDir, name)); err != nil {
+				return freed, fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+		freed += u.Bytes
+	}
+	return freed, nil
+}
+
+func isDataCategory(name string) bool {
+	for _, c := range DataCategories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimQueryLog drops the entries of the query log in dataDir logged before
+// cutoff, merging what is left of the rotated file into the current one. It
+// returns the number of entries dropped and the bytes freed.
+func TrimQueryLog(dataDir string, cutoff time.Time) (int, int64, error) {
+	return trimQueryLog(NewLocalStorage(dataDir), cutoff)
+}
+
+func trimQueryLog(st Storage, cutoff time.Time) (int, int64, error) {
+	var kept bytes.Buffer
+	var before int64
+	dropped := 0
+	for _, name := range []string{queryLogFile + ".1", queryLogFile} {
+		data, err := st.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		before += int64(len(data))
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var e queryLogEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Time.Before(cutoff) {
+				dropped++
+				continue
+			}
+			kept.Write(scanner.Bytes())
+			kept.WriteByte('\n')
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if dropped == 0 {
+		return 0, 0, nil
+	}
+	if err := st.WriteFile(queryLogFile, kept.Bytes()); err != nil {
+		return 0, 0, err
+	}
+	if err := st.RemoveAll(queryLogFile + ".1"); err != nil {
+		return 0, 0, err
+	}
+	return dropped, before - int64(kept.Len()), nil
+}
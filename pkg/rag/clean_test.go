@@ -0,0 +1,79 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDataDirUsageAndClean(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, data string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0o755)
+		os.WriteFile(filepath.Join(dir, rel), []byte(data), 0o644)
+	}
+	write("index_state.json", "{}")
+	write("index_state.zh.json", "{}")
+	write("index_state.json.bak", "{}")
+	write("transcripts/abc.md", "hello")
+	write("vocabulary.json", "{}")
+	write("remote/s3/a.md", "remote")
+	write(queryLogFile, "log\n")
+	write("notes.bak", "mine")
+
+	usage, err := DataDirUsage(dir)
+	if err != nil {
+		t.Fatalf("DataDirUsage() error: %v", err)
+	}
+	var got []string
+	for _, u := range usage {
+		got = append(got, u.Category+":"+strings.Join(u.Entries, "+"))
+	}
+	want := "state:index_state.json+index_state.json.bak+index_state.zh.json caches:transcripts+vocabulary.json remote:remote logs:query_log.jsonl other:notes.bak"
+	if strings.Join(got, " ") != want {
+		t.Errorf("DataDirUsage() = %q", got)
+	}
+	if usage[1].Files != 2 || usage[1].Bytes != 7 {
+		t.Errorf("caches usage = %+v", usage[1])
+	}
+
+	freed, err := CleanDataDir(dir, []string{DataCaches, DataLogs})
+	if err != nil || freed != 11 {
+		t.Fatalf("CleanDataDir() = %d, %v", freed, err)
+	}
+	for _, rel := range []string{"transcripts", "vocabulary.json", queryLogFile} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.bak")); err != nil {
+		t.Errorf("unrecognized file removed: %v", err)
+	}
+	if _, err := CleanDataDir(dir, []string{DataOther}); err == nil {
+		t.Error("CleanDataDir(other) should fail")
+	}
+}
+
+func TestTrimQueryLog(t *testing.T) {
+	dir := t.TempDir()
+	line := func(at time.Time, q string) string {
+		return `{"time":"` + at.Format(time.RFC3339) + `","query":"` + q + `"}` + "\n"
+	}
+	now := time.Now()
+	os.WriteFile(filepath.Join(dir, queryLogFile)+".1", []byte(line(now.Add(-60*24*time.Hour), "old")+line(now.Add(-2*time.Hour), "kept1")), 0o600)
+	os.WriteFile(filepath.Join(dir, queryLogFile), []byte(line(now.Add(-40*24*time.Hour), "old2")+line(now, "kept2")), 0o600)
+
+	dropped, freed, err := TrimQueryLog(dir, now.Add(-30*24*time.Hour))
+	if err != nil || dropped != 2 || freed <= 0 {
+		t.Fatalf("TrimQueryLog() = %d, %d, %v", dropped, freed, err)
+	}
+	entries, _ := readQueryLog(NewLocalStorage(dir), time.Time{})
+	if len(entries) != 2 || entries[0].Query != "kept1" || entries[1].Query != "kept2" {
+		t.Errorf("entries after trim = %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, queryLogFile) + ".1"); !os.IsNotExist(err) {
+		t.Error("rotated log not removed")
+	}
+}
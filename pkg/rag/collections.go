@@ -0,0 +1,110 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// CollectionInfo describes a collection on the configured Qdrant server.
+type CollectionInfo struct {
+	Name   string
+	Points int
+	// Picoclaw is set when the collection's points carry the payload
+	// written by the indexer.
+	Picoclaw bool
+	// InUse is set when the config or an index state file refers to the
+	// collection.
+	InUse bool
+}
+
+// Prunable reports whether PruneCollections would delete the collection.
+func (c CollectionInfo) Prunable() bool {
+	return c.Picoclaw && !c.InUse
+}
+
+// Collections lists the collections on the configured Qdrant server, marking
+// the ones picoclaw created and the ones still in use.
+func (s *Service) Collections(ctx context.Context) ([]CollectionInfo, error) {
+	client, ok := s.store.(*QdrantClient)
+	if !ok {
+		return nil, fmt.Errorf("listing collections needs a %s store", StoreQdrant)
+	}
+	names, err := client.listCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	inUse := s.referencedCollections()
+	infos := make([]CollectionInfo, 0, len(names))
+	for _, name := range names {
+		col := client.forCollection(name)
+		info := CollectionInfo{Name: name, InUse: inUse[name]}
+		if info.Points, err = col.pointsCount(ctx); err != nil {
+			return nil, fmt.Errorf("inspecting collection %s: %w", name, err)
+		}
+		if info.Picoclaw, err = isPicoclawCollection(ctx, col); err != nil {
+			return nil, fmt.Errorf("inspecting collection %s: %w", name, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// PruneCollections deletes the collections picoclaw created that neither the
+// config nor any index state file refers to any more, such as the ones left
+// behind by a model change or a store migration. It returns their names.
+func (s *Service) PruneCollections(ctx context.Context) ([]string, error) {
+	if s.user != "" {
+		return nil, fmt.Errorf("collections can only be pruned from the shared knowledge base")
+	}
+	infos, err := s.Collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := s.store.(*QdrantClient)
+	var pruned []string
+	for _, info := range infos {
+		if !info.Prunable() {
+			continue
+		}
+		if err := client.forCollection(info.Name).deleteCollection(ctx); err != nil {
+			return pruned, fmt.Errorf("deleting collection %s: %w", info.Name, err)
+		}
+		pruned = append(pruned, info.Name)
+	}
+	return pruned, nil
+}
+
+// referencedCollections returns the collections of every backend, both as
+// configured and as recorded in its index state, and those of the per-user
+// knowledge bases.
+func (s *Service) referencedCollections() map[string]bool {
+	refs := make(map[string]bool)
+	for _, b := range s.backends() {
+		refs[b.store.Collection()] = true
+		if state, err := s.newBackendIndexer(b).loadState(); err == nil && state.Collection != "" {
+			refs[state.Collection] = true
+		}
+	}
+	for _, name := range s.userStateCollections() {
+		refs[name] = true
+	}
+	return refs
+}
+
+// isPicoclawCollection looks at one point of col for the chunker_version
+// payload field every indexed chunk and the metadata point carry. Empty
+// collections do not count.
+func isPicoclawCollection(ctx context.Context, col *QdrantClient) (bool, error) {
+	points, _, err := col.scroll(ctx, nil, nil, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(points) == 0 {
+		return false, nil
+	}
+	_, ok := points[0].Payload["chunker_version"]
+	return ok, nil
+}
@@ -0,0 +1,87 @@
+package rag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPruneCollections(t *testing.T) {
+	payloads := map[string]string{
+		"notes":     `{"path":"a.md","chunker_version":6}`,
+		"notes_old": `{"path":"a.md","chunker_version":5}`,
+		"notes_v1":  `{"path":"a.md","chunker_version":4}`,
+		"other":     `{"title":"x"}`,
+		"notes_tg1": `{"path":"a.md","chunker_version":6}`,
+	}
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.URL.Path == "/collections":
+			w.Write([]byte(`{"result":{"collections":[{"name":"other"},{"name":"notes_old"},{"name":"notes"},{"name":"notes_v1"},{"name":"notes_tg1"}]}}`))
+		case len(parts) == 2 && r.Method == http.MethodGet:
+			w.Write([]byte(`{"result":{"points_count":3}}`))
+		case len(parts) == 2 && r.Method == http.MethodDelete:
+			deleted = append(deleted, parts[1])
+			w.Write([]byte(`{"result":true}`))
+		case len(parts) == 4 && parts[3] == "scroll":
+			w.Write([]byte(`{"result":{"points":[{"id":"p","payload":` + payloads[parts[1]] + `}],"next_page_offset":null}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = dir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	cfg.RAG.VectorDB.URL = server.URL
+	cfg.RAG.VectorDB.Collection = "notes"
+	s, err := NewService(cfg, dir)
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	// An index state that still names an older collection keeps it alive.
+	if err := writeIndexState(NewLocalStorage(dir), "index_state.json", &indexState{Collection: "notes_v1"}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	// So does the index state of a per-user knowledge base.
+	if err := writeIndexState(NewLocalStorage(filepath.Join(dir, "users", "tg1")), "index_state.json", &indexState{Collection: "notes_tg1"}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := s.Collections(t.Context())
+	if err != nil {
+		t.Fatalf("Collections() error: %v", err)
+	}
+	var prunable []string
+	for _, info := range infos {
+		if info.Points != 3 {
+			t.Errorf("%s has %d points, want 3", info.Name, info.Points)
+		}
+		if info.Prunable() {
+			prunable = append(prunable, info.Name)
+		}
+	}
+	if want := []string{"notes_old"}; !reflect.DeepEqual(prunable, want) {
+		t.Errorf("prunable = %v, want %v", prunable, want)
+	}
+
+	pruned, err := s.PruneCollections(t.Context())
+	if err != nil {
+		t.Fatalf("PruneCollections() error: %v", err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"notes_old"}) || !reflect.DeepEqual(deleted, []string{"notes_old"}) {
+		t.Errorf("pruned %v, deleted %v", pruned, deleted)
+	}
+}
@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchWaitsForCollectionRecreate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+	deleting := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			record("delete")
+			close(deleting)
+			<-release
+		case r.Method == http.MethodPut:
+			record("create")
+		case strings.HasSuffix(r.URL.Path, "/points/search"):
+			record("search")
+			w.Write([]byte(`{"result":[]}`))
+			return
+		}
+		w.Write([]byte(`{"result":true}`))
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := client.EnsureCollection(t.Context(), 3, true); err != nil {
+			t.Errorf("EnsureCollection() error: %v", err)
+		}
+	}()
+	<-deleting
+	go func() {
+		defer wg.Done()
+		if _, err := client.Search(t.Context(), StoreQuery{Vector: []float64{1, 0, 0}, Limit: 1}); err != nil {
+			t.Errorf("Search() error: %v", err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := strings.Join(events, ","); got != "delete,create,search" {
+		t.Errorf("events = %s, want the search after the collection is recreated", got)
+	}
+}
+
+func TestHTTPClientsShareTransport(t *testing.T) {
+	a := newHTTPClient(3*time.Second, 4*time.Second, defaultHTTPTuning)
+	b := newHTTPClient(3*time.Second, 4*time.Second, defaultHTTPTuning)
+	if a != b {
+		t.Error("expected clients with the same timeouts to be shared")
+	}
+	if c := newHTTPClient(5*time.Second, 4*time.Second, defaultHTTPTuning); c == a {
+		t.Error("expected a separate client for different timeouts")
+	}
+}
+
+func TestReindexPathsDoesNotWaitForIndexRun(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if err := s.reindexPaths(t.Context(), []string{"a.md"}); !errors.Is(err, ErrIndexBusy) {
+		t.Errorf("reindexPaths() error = %v, want ErrIndexBusy", err)
+	}
+}
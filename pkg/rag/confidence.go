@@ -0,0 +1,94 @@
+package rag
+
+import "fmt"
+
+// Confidence levels, from Service.Confidence.
+const (
+	// ConfidenceHigh: the best result scores at least high_score.
+	ConfidenceHigh = "high"
+	// ConfidenceMedium: the best result scores between low_score and
+	// high_score, so the notes may only partly answer the question.
+	ConfidenceMedium = "medium"
+	// ConfidenceLow: no result reaches low_score, or there are none.
+	ConfidenceLow = "low"
+)
+
+// Confidence summarizes how well a set of results matches its query, so a
+// caller can choose between answering from the notes, answering from general
+// knowledge and saying it does not know.
+type Confidence struct {
+	Level string
+	// TopScore is the score of the best result.
+	TopScore float64
+	// Spread is the gap between the best and the worst result. A wide spread
+	// means the best results stand out; a narrow one at a low score means
+	// nothing does.
+	Spread float64
+	// Strong is the number of results scoring at least high_score.
+	Strong int
+}
+
+// Confidence rates results by their scores against rag.confidence.
+func (s *Service) Confidence(results []SearchResult) Confidence {
+	high, low := s.confidenceScores()
+	c := Confidence{Level: ConfidenceLow}
+	_, results = splitPinned(results)
+	if len(results) == 0 {
+		return c
+	}
+	c.TopScore = results[0].Score
+	bottom := results[0].Score
+	for _, r := range results {
+		c.TopScore = max(c.TopScore, r.Score)
+		bottom = min(bottom, r.Score)
+		if r.Score >= high {
+			c.Strong++
+		}
+	}
+	c.Spread = c.TopScore - bottom
+	switch {
+	case c.TopScore >= high:
+		c.Level = ConfidenceHigh
+	case c.TopScore >= low:
+		c.Level = ConfidenceMedium
+	}
+	return c
+}
+
+func (s *Service) confidenceScores() (high, low float64) {
+	high, low = s.cfg.Confidence.HighScore, s.cfg.Confidence.LowScore
+	if high <= 0 {
+		high = 0.6
+	}
+	if low <= 0 || low > high {
+		low = min(0.4, high)
+	}
+	return high, low
+}
+
+// contextGuidance is the guidance added to the context of results when
+// rag.confidence.guidance is on.
+func (s *Service) contextGuidance(results []SearchResult) string {
+	if !s.cfg.Confidence.Guidance {
+		return ""
+	}
+	return s.confidenceGuidance(s.Confidence(results))
+}
+
+// confidenceGuidance tells the model what the confidence means for its
+// answer. Without fallback_to_llm, a weak match is to be reported rather than
+// papered over with general knowledge.
+func (s *Service) confidenceGuidance(c Confidence) string {
+	high, _ := s.confidenceScores()
+	rating := fmt.Sprintf("Retrieval confidence: %s (best score %.2f, %d of the notes score %.2f or more).", c.Level, c.TopScore, c.Strong, high)
+	switch c.Level {
+	case ConfidenceHigh:
+		return rating + " Answer from the notes."
+	case ConfidenceMedium:
+		return rating + " The notes may only partly answer the question; say which parts of your answer do not come from them."
+	}
+	if s.cfg.FallbackToLLM {
+		return rating + " The notes probably do not answer the question; answer from general knowledge and say so, or say you don't know."
+	}
+	return rating + " The notes probably do not answer the question; say that they do not cover it instead of guessing."
+}
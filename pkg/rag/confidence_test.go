@@ -0,0 +1,58 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	tests := []struct {
+		scores []float64
+		level  string
+		strong int
+		spread float64
+	}{
+		{[]float64{0.82, 0.65, 0.3}, ConfidenceHigh, 2, 0.52},
+		{[]float64{0.5, 0.45}, ConfidenceMedium, 0, 0.05},
+		{[]float64{0.3}, ConfidenceLow, 0, 0},
+		{nil, ConfidenceLow, 0, 0},
+	}
+	for _, tt := range tests {
+		var results []SearchResult
+		for _, score := range tt.scores {
+			results = append(results, SearchResult{Score: score})
+		}
+		c := s.Confidence(results)
+		if c.Level != tt.level || c.Strong != tt.strong || c.Spread < tt.spread-1e-9 || c.Spread > tt.spread+1e-9 {
+			t.Errorf("Confidence(%v) = %+v", tt.scores, c)
+		}
+	}
+}
+
+func TestFormatContextConfidenceGuidance(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	results := []SearchResult{{Path: "a.md", StartLine: 1, EndLine: 2, Content: "alpha", Score: 0.31}}
+	if text := s.FormatContext(results); strings.Contains(text, "Retrieval confidence") {
+		t.Errorf("guidance added while off:\n%s", text)
+	}
+
+	s.cfg.Confidence.Guidance = true
+	text := s.FormatContext(results)
+	if !strings.HasPrefix(text, contextHeader+"Retrieval confidence: low (best score 0.31, 0 of the notes score 0.60 or more).") ||
+		!strings.Contains(text, "say that they do not cover it") {
+		t.Errorf("low confidence guidance:\n%s", text)
+	}
+	if fitted, _ := s.FitContext(results, 100000); fitted != text {
+		t.Errorf("FitContext() = %q, want %q", fitted, text)
+	}
+
+	s.cfg.FallbackToLLM = true
+	results[0].Score = 0.9
+	if text := s.FormatContext(results); !strings.Contains(text, "confidence: high") || !strings.Contains(text, "Answer from the notes.") {
+		t.Errorf("high confidence guidance:\n%s", text)
+	}
+	if text := s.FormatContextJSON(results); !strings.Contains(text, `,"guidance":"Retrieval confidence: high`) {
+		t.Errorf("JSON context guidance: %s", text)
+	}
+}
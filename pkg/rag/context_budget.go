@@ -0,0 +1,48 @@
+package rag
+
+import "unicode/utf8"
+
+// minTruncatedTokens is the smallest part of a note worth including when the
+// whole note does not fit the budget.
+const minTruncatedTokens = 40
+
+// EstimateTokens approximates the token count of text at 2.5 characters per
+// token, the same heuristic the agent uses for its history.
+func EstimateTokens(text string) int {
+	return utf8.RuneCountInString(text) * 2 / 5
+}
+
+// FitContext is FormatContext for a limited prompt: it keeps results in rank
+// order while they fit in maxTokens, truncates the first one that does not
+// fit if enough room is left for it to be useful, and drops the rest. It
+// returns the context and the results it contains, numbered as in the
+// context, or "" and nil if not even a truncated note fits.
+func (s *Service) FitContext(results []SearchResult, maxTokens int) (string, []SearchResult) {
+	f := s.contextFormat()
+	results = f.limit(results)
+	f.guidance = s.contextGuidance(results)
+	remaining := maxTokens - EstimateTokens(f.render(nil))
+	var entries []string
+	var used []SearchResult
+	for _, r := range results {
+		label := len(used) + 1
+		snippet := f.snippet(r)
+		entry := f.entry(label, r, snippet)
+		if cost := EstimateTokens(entry); cost <= remaining {
+			entries = append(entries, entry)
+			used = append(used, r)
+			remaining -= cost
+			continue
+		}
+		room := remaining - EstimateTokens(f.entry(label, r, truncatedMarker))
+		if room >= minTruncatedTokens {
+			entries = append(entries, f.entry(label, r, f.cutter.cut(snippet, room*5/2)+truncatedMarker))
+			used = append(used, r)
+		}
+		break
+	}
+	if len(used) == 0 {
+		return "", nil
+	}
+	return s.contextBuilt(used, f.render(entries)), used
+}
@@ -0,0 +1,37 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFitContext(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	long := strings.Repeat("Sepsis needs early antibiotics. ", 40)
+	results := []SearchResult{
+		{Path: "a.md", StartLine: 1, EndLine: 2, Content: "short note"},
+		{Path: "b.md", StartLine: 1, EndLine: 9, Content: long},
+		{Path: "c.md", StartLine: 1, EndLine: 2, Content: "dropped"},
+	}
+
+	full, kept := s.FitContext(results, 100000)
+	if len(kept) != 3 || full != s.FormatContext(results) {
+		t.Errorf("FitContext() with room for everything should match FormatContext, kept %d", len(kept))
+	}
+
+	budget := EstimateTokens(contextHeader+contextFooter) + 200
+	text, kept := s.FitContext(results, budget)
+	if len(kept) != 2 || kept[1].Path != "b.md" {
+		t.Fatalf("FitContext() kept %+v", kept)
+	}
+	if EstimateTokens(text) > budget {
+		t.Errorf("context of %d tokens exceeds budget %d", EstimateTokens(text), budget)
+	}
+	if !strings.Contains(text, "antibiotics."+truncatedMarker) || strings.Contains(text, "c.md") {
+		t.Errorf("expected b.md truncated at a sentence and c.md dropped:\n%s", text)
+	}
+
+	if text, kept := s.FitContext(results, 10); text != "" || kept != nil {
+		t.Errorf("FitContext() with no room = %q, %v", text, kept)
+	}
+}
@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// jsonContextInstructions accompanies results rendered as JSON.
+const jsonContextInstructions = "Answer from these knowledge base results. Cite them as [id]; if they do not contain the answer, say so."
+
+// ContextItem is one result in FormatContextJSON's output.
+type ContextItem struct {
+	// ID is the citation label, as in [1].
+	ID      int    `json:"id"`
+	Source  string `json:"source"`
+	Heading string `json:"heading,omitempty"`
+	// Anchor links to the heading's section, as in "source#anchor".
+	Anchor string `json:"anchor,omitempty"`
+	Lines  string `json:"lines"`
+	// Time is the span of an audio transcript chunk, e.g. "01:05-01:40".
+	Time  string  `json:"time,omitempty"`
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+	Stale bool    `json:"stale,omitempty"`
+	// Pinned marks a note of rag.pinned, included regardless of score.
+	Pinned bool `json:"pinned,omitempty"`
+	// Modified, Tags and Vault are the fields of rag.snippet_metadata.
+	Modified string   `json:"modified,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Vault    string   `json:"vault,omitempty"`
+}
+
+// FormatContextJSON renders results as a compact JSON object, for models that
+// ground better on structured data than on prose, such as when the context
+// is injected as a tool result:
+//
+//	{"instructions":"...","results":[{"id":1,"source":"a.md","heading":"H","lines":"1-9","text":"...","score":0.82}]}
+func (s *Service) FormatContextJSON(results []SearchResult) string {
+	f := s.contextFormat()
+	f.json = true
+	return s.formatContext(f, results)
+}
+
+func jsonContextEntry(label int, r SearchResult, snippet string, meta sourceMeta) string {
+	item := ContextItem{
+		ID:       label,
+		Source:   r.Path,
+		Heading:  r.Heading,
+		Anchor:   r.Anchor,
+		Lines:    fmt.Sprintf("%d-%d", r.StartLine, r.EndLine),
+		Text:     snippet,
+		Score:    math.Round(r.Score*1000) / 1000,
+		Stale:    r.Stale,
+		Pinned:   r.Pinned,
+		Modified: meta.Modified,
+		Tags:     meta.Tags,
+		Vault:    meta.Vault,
+	}
+	if r.AudioEnd > 0 {
+		item.Time = formatTimestamp(float64(r.AudioStart)) + "-" + formatTimestamp(float64(r.AudioEnd))
+	}
+	return marshalCompact(item)
+}
+
+func renderJSONContext(entries []string, guidance string) string {
+	text := `{"instructions":` + marshalCompact(jsonContextInstructions)
+	if guidance != "" {
+		text += `,"guidance":` + marshalCompact(guidance)
+	}
+	return text + `,"results":[` + strings.Join(entries, ",") + `]}`
+}
+
+// marshalCompact encodes v without HTML escaping, which only costs tokens
+// in a prompt.
+func marshalCompact(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
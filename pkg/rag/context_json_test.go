@@ -0,0 +1,43 @@
+package rag
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatContextJSON(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	results := []SearchResult{
+		{Path: "a.md", Heading: "Dose", StartLine: 3, EndLine: 9, Content: " x < y & z ", Score: 0.81234},
+		{Path: "b.md", StartLine: 1, EndLine: 2, Content: "beta", Stale: true},
+	}
+	text := s.FormatContextJSON(results)
+	if strings.Contains(text, `\u003c`) {
+		t.Errorf("expected no HTML escaping: %s", text)
+	}
+	var got struct {
+		Instructions string        `json:"instructions"`
+		Results      []ContextItem `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(text), &got); err != nil {
+		t.Fatalf("FormatContextJSON() is not valid JSON: %v\n%s", err, text)
+	}
+	want := ContextItem{ID: 1, Source: "a.md", Heading: "Dose", Lines: "3-9", Text: "x < y & z", Score: 0.812}
+	if len(got.Results) != 2 || !reflect.DeepEqual(got.Results[0], want) || got.Results[1].ID != 2 || !got.Results[1].Stale {
+		t.Errorf("FormatContextJSON() results = %+v", got.Results)
+	}
+
+	dated := []SearchResult{{Path: "c.md", Content: "gamma", ModTime: time.Date(2021, 4, 3, 8, 0, 0, 0, time.Local), Tags: []string{"work"}}}
+	if text := s.FormatContextJSON(dated); !strings.Contains(text, `"modified":"2021-04-03","tags":["work"]`) {
+		t.Errorf("FormatContextJSON() without metadata: %s", text)
+	}
+
+	s.format.json = true
+	fitted, kept := s.FitContext(results, 100000)
+	if fitted != text || len(kept) != 2 {
+		t.Errorf("FitContext() in json format = %s", fitted)
+	}
+}
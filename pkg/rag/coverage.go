@@ -0,0 +1,155 @@
+package rag
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// NoteCoverage is how often a note came up in the logged searches.
+type NoteCoverage struct {
+	Path string
+	// Hits counts the searches that returned the note.
+	Hits int
+	// NearMisses counts the searches where the note was among the top
+	// candidates but scored below min_similarity.
+	NearMisses int
+	// BestMiss is the highest of those scores.
+	BestMiss float64
+}
+
+// FolderCoverage sums NoteCoverage over the notes directly in a folder.
+type FolderCoverage struct {
+	Folder    string
+	Notes     int
+	Retrieved int
+	Hits      int
+}
+
+// CoverageReport is what picoclaw rag coverage prints.
+type CoverageReport struct {
+	Queries int
+	// Retrieved are the notes returned at least once, most often first.
+	Retrieved []NoteCoverage
+	// BelowThreshold are the notes only ever seen below min_similarity,
+	// most often first; they may need better chunking or wording.
+	BelowThreshold []NoteCoverage
+	// Never are the notes no logged search came near.
+	Never   []string
+	Folders []FolderCoverage
+}
+
+// Coverage reads the searches logged since the given time (see
+// rag.query_log) and reports which notes of the vault they retrieved.
+// Hits on notes that were renamed or moved since count for their new path;
+// other logged paths that are no longer in the vault are ignored.
+func (s *Service) Coverage(since time.Time) (*CoverageReport, error) {
+	if !s.cfg.QueryLog {
+		return nil, fmt.Errorf("the query log is off; set rag.query_log to true and search for a while first")
+	}
+	entries, err := readQueryLog(s.storage, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the query log: %w", err)
+	}
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	files, err := v.list(s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	paths := make([]string, len(files))
+	for idx, f := range files {
+		paths[idx] = f.RelPath
+	}
+	sort.Strings(paths)
+	byID, moved := s.docPaths()
+	for _, e := range entries {
+		followMoves(e.Hits, byID, moved)
+		followMoves(e.NearMisses, byID, moved)
+	}
+	return buildCoverage(paths, entries), nil
+}
+
+// followMoves points logged hits at the current path of their note, found by
+// the logged document ID or, for hits logged without one, by the path the
+// note had before it moved.
+func followMoves(hits []queryLogHit, byID, moved map[string]string) {
+	for idx, h := range hits {
+		id := h.ID
+		if id == "" {
+			id = moved[h.Path]
+		}
+		if p, ok := byID[id]; ok {
+			hits[idx].Path = p
+		}
+	}
+}
+
+// buildCoverage counts each note at most once per search, as a hit if any
+// of its chunks was returned and as a near miss otherwise.
+func buildCoverage(notes []string, entries []queryLogEntry) *CoverageReport {
+	stats := make(map[string]*NoteCoverage, len(notes))
+	for _, p := range notes {
+		stats[p] = &NoteCoverage{Path: p}
+	}
+	for _, e := range entries {
+		hit := make(map[string]bool)
+		for _, h := range e.Hits {
+			if n := stats[h.Path]; n != nil && !hit[h.Path] {
+				hit[h.Path] = true
+				n.Hits++
+			}
+		}
+		missed := make(map[string]bool)
+		for _, m := range e.NearMisses {
+			n := stats[m.Path]
+			if n == nil || hit[m.Path] {
+				continue
+			}
+			if !missed[m.Path] {
+				missed[m.Path] = true
+				n.NearMisses++
+			}
+			n.BestMiss = max(n.BestMiss, m.Score)
+		}
+	}
+
+	report := &CoverageReport{Queries: len(entries)}
+	folders := make(map[string]*FolderCoverage)
+	for _, p := range notes {
+		n := stats[p]
+		dir := path.Dir(p)
+		f := folders[dir]
+		if f == nil {
+			f = &FolderCoverage{Folder: dir}
+			folders[dir] = f
+		}
+		f.Notes++
+		f.Hits += n.Hits
+		switch {
+		case n.Hits > 0:
+			f.Retrieved++
+			report.Retrieved = append(report.Retrieved, *n)
+		case n.NearMisses > 0:
+			report.BelowThreshold = append(report.BelowThreshold, *n)
+		default:
+			report.Never = append(report.Never, p)
+		}
+	}
+	sort.SliceStable(report.Retrieved, func(a, b int) bool {
+		return report.Retrieved[a].Hits > report.Retrieved[b].Hits
+	})
+	sort.SliceStable(report.BelowThreshold, func(a, b int) bool {
+		return report.BelowThreshold[a].NearMisses > report.BelowThreshold[b].NearMisses
+	})
+	for _, f := range folders {
+		report.Folders = append(report.Folders, *f)
+	}
+	sort.Slice(report.Folders, func(a, b int) bool {
+		return report.Folders[a].Folder < report.Folders[b].Folder
+	})
+	return report
+}
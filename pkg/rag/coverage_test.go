@@ -0,0 +1,100 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSearchLogsHitsAndNearMisses(t *testing.T) {
+	vault := t.TempDir()
+	os.MkdirAll(filepath.Join(vault, "ops"), 0o755)
+	for _, name := range []string{"a.md", "b.md", "ops/c.md", "ops/d.md"} {
+		os.WriteFile(filepath.Join(vault, name), []byte("# note\n"), 0o644)
+	}
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	s.cfg.QueryLog = true
+	s.cfg.MinSimilarity = 0.5
+	var thresholds []float64
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if threshold, _ := body["score_threshold"].(float64); threshold != 0 {
+			thresholds = append(thresholds, threshold)
+		}
+		w.Write([]byte(`{"result":[
+			{"score":0.8,"payload":{"path":"a.md","start_line":1,"end_line":1,"content":"a"}},
+			{"score":0.7,"payload":{"path":"a.md","start_line":2,"end_line":2,"content":"a"}},
+			{"score":0.3,"payload":{"path":"ops/c.md","start_line":1,"end_line":1,"content":"c"}}
+		]}`))
+	})
+	embedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	t.Cleanup(embedServer.Close)
+	embedder, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: embedServer.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.embedder = embedder
+
+	for range 2 {
+		results, err := s.Search(t.Context(), "deploy steps")
+		if err != nil {
+			t.Fatalf("Search() error: %v", err)
+		}
+		if len(results) != 2 || results[0].Path != "a.md" {
+			t.Fatalf("Search() = %+v", results)
+		}
+	}
+	if len(thresholds) != 0 {
+		t.Errorf("searches sent score_threshold %v with the query log on", thresholds)
+	}
+
+	report, err := s.Coverage(time.Time{})
+	if err != nil {
+		t.Fatalf("Coverage() error: %v", err)
+	}
+	if report.Queries != 2 || len(report.Retrieved) != 1 || report.Retrieved[0].Hits != 2 {
+		t.Errorf("retrieved = %+v (%d queries)", report.Retrieved, report.Queries)
+	}
+	if len(report.BelowThreshold) != 1 || report.BelowThreshold[0].Path != "ops/c.md" ||
+		report.BelowThreshold[0].NearMisses != 2 || report.BelowThreshold[0].BestMiss != 0.3 {
+		t.Errorf("below threshold = %+v", report.BelowThreshold)
+	}
+	if strings.Join(report.Never, ",") != "b.md,ops/d.md" {
+		t.Errorf("never = %q", report.Never)
+	}
+	want := []FolderCoverage{{Folder: ".", Notes: 2, Retrieved: 1, Hits: 2}, {Folder: "ops", Notes: 2}}
+	if len(report.Folders) != 2 || report.Folders[0] != want[0] || report.Folders[1] != want[1] {
+		t.Errorf("folders = %+v", report.Folders)
+	}
+}
+
+func TestReadQueryLogSinceAndRotated(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	os.WriteFile(filepath.Join(dir, queryLogFile)+".1", []byte(`{"time":"`+old.Format(time.RFC3339)+`","query":"old"}`+"\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, queryLogFile), []byte("not json\n"+`{"time":"`+time.Now().Format(time.RFC3339)+`","query":"new"}`+"\n"), 0o600)
+
+	if entries, err := readQueryLog(NewLocalStorage(dir), time.Time{}); err != nil || len(entries) != 2 || entries[0].Query != "old" {
+		t.Errorf("readQueryLog() = %+v, %v", entries, err)
+	}
+	if entries, _ := readQueryLog(NewLocalStorage(dir), time.Now().Add(-time.Hour)); len(entries) != 1 || entries[0].Query != "new" {
+		t.Errorf("readQueryLog(since) = %+v", entries)
+	}
+}
+
+func TestCoverageNeedsQueryLog(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	if _, err := s.Coverage(time.Time{}); err == nil || !strings.Contains(err.Error(), "rag.query_log") {
+		t.Errorf("Coverage() error = %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package rag
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateRange is a half-open range of calendar days [From, To). Days are kept
+// as midnight UTC so they compare equal to indexed note dates regardless of
+// the server time zone.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// IsZero reports whether the range is unset.
+func (r DateRange) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+func calendarDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dayRange(day time.Time, days int) DateRange {
+	return DateRange{From: day, To: day.AddDate(0, 0, days)}
+}
+
+var isoDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// noteDate returns the day a note is about: the frontmatter date if present,
+// otherwise the date in a daily-note file name.
+func noteDate(path string, meta noteMeta, layout string) (time.Time, bool) {
+	if meta.Date != "" {
+		if m := isoDatePattern.FindString(meta.Date); m != "" {
+			if t, err := time.Parse("2006-01-02", m); err == nil {
+				return t, true
+			}
+		}
+	}
+	base := fileTitle(path)
+	if layout != "" {
+		if t, err := time.Parse(layout, base); err == nil {
+			return calendarDay(t), true
+		}
+	}
+	if m := isoDatePattern.FindString(filepath.Base(path)); m != "" {
+		if t, err := time.Parse("2006-01-02", m); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+var (
+	daysAgoPattern     = regexp.MustCompile(`\b(\d+) days? ago\b`)
+	lastWeekdayPattern = regexp.MustCompile(`\blast (monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+	cnLastWeekday      = regexp.MustCompile(`上(?:周|星期|个星期)([一二三四五六日天])`)
+)
+
+var englishWeekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+var chineseWeekdays = map[string]time.Weekday{
+	"一": time.Monday, "二": time.Tuesday, "三": time.Wednesday, "四": time.Thursday,
+	"五": time.Friday, "六": time.Saturday, "日": time.Sunday, "天": time.Sunday,
+}
+
+// parseDateRange detects a date expression in a query, such as "yesterday",
+// "last week", "last Tuesday", "3 days ago", "on 2024-03-02" or their common
+// Chinese forms, and resolves it relative to now. Weeks start on Monday.
+func parseDateRange(query string, now time.Time) (DateRange, bool) {
+	lower := strings.ToLower(query)
+	today := calendarDay(now)
+
+	if dates := isoDatePattern.FindAllString(lower, 2); len(dates) > 0 {
+		from, err := time.Parse("2006-01-02", dates[0])
+		if err == nil {
+			to := from
+			if len(dates) == 2 {
+				if t, err := time.Parse("2006-01-02", dates[1]); err == nil && t.After(from) {
+					to = t
+				}
+			}
+			return DateRange{From: from, To: to.AddDate(0, 0, 1)}, true
+		}
+	}
+
+	if m := lastWeekdayPattern.FindStringSubmatch(lower); m != nil {
+		return dayRange(previousWeekday(today, englishWeekdays[m[1]]), 1), true
+	}
+	if m := cnLastWeekday.FindStringSubmatch(query); m != nil {
+		monday := weekStart(today).AddDate(0, 0, -7)
+		offset := (int(chineseWeekdays[m[1]]) + 6) % 7
+		return dayRange(monday.AddDate(0, 0, offset), 1), true
+	}
+	if m := daysAgoPattern.FindStringSubmatch(lower); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return dayRange(today.AddDate(0, 0, -n), 1), true
+		}
+	}
+
+	switch {
+	case containsWord(lower, "today") || strings.Contains(query, "今天"):
+		return dayRange(today, 1), true
+	case containsWord(lower, "yesterday") || strings.Contains(query, "昨天"):
+		return dayRange(today.AddDate(0, 0, -1), 1), true
+	case strings.Contains(query, "前天"):
+		return dayRange(today.AddDate(0, 0, -2), 1), true
+	case strings.Contains(lower, "last week") || strings.Contains(query, "上周"):
+		return dayRange(weekStart(today).AddDate(0, 0, -7), 7), true
+	case strings.Contains(lower, "this week") || strings.Contains(query, "本周") || strings.Contains(query, "这周"):
+		start := weekStart(today)
+		return DateRange{From: start, To: today.AddDate(0, 0, 1)}, true
+	case strings.Contains(lower, "last month") || strings.Contains(query, "上个月") || strings.Contains(query, "上月"):
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return DateRange{From: first.AddDate(0, -1, 0), To: first}, true
+	case strings.Contains(lower, "this month") || strings.Contains(query, "本月") || strings.Contains(query, "这个月"):
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return DateRange{From: first, To: today.AddDate(0, 0, 1)}, true
+	}
+	return DateRange{}, false
+}
+
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// previousWeekday returns the most recent day before today that falls on wd.
+func previousWeekday(today time.Time, wd time.Weekday) time.Time {
+	diff := (int(today.Weekday()) - int(wd) + 7) % 7
+	if diff == 0 {
+		diff = 7
+	}
+	return today.AddDate(0, 0, -diff)
+}
+
+func containsWord(s, word string) bool {
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	}) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
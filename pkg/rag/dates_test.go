@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	// Thursday.
+	now := time.Date(2024, 3, 7, 15, 4, 0, 0, time.Local)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		query    string
+		from, to time.Time
+	}{
+		{"what did I do yesterday", day(6), day(7)},
+		{"what did I do last Tuesday", day(5), day(6)},
+		{"notes from last week", day(-3), day(4)},
+		{"meeting on 2024-03-02", day(2), day(3)},
+		{"between 2024-03-01 and 2024-03-03", day(1), day(4)},
+		{"3 days ago", day(4), day(5)},
+		{"上周二做了什么", day(-2), day(-1)},
+		{"今天的计划", day(7), day(8)},
+	}
+	for _, tt := range tests {
+		got, ok := parseDateRange(tt.query, now)
+		if !ok || !got.From.Equal(tt.from) || !got.To.Equal(tt.to) {
+			t.Errorf("parseDateRange(%q) = %v..%v, %v; want %v..%v", tt.query, got.From, got.To, ok, tt.from, tt.to)
+		}
+	}
+	for _, query := range []string{"atrial fibrillation", "todays special"} {
+		if _, ok := parseDateRange(query, now); ok {
+			t.Errorf("parseDateRange(%q) detected a date", query)
+		}
+	}
+}
+
+func TestNoteDate(t *testing.T) {
+	want := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	if got, ok := noteDate("journal/2024-03-02.md", noteMeta{}, "2006-01-02"); !ok || !got.Equal(want) {
+		t.Errorf("daily note date = %v, %v", got, ok)
+	}
+	if got, ok := noteDate("journal/02.03.2024.md", noteMeta{}, "02.01.2006"); !ok || !got.Equal(want) {
+		t.Errorf("custom layout date = %v, %v", got, ok)
+	}
+	if got, ok := noteDate("ideas.md", noteMeta{Date: "2024-03-02T10:00"}, "2006-01-02"); !ok || !got.Equal(want) {
+		t.Errorf("frontmatter date = %v, %v", got, ok)
+	}
+	if _, ok := noteDate("ideas.md", noteMeta{}, "2006-01-02"); ok {
+		t.Error("expected no date for undated note")
+	}
+}
@@ -0,0 +1,311 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// digestClusterSimilarity is how similar a note must be to a topic, by
+	// the mean vector of its chunks, to join it.
+	digestClusterSimilarity = 0.6
+	// digestTopicChars caps the note text sent to the LLM per topic.
+	digestTopicChars  = 6000
+	digestScrollBatch = 256
+)
+
+// Summarizer generates text for a prompt, usually with the agent's LLM.
+type Summarizer func(ctx context.Context, prompt string) (string, error)
+
+// DigestOptions selects the notes of a digest.
+type DigestOptions struct {
+	// Since is the window before Now; notes modified in it are included.
+	Since time.Duration
+	// Now defaults to the current time.
+	Now time.Time
+}
+
+// Digest summarizes the notes changed in a window, grouped into topics.
+type Digest struct {
+	From   time.Time
+	To     time.Time
+	Topics []DigestTopic
+	// Other lists the notes of topics beyond rag.digest.max_topics, which
+	// are not summarized.
+	Other []string
+}
+
+// DigestTopic is a group of similar notes and their summary.
+type DigestTopic struct {
+	Title   string
+	Summary string
+	Paths   []string
+}
+
+// Notes returns the number of notes in the digest.
+func (d *Digest) Notes() int {
+	n := len(d.Other)
+	for _, t := range d.Topics {
+		n += len(t.Paths)
+	}
+	return n
+}
+
+// Markdown renders the digest as a note linking to its sources.
+func (d *Digest) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("---\ntags: [digest]\n---\n")
+	sb.WriteString(fmt.Sprintf("# Digest %s\n\n", d.To.Format("2006-01-02")))
+	if d.Notes() == 0 {
+		sb.WriteString(fmt.Sprintf("No notes changed since %s.\n", d.From.Format("2006-01-02 15:04")))
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("%d note(s) changed between %s and %s.\n",
+		d.Notes(), d.From.Format("2006-01-02 15:04"), d.To.Format("2006-01-02 15:04")))
+	for _, t := range d.Topics {
+		sb.WriteString("\n## " + t.Title + "\n\n")
+		if t.Summary != "" {
+			sb.WriteString(t.Summary + "\n\n")
+		}
+		sb.WriteString("Sources: " + digestLinks(t.Paths) + "\n")
+	}
+	if len(d.Other) > 0 {
+		sb.WriteString("\n## Other notes\n\n" + digestLinks(d.Other) + "\n")
+	}
+	return sb.String()
+}
+
+// digestLinks renders paths as wikilinks, without the .md extension.
+func digestLinks(paths []string) string {
+	links := make([]string, len(paths))
+	for idx, p := range paths {
+		links[idx] = "[[" + strings.TrimSuffix(p, ".md") + "]]"
+	}
+	return strings.Join(links, ", ")
+}
+
+// digestNote is a changed note with the sum of its chunk vectors, which
+// points the same way as their mean.
+type digestNote struct {
+	path   string
+	vector []float64
+	chunks []string
+}
+
+// Digest collects the chunks of notes modified in the window from the index,
+// groups the notes into topics by vector similarity and has summarize write
+// a title and summary for each topic. Notes in the digest folder are left
+// out, so digests do not summarize earlier digests.
+func (s *Service) Digest(ctx context.Context, opts DigestOptions, summarize Summarizer) (*Digest, error) {
+	if opts.Since <= 0 {
+		return nil, fmt.Errorf("digest window must be positive")
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = s.now()
+	}
+	d := &Digest{From: now.Add(-opts.Since), To: now}
+	summarize = s.auditSummarizer("rag:digest", summarize)
+
+	notes, err := s.digestNotes(ctx, d.From)
+	if err != nil {
+		return nil, err
+	}
+	clusters := clusterDigestNotes(notes)
+	maxTopics := s.cfg.Digest.MaxTopics
+	if maxTopics <= 0 {
+		maxTopics = 8
+	}
+	for idx, cluster := range clusters {
+		var paths []string
+		for _, n := range cluster {
+			paths = append(paths, n.path)
+		}
+		if idx >= maxTopics {
+			d.Other = append(d.Other, paths...)
+			continue
+		}
+		reply, err := summarize(ctx, digestPrompt(cluster))
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize %s: %w", strings.Join(paths, ", "), err)
+		}
+		title, summary := parseDigestReply(reply)
+		if title == "" {
+			title = path.Base(strings.TrimSuffix(paths[0], path.Ext(paths[0])))
+		}
+		d.Topics = append(d.Topics, DigestTopic{Title: title, Summary: summary, Paths: paths})
+	}
+	sort.Strings(d.Other)
+	return d, nil
+}
+
+// digestNotes scrolls every collection for chunks modified since from.
+func (s *Service) digestNotes(ctx context.Context, from time.Time) ([]*digestNote, error) {
+	filter := map[string]interface{}{
+		"must": []map[string]interface{}{{
+			"key":   "mtime",
+			"range": map[string]interface{}{"gte": from.UnixNano()},
+		}},
+	}
+	folder := strings.Trim(s.digestFolder(), "/") + "/"
+	byPath := make(map[string]*digestNote)
+	var notes []*digestNote
+	for _, b := range s.backends() {
+		store, ok := b.store.(*QdrantClient)
+		if !ok {
+			return nil, fmt.Errorf("collection %s is not in a %s store", b.store.Collection(), StoreQdrant)
+		}
+		var offset interface{}
+		for {
+			points, next, err := store.scroll(ctx, filter, offset, digestScrollBatch)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range points {
+				if isMetadataPayload(p.Payload) {
+					continue
+				}
+				rel, _ := p.Payload["path"].(string)
+				if rel == "" || strings.HasPrefix(rel, folder) {
+					continue
+				}
+				n, ok := byPath[rel]
+				if !ok {
+					n = &digestNote{path: rel}
+					byPath[rel] = n
+					notes = append(notes, n)
+				}
+				content, _ := p.Payload["content"].(string)
+				n.chunks = append(n.chunks, content)
+				n.vector = addVector(n.vector, p.Vector)
+			}
+			if next == nil || len(points) == 0 {
+				break
+			}
+			offset = next
+		}
+	}
+	sort.Slice(notes, func(a, b int) bool { return notes[a].path < notes[b].path })
+	return notes, nil
+}
+
+// addVector adds v to sum. Vectors of another length, from another language
+// route, are ignored; only the direction of the sum matters for clustering.
+func addVector(sum, v []float64) []float64 {
+	if sum == nil {
+		return append([]float64(nil), v...)
+	}
+	if len(sum) != len(v) {
+		return sum
+	}
+	for idx := range v {
+		sum[idx] += v[idx]
+	}
+	return sum
+}
+
+// clusterDigestNotes groups notes greedily: each note joins the most similar
+// topic when it is similar enough and starts a new one otherwise. Topics are
+// returned largest first.
+func clusterDigestNotes(notes []*digestNote) [][]*digestNote {
+	var clusters [][]*digestNote
+	var centroids [][]float64
+	for _, n := range notes {
+		best, bestSim := -1, digestClusterSimilarity
+		for idx, c := range centroids {
+			if sim := cosineSimilarity(n.vector, c); sim >= bestSim {
+				best, bestSim = idx, sim
+			}
+		}
+		if best < 0 {
+			clusters = append(clusters, []*digestNote{n})
+			centroids = append(centroids, append([]float64(nil), n.vector...))
+			continue
+		}
+		clusters[best] = append(clusters[best], n)
+		centroids[best] = addVector(centroids[best], n.vector)
+	}
+	sort.SliceStable(clusters, func(a, b int) bool { return len(clusters[a]) > len(clusters[b]) })
+	return clusters
+}
+
+// digestPrompt asks for a title and a short summary of the notes of a topic.
+// Every note gets an equal share of digestTopicChars.
+func digestPrompt(notes []*digestNote) string {
+	var sb strings.Builder
+	sb.WriteString("These notes were written or edited recently. Summarize what they are about for a daily digest.\n" +
+		"Reply with a short topic title on the first line, then 2-5 bullet points with the key points, decisions and open questions. " +
+		"Only use the notes below.\n")
+	share := digestTopicChars / len(notes)
+	for _, n := range notes {
+		text := strings.Join(n.chunks, "\n\n")
+		if len([]rune(text)) > share {
+			text = truncateSnippet(text, share) + truncatedMarker
+		}
+		sb.WriteString("\n### " + n.path + "\n" + text + "\n")
+	}
+	return sb.String()
+}
+
+// parseDigestReply splits a reply into its title line and the summary below.
+func parseDigestReply(reply string) (string, string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(reply), "\n")
+	title := strings.Trim(strings.TrimSpace(first), "#*_ ")
+	if t, ok := strings.CutPrefix(title, "Title:"); ok {
+		title = strings.Trim(t, "*_ ")
+	}
+	return title, strings.TrimSpace(rest)
+}
+
+func (s *Service) digestFolder() string {
+	if s.cfg.Digest.Folder == "" {
+		return "Digests"
+	}
+	return s.cfg.Digest.Folder
+}
+
+// WriteDigest saves d in the digest folder as "Digest <date>.md", replacing
+// the digest of the same day, and indexes it. It returns the note's path in
+// the vault.
+func (s *Service) WriteDigest(ctx context.Context, d *Digest) (string, error) {
+	rel := path.Join(strings.Trim(s.digestFolder(), "/"), "Digest "+d.To.Format("2006-01-02")+".md")
+	abs, err := s.vaultNotePath(rel, "rag.digest.folder")
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(abs, []byte(d.Markdown())); err != nil {
+		return "", err
+	}
+	s.indexWrittenNote(ctx, rel)
+	return rel, nil
+}
+
+// vaultNotePath resolves rel, a note picoclaw writes into the vault, to a
+// file path. setting names the config option rel comes from.
+func (s *Service) vaultNotePath(rel, setting string) (string, error) {
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return "", err
+	}
+	abs, ok := v.abs(rel)
+	if !ok {
+		return "", fmt.Errorf("%s: %q is not in a vault, start it with a vault name", setting, rel)
+	}
+	return abs, nil
+}
+
+// indexWrittenNote indexes a note picoclaw just wrote. When that fails, for
+// example because an index run is in progress, the next run picks it up.
+func (s *Service) indexWrittenNote(ctx context.Context, rel string) {
+	if err := s.reindexPaths(ctx, []string{rel}); err != nil && !errors.Is(err, ErrIndexBusy) {
+		s.log.Warn("Failed to index written note", map[string]interface{}{
+			"path":  rel,
+			"error": err.Error(),
+		})
+	}
+}
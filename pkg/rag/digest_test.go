@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestGroupsChangedNotes(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Filter struct {
+				Must []struct {
+					Key   string             `json:"key"`
+					Range map[string]float64 `json:"range"`
+				} `json:"must"`
+			} `json:"filter"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Filter.Must) != 1 || req.Filter.Must[0].Key != "mtime" ||
+			req.Filter.Must[0].Range["gte"] != float64(now.Add(-24*time.Hour).UnixNano()) {
+			t.Errorf("filter = %+v", req.Filter)
+		}
+		w.Write([]byte(`{"result":{"points":[
+			{"id":1,"vector":[1,0],"payload":{"path":"work/api.md","content":"Rate limits go up."}},
+			{"id":2,"vector":[0.9,0.1],"payload":{"path":"work/api-notes.md","content":"Clients retry."}},
+			{"id":3,"vector":[0,1],"payload":{"path":"home/garden.md","content":"Plant tomatoes."}},
+			{"id":4,"vector":[1,0],"payload":{"path":"Digests/Digest 2026-03-01.md","content":"old digest"}},
+			{"id":5,"vector":[1,0],"payload":{"path":"work/api.md","content":"Keys rotate."}}
+		],"next_page_offset":null}}`))
+	})
+
+	var prompts []string
+	digest, err := s.Digest(t.Context(), DigestOptions{Since: 24 * time.Hour, Now: now}, func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if strings.Contains(prompt, "tomatoes") {
+			return "Garden", nil
+		}
+		return "## API changes\n- Limits raised\n- Keys rotate", nil
+	})
+	if err != nil {
+		t.Fatalf("Digest() error: %v", err)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[0], "Rate limits go up.\n\nKeys rotate.") {
+		t.Errorf("prompts = %q", prompts)
+	}
+	got := digest.Markdown()
+	for _, want := range []string{
+		"3 note(s) changed between 2026-03-01 09:00 and 2026-03-02 09:00.",
+		"## API changes\n\n- Limits raised\n- Keys rotate\n\nSources: [[work/api-notes]], [[work/api]]\n",
+		"## Garden\n\nSources: [[home/garden]]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("digest missing %q:\n%s", want, got)
+		}
+	}
+
+	s.cfg.Digest.MaxTopics = 1
+	digest, err = s.Digest(t.Context(), DigestOptions{Since: 24 * time.Hour, Now: now}, func(ctx context.Context, prompt string) (string, error) {
+		return "API", nil
+	})
+	if err != nil || len(digest.Topics) != 1 || strings.Join(digest.Other, ",") != "home/garden.md" {
+		t.Errorf("Digest() with max_topics 1 = %+v, %v", digest, err)
+	}
+}
@@ -0,0 +1,194 @@
+package rag
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// docIDKey is the frontmatter key a note's document ID is read from and,
+// with rag.index.write_ids, written to.
+const docIDKey = "id"
+
+// assignDocID returns the document ID of path and records it. An "id:" in
+// the note's frontmatter, declared, wins unless another note already holds
+// it, as a copied note would; otherwise the note keeps the ID it has, or
+// gets a new random one.
+func (s *indexState) assignDocID(path, declared string) string {
+	if s.IDs == nil {
+		s.IDs = map[string]string{}
+	}
+	id := s.IDs[path]
+	if declared != "" && declared != id && !s.hasDocID(declared) {
+		id = declared
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	s.IDs[path] = id
+	delete(s.Moved, path)
+	return id
+}
+
+func (s *indexState) hasDocID(id string) bool {
+	for _, held := range s.IDs {
+		if held == id {
+			return true
+		}
+	}
+	return false
+}
+
+// detectMoves carries the IDs of notes that disappeared over to new notes
+// of current that look like the same file moved: same extension and the
+// same modification time, which renames keep, with no other candidate
+// sharing it. It returns the moves as old path to new path. The IDs of the
+// other notes that disappeared are kept in Moved until pruneDocIDs, so a new
+// note that declares one in its frontmatter takes it over.
+func (s *indexState) detectMoves(current map[string]int64) map[string]string {
+	type key struct {
+		ext   string
+		mtime int64
+	}
+	gone := make(map[key][]string)
+	for p, mtime := range s.Files {
+		if _, ok := current[p]; !ok && s.IDs[p] != "" {
+			k := key{strings.ToLower(path.Ext(p)), mtime}
+			gone[k] = append(gone[k], p)
+		}
+	}
+	added := make(map[key][]string)
+	for p, mtime := range current {
+		if _, ok := s.Files[p]; !ok && s.IDs[p] == "" {
+			k := key{strings.ToLower(path.Ext(p)), mtime}
+			added[k] = append(added[k], p)
+		}
+	}
+	if s.Moved == nil {
+		s.Moved = map[string]string{}
+	}
+	moves := make(map[string]string)
+	for k, from := range gone {
+		to := added[k]
+		for _, p := range from {
+			s.Moved[p] = s.IDs[p]
+			delete(s.IDs, p)
+		}
+		if len(from) != 1 || len(to) != 1 {
+			continue
+		}
+		s.IDs[to[0]] = s.Moved[from[0]]
+		delete(s.Moved, to[0])
+		moves[from[0]] = to[0]
+	}
+	return moves
+}
+
+// pruneDocIDs forgets the IDs of notes no longer in the vault, and the old
+// paths of notes that are gone.
+func (s *indexState) pruneDocIDs(current map[string]int64) {
+	for p := range s.IDs {
+		if _, ok := current[p]; !ok {
+			delete(s.IDs, p)
+		}
+	}
+	held := make(map[string]bool, len(s.IDs))
+	for _, id := range s.IDs {
+		held[id] = true
+	}
+	for p, id := range s.Moved {
+		if !held[id] {
+			delete(s.Moved, p)
+		}
+	}
+}
+
+// docPaths maps the document IDs of every backend's index to the notes'
+// current paths, and the paths notes had before a move to their IDs.
+func (s *Service) docPaths() (byID, moved map[string]string) {
+	byID = make(map[string]string)
+	moved = make(map[string]string)
+	for _, b := range s.backends() {
+		state, err := s.newBackendIndexer(b).loadState()
+		if err != nil {
+			continue
+		}
+		for p, id := range state.IDs {
+			byID[id] = p
+		}
+		for p, id := range state.Moved {
+			moved[p] = id
+		}
+	}
+	return byID, moved
+}
+
+// movedPath returns where the note that was at old is now, if it moved.
+func (s *Service) movedPath(old string) (string, bool) {
+	byID, moved := s.docPaths()
+	p, ok := byID[moved[old]]
+	return p, ok
+}
+
+// writableNote reports whether the document ID of file can be written into
+// it: it is a markdown note, and not a copy of a rag.remote_vaults vault,
+// which the next sync would overwrite.
+func (i *indexer) writableNote(file fileEntry) bool {
+	if !strings.EqualFold(filepath.Ext(file.AbsPath), ".md") {
+		return false
+	}
+	remote := make(map[string]bool, len(i.cfg.RemoteVaults))
+	for _, r := range i.cfg.RemoteVaults {
+		remote[strings.TrimSpace(r.Name)] = true
+	}
+	for _, entry := range i.cfg.VaultPath {
+		name, dir, ok := strings.Cut(entry, "=")
+		if !ok || !remote[strings.TrimSpace(name)] {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Clean(strings.TrimSpace(dir)), file.AbsPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeDocID adds "id: <id>" to the frontmatter of the note at absPath,
+// whose current content is data, creating the frontmatter if there is
+// none. It returns the new content and modification time.
+func writeDocID(absPath string, data []byte, id string) ([]byte, int64, error) {
+	newline := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+	line := docIDKey + ": " + id + newline
+	body := bytes.TrimPrefix(data, []byte("\ufeff"))
+	var out bytes.Buffer
+	out.Write(data[:len(data)-len(body)])
+	if first, rest, ok := bytes.Cut(body, []byte("\n")); ok && parseFrontmatter(normalizeText(string(body))).EndLine > 0 {
+		// Right after the opening "---".
+		out.Write(first)
+		out.WriteString("\n" + line)
+		out.Write(rest)
+	} else {
+		out.WriteString("---" + newline + line + "---" + newline)
+		out.Write(body)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := os.WriteFile(absPath, out.Bytes(), info.Mode().Perm()); err != nil {
+		return nil, 0, err
+	}
+	info, err = os.Stat(absPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out.Bytes(), info.ModTime().UnixNano(), nil
+}
@@ -0,0 +1,101 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestDocIDsFollowMoves(t *testing.T) {
+	state := &indexState{Files: map[string]int64{"a.md": 1, "b.md": 2, "c.md": 3}}
+	ids := map[string]string{}
+	for p := range state.Files {
+		ids[p] = state.assignDocID(p, "")
+	}
+	if state.assignDocID("a.md", "") != ids["a.md"] {
+		t.Fatal("assignDocID() changed an assigned ID")
+	}
+
+	// a.md moved keeping its mtime; c.md was deleted and e.md is new.
+	current := map[string]int64{"notes/a.md": 1, "b.md": 2, "e.md": 5}
+	moves := state.detectMoves(current)
+	if len(moves) != 1 || moves["a.md"] != "notes/a.md" || state.IDs["notes/a.md"] != ids["a.md"] {
+		t.Fatalf("detectMoves() = %v, IDs %v", moves, state.IDs)
+	}
+	// A note that declares the ID of a deleted one takes it over; a copy
+	// declaring the ID of a note still there gets its own.
+	if got := state.assignDocID("e.md", ids["c.md"]); got != ids["c.md"] {
+		t.Errorf("declared ID = %q, want %q", got, ids["c.md"])
+	}
+	current["copy.md"] = 6
+	if got := state.assignDocID("copy.md", ids["b.md"]); got == ids["b.md"] || got == "" {
+		t.Errorf("copied note got ID %q", got)
+	}
+
+	delete(current, "b.md")
+	state.pruneDocIDs(current)
+	if _, ok := state.IDs["b.md"]; ok {
+		t.Error("ID of a removed note kept")
+	}
+	if state.Moved["a.md"] != ids["a.md"] || state.Moved["c.md"] != ids["c.md"] || len(state.Moved) != 2 {
+		t.Errorf("Moved = %v", state.Moved)
+	}
+
+	byID := map[string]string{ids["a.md"]: "notes/a.md"}
+	hits := []queryLogHit{{Path: "a.md"}, {Path: "x.md", ID: ids["a.md"]}, {Path: "b.md"}}
+	followMoves(hits, byID, state.Moved)
+	if hits[0].Path != "notes/a.md" || hits[1].Path != "notes/a.md" || hits[2].Path != "b.md" {
+		t.Errorf("followMoves() = %+v", hits)
+	}
+}
+
+func TestIndexFileWritesDocID(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.DefaultConfig().RAG
+	cfg.VaultPath = config.VaultPaths{root}
+	cfg.Index.WriteIDs = true
+	store := &pathStore{points: map[string][]QdrantPoint{}}
+	i := newIndexer(cfg, NewMemoryStorage(), fixedEmbedder{}, store)
+	state := &indexState{Files: map[string]int64{}, OtherLanguage: map[string]int64{}, EmbeddingDimension: 2}
+	ctx := context.Background()
+
+	notes := map[string]string{
+		"plain.md":    "# Plain\r\nbody\r\n",
+		"meta.md":     "---\ntitle: Meta\n---\n# Meta\nbody\n",
+		"declared.md": "---\nid: note-7\n---\nbody\n",
+	}
+	for name, content := range notes {
+		abs := filepath.Join(root, name)
+		os.WriteFile(abs, []byte(content), 0o644)
+		if _, err := i.indexFile(ctx, state, fileEntry{AbsPath: abs, RelPath: name, MTime: 1}, nil); err != nil {
+			t.Fatalf("indexFile(%s) error: %v", name, err)
+		}
+		data, _ := os.ReadFile(abs)
+		id := state.IDs[name]
+		if got := store.points[name][0].Payload["doc_id"]; got != id || id == "" {
+			t.Errorf("%s: doc_id payload %v, state %q", name, got, id)
+		}
+		if name == "declared.md" {
+			if id != "note-7" || string(data) != content || state.Files[name] != 1 {
+				t.Errorf("declared.md: ID %q, content %q", id, data)
+			}
+			continue
+		}
+		if meta := parseFrontmatter(normalizeText(string(data))); meta.ID != id {
+			t.Errorf("%s: frontmatter ID %q, want %q in %q", name, meta.ID, id, data)
+		}
+		if info, _ := os.Stat(abs); state.Files[name] != info.ModTime().UnixNano() {
+			t.Errorf("%s: state mtime not updated after writing the ID", name)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "plain.md")); !strings.HasPrefix(string(data), "---\r\nid: ") {
+		t.Errorf("new frontmatter = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "meta.md")); !strings.HasPrefix(string(data), "---\nid: ") || !strings.Contains(string(data), "title: Meta\n---\n# Meta") {
+		t.Errorf("extended frontmatter = %q", data)
+	}
+}
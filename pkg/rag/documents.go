@@ -0,0 +1,186 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// documentPayloadKey marks the point holding a note's vector for
+// rag.two_stage. Its vector is the sum of the note's chunk vectors, which
+// points the same way as their mean; the collection compares by cosine.
+const documentPayloadKey = "document"
+
+// documentsFilter adds to filter the condition that selects the per-note
+// points when documents is set, and that leaves them out otherwise, so chunk
+// searches never return them.
+func documentsFilter(filter map[string]interface{}, documents bool) map[string]interface{} {
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+	cond := map[string]interface{}{
+		"key":   documentPayloadKey,
+		"match": map[string]interface{}{"value": true},
+	}
+	if documents {
+		must, _ := filter["must"].([]map[string]interface{})
+		filter["must"] = append(must, cond)
+	} else {
+		mustNot, _ := filter["must_not"].([]map[string]interface{})
+		filter["must_not"] = append(mustNot, cond)
+	}
+	return filter
+}
+
+func isDocumentPayload(payload map[string]interface{}) bool {
+	v, _ := payload[documentPayloadKey].(bool)
+	return v
+}
+
+// newDocumentPoint is the per-note point of path. It carries the payload the
+// search filters match on, so a filtered shortlist only holds notes whose
+// chunks can match too. Its path payload makes DeleteByPath remove it with
+// the chunks.
+func newDocumentPoint(path string, vector []float64, chunks int, meta map[string]interface{}) QdrantPoint {
+	payload := map[string]interface{}{
+		"path":             path,
+		documentPayloadKey: true,
+		"chunks":           chunks,
+		"chunker_version":  chunkerVersion,
+	}
+	for _, key := range []string{"tags", "note_date", "book", "author"} {
+		if v, ok := meta[key]; ok {
+			payload[key] = v
+		}
+	}
+	return QdrantPoint{
+		ID:      hashPointID(path+"#document", 0, 0),
+		Vector:  vector,
+		Payload: payload,
+	}
+}
+
+// documentPoint is the per-note point of a note being indexed.
+func (i *indexer) documentPoint(path string, meta noteMeta, vector []float64, chunks int) QdrantPoint {
+	payload := map[string]interface{}{"tags": stringsPayload(meta.Tags)}
+	if date, ok := noteDate(path, meta, i.cfg.DailyNoteFormat); ok {
+		payload["note_date"] = date.Unix()
+	}
+	if meta.Book != "" {
+		payload["book"] = meta.Book
+		if meta.Author != "" {
+			payload["author"] = meta.Author
+		}
+	}
+	return newDocumentPoint(path, vector, chunks, payload)
+}
+
+// updateDocuments brings the per-note points in line with rag.two_stage.
+// Notes indexed while it is on get theirs as they are written; this adds the
+// points of notes indexed before it was turned on, from the stored chunk
+// vectors, and removes every per-note point once it is turned off.
+func (i *indexer) updateDocuments(ctx context.Context, state *indexState) error {
+	if i.cfg.TwoStage.Enabled == state.Documents {
+		return nil
+	}
+	store, ok := i.store.(*QdrantClient)
+	if !ok {
+		return fmt.Errorf("rag.two_stage needs a %s store", StoreQdrant)
+	}
+	if !i.cfg.TwoStage.Enabled {
+		if err := store.deleteByFilter(ctx, documentsFilter(nil, true)); err != nil {
+			return err
+		}
+		state.Documents = false
+		return nil
+	}
+
+	type note struct {
+		vector []float64
+		chunks int
+		meta   map[string]interface{}
+	}
+	notes := make(map[string]*note)
+	var order []string
+	filter := documentsFilter(map[string]interface{}{
+		"must": []map[string]interface{}{{"is_empty": map[string]interface{}{"key": "summary_level"}}},
+	}, false)
+	var offset interface{}
+	for {
+		points, next, err := store.scroll(ctx, filter, offset, digestScrollBatch)
+		if err != nil {
+			return err
+		}
+		for _, p := range points {
+			path, _ := p.Payload["path"].(string)
+			if isMetadataPayload(p.Payload) || path == "" || len(p.Vector) == 0 {
+				continue
+			}
+			n, ok := notes[path]
+			if !ok {
+				n = &note{meta: p.Payload}
+				notes[path] = n
+				order = append(order, path)
+			}
+			n.vector = addVector(n.vector, p.Vector)
+			n.chunks++
+		}
+		if next == nil || len(points) == 0 {
+			break
+		}
+		offset = next
+	}
+
+	batch := make([]QdrantPoint, 0, i.embedder.BatchSize())
+	for idx, path := range order {
+		n := notes[path]
+		batch = append(batch, newDocumentPoint(path, n.vector, n.chunks, n.meta))
+		if len(batch) == cap(batch) || idx == len(order)-1 {
+			if err := store.Upsert(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	state.Documents = true
+	return nil
+}
+
+// shortlistDocuments returns the paths of the rag.two_stage.documents notes
+// closest to the query vector. The heading filter is left out, as it only
+// applies to chunks.
+func (s *Service) shortlistDocuments(ctx context.Context, b *backend, query StoreQuery) ([]string, error) {
+	limit := s.cfg.TwoStage.Documents
+	if limit <= 0 {
+		limit = 20
+	}
+	filter := query.Filter
+	filter.UnderHeading = ""
+	docs, err := b.store.Search(ctx, StoreQuery{
+		Vector:    query.Vector,
+		Limit:     limit,
+		Filter:    filter,
+		Documents: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(docs))
+	for _, d := range docs {
+		paths = append(paths, d.Path)
+	}
+	return paths, nil
+}
+
+// searchChunks runs a chunk search, first narrowing it to the shortlisted
+// notes when rag.two_stage is on. An empty shortlist, as before the per-note
+// points exist, falls back to searching every chunk.
+func (s *Service) searchChunks(ctx context.Context, b *backend, query StoreQuery) ([]SearchResult, error) {
+	if s.cfg.TwoStage.Enabled && len(query.Filter.Paths) == 0 {
+		paths, err := s.shortlistDocuments(ctx, b, query)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter.Paths = paths
+	}
+	return b.store.Search(ctx, query)
+}
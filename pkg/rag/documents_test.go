@@ -0,0 +1,110 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSearchChunksShortlistsDocuments(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.cfg.TwoStage = config.RagTwoStageConfig{Enabled: true, Documents: 2}
+	var filters []string
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Limit  int                    `json:"limit"`
+			Filter map[string]interface{} `json:"filter"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data, _ := json.Marshal(req.Filter)
+		filters = append(filters, string(data))
+		if len(filters) == 1 {
+			if req.Limit != 2 {
+				t.Errorf("shortlist limit = %d, want 2", req.Limit)
+			}
+			w.Write([]byte(`{"result":[{"score":0.9,"payload":{"path":"a.md","document":true}},{"score":0.8,"payload":{"path":"b.md","document":true}}]}`))
+			return
+		}
+		w.Write([]byte(`{"result":[{"score":0.7,"payload":{"path":"b.md","content":"chunk","start_line":1,"end_line":2}}]}`))
+	})
+
+	b := s.backends()[0]
+	results, err := s.searchChunks(t.Context(), b, StoreQuery{
+		Vector: []float64{1, 0},
+		Limit:  5,
+		Filter: SearchFilter{UnderHeading: "API", Tags: []string{"work"}},
+	})
+	if err != nil {
+		t.Fatalf("searchChunks() error: %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "b.md" {
+		t.Errorf("results = %+v", results)
+	}
+	if len(filters) != 2 {
+		t.Fatalf("searches = %d, want 2", len(filters))
+	}
+	if want := `{"must":[{"key":"tags","match":{"value":"work"}},{"key":"document","match":{"value":true}}]}`; filters[0] != want {
+		t.Errorf("shortlist filter = %s", filters[0])
+	}
+	for _, want := range []string{`"heading_path"`, `{"key":"path","match":{"any":["a.md","b.md"]}}`, `"must_not":[{"key":"document"`} {
+		if !strings.Contains(filters[1], want) {
+			t.Errorf("chunk filter %s missing %s", filters[1], want)
+		}
+	}
+}
+
+func TestUpdateDocumentsBackfillsAndRemoves(t *testing.T) {
+	var upserted, deleted []string
+	store := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/points/scroll"):
+			w.Write([]byte(`{"result":{"points":[
+				{"id":1,"vector":[1,0],"payload":{"path":"a.md","tags":["work"]}},
+				{"id":2,"vector":[0,1],"payload":{"path":"a.md","tags":["work"]}},
+				{"id":3,"vector":[0,2],"payload":{"path":"b.md"}}
+			],"next_page_offset":null}}`))
+		case strings.HasSuffix(r.URL.Path, "/points/delete"):
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			data, _ := json.Marshal(req["filter"])
+			deleted = append(deleted, string(data))
+			w.Write([]byte(`{"result":{}}`))
+		case r.Method == http.MethodPut:
+			var req struct {
+				Points []QdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			for _, p := range req.Points {
+				upserted = append(upserted, fmt.Sprintf("%s %v %v %v", p.Payload["path"], p.Vector, p.Payload["chunks"], p.Payload["tags"]))
+			}
+			w.Write([]byte(`{"result":{}}`))
+		}
+	})
+	cfg := config.DefaultConfig().RAG
+	cfg.TwoStage.Enabled = true
+	idx := newIndexer(cfg, NewLocalStorage(t.TempDir()), &EmbeddingClient{batchSize: 16}, store)
+	state := &indexState{}
+	if err := idx.updateDocuments(t.Context(), state); err != nil {
+		t.Fatalf("updateDocuments() error: %v", err)
+	}
+	if got := strings.Join(upserted, "; "); got != "a.md [1 1] 2 [work]; b.md [0 2] 1 <nil>" || !state.Documents {
+		t.Errorf("upserted %q, state.Documents = %v", got, state.Documents)
+	}
+
+	upserted = nil
+	if err := idx.updateDocuments(t.Context(), state); err != nil || len(upserted) != 0 {
+		t.Errorf("second updateDocuments() = %v, upserted %q", err, upserted)
+	}
+
+	idx.cfg.TwoStage.Enabled = false
+	if err := idx.updateDocuments(t.Context(), state); err != nil {
+		t.Fatalf("updateDocuments() when disabled error: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != `{"must":[{"key":"document","match":{"value":true}}]}` || state.Documents {
+		t.Errorf("deleted %q, state.Documents = %v", deleted, state.Documents)
+	}
+}
@@ -13,15 +13,48 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 )
 
+// Embedder turns texts into vectors. EmbeddingClient implements it for
+// OpenAI-compatible APIs; WithEmbedder sets another implementation.
+type Embedder interface {
+	// EmbedBatch returns one vector per input, in order.
+	EmbedBatch(ctx context.Context, inputs []string) ([][]float64, error)
+	// Model identifies the embedding model; the index is rebuilt when it
+	// changes.
+	Model() string
+	// BatchSize is the number of inputs indexing sends per EmbedBatch call.
+	BatchSize() int
+	// Concurrency is the number of EmbedBatch calls indexing may run at
+	// once.
+	Concurrency() int
+}
+
 type EmbeddingClient struct {
-	apiKey     string
-	apiBase    string
-	model      string
-	batchSize  int
-	httpClient *http.Client
+	apiKey          string
+	apiBase         string
+	model           string
+	batchSize       int
+	concurrency     int
+	timeout         time.Duration
+	timeoutPerInput time.Duration
+	httpClient      *http.Client
+	breaker         *circuitBreaker
+	calls           apiCounter
+	// batcher replaces batchSize under rag.embedding.adaptive_batch.
+	batcher *batchController
+	// compression is set by rag.embedding.compress_requests.
+	compression *requestCompression
+	// anonymizer, set under rag.anonymize for remote APIs, replaces names
+	// and IDs in the inputs before they are sent.
+	anonymizer *anonymizer
 }
 
+// NewEmbeddingClient returns a client for cfg with the default rag.http
+// settings.
 func NewEmbeddingClient(cfg config.RagEmbeddingConfig) (*EmbeddingClient, error) {
+	return newEmbeddingClient(cfg, defaultHTTPTuning)
+}
+
+func newEmbeddingClient(cfg config.RagEmbeddingConfig, tuning config.RagHTTPConfig) (*EmbeddingClient, error) {
 	if cfg.APIBase == "" {
 		return nil, fmt.Errorf("embedding api_base is required")
 	}
@@ -32,31 +65,85 @@ func NewEmbeddingClient(cfg config.RagEmbeddingConfig) (*EmbeddingClient, error)
 	if batchSize <= 0 {
 		batchSize = 16
 	}
-	timeout := cfg.TimeoutSeconds
-	if timeout <= 0 {
-		timeout = 60
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	timeoutPerInput := cfg.TimeoutPerInputMs
+	if timeoutPerInput < 0 {
+		timeoutPerInput = 0
 	}
+	compression := newRequestCompression(cfg.CompressRequests)
 	return &EmbeddingClient{
-		apiKey:     cfg.APIKey,
-		apiBase:    strings.TrimRight(cfg.APIBase, "/"),
-		model:      cfg.Model,
-		batchSize:  batchSize,
-		httpClient: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		apiKey:          cfg.APIKey,
+		apiBase:         strings.TrimRight(cfg.APIBase, "/"),
+		model:           cfg.Model,
+		batchSize:       batchSize,
+		concurrency:     concurrency,
+		timeout:         secondsOrDefault(cfg.TimeoutSeconds, 60),
+		timeoutPerInput: time.Duration(timeoutPerInput) * time.Millisecond,
+		httpClient: compressingClient(newHTTPClient(
+			secondsOrDefault(cfg.ConnectTimeoutSeconds, 10),
+			secondsOrDefault(cfg.TLSTimeoutSeconds, 10),
+			tuning,
+		), compression),
+		compression: compression,
+		batcher:     newBatchController(cfg, batchSize),
 	}, nil
 }
 
+// BatchSize is batch_size, or under adaptive_batch the size the observed
+// requests suggest; callers should read it once per batch.
 func (c *EmbeddingClient) BatchSize() int {
+	if c.batcher != nil {
+		return c.batcher.current()
+	}
 	return c.batchSize
 }
 
+// Concurrency is the number of EmbedBatch calls indexing may run at once.
+func (c *EmbeddingClient) Concurrency() int {
+	return c.concurrency
+}
+
 func (c *EmbeddingClient) Model() string {
+	// Anonymized text embeds differently, so switching rag.anonymize on or
+	// off rebuilds the index.
+	if c.anonymizer != nil {
+		return c.model + "+anonymized"
+	}
 	return c.model
 }
 
+// requestTimeout grows the base timeout with the number of inputs so large
+// batches against slow local models are not cut off.
+func (c *EmbeddingClient) requestTimeout(inputs int) time.Duration {
+	return c.timeout + time.Duration(inputs)*c.timeoutPerInput
+}
+
 func (c *EmbeddingClient) EmbedBatch(ctx context.Context, inputs []string) ([][]float64, error) {
+	if c.batcher == nil || len(inputs) == 0 {
+		return c.embedBatch(ctx, inputs)
+	}
+	start := time.Now()
+	embeddings, err := c.embedBatch(ctx, inputs)
+	c.batcher.observe(inputs, time.Since(start), err)
+	return embeddings, err
+}
+
+func (c *EmbeddingClient) embedBatch(ctx context.Context, inputs []string) ([][]float64, error) {
 	if len(inputs) == 0 {
 		return nil, nil
 	}
+	if c.anonymizer != nil {
+		var err error
+		if inputs, err = c.anonymizer.apply(inputs); err != nil {
+			return nil, err
+		}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.requestTimeout(len(inputs)))
+	defer cancel()
 
 	requestBody := map[string]interface{}{
 		"model": c.model,
@@ -68,7 +155,7 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, inputs []string) ([][]
 		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.apiBase+"/embeddings", bytes.NewReader(jsonData))
+	req, err := http.NewRequestWithContext(reqCtx, "POST", c.apiBase+"/embeddings", bytes.NewReader(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create embedding request: %w", err)
 	}
@@ -78,11 +165,17 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, inputs []string) ([][]
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
 
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	c.calls.add(len(inputs))
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.breaker.recordError(ctx)
 		return nil, fmt.Errorf("embedding request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	c.breaker.record(resp.StatusCode >= 500)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -90,7 +183,7 @@ func (c *EmbeddingClient) EmbedBatch(ctx context.Context, inputs []string) ([][]
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("embedding API error: %d %s", resp.StatusCode, string(body))
+		return nil, newProviderError("embedding", resp, body)
 	}
 
 	var apiResponse struct {
@@ -0,0 +1,62 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestEmbeddingRequestTimeout(t *testing.T) {
+	client, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: "http://localhost:11434/v1", Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.requestTimeout(100); got != 60*time.Second {
+		t.Errorf("default request timeout = %s, want 60s regardless of the batch", got)
+	}
+
+	client, err = NewEmbeddingClient(config.RagEmbeddingConfig{
+		APIBase:               "http://localhost:11434/v1",
+		Model:                 "m",
+		TimeoutSeconds:        2,
+		TimeoutPerInputMs:     500,
+		ConnectTimeoutSeconds: 3,
+		TLSTimeoutSeconds:     4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.requestTimeout(4); got != 4*time.Second {
+		t.Errorf("requestTimeout(4) = %s, want 2s plus 4 × 500ms", got)
+	}
+	if transport := client.httpClient.Transport.(*http.Transport); transport.TLSHandshakeTimeout != 4*time.Second {
+		t.Errorf("TLS handshake timeout = %s, want 4s", transport.TLSHandshakeTimeout)
+	}
+}
+
+func TestEmbeddingTimeoutAbortsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: server.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err = client.EmbedBatch(context.Background(), []string{"hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EmbedBatch() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("EmbedBatch() took %s with a 50ms timeout", elapsed)
+	}
+}
@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// ensembleMember is a collection of rag.ensemble. Its embedder is nil when
+// it shares the default embedding model.
+type ensembleMember struct {
+	name     string
+	weight   float64
+	embedder Embedder
+	store    VectorStore
+}
+
+// newEnsemble builds the members of rag.ensemble. Member names must be
+// unique, as they tell the results apart.
+func newEnsemble(base config.RagConfig) ([]*ensembleMember, error) {
+	if base.Ensemble.VaultWeight < 0 {
+		return nil, fmt.Errorf("rag.ensemble.vault_weight must not be negative")
+	}
+	seen := make(map[string]bool)
+	var members []*ensembleMember
+	for _, c := range base.Ensemble.Collections {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			return nil, fmt.Errorf("rag.ensemble.collections: name is required")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rag.ensemble.collections: duplicate name %q", name)
+		}
+		seen[name] = true
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("rag.ensemble.collections[%s]: weight must not be negative", name)
+		}
+		m, err := newEnsembleMember(base, c, name)
+		if err != nil {
+			return nil, fmt.Errorf("rag.ensemble.collections[%s]: %w", name, err)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func newEnsembleMember(base config.RagConfig, c config.RagEnsembleCollectionConfig, name string) (*ensembleMember, error) {
+	m := &ensembleMember{name: name, weight: c.Weight}
+	if m.weight == 0 {
+		m.weight = 1
+	}
+	cooldown := secondsOrDefault(base.CircuitBreaker.CooldownSeconds, 30)
+	if c.Embedding != (config.RagEmbeddingConfig{}) {
+		embedder, err := newEmbeddingClient(mergeEmbeddingConfig(base.Embedding, c.Embedding), base.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		embedder.breaker = newCircuitBreaker("embedding:"+name, base.CircuitBreaker.FailureThreshold, cooldown)
+		m.embedder = embedder
+	}
+	vectorDB := base.VectorDB
+	vectorDB.Collection = c.Collection
+	if vectorDB.Collection == "" {
+		vectorDB.Collection = base.VectorDB.Collection + "_" + name
+	}
+	store, err := newQdrantClient(vectorDB, base.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	store.breaker = newCircuitBreaker("qdrant:"+name, base.CircuitBreaker.FailureThreshold, cooldown)
+	m.store = store
+	return m, nil
+}
+
+// fuseEnsemble searches the rag.ensemble collections like the vault's, whose
+// results are in results, and merges them by score times the weight of
+// their collection, keeping the best storeQuery.Limit. A collection that
+// cannot be searched is logged and left out.
+func (s *Service) fuseEnsemble(ctx context.Context, query string, b *backend, storeQuery StoreQuery, results []SearchResult) []SearchResult {
+	if len(s.ensemble) == 0 {
+		return results
+	}
+	vaultWeight := s.cfg.Ensemble.VaultWeight
+	if vaultWeight == 0 {
+		vaultWeight = 1
+	}
+	fused := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		r.Score *= vaultWeight
+		fused = append(fused, r)
+	}
+	// The default model's vector is the vault's own unless a language route
+	// embedded the query.
+	var defaultVector []float64
+	if b.language == "" {
+		defaultVector = storeQuery.Vector
+	}
+	for _, m := range s.ensemble {
+		var vector []float64
+		var err error
+		if m.embedder == nil {
+			if defaultVector == nil {
+				defaultVector, err = embedQuery(ctx, s.embedder, query)
+			}
+			vector = defaultVector
+		} else {
+			vector, err = embedQuery(ctx, m.embedder, query)
+		}
+		var found []SearchResult
+		if err == nil {
+			q := storeQuery
+			q.Vector = vector
+			found, err = m.store.Search(ctx, q)
+		}
+		if err != nil {
+			s.log.Warn("Ensemble collection search failed", map[string]interface{}{
+				"collection": m.name,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		for _, r := range found {
+			r.Namespace = m.name
+			r.Score *= m.weight
+			fused = append(fused, r)
+		}
+	}
+	sort.SliceStable(fused, func(a, b int) bool {
+		return fused[a].Score > fused[b].Score
+	})
+	if storeQuery.Limit > 0 && len(fused) > storeQuery.Limit {
+		fused = fused[:storeQuery.Limit]
+	}
+	return fused
+}
+
+func embedQuery(ctx context.Context, embedder Embedder, query string) ([]float64, error) {
+	embeddings, err := embedder.EmbedBatch(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return nil, fmt.Errorf("embedding returned empty vector")
+	}
+	return embeddings[0], nil
+}
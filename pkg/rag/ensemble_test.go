@@ -0,0 +1,95 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// resultStore returns its results for every search, or err.
+type resultStore struct {
+	VectorStore
+	results []SearchResult
+	err     error
+	limits  []int
+}
+
+func (s *resultStore) Collection() string { return "notes" }
+func (s *resultStore) Search(_ context.Context, q StoreQuery) ([]SearchResult, error) {
+	s.limits = append(s.limits, q.Limit)
+	return append([]SearchResult(nil), s.results...), s.err
+}
+
+func TestEnsembleFusion(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.TopK = 5
+	cfg.RAG.Ensemble.VaultWeight = 1
+	cfg.RAG.Ensemble.TopK = 3
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory", Weight: 0.5}}
+	vault := &resultStore{results: []SearchResult{
+		{ID: "v1", Path: "a.md", Score: 0.8},
+		{ID: "v2", Path: "b.md", Score: 0.6},
+	}}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ensemble) != 1 || s.ensemble[0].weight != 0.5 || s.ensemble[0].embedder != nil {
+		t.Fatalf("ensemble = %+v", s.ensemble)
+	}
+	memory := &resultStore{results: []SearchResult{
+		{ID: "m1", Path: "2024-05-01.md", Score: 0.9},
+		{ID: "m2", Path: "2024-05-02.md", Score: 0.7},
+	}}
+	s.ensemble[0].store = memory
+
+	results, err := s.Search(context.Background(), "what did we decide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Memory scores are halved: 0.8, 0.6, 0.45, 0.35, cut to the global
+	// top_k of 3.
+	var got []string
+	for _, r := range results {
+		got = append(got, r.ID)
+	}
+	if strings.Join(got, ",") != "v1,v2,m1" {
+		t.Errorf("fused results = %v, want v1,v2,m1", got)
+	}
+	if results[2].Namespace != "memory" || results[2].Score != 0.45 {
+		t.Errorf("memory result = %+v", results[2])
+	}
+	if src := FormatSource(results[2]); !strings.HasPrefix(src, "memory: 2024-05-01.md") {
+		t.Errorf("FormatSource() = %q, want the namespace first", src)
+	}
+	if vault.limits[0] != 3 || memory.limits[0] != 3 {
+		t.Errorf("store limits = %v and %v, want the global top_k", vault.limits, memory.limits)
+	}
+
+	// A failing collection leaves the vault's results.
+	memory.err = errors.New("collection not found")
+	results, err = s.Search(context.Background(), "what did we decide")
+	if err != nil || len(results) != 2 || results[0].Namespace != "" {
+		t.Errorf("Search() with a failing collection = %+v, %v", results, err)
+	}
+}
+
+func TestNewEnsembleValidates(t *testing.T) {
+	cfg := config.DefaultConfig().RAG
+	cfg.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory"}, {Name: "memory"}}
+	if _, err := newEnsemble(cfg); err == nil {
+		t.Error("duplicate names accepted")
+	}
+	cfg.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory", Weight: -1}}
+	if _, err := newEnsemble(cfg); err == nil {
+		t.Error("negative weight accepted")
+	}
+	cfg.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Collection: "x"}}
+	if _, err := newEnsemble(cfg); err == nil {
+		t.Error("collection without a name accepted")
+	}
+}
@@ -0,0 +1,229 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubToMarkdown converts an EPUB book into one markdown document: a
+// frontmatter with the book title and author, which end up in the payload of
+// every chunk, followed by the chapters in reading order. A chapter named in
+// the table of contents starts with that name as a heading unless its page
+// has its own <h1>, so chunks carry the chapter in their heading path.
+func epubToMarkdown(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	book := &epubBook{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		book.files[f.Name] = f
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := book.readXML("META-INF/container.xml", &container); err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("epub has no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg struct {
+		Titles   []string `xml:"metadata>title"`
+		Creators []string `xml:"metadata>creator"`
+		Items    []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"manifest>item"`
+		Spine struct {
+			Toc      string `xml:"toc,attr"`
+			ItemRefs []struct {
+				IDRef string `xml:"idref,attr"`
+			} `xml:"itemref"`
+		} `xml:"spine"`
+	}
+	if err := book.readXML(opfPath, &pkg); err != nil {
+		return "", err
+	}
+
+	hrefs := make(map[string]string)
+	for _, item := range pkg.Items {
+		name := epubResolve(opfPath, item.Href)
+		hrefs[item.ID] = name
+		switch {
+		case strings.Contains(" "+item.Properties+" ", " nav "):
+			book.readNav(name)
+		case item.ID == pkg.Spine.Toc || item.MediaType == "application/x-dtbncx+xml":
+			book.readNCX(name)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	if len(pkg.Titles) > 0 {
+		sb.WriteString("book: " + frontmatterValue(pkg.Titles[0]) + "\n")
+	}
+	if len(pkg.Creators) > 0 {
+		var authors []string
+		for _, c := range pkg.Creators {
+			authors = append(authors, frontmatterValue(c))
+		}
+		sb.WriteString("author: " + strings.Join(authors, ", ") + "\n")
+	}
+	sb.WriteString("---\n")
+	for _, ref := range pkg.Spine.ItemRefs {
+		name, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		page, err := book.read(name)
+		if err != nil {
+			return "", err
+		}
+		doc, err := html.Parse(bytes.NewReader(page))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		// Only the body: the <title> of a chapter page is often just the
+		// book title.
+		body := findElement(doc, atom.Body)
+		if body == nil {
+			continue
+		}
+		text := htmlDocToMarkdown(body, book.titles[name])
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		sb.WriteString("\n" + text)
+	}
+	return sb.String(), nil
+}
+
+// epubBook reads the files of an unpacked EPUB.
+type epubBook struct {
+	files map[string]*zip.File
+	// titles maps chapter files to their table of contents entry.
+	titles map[string]string
+}
+
+func (b *epubBook) read(name string) ([]byte, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return nil, fmt.Errorf("epub is missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (b *epubBook) readXML(name string, v any) error {
+	data, err := b.read(name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// addTitle records the first table of contents entry pointing into a file.
+func (b *epubBook) addTitle(tocPath, href, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if href == "" || title == "" {
+		return
+	}
+	if b.titles == nil {
+		b.titles = make(map[string]string)
+	}
+	name := epubResolve(tocPath, href)
+	if _, ok := b.titles[name]; !ok {
+		b.titles[name] = title
+	}
+}
+
+// readNCX reads the EPUB 2 table of contents. A missing or broken one only
+// costs the chapter headings.
+func (b *epubBook) readNCX(name string) {
+	type navPoint struct {
+		Label   string `xml:"navLabel>text"`
+		Content struct {
+			Src string `xml:"src,attr"`
+		} `xml:"content"`
+		Children []navPoint `xml:"navPoint"`
+	}
+	var ncx struct {
+		Points []navPoint `xml:"navMap>navPoint"`
+	}
+	if err := b.readXML(name, &ncx); err != nil {
+		return
+	}
+	var walk func(points []navPoint)
+	walk = func(points []navPoint) {
+		for _, p := range points {
+			b.addTitle(name, p.Content.Src, p.Label)
+			walk(p.Children)
+		}
+	}
+	walk(ncx.Points)
+}
+
+// readNav reads the EPUB 3 navigation document, the links of its first
+// <nav>.
+func (b *epubBook) readNav(name string) {
+	data, err := b.read(name)
+	if err != nil {
+		return
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	nav := findElement(doc, atom.Nav)
+	if nav == nil {
+		return
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			b.addTitle(name, htmlAttr(n, "href"), textContent(n))
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(nav)
+}
+
+// epubResolve resolves href, relative to the file at base, to a path inside
+// the archive.
+func epubResolve(base, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(path.Dir(base), href)
+}
+
+// frontmatterValue keeps a metadata value on one frontmatter line.
+func frontmatterValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
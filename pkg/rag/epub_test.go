@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildEPUB(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const testEPUBContainer = `<?xml version="1.0"?><container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`
+
+func TestEPUBToMarkdownWithNCX(t *testing.T) {
+	data := buildEPUB(t, map[string]string{
+		"META-INF/container.xml": testEPUBContainer,
+		"OEBPS/content.opf": `<?xml version="1.0"?><package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" version="2.0">
+<metadata><dc:title>Deep Work</dc:title><dc:creator>Cal Newport</dc:creator></metadata>
+<manifest><item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="c1" href="text/ch%201.xhtml" media-type="application/xhtml+xml"/>
+<item id="c1b" href="text/ch1b.xhtml" media-type="application/xhtml+xml"/>
+<item id="c2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine toc="ncx"><itemref idref="c1"/><itemref idref="c1b"/><itemref idref="c2"/></spine></package>`,
+		"OEBPS/toc.ncx": `<?xml version="1.0"?><ncx xmlns="http://www.daisy.org/z3986/2005/ncx/"><navMap>
+<navPoint><navLabel><text>Rule 1: Work Deeply</text></navLabel><content src="text/ch%201.xhtml#start"/>
+<navPoint><navLabel><text>Nested</text></navLabel><content src="text/ch2.xhtml"/></navPoint></navPoint></navMap></ncx>`,
+		"OEBPS/text/ch 1.xhtml": `<html><head><title>Deep Work</title></head><body><p>Schedule every minute.</p><h2>Rituals</h2><p>Decide where.</p></body></html>`,
+		"OEBPS/text/ch1b.xhtml": `<html><head><title>Deep Work</title></head><body><p>More of rule one.</p></body></html>`,
+		"OEBPS/text/ch2.xhtml":  `<html><body><h1>Rule 2</h1><p>Embrace boredom.</p></body></html>`,
+	})
+	got, err := epubToMarkdown(data)
+	if err != nil {
+		t.Fatalf("epubToMarkdown() error: %v", err)
+	}
+	want := "---\nbook: Deep Work\nauthor: Cal Newport\n---\n\n" +
+		"# Rule 1: Work Deeply\n\nSchedule every minute.\n\n## Rituals\n\nDecide where.\n\n" +
+		"More of rule one.\n\n" +
+		"# Rule 2\n\nEmbrace boredom.\n"
+	if got != want {
+		t.Errorf("epubToMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+
+	meta := parseFrontmatter(got)
+	if meta.Book != "Deep Work" || meta.Author != "Cal Newport" {
+		t.Errorf("frontmatter = %+v", meta)
+	}
+	c := newChunker(40, 0)
+	chunks := c.chunk("library/deep-work.epub", got)
+	if last := chunks[len(chunks)-1]; len(last.HeadingPath) == 0 || last.HeadingPath[0] != "Rule 2" {
+		t.Errorf("chunks should carry the chapter in their heading path: %+v", chunks)
+	}
+}
+
+func TestEPUBToMarkdownWithNav(t *testing.T) {
+	data := buildEPUB(t, map[string]string{
+		"META-INF/container.xml": testEPUBContainer,
+		"OEBPS/content.opf": `<?xml version="1.0"?><package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" version="3.0">
+<metadata><dc:title>Notes</dc:title></metadata>
+<manifest><item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="c1" href="c1.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="c1"/></spine></package>`,
+		"OEBPS/nav.xhtml": `<html><body><nav epub:type="toc"><ol><li><a href="c1.xhtml">Opening</a></li></ol></nav></body></html>`,
+		"OEBPS/c1.xhtml":  `<html><body><p>Hello.</p></body></html>`,
+	})
+	got, err := epubToMarkdown(data)
+	if err != nil {
+		t.Fatalf("epubToMarkdown() error: %v", err)
+	}
+	if want := "---\nbook: Notes\n---\n\n# Opening\n\nHello.\n"; got != want {
+		t.Errorf("epubToMarkdown() = %q, want %q", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.epub")
+	os.WriteFile(path, data, 0644)
+	if note, err := readNote(path, nil); err != nil || string(note) != got {
+		t.Errorf("readNote() = %q, %v", note, err)
+	}
+	os.WriteFile(path, []byte("not a zip"), 0644)
+	if _, err := readNote(path, nil); err == nil {
+		t.Error("readNote() of a broken epub succeeded")
+	}
+}
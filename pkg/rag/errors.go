@@ -0,0 +1,153 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDisabled          = errors.New("rag is disabled")
+	ErrVaultNotFound     = errors.New("vault path not found")
+	ErrIndexNotBuilt     = errors.New("index has not been built")
+	ErrIndexOutdated     = errors.New("index was built by an older chunker, run a full index")
+	ErrCollectionMissing = errors.New("vector collection does not exist")
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+	ErrBudgetExceeded    = errors.New("retrieval latency budget exceeded")
+	ErrInvalidPageToken  = errors.New("invalid page token")
+	ErrUnknownPreset     = errors.New("unknown rag preset")
+	// ErrIndexBusy is returned by on-demand reindexing during searches while
+	// an index run holds the index; that run picks the files up anyway.
+	ErrIndexBusy = errors.New("an index run is in progress")
+	// ErrIncompatibleIndex is returned when a collection's stored metadata
+	// shows it was built for another vault or embedding model.
+	ErrIncompatibleIndex = errors.New("collection was built by an incompatible index")
+	// ErrUnavailable matches any UnavailableError via errors.Is.
+	ErrUnavailable = errors.New("rag backend unavailable")
+	// ErrNotPermitted is returned by Authorize for callers that are not
+	// listed in rag.guardrails.admins.
+	ErrNotPermitted = errors.New("not permitted")
+	// ErrConfirmationRequired matches any ConfirmationError via errors.Is.
+	ErrConfirmationRequired = errors.New("confirmation required")
+	// ErrNotLocal is returned by NewService under rag.local_only for an
+	// endpoint outside this machine and the local network.
+	ErrNotLocal = errors.New("endpoint is not on this machine or the local network, as rag.local_only requires")
+	// ErrMassDelete matches any MassDeleteError via errors.Is.
+	ErrMassDelete = errors.New("too many indexed notes are missing from the vault")
+	// ErrNotInTrash is returned by UndoDelete for a note without points in
+	// the trash of rag.trash.
+	ErrNotInTrash = errors.New("no deleted points in the trash")
+)
+
+// ProviderError is a non-success HTTP response from the embedding API or the
+// vector store.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error: %d %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// RateLimitError is a ProviderError for HTTP 429 responses. RetryAfter is
+// taken from the Retry-After header when present.
+type RateLimitError struct {
+	ProviderError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s rate limited, retry in %s", e.Provider, e.RetryAfter)
+	}
+	return fmt.Sprintf("%s rate limited", e.Provider)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return &e.ProviderError
+}
+
+func newProviderError(provider string, resp *http.Response, body []byte) error {
+	perr := ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return &perr
+	}
+	rl := &RateLimitError{ProviderError: perr}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		rl.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return rl
+}
+
+// UnavailableError is returned without contacting the backend while its
+// circuit breaker is open.
+type UnavailableError struct {
+	Backend    string
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s unavailable, retry in %s", e.Backend, e.RetryAfter.Truncate(time.Second))
+	}
+	return fmt.Sprintf("%s unavailable", e.Backend)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// ConfirmationError is returned by Authorize when a destructive operation
+// needs to be confirmed by repeating the request with Token before Expires.
+type ConfirmationError struct {
+	Operation Operation
+	Token     string
+	Expires   time.Time
+}
+
+func (e *ConfirmationError) Error() string {
+	return fmt.Sprintf("%s needs confirmation with token %s", e.Operation, e.Token)
+}
+
+func (e *ConfirmationError) Is(target error) bool {
+	return target == ErrConfirmationRequired
+}
+
+// MassDeleteError stops an index run that would remove more than
+// rag.safety.max_removed_fraction of the indexed notes; nothing is removed.
+// Run again with IndexOptions.AllowMassDelete when the notes are gone on
+// purpose.
+type MassDeleteError struct {
+	Missing int
+	Indexed int
+	// Unmounted lists the vault folders that were on an encrypted or FUSE
+	// mount at the last index run and are not now, with the mount type.
+	Unmounted []string
+	// Empty lists the vault folders that are empty, as the mount point of
+	// an unmounted volume is.
+	Empty []string
+}
+
+func (e *MassDeleteError) Error() string {
+	msg := fmt.Sprintf("%d of %d indexed notes are missing from the vault, more than rag.safety.max_removed_fraction; not removing them", e.Missing, e.Indexed)
+	if len(e.Unmounted) > 0 {
+		msg += "; not mounted any more: " + strings.Join(e.Unmounted, ", ")
+	}
+	if len(e.Empty) > 0 {
+		msg += "; empty: " + strings.Join(e.Empty, ", ")
+	}
+	return msg
+}
+
+func (e *MassDeleteError) Is(target error) bool {
+	return target == ErrMassDelete
+}
@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestProviderErrors(t *testing.T) {
+	status, retryAfter := http.StatusTooManyRequests, "7"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, "slow down", status)
+	}))
+	defer server.Close()
+	client, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: server.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.EmbedBatch(context.Background(), []string{"hello"})
+	var rateLimit *RateLimitError
+	if !errors.As(err, &rateLimit) || rateLimit.RetryAfter.Seconds() != 7 {
+		t.Fatalf("EmbedBatch() error = %v, want a RateLimitError with Retry-After", err)
+	}
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != 429 || providerErr.Provider != "embedding" || providerErr.Body != "slow down" {
+		t.Errorf("rate limit does not unwrap to its ProviderError: %+v", providerErr)
+	}
+
+	status, retryAfter = http.StatusUnauthorized, ""
+	_, err = client.EmbedBatch(context.Background(), []string{"hello"})
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != 401 || errors.As(err, &rateLimit) {
+		t.Errorf("EmbedBatch() error = %v, want a plain ProviderError", err)
+	}
+
+	status = http.StatusNotFound
+	store, err := NewQdrantClient(config.RagVectorDBConfig{URL: server.URL, Collection: "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.doRequest(context.Background(), "GET", "/collections/notes", nil, nil)
+	if !errors.Is(err, ErrCollectionMissing) || !errors.As(err, &providerErr) || providerErr.Provider != "qdrant" {
+		t.Errorf("doRequest() error = %v, want ErrCollectionMissing wrapping a ProviderError", err)
+	}
+}
+
+func TestUnavailableErrorIs(t *testing.T) {
+	err := error(&UnavailableError{Backend: "qdrant"})
+	if !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrCollectionMissing) {
+		t.Errorf("errors.Is(%v) does not match ErrUnavailable alone", err)
+	}
+}
@@ -0,0 +1,144 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// EvalCase is a query and the notes a good retrieval should return for it.
+type EvalCase struct {
+	Query string   `json:"query"`
+	Paths []string `json:"paths"`
+}
+
+// EvalMetrics scores retrieval over a set of EvalCase.
+type EvalMetrics struct {
+	Cases int
+	K     int
+	// RecallAtK is the share of cases with an expected note in the top K.
+	RecallAtK float64
+	// MRR is the mean reciprocal rank of the first expected note.
+	MRR float64
+}
+
+// LoadEvalSet reads eval cases from a JSON array or from JSON lines.
+func LoadEvalSet(path string) ([]EvalCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	var cases []EvalCase
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &cases); err != nil {
+			return nil, fmt.Errorf("failed to parse eval set: %w", err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var c EvalCase
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				return nil, fmt.Errorf("failed to parse eval set line %d: %w", line, err)
+			}
+			cases = append(cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for idx, c := range cases {
+		if strings.TrimSpace(c.Query) == "" || len(c.Paths) == 0 {
+			return nil, fmt.Errorf("eval case %d needs a query and at least one path", idx+1)
+		}
+	}
+	return cases, nil
+}
+
+// scoreRankings computes metrics for rankings, the retrieved note paths for
+// each case in order.
+func scoreRankings(cases []EvalCase, rankings [][]string, k int) EvalMetrics {
+	m := EvalMetrics{Cases: len(cases), K: k}
+	if len(cases) == 0 {
+		return m
+	}
+	for idx, c := range cases {
+		expected := make(map[string]bool, len(c.Paths))
+		for _, p := range c.Paths {
+			expected[p] = true
+		}
+		for rank, path := range rankings[idx] {
+			if !expected[path] {
+				continue
+			}
+			if rank < k {
+				m.RecallAtK++
+			}
+			m.MRR += 1 / float64(rank+1)
+			break
+		}
+	}
+	m.RecallAtK /= float64(len(cases))
+	m.MRR /= float64(len(cases))
+	return m
+}
+
+// evalQueryFromNote derives a query from a note body: its middle sentence of
+// reasonable length, cut to about twenty words. Headings and frontmatter are
+// skipped, so the query does not simply repeat the note's title.
+func evalQueryFromNote(text string) (string, bool) {
+	lines := strings.Split(text, "\n")
+	if meta := parseFrontmatter(text); meta.EndLine > 0 {
+		lines = lines[meta.EndLine:]
+	}
+	var sentences []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "```") {
+			continue
+		}
+		line = strings.TrimLeft(line, "-*> ")
+		for _, s := range splitSentences(line) {
+			if len(strings.Fields(s)) >= 6 || (utf8.RuneCountInString(s) >= 15 && !strings.Contains(s, " ")) {
+				sentences = append(sentences, s)
+			}
+		}
+	}
+	if len(sentences) == 0 {
+		return "", false
+	}
+	query := sentences[len(sentences)/2]
+	if words := strings.Fields(query); len(words) > 20 {
+		query = strings.Join(words[:20], " ")
+	} else if len(words) == 1 && utf8.RuneCountInString(query) > 40 {
+		query = string([]rune(query)[:40])
+	}
+	return query, true
+}
+
+func splitSentences(line string) []string {
+	var out []string
+	start := 0
+	for idx, r := range line {
+		switch r {
+		case '.', '?', '!', '。', '？', '！':
+			if s := strings.TrimSpace(line[start:idx]); s != "" {
+				out = append(out, s)
+			}
+			start = idx + utf8.RuneLen(r)
+		}
+	}
+	if s := strings.TrimSpace(line[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package rag
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScoreRankings(t *testing.T) {
+	cases := []EvalCase{
+		{Query: "a", Paths: []string{"a.md"}},
+		{Query: "b", Paths: []string{"b.md"}},
+		{Query: "c", Paths: []string{"c.md"}},
+	}
+	rankings := [][]string{
+		{"a.md", "x.md"},
+		{"x.md", "y.md", "b.md"},
+		{"x.md"},
+	}
+	m := scoreRankings(cases, rankings, 2)
+	if math.Abs(m.RecallAtK-1.0/3) > 1e-9 {
+		t.Errorf("RecallAtK = %v, want 1/3", m.RecallAtK)
+	}
+	if want := (1 + 1.0/3) / 3; math.Abs(m.MRR-want) > 1e-9 {
+		t.Errorf("MRR = %v, want %v", m.MRR, want)
+	}
+}
+
+func TestLoadEvalSet(t *testing.T) {
+	dir := t.TempDir()
+	lines := filepath.Join(dir, "eval.jsonl")
+	os.WriteFile(lines, []byte(`{"query":"q1","paths":["a.md"]}`+"\n\n"+`{"query":"q2","paths":["b.md","c.md"]}`+"\n"), 0o644)
+	cases, err := LoadEvalSet(lines)
+	if err != nil {
+		t.Fatalf("LoadEvalSet(jsonl) error: %v", err)
+	}
+	if len(cases) != 2 || cases[1].Paths[1] != "c.md" {
+		t.Errorf("unexpected cases: %+v", cases)
+	}
+
+	array := filepath.Join(dir, "eval.json")
+	os.WriteFile(array, []byte(`[{"query":"q","paths":[]}]`), 0o644)
+	if _, err := LoadEvalSet(array); err == nil {
+		t.Error("expected an error for a case without paths")
+	}
+}
+
+func TestEvalQueryFromNote(t *testing.T) {
+	note := "---\ntitle: Fluids\n---\n# Sepsis\n\nShort.\nGive a thirty ml per kg crystalloid bolus within three hours. Reassess often.\n"
+	got, ok := evalQueryFromNote(note)
+	if !ok || got != "Give a thirty ml per kg crystalloid bolus within three hours" {
+		t.Errorf("evalQueryFromNote() = %q, %v", got, ok)
+	}
+	if _, ok := evalQueryFromNote("# Only a heading\n"); ok {
+		t.Error("a note without sentences should yield no query")
+	}
+}
@@ -0,0 +1,233 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// feedbackFile keeps the marks of rag.feedback, by document ID, or by path
+// for notes indexed before document IDs were stored.
+const feedbackFile = "feedback.json"
+
+// feedbackMark sums the marks given to one note.
+type feedbackMark struct {
+	// Path is where the note was when it was last marked.
+	Path string `json:"path"`
+	Good int    `json:"good"`
+	Bad  int    `json:"bad"`
+	// Score is the net of the marks, each faded by the half-life, as of
+	// Updated.
+	Score   float64   `json:"score"`
+	Updated time.Time `json:"updated"`
+}
+
+// FeedbackWeight is what rag.feedback learned about one note.
+type FeedbackWeight struct {
+	Path  string
+	DocID string
+	Good  int
+	Bad   int
+	// Score is the net of the marks, faded to now.
+	Score float64
+	// Boost is added to the scores of the note's results.
+	Boost   float64
+	Updated time.Time
+}
+
+// fadedScore is the score of m at now, halved for every halfLife since it
+// was last updated.
+func fadedScore(m feedbackMark, halfLife time.Duration, now time.Time) float64 {
+	age := now.Sub(m.Updated)
+	if halfLife <= 0 || age <= 0 {
+		return m.Score
+	}
+	return m.Score * math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// feedbackBoost turns a score into a boost that approaches maxBoost as the
+// score grows, so no amount of marks lets a note outrank much better
+// matches. A single mark gives half of it.
+func feedbackBoost(score, maxBoost float64) float64 {
+	return maxBoost * score / (math.Abs(score) + 1)
+}
+
+func (s *Service) feedbackHalfLife() time.Duration {
+	return time.Duration(s.cfg.Feedback.HalfLifeDays) * 24 * time.Hour
+}
+
+func (s *Service) loadFeedback() (map[string]feedbackMark, error) {
+	marks := map[string]feedbackMark{}
+	data, err := s.storage.ReadFile(feedbackFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return marks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", feedbackFile, err)
+	}
+	return marks, nil
+}
+
+func (s *Service) saveFeedback(marks map[string]feedbackMark) error {
+	data, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.storage.WriteFile(feedbackFile, data)
+}
+
+// RecordFeedback marks the notes of results as good or bad, once per note,
+// and returns how many notes were marked. Pinned notes are left out, since
+// their place in the context does not depend on ranking.
+func (s *Service) RecordFeedback(results []SearchResult, good bool) (int, error) {
+	if !s.cfg.Feedback.Enabled {
+		return 0, fmt.Errorf("feedback is off; set rag.feedback.enabled to true")
+	}
+	s.feedbackMu.Lock()
+	defer s.feedbackMu.Unlock()
+	marks, err := s.loadFeedback()
+	if err != nil {
+		return 0, err
+	}
+	byID, _ := s.docPaths()
+	ids := make(map[string]string, len(byID))
+	for id, p := range byID {
+		ids[p] = id
+	}
+	now := s.now()
+	seen := make(map[string]bool)
+	for _, r := range results {
+		key := r.DocID
+		if key == "" {
+			key = ids[r.Path]
+		}
+		if key == "" {
+			key = r.Path
+		}
+		if r.Pinned || r.Path == "" || r.Namespace != "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		m := marks[key]
+		m.Score = fadedScore(m, s.feedbackHalfLife(), now)
+		if good {
+			m.Good++
+			m.Score++
+		} else {
+			m.Bad++
+			m.Score--
+		}
+		m.Path, m.Updated = r.Path, now
+		marks[key] = m
+	}
+	if len(seen) == 0 {
+		return 0, nil
+	}
+	if err := s.saveFeedback(marks); err != nil {
+		return 0, err
+	}
+	return len(seen), nil
+}
+
+// FeedbackWeights lists the notes rag.feedback has marks for, under their
+// current paths, the largest boosts and penalties first.
+func (s *Service) FeedbackWeights() ([]FeedbackWeight, error) {
+	marks, err := s.loadFeedback()
+	if err != nil {
+		return nil, err
+	}
+	byID, _ := s.docPaths()
+	now := s.now()
+	weights := make([]FeedbackWeight, 0, len(marks))
+	for key, m := range marks {
+		w := FeedbackWeight{Path: m.Path, Good: m.Good, Bad: m.Bad, Updated: m.Updated}
+		if p, ok := byID[key]; ok {
+			w.Path, w.DocID = p, key
+		}
+		w.Score = fadedScore(m, s.feedbackHalfLife(), now)
+		w.Boost = feedbackBoost(w.Score, s.cfg.Feedback.MaxBoost)
+		weights = append(weights, w)
+	}
+	sort.Slice(weights, func(a, b int) bool {
+		if math.Abs(weights[a].Boost) != math.Abs(weights[b].Boost) {
+			return math.Abs(weights[a].Boost) > math.Abs(weights[b].Boost)
+		}
+		return weights[a].Path < weights[b].Path
+	})
+	return weights, nil
+}
+
+// ResetFeedback forgets the marks of the note at path, or of every note when
+// path is empty, and returns how many notes had marks.
+func (s *Service) ResetFeedback(path string) (int, error) {
+	s.feedbackMu.Lock()
+	defer s.feedbackMu.Unlock()
+	marks, err := s.loadFeedback()
+	if err != nil {
+		return 0, err
+	}
+	byID, _ := s.docPaths()
+	removed := 0
+	for key, m := range marks {
+		if path == "" || m.Path == path || byID[key] == path {
+			delete(marks, key)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.saveFeedback(marks)
+}
+
+// applyFeedback adds the learned boost of each result's note to its score
+// and ranks the results again. Failures are logged and leave the ranking
+// as it is.
+func (s *Service) applyFeedback(results []SearchResult) []SearchResult {
+	if !s.cfg.Feedback.Enabled || len(results) == 0 {
+		return results
+	}
+	marks, err := s.loadFeedback()
+	if err != nil {
+		s.log.Warn("Failed to read the feedback marks", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return results
+	}
+	if len(marks) == 0 {
+		return results
+	}
+	byPath := make(map[string]feedbackMark, len(marks))
+	for _, m := range marks {
+		byPath[m.Path] = m
+	}
+	now := s.now()
+	boosted := false
+	for idx, r := range results {
+		if r.Namespace != "" {
+			continue
+		}
+		m, ok := marks[r.DocID]
+		if !ok || r.DocID == "" {
+			m, ok = byPath[r.Path]
+		}
+		if !ok {
+			continue
+		}
+		results[idx].Score += feedbackBoost(fadedScore(m, s.feedbackHalfLife(), now), s.cfg.Feedback.MaxBoost)
+		boosted = true
+	}
+	if boosted {
+		sort.SliceStable(results, func(a, b int) bool {
+			return results[a].Score > results[b].Score
+		})
+	}
+	return results
+}
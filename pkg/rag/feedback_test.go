@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFeedbackBoosts(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.SetStorage(NewMemoryStorage())
+	s.cfg.Feedback.Enabled = true
+	s.cfg.Feedback.MaxBoost = 0.1
+	s.cfg.Feedback.HalfLifeDays = 10
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// Two chunks of a.md count as one mark.
+	if n, err := s.RecordFeedback([]SearchResult{{Path: "a.md"}, {Path: "a.md"}, {Path: "p.md", Pinned: true}}, true); err != nil || n != 1 {
+		t.Fatalf("RecordFeedback() = %d, %v", n, err)
+	}
+	s.RecordFeedback([]SearchResult{{Path: "b.md", DocID: "doc-b"}}, false)
+
+	results := s.applyFeedback([]SearchResult{
+		{Path: "b.md", DocID: "doc-b", Score: 0.80},
+		{Path: "c.md", Score: 0.78},
+		{Path: "a.md", Score: 0.74},
+	})
+	want := []string{"a.md", "c.md", "b.md"}
+	for idx, r := range results {
+		if r.Path != want[idx] {
+			t.Fatalf("ranking = %+v, want %v", results, want)
+		}
+	}
+	if math.Abs(results[0].Score-0.79) > 1e-9 || math.Abs(results[2].Score-0.75) > 1e-9 {
+		t.Errorf("boosted scores = %v, %v", results[0].Score, results[2].Score)
+	}
+
+	// Marks fade with the half-life.
+	now = now.Add(10 * 24 * time.Hour)
+	weights, err := s.FeedbackWeights()
+	if err != nil || len(weights) != 2 {
+		t.Fatalf("FeedbackWeights() = %+v, %v", weights, err)
+	}
+	if w := weights[0]; math.Abs(w.Score-0.5) > 1e-9 || math.Abs(w.Boost-0.1/3) > 1e-9 || w.Good != 1 {
+		t.Errorf("faded weight = %+v", w)
+	}
+
+	if n, err := s.ResetFeedback("a.md"); err != nil || n != 1 {
+		t.Errorf("ResetFeedback(a.md) = %d, %v", n, err)
+	}
+	if n, _ := s.ResetFeedback(""); n != 1 {
+		t.Errorf("ResetFeedback() removed %d", n)
+	}
+	s.cfg.Feedback.Enabled = false
+	if _, err := s.RecordFeedback([]SearchResult{{Path: "a.md"}}, true); err == nil {
+		t.Error("RecordFeedback() with feedback off succeeded")
+	}
+}
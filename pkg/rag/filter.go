@@ -0,0 +1,235 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchFilter restricts retrieval to a subset of chunks. The zero value
+// matches everything.
+type SearchFilter struct {
+	// UnderHeading keeps chunks that sit anywhere below a heading with this
+	// exact title, at any depth.
+	UnderHeading string
+	// Tags keeps chunks of notes whose frontmatter lists every one of these
+	// tags.
+	Tags []string
+	// Dates keeps chunks of notes dated within the range, taken from the
+	// frontmatter date or the daily-note file name.
+	Dates DateRange
+	// Book keeps chunks of the book with this exact title, taken from the
+	// frontmatter book field that converted EPUB files carry.
+	Book string
+	// Paths keeps chunks of these notes only.
+	Paths []string
+	// ExcludePaths drops chunks of notes matching any of these glob
+	// patterns, e.g. "archive/**".
+	ExcludePaths []string
+	// ExcludeTags drops chunks of notes tagged with any of these tags.
+	ExcludeTags []string
+	// Preset names the rag.presets entry whose settings and filters apply
+	// to the search.
+	Preset string
+
+	// excludedNotes are the vault notes ExcludePaths matched, set by
+	// Service.applyInlineFilter since the vector store cannot match globs.
+	excludedNotes []string
+}
+
+// IsZero reports whether the filter matches every chunk.
+func (f SearchFilter) IsZero() bool {
+	return f.UnderHeading == "" && len(f.Tags) == 0 && f.Dates.IsZero() && f.Book == "" && len(f.Paths) == 0 &&
+		len(f.ExcludePaths) == 0 && len(f.ExcludeTags) == 0 && f.Preset == ""
+}
+
+// merge returns f with any unset field taken from other. Tags and exclusions
+// from both filters are combined.
+func (f SearchFilter) merge(other SearchFilter) SearchFilter {
+	if f.UnderHeading == "" {
+		f.UnderHeading = other.UnderHeading
+	}
+	if f.Dates.IsZero() {
+		f.Dates = other.Dates
+	}
+	if f.Book == "" {
+		f.Book = other.Book
+	}
+	if len(f.Paths) == 0 {
+		f.Paths = other.Paths
+	}
+	if f.Preset == "" {
+		f.Preset = other.Preset
+	}
+	if len(other.Tags) > 0 {
+		f.Tags = append(append([]string(nil), f.Tags...), other.Tags...)
+	}
+	if len(other.ExcludePaths) > 0 {
+		f.ExcludePaths = append(append([]string(nil), f.ExcludePaths...), other.ExcludePaths...)
+	}
+	if len(other.ExcludeTags) > 0 {
+		f.ExcludeTags = append(append([]string(nil), f.ExcludeTags...), other.ExcludeTags...)
+	}
+	return f
+}
+
+// key renders the filter as a string that differs whenever the filter does.
+func (f SearchFilter) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%d-%d\x00%s\x00%s\x00-%s\x00-%s\x00@%s", f.UnderHeading, strings.Join(f.Tags, "\x00"), f.Dates.From.Unix(), f.Dates.To.Unix(), f.Book, strings.Join(f.Paths, "\x00"),
+		strings.Join(f.ExcludePaths, "\x00"), strings.Join(f.ExcludeTags, "\x00"), f.Preset)
+}
+
+// qdrantFilter renders the filter as a Qdrant filter clause, or nil when the
+// filter is empty. heading_path is stored as an array, and a match on an array
+// field succeeds when any element matches.
+func (f SearchFilter) qdrantFilter() map[string]interface{} {
+	var must, mustNot []map[string]interface{}
+	if f.UnderHeading != "" {
+		must = append(must, map[string]interface{}{
+			"key":   "heading_path",
+			"match": map[string]interface{}{"value": f.UnderHeading},
+		})
+	}
+	for _, tag := range f.Tags {
+		must = append(must, map[string]interface{}{
+			"key":   "tags",
+			"match": map[string]interface{}{"value": tag},
+		})
+	}
+	if f.Book != "" {
+		must = append(must, map[string]interface{}{
+			"key":   "book",
+			"match": map[string]interface{}{"value": f.Book},
+		})
+	}
+	if len(f.Paths) > 0 {
+		must = append(must, map[string]interface{}{
+			"key":   "path",
+			"match": map[string]interface{}{"any": f.Paths},
+		})
+	}
+	if !f.Dates.IsZero() {
+		dateRange := map[string]interface{}{}
+		if !f.Dates.From.IsZero() {
+			dateRange["gte"] = f.Dates.From.Unix()
+		}
+		if !f.Dates.To.IsZero() {
+			dateRange["lt"] = f.Dates.To.Unix()
+		}
+		must = append(must, map[string]interface{}{
+			"key":   "note_date",
+			"range": dateRange,
+		})
+	}
+	if len(f.ExcludeTags) > 0 {
+		mustNot = append(mustNot, map[string]interface{}{
+			"key":   "tags",
+			"match": map[string]interface{}{"any": f.ExcludeTags},
+		})
+	}
+	if len(f.excludedNotes) > 0 {
+		mustNot = append(mustNot, map[string]interface{}{
+			"key":   "path",
+			"match": map[string]interface{}{"any": f.excludedNotes},
+		})
+	}
+	if len(must) == 0 && len(mustNot) == 0 {
+		return nil
+	}
+	filter := map[string]interface{}{}
+	if len(must) > 0 {
+		filter["must"] = must
+	}
+	if len(mustNot) > 0 {
+		filter["must_not"] = mustNot
+	}
+	return filter
+}
+
+// parseSearchFilter extracts inline filter terms from a query, e.g.
+// `heading:API rate limits`, `heading:"Getting started" install` or
+// `tag:projectX status` or `book:"Deep Work" focus`. `-path:archive/**` and
+// `-tag:meeting` exclude notes instead. The returned query has the filter
+// terms removed.
+func parseSearchFilter(query string) (string, SearchFilter) {
+	var filter SearchFilter
+	var rest []string
+	remaining := strings.TrimSpace(query)
+	for remaining != "" {
+		token, value, tail := nextQueryToken(remaining)
+		remaining = strings.TrimSpace(tail)
+		key, arg, ok := strings.Cut(value, ":")
+		if ok && arg != "" {
+			switch strings.ToLower(key) {
+			case "heading":
+				filter.UnderHeading = strings.Trim(arg, `"`)
+				continue
+			case "tag":
+				filter.Tags = append(filter.Tags, strings.TrimPrefix(strings.Trim(arg, `"`), "#"))
+				continue
+			case "book":
+				filter.Book = strings.Trim(arg, `"`)
+				continue
+			case "-path":
+				filter.ExcludePaths = append(filter.ExcludePaths, strings.Trim(arg, `"`))
+				continue
+			case "-tag":
+				filter.ExcludeTags = append(filter.ExcludeTags, strings.TrimPrefix(strings.Trim(arg, `"`), "#"))
+				continue
+			}
+		}
+		rest = append(rest, token)
+	}
+	return strings.Join(rest, " "), filter
+}
+
+// nextQueryToken returns the next whitespace-separated token, keeping a
+// double-quoted value after "key:" together. value is the token with the
+// quotes removed from the value part.
+func nextQueryToken(s string) (token, value, rest string) {
+	end := strings.IndexFunc(s, isQuerySpace)
+	if end < 0 {
+		end = len(s)
+	}
+	if colon := strings.Index(s[:end], `:"`); colon >= 0 {
+		if closing := strings.Index(s[colon+2:], `"`); closing >= 0 {
+			end = colon + 2 + closing + 1
+			token = s[:end]
+			return token, s[:colon+1] + s[colon+2:end-1], s[end:]
+		}
+	}
+	return s[:end], s[:end], s[end:]
+}
+
+func isQuerySpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+// applyInlineFilter removes the inline filter terms from query, merges them
+// and the filters of filter.Preset into filter, and resolves
+// filter.ExcludePaths against the vault.
+func (s *Service) applyInlineFilter(query string, filter SearchFilter) (string, SearchFilter) {
+	query, inline := parseSearchFilter(query)
+	filter = s.presetFilter(filter.merge(inline))
+	if len(filter.ExcludePaths) == 0 {
+		return query, filter
+	}
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return query, filter
+	}
+	files, err := v.list(s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+	if err != nil {
+		s.log.Warn("Failed to list notes for -path exclusions", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return query, filter
+	}
+	patterns := compilePatterns(filter.ExcludePaths)
+	filter.excludedNotes = nil
+	for _, f := range files {
+		if matchesAny(f.RelPath, patterns) {
+			filter.excludedNotes = append(filter.excludedNotes, f.RelPath)
+		}
+	}
+	return query, filter
+}
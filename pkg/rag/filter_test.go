@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		heading string
+	}{
+		{"rate limits", "rate limits", ""},
+		{"heading:API rate limits", "rate limits", "API"},
+		{`install heading:"Getting started" steps`, "install steps", "Getting started"},
+		{"HEADING:Setup", "", "Setup"},
+		{"heading: alone", "heading: alone", ""},
+		{"see https://example.com", "see https://example.com", ""},
+		{"tag:projectX status", "status", ""},
+	}
+	for _, tt := range tests {
+		got, filter := parseSearchFilter(tt.query)
+		if got != tt.want || filter.UnderHeading != tt.heading {
+			t.Errorf("parseSearchFilter(%q) = %q, %q; want %q, %q", tt.query, got, filter.UnderHeading, tt.want, tt.heading)
+		}
+	}
+}
+
+func TestSearchFilterQdrant(t *testing.T) {
+	if (SearchFilter{}).qdrantFilter() != nil {
+		t.Error("empty filter should render as nil")
+	}
+	f := SearchFilter{UnderHeading: "API", Tags: []string{"projectX"}, Book: "Deep Work"}.qdrantFilter()
+	must, ok := f["must"].([]map[string]interface{})
+	if !ok || len(must) != 3 || must[0]["key"] != "heading_path" || must[1]["key"] != "tags" || must[2]["key"] != "book" {
+		t.Errorf("unexpected filter: %#v", f)
+	}
+}
+
+func TestParseSearchFilterBook(t *testing.T) {
+	got, filter := parseSearchFilter(`book:"Deep Work" what about email`)
+	if got != "what about email" || filter.Book != "Deep Work" {
+		t.Errorf("parseSearchFilter() = %q, %+v", got, filter)
+	}
+}
+
+func TestParseSearchFilterExclusions(t *testing.T) {
+	got, filter := parseSearchFilter(`standup notes -path:archive/** -tag:#meeting -path:"old stuff/*"`)
+	if got != "standup notes" || strings.Join(filter.ExcludePaths, "|") != "archive/**|old stuff/*" || strings.Join(filter.ExcludeTags, "|") != "meeting" {
+		t.Errorf("parseSearchFilter() = %q, %+v", got, filter)
+	}
+	if filter.IsZero() {
+		t.Error("a filter with exclusions should not be zero")
+	}
+}
+
+func TestSearchFilterQdrantExclusions(t *testing.T) {
+	f := SearchFilter{Tags: []string{"work"}, ExcludeTags: []string{"meeting"}, excludedNotes: []string{"archive/a.md"}}
+	data, _ := json.Marshal(documentsFilter(f.qdrantFilter(), false))
+	want := `{"must":[{"key":"tags","match":{"value":"work"}}],"must_not":[{"key":"tags","match":{"any":["meeting"]}},{"key":"path","match":{"any":["archive/a.md"]}},{"key":"document","match":{"value":true}}]}`
+	if string(data) != want {
+		t.Errorf("filter = %s", data)
+	}
+}
+
+func TestApplyInlineFilterResolvesExcludedPaths(t *testing.T) {
+	vault := t.TempDir()
+	for _, name := range []string{"archive/2023/a.md", "archive/b.md", "notes/c.md"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(vault, name)), 0o755)
+		os.WriteFile(filepath.Join(vault, name), []byte("text"), 0o644)
+	}
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	query, filter := s.applyInlineFilter("plans -path:archive/**", SearchFilter{Tags: []string{"work"}})
+	if query != "plans" || strings.Join(filter.Tags, ",") != "work" {
+		t.Errorf("applyInlineFilter() = %q, %+v", query, filter)
+	}
+	if got := strings.Join(filter.excludedNotes, ","); got != "archive/2023/a.md,archive/b.md" {
+		t.Errorf("excludedNotes = %q", got)
+	}
+}
@@ -0,0 +1,160 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// followUpCandidates is how many unused chunks the follow-up questions
+	// are written from.
+	followUpCandidates = 6
+	// followUpExcerptChars caps the text of each of them in the prompt.
+	followUpExcerptChars = 600
+)
+
+// SuggestFollowUps has summarize write up to rag.follow_ups.count questions
+// the user could ask next, grounded in chunks that matched question but did
+// not make it into the answer: those of retrieved missing from used, then,
+// if too few, the next best matches of a deeper search. It returns nil when
+// there is nothing left below the cut.
+func (s *Service) SuggestFollowUps(ctx context.Context, question string, retrieved, used []SearchResult, summarize Summarizer) ([]string, error) {
+	count := s.cfg.FollowUps.Count
+	if count <= 0 {
+		count = 3
+	}
+	candidates, err := s.belowCut(ctx, question, retrieved, used)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	summarize = s.auditSummarizer("rag:follow_ups", summarize)
+	reply, err := summarize(ctx, followUpPrompt(question, candidates, count))
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest follow-up questions: %w", err)
+	}
+	return parseFollowUps(reply, count), nil
+}
+
+// belowCut returns up to followUpCandidates chunks that matched question but
+// are not in used, best first. Pinned notes and summaries are left out, as
+// they are not about a part of the vault the user could ask after.
+func (s *Service) belowCut(ctx context.Context, question string, retrieved, used []SearchResult) ([]SearchResult, error) {
+	seen := make(map[string]bool, len(used))
+	for _, r := range used {
+		seen[followUpKey(r)] = true
+	}
+	var candidates []SearchResult
+	take := func(results []SearchResult) {
+		for _, r := range results {
+			key := followUpKey(r)
+			if len(candidates) == followUpCandidates || seen[key] || r.Pinned || r.SummaryLevel > 0 || strings.TrimSpace(r.Content) == "" {
+				continue
+			}
+			seen[key] = true
+			candidates = append(candidates, r)
+		}
+	}
+	take(retrieved)
+	if len(candidates) == followUpCandidates {
+		return candidates, nil
+	}
+
+	query, filter := s.applyInlineFilter(question, SearchFilter{})
+	if query == "" {
+		return candidates, nil
+	}
+	params, err := s.searchParams(filter.Preset)
+	if err != nil {
+		return nil, err
+	}
+	b := s.backendFor(query)
+	embeddings, err := b.embedder.EmbedBatch(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return nil, fmt.Errorf("embedding returned empty vector")
+	}
+	deeper, err := s.searchChunks(ctx, b, StoreQuery{
+		Vector:        embeddings[0],
+		Limit:         params.storeLimit() + len(used) + followUpCandidates,
+		MinSimilarity: params.minSimilarity,
+		Filter:        filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	take(deeper)
+	return candidates, nil
+}
+
+// followUpKey identifies the chunk of r, by point ID when the store has one.
+func followUpKey(r SearchResult) string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Path + ":" + strconv.Itoa(r.StartLine)
+}
+
+func followUpPrompt(question string, candidates []SearchResult, count int) string {
+	var sb strings.Builder
+	sb.WriteString("A user asked the question below and was answered from their notes. " +
+		"The excerpts below come from the same notes but were not used in the answer.\n" +
+		fmt.Sprintf("Suggest %d short follow-up questions the user could ask next, each answerable from the excerpts. ", count) +
+		"Write them in the language of the question, one per line, with nothing else.\n\n")
+	sb.WriteString("Question: " + question + "\n")
+	for _, r := range candidates {
+		text := r.Content
+		if len([]rune(text)) > followUpExcerptChars {
+			text = truncateSnippet(text, followUpExcerptChars) + truncatedMarker
+		}
+		sb.WriteString("\n### " + r.Path)
+		if r.Heading != "" {
+			sb.WriteString(" > " + r.Heading)
+		}
+		sb.WriteString("\n" + text + "\n")
+	}
+	return sb.String()
+}
+
+// followUpMarker matches the bullet or number a reply line may start with.
+var followUpMarker = regexp.MustCompile(`^(?:[-*•+]|\d+[.)、])\s*`)
+
+// parseFollowUps takes up to count questions from reply, one per line,
+// without list markers, numbering or surrounding quotes.
+func parseFollowUps(reply string, count int) []string {
+	var questions []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(reply, "\n") {
+		q := followUpMarker.ReplaceAllString(strings.TrimSpace(line), "")
+		q = strings.Trim(q, "\"“”*_ ")
+		if q == "" || strings.HasSuffix(q, ":") || strings.HasSuffix(q, "：") || seen[strings.ToLower(q)] {
+			continue
+		}
+		seen[strings.ToLower(q)] = true
+		questions = append(questions, q)
+		if len(questions) == count {
+			break
+		}
+	}
+	return questions
+}
+
+// FormatFollowUps renders questions as a list to append to an answer.
+func FormatFollowUps(questions []string) string {
+	if len(questions) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("You could also ask:")
+	for _, q := range questions {
+		sb.WriteString("\n- " + q)
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package rag
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseFollowUps(t *testing.T) {
+	reply := "Follow-up questions:\n1. What did the trial find?\n- **Who ran it?**\n\n2) what did the trial find?\n\"When did it end?\"\n3、还有别的吗？"
+	got := parseFollowUps(reply, 3)
+	want := []string{"What did the trial find?", "Who ran it?", "When did it end?"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFollowUps() = %q, want %q", got, want)
+	}
+	if got := parseFollowUps("3、还有别的吗？", 3); !reflect.DeepEqual(got, []string{"还有别的吗？"}) {
+		t.Errorf("parseFollowUps() = %q", got)
+	}
+}
+
+func TestSuggestFollowUps(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.FollowUps.Count = 2
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(oneResultStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := []SearchResult{{Path: "used.md", Content: "the answer"}}
+	retrieved := append(used,
+		SearchResult{Path: "pinned.md", Content: "always here", Pinned: true},
+		SearchResult{Path: "below.md", Heading: "Results", Content: "the trial ended early"})
+
+	var prompt string
+	questions, err := s.SuggestFollowUps(context.Background(), "what was the answer?", retrieved, used, func(_ context.Context, p string) (string, error) {
+		prompt = p
+		return "1. Why did the trial end early?\n2. What is alpha?\n3. One too many?", nil
+	})
+	if err != nil {
+		t.Fatalf("SuggestFollowUps() error: %v", err)
+	}
+	if want := []string{"Why did the trial end early?", "What is alpha?"}; !reflect.DeepEqual(questions, want) {
+		t.Errorf("questions = %q, want %q", questions, want)
+	}
+	// The chunk below the cut, then the deeper search's match; not the
+	// chunk already in the answer or the pinned note.
+	if !strings.Contains(prompt, "### below.md > Results\nthe trial ended early") || !strings.Contains(prompt, "### a.md\nalpha") {
+		t.Errorf("prompt misses the unused chunks:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "used.md") || strings.Contains(prompt, "always here") {
+		t.Errorf("prompt includes used or pinned chunks:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Suggest 2 ") {
+		t.Errorf("prompt does not ask for rag.follow_ups.count questions:\n%s", prompt)
+	}
+
+	// Nothing left below the cut: no LLM call.
+	questions, err = s.SuggestFollowUps(context.Background(), "alpha", nil, []SearchResult{{Path: "a.md"}}, func(context.Context, string) (string, error) {
+		t.Error("summarizer called without unused chunks")
+		return "", nil
+	})
+	if err != nil || questions != nil {
+		t.Errorf("SuggestFollowUps() = %q, %v; want nothing", questions, err)
+	}
+}
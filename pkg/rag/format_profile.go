@@ -0,0 +1,139 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Format profile styles; see config.RagFormatProfileConfig.
+const (
+	FormatStyleVerbose = "verbose"
+	FormatStyleTerse   = "terse"
+)
+
+const (
+	terseContextHeader = "Notes:\n\n"
+	terseContextFooter = "Cite notes as [n].\n"
+)
+
+// contextFormat is how FormatContext and FitContext lay out results for the
+// target model.
+type contextFormat struct {
+	header          string
+	footer          string
+	snippetMaxChars int
+	cutter          snippetCutter
+	// metadata lists the rag.snippet_metadata fields; vault resolves the
+	// vault field and is nil when the vault config is invalid.
+	metadata []string
+	vault    *vault
+	// guidance is the rag.confidence guidance for the results being
+	// rendered, or "".
+	guidance string
+	// maxResults caps the number of results in the context; 0 means no cap.
+	maxResults int
+	// json renders the context with FormatContextJSON's layout.
+	json bool
+	// model is the model given to SetTargetModel, recorded in the audit
+	// log.
+	model string
+}
+
+func validateFormatProfiles(profiles []config.RagFormatProfileConfig) error {
+	for idx, p := range profiles {
+		if len(p.Models) == 0 {
+			return fmt.Errorf("rag.format_profiles[%d]: models is required", idx)
+		}
+		switch p.Style {
+		case "", FormatStyleVerbose, FormatStyleTerse:
+		default:
+			return fmt.Errorf("rag.format_profiles[%d]: unknown style %q", idx, p.Style)
+		}
+	}
+	return nil
+}
+
+// SetTargetModel selects the format profile matching the model the context
+// is built for. With no matching profile the defaults apply.
+func (s *Service) SetTargetModel(model string) {
+	f := s.defaultFormat()
+	if p, ok := matchFormatProfile(s.cfg.FormatProfiles, model); ok {
+		if p.Style == FormatStyleTerse {
+			f.header = terseContextHeader
+			f.footer = terseContextFooter
+		}
+		if p.Header != "" {
+			f.header = strings.TrimRight(p.Header, "\n") + "\n\n"
+		}
+		if p.Footer != "" {
+			f.footer = strings.TrimRight(p.Footer, "\n") + "\n"
+		}
+		if p.SnippetMaxChars > 0 {
+			f.snippetMaxChars = p.SnippetMaxChars
+		}
+		f.maxResults = p.MaxResults
+	}
+	f.model = model
+	s.formatMu.Lock()
+	defer s.formatMu.Unlock()
+	s.format = f
+}
+
+func (s *Service) defaultFormat() contextFormat {
+	cutter := s.cutter
+	if cutter.boundary == "" {
+		cutter = defaultSnippetCutter
+	}
+	v, _ := newVault(s.cfg.VaultPath)
+	return contextFormat{
+		header:          contextHeader,
+		footer:          contextFooter,
+		snippetMaxChars: s.cfg.SnippetMaxChars,
+		cutter:          cutter,
+		metadata:        s.cfg.SnippetMetadata,
+		vault:           v,
+		json:            s.cfg.Injection.Format == InjectionFormatJSON,
+	}
+}
+
+// limit puts pinned notes first and caps the search results after them at
+// maxResults; pinned notes do not count against the cap.
+func (f contextFormat) limit(results []SearchResult) []SearchResult {
+	pinned, rest := splitPinned(results)
+	if f.maxResults > 0 && len(rest) > f.maxResults {
+		rest = rest[:f.maxResults]
+	}
+	return append(pinned, rest...)
+}
+
+func (s *Service) contextFormat() contextFormat {
+	s.formatMu.RLock()
+	defer s.formatMu.RUnlock()
+	return s.format
+}
+
+func matchFormatProfile(profiles []config.RagFormatProfileConfig, model string) (config.RagFormatProfileConfig, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	for _, p := range profiles {
+		for _, pattern := range p.Models {
+			if modelPatternMatch(strings.ToLower(strings.TrimSpace(pattern)), model) {
+				return p, true
+			}
+		}
+	}
+	return config.RagFormatProfileConfig{}, false
+}
+
+// modelPatternMatch matches model against pattern, where "*" matches any
+// text including "/".
+func modelPatternMatch(pattern, model string) bool {
+	parts := strings.Split(pattern, "*")
+	for idx, part := range parts {
+		parts[idx] = regexp.QuoteMeta(part)
+	}
+	re, err := regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+	return err == nil && re.MatchString(model)
+}
@@ -0,0 +1,59 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestModelPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern, model string
+		want           bool
+	}{
+		{"qwen2.5:*", "qwen2.5:7b", true},
+		{"*mini*", "openrouter/openai/gpt-4o-mini", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"llama3.2", "llama3x2", false},
+	}
+	for _, tt := range tests {
+		if got := modelPatternMatch(tt.pattern, tt.model); got != tt.want {
+			t.Errorf("modelPatternMatch(%q, %q) = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestSetTargetModel(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.cfg.FormatProfiles = []config.RagFormatProfileConfig{
+		{Models: []string{"qwen*"}, Style: FormatStyleTerse, SnippetMaxChars: 5, MaxResults: 1},
+	}
+	results := []SearchResult{
+		{Path: "a.md", StartLine: 1, EndLine: 2, Content: "alpha beta"},
+		{Path: "b.md", StartLine: 1, EndLine: 2, Content: "gamma"},
+	}
+
+	s.SetTargetModel("Qwen2.5:3b")
+	text := s.FormatContext(results)
+	if !strings.HasPrefix(text, terseContextHeader) || !strings.Contains(text, "alpha"+truncatedMarker) || strings.Contains(text, "b.md") {
+		t.Errorf("terse profile not applied:\n%s", text)
+	}
+	if _, kept := s.FitContext(results, 100000); len(kept) != 1 {
+		t.Errorf("FitContext() kept %d results, want 1", len(kept))
+	}
+
+	s.SetTargetModel("gpt-4o")
+	if text := s.FormatContext(results); !strings.HasPrefix(text, contextHeader) || !strings.Contains(text, "b.md") {
+		t.Errorf("default format not restored:\n%s", text)
+	}
+}
+
+func TestValidateFormatProfiles(t *testing.T) {
+	if err := validateFormatProfiles([]config.RagFormatProfileConfig{{Style: FormatStyleTerse}}); err == nil {
+		t.Error("expected an error for a profile without models")
+	}
+	if err := validateFormatProfiles([]config.RagFormatProfileConfig{{Models: []string{"*"}, Style: "loud"}}); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+}
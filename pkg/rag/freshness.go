@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"time"
+)
+
+// IndexFreshness describes how far the index lags behind the vault.
+type IndexFreshness struct {
+	// UpdatedAt is when the least recently updated backend last finished
+	// an index run.
+	UpdatedAt     time.Time
+	NewFiles      int
+	ModifiedFiles int
+	DeletedFiles  int
+	// FullReindexReason is set when the next run will re-embed everything.
+	FullReindexReason string
+}
+
+// PendingFiles is the number of files the next incremental run would touch.
+func (f *IndexFreshness) PendingFiles() int {
+	return f.NewFiles + f.ModifiedFiles + f.DeletedFiles
+}
+
+// Freshness compares the saved index state with the vault on disk without
+// contacting the embedding API or the vector store. It returns
+// ErrIndexNotBuilt when no index run has completed yet.
+func (s *Service) Freshness() (*IndexFreshness, error) {
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	v.formats = noteFormatsOf(s.cfg)
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+
+	f := &IndexFreshness{}
+	var tracked *indexState
+	for _, b := range s.backends() {
+		idx := s.newBackendIndexer(b)
+		state, err := idx.loadState()
+		if err != nil {
+			return nil, ErrIndexNotBuilt
+		}
+		if tracked == nil {
+			// The default backend tracks every file, including those
+			// owned by language routes.
+			tracked = state
+		}
+		updated, _ := time.Parse(time.RFC3339, state.UpdatedAt)
+		if f.UpdatedAt.IsZero() || updated.Before(f.UpdatedAt) {
+			f.UpdatedAt = updated
+		}
+		if f.FullReindexReason == "" {
+			f.FullReindexReason = reindexReason(state, b.cfg, b.embedder.Model(), b.store.Collection())
+		}
+		if f.FullReindexReason == "" && !stringSliceEqual(state.BoilerplateRules, boilerplateRules(b.cfg.Boilerplate)) {
+			f.FullReindexReason = "boilerplate rules changed"
+		}
+	}
+
+	files, err := v.list(s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file.RelPath] = true
+		mt, ok := tracked.Files[file.RelPath]
+		if !ok {
+			mt, ok = tracked.OtherLanguage[file.RelPath]
+		}
+		switch {
+		case !ok:
+			f.NewFiles++
+		case mt != file.MTime:
+			f.ModifiedFiles++
+		}
+	}
+	for path := range tracked.Files {
+		if !current[path] {
+			f.DeletedFiles++
+		}
+	}
+	return f, nil
+}
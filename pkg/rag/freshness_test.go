@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFreshness(t *testing.T) {
+	dir := t.TempDir()
+	vault := filepath.Join(dir, "vault")
+	os.MkdirAll(vault, 0o755)
+	for _, name := range []string{"same.md", "changed.md", "new.md"} {
+		os.WriteFile(filepath.Join(vault, name), []byte("# "+name), 0o644)
+	}
+	s := newRunnerTestService(t, dir, vault)
+
+	if _, err := s.Freshness(); !errors.Is(err, ErrIndexNotBuilt) {
+		t.Fatalf("Freshness() before indexing = %v, want ErrIndexNotBuilt", err)
+	}
+
+	files, err := listNoteFiles(vault, noteFormats{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &indexState{
+		Collection:      s.store.Collection(),
+		ChunkerVersion:  chunkerVersion,
+		EmbeddingModel:  s.embedder.Model(),
+		ChunkSize:       s.cfg.ChunkSize,
+		ChunkOverlap:    s.cfg.ChunkOverlap,
+		IncludePatterns: s.cfg.IncludePatterns,
+		ExcludePatterns: s.cfg.ExcludePatterns,
+		MinChunkChars:   s.cfg.MinChunkChars,
+		Files:           map[string]int64{"gone.md": 1},
+	}
+	for _, f := range files {
+		switch f.RelPath {
+		case "same.md":
+			state.Files[f.RelPath] = f.MTime
+		case "changed.md":
+			state.Files[f.RelPath] = f.MTime - 1
+		}
+	}
+	if err := s.newBackendIndexer(s.backends()[0]).saveState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Freshness()
+	if err != nil {
+		t.Fatalf("Freshness() error: %v", err)
+	}
+	if f.NewFiles != 1 || f.ModifiedFiles != 1 || f.DeletedFiles != 1 || f.PendingFiles() != 3 {
+		t.Errorf("unexpected freshness: %+v", f)
+	}
+	if f.FullReindexReason != "" {
+		t.Errorf("FullReindexReason = %q, want none", f.FullReindexReason)
+	}
+	if time.Since(f.UpdatedAt) > time.Minute {
+		t.Errorf("UpdatedAt = %v, want about now", f.UpdatedAt)
+	}
+}
+
+func TestStateSummarizesSavedIndex(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.SetStorage(NewMemoryStorage())
+	if _, err := s.State(); !errors.Is(err, ErrIndexNotBuilt) {
+		t.Fatalf("State() before indexing = %v, want ErrIndexNotBuilt", err)
+	}
+
+	saved := &indexState{
+		Collection:         "notes",
+		EmbeddingModel:     "m",
+		EmbeddingDimension: 384,
+		ChunkSize:          512,
+		Files:              map[string]int64{"a.md": 1, "b.md": 2},
+		Summaries:          "levels=2",
+	}
+	if err := s.newBackendIndexer(s.backends()[0]).saveState(saved); err != nil {
+		t.Fatal(err)
+	}
+	states, err := s.State()
+	if err != nil || len(states) != 1 {
+		t.Fatalf("State() = %+v, %v", states, err)
+	}
+	got := states[0]
+	if got.Collection != "notes" || got.EmbeddingModel != "m" || got.EmbeddingDimension != 384 || got.ChunkSize != 512 ||
+		got.Files != 2 || !got.Hierarchical || time.Since(got.UpdatedAt) > time.Minute {
+		t.Errorf("State() = %+v", got)
+	}
+}
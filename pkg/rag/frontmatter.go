@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"strings"
+)
+
+// noteMeta is the subset of Obsidian-style frontmatter used for retrieval.
+type noteMeta struct {
+	Title   string
+	Aliases []string
+	Tags    []string
+	// Date is the raw "date" (or "created") value, if any.
+	Date string
+	// Book and Author are set on books, such as converted EPUB files.
+	Book   string
+	Author string
+	// ID is the "id" of the frontmatter. Notes being indexed carry their
+	// document ID here instead; see assignDocID.
+	ID string
+	// EndLine is the 1-based line of the closing "---", or 0 when the note
+	// has no frontmatter.
+	EndLine int
+}
+
+// parseFrontmatter reads the YAML frontmatter at the top of a normalized note.
+// Only flat keys are understood: scalars, inline lists ("[a, b]") and block
+// lists ("- a"). Anything else is ignored rather than rejected, since notes
+// are written by hand.
+func parseFrontmatter(text string) noteMeta {
+	var meta noteMeta
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "---" {
+		return meta
+	}
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return meta
+	}
+	meta.EndLine = end + 1
+
+	values := make(map[string][]string)
+	key := ""
+	for _, line := range lines[1:end] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && key != "" {
+			values[key] = appendYAMLValue(values[key], item)
+			continue
+		}
+		k, v, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			key = ""
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				values[key] = appendYAMLValue(values[key], item)
+			}
+			continue
+		}
+		values[key] = appendYAMLValue(values[key], v)
+	}
+
+	if title := values["title"]; len(title) > 0 {
+		meta.Title = title[0]
+	}
+	for _, key := range []string{"date", "created"} {
+		if v := values[key]; len(v) > 0 && meta.Date == "" {
+			meta.Date = v[0]
+		}
+	}
+	if book := values["book"]; len(book) > 0 {
+		meta.Book = book[0]
+	}
+	if author := values["author"]; len(author) > 0 {
+		meta.Author = author[0]
+	}
+	if id := values[docIDKey]; len(id) > 0 {
+		meta.ID = id[0]
+	}
+	meta.Aliases = append(values["aliases"], values["alias"]...)
+	for _, tag := range append(values["tags"], values["tag"]...) {
+		if tag = strings.TrimPrefix(tag, "#"); tag != "" {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	return meta
+}
+
+func appendYAMLValue(values []string, raw string) []string {
+	v := strings.Trim(strings.TrimSpace(raw), `"'`)
+	if v == "" {
+		return values
+	}
+	return append(values, v)
+}
+
+// aliasChunk builds an extra chunk that names the note and its aliases, so a
+// query that uses an alias retrieves the note even when the alias never
+// appears in the body. It spans the frontmatter lines.
+func aliasChunk(path string, meta noteMeta) (chunk, bool) {
+	if len(meta.Aliases) == 0 {
+		return chunk{}, false
+	}
+	title := meta.Title
+	if title == "" {
+		title = fileTitle(path)
+	}
+	return chunk{
+		Path:      path,
+		Heading:   title,
+		StartLine: 1,
+		EndLine:   meta.EndLine,
+		Content:   title + "\nAlso known as: " + strings.Join(meta.Aliases, ", "),
+		Aliases:   meta.Aliases,
+	}, true
+}
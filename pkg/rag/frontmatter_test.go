@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	text := "---\ntitle: \"Heart failure\"\naliases: [HF, 'CHF']\ntags:\n  - cardiology\n  - \"#chronic\"\n---\n\n# Heart failure\n"
+	meta := parseFrontmatter(text)
+	if meta.Title != "Heart failure" {
+		t.Errorf("Title = %q", meta.Title)
+	}
+	if !reflect.DeepEqual(meta.Aliases, []string{"HF", "CHF"}) {
+		t.Errorf("Aliases = %v", meta.Aliases)
+	}
+	if !reflect.DeepEqual(meta.Tags, []string{"cardiology", "chronic"}) {
+		t.Errorf("Tags = %v", meta.Tags)
+	}
+	if meta.EndLine != 7 {
+		t.Errorf("EndLine = %d, want 7", meta.EndLine)
+	}
+}
+
+func TestParseFrontmatterMissing(t *testing.T) {
+	for _, text := range []string{"# Title\n", "---\naliases: [x]\nno closing fence\n"} {
+		if meta := parseFrontmatter(text); meta.EndLine != 0 || len(meta.Aliases) != 0 {
+			t.Errorf("parseFrontmatter(%q) = %+v, want empty", text, meta)
+		}
+	}
+}
+
+func TestAliasChunk(t *testing.T) {
+	if _, ok := aliasChunk("notes/hf.md", noteMeta{EndLine: 3}); ok {
+		t.Error("expected no alias chunk without aliases")
+	}
+	ch, ok := aliasChunk("notes/hf.md", noteMeta{Aliases: []string{"HF", "CHF"}, EndLine: 3})
+	if !ok {
+		t.Fatal("expected alias chunk")
+	}
+	if ch.Heading != "hf" || ch.Content != "hf\nAlso known as: HF, CHF" || ch.EndLine != 3 {
+		t.Errorf("unexpected alias chunk: %+v", ch)
+	}
+}
@@ -0,0 +1,48 @@
+package rag
+
+// groupOverfetch is how many extra candidates per requested result are pulled
+// from the vector store when results are capped per document, so enough
+// distinct notes remain after grouping.
+const groupOverfetch = 4
+
+// storeLimit is the number of candidates to request from the vector store.
+func (p searchParams) storeLimit() int {
+	limit := p.topK
+	if limit <= 0 {
+		limit = 5
+	}
+	if p.group {
+		return limit * groupOverfetch
+	}
+	return limit
+}
+
+// groupByDocument keeps at most maxChunksPerDoc chunks per note, preserving
+// score order, and trims the list back to topK.
+func (p searchParams) groupByDocument(results []SearchResult) []SearchResult {
+	if !p.group {
+		return results
+	}
+	perDoc := p.maxChunksPerDoc
+	if perDoc <= 0 {
+		perDoc = 1
+	}
+	limit := p.topK
+	if limit <= 0 {
+		limit = 5
+	}
+
+	counts := make(map[string]int)
+	grouped := make([]SearchResult, 0, limit)
+	for _, r := range results {
+		if counts[r.Path] >= perDoc {
+			continue
+		}
+		counts[r.Path]++
+		grouped = append(grouped, r)
+		if len(grouped) == limit {
+			break
+		}
+	}
+	return grouped
+}
@@ -0,0 +1,34 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestGroupByDocument(t *testing.T) {
+	s := &Service{cfg: config.RagConfig{TopK: 3, GroupByDocument: true, MaxChunksPerDoc: 1}}
+	results := []SearchResult{
+		{Path: "a.md", Score: 0.9},
+		{Path: "a.md", Score: 0.8},
+		{Path: "b.md", Score: 0.7},
+		{Path: "a.md", Score: 0.6},
+		{Path: "c.md", Score: 0.5},
+		{Path: "d.md", Score: 0.4},
+	}
+
+	p, _ := s.searchParams("")
+	got := p.groupByDocument(results)
+	want := []string{"a.md", "b.md", "c.md"}
+	if len(got) != len(want) {
+		t.Fatalf("groupByDocument() returned %d results, want %d", len(got), len(want))
+	}
+	for i, path := range want {
+		if got[i].Path != path {
+			t.Errorf("result[%d].Path = %q, want %q", i, got[i].Path, path)
+		}
+	}
+	if p.storeLimit() != 3*groupOverfetch {
+		t.Errorf("storeLimit() = %d, want %d", p.storeLimit(), 3*groupOverfetch)
+	}
+}
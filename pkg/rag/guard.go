@@ -0,0 +1,185 @@
+package rag
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Operation names a destructive operation guarded by rag.guardrails.
+type Operation string
+
+const (
+	// OpFullReindex drops and re-embeds every note.
+	OpFullReindex Operation = "full_reindex"
+	// OpPurge deletes the collections and the index state.
+	OpPurge Operation = "purge"
+	// OpPruneCollections deletes the unused collections picoclaw created.
+	OpPruneCollections Operation = "prune_collections"
+)
+
+// Caller identifies who asks for a destructive operation.
+type Caller struct {
+	Channel  string
+	SenderID string
+	// Trusted skips the admin allowlist for callers authorized otherwise,
+	// such as by the admin token of the gateway's endpoints or as the owner
+	// of a per-user knowledge base. Confirmation still applies.
+	Trusted bool
+}
+
+// guard enforces rag.guardrails for one service.
+type guard struct {
+	admins  []string
+	confirm bool
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	op      Operation
+	caller  Caller
+	expires time.Time
+}
+
+func newGuard(cfg config.RagGuardrailsConfig, now func() time.Time) *guard {
+	return &guard{
+		admins:  cfg.Admins,
+		confirm: cfg.Confirm,
+		ttl:     secondsOrDefault(cfg.ConfirmTTLSeconds, 120),
+		now:     now,
+		pending: make(map[string]pendingConfirmation),
+	}
+}
+
+// Authorize decides whether caller may run op now. Callers must be trusted
+// or listed in rag.guardrails.admins, or ErrNotPermitted is returned. With
+// rag.guardrails.confirm, a request without a confirmation fails with a
+// *ConfirmationError carrying a one-time token; repeating it with that token
+// before it expires, as the same caller and for the same operation, is then
+// allowed.
+func (s *Service) Authorize(op Operation, caller Caller, confirmation string) error {
+	return s.guard.authorize(op, caller, confirmation)
+}
+
+func (g *guard) authorize(op Operation, caller Caller, confirmation string) error {
+	if !caller.Trusted && !IsAdmin(g.admins, caller.Channel, caller.SenderID) {
+		return fmt.Errorf("%s: %w", op, ErrNotPermitted)
+	}
+	if !g.confirm {
+		return nil
+	}
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for token, p := range g.pending {
+		if now.After(p.expires) {
+			delete(g.pending, token)
+		}
+	}
+	if confirmation != "" {
+		if p, ok := g.pending[confirmation]; ok && p.op == op && p.caller == caller {
+			delete(g.pending, confirmation)
+			return nil
+		}
+	}
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("create confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	p := pendingConfirmation{op: op, caller: caller, expires: now.Add(g.ttl)}
+	g.pending[token] = p
+	return &ConfirmationError{Operation: op, Token: token, Expires: p.expires}
+}
+
+// IsAdmin reports whether senderID on channel is listed in admins, as
+// "channel:sender_id" or a bare sender ID. Compound sender IDs such as
+// "123456|username" match by their first part.
+func IsAdmin(admins []string, channel, senderID string) bool {
+	if senderID == "" {
+		return false
+	}
+	id, _, _ := strings.Cut(senderID, "|")
+	for _, admin := range admins {
+		if c, sender, ok := strings.Cut(admin, ":"); ok {
+			if c != channel {
+				continue
+			}
+			admin = sender
+		}
+		if admin == senderID || admin == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Purge deletes the collections of the default index and the language
+// routes, including the ones their index state still points at, and the
+// index state itself, so the next index run rebuilds everything. Callers
+// reachable from chat or HTTP must check Authorize with OpPurge first.
+func (s *Service) Purge(ctx context.Context) error {
+	for _, b := range s.backends() {
+		client, ok := b.store.(*QdrantClient)
+		if !ok {
+			return fmt.Errorf("purging needs a %s store", StoreQdrant)
+		}
+		idx := s.newBackendIndexer(b)
+		collections := []string{client.Collection()}
+		if state, err := idx.loadState(); err == nil && state.Collection != "" && state.Collection != client.Collection() {
+			collections = append(collections, state.Collection)
+		}
+		for _, name := range collections {
+			if err := client.forCollection(name).deleteCollection(ctx); err != nil {
+				var perr *ProviderError
+				if errors.As(err, &perr) && perr.StatusCode == http.StatusNotFound {
+					continue
+				}
+				return fmt.Errorf("deleting collection %s: %w", name, err)
+			}
+		}
+		if err := removeIndexState(s.storage, idx.stateName()); err != nil {
+			return fmt.Errorf("removing index state: %w", err)
+		}
+	}
+	s.log.Info("Knowledge base purged", nil)
+	return nil
+}
+
+// userStateCollections returns the collections recorded in the index state
+// of the per-user knowledge bases kept under the data directory, so that
+// pruning from the shared knowledge base leaves them alone.
+func (s *Service) userStateCollections() []string {
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, "users"))
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		st := NewLocalStorage(filepath.Join(s.dataDir, "users", entry.Name()))
+		for _, b := range s.backends() {
+			state, err := loadIndexState(st, s.newBackendIndexer(b).stateName(), s.log)
+			if err == nil && state.Collection != "" {
+				out = append(out, state.Collection)
+			}
+		}
+	}
+	return out
+}
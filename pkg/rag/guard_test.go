@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestGuardAuthorize(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	g := newGuard(config.RagGuardrailsConfig{
+		Admins:            config.FlexibleStringSlice{"telegram:42"},
+		Confirm:           true,
+		ConfirmTTLSeconds: 60,
+	}, func() time.Time { return now })
+	admin := Caller{Channel: "telegram", SenderID: "42|alice"}
+	other := Caller{Channel: "telegram", SenderID: "7"}
+
+	if err := g.authorize(OpPurge, other, ""); !errors.Is(err, ErrNotPermitted) {
+		t.Fatalf("authorize() by a non-admin error = %v, want ErrNotPermitted", err)
+	}
+	err := g.authorize(OpPurge, admin, "")
+	var confirm *ConfirmationError
+	if !errors.As(err, &confirm) || !errors.Is(err, ErrConfirmationRequired) || !confirm.Expires.Equal(now.Add(time.Minute)) {
+		t.Fatalf("authorize() without confirmation error = %v", err)
+	}
+	trusted := Caller{Channel: "http", Trusted: true}
+	if err := g.authorize(OpPurge, trusted, confirm.Token); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("another caller confirmed with the token: %v", err)
+	}
+	if err := g.authorize(OpFullReindex, admin, confirm.Token); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("the token confirmed another operation: %v", err)
+	}
+	if err := g.authorize(OpPurge, admin, confirm.Token); err != nil {
+		t.Errorf("authorize() with the token error = %v", err)
+	}
+	if err := g.authorize(OpPurge, admin, confirm.Token); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("the token was accepted twice: %v", err)
+	}
+
+	errors.As(g.authorize(OpPurge, admin, ""), &confirm)
+	now = now.Add(2 * time.Minute)
+	if err := g.authorize(OpPurge, admin, confirm.Token); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("an expired token was accepted: %v", err)
+	}
+
+	g.confirm = false
+	if err := g.authorize(OpPruneCollections, trusted, ""); err != nil {
+		t.Errorf("authorize() without confirm error = %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/collections/"))
+		w.Write([]byte(`{"result":true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.DataDir = dir
+	cfg.RAG.VectorDB.URL = server.URL
+	cfg.RAG.VectorDB.Collection = "notes"
+	s, err := NewService(cfg, dir, WithEmbedder(fixedEmbedder{}))
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	idx := s.newBackendIndexer(s.backends()[0])
+	// The second save leaves a backup of the first.
+	for range 2 {
+		if err := idx.saveState(&indexState{Collection: "notes_old"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Purge(t.Context()); err != nil {
+		t.Fatalf("Purge() error: %v", err)
+	}
+	if want := []string{"notes", "notes_old"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted collections %v, want %v", deleted, want)
+	}
+	for _, name := range []string{idx.stateName(), idx.stateName() + stateBackupSuffix} {
+		if _, err := s.storage.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s kept after Purge(): %v", name, err)
+		}
+	}
+	if _, err := s.State(); !errors.Is(err, ErrIndexNotBuilt) {
+		t.Errorf("State() after Purge() error = %v, want ErrIndexNotBuilt", err)
+	}
+}
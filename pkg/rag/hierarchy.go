@@ -0,0 +1,389 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const (
+	// summaryPathPrefix starts the path of summary points, which belong to
+	// no single note: "@summary/<level>/<key>".
+	summaryPathPrefix = "@summary/"
+	// summaryPromptChars caps the text of a cluster sent to the LLM.
+	summaryPromptChars = 8000
+	// kmeansIterations bounds each 2-means split of a cluster.
+	kmeansIterations = 8
+)
+
+// errNoSummarizer is returned when summary levels are enabled but the
+// service was not given an LLM to write them.
+var errNoSummarizer = errors.New("rag.hierarchical needs an LLM; index from the gateway or the rag command")
+
+// SetSummarizer gives the service the LLM that writes the summary levels of
+// rag.hierarchical. Call it before indexing; without it index runs leave the
+// summaries stale.
+func (s *Service) SetSummarizer(summarize Summarizer) {
+	s.summarizer = s.auditSummarizer("rag:summaries", summarize)
+}
+
+// summarySourcesLabel names the first notes a summary covers.
+func summarySourcesLabel(paths []string) string {
+	const shown = 3
+	if len(paths) <= shown {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:shown], ", "), len(paths)-shown)
+}
+
+// summarySettings renders the settings summary levels are built with, or ""
+// when they are off.
+func summarySettings(cfg config.RagHierarchicalConfig) string {
+	if !cfg.Enabled {
+		return ""
+	}
+	levels, size := hierarchicalDefaults(cfg)
+	return fmt.Sprintf("levels=%d,cluster_size=%d", levels, size)
+}
+
+func hierarchicalDefaults(cfg config.RagHierarchicalConfig) (levels, clusterSize int) {
+	levels, clusterSize = cfg.Levels, cfg.ClusterSize
+	if levels <= 0 {
+		levels = 2
+	}
+	if clusterSize < 2 {
+		clusterSize = 10
+	}
+	return levels, clusterSize
+}
+
+// summaryNode is a chunk or a summary taking part in clustering.
+type summaryNode struct {
+	// key identifies the content: the hash of a chunk, or of the keys of a
+	// summary's cluster.
+	key    string
+	text   string
+	vector []float64
+	// sources are the notes the node covers.
+	sources []string
+}
+
+// cachedSummary is a summary kept between runs, so a cluster whose members
+// did not change is neither summarized nor embedded again.
+type cachedSummary struct {
+	Title   string    `json:"title"`
+	Summary string    `json:"summary"`
+	Vector  []float64 `json:"vector"`
+}
+
+func (i *indexer) summaryCacheName() string {
+	if i.language != "" {
+		return "summaries." + i.language + ".json"
+	}
+	return "summaries.json"
+}
+
+// updateSummaries brings the summary levels in line with the notes after a
+// run: it rebuilds them when notes changed, when the settings changed or when
+// the last attempt failed, and removes them when rag.hierarchical is off.
+func (i *indexer) updateSummaries(ctx context.Context, state *indexState, changed bool) error {
+	want := summarySettings(i.cfg.Hierarchical)
+	if want == "" {
+		if state.Summaries == "" {
+			return nil
+		}
+		if err := i.deleteSummaries(ctx); err != nil {
+			return err
+		}
+		state.Summaries = ""
+		state.SummariesStale = false
+		return i.storage.RemoveAll(i.summaryCacheName())
+	}
+	if !changed && !state.SummariesStale && state.Summaries == want {
+		return nil
+	}
+	if err := i.buildSummaries(ctx); err != nil {
+		state.SummariesStale = true
+		return err
+	}
+	state.Summaries = want
+	state.SummariesStale = false
+	return nil
+}
+
+func (i *indexer) deleteSummaries(ctx context.Context) error {
+	store, ok := i.store.(*QdrantClient)
+	if !ok {
+		return fmt.Errorf("rag.hierarchical needs a %s store", StoreQdrant)
+	}
+	return store.deleteByFilter(ctx, map[string]interface{}{
+		"must": []map[string]interface{}{{
+			"key":   "summary_level",
+			"range": map[string]interface{}{"gte": 1},
+		}},
+	})
+}
+
+// buildSummaries clusters the chunks of the collection and summarizes each
+// cluster, level by level, then replaces the stored summaries with the new
+// ones. A level stops the climb when clustering no longer reduces the nodes.
+func (i *indexer) buildSummaries(ctx context.Context) error {
+	if i.summarize == nil {
+		return errNoSummarizer
+	}
+	store, ok := i.store.(*QdrantClient)
+	if !ok {
+		return fmt.Errorf("rag.hierarchical needs a %s store", StoreQdrant)
+	}
+	nodes, err := summaryLeaves(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	cacheName := i.summaryCacheName()
+	cache := map[string]cachedSummary{}
+	if data, err := i.storage.ReadFile(cacheName); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	used := map[string]cachedSummary{}
+
+	levels, clusterSize := hierarchicalDefaults(i.cfg.Hierarchical)
+	var points []QdrantPoint
+	for level := 1; level <= levels && len(nodes) > 1; level++ {
+		clusters := splitClusters(nodes, clusterSize)
+		if len(clusters) == len(nodes) {
+			break
+		}
+		next := make([]*summaryNode, 0, len(clusters))
+		var missing []int
+		var texts []string
+		for _, cluster := range clusters {
+			node := clusterNode(level, cluster)
+			next = append(next, node)
+			if c, ok := cache[node.key]; ok {
+				used[node.key] = c
+				continue
+			}
+			reply, err := i.summarize(ctx, summaryPrompt(cluster))
+			if err != nil {
+				return fmt.Errorf("failed to summarize level %d: %w", level, err)
+			}
+			title, summary := parseDigestReply(reply)
+			used[node.key] = cachedSummary{Title: title, Summary: summary}
+			missing = append(missing, len(next)-1)
+			texts = append(texts, strings.TrimSpace(title+"\n"+summary))
+		}
+		for start, end := 0, 0; start < len(texts); start = end {
+			end = min(start+i.batchSize(), len(texts))
+			embeddings, err := i.embedder.EmbedBatch(ctx, texts[start:end])
+			if err != nil {
+				return err
+			}
+			for idx, emb := range embeddings {
+				key := next[missing[start+idx]].key
+				c := used[key]
+				c.Vector = emb
+				used[key] = c
+			}
+		}
+		for _, node := range next {
+			c := used[node.key]
+			node.vector = c.Vector
+			node.text = strings.TrimSpace(c.Title + "\n" + c.Summary)
+			points = append(points, summaryPoint(level, node, c))
+		}
+		nodes = next
+	}
+
+	if err := i.deleteSummaries(ctx); err != nil {
+		return err
+	}
+	for start, end := 0, 0; start < len(points); start = end {
+		end = min(start+i.batchSize(), len(points))
+		if err := i.store.Upsert(ctx, points[start:end]); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(used)
+	if err != nil {
+		return err
+	}
+	return i.storage.WriteFile(cacheName, data)
+}
+
+// summaryLeaves returns the chunks of the collection, in note order.
+func summaryLeaves(ctx context.Context, store *QdrantClient) ([]*summaryNode, error) {
+	filter := documentsFilter(map[string]interface{}{
+		"must": []map[string]interface{}{{"is_empty": map[string]interface{}{"key": "summary_level"}}},
+	}, false)
+	type leaf struct {
+		node  *summaryNode
+		path  string
+		start float64
+	}
+	var leaves []leaf
+	var offset interface{}
+	for {
+		points, next, err := store.scroll(ctx, filter, offset, digestScrollBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			if isMetadataPayload(p.Payload) || len(p.Vector) == 0 {
+				continue
+			}
+			path, _ := p.Payload["path"].(string)
+			content, _ := p.Payload["content"].(string)
+			start, _ := p.Payload["start_line"].(float64)
+			leaves = append(leaves, leaf{
+				node: &summaryNode{
+					key:     hashContent([]byte(path + "\x00" + content)),
+					text:    content,
+					vector:  p.Vector,
+					sources: []string{path},
+				},
+				path:  path,
+				start: start,
+			})
+		}
+		if next == nil || len(points) == 0 {
+			break
+		}
+		offset = next
+	}
+	sort.Slice(leaves, func(a, b int) bool {
+		if leaves[a].path != leaves[b].path {
+			return leaves[a].path < leaves[b].path
+		}
+		return leaves[a].start < leaves[b].start
+	})
+	nodes := make([]*summaryNode, len(leaves))
+	for idx, l := range leaves {
+		nodes[idx] = l.node
+	}
+	return nodes, nil
+}
+
+// clusterNode is the summary node of a cluster, keyed by its level and
+// members so an unchanged cluster finds its cached summary.
+func clusterNode(level int, cluster []*summaryNode) *summaryNode {
+	keys := make([]string, len(cluster))
+	seen := map[string]bool{}
+	var sources []string
+	for idx, n := range cluster {
+		keys[idx] = n.key
+		for _, src := range n.sources {
+			if !seen[src] {
+				seen[src] = true
+				sources = append(sources, src)
+			}
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(sources)
+	return &summaryNode{
+		key:     hashContent([]byte(fmt.Sprintf("%d\x00%s", level, strings.Join(keys, "\x00")))),
+		sources: sources,
+	}
+}
+
+func summaryPoint(level int, node *summaryNode, c cachedSummary) QdrantPoint {
+	path := fmt.Sprintf("%s%d/%s", summaryPathPrefix, level, node.key[:12])
+	return QdrantPoint{
+		ID:     hashPointID(path, level, 0),
+		Vector: c.Vector,
+		Payload: map[string]interface{}{
+			"path":            path,
+			"heading":         c.Title,
+			"heading_path":    stringsPayload([]string{c.Title}),
+			"content":         c.Summary,
+			"summary_level":   level,
+			"summary_of":      stringsPayload(node.sources),
+			"chunker_version": chunkerVersion,
+		},
+	}
+}
+
+// summaryPrompt asks for a title and an overview of a cluster. Every member
+// gets an equal share of summaryPromptChars.
+func summaryPrompt(cluster []*summaryNode) string {
+	var sb strings.Builder
+	sb.WriteString("The passages below come from a personal knowledge base and are about related things. " +
+		"Write an overview of them that someone searching the notes could use instead of reading every passage.\n" +
+		"Reply with a short title on the first line, then one paragraph that keeps the key facts, names, numbers and decisions. " +
+		"Only use the passages below.\n")
+	share := summaryPromptChars / len(cluster)
+	for _, n := range cluster {
+		text := n.text
+		if len([]rune(text)) > share {
+			text = truncateSnippet(text, share) + truncatedMarker
+		}
+		sb.WriteString("\n---\nFrom " + strings.Join(n.sources, ", ") + ":\n" + text + "\n")
+	}
+	return sb.String()
+}
+
+// splitClusters divides nodes into clusters of at most size by repeatedly
+// splitting the largest with 2-means, which stays fast on large vaults where
+// a full k-means over every chunk would not. Clusters keep the node order.
+func splitClusters(nodes []*summaryNode, size int) [][]*summaryNode {
+	if len(nodes) <= size {
+		return [][]*summaryNode{nodes}
+	}
+	a, b := twoMeans(nodes)
+	if len(a) == 0 || len(b) == 0 {
+		// Identical vectors: fall back to halves.
+		a, b = nodes[:len(nodes)/2], nodes[len(nodes)/2:]
+	}
+	return append(splitClusters(a, size), splitClusters(b, size)...)
+}
+
+// twoMeans splits nodes in two by cosine similarity, seeded with the first
+// node and the node least similar to it.
+func twoMeans(nodes []*summaryNode) ([]*summaryNode, []*summaryNode) {
+	far, farSim := 0, 2.0
+	for idx, n := range nodes {
+		if sim := cosineSimilarity(nodes[0].vector, n.vector); sim < farSim {
+			far, farSim = idx, sim
+		}
+	}
+	centroids := [2][]float64{nodes[0].vector, nodes[far].vector}
+	side := make([]int, len(nodes))
+	for iter := 0; iter < kmeansIterations; iter++ {
+		moved := false
+		var sums [2][]float64
+		for idx, n := range nodes {
+			s := 0
+			if cosineSimilarity(n.vector, centroids[1]) > cosineSimilarity(n.vector, centroids[0]) {
+				s = 1
+			}
+			if s != side[idx] || iter == 0 {
+				moved = true
+			}
+			side[idx] = s
+			sums[s] = addVector(sums[s], n.vector)
+		}
+		if !moved {
+			break
+		}
+		for s := range sums {
+			if sums[s] != nil {
+				centroids[s] = sums[s]
+			}
+		}
+	}
+	var a, b []*summaryNode
+	for idx, n := range nodes {
+		if side[idx] == 0 {
+			a = append(a, n)
+		} else {
+			b = append(b, n)
+		}
+	}
+	return a, b
+}
@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSplitClustersKeepsSimilarNodesTogether(t *testing.T) {
+	var nodes []*summaryNode
+	for idx, v := range [][]float64{{1, 0}, {0, 1}, {0.9, 0.1}, {0.1, 0.9}, {1, 0.05}} {
+		nodes = append(nodes, &summaryNode{key: fmt.Sprint(idx), vector: v})
+	}
+	var got []string
+	for _, c := range splitClusters(nodes, 3) {
+		var keys []string
+		for _, n := range c {
+			keys = append(keys, n.key)
+		}
+		got = append(got, strings.Join(keys, ","))
+	}
+	if strings.Join(got, " ") != "0,2,4 1,3" {
+		t.Errorf("splitClusters() = %q", got)
+	}
+
+	same := []*summaryNode{{key: "a", vector: []float64{1, 0}}, {key: "b", vector: []float64{1, 0}}, {key: "c", vector: []float64{1, 0}}}
+	if clusters := splitClusters(same, 2); len(clusters) != 2 || len(clusters[0])+len(clusters[1]) != 3 {
+		t.Errorf("splitClusters() of identical vectors = %d clusters", len(clusters))
+	}
+}
+
+func TestBuildSummariesReusesCachedClusters(t *testing.T) {
+	var deletes, upserted []string
+	store := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/points/scroll"):
+			w.Write([]byte(`{"result":{"points":[
+				{"id":1,"vector":[1,0],"payload":{"path":"api.md","start_line":1,"content":"Rate limits go up."}},
+				{"id":2,"vector":[0,1],"payload":{"path":"garden.md","start_line":1,"content":"Plant tomatoes."}},
+				{"id":3,"vector":[0.9,0.1],"payload":{"path":"api.md","start_line":9,"content":"Keys rotate."}},
+				{"id":4,"vector":[0.1,0.9],"payload":{"path":"garden.md","start_line":5,"content":"Water daily."}}
+			],"next_page_offset":null}}`))
+		case strings.HasSuffix(r.URL.Path, "/points/delete"):
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			data, _ := json.Marshal(req["filter"])
+			deletes = append(deletes, string(data))
+			w.Write([]byte(`{"result":{}}`))
+		case r.Method == http.MethodPut:
+			var req struct {
+				Points []QdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			for _, p := range req.Points {
+				upserted = append(upserted, fmt.Sprintf("%s|%s|%v", p.Payload["path"], p.Payload["heading"], p.Payload["summary_of"]))
+			}
+			w.Write([]byte(`{"result":{}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	embedded := 0
+	embedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		embedded += len(req.Input)
+		var data []string
+		for idx := range req.Input {
+			data = append(data, fmt.Sprintf(`{"index":%d,"embedding":[%d,1]}`, idx, idx))
+		}
+		w.Write([]byte(`{"data":[` + strings.Join(data, ",") + `]}`))
+	}))
+	t.Cleanup(embedServer.Close)
+	embedder, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: embedServer.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig().RAG
+	cfg.Hierarchical = config.RagHierarchicalConfig{Enabled: true, Levels: 2, ClusterSize: 2}
+	idx := newIndexer(cfg, NewLocalStorage(t.TempDir()), embedder, store)
+	var prompts []string
+	idx.summarize = func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		switch {
+		case strings.Contains(prompt, "Rate limits"):
+			return "API\nLimits went up and keys rotate.", nil
+		case strings.Contains(prompt, "tomatoes"):
+			return "Garden\nTomatoes need daily water.", nil
+		}
+		return "Everything\nAPI and garden work.", nil
+	}
+
+	if err := idx.buildSummaries(t.Context()); err != nil {
+		t.Fatalf("buildSummaries() error: %v", err)
+	}
+	if len(prompts) != 3 || embedded != 3 {
+		t.Fatalf("prompts = %d, embedded = %d, want 3 and 3", len(prompts), embedded)
+	}
+	if !strings.Contains(prompts[0], "From api.md:\nRate limits go up.") {
+		t.Errorf("prompt = %q", prompts[0])
+	}
+	got := strings.Join(upserted, "\n")
+	for _, want := range []string{"|API|[api.md]", "|Garden|[garden.md]", "@summary/2/", "|Everything|[api.md garden.md]"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("upserted summaries missing %q:\n%s", want, got)
+		}
+	}
+	if len(deletes) != 1 || !strings.Contains(deletes[0], "summary_level") {
+		t.Errorf("deletes = %q", deletes)
+	}
+
+	prompts, upserted, embedded = nil, nil, 0
+	if err := idx.buildSummaries(t.Context()); err != nil {
+		t.Fatalf("second buildSummaries() error: %v", err)
+	}
+	if len(prompts) != 0 || embedded != 0 || len(upserted) != 3 {
+		t.Errorf("unchanged notes: prompts = %d, embedded = %d, upserted = %d", len(prompts), embedded, len(upserted))
+	}
+
+	idx.summarize = nil
+	state := &indexState{Summaries: summarySettings(cfg.Hierarchical)}
+	if err := idx.updateSummaries(t.Context(), state, true); err != errNoSummarizer || !state.SummariesStale {
+		t.Errorf("updateSummaries() without an LLM = %v, stale %v", err, state.SummariesStale)
+	}
+}
+
+func TestFormatSourceSummary(t *testing.T) {
+	r := SearchResult{
+		Path:         "@summary/1/abc",
+		Heading:      "API",
+		SummaryLevel: 1,
+		SummaryOf:    []string{"a.md", "b.md", "c.md", "d.md", "e.md"},
+	}
+	if got := FormatSource(r); got != "API (summary of a.md, b.md, c.md and 2 more)" {
+		t.Errorf("FormatSource() = %q", got)
+	}
+	if got := answerSourceLink(r); got != "[[a]], [[b]], [[c]], [[d]], [[e]]" {
+		t.Errorf("answerSourceLink() = %q", got)
+	}
+}
@@ -0,0 +1,228 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stateHistoryDir holds the index state snapshots kept for rag.state_history.
+const stateHistoryDir = "state_history"
+
+// stateSnapshot is what an index state tracked at one point in time.
+type stateSnapshot struct {
+	Time       time.Time               `json:"time"`
+	Collection string                  `json:"collection"`
+	Files      map[string]snapshotFile `json:"files"`
+}
+
+type snapshotFile struct {
+	MTime int64 `json:"mtime"`
+	// Chunks is -1 for files indexed before chunk counts were recorded.
+	Chunks int `json:"chunks"`
+}
+
+// historyEntry names one snapshot in the history list of a state.
+type historyEntry struct {
+	Time time.Time `json:"time"`
+	Name string    `json:"name"`
+}
+
+// historyListName is where the snapshots of the state stored as name are
+// listed, oldest first.
+func historyListName(name string) string {
+	return path.Join(stateHistoryDir, strings.TrimSuffix(name, ".json")+".list.json")
+}
+
+// recordHistory saves a snapshot of state if rag.state_history is set,
+// dropping the oldest ones beyond it. Failures are logged: the history is
+// for auditing and never stops an index run.
+func (i *indexer) recordHistory(state *indexState) {
+	if i.cfg.StateHistory <= 0 {
+		return
+	}
+	if err := appendStateHistory(i.storage, i.stateName(), state, i.now().UTC(), i.cfg.StateHistory); err != nil {
+		i.log.Warn("Failed to save an index state snapshot", map[string]interface{}{
+			"state": i.stateName(),
+			"error": err.Error(),
+		})
+	}
+}
+
+func appendStateHistory(st Storage, name string, state *indexState, now time.Time, keep int) error {
+	entries, err := readStateHistory(st, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	snap := stateSnapshot{Time: now, Collection: state.Collection, Files: make(map[string]snapshotFile, len(state.Files))}
+	for p, mtime := range state.Files {
+		chunks, ok := state.Chunks[p]
+		if !ok {
+			chunks = -1
+		}
+		snap.Files[p] = snapshotFile{MTime: mtime, Chunks: chunks}
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	snapName := path.Join(stateHistoryDir, strings.TrimSuffix(name, ".json")+"."+now.Format("20060102T150405.000000000Z")+".json")
+	if err := st.WriteFile(snapName, data); err != nil {
+		return err
+	}
+	entries = append(entries, historyEntry{Time: now, Name: snapName})
+	for len(entries) > keep {
+		if err := st.RemoveAll(entries[0].Name); err != nil {
+			return err
+		}
+		entries = entries[1:]
+	}
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.WriteFile(historyListName(name), data)
+}
+
+func readStateHistory(st Storage, name string) ([]historyEntry, error) {
+	data, err := st.ReadFile(historyListName(name))
+	if err != nil {
+		return nil, err
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse the state history of %s: %w", name, err)
+	}
+	return entries, nil
+}
+
+func readStateSnapshot(st Storage, entry historyEntry) (*stateSnapshot, error) {
+	data, err := st.ReadFile(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	var snap stateSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse state snapshot %s: %w", entry.Name, err)
+	}
+	return &snap, nil
+}
+
+// snapshotAt returns the last of entries taken at or before t.
+func snapshotAt(entries []historyEntry, t time.Time) (historyEntry, bool) {
+	idx := sort.Search(len(entries), func(idx int) bool { return entries[idx].Time.After(t) })
+	if idx == 0 {
+		return historyEntry{}, false
+	}
+	return entries[idx-1], true
+}
+
+// DocumentChange is one note in a StateDiff. A chunk count is 0 on the side
+// where the note is absent, and -1 where it was indexed before chunk counts
+// were recorded.
+type DocumentChange struct {
+	Path         string
+	ChunksBefore int
+	ChunksAfter  int
+}
+
+// StateDiff lists how the indexed notes changed between two snapshots of the
+// index state.
+type StateDiff struct {
+	// From and To are when the compared snapshots of the default index
+	// were taken.
+	From     time.Time
+	To       time.Time
+	Added    []DocumentChange
+	Removed  []DocumentChange
+	Modified []DocumentChange
+	// ChunksBefore and ChunksAfter total the known chunk counts.
+	ChunksBefore int
+	ChunksAfter  int
+}
+
+// Diff compares what the index tracked at since with what it tracked at
+// until, or after the last index run when until is zero, using the snapshots
+// rag.state_history keeps. The notes of the default index and the language
+// routes are compared together, so a note moving between them does not
+// count as a change. It fails when no snapshot is as old as since.
+func (s *Service) Diff(since, until time.Time) (*StateDiff, error) {
+	diff := &StateDiff{}
+	before := make(map[string]snapshotFile)
+	after := make(map[string]snapshotFile)
+	found := false
+	for _, b := range s.backends() {
+		name := s.newBackendIndexer(b).stateName()
+		entries, err := readStateHistory(s.storage, name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		found = true
+		from, ok := snapshotAt(entries, since)
+		if !ok {
+			return nil, fmt.Errorf("no index state snapshot from before %s; the oldest is from %s",
+				since.Local().Format("2006-01-02 15:04"), entries[0].Time.Local().Format("2006-01-02 15:04"))
+		}
+		to := entries[len(entries)-1]
+		if !until.IsZero() {
+			to, _ = snapshotAt(entries, until)
+		}
+		if to.Time.Before(from.Time) {
+			to = from
+		}
+		for _, pick := range []struct {
+			entry historyEntry
+			files map[string]snapshotFile
+		}{{from, before}, {to, after}} {
+			snap, err := readStateSnapshot(s.storage, pick.entry)
+			if err != nil {
+				return nil, err
+			}
+			for p, f := range snap.Files {
+				pick.files[p] = f
+			}
+		}
+		if b.language == "" {
+			diff.From, diff.To = from.Time, to.Time
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no index state snapshots yet; set rag.state_history and run an index")
+	}
+
+	for p, a := range after {
+		b, ok := before[p]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, DocumentChange{Path: p, ChunksAfter: a.Chunks})
+		case b.MTime != a.MTime:
+			diff.Modified = append(diff.Modified, DocumentChange{Path: p, ChunksBefore: b.Chunks, ChunksAfter: a.Chunks})
+		}
+		if a.Chunks > 0 {
+			diff.ChunksAfter += a.Chunks
+		}
+	}
+	for p, b := range before {
+		if _, ok := after[p]; !ok {
+			diff.Removed = append(diff.Removed, DocumentChange{Path: p, ChunksBefore: b.Chunks})
+		}
+		if b.Chunks > 0 {
+			diff.ChunksBefore += b.Chunks
+		}
+	}
+	for _, changes := range [][]DocumentChange{diff.Added, diff.Removed, diff.Modified} {
+		sort.Slice(changes, func(x, y int) bool { return changes[x].Path < changes[y].Path })
+	}
+	return diff, nil
+}
@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateHistoryDiff(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	st := NewMemoryStorage()
+	s.SetStorage(st)
+	s.cfg.StateHistory = 2
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return clock }
+	idx := s.newBackendIndexer(s.backends()[0])
+
+	idx.recordHistory(&indexState{
+		Files:  map[string]int64{"a.md": 1, "b.md": 1},
+		Chunks: map[string]int{"a.md": 2, "b.md": 3},
+	})
+	clock = clock.AddDate(0, 0, 9)
+	idx.recordHistory(&indexState{
+		Files:  map[string]int64{"b.md": 2, "c.md": 1},
+		Chunks: map[string]int{"b.md": 5},
+	})
+
+	diff, err := s.Diff(time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC), time.Time{})
+	if err != nil {
+		t.Fatalf("Diff() error: %v", err)
+	}
+	if !diff.From.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) || !diff.To.Equal(clock) {
+		t.Errorf("compared %s to %s", diff.From, diff.To)
+	}
+	if want := []DocumentChange{{Path: "c.md", ChunksAfter: -1}}; !reflect.DeepEqual(diff.Added, want) {
+		t.Errorf("Added = %+v, want %+v", diff.Added, want)
+	}
+	if want := []DocumentChange{{Path: "a.md", ChunksBefore: 2}}; !reflect.DeepEqual(diff.Removed, want) {
+		t.Errorf("Removed = %+v, want %+v", diff.Removed, want)
+	}
+	if want := []DocumentChange{{Path: "b.md", ChunksBefore: 3, ChunksAfter: 5}}; !reflect.DeepEqual(diff.Modified, want) {
+		t.Errorf("Modified = %+v, want %+v", diff.Modified, want)
+	}
+	if diff.ChunksBefore != 5 || diff.ChunksAfter != 5 {
+		t.Errorf("chunks %d -> %d, want 5 -> 5", diff.ChunksBefore, diff.ChunksAfter)
+	}
+	if _, err := s.Diff(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), time.Time{}); err == nil {
+		t.Error("Diff() from before the oldest snapshot succeeded")
+	}
+
+	// A third snapshot pushes out the first.
+	entries, _ := readStateHistory(st, idx.stateName())
+	clock = clock.AddDate(0, 0, 10)
+	idx.recordHistory(&indexState{Files: map[string]int64{}})
+	if _, err := st.ReadFile(entries[0].Name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("oldest snapshot kept: %v", err)
+	}
+	diff, err = s.Diff(time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Diff() error: %v", err)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Modified) != 0 {
+		t.Errorf("Diff() within one snapshot = %+v", diff)
+	}
+}
+
+func TestStateChunksSurviveShards(t *testing.T) {
+	st := NewMemoryStorage()
+	state := &indexState{Files: map[string]int64{}, Chunks: map[string]int{}}
+	for n := 0; n <= stateShardThreshold; n++ {
+		p := "notes/" + time.Duration(n).String() + ".md"
+		state.trackFile(p, int64(n), n%7)
+	}
+	if err := writeIndexState(st, "index_state.json", state, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadIndexState(st, "index_state.json", defaultLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Shards == 0 || !reflect.DeepEqual(got.Chunks, state.Chunks) {
+		t.Errorf("chunk counts not kept in %d shards (%d of %d)", got.Shards, len(got.Chunks), len(state.Chunks))
+	}
+}
@@ -0,0 +1,87 @@
+package rag
+
+import "context"
+
+// Hooks lets code embedding the package observe and adjust retrieval and
+// indexing without forking it. Register implementations with
+// Service.AddHooks; embed NopHooks to implement only some of the methods.
+// The search hooks wrap Search, SearchFiltered, SearchWithBudget and
+// SearchMany; SearchPage and MoreLikeThis do not run them.
+//
+// Hooks run synchronously on the calling goroutine, in registration order,
+// each receiving the previous hook's output. OnIndexFileDone may be called
+// from the background index runner, so implementations must be safe for
+// concurrent use.
+type Hooks interface {
+	// OnBeforeSearch may rewrite the query and filter before retrieval.
+	// Inline filter terms in the returned query are still parsed.
+	OnBeforeSearch(ctx context.Context, query string, filter SearchFilter) (string, SearchFilter)
+	// OnAfterSearch may reorder, rescore, drop or add results. query is the
+	// query as returned by OnBeforeSearch.
+	OnAfterSearch(ctx context.Context, query string, results []SearchResult) []SearchResult
+	// OnContextBuilt may rewrite the prompt context built by FormatContext.
+	OnContextBuilt(results []SearchResult, contextText string) string
+	// OnIndexFileDone is told about every file an index run indexed,
+	// updated, removed, skipped or failed on.
+	OnIndexFileDone(ctx context.Context, result IndexFileResult)
+}
+
+// NopHooks implements Hooks by leaving everything unchanged.
+type NopHooks struct{}
+
+func (NopHooks) OnBeforeSearch(ctx context.Context, query string, filter SearchFilter) (string, SearchFilter) {
+	return query, filter
+}
+
+func (NopHooks) OnAfterSearch(ctx context.Context, query string, results []SearchResult) []SearchResult {
+	return results
+}
+
+func (NopHooks) OnContextBuilt(results []SearchResult, contextText string) string {
+	return contextText
+}
+
+func (NopHooks) OnIndexFileDone(ctx context.Context, result IndexFileResult) {}
+
+// AddHooks registers h after any hooks already registered.
+func (s *Service) AddHooks(h Hooks) {
+	if h == nil {
+		return
+	}
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks = append(s.hooks, h)
+}
+
+func (s *Service) registeredHooks() []Hooks {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	return s.hooks
+}
+
+func (s *Service) beforeSearch(ctx context.Context, query string, filter SearchFilter) (string, SearchFilter) {
+	for _, h := range s.registeredHooks() {
+		query, filter = h.OnBeforeSearch(ctx, query, filter)
+	}
+	return query, filter
+}
+
+func (s *Service) afterSearch(ctx context.Context, query string, results []SearchResult) []SearchResult {
+	for _, h := range s.registeredHooks() {
+		results = h.OnAfterSearch(ctx, query, results)
+	}
+	return results
+}
+
+func (s *Service) contextBuilt(results []SearchResult, contextText string) string {
+	for _, h := range s.registeredHooks() {
+		contextText = h.OnContextBuilt(results, contextText)
+	}
+	return contextText
+}
+
+func (s *Service) indexFileDone(ctx context.Context, result IndexFileResult) {
+	for _, h := range s.registeredHooks() {
+		h.OnIndexFileDone(ctx, result)
+	}
+}
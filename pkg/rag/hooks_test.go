@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type suffixHooks struct {
+	NopHooks
+	suffix string
+}
+
+func (h suffixHooks) OnBeforeSearch(ctx context.Context, query string, filter SearchFilter) (string, SearchFilter) {
+	filter.Tags = append(filter.Tags, h.suffix)
+	return query + h.suffix, filter
+}
+
+func (h suffixHooks) OnAfterSearch(ctx context.Context, query string, results []SearchResult) []SearchResult {
+	return append(results, SearchResult{Path: query})
+}
+
+func (h suffixHooks) OnContextBuilt(results []SearchResult, contextText string) string {
+	return contextText + h.suffix
+}
+
+func TestServiceHooksRunInOrder(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.AddHooks(suffixHooks{suffix: "a"})
+	s.AddHooks(nil)
+	s.AddHooks(suffixHooks{suffix: "b"})
+
+	query, filter := s.beforeSearch(context.Background(), "q", SearchFilter{})
+	if query != "qab" || strings.Join(filter.Tags, ",") != "a,b" {
+		t.Errorf("beforeSearch() = %q, %v", query, filter.Tags)
+	}
+
+	results := s.afterSearch(context.Background(), query, nil)
+	if len(results) != 2 || results[0].Path != "qab" {
+		t.Errorf("afterSearch() = %+v", results)
+	}
+
+	text := s.FormatContext([]SearchResult{{Path: "a.md", Content: "x"}})
+	if !strings.HasSuffix(text, "ab") {
+		t.Errorf("FormatContext() did not run OnContextBuilt hooks: %q", text)
+	}
+	if got := s.FormatContext(nil); got != "" {
+		t.Errorf("FormatContext(nil) = %q, want empty", got)
+	}
+}
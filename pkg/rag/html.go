@@ -0,0 +1,359 @@
+package rag
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var htmlSpace = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// htmlToMarkdown converts an HTML page to markdown, keeping headings, lists,
+// tables, code blocks and links. Relative links to other pages of an export
+// are kept as they are, so they still resolve next to the converted page.
+// When the body has no <h1>, title, or the page <title> if title is empty,
+// becomes the top heading.
+func htmlToMarkdown(data []byte, title string) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if title == "" {
+		if el := findElement(doc, atom.Title); el != nil {
+			title = strings.TrimSpace(htmlSpace.ReplaceAllString(textContent(el), " "))
+		}
+	}
+	return htmlDocToMarkdown(doc, title), nil
+}
+
+// htmlDocToMarkdown converts a parsed page; title, if set, becomes the top
+// heading when the body has no <h1>.
+func htmlDocToMarkdown(doc *html.Node, title string) string {
+	c := &htmlConverter{}
+	if title != "" && findElement(doc, atom.H1) == nil {
+		c.paragraph("# "+title, "")
+	}
+	c.blocks(doc, "")
+	return strings.TrimSpace(strings.Join(c.lines, "\n")) + "\n"
+}
+
+// findElement returns the first element of type a below n, depth first.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if el := findElement(child, a); el != nil {
+			return el
+		}
+	}
+	return nil
+}
+
+// htmlConverter collects markdown lines, with blocks separated by a blank
+// line.
+type htmlConverter struct {
+	lines []string
+}
+
+// paragraph writes text, which may span lines, with every line prefixed.
+func (c *htmlConverter) paragraph(text, prefix string) {
+	text = strings.Trim(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if n := len(c.lines); n > 0 {
+		// Inside a blockquote the separator stays part of the quote.
+		sep := strings.TrimRight(prefix, " ")
+		if !strings.HasPrefix(c.lines[n-1], sep) {
+			sep = ""
+		}
+		c.lines = append(c.lines, sep)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			c.lines = append(c.lines, strings.TrimRight(prefix, " "))
+			continue
+		}
+		c.lines = append(c.lines, prefix+line)
+	}
+}
+
+// blocks writes the children of n. Runs of inline content between block
+// elements become paragraphs.
+func (c *htmlConverter) blocks(n *html.Node, prefix string) {
+	var run strings.Builder
+	flush := func() {
+		text := strings.TrimSpace(collapseInline(run.String()))
+		run.Reset()
+		c.paragraph(text, prefix)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || !isHTMLBlock(child) {
+			run.WriteString(c.inline(child))
+			continue
+		}
+		flush()
+		c.block(child, prefix)
+	}
+	flush()
+}
+
+func (c *htmlConverter) block(n *html.Node, prefix string) {
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Template, atom.Nav:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := strings.TrimSpace(collapseInline(c.inline(n)))
+		if text != "" {
+			c.paragraph(strings.Repeat("#", level)+" "+strings.ReplaceAll(text, "\n", " "), prefix)
+		}
+	case atom.Hr:
+		c.paragraph("---", prefix)
+	case atom.Pre:
+		c.paragraph(codeFence(n), prefix)
+	case atom.Blockquote:
+		c.blocks(n, prefix+"> ")
+	case atom.Ul, atom.Ol:
+		c.paragraph(listMarkdown(n), prefix)
+	case atom.Table:
+		c.paragraph(tableMarkdown(c, n), prefix)
+	default:
+		c.blocks(n, prefix)
+	}
+}
+
+// listMarkdown renders a list as a tight list. Each item is converted on its
+// own; its lines after the first, nested lists included, are indented below
+// the marker.
+func listMarkdown(n *html.Node) string {
+	var sb strings.Builder
+	num := 0
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.DataAtom != atom.Li {
+			continue
+		}
+		num++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", num)
+		}
+		sub := &htmlConverter{}
+		sub.blocks(item, "")
+		first := true
+		for _, line := range sub.lines {
+			if line == "" {
+				continue
+			}
+			if first {
+				sb.WriteString(marker + line + "\n")
+				first = false
+				continue
+			}
+			sb.WriteString(strings.Repeat(" ", len(marker)) + line + "\n")
+		}
+		if first {
+			sb.WriteString(strings.TrimSpace(marker) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// inline renders phrasing content. Whitespace is collapsed later, by
+// collapseInline, so spaces between elements survive.
+func (c *htmlConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return htmlSpace.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	children := func() string {
+		var sb strings.Builder
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			sb.WriteString(c.inline(child))
+		}
+		return sb.String()
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Template:
+		return ""
+	case atom.Br:
+		return "\n"
+	case atom.Strong, atom.B:
+		return wrapInline(children(), "**")
+	case atom.Em, atom.I:
+		return wrapInline(children(), "*")
+	case atom.Del, atom.S:
+		return wrapInline(children(), "~~")
+	case atom.Code:
+		return wrapInline(textContent(n), "`")
+	case atom.Img:
+		alt := htmlAttr(n, "alt")
+		if alt == "" {
+			return ""
+		}
+		return "![" + alt + "](" + htmlAttr(n, "src") + ")"
+	case atom.A:
+		text := children()
+		href := htmlAttr(n, "href")
+		if href == "" || strings.HasPrefix(href, "#") || strings.TrimSpace(text) == "" {
+			return text
+		}
+		lead, inner, trail := splitSpace(text)
+		return lead + "[" + inner + "](" + markdownLinkTarget(href) + ")" + trail
+	}
+	return children()
+}
+
+// markdownLinkTarget keeps href usable as a markdown link target; spaces and
+// parentheses in unescaped relative links are percent-encoded.
+func markdownLinkTarget(href string) string {
+	if u, err := url.Parse(href); err == nil && u.Scheme == "" && u.Host == "" {
+		return (&url.URL{Path: u.Path, RawQuery: u.RawQuery, Fragment: u.Fragment}).String()
+	}
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(href)
+}
+
+// collapseInline turns the output of inline into markdown text: runs of
+// spaces become one and line breaks from <br> lose surrounding spaces.
+func collapseInline(s string) string {
+	lines := strings.Split(s, "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSpace(strings.Join(strings.Fields(line), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapInline wraps text in a markdown delimiter, keeping surrounding spaces
+// outside it so "<b> bold </b>" stays valid markdown.
+func wrapInline(text, delim string) string {
+	lead, inner, trail := splitSpace(text)
+	if inner == "" {
+		return text
+	}
+	return lead + delim + inner + delim + trail
+}
+
+func splitSpace(s string) (string, string, string) {
+	inner := strings.TrimSpace(s)
+	if inner == "" {
+		return s, "", ""
+	}
+	start := strings.Index(s, inner)
+	lead, trail := s[:start], s[start+len(inner):]
+	if lead != "" {
+		lead = " "
+	}
+	if trail != "" {
+		trail = " "
+	}
+	return lead, inner, trail
+}
+
+// codeFence renders a <pre> block as a fenced code block, taking the
+// language from a "language-x" class on it or its <code> child.
+func codeFence(n *html.Node) string {
+	lang := ""
+	for _, el := range []*html.Node{n, n.FirstChild} {
+		if el == nil || el.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(htmlAttr(el, "class")) {
+			if l, ok := strings.CutPrefix(class, "language-"); ok && lang == "" {
+				lang = l
+			}
+		}
+	}
+	code := strings.Trim(textContent(n), "\n")
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+// tableMarkdown renders a table as a pipe table. The first row is the
+// header; short rows are padded.
+func tableMarkdown(c *htmlConverter, table *html.Node) string {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						text := strings.ReplaceAll(collapseInline(c.inline(cell)), "\n", " ")
+						row = append(row, strings.ReplaceAll(strings.TrimSpace(text), "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Table:
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(table)
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for idx, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if idx == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func isHTMLBlock(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Html, atom.Head, atom.Body, atom.Script, atom.Style, atom.Template, atom.Nav,
+		atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Aside,
+		atom.Figure, atom.Figcaption, atom.Details, atom.Summary, atom.Blockquote, atom.Pre, atom.Hr,
+		atom.Ul, atom.Ol, atom.Li, atom.Dl, atom.Dt, atom.Dd, atom.Table,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(textContent(child))
+	}
+	return sb.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLToMarkdownNotionExport(t *testing.T) {
+	page := `<html><head><title>Project Plan</title><style>body{}</style></head><body>
+<article id="1" class="page sans"><header><h1 class="page-title">Project Plan</h1>
+<table class="properties"><tbody><tr><th>Status</th><td>Active</td></tr></tbody></table></header>
+<div class="page-body"><h2>Goals</h2>
+<p>Ship <strong>v2 </strong>by March, see <a href="Roadmap%20abc123.html">Roadmap</a> and <a href="https://example.com/x">docs</a>.</p>
+<ul><li>First<ul><li>Nested</li></ul></li><li>Second</li></ul>
+<ol><li>One</li><li>Two</li></ol>
+<blockquote>Quoted<br>twice</blockquote>
+<pre class="code"><code class="language-go">fmt.Println("a|b")
+</code></pre>
+<figure class="link-to-page"><a href="Sub%20Page%20def456.html">Sub Page</a></figure>
+<table><thead><tr><th>Name</th><th>Role</th></tr></thead><tbody><tr><td>Ann | B</td></tr></tbody></table>
+</div></article><script>alert(1)</script></body></html>`
+	got, err := htmlToMarkdown([]byte(page), "")
+	if err != nil {
+		t.Fatalf("htmlToMarkdown() error: %v", err)
+	}
+	want := "# Project Plan\n\n" +
+		"| Status | Active |\n| --- | --- |\n\n" +
+		"## Goals\n\n" +
+		"Ship **v2** by March, see [Roadmap](Roadmap%20abc123.html) and [docs](https://example.com/x).\n\n" +
+		"- First\n  - Nested\n- Second\n\n" +
+		"1. One\n2. Two\n\n" +
+		"> Quoted\n> twice\n\n" +
+		"```go\nfmt.Println(\"a|b\")\n```\n\n" +
+		"[Sub Page](Sub%20Page%20def456.html)\n\n" +
+		"| Name | Role |\n| --- | --- |\n| Ann \\| B |  |\n"
+	if got != want {
+		t.Errorf("htmlToMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHTMLToMarkdownUsesTitle(t *testing.T) {
+	got, err := htmlToMarkdown([]byte(`<title>Saved page</title><p>Body <em>text</em></p>`), "")
+	if err != nil {
+		t.Fatalf("htmlToMarkdown() error: %v", err)
+	}
+	if got != "# Saved page\n\nBody *text*\n" {
+		t.Errorf("htmlToMarkdown() = %q", got)
+	}
+}
+
+func TestListNoteFilesHTML(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.md", "b.html", "c.HTM", "d.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("<p>x</p>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(html bool) string {
+		files, err := listNoteFiles(root, noteFormats{HTML: html}, nil, nil)
+		if err != nil {
+			t.Fatalf("listNoteFiles() error: %v", err)
+		}
+		var rels []string
+		for _, f := range files {
+			rels = append(rels, f.RelPath)
+		}
+		return strings.Join(rels, ",")
+	}
+	if got := names(false); got != "a.md" {
+		t.Errorf("markdown only = %s", got)
+	}
+	if got := names(true); got != "a.md,b.html,c.HTM" {
+		t.Errorf("with html = %s", got)
+	}
+	data, err := readNote(filepath.Join(root, "b.html"), nil)
+	if err != nil || string(data) != "x\n" {
+		t.Errorf("readNote() = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,178 @@
+package rag
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// defaultMaxIdleConnsPerHost keeps enough connections open for concurrent
+// searches and parallel embedding batches; net/http keeps only two by
+// default.
+const defaultMaxIdleConnsPerHost = 64
+
+type httpClientKey struct {
+	connectTimeout time.Duration
+	tlsTimeout     time.Duration
+	tuning         config.RagHTTPConfig
+}
+
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = map[httpClientKey]*http.Client{}
+)
+
+// defaultHTTPTuning is the rag.http setup of clients built without a rag
+// config at hand, such as those of NewEmbeddingClient and the remote vault
+// sources.
+var defaultHTTPTuning = config.RagHTTPConfig{HTTP2: true}
+
+// newHTTPClient returns a client with bounded connect and TLS handshake
+// phases and the connection pool and protocols of tuning, from rag.http.
+// The overall request deadline is applied per call through the context, so
+// it can scale with the size of the request. Clients with the same timeouts
+// and rag.http settings are shared, so every service, backend and language
+// route draws on one connection pool per host.
+func newHTTPClient(connectTimeout, tlsTimeout time.Duration, tuning config.RagHTTPConfig) *http.Client {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	key := httpClientKey{connectTimeout: connectTimeout, tlsTimeout: tlsTimeout, tuning: tuning}
+	if client, ok := httpClients[key]; ok {
+		return client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = tlsTimeout
+	transport.MaxIdleConnsPerHost = key.tuning.MaxIdleConnsPerHost
+	if transport.MaxIdleConnsPerHost <= 0 {
+		transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = key.tuning.MaxConnsPerHost
+	if key.tuning.IdleConnTimeoutSeconds > 0 {
+		transport.IdleConnTimeout = time.Duration(key.tuning.IdleConnTimeoutSeconds) * time.Second
+	}
+	transport.Protocols = httpProtocols(key.tuning)
+	transport.ForceAttemptHTTP2 = key.tuning.HTTP2 || key.tuning.H2C
+	client := &http.Client{Transport: transport}
+	httpClients[key] = client
+	return client
+}
+
+// httpProtocols picks the protocols of rag.http: HTTP/1.1, plus HTTP/2
+// where TLS negotiates it, or with h2c HTTP/2 only, also without TLS.
+func httpProtocols(tuning config.RagHTTPConfig) *http.Protocols {
+	p := new(http.Protocols)
+	switch {
+	case tuning.H2C:
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	case tuning.HTTP2:
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+	default:
+		p.SetHTTP1(true)
+	}
+	return p
+}
+
+func secondsOrDefault(seconds, fallback int) time.Duration {
+	if seconds <= 0 {
+		seconds = fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// gzipMinBytes is the smallest request body worth compressing.
+const gzipMinBytes = 1024
+
+// requestCompression gzips the request bodies sent to one endpoint, for
+// compress_requests. A server that refuses a compressed body with 400 or 415
+// gets the request again uncompressed; when that succeeds, compression stays
+// off for the endpoint from then on.
+type requestCompression struct {
+	off atomic.Bool
+}
+
+// newRequestCompression returns nil when compression is not enabled.
+func newRequestCompression(enabled bool) *requestCompression {
+	if !enabled {
+		return nil
+	}
+	return &requestCompression{}
+}
+
+// compressingClient returns client with its request bodies compressed by
+// comp, or client itself when comp is nil. The connection pool is shared.
+func compressingClient(client *http.Client, comp *requestCompression) *http.Client {
+	if comp == nil {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &gzipTransport{base: base, comp: comp}
+	return &wrapped
+}
+
+type gzipTransport struct {
+	base http.RoundTripper
+	comp *requestCompression
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.comp.off.Load() || req.Body == nil || req.GetBody == nil ||
+		req.ContentLength < gzipMinBytes || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// The original body is replaced by copies from GetBody.
+	req.Body.Close()
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	zw.Write(data)
+	zw.Close()
+	compressed := buf.Bytes()
+
+	zreq := req.Clone(req.Context())
+	zreq.Body = io.NopCloser(bytes.NewReader(compressed))
+	zreq.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(compressed)), nil }
+	zreq.ContentLength = int64(len(compressed))
+	zreq.Header.Set("Content-Encoding", "gzip")
+	resp, err := t.base.RoundTrip(zreq)
+	if err != nil || resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnsupportedMediaType {
+		return resp, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	plain := req.Clone(req.Context())
+	plain.Body = io.NopCloser(bytes.NewReader(data))
+	resp, err = t.base.RoundTrip(plain)
+	if err == nil && resp.StatusCode < 300 {
+		t.comp.off.Store(true)
+	}
+	return resp, err
+}
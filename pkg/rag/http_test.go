@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCompressingClient(t *testing.T) {
+	acceptGzip := true
+	var encodings []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			if !acceptGzip {
+				http.Error(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+
+	post := func(client *http.Client, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL, bytes.NewReader([]byte(body)))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	large := strings.Repeat(`{"input":"note text"}`, 100)
+
+	comp := newRequestCompression(true)
+	client := compressingClient(server.Client(), comp)
+	post(client, "small")
+	post(client, large)
+	if want := []string{"", "gzip"}; strings.Join(encodings, ",") != strings.Join(want, ",") {
+		t.Errorf("encodings = %q, want %q", encodings, want)
+	}
+	if bodies[1] != large {
+		t.Error("compressed body did not arrive intact")
+	}
+
+	// A server that cannot read gzip gets the request again uncompressed,
+	// and later requests are not compressed any more.
+	acceptGzip = false
+	encodings, bodies = nil, nil
+	if status := post(client, large); status != http.StatusOK {
+		t.Errorf("status after fallback = %d", status)
+	}
+	post(client, large)
+	if want := []string{"gzip", "", ""}; strings.Join(encodings, ",") != strings.Join(want, ",") {
+		t.Errorf("encodings = %q, want %q", encodings, want)
+	}
+	if len(bodies) != 2 || bodies[0] != large {
+		t.Error("uncompressed retry lost the body")
+	}
+	if !comp.off.Load() {
+		t.Error("compression still on after the server refused it")
+	}
+
+	if c := compressingClient(server.Client(), newRequestCompression(false)); c != server.Client() {
+		t.Error("compressingClient() wrapped the client without compression")
+	}
+}
+
+func TestNewHTTPClientTuning(t *testing.T) {
+	tuning := config.RagHTTPConfig{HTTP2: true, MaxConnsPerHost: 8, IdleConnTimeoutSeconds: 30}
+	tuned := newHTTPClient(time.Second, 2*time.Second, tuning)
+	if again := newHTTPClient(time.Second, 2*time.Second, tuning); again != tuned {
+		t.Error("clients with the same settings are not shared")
+	}
+	transport := tuned.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || transport.MaxConnsPerHost != 8 ||
+		transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("pool = %d idle per host, %d per host, %s idle timeout",
+			transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+	if p := transport.Protocols; !p.HTTP1() || !p.HTTP2() || p.UnencryptedHTTP2() {
+		t.Errorf("protocols = %s, want HTTP1 and HTTP2", p)
+	}
+
+	h2c := newHTTPClient(time.Second, 2*time.Second, config.RagHTTPConfig{H2C: true})
+	if h2c == tuned {
+		t.Fatal("other rag.http settings reused the same client")
+	}
+	if p := h2c.Transport.(*http.Transport).Protocols; p.HTTP1() || !p.UnencryptedHTTP2() {
+		t.Errorf("h2c protocols = %s", p)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+	resp, err := h2c.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if proto, _ := io.ReadAll(resp.Body); string(proto) != "HTTP/2.0" {
+		t.Errorf("h2c request used %s", proto)
+	}
+}
+
+func TestServicesKeepTheirHTTPTuning(t *testing.T) {
+	pool := func(maxConns int) int {
+		cfg := config.DefaultConfig()
+		cfg.RAG.Enabled = true
+		cfg.RAG.Embedding.APIBase = "http://localhost:11434/v1"
+		cfg.RAG.Embedding.Model = "m"
+		cfg.RAG.HTTP.MaxConnsPerHost = maxConns
+		s, err := NewService(cfg, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := s.embedder.(*EmbeddingClient).httpClient.Transport
+		if gz, ok := transport.(*gzipTransport); ok {
+			transport = gz.base
+		}
+		return transport.(*http.Transport).MaxConnsPerHost
+	}
+	if a, b := pool(4), pool(16); a != 4 || b != 16 {
+		t.Errorf("MaxConnsPerHost = %d and %d, want each service's rag.http setting", a, b)
+	}
+}
@@ -4,80 +4,121 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 type indexer struct {
-	cfg       config.RagConfig
-	workspace string
-	embedder  *EmbeddingClient
-	qdrant    *QdrantClient
+	cfg config.RagConfig
+	// storage holds the index state and caches.
+	storage  Storage
+	embedder Embedder
+	store    VectorStore
+	log      Logger
+	now      func() time.Time
+	// language is the language this indexer's backend owns, or "" for the
+	// default backend, which takes every language not listed in routed.
+	language string
+	routed   []string
+	// boilerplate is set up by run or reindexPaths before files are indexed.
+	boilerplate *boilerplate
+	// transcripts is nil unless rag.transcription is enabled.
+	transcripts *transcripts
+	// onFileDone, if set, is told about every file the indexer handled.
+	onFileDone func(ctx context.Context, result IndexFileResult)
+	// summarize writes the summary levels of rag.hierarchical.
+	summarize Summarizer
+	// synonyms expands the embedded text when rag.synonyms_in_index is on,
+	// and is nil otherwise.
+	synonyms *synonymExpander
 }
 
-func newIndexer(cfg config.RagConfig, workspace string, embedder *EmbeddingClient, qdrant *QdrantClient) *indexer {
-	return &indexer{
-		cfg:       cfg,
-		workspace: workspace,
-		embedder:  embedder,
-		qdrant:    qdrant,
+func newIndexer(cfg config.RagConfig, storage Storage, embedder Embedder, store VectorStore) *indexer {
+	i := &indexer{
+		cfg:         cfg,
+		storage:     storage,
+		embedder:    embedder,
+		store:       store,
+		log:         defaultLogger{},
+		now:         time.Now,
+		transcripts: newTranscripts(cfg.Transcription, storage),
 	}
+	if cfg.SynonymsInIndex {
+		// NewService has rejected invalid synonyms already.
+		i.synonyms, _ = newSynonymExpander(cfg.Synonyms)
+	}
+	return i
 }
 
 func (i *indexer) run(ctx context.Context, opts IndexOptions) (*IndexSummary, error) {
-	vaultPath := expandHome(i.cfg.VaultPath)
-	if vaultPath == "" {
-		return nil, fmt.Errorf("rag.vault_path is required")
+	defer i.limitMemory()()
+	v, err := newVault(i.cfg.VaultPath)
+	if err != nil {
+		return nil, err
 	}
-	info, err := os.Stat(vaultPath)
-	if err != nil || !info.IsDir() {
-		return nil, fmt.Errorf("vault path not found: %s", vaultPath)
+	v.formats = noteFormatsOf(i.cfg)
+	if err := v.check(); err != nil {
+		return nil, err
 	}
 
-	statePath := filepath.Join(i.workspace, "rag", "index_state.json")
-	state, _ := loadIndexState(statePath)
+	state, _ := i.loadState()
 
-	reindexAll := opts.ReindexAll
-	if state == nil {
-		reindexAll = true
+	meta, err := i.collectionMetadata(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if state != nil && !reindexAll {
-		if state.EmbeddingModel != i.embedder.Model() {
-			reindexAll = true
+	reason := "requested"
+	if !opts.ReindexAll {
+		reason = reindexReason(state, i.cfg, i.embedder.Model(), i.store.Collection())
+		if reason == "" && !stringSliceEqual(state.RoutedLanguages, i.routed) {
+			reason = "language routes changed"
 		}
-		if state.ChunkSize != i.cfg.ChunkSize || state.ChunkOverlap != i.cfg.ChunkOverlap {
-			reindexAll = true
-		}
-		if !stringSliceEqual(state.IncludePatterns, i.cfg.IncludePatterns) ||
-			!stringSliceEqual(state.ExcludePatterns, i.cfg.ExcludePatterns) {
-			reindexAll = true
-		}
-		if state.Collection != i.qdrant.Collection() {
-			reindexAll = true
+		if reason == "" {
+			reason = i.metadataReindexReason(meta)
 		}
 	}
 
-	files, err := listMarkdownFiles(vaultPath, i.cfg.IncludePatterns, i.cfg.ExcludePatterns)
+	files, err := v.list(i.cfg.IncludePatterns, i.cfg.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := boilerplateRules(i.cfg.Boilerplate)
+	detected, err := detectBoilerplateLines(files, i.cfg.Boilerplate.AutoDetectPercent, i.cfg.Boilerplate.AutoDetectMinDocs)
 	if err != nil {
 		return nil, err
 	}
+	if i.boilerplate, err = newBoilerplate(i.cfg.Boilerplate, detected); err != nil {
+		return nil, err
+	}
+	if reason == "" && (!stringSliceEqual(state.BoilerplateRules, rules) || !stringSliceEqual(state.BoilerplateLines, detected)) {
+		reason = "boilerplate rules changed"
+	}
+	reindexAll := reason != ""
 
 	currentFiles := make(map[string]int64, len(files))
 	for _, f := range files {
 		currentFiles[f.RelPath] = f.MTime
 	}
+	if err := i.checkMassDelete(v, state, currentFiles, opts); err != nil {
+		return nil, err
+	}
 
 	if state == nil {
 		state = &indexState{
-			Version: 1,
-			Files:   map[string]int64{},
+			Version:       1,
+			Files:         map[string]int64{},
+			OtherLanguage: map[string]int64{},
 		}
 	}
 
@@ -90,7 +131,7 @@ func (i *indexer) run(ctx context.Context, opts IndexOptions) (*IndexSummary, er
 		if dim <= 0 {
 			return fmt.Errorf("invalid embedding dimension")
 		}
-		if err := i.qdrant.EnsureCollection(ctx, dim, reindexAll); err != nil {
+		if err := i.store.EnsureCollection(ctx, dim, reindexAll); err != nil {
 			return err
 		}
 		state.EmbeddingDimension = dim
@@ -103,117 +144,534 @@ func (i *indexer) run(ctx context.Context, opts IndexOptions) (*IndexSummary, er
 		}
 	}
 
-	summary := &IndexSummary{TotalFiles: len(files)}
+	summary := &IndexSummary{TotalFiles: len(files), FullReindexReason: reason}
 
 	if reindexAll {
 		state.Files = map[string]int64{}
+		state.Chunks = nil
+		state.OtherLanguage = map[string]int64{}
+	}
+	for path := range state.OtherLanguage {
+		if _, ok := currentFiles[path]; !ok {
+			delete(state.OtherLanguage, path)
+		}
 	}
 
+	for from, to := range state.detectMoves(currentFiles) {
+		i.log.Info("Note moved, keeping its document ID", map[string]interface{}{
+			"from": from,
+			"to":   to,
+		})
+	}
 	for path := range state.Files {
 		if _, ok := currentFiles[path]; !ok {
-			if err := i.qdrant.DeleteByPath(ctx, path); err != nil {
+			if err := i.deletePath(ctx, state, path, TrashRemoved); err != nil {
 				return nil, err
 			}
-			delete(state.Files, path)
+			state.untrackFile(path)
 			summary.RemovedFiles++
+			i.record(ctx, summary, opts, IndexFileResult{Path: path, Action: IndexActionRemoved})
 		}
 	}
 
 	for _, file := range files {
-		mt := file.MTime
+		if stopRequested(opts.Stop) {
+			summary.Stopped = true
+			break
+		}
 		if !reindexAll {
-			if prev, ok := state.Files[file.RelPath]; ok && prev == mt {
+			if prev, ok := state.Files[file.RelPath]; ok && prev == file.MTime {
 				summary.SkippedFiles++
+				i.record(ctx, summary, opts, IndexFileResult{Path: file.RelPath, Action: IndexActionSkipped})
+				continue
+			}
+			if prev, ok := state.OtherLanguage[file.RelPath]; ok && prev == file.MTime {
 				continue
 			}
 		}
 
-		content, err := os.ReadFile(file.AbsPath)
+		_, existed := state.Files[file.RelPath]
+		fileStart := time.Now()
+		chunks, err := i.indexFile(ctx, state, file, ensureCollection)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read %s: %w", file.AbsPath, err)
+			if !opts.ContinueOnError || abortsIndexRun(ctx, err) {
+				return nil, err
+			}
+			failure := IndexFileResult{
+				Path:     file.RelPath,
+				Action:   IndexActionFailed,
+				Duration: time.Since(fileStart),
+				Error:    err.Error(),
+			}
+			summary.FailedFiles++
+			summary.Failures = append(summary.Failures, failure)
+			i.record(ctx, summary, opts, failure)
+			continue
 		}
-
-		chunks := chunkMarkdown(file.RelPath, string(content), i.cfg.ChunkSize, i.cfg.ChunkOverlap)
-		if len(chunks) == 0 {
-			state.Files[file.RelPath] = mt
+		if chunks == 0 {
 			continue
 		}
+		summary.Chunks += chunks
+		action := IndexActionIndexed
+		if existed && !reindexAll {
+			action = IndexActionUpdated
+			summary.UpdatedFiles++
+		} else {
+			summary.IndexedFiles++
+		}
+		i.record(ctx, summary, opts, IndexFileResult{
+			Path:     file.RelPath,
+			Action:   action,
+			Chunks:   chunks,
+			Duration: time.Since(fileStart),
+		})
+	}
 
-		if err := i.qdrant.DeleteByPath(ctx, file.RelPath); err != nil {
-			return nil, err
+	state.Collection = i.store.Collection()
+	state.ChunkerVersion = chunkerVersion
+	state.EmbeddingModel = i.embedder.Model()
+	state.ChunkSize = i.cfg.ChunkSize
+	state.ChunkOverlap = i.cfg.ChunkOverlap
+	state.MinChunkChars = i.cfg.MinChunkChars
+	state.IncludePatterns = append([]string{}, i.cfg.IncludePatterns...)
+	state.ExcludePatterns = append([]string{}, i.cfg.ExcludePatterns...)
+	state.RoutedLanguages = append([]string{}, i.routed...)
+	state.BoilerplateRules = rules
+	state.BoilerplateLines = detected
+	state.Synonyms = indexSynonymsKey(i.cfg.Synonyms, i.cfg.SynonymsInIndex)
+	state.VaultMounts = vaultMounts(v)
+	if !summary.Stopped {
+		state.pruneDocIDs(currentFiles)
+	}
+
+	if reindexAll {
+		// The recreated collection holds a per-note point for every note
+		// written in this run, and none otherwise.
+		state.Documents = i.cfg.TwoStage.Enabled && !summary.Stopped
+	}
+	changed := reindexAll || summary.IndexedFiles+summary.UpdatedFiles+summary.RemovedFiles > 0
+	if !summary.Stopped && state.EmbeddingDimension > 0 {
+		if err := i.updateDocuments(ctx, state); err != nil {
+			i.log.Warn("Failed to update per-note vectors", map[string]interface{}{
+				"collection": i.store.Collection(),
+				"error":      err.Error(),
+			})
+		}
+		if err := i.updateSummaries(ctx, state, changed); err != nil {
+			i.log.Warn("Failed to update summary levels", map[string]interface{}{
+				"collection": i.store.Collection(),
+				"error":      err.Error(),
+			})
 		}
+	} else if changed && state.Summaries != "" {
+		state.SummariesStale = true
+	}
+	if i.language == "" && i.cfg.Spelling.Enabled && !summary.Stopped {
+		if _, err := i.storage.Stat(vocabularyFile); changed || err != nil {
+			if err := i.buildVocabulary(files); err != nil {
+				i.log.Warn("Failed to build the spelling vocabulary", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+
+	if err := i.saveState(state); err != nil {
+		return nil, err
+	}
+	if changed {
+		i.recordHistory(state)
+	}
+	i.saveMetadata(ctx, state.EmbeddingDimension)
+	i.pushState(ctx, state)
+
+	return summary, nil
+}
+
+func stopRequested(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// abortsIndexRun reports whether err would make every remaining file fail
+// too, so continuing the run is pointless.
+func abortsIndexRun(ctx context.Context, err error) bool {
+	return ctx.Err() != nil ||
+		errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrDimensionMismatch) ||
+		errors.Is(err, ErrCollectionMissing)
+}
+
+func (i *indexer) record(ctx context.Context, summary *IndexSummary, opts IndexOptions, result IndexFileResult) {
+	if opts.Detail {
+		summary.Files = append(summary.Files, result)
+	}
+	i.fileDone(ctx, result)
+}
+
+func (i *indexer) fileDone(ctx context.Context, result IndexFileResult) {
+	if i.onFileDone != nil {
+		i.onFileDone(ctx, result)
+	}
+}
+
+// reindexReason explains why the existing index cannot be updated
+// incrementally, or returns "" when it can.
+func reindexReason(state *indexState, cfg config.RagConfig, model, collection string) string {
+	switch {
+	case state == nil:
+		return "no previous index"
+	case state.ChunkerVersion != chunkerVersion:
+		return fmt.Sprintf("chunker version changed (%d -> %d)", state.ChunkerVersion, chunkerVersion)
+	case state.EmbeddingModel != model:
+		return "embedding model changed"
+	case state.ChunkSize != cfg.ChunkSize || state.ChunkOverlap != cfg.ChunkOverlap ||
+		state.MinChunkChars != cfg.MinChunkChars:
+		return "chunk settings changed"
+	case !stringSliceEqual(state.IncludePatterns, cfg.IncludePatterns) ||
+		!stringSliceEqual(state.ExcludePatterns, cfg.ExcludePatterns):
+		return "include/exclude patterns changed"
+	case state.Collection != collection:
+		return "collection changed"
+	case state.Synonyms != indexSynonymsKey(cfg.Synonyms, cfg.SynonymsInIndex):
+		return "synonyms changed"
+	}
+	return ""
+}
+
+// indexFile replaces all points of a single file and records its mtime in state.
+// It returns the number of chunks written.
+func (i *indexer) indexFile(ctx context.Context, state *indexState, file fileEntry, ensureCollection func(int) error) (int, error) {
+	if err := i.pause(ctx); err != nil {
+		return 0, err
+	}
+	mt := file.MTime
+	if i.transcripts != nil && isAudioFile(file.AbsPath) {
+		if err := i.transcripts.ensure(ctx, ioPath(file.AbsPath)); err != nil {
+			return 0, fmt.Errorf("failed to transcribe %s: %w", file.AbsPath, err)
+		}
+	}
+	content, err := readNote(ioPath(file.AbsPath), i.transcripts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", file.AbsPath, err)
+	}
 
-		batchSize := i.embedder.BatchSize()
-		for start := 0; start < len(chunks); start += batchSize {
-			end := start + batchSize
-			if end > len(chunks) {
-				end = len(chunks)
+	text := normalizeText(string(content))
+	if !i.accepts(text) {
+		// The note belongs to another language backend now; drop any
+		// vectors this backend still holds for it.
+		if _, ok := state.Files[file.RelPath]; ok {
+			if err := i.deletePath(ctx, state, file.RelPath, TrashChanged); err != nil {
+				return 0, err
 			}
-			batch := chunks[start:end]
+			state.untrackFile(file.RelPath)
+		}
+		state.OtherLanguage[file.RelPath] = mt
+		return 0, nil
+	}
+	delete(state.OtherLanguage, file.RelPath)
+	meta := parseFrontmatter(text)
+	declared := meta.ID
+	meta.ID = state.assignDocID(file.RelPath, declared)
+	if declared == "" && i.cfg.Index.WriteIDs && i.writableNote(file) {
+		if written, mtime, err := writeDocID(ioPath(file.AbsPath), content, meta.ID); err != nil {
+			i.log.Warn("Failed to write the document ID to the note", map[string]interface{}{
+				"path":  file.RelPath,
+				"error": err.Error(),
+			})
+		} else {
+			text = normalizeText(string(written))
+			mt, file.MTime = mtime, mtime
+		}
+	}
+	c := newChunker(i.cfg.ChunkSize, i.cfg.ChunkOverlap)
+	c.minChunkChars = i.cfg.MinChunkChars
+	chunks := c.chunk(file.RelPath, i.boilerplate.strip(text))
+	if alias, ok := aliasChunk(file.RelPath, meta); ok {
+		chunks = append(chunks, alias)
+	}
+	if len(chunks) == 0 {
+		state.trackFile(file.RelPath, mt, 0)
+		return 0, nil
+	}
+
+	if err := i.deletePath(ctx, state, file.RelPath, TrashChanged); err != nil {
+		return 0, err
+	}
+
+	fileHash := hashContent([]byte(text))
+	written := 0
+	var sum []float64
+	for _, group := range i.embedGroups(state, chunks) {
+		i.relieveMemory()
+		groupEmbeddings, err := i.embedBatches(ctx, group)
+		if err != nil {
+			return 0, err
+		}
+		for gi, batch := range group {
+			n, err := i.writeBatch(ctx, state, file, meta, fileHash, batch, groupEmbeddings[gi], ensureCollection)
+			if err != nil {
+				return 0, err
+			}
+			written += n
+			for _, emb := range groupEmbeddings[gi] {
+				sum = addVector(sum, emb)
+			}
+		}
+	}
+	if i.cfg.TwoStage.Enabled {
+		if err := i.store.Upsert(ctx, []QdrantPoint{i.documentPoint(file.RelPath, meta, sum, written)}); err != nil {
+			return 0, err
+		}
+	}
+
+	state.trackFile(file.RelPath, mt, written)
+	return written, nil
+}
+
+func splitChunks(chunks []chunk, size int) [][]chunk {
+	var batches [][]chunk
+	for start := 0; start < len(chunks); start += size {
+		end := start + size
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		batches = append(batches, chunks[start:end])
+	}
+	return batches
+}
+
+// embedBatches embeds each batch in its own concurrent request and returns
+// the embeddings aligned with batches.
+func (i *indexer) embedBatches(ctx context.Context, batches [][]chunk) ([][][]float64, error) {
+	results := make([][][]float64, len(batches))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for bi, batch := range batches {
+		wg.Add(1)
+		go func(bi int, batch []chunk) {
+			defer wg.Done()
 			texts := make([]string, len(batch))
 			for idx, ch := range batch {
-				texts[idx] = ch.Content
+				texts[idx] = i.synonyms.expand(ch.Content)
 			}
 			embeddings, err := i.embedder.EmbedBatch(ctx, texts)
-			if err != nil {
-				return nil, err
+			if err == nil && len(embeddings) != len(batch) {
+				err = fmt.Errorf("embedding result size mismatch")
 			}
-			if len(embeddings) != len(batch) {
-				return nil, fmt.Errorf("embedding result size mismatch")
+			results[bi], errs[bi] = embeddings, err
+		}(bi, batch)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// writeBatch upserts one embedded batch of a file's chunks and returns the
+// number of points written.
+func (i *indexer) writeBatch(ctx context.Context, state *indexState, file fileEntry, meta noteMeta, fileHash string, batch []chunk, embeddings [][]float64, ensureCollection func(int) error) (int, error) {
+	mt := file.MTime
+	if state.EmbeddingDimension == 0 {
+		dimension := len(embeddings[0])
+		if i.cfg.Embedding.Dimension > 0 && i.cfg.Embedding.Dimension != dimension {
+			return 0, fmt.Errorf("%w: got %d expected %d", ErrDimensionMismatch, dimension, i.cfg.Embedding.Dimension)
+		}
+		if err := ensureCollection(dimension); err != nil {
+			return 0, err
+		}
+	}
+
+	points := make([]QdrantPoint, 0, len(batch))
+	for idx, ch := range batch {
+		emb := embeddings[idx]
+		payload := map[string]interface{}{
+			"path":            ch.Path,
+			"heading":         ch.Heading,
+			"heading_path":    stringsPayload(ch.HeadingPath),
+			"heading_level":   ch.HeadingLevel,
+			"anchor":          ch.Anchor,
+			"start_line":      ch.StartLine,
+			"end_line":        ch.EndLine,
+			"content":         ch.Content,
+			"mtime":           mt,
+			"file_hash":       fileHash,
+			"doc_id":          meta.ID,
+			"tags":            stringsPayload(meta.Tags),
+			"chunker_version": chunkerVersion,
+		}
+		if date, ok := noteDate(file.RelPath, meta, i.cfg.DailyNoteFormat); ok {
+			payload["note_date"] = date.Unix()
+		}
+		if start, end, ok := transcriptSpan(ch.Content); ok && isAudioFile(file.RelPath) {
+			payload["audio_start"] = start
+			payload["audio_end"] = end
+		}
+		if meta.Book != "" {
+			payload["book"] = meta.Book
+			if meta.Author != "" {
+				payload["author"] = meta.Author
 			}
-			if state.EmbeddingDimension == 0 {
-				dimension = len(embeddings[0])
-				if i.cfg.Embedding.Dimension > 0 && i.cfg.Embedding.Dimension != dimension {
-					return nil, fmt.Errorf("embedding dimension mismatch: got %d expected %d", dimension, i.cfg.Embedding.Dimension)
-				}
-				if err := ensureCollection(dimension); err != nil {
-					return nil, err
-				}
+			if len(ch.HeadingPath) > 0 {
+				payload["chapter"] = ch.HeadingPath[0]
 			}
+		}
+		// The alias chunk covers the same lines as the first body chunk
+		// can, so it gets its own ID namespace.
+		idPath := file.RelPath
+		if len(ch.Aliases) > 0 {
+			payload["aliases"] = ch.Aliases
+			idPath += "#aliases"
+		}
+		points = append(points, QdrantPoint{
+			ID:      hashPointID(idPath, ch.StartLine, ch.EndLine),
+			Vector:  emb,
+			Payload: payload,
+		})
+	}
+	if err := i.store.Upsert(ctx, points); err != nil {
+		return 0, err
+	}
+	return len(points), nil
+}
 
-			points := make([]QdrantPoint, 0, len(batch))
-			for idx, ch := range batch {
-				emb := embeddings[idx]
-				pointID := hashPointID(file.RelPath, ch.StartLine, ch.EndLine)
-				points = append(points, QdrantPoint{
-					ID:     pointID,
-					Vector: emb,
-					Payload: map[string]interface{}{
-						"path":       ch.Path,
-						"heading":    ch.Heading,
-						"start_line": ch.StartLine,
-						"end_line":   ch.EndLine,
-						"content":    ch.Content,
-						"mtime":      mt,
-					},
-				})
-				summary.Chunks++
+// reindexPaths refreshes the given vault-relative files against an existing
+// index without walking the whole vault. Files that no longer exist are removed.
+func (i *indexer) reindexPaths(ctx context.Context, paths []string) error {
+	defer i.limitMemory()()
+	v, err := newVault(i.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	state, err := i.loadState()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexNotBuilt, err)
+	}
+	if state.ChunkerVersion != chunkerVersion {
+		// Adding new-format chunks to an old index would leave it mixed.
+		return fmt.Errorf("%w: chunker version %d, need %d", ErrIndexOutdated, state.ChunkerVersion, chunkerVersion)
+	}
+	if !stringSliceEqual(state.BoilerplateRules, boilerplateRules(i.cfg.Boilerplate)) {
+		return fmt.Errorf("%w: boilerplate rules changed", ErrIndexOutdated)
+	}
+	if state.Synonyms != indexSynonymsKey(i.cfg.Synonyms, i.cfg.SynonymsInIndex) {
+		return fmt.Errorf("%w: synonyms changed", ErrIndexOutdated)
+	}
+	meta, err := i.collectionMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	if reason := i.metadataReindexReason(meta); reason != "" {
+		return fmt.Errorf("%w: %s", ErrIndexOutdated, reason)
+	}
+	if i.boilerplate, err = newBoilerplate(i.cfg.Boilerplate, state.BoilerplateLines); err != nil {
+		return err
+	}
+
+	ensureCollection := func(dim int) error {
+		if dim <= 0 {
+			return fmt.Errorf("invalid embedding dimension")
+		}
+		if err := i.store.EnsureCollection(ctx, dim, false); err != nil {
+			return err
+		}
+		state.EmbeddingDimension = dim
+		return nil
+	}
+
+	for _, rel := range paths {
+		// A path under a root that is no longer configured counts as gone.
+		absPath, known := v.abs(rel)
+		info, err := os.Stat(ioPath(absPath))
+		if !known || err != nil || info.IsDir() {
+			if root, _, ok := v.locate(rel); ok {
+				// Notes of an unmounted volume stay indexed until an index
+				// run, where checkMassDelete decides.
+				if unmounted, empty := rootMissing(root, state); unmounted != "" || empty {
+					continue
+				}
 			}
-			if err := i.qdrant.Upsert(ctx, points); err != nil {
-				return nil, err
+			if err := i.deletePath(ctx, state, rel, TrashRemoved); err != nil {
+				return err
 			}
+			state.untrackFile(rel)
+			i.fileDone(ctx, IndexFileResult{Path: rel, Action: IndexActionRemoved})
+			continue
 		}
-
-		if _, ok := state.Files[file.RelPath]; ok && !reindexAll {
-			summary.UpdatedFiles++
-		} else {
-			summary.IndexedFiles++
+		file := fileEntry{
+			AbsPath: absPath,
+			RelPath: rel,
+			MTime:   info.ModTime().UnixNano(),
+		}
+		fileStart := time.Now()
+		chunks, err := i.indexFile(ctx, state, file, ensureCollection)
+		if err != nil {
+			return err
+		}
+		if chunks > 0 {
+			i.fileDone(ctx, IndexFileResult{
+				Path:     rel,
+				Action:   IndexActionUpdated,
+				Chunks:   chunks,
+				Duration: time.Since(fileStart),
+			})
 		}
-		state.Files[file.RelPath] = mt
 	}
 
-	state.Collection = i.qdrant.Collection()
-	state.EmbeddingModel = i.embedder.Model()
-	state.ChunkSize = i.cfg.ChunkSize
-	state.ChunkOverlap = i.cfg.ChunkOverlap
-	state.IncludePatterns = append([]string{}, i.cfg.IncludePatterns...)
-	state.ExcludePatterns = append([]string{}, i.cfg.ExcludePatterns...)
+	// Rebuilding the summaries would keep a search waiting; the next index
+	// run does it.
+	if state.Summaries != "" {
+		state.SummariesStale = true
+	}
+	if err := i.saveState(state); err != nil {
+		return err
+	}
+	i.recordHistory(state)
+	i.pushState(ctx, state)
+	return nil
+}
 
-	if err := saveIndexState(statePath, state); err != nil {
-		return nil, err
+// stateName is where the index state of the indexer's backend is stored.
+func (i *indexer) stateName() string {
+	if i.language != "" {
+		return "index_state." + i.language + ".json"
 	}
+	return "index_state.json"
+}
 
-	return summary, nil
+func (i *indexer) loadState() (*indexState, error) {
+	return loadIndexState(i.storage, i.stateName(), i.log)
+}
+
+// saveState stamps state with the current time and saves it.
+func (i *indexer) saveState(state *indexState) error {
+	state.UpdatedAt = i.now().Format(time.RFC3339)
+	return writeIndexState(i.storage, i.stateName(), state, i.log)
+}
+
+// accepts reports whether a note with this text belongs to the indexer's
+// backend. Without language routes everything belongs to the default backend.
+func (i *indexer) accepts(text string) bool {
+	if i.language == "" && len(i.routed) == 0 {
+		return true
+	}
+	lang := detectLanguage(text)
+	if i.language != "" {
+		return lang == i.language
+	}
+	for _, routed := range i.routed {
+		if lang == routed {
+			return false
+		}
+	}
+	return true
 }
 
 type fileEntry struct {
@@ -222,8 +680,8 @@ type fileEntry struct {
 	MTime   int64
 }
 
-func listMarkdownFiles(root string, includePatterns, excludePatterns []string) ([]fileEntry, error) {
-	root = filepath.Clean(root)
+func listNoteFiles(root string, formats noteFormats, includePatterns, excludePatterns []string) ([]fileEntry, error) {
+	root = ioPath(filepath.Clean(root))
 	includeRegex := compilePatterns(includePatterns)
 	excludeRegex := compilePatterns(excludePatterns)
 
@@ -235,14 +693,14 @@ func listMarkdownFiles(root string, includePatterns, excludePatterns []string) (
 		if d.IsDir() {
 			return nil
 		}
-		if filepath.Ext(path) != ".md" {
+		if !isNoteFile(path, formats) {
 			return nil
 		}
 		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
-		rel = filepath.ToSlash(rel)
+		rel = logicalPath(rel)
 		if matchesAny(rel, excludeRegex) {
 			return nil
 		}
@@ -283,7 +741,7 @@ func compilePatterns(patterns []string) []*regexp.Regexp {
 }
 
 func globToRegex(pattern string) (*regexp.Regexp, error) {
-	pattern = filepath.ToSlash(pattern)
+	pattern = slashPath(pattern)
 	var sb strings.Builder
 	sb.WriteString("^")
 	for i := 0; i < len(pattern); i++ {
@@ -320,11 +778,25 @@ func matchesAny(path string, patterns []*regexp.Regexp) bool {
 	return false
 }
 
+// stringsPayload stores an empty array rather than null so payload filters
+// can treat every point the same way.
+func stringsPayload(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
 func hashPointID(path string, startLine, endLine int) string {
 	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", path, startLine, endLine)))
 	return hex.EncodeToString(sum[:])
 }
 
+func hashContent(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func stringSliceEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -336,17 +808,3 @@ func stringSliceEqual(a, b []string) bool {
 	}
 	return true
 }
-
-func expandHome(path string) string {
-	if path == "" {
-		return path
-	}
-	if path[0] == '~' {
-		home, _ := os.UserHomeDir()
-		if len(path) > 1 && path[1] == '/' {
-			return filepath.Join(home, path[2:])
-		}
-		return home
-	}
-	return path
-}
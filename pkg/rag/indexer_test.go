@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestReindexReason(t *testing.T) {
+	cfg := config.RagConfig{ChunkSize: 800, ChunkOverlap: 120}
+	current := func() *indexState {
+		return &indexState{
+			ChunkerVersion: chunkerVersion,
+			EmbeddingModel: "m",
+			Collection:     "c",
+			ChunkSize:      800,
+			ChunkOverlap:   120,
+		}
+	}
+
+	if got := reindexReason(current(), cfg, "m", "c"); got != "" {
+		t.Errorf("up-to-date state: got reason %q", got)
+	}
+	if got := reindexReason(nil, cfg, "m", "c"); got == "" {
+		t.Error("missing state should force a full reindex")
+	}
+
+	old := current()
+	old.ChunkerVersion = chunkerVersion - 1
+	if got := reindexReason(old, cfg, "m", "c"); got == "" {
+		t.Error("older chunker version should force a full reindex")
+	}
+
+	resized := current()
+	resized.ChunkSize = 400
+	if got := reindexReason(resized, cfg, "m", "c"); got == "" {
+		t.Error("chunk size change should force a full reindex")
+	}
+}
+
+func TestAbortsIndexRun(t *testing.T) {
+	ctx := t.Context()
+	if abortsIndexRun(ctx, fmt.Errorf("failed to read a.md: %w", os.ErrPermission)) {
+		t.Error("a single unreadable file should not abort the run")
+	}
+	if !abortsIndexRun(ctx, &UnavailableError{Backend: "embedding"}) {
+		t.Error("an unavailable backend should abort the run")
+	}
+	if !abortsIndexRun(ctx, fmt.Errorf("%w: got 3 expected 4", ErrDimensionMismatch)) {
+		t.Error("a dimension mismatch should abort the run")
+	}
+}
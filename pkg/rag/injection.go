@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Context injection modes and positions; see config.RagInjectionConfig.
+const (
+	InjectionUserSuffix          = "user_suffix"
+	InjectionUserPrefix          = "user_prefix"
+	InjectionSystem              = "system"
+	InjectionAssistantToolResult = "assistant_tool_result"
+
+	InjectionBeforeUser  = "before_user"
+	InjectionAfterSystem = "after_system"
+
+	InjectionFormatText = "text"
+	InjectionFormatJSON = "json"
+)
+
+// normalizeInjection fills in the defaults and rejects unknown values.
+func normalizeInjection(cfg config.RagInjectionConfig) (config.RagInjectionConfig, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = InjectionUserSuffix
+	case InjectionUserSuffix, InjectionUserPrefix, InjectionSystem, InjectionAssistantToolResult:
+	default:
+		return cfg, fmt.Errorf("rag.injection.mode: unknown mode %q", cfg.Mode)
+	}
+	switch cfg.Position {
+	case "":
+		cfg.Position = InjectionBeforeUser
+	case InjectionBeforeUser, InjectionAfterSystem:
+	default:
+		return cfg, fmt.Errorf("rag.injection.position: unknown position %q", cfg.Position)
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = InjectionFormatText
+	case InjectionFormatText, InjectionFormatJSON:
+	default:
+		return cfg, fmt.Errorf("rag.injection.format: unknown format %q", cfg.Format)
+	}
+	return cfg, nil
+}
+
+// Injection returns where the agent should place the context built by
+// FormatContext.
+func (s *Service) Injection() config.RagInjectionConfig {
+	return s.cfg.Injection
+}
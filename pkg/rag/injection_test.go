@@ -0,0 +1,20 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNormalizeInjection(t *testing.T) {
+	got, err := normalizeInjection(config.RagInjectionConfig{})
+	if err != nil || got.Mode != InjectionUserSuffix || got.Position != InjectionBeforeUser {
+		t.Errorf("normalizeInjection(zero) = %+v, %v", got, err)
+	}
+	if _, err := normalizeInjection(config.RagInjectionConfig{Mode: "footer"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := normalizeInjection(config.RagInjectionConfig{Mode: InjectionSystem, Position: "middle"}); err == nil {
+		t.Error("expected an error for an unknown position")
+	}
+}
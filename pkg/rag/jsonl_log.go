@@ -0,0 +1,60 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// The query log and the route log are JSONL logs: one JSON object with a
+// "time" field per line, moved to "<name>.1" once it reaches its size limit,
+// replacing the previous one.
+
+// appendLogEntry appends entry to the log name in st, first rotating a log
+// the line would take past maxBytes. Callers serialize appends to a log.
+func appendLogEntry(st Storage, name string, maxBytes int64, entry interface{}) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line := append(data, '\n')
+	if info, err := st.Stat(name); err == nil && info.Size()+int64(len(line)) > maxBytes {
+		if err := st.Rename(name, name+".1"); err != nil {
+			return err
+		}
+	}
+	return st.AppendFile(name, line)
+}
+
+// readLogSince calls fn with each line of the log name in st, including the
+// rotated file, that was logged at or after since, oldest first. Lines that
+// do not parse are skipped.
+func readLogSince(st Storage, name string, since time.Time, fn func(line []byte)) error {
+	for _, file := range []string{name + ".1", name} {
+		data, err := st.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			var head struct {
+				Time time.Time `json:"time"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &head) != nil || head.Time.Before(since) {
+				continue
+			}
+			fn(scanner.Bytes())
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
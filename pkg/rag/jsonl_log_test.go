@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONLLog(t *testing.T) {
+	st := NewMemoryStorage()
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	type entry struct {
+		Time time.Time `json:"time"`
+		N    int       `json:"n"`
+	}
+	// Each line is 38 bytes, so the log rotates every two entries.
+	for n := 0; n < 5; n++ {
+		if err := appendLogEntry(st, "test.jsonl", 100, entry{Time: start.Add(time.Duration(n) * time.Hour), N: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.AppendFile("test.jsonl", []byte("not json\n"))
+
+	var got []int
+	err := readLogSince(st, "test.jsonl", start.Add(time.Hour), func(line []byte) {
+		var e entry
+		json.Unmarshal(line, &e)
+		got = append(got, e.N)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entries 0 and 1 went with the first rotated file, which the second
+	// rotation replaced.
+	if len(got) != 3 || got[0] != 2 || got[2] != 4 {
+		t.Errorf("read entries %v, want 2, 3 and 4 in order", got)
+	}
+	got = nil
+	readLogSince(st, "test.jsonl", start.Add(3*time.Hour), func(line []byte) {
+		var e entry
+		json.Unmarshal(line, &e)
+		got = append(got, e.N)
+	})
+	if len(got) != 2 || got[0] != 3 {
+		t.Errorf("read entries since 15:00 %v, want 3 and 4", got)
+	}
+	if err := readLogSince(st, "missing.jsonl", time.Time{}, func([]byte) { t.Error("line read from a missing log") }); err != nil {
+		t.Errorf("readLogSince() of a missing log error: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package rag
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeywordSuggestion is a term proposed for rag.trigger.auto_keywords.
+type KeywordSuggestion struct {
+	Term string
+	// Score is the term's TF-IDF weight summed over the chunks.
+	Score float64
+	// Chunks is the number of chunks containing the term.
+	Chunks int
+}
+
+// keywordStopwords are frequent English words and link fragments that say
+// nothing about what the vault is about.
+var keywordStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true, "all": true,
+	"any": true, "can": true, "had": true, "her": true, "was": true, "one": true, "our": true, "out": true,
+	"has": true, "him": true, "his": true, "how": true, "its": true, "may": true, "new": true, "now": true,
+	"see": true, "two": true, "who": true, "did": true, "get": true, "let": true, "use": true, "way": true,
+	"this": true, "that": true, "with": true, "have": true, "from": true, "they": true, "will": true,
+	"would": true, "there": true, "their": true, "what": true, "about": true, "which": true, "when": true,
+	"make": true, "like": true, "time": true, "just": true, "know": true, "take": true, "into": true,
+	"your": true, "some": true, "could": true, "them": true, "than": true, "then": true, "only": true,
+	"also": true, "over": true, "such": true, "these": true, "those": true, "been": true, "were": true,
+	"more": true, "most": true, "other": true, "should": true, "does": true, "each": true, "very": true,
+	"here": true, "where": true, "after": true, "before": true, "because": true, "while": true,
+	"http": true, "https": true, "www": true, "com": true, "org": true, "html": true, "png": true, "jpg": true,
+}
+
+// SuggestKeywords proposes up to limit auto-trigger keywords from the indexed
+// chunks of every backend: terms that are frequent in some notes but not
+// spread over most of them, ranked by TF-IDF. Terms that the configured
+// auto_keywords already trigger on are left out.
+func (s *Service) SuggestKeywords(ctx context.Context, limit int) ([]KeywordSuggestion, error) {
+	var chunks []string
+	for _, b := range s.backends() {
+		store, ok := b.store.(*QdrantClient)
+		if !ok {
+			continue
+		}
+		if err := s.verifyCollection(ctx, b); err != nil {
+			return nil, err
+		}
+		filter := documentsFilter(map[string]interface{}{
+			"must": []map[string]interface{}{{"is_empty": map[string]interface{}{"key": "summary_level"}}},
+		}, false)
+		var offset interface{}
+		for {
+			points, next, err := store.scroll(ctx, filter, offset, digestScrollBatch)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range points {
+				if content, _ := p.Payload["content"].(string); content != "" && !isMetadataPayload(p.Payload) {
+					chunks = append(chunks, content)
+				}
+			}
+			if next == nil || len(points) == 0 {
+				break
+			}
+			offset = next
+		}
+	}
+	return rankKeywords(chunks, s.cfg.Trigger.AutoKeywords, limit), nil
+}
+
+// rankKeywords scores the terms of chunks by TF-IDF: a term's count in each
+// chunk weighted by log(N/df), summed. Terms in fewer than two chunks or in
+// more than half of them are dropped as typos and filler respectively.
+func rankKeywords(chunks []string, configured []string, limit int) []KeywordSuggestion {
+	counts := make(map[string]int)
+	df := make(map[string]int)
+	for _, chunk := range chunks {
+		seen := make(map[string]bool)
+		for _, term := range keywordCandidates(chunk) {
+			counts[term]++
+			if !seen[term] {
+				seen[term] = true
+				df[term]++
+			}
+		}
+	}
+	n := float64(len(chunks))
+	var out []KeywordSuggestion
+	for term, count := range counts {
+		if df[term] < 2 || float64(df[term]) > n/2 || matchKeyword(term, configured) != "" {
+			continue
+		}
+		out = append(out, KeywordSuggestion{
+			Term:   term,
+			Score:  float64(count) * math.Log(n/float64(df[term])),
+			Chunks: df[term],
+		})
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Score != out[b].Score {
+			return out[a].Score > out[b].Score
+		}
+		return out[a].Term < out[b].Term
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// keywordCandidates splits text into lowercase words of three letters or
+// more, skipping stopwords and words that are mostly digits. Han text has no
+// spaces, so each run of it contributes its two-character pairs instead.
+func keywordCandidates(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if han := []rune(word); unicode.Is(unicode.Han, han[0]) {
+			terms = append(terms, hanBigrams(han)...)
+			continue
+		}
+		letters := 0
+		for _, r := range word {
+			if unicode.IsLetter(r) {
+				letters++
+			}
+		}
+		if n := utf8.RuneCountInString(word); n < 3 || n > maxVocabularyWordLen || letters*2 < n || keywordStopwords[word] {
+			continue
+		}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// hanBigrams returns the pairs of adjacent Han characters in runes.
+func hanBigrams(runes []rune) []string {
+	var out []string
+	for idx := 0; idx+1 < len(runes); idx++ {
+		if unicode.Is(unicode.Han, runes[idx]) && unicode.Is(unicode.Han, runes[idx+1]) {
+			out = append(out, string(runes[idx:idx+2]))
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRankKeywords(t *testing.T) {
+	chunks := []string{
+		"Kubernetes cluster upgrade notes for the cluster.",
+		"The kubernetes ingress broke after the upgrade.",
+		"Sourdough starter feeding schedule.",
+		"Sourdough hydration and the starter.",
+		"Weekly review of the week.",
+		"A typo: kubernetse.",
+	}
+	got := rankKeywords(chunks, []string{"ingress", "Upgrade"}, 4)
+	var terms []string
+	for _, s := range got {
+		terms = append(terms, s.Term)
+	}
+	if strings.Join(terms, ",") != "kubernetes,sourdough,starter" {
+		t.Errorf("rankKeywords() = %q", terms)
+	}
+	if got[0].Chunks != 2 {
+		t.Errorf("chunks for %q = %d, want 2", got[0].Term, got[0].Chunks)
+	}
+}
+
+func TestKeywordCandidates(t *testing.T) {
+	got := keywordCandidates("The 2024 k8s 诊断流程, see https://x.org")
+	if strings.Join(got, ",") != "k8s,诊断,断流,流程" {
+		t.Errorf("keywordCandidates() = %q", got)
+	}
+}
+
+func TestSuggestKeywordsScrollsChunks(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/points/scroll") {
+			w.Write([]byte(`{"result":{"status":"green","config":{"params":{"vectors":{"size":2}}}}}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"points":[
+			{"id":1,"payload":{"path":"a.md","content":"sepsis fluids"}},
+			{"id":2,"payload":{"path":"b.md","content":"sepsis antibiotics"}},
+			{"id":3,"payload":{"path":"c.md","content":"garden beds"}},
+			{"id":4,"payload":{"path":"d.md","content":"garden tomatoes"}},
+			{"id":5,"payload":{"path":"e.md","content":"reading list"}}
+		],"next_page_offset":null}}`))
+	})
+	s.cfg.Trigger.AutoKeywords = nil
+	got, err := s.SuggestKeywords(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("SuggestKeywords() error: %v", err)
+	}
+	if len(got) != 2 || got[0].Term != "garden" || got[1].Term != "sepsis" {
+		t.Errorf("SuggestKeywords() = %+v", got)
+	}
+}
@@ -0,0 +1,187 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// detectLanguage guesses the dominant language of text from its scripts. It
+// returns an ISO 639-1 code ("en", "zh", "ja", "ko", "ru") or "" when the text
+// has no letters. Latin script is reported as "en". CJK characters carry
+// roughly a word each, so they are weighted against Latin letters accordingly.
+func detectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	const cjkWeight = 4
+	scores := []struct {
+		lang  string
+		score int
+	}{
+		{"en", latin},
+		{"ru", cyrillic},
+		{"zh", han * cjkWeight},
+		{"ja", (han + kana) * cjkWeight},
+		{"ko", hangul * cjkWeight},
+	}
+	if kana == 0 {
+		// Without kana, Han text is Chinese.
+		scores[3].score = 0
+	}
+	best, bestScore := "", 0
+	for _, s := range scores {
+		if s.score > bestScore {
+			best, bestScore = s.lang, s.score
+		}
+	}
+	return best
+}
+
+// backend is one embedding model together with the collection its vectors
+// live in. The default backend has an empty language and takes everything
+// that no language route claims.
+type backend struct {
+	language string
+	cfg      config.RagConfig
+	embedder Embedder
+	store    VectorStore
+}
+
+// newRouteBackend builds the backend for a language route. Unset embedding
+// settings are inherited from the default embedding config.
+func newRouteBackend(base config.RagConfig, route config.RagLanguageRouteConfig) (*backend, error) {
+	cfg := base
+	cfg.Embedding = mergeEmbeddingConfig(base.Embedding, route.Embedding)
+	cfg.VectorDB.Collection = route.Collection
+	if cfg.VectorDB.Collection == "" {
+		cfg.VectorDB.Collection = base.VectorDB.Collection + "_" + route.Language
+	}
+	embedder, err := newEmbeddingClient(cfg.Embedding, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newQdrantClient(cfg.VectorDB, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	cooldown := secondsOrDefault(cfg.CircuitBreaker.CooldownSeconds, 30)
+	embedder.breaker = newCircuitBreaker("embedding:"+route.Language, cfg.CircuitBreaker.FailureThreshold, cooldown)
+	store.breaker = newCircuitBreaker("qdrant:"+route.Language, cfg.CircuitBreaker.FailureThreshold, cooldown)
+	return &backend{
+		language: route.Language,
+		cfg:      cfg,
+		embedder: embedder,
+		store:    store,
+	}, nil
+}
+
+func mergeEmbeddingConfig(base, override config.RagEmbeddingConfig) config.RagEmbeddingConfig {
+	merged := base
+	if override.APIKey != "" {
+		merged.APIKey = override.APIKey
+	}
+	if override.APIBase != "" {
+		merged.APIBase = override.APIBase
+	}
+	if override.CompressRequests {
+		merged.CompressRequests = true
+	}
+	if override.Model != "" {
+		merged.Model = override.Model
+		// A different model rarely shares the default model's dimension.
+		merged.Dimension = override.Dimension
+	}
+	if override.Dimension > 0 {
+		merged.Dimension = override.Dimension
+	}
+	if override.BatchSize > 0 {
+		merged.BatchSize = override.BatchSize
+	}
+	if override.Concurrency > 0 {
+		merged.Concurrency = override.Concurrency
+	}
+	if override.TimeoutSeconds > 0 {
+		merged.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.TimeoutPerInputMs > 0 {
+		merged.TimeoutPerInputMs = override.TimeoutPerInputMs
+	}
+	if override.ConnectTimeoutSeconds > 0 {
+		merged.ConnectTimeoutSeconds = override.ConnectTimeoutSeconds
+	}
+	if override.TLSTimeoutSeconds > 0 {
+		merged.TLSTimeoutSeconds = override.TLSTimeoutSeconds
+	}
+	if override.AdaptiveBatch {
+		merged.AdaptiveBatch = true
+	}
+	if override.TargetBatchMs > 0 {
+		merged.TargetBatchMs = override.TargetBatchMs
+	}
+	if override.MaxBatchTokens > 0 {
+		merged.MaxBatchTokens = override.MaxBatchTokens
+	}
+	if override.MinBatchSize > 0 {
+		merged.MinBatchSize = override.MinBatchSize
+	}
+	if override.MaxBatchSize > 0 {
+		merged.MaxBatchSize = override.MaxBatchSize
+	}
+	return merged
+}
+
+// backends returns the default backend followed by the language routes.
+func (s *Service) backends() []*backend {
+	all := make([]*backend, 0, len(s.routes)+1)
+	all = append(all, &backend{cfg: s.cfg, embedder: s.embedder, store: s.store})
+	return append(all, s.routes...)
+}
+
+// backendFor picks the backend that should embed text: the route for its
+// detected language, or the default backend.
+func (s *Service) backendFor(text string) *backend {
+	if len(s.routes) > 0 {
+		lang := detectLanguage(text)
+		for _, b := range s.routes {
+			if strings.EqualFold(b.language, lang) {
+				return b
+			}
+		}
+	}
+	return &backend{cfg: s.cfg, embedder: s.embedder, store: s.store}
+}
+
+// routedLanguages lists the languages claimed by language routes.
+func (s *Service) routedLanguages() []string {
+	langs := make([]string, 0, len(s.routes))
+	for _, b := range s.routes {
+		langs = append(langs, strings.ToLower(b.language))
+	}
+	return langs
+}
+
+func (s *Service) newBackendIndexer(b *backend) *indexer {
+	idx := newIndexer(b.cfg, s.storage, b.embedder, b.store)
+	idx.language = strings.ToLower(b.language)
+	idx.routed = s.routedLanguages()
+	idx.onFileDone = s.indexFileDone
+	idx.summarize = s.summarizer
+	idx.log = s.log
+	idx.now = s.now
+	idx.transcripts = idx.transcripts.withService(s)
+	return idx
+}
@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Atrial fibrillation rate control", "en"},
+		{"房颤的心率控制策略", "zh"},
+		{"心房細動のレートコントロール", "ja"},
+		{"심방세동 치료", "ko"},
+		{"Lecture notes on CHA2DS2-VASc 评分和抗凝治疗的适应症", "zh"},
+		{"1234 !!", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIndexerAccepts(t *testing.T) {
+	def := &indexer{routed: []string{"zh"}}
+	zh := &indexer{language: "zh", routed: []string{"zh"}}
+	if !def.accepts("plain english") || def.accepts("中文笔记内容") {
+		t.Error("default backend should take everything except routed languages")
+	}
+	if zh.accepts("plain english") || !zh.accepts("中文笔记内容") {
+		t.Error("route backend should only take its own language")
+	}
+	if !(&indexer{}).accepts("中文笔记内容") {
+		t.Error("without routes every note belongs to the default backend")
+	}
+}
+
+func TestMergeEmbeddingConfig(t *testing.T) {
+	base := config.RagEmbeddingConfig{APIKey: "k", APIBase: "b", Model: "m", Dimension: 768, BatchSize: 16}
+	got := mergeEmbeddingConfig(base, config.RagEmbeddingConfig{Model: "zh-model"})
+	if got.APIKey != "k" || got.Model != "zh-model" || got.Dimension != 0 || got.BatchSize != 16 {
+		t.Errorf("unexpected merge: %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	wikilinkPattern = regexp.MustCompile(`\[\[([^\]|#]+)(?:[#|][^\]]*)?\]\]`)
+	notePathPattern = regexp.MustCompile(`[^\s"'<>()\[\]]+\.md\b`)
+)
+
+// extractNoteRefs returns the wikilink targets and markdown paths mentioned in
+// a query, in order of appearance and without duplicates.
+func extractNoteRefs(query string) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[ref] {
+			return
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	for _, m := range wikilinkPattern.FindAllStringSubmatch(query, -1) {
+		add(m[1])
+	}
+	for _, m := range notePathPattern.FindAllString(query, -1) {
+		add(m)
+	}
+	return refs
+}
+
+// indexReferencedNotes indexes notes referenced in the query that are not part
+// of the index yet, so brand-new notes can be searched right away.
+func (s *Service) indexReferencedNotes(ctx context.Context, query string) error {
+	refs := extractNoteRefs(query)
+	if len(refs) == 0 {
+		return nil
+	}
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil
+	}
+	indexed := make(map[string]bool)
+	for _, b := range s.backends() {
+		state, err := s.newBackendIndexer(b).loadState()
+		if err != nil {
+			if b.language == "" {
+				// No index has been built yet; a full run is needed first.
+				return nil
+			}
+			continue
+		}
+		for rel := range state.Files {
+			indexed[rel] = true
+		}
+		for rel := range state.OtherLanguage {
+			indexed[rel] = true
+		}
+	}
+
+	includeRegex := compilePatterns(s.cfg.IncludePatterns)
+	excludeRegex := compilePatterns(s.cfg.ExcludePatterns)
+	var missing []string
+	for _, rel := range resolveNoteRefs(v, refs, s.cfg.IncludePatterns, s.cfg.ExcludePatterns) {
+		if indexed[rel] {
+			continue
+		}
+		if matchesAny(rel, excludeRegex) {
+			continue
+		}
+		if len(includeRegex) > 0 && !matchesAny(rel, includeRegex) {
+			continue
+		}
+		missing = append(missing, rel)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return s.reindexPaths(ctx, missing)
+}
+
+// resolveNoteRefs maps references to vault-relative paths of existing notes.
+// Paths are checked directly; bare wikilink names fall back to a basename match
+// across the vault, which is only walked when needed.
+func resolveNoteRefs(v *vault, refs []string, includePatterns, excludePatterns []string) []string {
+	var resolved []string
+	byName := make(map[string]bool)
+	for _, ref := range refs {
+		rel := path.Clean(slashPath(ref))
+		if !strings.HasSuffix(rel, ".md") {
+			rel += ".md"
+		}
+		if strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			continue
+		}
+		if absPath, ok := v.abs(rel); ok {
+			if info, err := os.Stat(ioPath(absPath)); err == nil && !info.IsDir() {
+				resolved = append(resolved, rel)
+				continue
+			}
+		}
+		if !strings.Contains(rel, "/") {
+			byName[strings.ToLower(strings.TrimSuffix(rel, ".md"))] = true
+		}
+	}
+	if len(byName) == 0 {
+		return resolved
+	}
+
+	files, err := v.list(includePatterns, excludePatterns)
+	if err != nil {
+		return resolved
+	}
+	for _, f := range files {
+		name := strings.ToLower(strings.TrimSuffix(path.Base(f.RelPath), ".md"))
+		if byName[name] {
+			resolved = append(resolved, f.RelPath)
+			delete(byName, name)
+		}
+	}
+	return resolved
+}
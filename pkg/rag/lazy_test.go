@@ -0,0 +1,43 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractNoteRefs(t *testing.T) {
+	query := "compare [[Sepsis]] with [[Shock|circulatory shock]] and notes/icu/fluids.md, again [[Sepsis#Treatment]]"
+	got := extractNoteRefs(query)
+	want := []string{"Sepsis", "Shock", "notes/icu/fluids.md"}
+	if len(got) != len(want) {
+		t.Fatalf("extractNoteRefs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ref[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResolveNoteRefs(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "cards"), 0755)
+	os.WriteFile(filepath.Join(dir, "cards", "Sepsis.md"), []byte("# Sepsis"), 0644)
+	os.WriteFile(filepath.Join(dir, "top.md"), []byte("# Top"), 0644)
+	v, err := newVault([]string{dir})
+	if err != nil {
+		t.Fatalf("newVault() error: %v", err)
+	}
+
+	got := resolveNoteRefs(v, []string{"top", "sepsis", "missing", "../escape.md"}, nil, nil)
+	want := []string{"top.md", "cards/Sepsis.md"}
+	if len(got) != len(want) {
+		t.Fatalf("resolveNoteRefs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("path[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
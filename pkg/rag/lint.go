@@ -0,0 +1,251 @@
+package rag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of LintFinding, in report order.
+const (
+	LintEmpty             = "empty"
+	LintHuge              = "huge"
+	LintBrokenFrontmatter = "broken_frontmatter"
+	LintNoHeadings        = "no_headings"
+	LintLongLines         = "long_lines"
+	LintDuplicateTitle    = "duplicate_title"
+	LintUnreadable        = "unreadable"
+)
+
+var lintKinds = []string{LintEmpty, LintHuge, LintBrokenFrontmatter, LintNoHeadings, LintLongLines, LintDuplicateTitle, LintUnreadable}
+
+const (
+	// lintHugeChars marks a note that becomes thousands of chunks.
+	lintHugeChars = 1 << 20
+	// A note longer than lintNoHeadingChunks chunks needs headings to tell
+	// its chunks apart, and a line longer than lintLongLineChunks chunks
+	// becomes one oversized chunk, as chunks end only at line breaks.
+	lintNoHeadingChunks = 3
+	lintLongLineChunks  = 4
+)
+
+// VaultLint is what picoclaw rag lint-vault prints: the notes of the vault
+// likely to retrieve poorly.
+type VaultLint struct {
+	Notes int
+	// Findings lists the kinds with at least one note, in report order.
+	Findings []LintFinding
+}
+
+// LintFinding counts the notes with one kind of problem and shows a few.
+type LintFinding struct {
+	Kind     string
+	Notes    int
+	Examples []LintExample
+}
+
+type LintExample struct {
+	Path   string
+	Detail string
+}
+
+// LintVault checks every note the index would read, without embedding
+// anything, and keeps up to examples notes per kind of problem.
+func (s *Service) LintVault(examples int) (*VaultLint, error) {
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	v.formats = noteFormatsOf(s.cfg)
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+	files, err := v.list(s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	chunkSize := s.cfg.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 800
+	}
+	l := newVaultLinter(chunkSize, examples)
+	for _, file := range files {
+		// Recordings would have to be transcribed first.
+		if isAudioFile(file.AbsPath) {
+			continue
+		}
+		content, err := readNote(ioPath(file.AbsPath), nil)
+		if err != nil {
+			l.report.Notes++
+			l.add(LintUnreadable, file.RelPath, err.Error())
+			continue
+		}
+		l.note(file.RelPath, normalizeText(string(content)))
+	}
+	return l.finish(), nil
+}
+
+type vaultLinter struct {
+	chunkSize int
+	examples  int
+	report    VaultLint
+	found     map[string]*LintFinding
+	titles    map[string][]string
+}
+
+func newVaultLinter(chunkSize, examples int) *vaultLinter {
+	return &vaultLinter{
+		chunkSize: chunkSize,
+		examples:  examples,
+		found:     map[string]*LintFinding{},
+		titles:    map[string][]string{},
+	}
+}
+
+func (l *vaultLinter) add(kind, path, detail string) {
+	f := l.found[kind]
+	if f == nil {
+		f = &LintFinding{Kind: kind}
+		l.found[kind] = f
+	}
+	f.Notes++
+	if len(f.Examples) < l.examples {
+		f.Examples = append(f.Examples, LintExample{Path: path, Detail: detail})
+	}
+}
+
+// note checks one normalized note.
+func (l *vaultLinter) note(path, text string) {
+	l.report.Notes++
+	if len(text) > lintHugeChars {
+		l.add(LintHuge, path, FormatBytes(int64(len(text))))
+	}
+	if problem := frontmatterProblem(text); problem != "" {
+		l.add(LintBrokenFrontmatter, path, problem)
+	}
+	meta := parseFrontmatter(text)
+	lines := strings.Split(text, "\n")
+	body := lines[meta.EndLine:]
+	if strings.TrimSpace(strings.Join(body, "\n")) == "" {
+		l.add(LintEmpty, path, "")
+		return
+	}
+
+	if !hasHeading(headingsByLine(body)) && len(text) > lintNoHeadingChunks*l.chunkSize {
+		l.add(LintNoHeadings, path, fmt.Sprintf("%d characters", len(text)))
+	}
+	longest, longestLine := 0, 0
+	for n, line := range lines {
+		if len(line) > longest {
+			longest, longestLine = len(line), n+1
+		}
+	}
+	if longest > lintLongLineChunks*l.chunkSize {
+		l.add(LintLongLines, path, fmt.Sprintf("line %d has %d characters", longestLine, longest))
+	}
+
+	// The title is the frontmatter title, the first top-level heading or
+	// the file name.
+	title := meta.Title
+	for _, line := range body {
+		if h1, ok := strings.CutPrefix(line, "# "); ok && title == "" {
+			title = h1
+		}
+		if title != "" {
+			break
+		}
+	}
+	if strings.TrimSpace(title) == "" {
+		title = fileTitle(path)
+	}
+	key := strings.ToLower(strings.TrimSpace(title))
+	l.titles[key] = append(l.titles[key], path)
+}
+
+func hasHeading(headings []headingPath) bool {
+	for _, h := range headings {
+		if len(h.Titles) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *vaultLinter) finish() *VaultLint {
+	keys := make([]string, 0, len(l.titles))
+	for key := range l.titles {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		paths := l.titles[key]
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		for n, path := range paths {
+			others := append(append([]string{}, paths[:n]...), paths[n+1:]...)
+			l.add(LintDuplicateTitle, path, fmt.Sprintf("%q, also %s", key, strings.Join(others, ", ")))
+		}
+	}
+	for _, kind := range lintKinds {
+		if f := l.found[kind]; f != nil {
+			l.report.Findings = append(l.report.Findings, *f)
+		}
+	}
+	return &l.report
+}
+
+// frontmatterProblem describes what keeps a note's frontmatter from being
+// read as intended, or returns "" when there is none or it is fine. It is
+// stricter than parseFrontmatter, which skips what it does not understand.
+func frontmatterProblem(text string) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return ""
+	}
+	end := -1
+	for n := 1; n < len(lines); n++ {
+		if strings.TrimSpace(lines[n]) == "---" {
+			end = n
+			break
+		}
+	}
+	if end < 0 {
+		return "no closing ---"
+	}
+	seen := map[string]bool{}
+	for n, line := range lines[1:end] {
+		lineNo := n + 2
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return fmt.Sprintf("line %d is indented with a tab", lineNo)
+		}
+		if line != strings.TrimLeft(line, " ") || strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			// Nested values and list items.
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return fmt.Sprintf("line %d is not key: value", lineNo)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if seen[key] {
+			return fmt.Sprintf("key %q repeated on line %d", key, lineNo)
+		}
+		seen[key] = true
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]"):
+			return fmt.Sprintf("unclosed [ on line %d", lineNo)
+		case len(value) == 1 && (value == `"` || value == "'"),
+			strings.HasPrefix(value, `"`) && !strings.HasSuffix(value, `"`),
+			strings.HasPrefix(value, "'") && !strings.HasSuffix(value, "'"):
+			return fmt.Sprintf("unclosed quote on line %d", lineNo)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestLintVault(t *testing.T) {
+	vault := t.TempDir()
+	write := func(name, text string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(vault, name)), 0o755)
+		os.WriteFile(filepath.Join(vault, name), []byte(text), 0o644)
+	}
+	paragraph := strings.Repeat("Some words about the topic. ", 10) + "\n"
+	write("good.md", "# Good\n\n## Part\n\n"+strings.Repeat(paragraph, 20))
+	write("empty.md", "---\ntitle: Nothing\n---\n\n")
+	write("wall.md", strings.Repeat(paragraph, 20))
+	write("oneline.md", "# One line\n\n"+strings.Repeat("word ", 1000))
+	write("a/meeting.md", "# Meeting\n\nnotes\n")
+	write("b/meeting.md", "---\ntitle: meeting\n---\nmore notes\n")
+	write("broken.md", "---\ntags: [a, b\n---\n# Broken\n")
+
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{vault}
+	cfg.RAG.ChunkSize = 800
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(oneResultStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.LintVault(1)
+	if err != nil {
+		t.Fatalf("LintVault() error: %v", err)
+	}
+	if report.Notes != 7 {
+		t.Errorf("Notes = %d, want 7", report.Notes)
+	}
+	var got []string
+	for _, f := range report.Findings {
+		got = append(got, f.Kind+":"+f.Examples[0].Path)
+		if f.Kind == LintDuplicateTitle && (f.Notes != 2 || len(f.Examples) != 1) {
+			t.Errorf("duplicate titles = %+v", f)
+		}
+	}
+	want := "empty:empty.md broken_frontmatter:broken.md no_headings:wall.md long_lines:oneline.md duplicate_title:a/meeting.md"
+	if strings.Join(got, " ") != want {
+		t.Errorf("findings = %q, want %q", got, want)
+	}
+}
+
+func TestFrontmatterProblem(t *testing.T) {
+	for text, want := range map[string]string{
+		"# No frontmatter\n":                            "",
+		"---\ntitle: x\ntags:\n  - a\n  - b\n---\n":     "",
+		"---\ntitle: x\n":                               "no closing ---",
+		"---\ntitle: x\nTitle: y\n---\n":                `key "title" repeated on line 3`,
+		"---\njust some text\n---\n":                    "line 2 is not key: value",
+		"---\ntitle: \"unfinished\n---\n":               "unclosed quote on line 2",
+		"---\ntags:\n\t- a\n---\n":                      "line 3 is indented with a tab",
+		"---\naliases: [one, two\n---\n":                "unclosed [ on line 2",
+		"---\n# comment\ndate: 2024-05-01\n---\nbody\n": "",
+	} {
+		if got := frontmatterProblem(text); got != want {
+			t.Errorf("frontmatterProblem(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// localHostSuffixes are name suffixes reserved for hosts on the local
+// network, which never resolve through public DNS.
+var localHostSuffixes = []string{".local", ".lan", ".internal", ".home.arpa", ".localhost"}
+
+// checkLocalOnly fails with ErrNotLocal, naming the setting, for the first
+// endpoint of cfg that is not on this machine or the local network.
+func checkLocalOnly(cfg config.RagConfig) error {
+	type endpoint struct{ setting, url string }
+	endpoints := []endpoint{
+		{"rag.embedding.api_base", cfg.Embedding.APIBase},
+		{"rag.vector_db.url", cfg.VectorDB.URL},
+		{"rag.notifications.webhook_url", cfg.Notifications.WebhookURL},
+	}
+	if cfg.Transcription.Enabled {
+		endpoints = append(endpoints, endpoint{"rag.transcription.api_base", cfg.Transcription.APIBase})
+	}
+	for _, route := range cfg.LanguageRoutes {
+		endpoints = append(endpoints, endpoint{fmt.Sprintf("rag.language_routes[%s].embedding.api_base", route.Language), route.Embedding.APIBase})
+	}
+	for _, c := range cfg.Ensemble.Collections {
+		endpoints = append(endpoints, endpoint{fmt.Sprintf("rag.ensemble.collections[%s].embedding.api_base", c.Name), c.Embedding.APIBase})
+	}
+	for _, remote := range cfg.RemoteVaults {
+		endpoints = append(endpoints, endpoint{fmt.Sprintf("rag.remote_vaults[%s].url", remote.Name), remote.URL})
+	}
+	for _, e := range endpoints {
+		if e.url == "" {
+			continue
+		}
+		if !isLocalEndpoint(e.url) {
+			return fmt.Errorf("%s %q: %w", e.setting, e.url, ErrNotLocal)
+		}
+	}
+	return nil
+}
+
+// isLocalEndpoint reports whether rawURL points at a loopback, private or
+// link-local address, or at a host name that can only be local: localhost,
+// a single-label name such as a Docker service, or one under a reserved
+// local suffix. Other names are not resolved, so a public DNS record cannot
+// pass the check by pointing at a private address.
+func isLocalEndpoint(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range localHostSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
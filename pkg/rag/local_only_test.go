@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestIsLocalEndpoint(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://localhost:6333", true},
+		{"http://127.0.0.1:8080/v1", true},
+		{"http://[::1]:6333", true},
+		{"http://192.168.1.20:6333", true},
+		{"http://10.0.0.5", true},
+		{"http://[fd00::1]:6333", true},
+		{"http://qdrant:6333", true},
+		{"https://nas.local/dav", true},
+		{"https://nas.home.arpa", true},
+		{"https://api.openai.com/v1", false},
+		{"http://8.8.8.8", false},
+		{"https://nas.local.example.com", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalEndpoint(tt.url); got != tt.want {
+			t.Errorf("isLocalEndpoint(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNewServiceLocalOnly(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.LocalOnly = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.Embedding.APIBase = "http://localhost:11434/v1"
+	cfg.RAG.Embedding.Model = "nomic-embed-text"
+	cfg.RAG.VectorDB.URL = "http://127.0.0.1:6333"
+	if _, err := NewService(cfg, t.TempDir()); err != nil {
+		t.Fatalf("NewService() with local endpoints error: %v", err)
+	}
+
+	cfg.RAG.RemoteVaults = []config.RagRemoteVaultConfig{{Name: "team", Type: RemoteVaultWebDAV, URL: "https://cloud.example.com/dav"}}
+	_, err := NewService(cfg, t.TempDir())
+	if !errors.Is(err, ErrNotLocal) || !strings.Contains(err.Error(), "rag.remote_vaults[team].url") {
+		t.Errorf("NewService() with a remote vault error = %v, want ErrNotLocal naming it", err)
+	}
+
+	cfg.RAG.RemoteVaults = nil
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory", Embedding: config.RagEmbeddingConfig{APIBase: "https://api.example.com/v1"}}}
+	_, err = NewService(cfg, t.TempDir())
+	if !errors.Is(err, ErrNotLocal) || !strings.Contains(err.Error(), "rag.ensemble.collections[memory]") {
+		t.Errorf("NewService() with a remote ensemble embedder error = %v, want ErrNotLocal naming it", err)
+	}
+
+	cfg.RAG.Ensemble.Collections = nil
+	cfg.RAG.LanguageRoutes = []config.RagLanguageRouteConfig{{Language: "zh", Embedding: config.RagEmbeddingConfig{APIBase: "https://api.example.com/v1"}}}
+	if _, err := NewService(cfg, t.TempDir()); !errors.Is(err, ErrNotLocal) {
+		t.Errorf("NewService() with a remote route error = %v, want ErrNotLocal", err)
+	}
+}
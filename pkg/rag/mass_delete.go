@@ -0,0 +1,150 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// massDeleteMinFiles is the smallest index the mass delete guard protects;
+// in smaller vaults deleting most notes on purpose is common.
+const massDeleteMinFiles = 10
+
+// encryptedMountTypes are the mount types of encrypted volumes. Other FUSE
+// mounts can vanish the same way and are watched too.
+var encryptedMountTypes = map[string]bool{
+	"fuse.gocryptfs": true,
+	"fuse.cryfs":     true,
+	"fuse.encfs":     true,
+	"fuse.securefs":  true,
+	"fuse.rage":      true,
+	"ecryptfs":       true,
+}
+
+// checkMassDelete returns a MassDeleteError when more than
+// rag.safety.max_removed_fraction of the indexed notes are missing from the
+// listed files, which more often means a sync glitch or an encrypted or
+// network volume that is not mounted than that the notes were deleted. It
+// runs before anything is removed or a full reindex recreates the
+// collection.
+func (i *indexer) checkMassDelete(v *vault, state *indexState, current map[string]int64, opts IndexOptions) error {
+	fraction := i.cfg.Safety.MaxRemovedFraction
+	if opts.AllowMassDelete || fraction <= 0 || state == nil || len(state.Files) < massDeleteMinFiles {
+		return nil
+	}
+	missing := 0
+	for path := range state.Files {
+		if _, ok := current[path]; !ok {
+			missing++
+		}
+	}
+	if float64(missing) <= fraction*float64(len(state.Files)) {
+		return nil
+	}
+	err := &MassDeleteError{Missing: missing, Indexed: len(state.Files)}
+	for _, root := range v.roots {
+		switch unmounted, empty := rootMissing(root, state); {
+		case unmounted != "":
+			err.Unmounted = append(err.Unmounted, fmt.Sprintf("%s (%s)", root.path, unmounted))
+		case empty:
+			err.Empty = append(err.Empty, root.path)
+		}
+	}
+	return err
+}
+
+// rootMissing reports whether a vault folder looks unmounted: unmounted is
+// the type of the encrypted or FUSE mount it was on at the last index run
+// when that mount is gone, and empty is set when the folder has nothing in
+// it.
+func rootMissing(root vaultRoot, state *indexState) (unmounted string, empty bool) {
+	if mount := state.VaultMounts[root.path]; mount != "" && mountType(root.path) != mount {
+		return mount, false
+	}
+	entries, err := os.ReadDir(ioPath(root.path))
+	return "", err == nil && len(entries) == 0
+}
+
+// vaultMounts records the vault roots that are on encrypted or FUSE mounts,
+// so a later run can tell that such a mount is gone.
+func vaultMounts(v *vault) map[string]string {
+	var mounts map[string]string
+	for _, root := range v.roots {
+		if mount := mountType(root.path); mount != "" {
+			if mounts == nil {
+				mounts = map[string]string{}
+			}
+			mounts[root.path] = mount
+		}
+	}
+	return mounts
+}
+
+// mountType returns the type of the mount holding path when it is an
+// encrypted or FUSE volume, and "" otherwise or where /proc is unavailable.
+func mountType(path string) string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return mountTypeIn(string(data), abs)
+}
+
+// mountTypeIn finds the innermost mount holding path in the contents of a
+// mountinfo file.
+func mountTypeIn(mountinfo, path string) string {
+	best, bestType := "", ""
+	for _, line := range strings.Split(mountinfo, "\n") {
+		fields := strings.Fields(line)
+		sep := -1
+		for n, f := range fields {
+			if f == "-" {
+				sep = n
+				break
+			}
+		}
+		if sep < 5 || sep+1 >= len(fields) {
+			continue
+		}
+		point := unescapeMountPath(fields[4])
+		if path != point && !strings.HasPrefix(path, strings.TrimSuffix(point, "/")+"/") {
+			continue
+		}
+		if len(point) >= len(best) {
+			best, bestType = point, fields[sep+1]
+		}
+	}
+	if encryptedMountTypes[bestType] || strings.HasPrefix(bestType, "fuse.") {
+		return bestType
+	}
+	return ""
+}
+
+// unescapeMountPath decodes the octal escapes, such as \040 for a space,
+// of a mountinfo path.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for n := 0; n < len(s); n++ {
+		if s[n] == '\\' && n+3 < len(s) {
+			if c, err := strconv.ParseUint(s[n+1:n+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				n += 3
+				continue
+			}
+		}
+		b.WriteByte(s[n])
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCheckMassDelete(t *testing.T) {
+	root := t.TempDir()
+	v, err := newVault([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := newIndexer(config.DefaultConfig().RAG, NewMemoryStorage(), fixedEmbedder{}, nil)
+	state := &indexState{Files: map[string]int64{}}
+	current := map[string]int64{}
+	for n := 0; n < 10; n++ {
+		path := fmt.Sprintf("note%d.md", n)
+		state.Files[path] = 1
+		if n < 5 {
+			current[path] = 1
+		}
+	}
+
+	// Half of the notes missing is still within the default 0.5.
+	if err := i.checkMassDelete(v, state, current, IndexOptions{}); err != nil {
+		t.Fatalf("checkMassDelete() at half = %v", err)
+	}
+	delete(current, "note0.md")
+	err = i.checkMassDelete(v, state, current, IndexOptions{})
+	var massDelete *MassDeleteError
+	if !errors.As(err, &massDelete) || !errors.Is(err, ErrMassDelete) {
+		t.Fatalf("checkMassDelete() at 0.6 = %v", err)
+	}
+	if massDelete.Missing != 6 || massDelete.Indexed != 10 || len(massDelete.Empty) != 1 {
+		t.Errorf("error = %+v", massDelete)
+	}
+	if err := i.checkMassDelete(v, state, current, IndexOptions{AllowMassDelete: true}); err != nil {
+		t.Errorf("checkMassDelete() with AllowMassDelete = %v", err)
+	}
+
+	// A recorded encrypted mount that is gone is named.
+	os.WriteFile(filepath.Join(root, "stray.md"), []byte("x"), 0o644)
+	state.VaultMounts = map[string]string{root: "fuse.gocryptfs"}
+	err = i.checkMassDelete(v, state, current, IndexOptions{})
+	if !errors.As(err, &massDelete) || len(massDelete.Unmounted) != 1 || len(massDelete.Empty) != 0 {
+		t.Errorf("error for an unmounted vault = %v", err)
+	}
+
+	i.cfg.Safety.MaxRemovedFraction = 0
+	if err := i.checkMassDelete(v, state, map[string]int64{}, IndexOptions{}); err != nil {
+		t.Errorf("checkMassDelete() turned off = %v", err)
+	}
+}
+
+func TestMountTypeIn(t *testing.T) {
+	mountinfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 22 0:35 / /home/pi/My\040Vault rw,nosuid,nodev shared:20 - fuse.gocryptfs /home/pi/.vault rw,user_id=1000
+41 22 0:36 / /mnt/share rw shared:21 - nfs server:/share rw
+`
+	for path, want := range map[string]string{
+		"/home/pi/My Vault":       "fuse.gocryptfs",
+		"/home/pi/My Vault/notes": "fuse.gocryptfs",
+		"/home/pi/My Vaults":      "",
+		"/mnt/share/notes":        "",
+		"/srv/notes":              "",
+	} {
+		if got := mountTypeIn(mountinfo, path); got != want {
+			t.Errorf("mountTypeIn(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	memoryLimitMu   sync.Mutex
+	memoryLimitRuns int
+	memoryLimitPrev int64
+)
+
+// memoryLimit is rag.index.max_memory_mb in bytes, or 0 without a ceiling.
+func (i *indexer) memoryLimit() int64 {
+	return int64(max(i.cfg.Index.MaxMemoryMB, 0)) << 20
+}
+
+// limitMemory lowers the Go runtime's soft memory limit to
+// rag.index.max_memory_mb while index runs are going on, so the garbage
+// collector works harder before the process nears it. The returned func
+// ends the run's claim; the previous limit is back once no run needs it.
+func (i *indexer) limitMemory() func() {
+	limit := i.memoryLimit()
+	if limit <= 0 {
+		return func() {}
+	}
+	memoryLimitMu.Lock()
+	if memoryLimitRuns == 0 {
+		memoryLimitPrev = debug.SetMemoryLimit(-1)
+	}
+	memoryLimitRuns++
+	if limit < debug.SetMemoryLimit(-1) {
+		debug.SetMemoryLimit(limit)
+	}
+	memoryLimitMu.Unlock()
+	return func() {
+		memoryLimitMu.Lock()
+		defer memoryLimitMu.Unlock()
+		memoryLimitRuns--
+		if memoryLimitRuns == 0 {
+			debug.SetMemoryLimit(memoryLimitPrev)
+		}
+	}
+}
+
+// relieveMemory returns freed memory to the operating system before more
+// chunks are embedded when the heap has grown past rag.index.max_memory_mb.
+func (i *indexer) relieveMemory() {
+	limit := i.memoryLimit()
+	if limit <= 0 {
+		return
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if int64(stats.HeapAlloc) > limit {
+		debug.FreeOSMemory()
+	}
+}
+
+// chunkMemory estimates the bytes a chunk takes while it is embedded and
+// written: its text in the request, the expanded text and the point, and
+// its vector decoded and as JSON in the response.
+func chunkMemory(ch chunk, dimension int) int64 {
+	return int64(3*len(ch.Content)+len(ch.Path)+len(ch.Heading)) + int64(dimension)*28 + 1024
+}
+
+// planEmbedGroups splits chunks into batches of batchSize and groups of up
+// to concurrency batches that are embedded at once. With a budget, the
+// chunks of one group are estimated to stay within it: batches that do not
+// fit alone are halved, and groups close early, so large notes are
+// embedded and flushed to the vector store in smaller steps.
+func planEmbedGroups(chunks []chunk, batchSize, concurrency int, budget int64, dimension int) [][][]chunk {
+	batches := splitChunks(chunks, batchSize)
+	var groups [][][]chunk
+	var group [][]chunk
+	var used int64
+	for len(batches) > 0 {
+		batch := batches[0]
+		var cost int64
+		for _, ch := range batch {
+			cost += chunkMemory(ch, dimension)
+		}
+		if budget > 0 && cost > budget && len(batch) > 1 {
+			half := len(batch) / 2
+			batches = append([][]chunk{batch[:half], batch[half:]}, batches[1:]...)
+			continue
+		}
+		batches = batches[1:]
+		if len(group) == concurrency || budget > 0 && len(group) > 0 && used+cost > budget {
+			groups = append(groups, group)
+			group, used = nil, 0
+		}
+		group = append(group, batch)
+		used += cost
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// embedGroups plans the embedding of a note's chunks, keeping what is held
+// at once under half of rag.index.max_memory_mb; the other half is left to
+// the rest of the process.
+func (i *indexer) embedGroups(state *indexState, chunks []chunk) [][][]chunk {
+	dimension := state.EmbeddingDimension
+	if dimension == 0 {
+		dimension = i.cfg.Embedding.Dimension
+	}
+	if dimension <= 0 {
+		dimension = guessedDimension
+	}
+	return planEmbedGroups(chunks, i.batchSize(), i.concurrency(), i.memoryLimit()/2, dimension)
+}
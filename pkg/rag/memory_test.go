@@ -0,0 +1,48 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlanEmbedGroups(t *testing.T) {
+	chunks := make([]chunk, 10)
+	for n := range chunks {
+		chunks[n] = chunk{Path: "a.md", Content: strings.Repeat("x", 1000)}
+	}
+	sizes := func(groups [][][]chunk) [][]int {
+		var out [][]int
+		for _, group := range groups {
+			var batches []int
+			for _, batch := range group {
+				batches = append(batches, len(batch))
+			}
+			out = append(out, batches)
+		}
+		return out
+	}
+
+	// Without a budget, batches of batch size go out concurrency at a time.
+	got := sizes(planEmbedGroups(chunks, 4, 2, 0, 8))
+	if want := [][]int{{4, 4}, {2}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+
+	// A budget of two and a half chunks fits batches of two.
+	per := chunkMemory(chunks[0], 8)
+	got = sizes(planEmbedGroups(chunks, 4, 2, 2*per+per/2, 8))
+	if want := [][]int{{2}, {2}, {2}, {2}, {2}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups under budget = %v, want %v", got, want)
+	}
+	got = sizes(planEmbedGroups(chunks, 4, 2, 4*per, 8))
+	if want := [][]int{{4}, {4}, {2}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups under budget = %v, want %v", got, want)
+	}
+
+	// A single chunk above the budget still goes out on its own.
+	got = sizes(planEmbedGroups(chunks[:2], 4, 2, 1, 8))
+	if want := [][]int{{1}, {1}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups with a tiny budget = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const (
+	metadataCreatedBy  = "picoclaw"
+	metadataPayloadKey = "picoclaw_metadata"
+)
+
+// metadataPointID is the ID of the point holding a collection's metadata.
+var metadataPointID = hashPointID("picoclaw:metadata", 0, 0)
+
+// IndexMetadata describes how a collection was built. It is kept in the
+// collection itself, so another picoclaw instance pointing at the same
+// collection can check that it is compatible before searching or indexing.
+type IndexMetadata struct {
+	CreatedBy          string `json:"created_by"`
+	EmbeddingModel     string `json:"embedding_model"`
+	EmbeddingDimension int    `json:"embedding_dimension"`
+	ChunkerVersion     int    `json:"chunker_version"`
+	VaultID            string `json:"vault_id"`
+	UpdatedAt          string `json:"updated_at"`
+}
+
+// metadataStore is implemented by vector stores that can keep IndexMetadata
+// next to the points.
+type metadataStore interface {
+	// readMetadata returns nil when the collection has no metadata yet.
+	readMetadata(ctx context.Context) (*IndexMetadata, error)
+	writeMetadata(ctx context.Context, meta IndexMetadata) error
+}
+
+var _ metadataStore = (*QdrantClient)(nil)
+
+// pointPayload fetches the payload of one point, or nil if it does not exist.
+func (c *QdrantClient) pointPayload(ctx context.Context, id string) (map[string]json.RawMessage, error) {
+	reqBody := map[string]interface{}{
+		"ids":          []string{id},
+		"with_payload": true,
+	}
+	var resp struct {
+		Result []struct {
+			Payload map[string]json.RawMessage `json:"payload"`
+		} `json:"result"`
+	}
+	if err := c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points", c.collection), reqBody, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Result) == 0 {
+		return nil, nil
+	}
+	return resp.Result[0].Payload, nil
+}
+
+// readMetadata fetches the metadata point.
+func (c *QdrantClient) readMetadata(ctx context.Context) (*IndexMetadata, error) {
+	payload, err := c.pointPayload(ctx, metadataPointID)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := payload[metadataPayloadKey]
+	if !ok {
+		return nil, nil
+	}
+	var meta IndexMetadata
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode collection metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// writeMetadata stores meta on a point with a zero vector, which is never
+// similar to a query; search results skip it as well.
+func (c *QdrantClient) writeMetadata(ctx context.Context, meta IndexMetadata) error {
+	if meta.EmbeddingDimension <= 0 {
+		return fmt.Errorf("invalid vector dimension: %d", meta.EmbeddingDimension)
+	}
+	return c.Upsert(ctx, []QdrantPoint{{
+		ID:     metadataPointID,
+		Vector: make([]float64, meta.EmbeddingDimension),
+		Payload: map[string]interface{}{
+			metadataPayloadKey: meta,
+			"chunker_version":  meta.ChunkerVersion,
+		},
+	}})
+}
+
+// isMetadataPayload reports whether a point's payload is the metadata point
+// or the shared index state rather than a note chunk.
+func isMetadataPayload(payload map[string]interface{}) bool {
+	for _, key := range []string{metadataPayloadKey, statePayloadKey} {
+		if _, ok := payload[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// vaultID identifies the vault an index belongs to: rag.vault_id, or the
+// names of the vault directories, which stay the same across devices that
+// sync the vault to different places.
+func vaultID(cfg config.RagConfig) string {
+	if cfg.VaultID != "" {
+		return cfg.VaultID
+	}
+	v, err := newVault(cfg.VaultPath)
+	if err != nil {
+		return ""
+	}
+	names := make([]string, 0, len(v.roots))
+	for _, root := range v.roots {
+		names = append(names, filepath.Base(root.path))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// collectionMetadata reads the metadata of the indexer's collection and
+// fails if the collection belongs to another vault. A store without metadata
+// support, a missing collection and a collection written before metadata
+// existed all return nil; so does a failed read, which the store calls of
+// the run itself will report.
+func (i *indexer) collectionMetadata(ctx context.Context) (*IndexMetadata, error) {
+	ms, ok := i.store.(metadataStore)
+	if !ok {
+		return nil, nil
+	}
+	meta, err := ms.readMetadata(ctx)
+	if err != nil {
+		return nil, nil
+	}
+	if meta != nil && meta.VaultID != "" && meta.VaultID != vaultID(i.cfg) {
+		return nil, fmt.Errorf("%w: collection %s holds vault %q, this is %q", ErrIncompatibleIndex, i.store.Collection(), meta.VaultID, vaultID(i.cfg))
+	}
+	return meta, nil
+}
+
+// metadataReindexReason is reindexReason for the collection's own metadata,
+// which another instance may have written since the local state was saved.
+func (i *indexer) metadataReindexReason(meta *IndexMetadata) string {
+	switch {
+	case meta == nil:
+		return ""
+	case meta.ChunkerVersion != chunkerVersion:
+		return fmt.Sprintf("collection was built by chunker version %d", meta.ChunkerVersion)
+	case meta.EmbeddingModel != i.embedder.Model():
+		return fmt.Sprintf("collection was built with embedding model %s", meta.EmbeddingModel)
+	}
+	return ""
+}
+
+// saveMetadata records how the collection was built. Failing to write it
+// does not fail the index run.
+func (i *indexer) saveMetadata(ctx context.Context, dimension int) {
+	ms, ok := i.store.(metadataStore)
+	if !ok || dimension <= 0 {
+		return
+	}
+	err := ms.writeMetadata(ctx, IndexMetadata{
+		CreatedBy:          metadataCreatedBy,
+		EmbeddingModel:     i.embedder.Model(),
+		EmbeddingDimension: dimension,
+		ChunkerVersion:     chunkerVersion,
+		VaultID:            vaultID(i.cfg),
+		UpdatedAt:          i.now().Format(time.RFC3339),
+	})
+	if err != nil {
+		i.log.Warn("Failed to write collection metadata", map[string]interface{}{
+			"collection": i.store.Collection(),
+			"error":      err.Error(),
+		})
+	}
+}
+
+// verifyCollection checks, once per collection, that the collection was
+// built with the embedding model b searches with, so vectors from different
+// models are never compared. Read errors are left to the search itself.
+func (s *Service) verifyCollection(ctx context.Context, b *backend) error {
+	ms, ok := b.store.(metadataStore)
+	if !ok {
+		return nil
+	}
+	collection := b.store.Collection()
+	if _, done := s.verified.Load(collection); done {
+		return nil
+	}
+	meta, err := ms.readMetadata(ctx)
+	if err != nil {
+		return nil
+	}
+	if meta != nil {
+		if meta.EmbeddingModel != b.embedder.Model() {
+			return fmt.Errorf("%w: collection %s was built with embedding model %s, not %s", ErrIncompatibleIndex, collection, meta.EmbeddingModel, b.embedder.Model())
+		}
+		if id := vaultID(s.cfg); meta.VaultID != "" && meta.VaultID != id {
+			s.log.Warn("Searching a collection built for another vault", map[string]interface{}{
+				"collection": collection,
+				"vault_id":   meta.VaultID,
+				"expected":   id,
+			})
+		}
+	}
+	s.verified.Store(collection, true)
+	return nil
+}
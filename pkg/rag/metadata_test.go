@@ -0,0 +1,117 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// newMetadataQdrant serves a collection that stores the points it receives
+// and counts metadata reads.
+func newMetadataQdrant(t *testing.T) (*QdrantClient, *int) {
+	var (
+		mu     sync.Mutex
+		stored []QdrantPoint
+		reads  int
+	)
+	client := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/collections/notes/points":
+			var req struct {
+				Points []QdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			stored = req.Points
+			w.Write([]byte(`{"result":true}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/collections/notes/points":
+			reads++
+			var result []map[string]interface{}
+			for _, p := range stored {
+				result = append(result, map[string]interface{}{"id": p.ID, "payload": p.Payload})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	return client, &reads
+}
+
+func TestCollectionMetadataRoundTrip(t *testing.T) {
+	client, _ := newMetadataQdrant(t)
+	if meta, err := client.readMetadata(t.Context()); err != nil || meta != nil {
+		t.Fatalf("readMetadata() before writing = %+v, %v", meta, err)
+	}
+	want := IndexMetadata{CreatedBy: metadataCreatedBy, EmbeddingModel: "m", EmbeddingDimension: 3, ChunkerVersion: chunkerVersion, VaultID: "notes"}
+	if err := client.writeMetadata(t.Context(), want); err != nil {
+		t.Fatalf("writeMetadata() error: %v", err)
+	}
+	got, err := client.readMetadata(t.Context())
+	if err != nil || got == nil || *got != want {
+		t.Errorf("readMetadata() = %+v, %v, want %+v", got, err, want)
+	}
+
+	results := scoredPointsToResults([]qdrantScoredPoint{
+		{ID: metadataPointID, Payload: map[string]interface{}{metadataPayloadKey: map[string]interface{}{}}},
+		{ID: "a", Payload: map[string]interface{}{"path": "a.md"}},
+	})
+	if len(results) != 1 || results[0].Path != "a.md" {
+		t.Errorf("search results should skip the metadata point: %+v", results)
+	}
+}
+
+func TestCollectionMetadataCompatibility(t *testing.T) {
+	client, reads := newMetadataQdrant(t)
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	b := &backend{cfg: s.cfg, embedder: s.embedder, store: client}
+	idx := s.newBackendIndexer(b)
+
+	if err := client.writeMetadata(t.Context(), IndexMetadata{EmbeddingModel: "other", EmbeddingDimension: 3, ChunkerVersion: chunkerVersion, VaultID: "desktop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.collectionMetadata(t.Context()); !errors.Is(err, ErrIncompatibleIndex) {
+		t.Errorf("indexing another vault's collection: error = %v, want ErrIncompatibleIndex", err)
+	}
+	if err := s.verifyCollection(t.Context(), b); !errors.Is(err, ErrIncompatibleIndex) {
+		t.Errorf("searching another model's collection: error = %v, want ErrIncompatibleIndex", err)
+	}
+
+	idx.saveMetadata(t.Context(), 3)
+	meta, err := idx.collectionMetadata(t.Context())
+	if err != nil || meta == nil || meta.EmbeddingModel != "m" || meta.VaultID != vaultID(s.cfg) {
+		t.Fatalf("collectionMetadata() after saveMetadata = %+v, %v", meta, err)
+	}
+	if reason := idx.metadataReindexReason(meta); reason != "" {
+		t.Errorf("metadataReindexReason() = %q for matching metadata", reason)
+	}
+	if reason := idx.metadataReindexReason(&IndexMetadata{ChunkerVersion: chunkerVersion - 1}); reason == "" {
+		t.Error("expected an older chunker version to force a rebuild")
+	}
+
+	before := *reads
+	for n := 0; n < 2; n++ {
+		if err := s.verifyCollection(t.Context(), b); err != nil {
+			t.Fatalf("verifyCollection() error: %v", err)
+		}
+	}
+	if *reads != before+1 {
+		t.Errorf("verifyCollection() read the metadata %d times, want once", *reads-before)
+	}
+}
+
+func TestVaultID(t *testing.T) {
+	cfg := config.RagConfig{VaultPath: config.VaultPaths{"/home/me/work", "/mnt/sd/Brain"}}
+	if got := vaultID(cfg); got != "Brain,work" {
+		t.Errorf("vaultID() = %q", got)
+	}
+	cfg.VaultID = "shared"
+	if got := vaultID(cfg); got != "shared" {
+		t.Errorf("vaultID() with rag.vault_id = %q", got)
+	}
+}
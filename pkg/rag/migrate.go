@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// StoreQdrant is the only vector store provider in this build.
+const StoreQdrant = "qdrant"
+
+const defaultMigrateBatchSize = 256
+
+// MigrateStoreOptions configures MigrateStore.
+type MigrateStoreOptions struct {
+	// From and To name the source and destination providers.
+	From string
+	To   string
+	// Target is the destination store. Language routes are copied to
+	// "<collection>_<language>", or to their own collection name when the
+	// route sets one.
+	Target    config.RagVectorDBConfig
+	BatchSize int
+}
+
+// MigratedCollection reports one collection copied by MigrateStore.
+type MigratedCollection struct {
+	Source string
+	Target string
+	Points int
+}
+
+// MigrateStore copies every point, vectors and payloads included, from the
+// configured vector store to opts.Target without re-embedding anything, then
+// points the index state files at the new collections. Indexing is blocked
+// while it runs. progress, if set, is called after each copied batch.
+func (s *Service) MigrateStore(ctx context.Context, opts MigrateStoreOptions, progress func(collection string, copied int)) ([]MigratedCollection, error) {
+	for _, provider := range []string{opts.From, opts.To} {
+		if provider != StoreQdrant {
+			return nil, fmt.Errorf("unsupported vector store %q: only %s is available in this build", provider, StoreQdrant)
+		}
+	}
+	if opts.Target.URL == "" || opts.Target.Collection == "" {
+		return nil, fmt.Errorf("target url and collection are required")
+	}
+	batch := opts.BatchSize
+	if batch <= 0 {
+		batch = defaultMigrateBatchSize
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	var migrated []MigratedCollection
+	for _, b := range s.backends() {
+		src, ok := b.store.(*QdrantClient)
+		if !ok {
+			return migrated, fmt.Errorf("collection %s is not in a %s store", b.store.Collection(), StoreQdrant)
+		}
+		targetCfg := opts.Target
+		targetCfg.Collection = s.migrateTargetCollection(b, opts.Target.Collection)
+		dst, err := newQdrantClient(targetCfg, s.cfg.HTTP)
+		if err != nil {
+			return migrated, err
+		}
+		if dst.baseURL == src.baseURL && dst.collection == src.collection {
+			return migrated, fmt.Errorf("source and target are the same collection: %s", src.collection)
+		}
+
+		copied, err := copyCollection(ctx, src, dst, batch, func(n int) {
+			if progress != nil {
+				progress(dst.collection, n)
+			}
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("migrating %s to %s: %w", src.collection, dst.collection, err)
+		}
+		if err := s.newBackendIndexer(b).retargetState(dst.collection); err != nil {
+			return migrated, fmt.Errorf("updating index state for %s: %w", dst.collection, err)
+		}
+		migrated = append(migrated, MigratedCollection{Source: src.collection, Target: dst.collection, Points: copied})
+	}
+	return migrated, nil
+}
+
+// migrateTargetCollection names the destination collection of backend b.
+func (s *Service) migrateTargetCollection(b *backend, target string) string {
+	if b.language == "" {
+		return target
+	}
+	for _, route := range s.cfg.LanguageRoutes {
+		if route.Language == b.language && route.Collection != "" {
+			return route.Collection
+		}
+	}
+	return target + "_" + b.language
+}
+
+// copyCollection scrolls through src and upserts every page into dst.
+func copyCollection(ctx context.Context, src, dst *QdrantClient, batch int, progress func(copied int)) (int, error) {
+	exists, dimension, err := src.getCollectionDimension(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionMissing, src.collection)
+	}
+	if err := dst.EnsureCollection(ctx, dimension, false); err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	var offset interface{}
+	for {
+		points, next, err := src.scroll(ctx, nil, offset, batch)
+		if err != nil {
+			return copied, err
+		}
+		if err := dst.Upsert(ctx, points); err != nil {
+			return copied, err
+		}
+		copied += len(points)
+		progress(copied)
+		if next == nil || len(points) == 0 {
+			return copied, nil
+		}
+		offset = next
+	}
+}
+
+// retargetState records the new collection in the index state so the next
+// index run continues incrementally instead of rebuilding. The last index
+// time is kept, and a missing state is left alone.
+func (i *indexer) retargetState(collection string) error {
+	state, err := i.loadState()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state.Collection = collection
+	return writeIndexState(i.storage, i.stateName(), state, i.log)
+}
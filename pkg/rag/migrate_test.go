@@ -0,0 +1,108 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMigrateStore(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/collections/notes":
+			w.Write([]byte(`{"result":{"config":{"params":{"vectors":{"size":2}}}}}`))
+		case r.URL.Path == "/collections/notes/points/scroll":
+			var req struct {
+				Offset interface{} `json:"offset"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Offset == nil {
+				w.Write([]byte(`{"result":{"points":[{"id":"p1","vector":[1,0],"payload":{"path":"a.md"}}],"next_page_offset":"p2"}}`))
+				return
+			}
+			w.Write([]byte(`{"result":{"points":[{"id":"p2","vector":[0,1],"payload":{"path":"b.md"}}],"next_page_offset":null}}`))
+		default:
+			t.Errorf("unexpected source request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	t.Cleanup(source.Close)
+
+	var (
+		mu       sync.Mutex
+		created  bool
+		upserted []QdrantPoint
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/collections/archive":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.Method == http.MethodPut && r.URL.Path == "/collections/archive":
+			created = true
+		case r.Method == http.MethodPut && r.URL.Path == "/collections/archive/points":
+			var req struct {
+				Points []QdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			upserted = append(upserted, req.Points...)
+		default:
+			t.Errorf("unexpected target request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"result":true}`))
+	}))
+	t.Cleanup(target.Close)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = dir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	cfg.RAG.VectorDB.URL = source.URL
+	cfg.RAG.VectorDB.Collection = "notes"
+	s, err := NewService(cfg, dir)
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	st := NewLocalStorage(dir)
+	if err := writeIndexState(st, "index_state.json", &indexState{Collection: "notes", UpdatedAt: "2024-01-02T03:04:05Z", Files: map[string]int64{"a.md": 1}}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := s.MigrateStore(t.Context(), MigrateStoreOptions{
+		From:      StoreQdrant,
+		To:        StoreQdrant,
+		Target:    config.RagVectorDBConfig{URL: target.URL, Collection: "archive"},
+		BatchSize: 1,
+	}, nil)
+	if err != nil {
+		t.Fatalf("MigrateStore() error: %v", err)
+	}
+	if len(migrated) != 1 || migrated[0].Points != 2 || migrated[0].Target != "archive" {
+		t.Errorf("MigrateStore() = %+v", migrated)
+	}
+	if !created || len(upserted) != 2 || upserted[1].ID != "p2" || upserted[1].Vector[1] != 1 || upserted[1].Payload["path"] != "b.md" {
+		t.Errorf("target got created=%v points=%+v", created, upserted)
+	}
+
+	state, err := loadIndexState(st, "index_state.json", defaultLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Collection != "archive" || state.UpdatedAt != "2024-01-02T03:04:05Z" || state.Files["a.md"] != 1 {
+		t.Errorf("state after migration = %+v", state)
+	}
+
+	_, err = s.MigrateStore(t.Context(), MigrateStoreOptions{From: StoreQdrant, To: "sqlite", Target: cfg.RAG.VectorDB}, nil)
+	if err == nil || !strings.Contains(err.Error(), "sqlite") {
+		t.Errorf("MigrateStore() to sqlite error = %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"context"
+	"time"
+)
+
+// pause waits rag.index.nice_sleep_ms before a file is indexed in nice mode,
+// so the embedding and Qdrant work of a run is spread out and the chat agent
+// keeps its share of a small board's CPU and disk.
+func (i *indexer) pause(ctx context.Context) error {
+	if !i.cfg.Index.Nice {
+		return nil
+	}
+	sleep := time.Duration(i.cfg.Index.NiceSleepMs) * time.Millisecond
+	if sleep <= 0 {
+		sleep = 250 * time.Millisecond
+	}
+	timer := time.NewTimer(sleep)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// batchSize is the embedder's batch size, capped by rag.index.nice_batch_size
+// in nice mode.
+func (i *indexer) batchSize() int {
+	size := i.embedder.BatchSize()
+	if i.cfg.Index.Nice {
+		limit := i.cfg.Index.NiceBatchSize
+		if limit <= 0 {
+			limit = 4
+		}
+		size = min(size, limit)
+	}
+	return max(size, 1)
+}
+
+// concurrency is the embedder's concurrency, or 1 in nice mode.
+func (i *indexer) concurrency() int {
+	if i.cfg.Index.Nice {
+		return 1
+	}
+	return max(i.embedder.Concurrency(), 1)
+}
@@ -0,0 +1,37 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestIndexerNice(t *testing.T) {
+	cfg := config.DefaultConfig().RAG
+	i := newIndexer(cfg, NewMemoryStorage(), fixedEmbedder{}, nil)
+	if i.batchSize() != 16 || i.concurrency() != 1 {
+		t.Errorf("batch %d, concurrency %d without nice", i.batchSize(), i.concurrency())
+	}
+	start := time.Now()
+	if err := i.pause(context.Background()); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("pause() without nice took %s, %v", time.Since(start), err)
+	}
+
+	i.cfg.Index = config.RagIndexConfig{Nice: true, NiceSleepMs: 20, NiceBatchSize: 3}
+	if i.batchSize() != 3 {
+		t.Errorf("nice batch size = %d, want 3", i.batchSize())
+	}
+	start = time.Now()
+	if err := i.pause(context.Background()); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("pause() took %s, %v; want 20ms", time.Since(start), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i.cfg.Index.NiceSleepMs = 60000
+	if err := i.pause(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("pause() on a cancelled run = %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// No-hit behaviors; see config.RagNoHitConfig.
+const (
+	NoHitSilent             = "silent"
+	NoHitNotifyUser         = "notify_user"
+	NoHitFallbackKeyword    = "fallback_keyword"
+	NoHitLowerThresholdOnce = "lower_threshold_once"
+)
+
+// keywordTermsMax caps the terms of a keyword fallback search.
+const keywordTermsMax = 8
+
+// normalizeNoHit fills in the behavior from fallbackToLLM when it is unset
+// and rejects unknown values.
+func normalizeNoHit(cfg config.RagNoHitConfig, fallbackToLLM bool) (config.RagNoHitConfig, error) {
+	switch cfg.Behavior {
+	case "":
+		cfg.Behavior = NoHitNotifyUser
+		if fallbackToLLM {
+			cfg.Behavior = NoHitSilent
+		}
+	case NoHitSilent, NoHitNotifyUser, NoHitFallbackKeyword, NoHitLowerThresholdOnce:
+	default:
+		return cfg, fmt.Errorf("rag.no_hit.behavior: unknown behavior %q", cfg.Behavior)
+	}
+	return cfg, nil
+}
+
+// noHitOutcome is what the agent does when a search finds nothing, after the
+// retry of rag.no_hit.behavior if it has one: NoHitSilent or NoHitNotifyUser.
+func (s *Service) noHitOutcome() string {
+	switch s.cfg.NoHit.Behavior {
+	case NoHitSilent, NoHitNotifyUser:
+		return s.cfg.NoHit.Behavior
+	}
+	if s.cfg.FallbackToLLM {
+		return NoHitSilent
+	}
+	return NoHitNotifyUser
+}
+
+// retryNoHit runs the retry of rag.no_hit.behavior for a search that found
+// nothing, and returns its results, which may be empty too.
+func (s *Service) retryNoHit(ctx context.Context, b *backend, query string, storeQuery StoreQuery) ([]SearchResult, error) {
+	var results []SearchResult
+	var err error
+	switch s.cfg.NoHit.Behavior {
+	case NoHitLowerThresholdOnce:
+		threshold := s.cfg.NoHit.LowerThreshold
+		if threshold >= storeQuery.MinSimilarity {
+			return nil, nil
+		}
+		storeQuery.MinSimilarity = threshold
+		results, err = s.searchChunks(ctx, b, storeQuery)
+	case NoHitFallbackKeyword:
+		results, err = s.keywordSearch(ctx, b, query, storeQuery.Filter, storeQuery.Limit)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("No notes above min_similarity, retried", map[string]interface{}{
+		"behavior": s.cfg.NoHit.Behavior,
+		"results":  len(results),
+	})
+	return results, nil
+}
+
+// keywordSearch finds chunks whose text contains terms of the query and ranks
+// them by the number of terms they contain. It has no similarity, so its
+// results score 0. Without a full-text index on content, Qdrant matches each
+// term as a substring; the search scans the collection, which is acceptable
+// for a fallback.
+func (s *Service) keywordSearch(ctx context.Context, b *backend, query string, filter SearchFilter, limit int) ([]SearchResult, error) {
+	store, ok := b.store.(*QdrantClient)
+	if !ok {
+		return nil, nil
+	}
+	terms := keywordTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	should := make([]map[string]interface{}, len(terms))
+	for idx, term := range terms {
+		should[idx] = map[string]interface{}{
+			"key":   "content",
+			"match": map[string]interface{}{"text": term},
+		}
+	}
+	qfilter := documentsFilter(filter.qdrantFilter(), false)
+	qfilter["should"] = should
+	points, _, err := store.scroll(ctx, qfilter, nil, limit*4)
+	if err != nil {
+		return nil, err
+	}
+	scored := make([]qdrantScoredPoint, 0, len(points))
+	for _, p := range points {
+		scored = append(scored, qdrantScoredPoint{ID: p.ID, Payload: p.Payload})
+	}
+	results := scoredPointsToResults(scored)
+	matches := make([]int, len(results))
+	for idx, r := range results {
+		content := strings.ToLower(r.Content)
+		for _, term := range terms {
+			if strings.Contains(content, term) {
+				matches[idx]++
+			}
+		}
+	}
+	order := make([]int, len(results))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(a, b int) bool { return matches[order[a]] > matches[order[b]] })
+	ranked := make([]SearchResult, 0, min(limit, len(results)))
+	for _, idx := range order {
+		if len(ranked) == limit || matches[idx] == 0 {
+			break
+		}
+		ranked = append(ranked, results[idx])
+	}
+	return ranked, nil
+}
+
+// keywordTerms picks the distinct lowercase words of query worth matching:
+// three letters or more, or two for CJK, where words are not separated.
+func keywordTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		n := utf8.RuneCountInString(word)
+		first, _ := utf8.DecodeRuneInString(word)
+		if seen[word] || n < 2 || (n < 3 && !unicode.In(first, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)) {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == keywordTermsMax {
+			break
+		}
+	}
+	return terms
+}
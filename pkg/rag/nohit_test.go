@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNormalizeNoHit(t *testing.T) {
+	tests := []struct {
+		behavior string
+		fallback bool
+		want     string
+	}{
+		{"", false, NoHitNotifyUser},
+		{"", true, NoHitSilent},
+		{NoHitFallbackKeyword, false, NoHitFallbackKeyword},
+	}
+	for _, tt := range tests {
+		got, err := normalizeNoHit(config.RagNoHitConfig{Behavior: tt.behavior}, tt.fallback)
+		if err != nil || got.Behavior != tt.want {
+			t.Errorf("normalizeNoHit(%q, %v) = %q, %v", tt.behavior, tt.fallback, got.Behavior, err)
+		}
+	}
+	if _, err := normalizeNoHit(config.RagNoHitConfig{Behavior: "shrug"}, false); err == nil {
+		t.Error("expected an error for an unknown behavior")
+	}
+
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.cfg.Trigger.ForcePrefixes = []string{"kb:"}
+	s.cfg.NoHit.Behavior = NoHitLowerThresholdOnce
+	s.cfg.FallbackToLLM = true
+	if d := s.TriggerDecision("kb: rate limits"); d.NoHit != NoHitSilent {
+		t.Errorf("TriggerDecision().NoHit = %q, want %q", d.NoHit, NoHitSilent)
+	}
+}
+
+func TestKeywordTerms(t *testing.T) {
+	got := strings.Join(keywordTerms("What is the API rate-limit? api 限流 a"), ",")
+	if got != "what,the,api,rate,limit,限流" {
+		t.Errorf("keywordTerms() = %q", got)
+	}
+}
+
+func TestRetryNoHit(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	var bodies []string
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		data, _ := json.Marshal(req)
+		bodies = append(bodies, string(data))
+		if strings.HasSuffix(r.URL.Path, "/points/scroll") {
+			w.Write([]byte(`{"result":{"points":[
+				{"id":"1","payload":{"path":"a.md","content":"Rate limits were raised."}},
+				{"id":"2","payload":{"path":"b.md","content":"The API rate limit is 100 per minute."}}
+			],"next_page_offset":null}}`))
+			return
+		}
+		w.Write([]byte(`{"result":[{"score":0.2,"payload":{"path":"c.md","content":"close enough"}}]}`))
+	})
+	b := s.backends()[0]
+	query := StoreQuery{Vector: []float64{1, 0}, Limit: 5, MinSimilarity: 0.25}
+
+	s.cfg.NoHit = config.RagNoHitConfig{Behavior: NoHitLowerThresholdOnce, LowerThreshold: 0.15}
+	results, err := s.retryNoHit(t.Context(), b, "rate limits", query)
+	if err != nil || len(results) != 1 || results[0].Path != "c.md" {
+		t.Errorf("lower_threshold_once results = %+v, %v", results, err)
+	}
+	if !strings.Contains(bodies[0], `"score_threshold":0.15`) {
+		t.Errorf("retry request = %s", bodies[0])
+	}
+
+	bodies = nil
+	s.cfg.NoHit.Behavior = NoHitFallbackKeyword
+	results, err = s.retryNoHit(t.Context(), b, "API rate limit", query)
+	if err != nil || len(results) != 2 || results[0].Path != "b.md" || results[1].Path != "a.md" {
+		t.Errorf("fallback_keyword results = %+v, %v", results, err)
+	}
+	if !strings.Contains(bodies[0], `"should":[{"key":"content","match":{"text":"api"}},{"key":"content","match":{"text":"rate"}},{"key":"content","match":{"text":"limit"}}]`) {
+		t.Errorf("keyword request = %s", bodies[0])
+	}
+
+	s.cfg.NoHit.Behavior = NoHitSilent
+	if results, err := s.retryNoHit(t.Context(), b, "x", query); results != nil || err != nil {
+		t.Errorf("silent retry = %+v, %v", results, err)
+	}
+}
@@ -0,0 +1,21 @@
+package rag
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText prepares note text for chunking and hashing. It drops a UTF-8
+// BOM, turns CRLF and lone CR line endings into LF and converts the text to
+// Unicode NFC, composing decomposed sequences (as written by macOS), so the
+// same note produces the same chunks, line numbers and hashes on every
+// machine.
+func normalizeText(text string) string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	if strings.Contains(text, "\r") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	return norm.NFC.String(text)
+}
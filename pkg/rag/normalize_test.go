@@ -0,0 +1,29 @@
+package rag
+
+import "testing"
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"crlf", "a\r\nb\rc\n", "a\nb\nc\n"},
+		{"bom", "\ufeff# Title", "# Title"},
+		{"latin acute", "Cafe\u0301", "Caf\u00e9"},
+		{"stacked marks", "Vie\u0323\u0302t", "Vi\u1ec7t"},
+		{"kana voiced mark", "\u304b\u3099", "\u304c"},
+		{"hangul jamo", "\u1100\u1161\u11a8", "\uac01"},
+		{"already composed", "Caf\u00e9 \u304c \uac01", "Caf\u00e9 \u304c \uac01"},
+		{"lone mark", "\u0301x", "\u0301x"},
+		{"marks out of order", "Vie\u0302\u0323t", "Vi\u1ec7t"},
+		{"singleton", "\u212b", "\u00c5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.in); got != tt.want {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
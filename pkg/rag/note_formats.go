@@ -0,0 +1,65 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// noteFormats selects the file types indexed besides markdown notes.
+type noteFormats struct {
+	// HTML indexes .html and .htm pages; see rag.index_html.
+	HTML bool
+	// EPUB indexes .epub books; see rag.index_epub.
+	EPUB bool
+	// Audio indexes transcripts of audio notes; see rag.transcription.
+	Audio bool
+}
+
+func noteFormatsOf(cfg config.RagConfig) noteFormats {
+	return noteFormats{HTML: cfg.IndexHTML, EPUB: cfg.IndexEPUB, Audio: cfg.Transcription.Enabled}
+}
+
+// isNoteFile reports whether a file is indexed: markdown notes always, other
+// formats when enabled.
+func isNoteFile(name string, formats noteFormats) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md":
+		return true
+	case ".html", ".htm":
+		return formats.HTML
+	case ".epub":
+		return formats.EPUB
+	}
+	return formats.Audio && isAudioFile(name)
+}
+
+// readNote returns the markdown text of a note. Other formats are converted
+// so they go through the same chunking as markdown notes; audio notes are
+// read from the transcript cache, which audio may leave nil when there is
+// none.
+func readNote(path string, audio *transcripts) ([]byte, error) {
+	if isAudioFile(path) {
+		return audio.read(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var text string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		text, err = htmlToMarkdown(data, "")
+	case ".epub":
+		text, err = epubToMarkdown(data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+	return []byte(text), nil
+}
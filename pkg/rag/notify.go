@@ -0,0 +1,108 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Index notification events.
+const (
+	IndexEventCompleted = "index.completed"
+	IndexEventFailed    = "index.failed"
+)
+
+// maxNotifiedFailures caps the per-file failures listed in a notification.
+const maxNotifiedFailures = 10
+
+// IndexNotification is the JSON body posted to rag.notifications.webhook_url.
+type IndexNotification struct {
+	Event    string             `json:"event"`
+	Trigger  string             `json:"trigger"`
+	Time     time.Time          `json:"time"`
+	Error    string             `json:"error,omitempty"`
+	Summary  *IndexReportCounts `json:"summary,omitempty"`
+	Failures []IndexReportFile  `json:"failures,omitempty"`
+}
+
+// NewIndexNotification describes the outcome of an index run.
+func NewIndexNotification(trigger string, summary *IndexSummary, err error) IndexNotification {
+	n := IndexNotification{Event: IndexEventCompleted, Trigger: trigger, Time: time.Now().UTC()}
+	if err != nil {
+		n.Event = IndexEventFailed
+		n.Error = err.Error()
+	}
+	if summary != nil {
+		counts := reportCounts(summary)
+		n.Summary = &counts
+		for idx, f := range summary.Failures {
+			if idx == maxNotifiedFailures {
+				break
+			}
+			n.Failures = append(n.Failures, reportFile(f))
+		}
+	}
+	return n
+}
+
+// HasFailures reports whether the run failed or skipped files.
+func (n IndexNotification) HasFailures() bool {
+	return n.Event == IndexEventFailed || (n.Summary != nil && n.Summary.FailedFiles > 0)
+}
+
+// Text renders the notification as a short chat message.
+func (n IndexNotification) Text() string {
+	var sb strings.Builder
+	if n.Event == IndexEventFailed {
+		sb.WriteString(fmt.Sprintf("❌ Knowledge base index (%s) failed: %s", n.Trigger, n.Error))
+		return sb.String()
+	}
+	s := n.Summary
+	icon := "✅"
+	if s.FailedFiles > 0 {
+		icon = "⚠️"
+	}
+	sb.WriteString(fmt.Sprintf("%s Knowledge base index (%s) done: %d new, %d updated, %d removed, %d chunks",
+		icon, n.Trigger, s.IndexedFiles, s.UpdatedFiles, s.RemovedFiles, s.Chunks))
+	if s.FullReindexReason != "" {
+		sb.WriteString(fmt.Sprintf("\nFull rebuild: %s", s.FullReindexReason))
+	}
+	if s.FailedFiles > 0 {
+		sb.WriteString(fmt.Sprintf("\n%d file(s) failed:", s.FailedFiles))
+		for _, f := range n.Failures {
+			sb.WriteString(fmt.Sprintf("\n- %s: %s", f.Path, f.Error))
+		}
+		if s.FailedFiles > len(n.Failures) {
+			sb.WriteString(fmt.Sprintf("\n- and %d more", s.FailedFiles-len(n.Failures)))
+		}
+	}
+	return sb.String()
+}
+
+// PostIndexWebhook posts n as JSON to url.
+func PostIndexWebhook(ctx context.Context, url string, n IndexNotification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := newHTTPClient(5*time.Second, 5*time.Second, defaultHTTPTuning).Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
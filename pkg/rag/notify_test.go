@@ -0,0 +1,45 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndexNotificationText(t *testing.T) {
+	summary := &IndexSummary{IndexedFiles: 2, Chunks: 7, FailedFiles: 1,
+		Failures: []IndexFileResult{{Path: "bad.md", Action: IndexActionFailed, Error: "permission denied"}}}
+	n := NewIndexNotification(IndexTriggerSchedule, summary, nil)
+	if !n.HasFailures() {
+		t.Error("a run with failed files should count as a failure")
+	}
+	text := n.Text()
+	if !strings.Contains(text, "2 new") || !strings.Contains(text, "bad.md: permission denied") {
+		t.Errorf("unexpected text: %q", text)
+	}
+
+	failed := NewIndexNotification(IndexTriggerSignal, nil, errors.New("qdrant down"))
+	if failed.Event != IndexEventFailed || !strings.Contains(failed.Text(), "qdrant down") {
+		t.Errorf("unexpected failure notification: %+v", failed)
+	}
+}
+
+func TestPostIndexWebhook(t *testing.T) {
+	var got IndexNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n := NewIndexNotification(IndexTriggerAdmin, &IndexSummary{Chunks: 3}, nil)
+	if err := PostIndexWebhook(context.Background(), srv.URL, n); err != nil {
+		t.Fatalf("PostIndexWebhook() error: %v", err)
+	}
+	if got.Event != IndexEventCompleted || got.Trigger != IndexTriggerAdmin || got.Summary.Chunks != 3 {
+		t.Errorf("webhook received %+v", got)
+	}
+}
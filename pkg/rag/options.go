@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Option customizes a Service built by NewService.
+type Option func(*serviceOptions)
+
+type serviceOptions struct {
+	log        Logger
+	httpClient *http.Client
+	store      VectorStore
+	embedder   Embedder
+	now        func() time.Time
+}
+
+// Logger receives the messages the service logs. fields may be nil.
+type Logger interface {
+	Info(message string, fields map[string]interface{})
+	Warn(message string, fields map[string]interface{})
+}
+
+// defaultLogger writes to the picoclaw log under the "rag" component.
+type defaultLogger struct{}
+
+func (defaultLogger) Info(message string, fields map[string]interface{}) {
+	logger.InfoCF("rag", message, fields)
+}
+
+func (defaultLogger) Warn(message string, fields map[string]interface{}) {
+	logger.WarnCF("rag", message, fields)
+}
+
+// WithLogger sends the service's log messages to log instead of the picoclaw
+// log.
+func WithLogger(log Logger) Option {
+	return func(o *serviceOptions) { o.log = log }
+}
+
+// WithHTTPClient makes the built-in embedding, Qdrant, transcription and
+// remote vault clients send their requests through client, e.g. to add a
+// proxy or tracing. Per-request deadlines still come from the rag config.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *serviceOptions) { o.httpClient = client }
+}
+
+// WithVectorStore replaces the Qdrant store of the default index; rag.vector_db
+// is then not needed. Language routes still use Qdrant.
+func WithVectorStore(store VectorStore) Option {
+	return func(o *serviceOptions) { o.store = store }
+}
+
+// WithEmbedder replaces the embedding client of the default index;
+// rag.embedding is then not needed. Language routes still use their
+// configured clients.
+func WithEmbedder(embedder Embedder) Option {
+	return func(o *serviceOptions) { o.embedder = embedder }
+}
+
+// WithClock sets what the service takes the current time from for the
+// times it records and compares against, such as the index state's update
+// time, the query log and date filters. Durations are always measured with
+// the system clock.
+func WithClock(now func() time.Time) Option {
+	return func(o *serviceOptions) { o.now = now }
+}
+
+// setHTTPClient points the built-in clients of the service at client.
+func (s *Service) setHTTPClient(client *http.Client) {
+	for _, b := range s.backends() {
+		if e, ok := b.embedder.(*EmbeddingClient); ok {
+			e.httpClient = compressingClient(client, e.compression)
+		}
+		if q, ok := b.store.(*QdrantClient); ok {
+			q.httpClient = compressingClient(client, q.compression)
+		}
+	}
+	for _, r := range s.remotes {
+		switch src := r.source.(type) {
+		case *s3Source:
+			src.httpClient = client
+		case *webdavSource:
+			src.httpClient = client
+		case *confluenceSource:
+			src.httpClient = client
+		}
+	}
+	s.httpClient = client
+}
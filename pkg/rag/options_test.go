@@ -0,0 +1,111 @@
+package rag
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fixedEmbedder struct{}
+
+func (fixedEmbedder) EmbedBatch(_ context.Context, inputs []string) ([][]float64, error) {
+	out := make([][]float64, len(inputs))
+	for idx := range out {
+		out[idx] = []float64{1, 0}
+	}
+	return out, nil
+}
+func (fixedEmbedder) Model() string    { return "fixed" }
+func (fixedEmbedder) BatchSize() int   { return 16 }
+func (fixedEmbedder) Concurrency() int { return 1 }
+
+type oneResultStore struct {
+	VectorStore
+}
+
+func (oneResultStore) Collection() string { return "memory" }
+func (oneResultStore) Search(_ context.Context, q StoreQuery) ([]SearchResult, error) {
+	return []SearchResult{{Path: "a.md", Content: "alpha", Score: 0.9}}, nil
+}
+
+type recordingLogger struct {
+	warnings []string
+}
+
+func (l *recordingLogger) Info(string, map[string]interface{}) {}
+func (l *recordingLogger) Warn(message string, _ map[string]interface{}) {
+	l.warnings = append(l.warnings, message)
+}
+
+func TestNewServiceOptions(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.DataDir = dir
+	cfg.RAG.QueryLog = true
+	cfg.RAG.Pinned.Notes = []string{"missing.md"}
+	cfg.RAG.VectorDB.URL = ""
+
+	log := &recordingLogger{}
+	clock := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s, err := NewService(cfg, dir,
+		WithEmbedder(fixedEmbedder{}),
+		WithVectorStore(oneResultStore{}),
+		WithLogger(log),
+		WithClock(func() time.Time { return clock }),
+	)
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	results, err := s.Search(t.Context(), "alpha")
+	if err != nil || len(results) != 1 || results[0].Path != "a.md" {
+		t.Fatalf("Search() = %+v, %v", results, err)
+	}
+	entries, err := readQueryLog(s.storage, time.Time{})
+	if err != nil || len(entries) != 1 || !entries[0].Time.Equal(clock) {
+		t.Errorf("query log = %+v, %v", entries, err)
+	}
+	s.Pinned(nil)
+	if len(log.warnings) != 1 || log.warnings[0] != "Pinned note not found" {
+		t.Errorf("logged warnings = %q", log.warnings)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+	var requests atomic.Int32
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.DataDir = dir
+	cfg.RAG.Embedding.APIBase = srv.URL
+	cfg.RAG.Embedding.Model = "m"
+	s, err := NewService(cfg, dir, WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	if _, err := s.embedder.EmbedBatch(t.Context(), []string{"hello"}); err != nil {
+		t.Fatalf("EmbedBatch() error: %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests through the client = %d, want 1", requests.Load())
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,114 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SearchPageOptions selects a window of matches. PageToken, when set, takes
+// precedence over Offset.
+type SearchPageOptions struct {
+	Limit     int
+	Offset    int
+	PageToken string
+	Filter    SearchFilter
+}
+
+// SearchPage is one window of matches. NextPageToken is empty on the last page.
+type SearchPage struct {
+	Results       []SearchResult
+	Offset        int
+	NextPageToken string
+}
+
+type pageToken struct {
+	Query  string `json:"q"`
+	Offset int    `json:"o"`
+}
+
+// SearchPage pages through matches beyond top_k. Each page is searched and
+// ranked like Search, but per-document grouping is not applied, so a page
+// holds a full window of the store's matches.
+func (s *Service) SearchPage(ctx context.Context, query string, opts SearchPageOptions) (*SearchPage, error) {
+	ctx, cancel := s.searchContext(ctx)
+	defer cancel()
+	s.refreshState(ctx)
+	fingerprint := queryFingerprint(strings.TrimSpace(query) + "\x00" + opts.Filter.key())
+	r, err := s.prepareRetrieval(ctx, query, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return &SearchPage{}, nil
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = r.params.topK
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+	offset := opts.Offset
+	if opts.PageToken != "" {
+		tok, err := decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, err
+		}
+		if tok.Query != fingerprint {
+			return nil, fmt.Errorf("%w: token belongs to a different query", ErrInvalidPageToken)
+		}
+		offset = tok.Offset
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	r.limit, r.offset = limit, offset
+	vector, err := embedQuery(ctx, r.backend.embedder, r.query)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.searchVector(ctx, r, vector, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: results, Offset: offset}
+	if len(results) == limit {
+		page.NextPageToken = encodePageToken(pageToken{
+			Query:  fingerprint,
+			Offset: offset + limit,
+		})
+	}
+	return page, nil
+}
+
+func queryFingerprint(query string) string {
+	sum := sha1.Sum([]byte(query))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodePageToken(tok pageToken) string {
+	data, _ := json.Marshal(tok)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(raw string) (pageToken, error) {
+	var tok pageToken
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return tok, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return tok, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	if tok.Offset < 0 {
+		return tok, fmt.Errorf("%w: negative offset", ErrInvalidPageToken)
+	}
+	return tok, nil
+}
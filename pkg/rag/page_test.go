@@ -0,0 +1,143 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	raw := encodePageToken(pageToken{Query: queryFingerprint("sepsis"), Offset: 12})
+	tok, err := decodePageToken(raw)
+	if err != nil {
+		t.Fatalf("decodePageToken() error: %v", err)
+	}
+	if tok.Offset != 12 || tok.Query != queryFingerprint("sepsis") {
+		t.Errorf("decodePageToken() = %+v", tok)
+	}
+
+	if _, err := decodePageToken("not a token!"); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("expected ErrInvalidPageToken, got %v", err)
+	}
+}
+
+// windowStore returns a window of limit results, two per note, and records
+// the queries.
+type windowStore struct {
+	VectorStore
+	queries []StoreQuery
+}
+
+func (s *windowStore) Collection() string { return "notes" }
+func (s *windowStore) Search(_ context.Context, q StoreQuery) ([]SearchResult, error) {
+	s.queries = append(s.queries, q)
+	results := make([]SearchResult, q.Limit)
+	for idx := range results {
+		results[idx] = SearchResult{Path: fmt.Sprintf("%d.md", (q.Offset+idx)/2), Score: 0.9}
+	}
+	return results, nil
+}
+
+func TestSearchPage(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.QueryLog = true
+	cfg.RAG.GroupByDocument = true
+	cfg.RAG.MaxChunksPerDoc = 1
+	store := &windowStore{}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+
+	page, err := s.SearchPage(t.Context(), "sepsis", SearchPageOptions{Limit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 4 || page.NextPageToken == "" {
+		t.Fatalf("first page = %+v, want a full window of 4 and a next token", page)
+	}
+	page, err = s.SearchPage(t.Context(), "sepsis", SearchPageOptions{Limit: 4, PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := store.queries[len(store.queries)-1]; q.Limit != 4 || q.Offset != 4 || page.Offset != 4 {
+		t.Errorf("second page searched %d at %d, page offset %d", q.Limit, q.Offset, page.Offset)
+	}
+	if entries, _ := readQueryLog(s.storage, time.Time{}); len(entries) != 1 {
+		t.Errorf("query log has %d entries, want only the first page", len(entries))
+	}
+}
+
+// rankedStore holds results best first and returns the window of each query.
+type rankedStore struct {
+	VectorStore
+	results []SearchResult
+}
+
+func (s *rankedStore) Collection() string { return "notes" }
+func (s *rankedStore) Search(_ context.Context, q StoreQuery) ([]SearchResult, error) {
+	start := min(q.Offset, len(s.results))
+	end := min(start+q.Limit, len(s.results))
+	return append([]SearchResult(nil), s.results[start:end]...), nil
+}
+
+func TestSearchPageEnsemble(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory"}}
+	// The collections interleave unevenly, so their own windows of a page
+	// are not the page of the fused ranking.
+	vault, memory := &rankedStore{}, &rankedStore{}
+	for idx, score := range []float64{0.99, 0.98, 0.97, 0.96, 0.6, 0.5} {
+		vault.results = append(vault.results, SearchResult{ID: fmt.Sprintf("v%d", idx), Path: fmt.Sprintf("v%d.md", idx), Score: score})
+	}
+	for idx, score := range []float64{0.95, 0.9, 0.8, 0.7, 0.4, 0.3} {
+		memory.results = append(memory.results, SearchResult{ID: fmt.Sprintf("m%d", idx), Path: fmt.Sprintf("m%d.md", idx), Score: score})
+	}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+	s.ensemble[0].store = memory
+
+	var got []string
+	opts := SearchPageOptions{Limit: 3}
+	for pages := 0; pages < 10; pages++ {
+		page, err := s.SearchPage(t.Context(), "sepsis", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range page.Results {
+			got = append(got, r.ID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		opts.PageToken = page.NextPageToken
+	}
+	want := "v0,v1,v2,v3,m0,m1,m2,m3,v4,v5,m4,m5"
+	if strings.Join(got, ",") != want {
+		t.Errorf("paged results = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestSearchPageTimeout(t *testing.T) {
+	s, _, aborted := newBlockingService(t, 50)
+	start := time.Now()
+	_, err := s.SearchPage(t.Context(), "hello", SearchPageOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SearchPage() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SearchPage() took %s with a 50ms timeout", elapsed)
+	}
+	waitClosed(t, aborted, "the embedding request to be aborted")
+}
@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Note paths are handled in two forms. Logical paths are slash-separated and
+// relative to the vault; they are what the index, the state file and search
+// results use on every platform. OS paths are only built at the point of
+// file IO, through ioPath.
+
+// logicalPath converts a path produced by the OS, e.g. from filepath.Rel,
+// into a logical path.
+func logicalPath(osRel string) string {
+	return path.Clean(filepath.ToSlash(osRel))
+}
+
+// slashPath converts a user-supplied path or pattern to slash form.
+// Backslashes count as separators on every platform, since configs and
+// queries are often written on Windows and used elsewhere.
+func slashPath(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// windowsMaxDirPath is the longest directory path the Win32 API accepts
+// without the \\?\ prefix (MAX_PATH minus room for an 8.3 file name).
+const windowsMaxDirPath = 248
+
+// ioPath returns the path to hand to the os package. On Windows, long paths
+// are made absolute and given the \\?\ prefix; the os package only does this
+// itself for paths that are already absolute, which misses relative vault
+// roots.
+func ioPath(p string) string {
+	if runtime.GOOS != "windows" {
+		return p
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if len(p) < windowsMaxDirPath {
+		return p
+	}
+	return windowsExtendedPath(p)
+}
+
+// windowsExtendedPath rewrites an absolute Windows path into extended-length
+// form: C:\dir becomes \\?\C:\dir and \\server\share becomes
+// \\?\UNC\server\share. Such paths bypass normalization, so forward slashes
+// are converted. Other paths are returned unchanged.
+func windowsExtendedPath(p string) string {
+	switch {
+	case strings.HasPrefix(p, `\\?\`), strings.HasPrefix(p, `\\.\`):
+		return p
+	case strings.HasPrefix(p, `\\`):
+		return `\\?\UNC\` + strings.ReplaceAll(p[2:], "/", `\`)
+	case len(p) >= 3 && isDriveLetter(p[0]) && p[1] == ':' && (p[2] == '\\' || p[2] == '/'):
+		return `\\?\` + strings.ReplaceAll(p, "/", `\`)
+	}
+	return p
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
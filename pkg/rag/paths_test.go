@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWindowsExtendedPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`C:\vault\notes\a.md`, `\\?\C:\vault\notes\a.md`},
+		{`d:/vault/a.md`, `\\?\d:\vault\a.md`},
+		{`\\nas\share\vault\a.md`, `\\?\UNC\nas\share\vault\a.md`},
+		{`\\?\C:\already\extended`, `\\?\C:\already\extended`},
+		{`\\.\pipe\name`, `\\.\pipe\name`},
+		{`relative\a.md`, `relative\a.md`},
+		{`/unix/path`, `/unix/path`},
+	}
+	for _, tt := range tests {
+		if got := windowsExtendedPath(tt.in); got != tt.want {
+			t.Errorf("windowsExtendedPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSlashPathPatterns(t *testing.T) {
+	if got := slashPath(`notes\icu\fluids.md`); got != "notes/icu/fluids.md" {
+		t.Errorf("slashPath = %q", got)
+	}
+	re, err := globToRegex(`.obsidian\**`)
+	if err != nil {
+		t.Fatalf("globToRegex() error: %v", err)
+	}
+	if !re.MatchString(".obsidian/plugins/x.md") {
+		t.Errorf("Windows-style pattern %s should match slash paths", re)
+	}
+}
+
+func TestLogicalPath(t *testing.T) {
+	rel := filepath.Join("notes", "icu", "..", "fluids.md")
+	if got := logicalPath(rel); got != "notes/fluids.md" {
+		t.Errorf("logicalPath(%q) = %q", rel, got)
+	}
+}
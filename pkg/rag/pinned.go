@@ -0,0 +1,156 @@
+package rag
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// pinPrefix marks an inline pin in a message, e.g. `pin:glossary.md` or
+// `pin:"Reading list"`.
+const pinPrefix = "pin:"
+
+// parsePins removes `pin:` terms from a message and returns the notes they
+// name. A message without pins is returned unchanged.
+func parsePins(message string) (string, []string) {
+	if !strings.Contains(strings.ToLower(message), pinPrefix) {
+		return message, nil
+	}
+	var pins, rest []string
+	remaining := strings.TrimSpace(message)
+	for remaining != "" {
+		token, value, tail := nextQueryToken(remaining)
+		remaining = strings.TrimSpace(tail)
+		if len(value) > len(pinPrefix) && strings.EqualFold(value[:len(pinPrefix)], pinPrefix) {
+			pins = append(pins, strings.Trim(value[len(pinPrefix):], `"`))
+			continue
+		}
+		rest = append(rest, token)
+	}
+	if len(pins) == 0 {
+		return message, nil
+	}
+	return strings.Join(rest, " "), pins
+}
+
+// Pinned reads the notes of rag.pinned.notes followed by extra, such as the
+// pins of a TriggerDecision, for inclusion in the context whatever the search
+// finds. Together they take at most rag.pinned.max_tokens: a note that does
+// not fit is truncated, and the notes after it are left out. Notes that
+// cannot be read are logged and skipped.
+func (s *Service) Pinned(extra []string) []SearchResult {
+	names := append(append([]string(nil), s.cfg.Pinned.Notes...), extra...)
+	if len(names) == 0 {
+		return nil
+	}
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil
+	}
+	remaining := s.cfg.Pinned.MaxTokens
+	seen := make(map[string]bool)
+	var pinned []SearchResult
+	for _, name := range names {
+		rel, text, modTime, ok := readPinned(v, name)
+		if !ok {
+			rel, text, modTime, ok = s.readMovedPin(v, name)
+		}
+		if !ok {
+			s.log.Warn("Pinned note not found", map[string]interface{}{
+				"note": name,
+			})
+			continue
+		}
+		if seen[rel] || text == "" {
+			continue
+		}
+		seen[rel] = true
+		if remaining < minTruncatedTokens {
+			s.log.Warn("Pinned notes exceed rag.pinned.max_tokens", map[string]interface{}{
+				"note":       rel,
+				"max_tokens": s.cfg.Pinned.MaxTokens,
+			})
+			break
+		}
+		if EstimateTokens(text) > remaining {
+			room := remaining - EstimateTokens(truncatedMarker)
+			text = s.cutter.cut(text, room*5/2) + truncatedMarker
+		}
+		remaining -= EstimateTokens(text)
+		meta := parseFrontmatter(text)
+		pinned = append(pinned, SearchResult{
+			Path:      rel,
+			Heading:   meta.Title,
+			StartLine: 1,
+			EndLine:   strings.Count(text, "\n") + 1,
+			Content:   text,
+			ModTime:   modTime,
+			Tags:      meta.Tags,
+			Pinned:    true,
+		})
+	}
+	return pinned
+}
+
+// readPinned reads a pinned note by its logical path, adding ".md" when the
+// name has no extension.
+func readPinned(v *vault, name string) (rel, text string, modTime time.Time, ok bool) {
+	rel = pinnedPath(name)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", "", time.Time{}, false
+	}
+	candidates := []string{rel}
+	if path.Ext(rel) == "" {
+		candidates = append(candidates, rel+".md")
+	}
+	for _, rel := range candidates {
+		absPath, found := v.abs(rel)
+		if !found {
+			continue
+		}
+		data, err := readNote(ioPath(absPath), nil)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(ioPath(absPath)); err == nil {
+			modTime = info.ModTime()
+		}
+		return rel, strings.TrimSpace(normalizeText(string(data))), modTime, true
+	}
+	return "", "", time.Time{}, false
+}
+
+// readMovedPin reads a pinned note named by a path it had before it was
+// renamed or moved.
+func (s *Service) readMovedPin(v *vault, name string) (rel, text string, modTime time.Time, ok bool) {
+	old := pinnedPath(name)
+	candidates := []string{old}
+	if path.Ext(old) == "" {
+		candidates = append(candidates, old+".md")
+	}
+	for _, candidate := range candidates {
+		if moved, found := s.movedPath(candidate); found {
+			return readPinned(v, moved)
+		}
+	}
+	return "", "", time.Time{}, false
+}
+
+// pinnedPath cleans the logical path of a pinned note.
+func pinnedPath(name string) string {
+	return strings.TrimPrefix(path.Clean(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/")), "/")
+}
+
+// splitPinned separates pinned results from search results, keeping the
+// order within each.
+func splitPinned(results []SearchResult) (pinned, rest []SearchResult) {
+	for _, r := range results {
+		if r.Pinned {
+			pinned = append(pinned, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	return pinned, rest
+}
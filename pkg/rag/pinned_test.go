@@ -0,0 +1,72 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePins(t *testing.T) {
+	msg, pins := parsePins(`pin:glossary what does PID mean pin:"Reading list"`)
+	if msg != "what does PID mean" || strings.Join(pins, "|") != "glossary|Reading list" {
+		t.Errorf("parsePins() = %q, %q", msg, pins)
+	}
+	msg, pins = parsePins("keep  the spacing: pin:")
+	if msg != "keep  the spacing: pin:" || pins != nil {
+		t.Errorf("parsePins() without pins = %q, %q", msg, pins)
+	}
+}
+
+func TestPinnedReadsNotesWithinBudget(t *testing.T) {
+	vault := t.TempDir()
+	os.MkdirAll(filepath.Join(vault, "ref"), 0o755)
+	os.WriteFile(filepath.Join(vault, "instructions.md"), []byte("---\ntags: [me]\n---\nAnswer in English.\n"), 0o644)
+	os.WriteFile(filepath.Join(vault, "ref", "glossary.md"), []byte(strings.Repeat("A term is defined here. ", 200)), 0o644)
+	s := newRunnerTestService(t, t.TempDir(), vault)
+	s.cfg.Pinned.Notes = []string{"instructions.md", "missing.md"}
+	s.cfg.Pinned.MaxTokens = 200
+
+	pinned := s.Pinned([]string{"ref/glossary", "instructions.md"})
+	if len(pinned) != 2 {
+		t.Fatalf("Pinned() = %d notes, want 2", len(pinned))
+	}
+	first := pinned[0]
+	if first.Path != "instructions.md" || !first.Pinned || first.EndLine != 4 || strings.Join(first.Tags, ",") != "me" {
+		t.Errorf("first pinned note = %+v", first)
+	}
+	second := pinned[1]
+	if second.Path != "ref/glossary.md" || !strings.HasSuffix(second.Content, truncatedMarker) {
+		t.Errorf("second pinned note = %q, %q", second.Path, second.Content)
+	}
+	if used := EstimateTokens(first.Content) + EstimateTokens(second.Content); used > 200 {
+		t.Errorf("pinned notes use %d tokens, want at most 200", used)
+	}
+	if got := FormatSource(first); got != "instructions.md L1-L4 (pinned)" {
+		t.Errorf("FormatSource() = %q", got)
+	}
+
+	if pinned := s.Pinned([]string{"../outside.md"}); len(pinned) != 1 {
+		t.Errorf("Pinned() outside the vault = %+v", pinned)
+	}
+}
+
+func TestFitContextKeepsPinnedNotesFirst(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.format.maxResults = 1
+	results := []SearchResult{
+		{Path: "a.md", StartLine: 1, EndLine: 2, Content: "alpha", Score: 0.9},
+		{Path: "b.md", StartLine: 1, EndLine: 2, Content: "beta", Score: 0.8},
+		{Path: "pin.md", StartLine: 1, EndLine: 1, Content: "standing context", Pinned: true},
+	}
+	text, kept := s.FitContext(results, 10000)
+	if len(kept) != 2 || kept[0].Path != "pin.md" || kept[1].Path != "a.md" {
+		t.Fatalf("kept = %+v", kept)
+	}
+	if !strings.Contains(text, "[1] pin.md L1-L1 (pinned)") || !strings.Contains(text, "[2] a.md") {
+		t.Errorf("context = %q", text)
+	}
+	if c := s.Confidence(results); c.TopScore != 0.9 || c.Spread < 0.09 {
+		t.Errorf("Confidence() counted the pinned note: %+v", c)
+	}
+}
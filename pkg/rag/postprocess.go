@@ -0,0 +1,140 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// PostProcessResult is the JSON form of a SearchResult exchanged with the
+// post-processing command.
+type PostProcessResult struct {
+	ID           string   `json:"id,omitempty"`
+	Path         string   `json:"path"`
+	DocID        string   `json:"doc_id,omitempty"`
+	Heading      string   `json:"heading,omitempty"`
+	HeadingPath  []string `json:"heading_path,omitempty"`
+	HeadingLevel int      `json:"heading_level,omitempty"`
+	Anchor       string   `json:"anchor,omitempty"`
+	StartLine    int      `json:"start_line"`
+	EndLine      int      `json:"end_line"`
+	AudioStart   int      `json:"audio_start,omitempty"`
+	AudioEnd     int      `json:"audio_end,omitempty"`
+	Content      string   `json:"content"`
+	Score        float64  `json:"score"`
+	Stale        bool     `json:"stale,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+}
+
+// commandPostProcessor is a Hooks that pipes search results through an
+// external command, so filtering and boosting can be written in any
+// language. The query is passed in PICOCLAW_RAG_QUERY. If the command fails,
+// times out or prints something that is not a result array, the results are
+// used unchanged.
+type commandPostProcessor struct {
+	NopHooks
+	command []string
+	timeout time.Duration
+	log     Logger
+}
+
+func newCommandPostProcessor(cfg config.RagPostProcessConfig) *commandPostProcessor {
+	if len(cfg.Command) == 0 || strings.TrimSpace(cfg.Command[0]) == "" {
+		return nil
+	}
+	return &commandPostProcessor{
+		command: cfg.Command,
+		timeout: secondsOrDefault(cfg.TimeoutSeconds, 5),
+		log:     defaultLogger{},
+	}
+}
+
+func (p *commandPostProcessor) OnAfterSearch(ctx context.Context, query string, results []SearchResult) []SearchResult {
+	if len(results) == 0 {
+		return results
+	}
+	out, err := p.run(ctx, query, results)
+	if err != nil {
+		p.log.Warn("Post-process command failed, using results unchanged", map[string]interface{}{
+			"command": p.command[0],
+			"error":   err.Error(),
+		})
+		return results
+	}
+	return out
+}
+
+func (p *commandPostProcessor) run(ctx context.Context, query string, results []SearchResult) ([]SearchResult, error) {
+	in := make([]PostProcessResult, len(results))
+	for idx, r := range results {
+		in[idx] = PostProcessResult{
+			ID:           r.ID,
+			Path:         r.Path,
+			DocID:        r.DocID,
+			Heading:      r.Heading,
+			HeadingPath:  r.HeadingPath,
+			HeadingLevel: r.HeadingLevel,
+			Anchor:       r.Anchor,
+			StartLine:    r.StartLine,
+			EndLine:      r.EndLine,
+			AudioStart:   r.AudioStart,
+			AudioEnd:     r.AudioEnd,
+			Content:      r.Content,
+			Score:        r.Score,
+			Stale:        r.Stale,
+			Namespace:    r.Namespace,
+		}
+	}
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, p.command[0], p.command[1:]...)
+	cmd.Env = append(os.Environ(), "PICOCLAW_RAG_QUERY="+query)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var transformed []PostProcessResult
+	if err := json.Unmarshal(stdout.Bytes(), &transformed); err != nil {
+		return nil, fmt.Errorf("invalid output: %w", err)
+	}
+	out := make([]SearchResult, len(transformed))
+	for idx, r := range transformed {
+		out[idx] = SearchResult{
+			ID:           r.ID,
+			Path:         r.Path,
+			DocID:        r.DocID,
+			Heading:      r.Heading,
+			HeadingPath:  r.HeadingPath,
+			HeadingLevel: r.HeadingLevel,
+			Anchor:       r.Anchor,
+			StartLine:    r.StartLine,
+			EndLine:      r.EndLine,
+			AudioStart:   r.AudioStart,
+			AudioEnd:     r.AudioEnd,
+			Content:      r.Content,
+			Score:        r.Score,
+			Stale:        r.Stale,
+			Namespace:    r.Namespace,
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package rag
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCommandPostProcessor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	if newCommandPostProcessor(config.RagPostProcessConfig{}) != nil {
+		t.Fatal("expected no post-processor without a command")
+	}
+	results := []SearchResult{
+		{ID: "1", Path: "a.md", StartLine: 1, EndLine: 3, Content: "alpha", Score: 0.9},
+		{ID: "2", Path: "b.md", StartLine: 4, EndLine: 5, Content: "beta", Score: 0.8},
+	}
+
+	echo := newCommandPostProcessor(config.RagPostProcessConfig{
+		Command: []string{"sh", "-c", `printf '[{"path":"%s.md","content":"x","score":1}]' "$PICOCLAW_RAG_QUERY"`},
+	})
+	got := echo.OnAfterSearch(context.Background(), "q", results)
+	if len(got) != 1 || got[0].Path != "q.md" || got[0].Score != 1 {
+		t.Errorf("OnAfterSearch() = %+v", got)
+	}
+
+	passThrough := newCommandPostProcessor(config.RagPostProcessConfig{Command: []string{"cat"}})
+	got = passThrough.OnAfterSearch(context.Background(), "q", results)
+	if len(got) != 2 || got[1].Path != "b.md" || got[1].EndLine != 5 || got[1].ID != "2" {
+		t.Errorf("pass-through OnAfterSearch() = %+v", got)
+	}
+
+	for _, command := range [][]string{{"false"}, {"echo", "not json"}} {
+		p := newCommandPostProcessor(config.RagPostProcessConfig{Command: command})
+		if got := p.OnAfterSearch(context.Background(), "q", results); len(got) != 2 {
+			t.Errorf("%v: expected results unchanged, got %+v", command, got)
+		}
+	}
+}
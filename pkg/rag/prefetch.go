@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"context"
+	"time"
+)
+
+// Prefetch is a retrieval started ahead of time. Its result is read with Wait.
+type Prefetch struct {
+	query   string
+	done    chan struct{}
+	cancel  context.CancelFunc
+	results []SearchResult
+	err     error
+}
+
+// Prefetch starts a budgeted search in the background so callers can overlap
+// retrieval with other work and collect the result later.
+func (s *Service) Prefetch(ctx context.Context, query string, filter SearchFilter) *Prefetch {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Prefetch{
+		query:  query,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	budget := time.Duration(s.cfg.SearchBudgetMs) * time.Millisecond
+	go func() {
+		defer close(p.done)
+		p.results, p.err = s.SearchWithBudget(ctx, query, filter, budget)
+	}()
+	return p
+}
+
+// Query returns the query the prefetch was started with.
+func (p *Prefetch) Query() string {
+	return p.query
+}
+
+// Wait blocks until the prefetched search finishes or ctx is done.
+func (p *Prefetch) Wait(ctx context.Context) ([]SearchResult, error) {
+	select {
+	case <-p.done:
+		return p.results, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel abandons the prefetch. Pending Wait calls return the cancellation error.
+func (p *Prefetch) Cancel() {
+	p.cancel()
+}
@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPrefetch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(oneResultStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+
+	p := s.Prefetch(t.Context(), "alpha", SearchFilter{})
+	if p.Query() != "alpha" {
+		t.Errorf("Query() = %q", p.Query())
+	}
+	results, err := p.Wait(t.Context())
+	if err != nil || len(results) != 1 || results[0].Path != "a.md" {
+		t.Errorf("Wait() = %+v, %v, want the search results", results, err)
+	}
+	// The result stays available to later calls.
+	if again, _ := p.Wait(t.Context()); len(again) != 1 {
+		t.Errorf("second Wait() = %+v", again)
+	}
+}
+
+func TestPrefetchWaitGivesUp(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(hangingStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+
+	p := s.Prefetch(t.Context(), "alpha", SearchFilter{})
+	defer p.Cancel()
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := p.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() with a cancelled context error = %v, want context.Canceled", err)
+	}
+	p.Cancel()
+	if _, err := p.Wait(t.Context()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() after Cancel error = %v, want context.Canceled", err)
+	}
+}
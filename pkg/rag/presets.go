@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// searchParams are the retrieval settings of one search: the rag-wide
+// settings, overridden by the rag.presets entry the search names, if any.
+type searchParams struct {
+	topK          int
+	minSimilarity float64
+	// group caps results at maxChunksPerDoc per note.
+	group           bool
+	maxChunksPerDoc int
+}
+
+// searchParams returns the settings for a search with the named preset, or
+// the rag-wide settings when preset is "".
+func (s *Service) searchParams(preset string) (searchParams, error) {
+	p := searchParams{
+		topK:            s.cfg.TopK,
+		minSimilarity:   s.cfg.MinSimilarity,
+		group:           s.cfg.GroupByDocument,
+		maxChunksPerDoc: s.cfg.MaxChunksPerDoc,
+	}
+	if len(s.ensemble) > 0 && s.cfg.Ensemble.TopK > 0 {
+		// The global top_k of rag.ensemble, across its collections.
+		p.topK = s.cfg.Ensemble.TopK
+	}
+	if preset == "" {
+		return p, nil
+	}
+	cfg, ok := s.cfg.Presets[preset]
+	if !ok {
+		return p, fmt.Errorf("%w: %q", ErrUnknownPreset, preset)
+	}
+	if cfg.TopK > 0 {
+		p.topK = cfg.TopK
+	}
+	if cfg.MinSimilarity > 0 {
+		p.minSimilarity = cfg.MinSimilarity
+	}
+	if cfg.MaxChunksPerDoc > 0 {
+		p.group = true
+		p.maxChunksPerDoc = cfg.MaxChunksPerDoc
+	}
+	return p, nil
+}
+
+// presetFilter adds the filters of the preset filter names to filter.
+// Unknown presets are left for searchParams to report.
+func (s *Service) presetFilter(filter SearchFilter) SearchFilter {
+	cfg, ok := s.cfg.Presets[filter.Preset]
+	if filter.Preset == "" || !ok {
+		return filter
+	}
+	return filter.merge(SearchFilter{
+		Tags:         cfg.Tags,
+		ExcludePaths: cfg.ExcludePaths,
+		ExcludeTags:  cfg.ExcludeTags,
+	})
+}
+
+// Presets returns the names of the configured rag.presets, sorted.
+func (s *Service) Presets() []string {
+	names := make([]string, 0, len(s.cfg.Presets))
+	for name := range s.cfg.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validatePresets(presets map[string]config.RagPresetConfig) error {
+	for name, p := range presets {
+		switch {
+		case name == "":
+			return fmt.Errorf("rag.presets: preset name is empty")
+		case p.TopK < 0:
+			return fmt.Errorf("rag.presets.%s: top_k must not be negative", name)
+		case p.MinSimilarity < 0 || p.MinSimilarity > 1:
+			return fmt.Errorf("rag.presets.%s: min_similarity must be between 0 and 1", name)
+		case p.MaxChunksPerDoc < 0:
+			return fmt.Errorf("rag.presets.%s: max_chunks_per_doc must not be negative", name)
+		}
+	}
+	return nil
+}
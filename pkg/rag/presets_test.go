@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestDecideTriggerPresetPrefix(t *testing.T) {
+	cfg := config.RagTriggerConfig{TagPrefix: "kb#", PresetPrefix: "kb@"}
+	d := DecideTrigger("kb@research：what changed in pricing?", cfg)
+	if !d.ShouldSearch || !d.Forced || d.Filter.Preset != "research" || d.CleanedMessage != "what changed in pricing?" {
+		t.Errorf("DecideTrigger() = %+v", d)
+	}
+	if d := DecideTrigger("kb@ research: question", cfg); d.Forced || d.Filter.Preset != "" {
+		t.Errorf("DecideTrigger() with a space = %+v", d)
+	}
+}
+
+func TestSearchParamsPreset(t *testing.T) {
+	s := &Service{cfg: config.RagConfig{
+		TopK:          6,
+		MinSimilarity: 0.25,
+		Presets: map[string]config.RagPresetConfig{
+			"research": {TopK: 10, MaxChunksPerDoc: 2},
+			"strict":   {MinSimilarity: 0.5},
+		},
+	}}
+	p, err := s.searchParams("research")
+	if err != nil || p.topK != 10 || p.minSimilarity != 0.25 || !p.group || p.maxChunksPerDoc != 2 {
+		t.Errorf("searchParams(research) = %+v, %v", p, err)
+	}
+	if p, _ := s.searchParams("strict"); p.topK != 6 || p.minSimilarity != 0.5 || p.group {
+		t.Errorf("searchParams(strict) = %+v", p)
+	}
+	if _, err := s.searchParams("missing"); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("searchParams(missing) error = %v", err)
+	}
+}
+
+func TestSearchPageAppliesPreset(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	s.cfg.Presets = map[string]config.RagPresetConfig{
+		"work": {TopK: 3, MinSimilarity: 0.5, Tags: []string{"work"}, ExcludeTags: []string{"meeting"}},
+	}
+	var body struct {
+		Limit          int                    `json:"limit"`
+		ScoreThreshold float64                `json:"score_threshold"`
+		Filter         map[string]interface{} `json:"filter"`
+	}
+	s.store = newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"result":[]}`))
+	})
+	embedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	t.Cleanup(embedServer.Close)
+	embedder, err := NewEmbeddingClient(config.RagEmbeddingConfig{APIBase: embedServer.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.embedder = embedder
+
+	if _, err := s.SearchPage(t.Context(), "status", SearchPageOptions{Filter: SearchFilter{Preset: "work"}}); err != nil {
+		t.Fatalf("SearchPage() error: %v", err)
+	}
+	filter, _ := json.Marshal(body.Filter)
+	want := `{"must":[{"key":"tags","match":{"value":"work"}}],"must_not":[{"key":"tags","match":{"any":["meeting"]}},{"key":"document","match":{"value":true}}]}`
+	if body.Limit != 3 || body.ScoreThreshold != 0.5 || string(filter) != want {
+		t.Errorf("search request limit %d, threshold %v, filter %s", body.Limit, body.ScoreThreshold, filter)
+	}
+
+	if _, err := s.SearchPage(t.Context(), "status", SearchPageOptions{Filter: SearchFilter{Preset: "nope"}}); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("SearchPage() with an unknown preset error = %v", err)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -16,7 +19,18 @@ import (
 type QdrantClient struct {
 	baseURL    string
 	collection string
+	timeout    time.Duration
 	httpClient *http.Client
+	breaker    *circuitBreaker
+	calls      apiCounter
+	// compression is set by rag.vector_db.compress_requests.
+	compression *requestCompression
+	// quantization is set by rag.vector_db.binary_quantization.
+	quantization binaryQuantization
+	// schemaMu is held exclusively while EnsureCollection may drop and
+	// recreate the collection, so point reads and writes never see it
+	// missing halfway through a full reindex.
+	schemaMu sync.RWMutex
 }
 
 type QdrantPoint struct {
@@ -25,21 +39,31 @@ type QdrantPoint struct {
 	Payload map[string]interface{} `json:"payload"`
 }
 
+// NewQdrantClient returns a client for cfg with the default rag.http
+// settings.
 func NewQdrantClient(cfg config.RagVectorDBConfig) (*QdrantClient, error) {
+	return newQdrantClient(cfg, defaultHTTPTuning)
+}
+
+func newQdrantClient(cfg config.RagVectorDBConfig, tuning config.RagHTTPConfig) (*QdrantClient, error) {
 	if cfg.URL == "" {
 		return nil, fmt.Errorf("vector_db url is required")
 	}
 	if cfg.Collection == "" {
 		return nil, fmt.Errorf("vector_db collection is required")
 	}
-	timeout := cfg.TimeoutSeconds
-	if timeout <= 0 {
-		timeout = 30
-	}
+	compression := newRequestCompression(cfg.CompressRequests)
 	return &QdrantClient{
 		baseURL:    strings.TrimRight(cfg.URL, "/"),
 		collection: cfg.Collection,
-		httpClient: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		timeout:    secondsOrDefault(cfg.TimeoutSeconds, 30),
+		httpClient: compressingClient(newHTTPClient(
+			secondsOrDefault(cfg.ConnectTimeoutSeconds, 5),
+			secondsOrDefault(cfg.TLSTimeoutSeconds, 10),
+			tuning,
+		), compression),
+		compression:  compression,
+		quantization: newBinaryQuantization(cfg),
 	}, nil
 }
 
@@ -47,29 +71,79 @@ func (c *QdrantClient) Collection() string {
 	return c.collection
 }
 
+// forCollection returns a client for another collection on the same server.
+func (c *QdrantClient) forCollection(name string) *QdrantClient {
+	return &QdrantClient{
+		baseURL:      c.baseURL,
+		collection:   name,
+		timeout:      c.timeout,
+		httpClient:   c.httpClient,
+		breaker:      c.breaker,
+		compression:  c.compression,
+		quantization: c.quantization,
+	}
+}
+
+// listCollections returns the names of all collections on the server.
+func (c *QdrantClient) listCollections(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Result struct {
+			Collections []struct {
+				Name string `json:"name"`
+			} `json:"collections"`
+		} `json:"result"`
+	}
+	if err := c.doRequest(ctx, "GET", "/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resp.Result.Collections))
+	for _, col := range resp.Result.Collections {
+		names = append(names, col.Name)
+	}
+	return names, nil
+}
+
+// pointsCount returns the number of points in the collection.
+func (c *QdrantClient) pointsCount(ctx context.Context) (int, error) {
+	var resp struct {
+		Result struct {
+			PointsCount int `json:"points_count"`
+		} `json:"result"`
+	}
+	if err := c.doRequest(ctx, "GET", fmt.Sprintf("/collections/%s", c.collection), nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Result.PointsCount, nil
+}
+
 func (c *QdrantClient) EnsureCollection(ctx context.Context, dimension int, recreate bool) error {
 	if dimension <= 0 {
 		return fmt.Errorf("invalid vector dimension: %d", dimension)
 	}
+	c.schemaMu.Lock()
+	defer c.schemaMu.Unlock()
 
 	if recreate {
 		_ = c.deleteCollection(ctx)
 		return c.createCollection(ctx, dimension)
 	}
 
-	exists, currentDim, err := c.getCollectionDimension(ctx)
+	info, err := c.getCollectionConfig(ctx)
 	if err != nil {
 		return err
 	}
-	if !exists {
+	if info == nil {
 		return c.createCollection(ctx, dimension)
 	}
-	if currentDim > 0 && currentDim != dimension {
+	if currentDim := info.Params.Vectors.Size; currentDim > 0 && currentDim != dimension {
 		if err := c.deleteCollection(ctx); err != nil {
 			return err
 		}
 		return c.createCollection(ctx, dimension)
 	}
+	if info.binaryQuantized() != c.quantization.enabled {
+		return c.updateQuantization(ctx)
+	}
 	return nil
 }
 
@@ -80,7 +154,7 @@ func (c *QdrantClient) Upsert(ctx context.Context, points []QdrantPoint) error {
 	reqBody := map[string]interface{}{
 		"points": points,
 	}
-	return c.doRequest(ctx, "PUT", fmt.Sprintf("/collections/%s/points?wait=true", c.collection), reqBody, nil)
+	return c.pointsRequest(ctx, "PUT", fmt.Sprintf("/collections/%s/points?wait=true", c.collection), reqBody, nil)
 }
 
 func (c *QdrantClient) DeleteByPath(ctx context.Context, path string) error {
@@ -99,46 +173,200 @@ func (c *QdrantClient) DeleteByPath(ctx context.Context, path string) error {
 			},
 		},
 	}
-	return c.doRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/delete?wait=true", c.collection), reqBody, nil)
+	return c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/delete?wait=true", c.collection), reqBody, nil)
+}
+
+// deleteByFilter deletes the points matching a Qdrant filter.
+func (c *QdrantClient) deleteByFilter(ctx context.Context, filter map[string]interface{}) error {
+	reqBody := map[string]interface{}{"filter": filter}
+	return c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/delete?wait=true", c.collection), reqBody, nil)
 }
 
-func (c *QdrantClient) Search(ctx context.Context, vector []float64, limit int, minSimilarity float64) ([]SearchResult, error) {
-	if len(vector) == 0 {
+func (c *QdrantClient) Search(ctx context.Context, query StoreQuery) ([]SearchResult, error) {
+	reqBody, err := c.searchRequestBody(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Result []qdrantScoredPoint `json:"result"`
+	}
+
+	if err := c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/search", c.collection), reqBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return scoredPointsToResults(resp.Result), nil
+}
+
+func (c *QdrantClient) SearchBatch(ctx context.Context, queries []StoreQuery) ([][]SearchResult, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	searches := make([]map[string]interface{}, 0, len(queries))
+	for _, query := range queries {
+		body, err := c.searchRequestBody(query)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, body)
+	}
+	reqBody := map[string]interface{}{
+		"searches": searches,
+	}
+
+	var resp struct {
+		Result [][]qdrantScoredPoint `json:"result"`
+	}
+
+	if err := c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/search/batch", c.collection), reqBody, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Result) != len(queries) {
+		return nil, fmt.Errorf("qdrant batch search returned %d result sets for %d queries", len(resp.Result), len(queries))
+	}
+
+	out := make([][]SearchResult, len(resp.Result))
+	for idx, points := range resp.Result {
+		out[idx] = scoredPointsToResults(points)
+	}
+	return out, nil
+}
+
+func (c *QdrantClient) searchRequestBody(query StoreQuery) (map[string]interface{}, error) {
+	if len(query.Vector) == 0 {
 		return nil, fmt.Errorf("empty query vector")
 	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+	body := map[string]interface{}{
+		"vector":          query.Vector,
+		"limit":           limit,
+		"with_payload":    true,
+		"score_threshold": query.MinSimilarity,
+	}
+	if query.Offset > 0 {
+		body["offset"] = query.Offset
+	}
+	body["filter"] = documentsFilter(query.Filter.qdrantFilter(), query.Documents)
+	if params := c.quantization.searchParams(); params != nil {
+		body["params"] = params
+	}
+	return body, nil
+}
+
+func (c *QdrantClient) Recommend(ctx context.Context, positiveIDs []string, limit int, minSimilarity float64) ([]SearchResult, error) {
+	if len(positiveIDs) == 0 {
+		return nil, fmt.Errorf("recommend requires at least one point id")
+	}
 	if limit <= 0 {
 		limit = 5
 	}
 	reqBody := map[string]interface{}{
-		"vector":         vector,
-		"limit":          limit,
-		"with_payload":   true,
+		"positive":        positiveIDs,
+		"limit":           limit,
+		"with_payload":    true,
 		"score_threshold": minSimilarity,
+		"filter":          documentsFilter(nil, false),
+	}
+	if params := c.quantization.searchParams(); params != nil {
+		reqBody["params"] = params
 	}
 
 	var resp struct {
-		Result []struct {
-			Score   float64                `json:"score"`
-			Payload map[string]interface{} `json:"payload"`
-		} `json:"result"`
+		Result []qdrantScoredPoint `json:"result"`
 	}
 
-	if err := c.doRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/search", c.collection), reqBody, &resp); err != nil {
+	if err := c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/recommend", c.collection), reqBody, &resp); err != nil {
 		return nil, err
 	}
 
-	results := make([]SearchResult, 0, len(resp.Result))
-	for _, item := range resp.Result {
+	return scoredPointsToResults(resp.Result), nil
+}
+
+// scroll returns up to limit points matching filter (nil for all) with their
+// vectors and payloads, starting at offset (nil for the first page), and the
+// offset of the next page, which is nil after the last one.
+func (c *QdrantClient) scroll(ctx context.Context, filter map[string]interface{}, offset interface{}, limit int) ([]QdrantPoint, interface{}, error) {
+	reqBody := map[string]interface{}{
+		"limit":        limit,
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if filter != nil {
+		reqBody["filter"] = filter
+	}
+	if offset != nil {
+		reqBody["offset"] = offset
+	}
+
+	var resp struct {
+		Result struct {
+			Points []struct {
+				ID      interface{}            `json:"id"`
+				Vector  []float64              `json:"vector"`
+				Payload map[string]interface{} `json:"payload"`
+			} `json:"points"`
+			NextPageOffset interface{} `json:"next_page_offset"`
+		} `json:"result"`
+	}
+
+	if err := c.pointsRequest(ctx, "POST", fmt.Sprintf("/collections/%s/points/scroll", c.collection), reqBody, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	points := make([]QdrantPoint, 0, len(resp.Result.Points))
+	for _, p := range resp.Result.Points {
+		points = append(points, QdrantPoint{ID: formatPointID(p.ID), Vector: p.Vector, Payload: p.Payload})
+	}
+	return points, resp.Result.NextPageOffset, nil
+}
+
+type qdrantScoredPoint struct {
+	ID      interface{}            `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+func scoredPointsToResults(points []qdrantScoredPoint) []SearchResult {
+	results := make([]SearchResult, 0, len(points))
+	for _, item := range points {
 		payload := item.Payload
+		if isMetadataPayload(payload) {
+			continue
+		}
 		res := SearchResult{
+			ID:    formatPointID(item.ID),
 			Score: item.Score,
 		}
 		if v, ok := payload["path"].(string); ok {
 			res.Path = v
 		}
+		if v, ok := payload["doc_id"].(string); ok {
+			res.DocID = v
+		}
 		if v, ok := payload["heading"].(string); ok {
 			res.Heading = v
 		}
+		if v, ok := payload["heading_path"].([]interface{}); ok {
+			for _, item := range v {
+				if title, ok := item.(string); ok {
+					res.HeadingPath = append(res.HeadingPath, title)
+				}
+			}
+		}
+		if v, ok := payload["heading_level"].(float64); ok {
+			res.HeadingLevel = int(v)
+		}
+		if v, ok := payload["anchor"].(string); ok {
+			res.Anchor = v
+		} else if len(res.HeadingPath) > 0 {
+			// Points indexed before anchors were stored; repeated headings
+			// may link to their first occurrence.
+			res.Anchor = headingSlug(res.HeadingPath[len(res.HeadingPath)-1])
+		}
 		if v, ok := payload["content"].(string); ok {
 			res.Content = v
 		}
@@ -148,41 +376,133 @@ func (c *QdrantClient) Search(ctx context.Context, vector []float64, limit int,
 		if v, ok := payload["end_line"].(float64); ok {
 			res.EndLine = int(v)
 		}
+		if v, ok := payload["audio_start"].(float64); ok {
+			res.AudioStart = int(v)
+		}
+		if v, ok := payload["audio_end"].(float64); ok {
+			res.AudioEnd = int(v)
+		}
+		if v, ok := payload["mtime"].(float64); ok && v > 0 {
+			res.ModTime = time.Unix(0, int64(v))
+		}
+		if v, ok := payload["tags"].([]interface{}); ok {
+			for _, item := range v {
+				if tag, ok := item.(string); ok {
+					res.Tags = append(res.Tags, tag)
+				}
+			}
+		}
+		if v, ok := payload["summary_level"].(float64); ok {
+			res.SummaryLevel = int(v)
+		}
+		if v, ok := payload["summary_of"].([]interface{}); ok {
+			for _, item := range v {
+				if path, ok := item.(string); ok {
+					res.SummaryOf = append(res.SummaryOf, path)
+				}
+			}
+		}
+		if v, ok := payload["file_hash"].(string); ok {
+			res.fileHash = v
+		}
 		results = append(results, res)
 	}
-	return results, nil
+	return results
 }
 
-func (c *QdrantClient) getCollectionDimension(ctx context.Context) (bool, int, error) {
+// formatPointID renders a Qdrant point ID, which is either a UUID string or an
+// unsigned integer.
+func formatPointID(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatUint(uint64(v), 10)
+	default:
+		return ""
+	}
+}
+
+func (c *QdrantClient) Ping(ctx context.Context) error {
+	return c.doRequest(ctx, "GET", "/collections", nil, nil)
+}
+
+// systemSize returns the total memory and disk of the machine Qdrant runs on,
+// in bytes, from its telemetry. Either is 0 when the server does not report
+// it.
+func (c *QdrantClient) systemSize(ctx context.Context) (ram, disk int64, err error) {
+	var resp struct {
+		Result struct {
+			App struct {
+				System struct {
+					// Qdrant reports both in KiB.
+					RAMSize  int64 `json:"ram_size"`
+					DiskSize int64 `json:"disk_size"`
+				} `json:"system"`
+			} `json:"app"`
+		} `json:"result"`
+	}
+	if err := c.doRequest(ctx, "GET", "/telemetry", nil, &resp); err != nil {
+		return 0, 0, err
+	}
+	return resp.Result.App.System.RAMSize << 10, resp.Result.App.System.DiskSize << 10, nil
+}
+
+// qdrantCollectionConfig is the part of a collection's configuration
+// EnsureCollection compares with the settings.
+type qdrantCollectionConfig struct {
+	Params struct {
+		Vectors struct {
+			Size int `json:"size"`
+		} `json:"vectors"`
+	} `json:"params"`
+	QuantizationConfig *struct {
+		Binary json.RawMessage `json:"binary"`
+	} `json:"quantization_config"`
+}
+
+func (cfg *qdrantCollectionConfig) binaryQuantized() bool {
+	return cfg.QuantizationConfig != nil && len(cfg.QuantizationConfig.Binary) > 0
+}
+
+// getCollectionConfig returns nil without an error when the collection does
+// not exist.
+func (c *QdrantClient) getCollectionConfig(ctx context.Context) (*qdrantCollectionConfig, error) {
 	var resp struct {
 		Result struct {
-			Config struct {
-				Params struct {
-					Vectors struct {
-						Size int `json:"size"`
-					} `json:"vectors"`
-				} `json:"params"`
-			} `json:"config"`
+			Config qdrantCollectionConfig `json:"config"`
 		} `json:"result"`
 	}
 
 	err := c.doRequest(ctx, "GET", fmt.Sprintf("/collections/%s", c.collection), nil, &resp)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
-			return false, 0, nil
+		if errors.Is(err, ErrCollectionMissing) {
+			return nil, nil
 		}
-		return false, 0, err
+		return nil, err
 	}
+	return &resp.Result.Config, nil
+}
 
-	return true, resp.Result.Config.Params.Vectors.Size, nil
+func (c *QdrantClient) getCollectionDimension(ctx context.Context) (bool, int, error) {
+	info, err := c.getCollectionConfig(ctx)
+	if err != nil || info == nil {
+		return false, 0, err
+	}
+	return true, info.Params.Vectors.Size, nil
 }
 
 func (c *QdrantClient) createCollection(ctx context.Context, dimension int) error {
+	vectors := map[string]interface{}{
+		"size":     dimension,
+		"distance": "Cosine",
+	}
 	reqBody := map[string]interface{}{
-		"vectors": map[string]interface{}{
-			"size":     dimension,
-			"distance": "Cosine",
-		},
+		"vectors": vectors,
+	}
+	if c.quantization.enabled {
+		vectors["on_disk"] = true
+		reqBody["quantization_config"] = binaryQuantizationConfig
 	}
 	return c.doRequest(ctx, "PUT", fmt.Sprintf("/collections/%s", c.collection), reqBody, nil)
 }
@@ -191,7 +511,18 @@ func (c *QdrantClient) deleteCollection(ctx context.Context) error {
 	return c.doRequest(ctx, "DELETE", fmt.Sprintf("/collections/%s", c.collection), nil, nil)
 }
 
+// pointsRequest is doRequest for calls on the collection's points, which
+// wait while EnsureCollection is changing the collection.
+func (c *QdrantClient) pointsRequest(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	c.schemaMu.RLock()
+	defer c.schemaMu.RUnlock()
+	return c.doRequest(ctx, method, path, body, out)
+}
+
 func (c *QdrantClient) doRequest(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
 	var reader io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
@@ -201,17 +532,23 @@ func (c *QdrantClient) doRequest(ctx context.Context, method, path string, body
 		reader = bytes.NewReader(data)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	req, err := http.NewRequestWithContext(reqCtx, method, c.baseURL+path, reader)
 	if err != nil {
 		return fmt.Errorf("failed to create qdrant request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	if err := c.breaker.allow(); err != nil {
+		return err
+	}
+	c.calls.add(0)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.breaker.recordError(ctx)
 		return fmt.Errorf("qdrant request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	c.breaker.record(resp.StatusCode >= 500)
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -219,7 +556,11 @@ func (c *QdrantClient) doRequest(ctx context.Context, method, path string, body
 	}
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("qdrant API error: %d %s", resp.StatusCode, string(data))
+		perr := newProviderError("qdrant", resp, data)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %w", ErrCollectionMissing, perr)
+		}
+		return perr
 	}
 
 	if out == nil {
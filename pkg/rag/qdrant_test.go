@@ -0,0 +1,115 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestQdrant(t *testing.T, handler http.HandlerFunc) *QdrantClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewQdrantClient(config.RagVectorDBConfig{URL: server.URL, Collection: "notes"})
+	if err != nil {
+		t.Fatalf("NewQdrantClient() error: %v", err)
+	}
+	return client
+}
+
+func TestQdrantSearchBatch(t *testing.T) {
+	client := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/collections/notes/points/search/batch" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req struct {
+			Searches []map[string]interface{} `json:"searches"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Searches) != 2 {
+			t.Errorf("expected 2 searches, got %d", len(req.Searches))
+		} else if _, ok := req.Searches[1]["filter"]; !ok {
+			t.Error("expected heading filter on second search")
+		}
+		w.Write([]byte(`{"result":[[{"score":0.9,"payload":{"path":"a.md","start_line":1,"end_line":3}}],[]]}`))
+	})
+
+	sets, err := client.SearchBatch(t.Context(), []StoreQuery{
+		{Vector: []float64{0.1}, Limit: 3, MinSimilarity: 0.2},
+		{Vector: []float64{0.2}, Limit: 3, MinSimilarity: 0.2, Filter: SearchFilter{UnderHeading: "API"}},
+	})
+	if err != nil {
+		t.Fatalf("SearchBatch() error: %v", err)
+	}
+	if len(sets) != 2 {
+		t.Fatalf("expected 2 result sets, got %d", len(sets))
+	}
+	if len(sets[0]) != 1 || sets[0][0].Path != "a.md" || sets[0][0].EndLine != 3 {
+		t.Errorf("unexpected first result set: %+v", sets[0])
+	}
+	if len(sets[1]) != 0 {
+		t.Errorf("expected empty second result set, got %+v", sets[1])
+	}
+}
+
+func TestQdrantRecommend(t *testing.T) {
+	client := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/collections/notes/points/recommend" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req struct {
+			Positive []string `json:"positive"`
+			Limit    int      `json:"limit"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Positive) != 1 || req.Positive[0] != "chunk-1" || req.Limit != 5 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		w.Write([]byte(`{"result":[{"score":0.8,"payload":{"path":"b.md","start_line":4,"end_line":9}}]}`))
+	})
+
+	results, err := client.Recommend(t.Context(), []string{"chunk-1"}, 0, 0.3)
+	if err != nil {
+		t.Fatalf("Recommend() error: %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "b.md" || results[0].StartLine != 4 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if _, err := client.Recommend(t.Context(), nil, 5, 0); err == nil {
+		t.Error("Recommend() without IDs succeeded")
+	}
+}
+
+// recommendStore answers Recommend for the chunk IDs it holds.
+type recommendStore struct {
+	VectorStore
+	similar map[string][]SearchResult
+}
+
+func (s recommendStore) Collection() string { return "notes" }
+func (s recommendStore) Recommend(_ context.Context, ids []string, _ int, _ float64) ([]SearchResult, error) {
+	return s.similar[ids[0]], nil
+}
+
+func TestMoreLikeThis(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	store := recommendStore{similar: map[string][]SearchResult{
+		"chunk-1": {{ID: "chunk-2", Path: "b.md", Score: 0.8}},
+	}}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := s.MoreLikeThis(t.Context(), " chunk-1 ")
+	if err != nil || len(results) != 1 || results[0].Path != "b.md" {
+		t.Errorf("MoreLikeThis() = %+v, %v", results, err)
+	}
+	if results, err := s.MoreLikeThis(t.Context(), ""); results != nil || err != nil {
+		t.Errorf("MoreLikeThis(\"\") = %+v, %v, want nothing", results, err)
+	}
+}
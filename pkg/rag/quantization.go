@@ -0,0 +1,77 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// binaryQuantization holds rag.vector_db.binary_quantization. Qdrant then
+// keeps the sign bits of every vector in memory and the float32 vectors on
+// disk, and searches compare the bits by hamming distance before the best
+// candidates are optionally rescored with the full vectors.
+type binaryQuantization struct {
+	enabled      bool
+	rescore      bool
+	oversampling float64
+}
+
+// binaryQuantizationConfig is the quantization_config of a binary
+// quantized collection.
+var binaryQuantizationConfig = map[string]interface{}{
+	"binary": map[string]interface{}{
+		"always_ram": true,
+	},
+}
+
+func newBinaryQuantization(cfg config.RagVectorDBConfig) binaryQuantization {
+	q := binaryQuantization{
+		enabled:      cfg.BinaryQuantization,
+		rescore:      cfg.Rescore,
+		oversampling: cfg.Oversampling,
+	}
+	if q.oversampling < 1 {
+		q.oversampling = 1
+	}
+	return q
+}
+
+// searchParams returns the params of a search or recommend request, or nil
+// without quantization.
+func (q binaryQuantization) searchParams() map[string]interface{} {
+	if !q.enabled {
+		return nil
+	}
+	quantization := map[string]interface{}{
+		"rescore": q.rescore,
+	}
+	if q.rescore {
+		quantization["oversampling"] = q.oversampling
+	}
+	return map[string]interface{}{
+		"quantization": quantization,
+	}
+}
+
+// updateQuantization turns binary quantization of an existing collection
+// on or off to match the settings. Qdrant rebuilds the quantized vectors in
+// the background; searches keep working meanwhile.
+func (c *QdrantClient) updateQuantization(ctx context.Context) error {
+	var quantization interface{} = "Disabled"
+	if c.quantization.enabled {
+		quantization = binaryQuantizationConfig
+	}
+	reqBody := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"": map[string]interface{}{
+				"on_disk": c.quantization.enabled,
+			},
+		},
+		"quantization_config": quantization,
+	}
+	if err := c.doRequest(ctx, "PATCH", fmt.Sprintf("/collections/%s", c.collection), reqBody, nil); err != nil {
+		return fmt.Errorf("update quantization of collection %s: %w", c.collection, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestQdrantBinaryQuantization(t *testing.T) {
+	quantized := false
+	var requests []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		switch {
+		case r.Method == "GET":
+			quantization := "null"
+			if quantized {
+				quantization = `{"binary":{"always_ram":true}}`
+			}
+			w.Write([]byte(`{"result":{"config":{"params":{"vectors":{"size":4}},"quantization_config":` + quantization + `}}}`))
+		case r.Method == "PATCH":
+			quantized = body["quantization_config"] != "Disabled"
+			w.Write([]byte(`{"result":true}`))
+		default:
+			w.Write([]byte(`{"result":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig().RAG.VectorDB
+	cfg.URL = server.URL
+	cfg.Collection = "notes"
+	cfg.BinaryQuantization = true
+	client, err := NewQdrantClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An existing collection is converted in place, once.
+	for n := 0; n < 2; n++ {
+		if err := client.EnsureCollection(t.Context(), 4, false); err != nil {
+			t.Fatalf("EnsureCollection() error: %v", err)
+		}
+	}
+	if len(requests) != 3 || requests[1] != "PATCH /collections/notes" {
+		t.Fatalf("requests = %q", requests)
+	}
+	vectors := bodies[1]["vectors"].(map[string]interface{})[""].(map[string]interface{})
+	if !quantized || vectors["on_disk"] != true {
+		t.Errorf("update body = %v", bodies[1])
+	}
+
+	// Searches ask for rescoring of oversampled candidates.
+	requests, bodies = nil, nil
+	if _, err := client.Search(t.Context(), StoreQuery{Vector: []float64{1, 0, 0, 0}, Limit: 3}); err != nil {
+		t.Fatal(err)
+	}
+	params, _ := json.Marshal(bodies[0]["params"])
+	if string(params) != `{"quantization":{"oversampling":2,"rescore":true}}` {
+		t.Errorf("search params = %s", params)
+	}
+
+	// New collections are created quantized, and turning the setting off
+	// converts them back.
+	requests, bodies = nil, nil
+	if err := client.EnsureCollection(t.Context(), 4, true); err != nil {
+		t.Fatal(err)
+	}
+	if bodies[1]["quantization_config"] == nil {
+		t.Errorf("create body = %v", bodies[1])
+	}
+	cfg.BinaryQuantization = false
+	plain, _ := NewQdrantClient(cfg)
+	if err := plain.EnsureCollection(t.Context(), 4, false); err != nil {
+		t.Fatal(err)
+	}
+	if quantized {
+		t.Error("quantization still on after binary_quantization was turned off")
+	}
+	requests, bodies = nil, nil
+	plain.Search(t.Context(), StoreQuery{Vector: []float64{1, 0, 0, 0}})
+	if _, ok := bodies[0]["params"]; ok {
+		t.Errorf("search without quantization sent params %v", bodies[0]["params"])
+	}
+}
@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// queryLogFile records the searches of rag.query_log, one JSON object per
+// line, for picoclaw rag coverage.
+const queryLogFile = "query_log.jsonl"
+
+// queryLogMaxBytes is the size at which the log is moved to
+// query_log.jsonl.1, replacing the previous one.
+const queryLogMaxBytes = 4 << 20
+
+type queryLogEntry struct {
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+	// Hits are the results returned, NearMisses the candidates the store
+	// ranked in the same top k that scored below min_similarity.
+	Hits       []queryLogHit `json:"hits,omitempty"`
+	NearMisses []queryLogHit `json:"near_misses,omitempty"`
+}
+
+type queryLogHit struct {
+	Path string `json:"path"`
+	// ID is the note's document ID, so the hit still counts for the note
+	// after it is renamed or moved.
+	ID    string  `json:"id,omitempty"`
+	Score float64 `json:"score"`
+}
+
+// searchNearMisses runs a chunk search like searchChunks. With rag.query_log
+// on it asks the store for the same top k without min_similarity and splits
+// off the candidates below it, which is the same result set at no extra
+// cost.
+func (s *Service) searchNearMisses(ctx context.Context, b *backend, query StoreQuery) (results, nearMisses []SearchResult, err error) {
+	if !s.cfg.QueryLog {
+		results, err = s.searchChunks(ctx, b, query)
+		return results, nil, err
+	}
+	threshold := query.MinSimilarity
+	query.MinSimilarity = 0
+	all, err := s.searchChunks(ctx, b, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range all {
+		if r.Score >= threshold {
+			results = append(results, r)
+		} else {
+			nearMisses = append(nearMisses, r)
+		}
+	}
+	return results, nearMisses, nil
+}
+
+// logQuery appends a search to the query log when rag.query_log is on.
+// Failures are logged and otherwise ignored.
+func (s *Service) logQuery(query string, results, nearMisses []SearchResult) {
+	if !s.cfg.QueryLog {
+		return
+	}
+	entry := queryLogEntry{Time: s.now(), Query: query}
+	for _, r := range results {
+		if !r.Pinned {
+			entry.Hits = append(entry.Hits, queryLogHit{Path: r.Path, ID: r.DocID, Score: r.Score})
+		}
+	}
+	for _, r := range nearMisses {
+		entry.NearMisses = append(entry.NearMisses, queryLogHit{Path: r.Path, ID: r.DocID, Score: r.Score})
+	}
+	s.queryLogMu.Lock()
+	err := appendLogEntry(s.storage, queryLogFile, queryLogMaxBytes, entry)
+	s.queryLogMu.Unlock()
+	if err != nil {
+		s.log.Warn("Failed to write the query log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// readQueryLog returns the logged searches since the given time, oldest
+// first, including those in the rotated file. Lines that do not parse are
+// skipped.
+func readQueryLog(st Storage, since time.Time) ([]queryLogEntry, error) {
+	var entries []queryLogEntry
+	err := readLogSince(st, queryLogFile, since, func(line []byte) {
+		var e queryLogEntry
+		if json.Unmarshal(line, &e) == nil {
+			entries = append(entries, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,248 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// confluencePageLimit is the page size of content searches.
+const confluencePageLimit = 50
+
+// confluenceSource reads the pages of a Confluence space through the REST
+// API. Each page becomes a note at its place in the page tree, e.g.
+// "Handbook/Onboarding.md", and its version number stands in for an ETag so
+// only edited pages are downloaded again.
+type confluenceSource struct {
+	base       string
+	space      string
+	cql        string
+	username   string
+	token      string
+	httpClient *http.Client
+
+	// ids maps note paths from the last listing to page ids.
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newConfluenceSource(cfg config.RagRemoteVaultConfig) (*confluenceSource, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", cfg.URL)
+	}
+	if cfg.Space == "" {
+		return nil, fmt.Errorf("space is required")
+	}
+	return &confluenceSource{
+		base:       strings.TrimRight(cfg.URL, "/"),
+		space:      cfg.Space,
+		cql:        strings.TrimSpace(cfg.CQL),
+		username:   cfg.Username,
+		token:      cfg.Token,
+		httpClient: newHTTPClient(5*time.Second, 10*time.Second, defaultHTTPTuning),
+	}, nil
+}
+
+// query returns the CQL selecting the pages to index.
+func (c *confluenceSource) query() string {
+	q := fmt.Sprintf(`space = "%s" and type = page`, strings.ReplaceAll(c.space, `"`, `\"`))
+	if c.cql != "" {
+		q += " and (" + c.cql + ")"
+	}
+	return q
+}
+
+func (c *confluenceSource) list(ctx context.Context) ([]remoteObject, error) {
+	params := url.Values{
+		"cql":    {c.query()},
+		"expand": {"version,ancestors"},
+		"limit":  {strconv.Itoa(confluencePageLimit)},
+	}
+	next := "/rest/api/content/search?" + params.Encode()
+	var objects []remoteObject
+	ids := make(map[string]string)
+	for next != "" {
+		body, err := c.get(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Results []struct {
+				ID      string `json:"id"`
+				Title   string `json:"title"`
+				Version struct {
+					Number int `json:"number"`
+				} `json:"version"`
+				Ancestors []struct {
+					Title string `json:"title"`
+				} `json:"ancestors"`
+			} `json:"results"`
+			Links struct {
+				Next string `json:"next"`
+			} `json:"_links"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse confluence search: %w", err)
+		}
+		for _, r := range page.Results {
+			var parts []string
+			for _, a := range r.Ancestors {
+				parts = append(parts, confluencePathPart(a.Title, ""))
+			}
+			parts = append(parts, confluencePathPart(r.Title, r.ID))
+			rel := path.Join(parts...) + ".md"
+			if _, taken := ids[rel]; taken {
+				// Sibling pages may share a title once sanitized.
+				rel = strings.TrimSuffix(rel, ".md") + " (" + r.ID + ").md"
+			}
+			ids[rel] = r.ID
+			objects = append(objects, remoteObject{Path: rel, ETag: strconv.Itoa(r.Version.Number)})
+		}
+		next = page.Links.Next
+	}
+	c.mu.Lock()
+	c.ids = ids
+	c.mu.Unlock()
+	return objects, nil
+}
+
+// confluencePathPart turns a page title into a path segment.
+func confluencePathPart(title, id string) string {
+	part := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, title)
+	part = strings.Trim(part, " .")
+	if part == "" {
+		part = id
+	}
+	if part == "" {
+		part = "untitled"
+	}
+	return part
+}
+
+func (c *confluenceSource) fetch(ctx context.Context, rel string) ([]byte, error) {
+	c.mu.Lock()
+	id, ok := c.ids[rel]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("confluence page for %s is not listed", rel)
+	}
+	body, err := c.get(ctx, "/rest/api/content/"+url.PathEscape(id)+"?expand=body.storage")
+	if err != nil {
+		return nil, err
+	}
+	var page struct {
+		Title string `json:"title"`
+		Body  struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse confluence page: %w", err)
+	}
+	text, err := htmlToMarkdown([]byte(confluenceStorageToHTML(page.Body.Storage.Value)), page.Title)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(text), nil
+}
+
+// get requests ref, an API path relative to the site URL, which is also how
+// the API returns its _links.next.
+func (c *confluenceSource) get(ctx context.Context, ref string) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, remoteRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", c.base+ref, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create confluence request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.token)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("confluence request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read confluence response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderError("confluence", resp, body)
+	}
+	return body, nil
+}
+
+var (
+	confluenceCodeMacro = regexp.MustCompile(`(?s)<ac:structured-macro[^>]*ac:name="(?:code|noformat)"[^>]*>(.*?)</ac:structured-macro>`)
+	confluenceLanguage  = regexp.MustCompile(`(?s)<ac:parameter[^>]*ac:name="language"[^>]*>(.*?)</ac:parameter>`)
+	confluenceCodeBody  = regexp.MustCompile(`(?s)<ac:plain-text-body>\s*<!\[CDATA\[(.*?)\]\]>\s*</ac:plain-text-body>`)
+	confluenceCDATA     = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+	confluencePageLink  = regexp.MustCompile(`(?s)<ac:link[^>]*>\s*<ri:page[^>]*ri:content-title="([^"]*)"[^>]*/>\s*(?:<ac:(?:plain-text-)?link-body>(.*?)</ac:(?:plain-text-)?link-body>\s*)?</ac:link>`)
+	confluenceDropped   = regexp.MustCompile(`(?s)<ac:(?:parameter|task-id|task-status|placeholder)\b[^>]*>.*?</ac:(?:parameter|task-id|task-status|placeholder)>`)
+	confluenceBlockTags = regexp.MustCompile(`<(/?)ac:(?:structured-macro|rich-text-body|layout|layout-section|layout-cell|task-body)\b`)
+	htmlTag             = regexp.MustCompile(`<[^>]*>`)
+	confluenceTaskTags  = strings.NewReplacer("<ac:task-list", "<ul", "</ac:task-list", "</ul", "<ac:task>", "<li>", "</ac:task>", "</li>")
+)
+
+// confluenceStorageToHTML rewrites the Confluence storage format into plain
+// HTML for htmlToMarkdown: code macros become <pre> blocks, links to other
+// pages become [[Title]] wikilinks like in an Obsidian vault, macro
+// parameters are dropped and macro bodies become divs.
+func confluenceStorageToHTML(storage string) string {
+	s := confluenceCodeMacro.ReplaceAllStringFunc(storage, func(m string) string {
+		inner := confluenceCodeMacro.FindStringSubmatch(m)[1]
+		class := ""
+		if lang := confluenceLanguage.FindStringSubmatch(inner); lang != nil {
+			class = ` class="language-` + html.EscapeString(strings.TrimSpace(lang[1])) + `"`
+		}
+		code := ""
+		if body := confluenceCodeBody.FindStringSubmatch(inner); body != nil {
+			code = body[1]
+		}
+		return "<pre><code" + class + ">" + html.EscapeString(code) + "</code></pre>"
+	})
+	s = confluencePageLink.ReplaceAllStringFunc(s, func(m string) string {
+		sub := confluencePageLink.FindStringSubmatch(m)
+		title := html.UnescapeString(sub[1])
+		label := strings.TrimSpace(confluenceCDATA.ReplaceAllString(sub[2], "$1"))
+		label = html.UnescapeString(htmlTag.ReplaceAllString(label, ""))
+		link := "[[" + title + "]]"
+		if label != "" && label != title {
+			link = "[[" + title + "|" + label + "]]"
+		}
+		return html.EscapeString(link)
+	})
+	s = confluenceCDATA.ReplaceAllStringFunc(s, func(m string) string {
+		return html.EscapeString(confluenceCDATA.FindStringSubmatch(m)[1])
+	})
+	s = confluenceDropped.ReplaceAllString(s, "")
+	s = confluenceTaskTags.Replace(s)
+	return confluenceBlockTags.ReplaceAllString(s, "<${1}div")
+}
@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestConfluenceSourceListsAndConvertsPages(t *testing.T) {
+	storage := `<p>See <ac:link><ri:page ri:content-title="Setup &amp; Tools" /><ac:plain-text-link-body><![CDATA[setup]]></ac:plain-text-link-body></ac:link>.</p>` +
+		`<ac:structured-macro ac:name="code" ac:schema-version="1"><ac:parameter ac:name="language">bash</ac:parameter>` +
+		`<ac:plain-text-body><![CDATA[make <all>]]></ac:plain-text-body></ac:structured-macro>` +
+		`<ac:structured-macro ac:name="info"><ac:parameter ac:name="title">Note</ac:parameter><ac:rich-text-body><p>Ask in #ops.</p></ac:rich-text-body></ac:structured-macro>` +
+		`<ac:task-list><ac:task><ac:task-id>1</ac:task-id><ac:task-status>incomplete</ac:task-status><ac:task-body>Get a laptop</ac:task-body></ac:task></ac:task-list>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/wiki/rest/api/content/search":
+			if r.URL.Query().Get("cursor") == "" {
+				if got := r.URL.Query().Get("cql"); got != `space = "ENG" and type = page and (label = "kb")` {
+					t.Errorf("cql = %q", got)
+				}
+				fmt.Fprint(w, `{"results":[{"id":"1","title":"Handbook","version":{"number":3},"ancestors":[]}],`+
+					`"_links":{"next":"/rest/api/content/search?cursor=abc"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"results":[{"id":"2","title":"On/boarding","version":{"number":7},"ancestors":[{"title":"Handbook"}]}],"_links":{}}`)
+		case "/wiki/rest/api/content/2":
+			json.NewEncoder(w).Encode(map[string]any{
+				"title": "On/boarding",
+				"body":  map[string]any{"storage": map[string]any{"value": storage}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	source, err := newConfluenceSource(config.RagRemoteVaultConfig{
+		URL: srv.URL + "/wiki/", Space: "ENG", CQL: `label = "kb"`, Token: "secret",
+	})
+	if err != nil {
+		t.Fatalf("newConfluenceSource() error: %v", err)
+	}
+	objects, err := source.list(t.Context())
+	if err != nil {
+		t.Fatalf("list() error: %v", err)
+	}
+	if got := fmt.Sprint(objects); got != "[{Handbook.md 3} {Handbook/On-boarding.md 7}]" {
+		t.Errorf("list() = %s", got)
+	}
+	data, err := source.fetch(t.Context(), "Handbook/On-boarding.md")
+	if err != nil {
+		t.Fatalf("fetch() error: %v", err)
+	}
+	want := "# On/boarding\n\nSee [[Setup & Tools|setup]].\n\n```bash\nmake <all>\n```\n\nAsk in #ops.\n\n- Get a laptop\n"
+	if string(data) != want {
+		t.Errorf("fetch() =\n%s\nwant\n%s", data, want)
+	}
+	if _, err := source.fetch(t.Context(), "missing.md"); err == nil {
+		t.Error("fetch() of an unlisted page succeeded")
+	}
+}
@@ -0,0 +1,264 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Remote vault types; see config.RagRemoteVaultConfig.
+const (
+	RemoteVaultS3         = "s3"
+	RemoteVaultWebDAV     = "webdav"
+	RemoteVaultConfluence = "confluence"
+)
+
+// remoteRequestTimeout bounds a single listing or download request.
+const remoteRequestTimeout = 60 * time.Second
+
+// remoteSource lists and downloads the files of a remote vault.
+type remoteSource interface {
+	list(ctx context.Context) ([]remoteObject, error)
+	fetch(ctx context.Context, rel string) ([]byte, error)
+}
+
+// remoteObject is a file in a remote vault, with its slash-separated path
+// inside the vault and the ETag that changes whenever its content does.
+type remoteObject struct {
+	Path string
+	ETag string
+}
+
+// remoteVault mirrors a remote vault into dir, a vault root on disk. The
+// ETag of every downloaded file is kept in manifestPath; a file is only
+// downloaded again when its ETag changes, and only then does its mtime,
+// which the indexer compares, change.
+type remoteVault struct {
+	name         string
+	dir          string
+	manifestPath string
+	source       remoteSource
+}
+
+// RemoteSyncSummary reports one remote vault sync.
+type RemoteSyncSummary struct {
+	Name       string
+	Downloaded int
+	Unchanged  int
+	Removed    int
+}
+
+// newRemoteVaults sets up the mirrors of rag.remote_vaults under dataDir
+// and returns them with the vault_path entries that point at them.
+func newRemoteVaults(cfgs []config.RagRemoteVaultConfig, dataDir string) ([]*remoteVault, []string, error) {
+	var vaults []*remoteVault
+	var roots []string
+	for _, cfg := range cfgs {
+		name := strings.TrimSpace(cfg.Name)
+		if name == "" || strings.ContainsAny(name, `/\=`) {
+			return nil, nil, fmt.Errorf("rag.remote_vaults: invalid name %q", cfg.Name)
+		}
+		var (
+			source remoteSource
+			err    error
+		)
+		switch cfg.Type {
+		case RemoteVaultS3:
+			source, err = newS3Source(cfg)
+		case RemoteVaultWebDAV:
+			source, err = newWebDAVSource(cfg)
+		case RemoteVaultConfluence:
+			source, err = newConfluenceSource(cfg)
+		default:
+			err = fmt.Errorf("unknown type %q", cfg.Type)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("rag.remote_vaults[%s]: %w", name, err)
+		}
+		dir := filepath.Join(dataDir, "remote", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+		vaults = append(vaults, &remoteVault{
+			name:         name,
+			dir:          dir,
+			manifestPath: filepath.Join(dataDir, "remote", name+".etags.json"),
+			source:       source,
+		})
+		roots = append(roots, name+"="+dir)
+	}
+	return vaults, roots, nil
+}
+
+// sync downloads new and changed notes that pass the include and exclude
+// patterns and deletes local copies of notes removed remotely.
+func (r *remoteVault) sync(ctx context.Context, includePatterns, excludePatterns []string) (*RemoteSyncSummary, error) {
+	objects, err := r.source.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest := map[string]string{}
+	if data, err := os.ReadFile(r.manifestPath); err == nil {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			manifest = map[string]string{}
+		}
+	}
+
+	includeRegex := compilePatterns(includePatterns)
+	excludeRegex := compilePatterns(excludePatterns)
+	summary := &RemoteSyncSummary{Name: r.name}
+	current := make(map[string]bool, len(objects))
+	var syncErr error
+	for _, obj := range objects {
+		if path.Ext(obj.Path) != ".md" || !filepath.IsLocal(filepath.FromSlash(obj.Path)) {
+			continue
+		}
+		if matchesAny(obj.Path, excludeRegex) || (len(includeRegex) > 0 && !matchesAny(obj.Path, includeRegex)) {
+			continue
+		}
+		current[obj.Path] = true
+		local := filepath.Join(r.dir, filepath.FromSlash(obj.Path))
+		if etag, ok := manifest[obj.Path]; ok && etag == obj.ETag && obj.ETag != "" {
+			if _, err := os.Stat(local); err == nil {
+				summary.Unchanged++
+				continue
+			}
+		}
+		data, err := r.source.fetch(ctx, obj.Path)
+		if err == nil {
+			err = writeFileAtomic(local, data)
+		}
+		if err != nil {
+			// Keep the previous copy; the next sync tries again.
+			syncErr = errors.Join(syncErr, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		manifest[obj.Path] = obj.ETag
+		summary.Downloaded++
+	}
+	for rel := range manifest {
+		if current[rel] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			syncErr = errors.Join(syncErr, err)
+			continue
+		}
+		delete(manifest, rel)
+		summary.Removed++
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return summary, err
+	}
+	if err := writeFileAtomic(r.manifestPath, data); err != nil {
+		return summary, err
+	}
+	return summary, syncErr
+}
+
+// writeFileAtomic replaces path with data so that after a crash it holds
+// either the old or the new content: data goes to a temporary file that is
+// synced to disk and then renamed over path. A concurrent reader never sees
+// a partial file either.
+func writeFileAtomic(path string, data []byte) error {
+	// Keep the permissions of the file being replaced, e.g. of the query
+	// log.
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeFileAtomicPerm(path, data, perm)
+}
+
+// writeFileAtomicPerm is writeFileAtomic with path ending up with perm.
+func writeFileAtomicPerm(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	// A temporary file left by an earlier crash keeps its mode.
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory entry change such as a rename to disk. Not
+// every platform can open a directory for this, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// SyncRemoteVaults brings the local copies of rag.remote_vaults up to date.
+// Index runs call it first; a vault that cannot be reached keeps its last
+// copy.
+func (s *Service) SyncRemoteVaults(ctx context.Context) ([]RemoteSyncSummary, error) {
+	var summaries []RemoteSyncSummary
+	var errs error
+	for _, r := range s.remotes {
+		summary, err := r.sync(ctx, s.cfg.IncludePatterns, s.cfg.ExcludePatterns)
+		if summary != nil {
+			summaries = append(summaries, *summary)
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("remote vault %s: %w", r.name, err))
+		}
+	}
+	return summaries, errs
+}
+
+// syncRemoteVaults runs SyncRemoteVaults for an index run, logging instead
+// of failing so local notes are still indexed when a remote is down.
+func (s *Service) syncRemoteVaults(ctx context.Context) {
+	if len(s.remotes) == 0 {
+		return
+	}
+	summaries, err := s.SyncRemoteVaults(ctx)
+	for _, summary := range summaries {
+		s.log.Info("Synced remote vault", map[string]interface{}{
+			"name":       summary.Name,
+			"downloaded": summary.Downloaded,
+			"unchanged":  summary.Unchanged,
+			"removed":    summary.Removed,
+		})
+	}
+	if err != nil {
+		s.log.Warn("Remote vault sync failed, indexing the last copy", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
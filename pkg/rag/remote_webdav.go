@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/><d:resourcetype/></d:prop></d:propfind>`
+
+// webdavSource reads notes from a WebDAV folder such as a Nextcloud
+// directory. Folders are walked one level at a time because many servers,
+// Nextcloud included, refuse "Depth: infinity".
+type webdavSource struct {
+	base       *url.URL
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+func newWebDAVSource(cfg config.RagRemoteVaultConfig) (*webdavSource, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", cfg.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	return &webdavSource{
+		base:       base,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: newHTTPClient(5*time.Second, 10*time.Second, defaultHTTPTuning),
+	}, nil
+}
+
+func (w *webdavSource) list(ctx context.Context) ([]remoteObject, error) {
+	var objects []remoteObject
+	pending := []string{""}
+	seen := map[string]bool{"": true}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		entries, err := w.propfind(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch {
+			case e.Path == dir || seen[e.Path]:
+			case e.dir:
+				seen[e.Path] = true
+				pending = append(pending, e.Path)
+			default:
+				objects = append(objects, e.remoteObject)
+			}
+		}
+	}
+	return objects, nil
+}
+
+type webdavEntry struct {
+	remoteObject
+	dir bool
+}
+
+// propfind lists one folder, given relative to the base URL with a trailing
+// slash. Paths in the result are relative to the base URL; folders keep
+// their trailing slash.
+func (w *webdavSource) propfind(ctx context.Context, dir string) ([]webdavEntry, error) {
+	body, err := w.do(ctx, "PROPFIND", dir, strings.NewReader(propfindBody), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"DAV: href"`
+			Propstat []struct {
+				Prop struct {
+					ETag         string `xml:"DAV: getetag"`
+					ResourceType struct {
+						Collection *struct{} `xml:"DAV: collection"`
+					} `xml:"DAV: resourcetype"`
+				} `xml:"DAV: prop"`
+				Status string `xml:"DAV: status"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, fmt.Errorf("failed to parse webdav listing: %w", err)
+	}
+	var entries []webdavEntry
+	for _, r := range ms.Responses {
+		href, err := url.Parse(strings.TrimSpace(r.Href))
+		if err != nil {
+			continue
+		}
+		rel, ok := strings.CutPrefix(w.base.ResolveReference(href).Path, w.base.Path)
+		if !ok {
+			continue
+		}
+		entry := webdavEntry{remoteObject: remoteObject{Path: rel}}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.ETag = strings.Trim(ps.Prop.ETag, `"`)
+			entry.dir = ps.Prop.ResourceType.Collection != nil
+		}
+		if entry.dir && !strings.HasSuffix(entry.Path, "/") && entry.Path != "" {
+			entry.Path += "/"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (w *webdavSource) fetch(ctx context.Context, rel string) ([]byte, error) {
+	return w.do(ctx, "GET", rel, nil, http.StatusOK)
+}
+
+func (w *webdavSource) do(ctx context.Context, method, rel string, body io.Reader, want int) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, remoteRequestTimeout)
+	defer cancel()
+
+	u := w.base.ResolveReference(&url.URL{Path: rel})
+	req, err := http.NewRequestWithContext(reqCtx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webdav request: %w", err)
+	}
+	if method == "PROPFIND" {
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webdav request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webdav response: %w", err)
+	}
+	if resp.StatusCode != want {
+		return nil, newProviderError("webdav", resp, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,220 @@
+package rag
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// apiCounter counts requests a client makes, and for batch endpoints the
+// number of inputs sent.
+type apiCounter struct {
+	requests atomic.Int64
+	inputs   atomic.Int64
+}
+
+func (c *apiCounter) add(inputs int) {
+	c.requests.Add(1)
+	c.inputs.Add(int64(inputs))
+}
+
+// APICallCounts is the number of backend calls made during an index run.
+type APICallCounts struct {
+	EmbeddingRequests int64 `json:"embedding_requests"`
+	EmbeddingInputs   int64 `json:"embedding_inputs"`
+	VectorDBRequests  int64 `json:"vector_db_requests"`
+}
+
+// IndexReport is written to last_index_report.json in the RAG data directory
+// after every index run, successful or not.
+type IndexReport struct {
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	DurationMs int64             `json:"duration_ms"`
+	Full       bool              `json:"full"`
+	Stopped    bool              `json:"stopped,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Summary    IndexReportCounts `json:"summary"`
+	Files      []IndexReportFile `json:"files"`
+	APICalls   APICallCounts     `json:"api_calls"`
+	Config     config.RagConfig  `json:"config"`
+}
+
+type IndexReportCounts struct {
+	TotalFiles        int    `json:"total_files"`
+	IndexedFiles      int    `json:"indexed_files"`
+	UpdatedFiles      int    `json:"updated_files"`
+	RemovedFiles      int    `json:"removed_files"`
+	SkippedFiles      int    `json:"skipped_files"`
+	FailedFiles       int    `json:"failed_files"`
+	Chunks            int    `json:"chunks"`
+	FullReindexReason string `json:"full_reindex_reason,omitempty"`
+}
+
+type IndexReportFile struct {
+	Path       string `json:"path"`
+	Action     string `json:"action"`
+	Chunks     int    `json:"chunks,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// indexReportFile is the name of the last index report in the storage.
+const indexReportFile = "last_index_report.json"
+
+// IndexReportPath returns where the last index report is stored, given the
+// RAG data directory (see config.Config.RagDataDir).
+func IndexReportPath(dataDir string) string {
+	return filepath.Join(dataDir, indexReportFile)
+}
+
+// LoadIndexReport reads the report of the most recent index run.
+func LoadIndexReport(dataDir string) (*IndexReport, error) {
+	return loadIndexReport(NewLocalStorage(dataDir))
+}
+
+func loadIndexReport(st Storage) (*IndexReport, error) {
+	data, err := st.ReadFile(indexReportFile)
+	if err != nil {
+		return nil, err
+	}
+	var report IndexReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func newIndexReport(cfg config.RagConfig, opts IndexOptions, started time.Time, summary *IndexSummary, runErr error) *IndexReport {
+	finished := time.Now()
+	report := &IndexReport{
+		StartedAt:  started,
+		FinishedAt: finished,
+		DurationMs: finished.Sub(started).Milliseconds(),
+		Full:       opts.ReindexAll,
+		Files:      []IndexReportFile{},
+		Config:     redactRagConfig(cfg),
+	}
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+	if summary == nil {
+		return report
+	}
+	report.Stopped = summary.Stopped
+	report.Summary = reportCounts(summary)
+	for _, f := range summary.Files {
+		report.Files = append(report.Files, reportFile(f))
+	}
+	return report
+}
+
+func reportCounts(summary *IndexSummary) IndexReportCounts {
+	return IndexReportCounts{
+		TotalFiles:        summary.TotalFiles,
+		IndexedFiles:      summary.IndexedFiles,
+		UpdatedFiles:      summary.UpdatedFiles,
+		RemovedFiles:      summary.RemovedFiles,
+		SkippedFiles:      summary.SkippedFiles,
+		FailedFiles:       summary.FailedFiles,
+		Chunks:            summary.Chunks,
+		FullReindexReason: summary.FullReindexReason,
+	}
+}
+
+func reportFile(f IndexFileResult) IndexReportFile {
+	return IndexReportFile{
+		Path:       f.Path,
+		Action:     f.Action,
+		Chunks:     f.Chunks,
+		DurationMs: f.Duration.Milliseconds(),
+		Error:      f.Error,
+	}
+}
+
+func saveIndexReport(st Storage, report *IndexReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.WriteFile(indexReportFile, data)
+}
+
+// redactRagConfig blanks API keys and tokens so the report can be shared.
+func redactRagConfig(cfg config.RagConfig) config.RagConfig {
+	if cfg.Embedding.APIKey != "" {
+		cfg.Embedding.APIKey = "[redacted]"
+	}
+	if cfg.Transcription.APIKey != "" {
+		cfg.Transcription.APIKey = "[redacted]"
+	}
+	if cfg.AutoIndex.AdminToken != "" {
+		cfg.AutoIndex.AdminToken = "[redacted]"
+	}
+	if cfg.Guardrails.AdminToken != "" {
+		cfg.Guardrails.AdminToken = "[redacted]"
+	}
+	if cfg.Notifications.WebhookURL != "" {
+		cfg.Notifications.WebhookURL = "[redacted]"
+	}
+	routes := make([]config.RagLanguageRouteConfig, len(cfg.LanguageRoutes))
+	for idx, route := range cfg.LanguageRoutes {
+		if route.Embedding.APIKey != "" {
+			route.Embedding.APIKey = "[redacted]"
+		}
+		routes[idx] = route
+	}
+	cfg.LanguageRoutes = routes
+	collections := make([]config.RagEnsembleCollectionConfig, len(cfg.Ensemble.Collections))
+	for idx, c := range cfg.Ensemble.Collections {
+		if c.Embedding.APIKey != "" {
+			c.Embedding.APIKey = "[redacted]"
+		}
+		collections[idx] = c
+	}
+	cfg.Ensemble.Collections = collections
+	remotes := make([]config.RagRemoteVaultConfig, len(cfg.RemoteVaults))
+	for idx, remote := range cfg.RemoteVaults {
+		if remote.AccessKey != "" {
+			remote.AccessKey = "[redacted]"
+		}
+		if remote.SecretKey != "" {
+			remote.SecretKey = "[redacted]"
+		}
+		if remote.Password != "" {
+			remote.Password = "[redacted]"
+		}
+		if remote.Token != "" {
+			remote.Token = "[redacted]"
+		}
+		remotes[idx] = remote
+	}
+	cfg.RemoteVaults = remotes
+	return cfg
+}
+
+// apiCallCounts sums the calls made by every backend so far.
+func (s *Service) apiCallCounts() APICallCounts {
+	var counts APICallCounts
+	for _, b := range s.backends() {
+		if e, ok := b.embedder.(*EmbeddingClient); ok {
+			counts.EmbeddingRequests += e.calls.requests.Load()
+			counts.EmbeddingInputs += e.calls.inputs.Load()
+		}
+		if q, ok := b.store.(*QdrantClient); ok {
+			counts.VectorDBRequests += q.calls.requests.Load()
+		}
+	}
+	return counts
+}
+
+func (c APICallCounts) since(before APICallCounts) APICallCounts {
+	return APICallCounts{
+		EmbeddingRequests: c.EmbeddingRequests - before.EmbeddingRequests,
+		EmbeddingInputs:   c.EmbeddingInputs - before.EmbeddingInputs,
+		VectorDBRequests:  c.VectorDBRequests - before.VectorDBRequests,
+	}
+}
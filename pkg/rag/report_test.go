@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestIndexReportRoundTrip(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := config.RagConfig{
+		Embedding: config.RagEmbeddingConfig{APIKey: "secret", Model: "m"},
+		LanguageRoutes: []config.RagLanguageRouteConfig{
+			{Language: "zh", Embedding: config.RagEmbeddingConfig{APIKey: "zh-secret"}},
+		},
+	}
+	summary := &IndexSummary{
+		TotalFiles:   2,
+		IndexedFiles: 1,
+		FailedFiles:  1,
+		Files: []IndexFileResult{
+			{Path: "a.md", Action: IndexActionIndexed, Chunks: 3, Duration: 1500 * time.Millisecond},
+			{Path: "b.md", Action: IndexActionFailed, Error: "permission denied"},
+		},
+	}
+	report := newIndexReport(cfg, IndexOptions{ReindexAll: true}, time.Now(), summary, nil)
+	if err := saveIndexReport(NewLocalStorage(workspace), report); err != nil {
+		t.Fatalf("saveIndexReport() error: %v", err)
+	}
+
+	loaded, err := LoadIndexReport(workspace)
+	if err != nil {
+		t.Fatalf("LoadIndexReport() error: %v", err)
+	}
+	if !loaded.Full || loaded.Summary.IndexedFiles != 1 || loaded.Summary.FailedFiles != 1 {
+		t.Errorf("unexpected summary: %+v", loaded.Summary)
+	}
+	if len(loaded.Files) != 2 || loaded.Files[0].DurationMs != 1500 || loaded.Files[1].Error == "" {
+		t.Errorf("unexpected files: %+v", loaded.Files)
+	}
+	if loaded.Config.Embedding.APIKey == "secret" || loaded.Config.LanguageRoutes[0].Embedding.APIKey == "zh-secret" {
+		t.Error("API keys must be redacted in the report")
+	}
+	if cfg.LanguageRoutes[0].Embedding.APIKey != "zh-secret" {
+		t.Error("redaction must not modify the live config")
+	}
+}
+
+func TestIndexReportRedactsSecrets(t *testing.T) {
+	cfg := config.RagConfig{
+		Transcription: config.RagTranscriptionConfig{APIKey: "whisper-secret"},
+		Guardrails:    config.RagGuardrailsConfig{AdminToken: "guardrails-secret"},
+		Ensemble: config.RagEnsembleConfig{Collections: []config.RagEnsembleCollectionConfig{
+			{Name: "memory", Embedding: config.RagEmbeddingConfig{APIKey: "ensemble-secret"}},
+		}},
+		RemoteVaults: []config.RagRemoteVaultConfig{
+			{Name: "s3", Type: "s3", AccessKey: "AKIA-secret", SecretKey: "s3-secret"},
+			{Name: "dav", Type: "webdav", Username: "me", Password: "dav-secret"},
+			{Name: "wiki", Type: "confluence", Token: "confluence-secret"},
+		},
+	}
+	report := newIndexReport(cfg, IndexOptions{}, time.Now(), nil, nil)
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"AKIA-secret", "s3-secret", "dav-secret", "confluence-secret", "whisper-secret", "ensemble-secret", "guardrails-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("report contains %q", secret)
+		}
+	}
+	if cfg.RemoteVaults[0].SecretKey != "s3-secret" {
+		t.Error("redaction must not modify the live config")
+	}
+}
+
+func TestIndexReportRecordsError(t *testing.T) {
+	report := newIndexReport(config.RagConfig{}, IndexOptions{}, time.Now(), nil, errors.New("vault not found"))
+	if report.Error != "vault not found" || report.Files == nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
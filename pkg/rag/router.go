@@ -0,0 +1,254 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Routes of rag.router.
+const (
+	RouteVault  = "vault"
+	RouteWeb    = "web"
+	RouteDirect = "direct"
+)
+
+// How rag.router reached a decision, recorded in RouteRecord.Method.
+const (
+	RouteMethodPrefix    = "prefix"
+	RouteMethodHeuristic = "heuristic"
+	RouteMethodLLM       = "llm"
+)
+
+const (
+	// routeLogFile records the decisions of rag.router, one JSON object per
+	// line, for picoclaw rag routes.
+	routeLogFile = "routes.jsonl"
+	// routeLogMaxBytes is the size at which the log is moved to
+	// routes.jsonl.1, replacing the previous one.
+	routeLogMaxBytes = 4 << 20
+	// routeTopics caps the auto_keywords named in the LLM prompt.
+	routeTopics = 20
+)
+
+// RouteOptions are what the caller of Route can offer.
+type RouteOptions struct {
+	// Classify asks the LLM in mode "llm".
+	Classify Summarizer
+	// Web is set when the web_search tool is available; without it nothing
+	// is routed to the web.
+	Web bool
+}
+
+// RouteRecord is one logged decision of rag.router. Message is only recorded
+// with rag.router.log_messages.
+type RouteRecord struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message,omitempty"`
+	Route   string    `json:"route"`
+	Method  string    `json:"method"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+func normalizeRouter(cfg config.RagRouterConfig) (config.RagRouterConfig, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = RouteMethodHeuristic
+	case RouteMethodHeuristic, RouteMethodLLM:
+	default:
+		return cfg, fmt.Errorf("rag.router.mode: unknown mode %q", cfg.Mode)
+	}
+	switch cfg.Default {
+	case "":
+		cfg.Default = RouteDirect
+	case RouteVault, RouteWeb, RouteDirect:
+	default:
+		return cfg, fmt.Errorf("rag.router.default: unknown route %q", cfg.Default)
+	}
+	return cfg, nil
+}
+
+// Route is TriggerDecision with rag.router: a message without a force or
+// skip prefix goes to the vault, the web or the model alone as the router
+// decides, instead of by the keywords of rag.trigger.auto. The decision is
+// set in Route and logged. With the router off it is TriggerDecision.
+func (s *Service) Route(ctx context.Context, message string, opts RouteOptions) TriggerDecision {
+	d := s.TriggerDecision(message)
+	if !s.cfg.Router.Enabled {
+		return d
+	}
+	switch {
+	case d.Forced:
+		d.Route, d.RouteMethod, d.RouteReason = RouteVault, RouteMethodPrefix, "force prefix"
+	case d.Skipped:
+		d.Route, d.RouteMethod, d.RouteReason = RouteDirect, RouteMethodPrefix, "skip prefix"
+	case strings.TrimSpace(d.CleanedMessage) == "":
+		return d
+	default:
+		d.Route, d.RouteMethod, d.RouteReason = s.routeMessage(ctx, d.CleanedMessage, opts)
+		d.ShouldSearch = d.Route == RouteVault
+		d.MatchedKeyword, d.NoHit = "", ""
+		if d.ShouldSearch {
+			d.NoHit = s.noHitOutcome()
+		}
+	}
+	record := RouteRecord{
+		Time:   s.now(),
+		Route:  d.Route,
+		Method: d.RouteMethod,
+		Reason: d.RouteReason,
+	}
+	if s.cfg.Router.LogMessages {
+		record.Message = d.CleanedMessage
+	}
+	s.logRoute(record)
+	return d
+}
+
+// routeMessage decides the route of message in the configured mode. A failed
+// or unclear LLM reply falls back to the heuristic.
+func (s *Service) routeMessage(ctx context.Context, message string, opts RouteOptions) (route, method, reason string) {
+	if s.cfg.Router.Mode == RouteMethodLLM && opts.Classify != nil {
+		classify := s.auditSummarizer("rag:router", opts.Classify)
+		reply, err := classify(ctx, s.routePrompt(message, opts.Web))
+		if err == nil {
+			if route, ok := parseRoute(reply, opts.Web); ok {
+				return route, RouteMethodLLM, ""
+			}
+			err = fmt.Errorf("unclear reply %q", truncateSnippet(strings.TrimSpace(reply), 80))
+		}
+		s.log.Warn("Routing with the LLM failed, using the heuristic", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	route, reason = s.heuristicRoute(message, opts.Web)
+	return route, RouteMethodHeuristic, reason
+}
+
+// heuristicRoute routes message by its cues: a vault cue or an auto keyword
+// sends it to the vault, then a web cue to the web and a direct cue to the
+// model alone. Without any, it takes rag.router.default. Auto keywords are
+// matched like cues, at word boundaries, unlike in rag.trigger.auto.
+func (s *Service) heuristicRoute(message string, web bool) (string, string) {
+	lower := strings.ToLower(message)
+	if cue := matchCue(lower, s.cfg.Router.VaultCues); cue != "" {
+		return RouteVault, fmt.Sprintf("vault cue %q", cue)
+	}
+	if kw := matchCue(lower, s.cfg.Trigger.AutoKeywords); kw != "" {
+		return RouteVault, fmt.Sprintf("keyword %q", kw)
+	}
+	if cue := matchCue(lower, s.cfg.Router.WebCues); cue != "" && web {
+		return RouteWeb, fmt.Sprintf("web cue %q", cue)
+	}
+	if cue := matchCue(lower, s.cfg.Router.DirectCues); cue != "" {
+		return RouteDirect, fmt.Sprintf("direct cue %q", cue)
+	}
+	if s.cfg.Router.Default == RouteWeb && !web {
+		return RouteDirect, "default, no web search"
+	}
+	return s.cfg.Router.Default, "default"
+}
+
+// matchCue returns the first of cues found in lower, a lowercased message.
+// Cues that start or end with a letter or digit must do so at a word
+// boundary, so "hi" does not match "this"; others, such as Chinese cues,
+// match anywhere.
+func matchCue(lower string, cues []string) string {
+	for _, cue := range cues {
+		c := strings.ToLower(strings.TrimSpace(cue))
+		if c == "" {
+			continue
+		}
+		for from := 0; from < len(lower); {
+			idx := strings.Index(lower[from:], c)
+			if idx < 0 {
+				break
+			}
+			start, end := from+idx, from+idx+len(c)
+			if !(start > 0 && isWordByte(c[0]) && isWordByte(lower[start-1])) &&
+				!(end < len(lower) && isWordByte(c[len(c)-1]) && isWordByte(lower[end])) {
+				return cue
+			}
+			from = start + 1
+		}
+	}
+	return ""
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+func (s *Service) routePrompt(message string, web bool) string {
+	var sb strings.Builder
+	sb.WriteString("Decide how to answer the user's message below. Reply with one word:\n" +
+		"vault - it asks about the user's own notes, records or documents, or a topic they keep notes on\n")
+	if web {
+		sb.WriteString("web - it needs current or public information from a web search\n")
+	}
+	sb.WriteString("direct - you can answer it alone: general knowledge, conversation, or a writing task\n")
+	if topics := s.cfg.Trigger.AutoKeywords; len(topics) > 0 {
+		if len(topics) > routeTopics {
+			topics = topics[:routeTopics]
+		}
+		sb.WriteString("\nThe notes cover topics such as: " + strings.Join(topics, ", ") + "\n")
+	}
+	sb.WriteString("\nMessage: " + message + "\n")
+	return sb.String()
+}
+
+// parseRoute takes the first route named in reply.
+func parseRoute(reply string, web bool) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(reply), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+	for _, w := range words {
+		switch w {
+		case RouteVault, RouteDirect:
+			return w, true
+		case RouteWeb:
+			if web {
+				return w, true
+			}
+		}
+	}
+	return "", false
+}
+
+// logRoute appends a decision to the route log. Failures are logged and
+// otherwise ignored.
+func (s *Service) logRoute(r RouteRecord) {
+	s.log.Info("Message routed", map[string]interface{}{
+		"route":  r.Route,
+		"method": r.Method,
+		"reason": r.Reason,
+	})
+	s.routeLogMu.Lock()
+	err := appendLogEntry(s.storage, routeLogFile, routeLogMaxBytes, r)
+	s.routeLogMu.Unlock()
+	if err != nil {
+		s.log.Warn("Failed to write the route log", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// Routes returns the logged decisions of rag.router since the given time,
+// oldest first. Lines that do not parse are skipped.
+func (s *Service) Routes(since time.Time) ([]RouteRecord, error) {
+	var records []RouteRecord
+	err := readLogSince(s.storage, routeLogFile, since, func(line []byte) {
+		var r RouteRecord
+		if json.Unmarshal(line, &r) == nil {
+			records = append(records, r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,139 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newRouterTestService(t *testing.T, mode string) *Service {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.Router.Enabled = true
+	cfg.RAG.Router.Mode = mode
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(oneResultStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+	return s
+}
+
+func TestHeuristicRoute(t *testing.T) {
+	s := newRouterTestService(t, RouteMethodHeuristic)
+	tests := []struct {
+		message string
+		web     bool
+		want    string
+	}{
+		{"what did I write in my notes about Qdrant?", true, RouteVault},
+		{"treatment of sepsis", true, RouteVault},
+		{"latest news on the election", true, RouteWeb},
+		{"latest news on the election", false, RouteDirect},
+		{"今天天气怎么样", true, RouteWeb},
+		{"please translate this sentence", true, RouteDirect},
+		// "today" only as a word; the default route otherwise.
+		{"explain todays idioms", true, RouteDirect},
+		{"why is the sky blue", true, RouteDirect},
+	}
+	for _, tt := range tests {
+		if got, reason := s.heuristicRoute(tt.message, tt.web); got != tt.want {
+			t.Errorf("heuristicRoute(%q, web=%v) = %s (%s), want %s", tt.message, tt.web, got, reason, tt.want)
+		}
+	}
+}
+
+func TestMatchCue(t *testing.T) {
+	if cue := matchCue("this is fine", []string{"hi"}); cue != "" {
+		t.Errorf("matched %q inside a word", cue)
+	}
+	if cue := matchCue("oh hi there", []string{"hi"}); cue != "hi" {
+		t.Errorf("matchCue() = %q, want hi", cue)
+	}
+	if cue := matchCue("see https://example.com", []string{"https://"}); cue != "https://" {
+		t.Errorf("matchCue() = %q, want https://", cue)
+	}
+	if cue := matchCue("帮我翻译一下", []string{"翻译"}); cue != "翻译" {
+		t.Errorf("matchCue() = %q, want 翻译", cue)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	s := newRouterTestService(t, RouteMethodLLM)
+	ctx := context.Background()
+	now := time.Now()
+
+	// The LLM decides; the web is only offered when available.
+	var prompt string
+	d := s.Route(ctx, "what is new in Go 1.24?", RouteOptions{Web: true, Classify: func(_ context.Context, p string) (string, error) {
+		prompt = p
+		return "Web.", nil
+	}})
+	if d.Route != RouteWeb || d.RouteMethod != RouteMethodLLM || d.ShouldSearch {
+		t.Errorf("LLM decision = %+v, want a web route without search", d)
+	}
+	if prompt == "" {
+		t.Fatal("classifier not called")
+	}
+	d = s.Route(ctx, "what is new in Go 1.24?", RouteOptions{Classify: func(context.Context, string) (string, error) {
+		return "web", nil
+	}})
+	if d.Route != RouteDirect || d.RouteMethod != RouteMethodHeuristic {
+		t.Errorf("web reply without web search = %+v, want the heuristic's direct route", d)
+	}
+
+	// A failing LLM falls back to the heuristic, which searches the vault.
+	d = s.Route(ctx, "dose of amoxicillin", RouteOptions{Classify: func(context.Context, string) (string, error) {
+		return "", errors.New("timeout")
+	}})
+	if d.Route != RouteVault || d.RouteMethod != RouteMethodHeuristic || !d.ShouldSearch || d.NoHit == "" {
+		t.Errorf("fallback decision = %+v, want a vault search", d)
+	}
+
+	// Prefixes decide before the router.
+	d = s.Route(ctx, "不查：hello", RouteOptions{Classify: func(context.Context, string) (string, error) {
+		t.Error("classifier called for a skip prefix")
+		return "", nil
+	}})
+	if d.Route != RouteDirect || d.RouteMethod != RouteMethodPrefix || d.ShouldSearch {
+		t.Errorf("skip prefix decision = %+v", d)
+	}
+
+	records, err := s.Routes(now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("logged %d decisions, want 4", len(records))
+	}
+	if r := records[2]; r.Message != "" || r.Route != RouteVault || r.Reason != `keyword "dose"` {
+		t.Errorf("logged %+v, want the decision without the message", r)
+	}
+	if records, _ := s.Routes(now.Add(time.Hour)); len(records) != 0 {
+		t.Errorf("Routes() ignored since: %d records", len(records))
+	}
+
+	// Messages are only logged on request.
+	s.cfg.Router.LogMessages = true
+	s.Route(ctx, "dose of amoxicillin", RouteOptions{})
+	records, _ = s.Routes(now.Add(-time.Minute))
+	if r := records[len(records)-1]; r.Message != "dose of amoxicillin" {
+		t.Errorf("logged %+v with log_messages on", r)
+	}
+}
+
+func TestRouteDisabled(t *testing.T) {
+	s := newRouterTestService(t, "")
+	s.cfg.Router.Enabled = false
+	d := s.Route(context.Background(), "treatment of sepsis", RouteOptions{})
+	if d.Route != "" || !d.ShouldSearch || d.MatchedKeyword != "treatment" {
+		t.Errorf("Route() without the router = %+v, want the keyword trigger", d)
+	}
+	if records, _ := s.Routes(time.Time{}); len(records) != 0 {
+		t.Errorf("logged %d decisions with the router off", len(records))
+	}
+}
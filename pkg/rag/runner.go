@@ -0,0 +1,152 @@
+package rag
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Index run triggers recorded in IndexRunStatus.Trigger.
+const (
+	IndexTriggerStartup  = "startup"
+	IndexTriggerSchedule = "schedule"
+	IndexTriggerSignal   = "signal"
+	IndexTriggerAdmin    = "admin"
+	IndexTriggerChat     = "chat"
+)
+
+// IndexRunStatus describes the current or most recent background index run.
+type IndexRunStatus struct {
+	Running    bool               `json:"running"`
+	Trigger    string             `json:"trigger,omitempty"`
+	Full       bool               `json:"full,omitempty"`
+	StartedAt  time.Time          `json:"started_at,omitempty"`
+	FinishedAt time.Time          `json:"finished_at,omitempty"`
+	Stopped    bool               `json:"stopped,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Summary    *IndexReportCounts `json:"summary,omitempty"`
+	Failures   []IndexReportFile  `json:"failures,omitempty"`
+}
+
+// IndexRunner serializes the index runs started by the daemon, so that the
+// schedule, signals and admin requests never index concurrently.
+type IndexRunner struct {
+	ctx     context.Context
+	service *Service
+	// onFinish, if set, is called after every run with its outcome.
+	onFinish func(trigger string, summary *IndexSummary, err error)
+
+	mu     sync.Mutex
+	status IndexRunStatus
+	done   chan struct{}
+	// stop is closed by Shutdown; no runs start afterwards.
+	stop chan struct{}
+}
+
+// NewIndexRunner returns a runner whose runs are cancelled with ctx. onFinish
+// may be nil.
+func NewIndexRunner(ctx context.Context, service *Service, onFinish func(trigger string, summary *IndexSummary, err error)) *IndexRunner {
+	return &IndexRunner{ctx: ctx, service: service, onFinish: onFinish, stop: make(chan struct{})}
+}
+
+// Trigger starts an incremental index run in the background and reports
+// whether it did. It does nothing if a run is already in progress or the
+// runner has been shut down.
+func (r *IndexRunner) Trigger(trigger string) bool {
+	return r.start(trigger, false)
+}
+
+// TriggerFull is Trigger for a full reindex, which re-embeds every note.
+// Callers reachable from chat or HTTP must check Service.Authorize with
+// OpFullReindex first.
+func (r *IndexRunner) TriggerFull(trigger string) bool {
+	return r.start(trigger, true)
+}
+
+// Service returns the service the runner indexes.
+func (r *IndexRunner) Service() *Service {
+	return r.service
+}
+
+func (r *IndexRunner) start(trigger string, full bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.Running || stopRequested(r.stop) {
+		return false
+	}
+	r.status = IndexRunStatus{
+		Running:   true,
+		Trigger:   trigger,
+		Full:      full,
+		StartedAt: time.Now(),
+	}
+	r.done = make(chan struct{})
+	go r.run(trigger, full, r.done)
+	return true
+}
+
+// Status returns a snapshot of the current or last run.
+func (r *IndexRunner) Status() IndexRunStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	status.Failures = append([]IndexReportFile(nil), r.status.Failures...)
+	return status
+}
+
+// Wait blocks until the run in progress, if any, has finished.
+func (r *IndexRunner) Wait() {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Shutdown stops the runner from starting new runs and asks the run in
+// progress to stop after its current file, then waits for it. It returns
+// ctx.Err() if ctx ends first; cancelling the runner's own context then
+// aborts the run outright.
+func (r *IndexRunner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !stopRequested(r.stop) {
+		close(r.stop)
+	}
+	done := r.done
+	r.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *IndexRunner) run(trigger string, full bool, done chan struct{}) {
+	defer close(done)
+	summary, err := r.service.Index(r.ctx, IndexOptions{ContinueOnError: true, ReindexAll: full, Stop: r.stop})
+
+	r.mu.Lock()
+	r.status.Running = false
+	r.status.FinishedAt = time.Now()
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	if summary != nil {
+		r.status.Stopped = summary.Stopped
+		counts := reportCounts(summary)
+		r.status.Summary = &counts
+		for _, f := range summary.Failures {
+			r.status.Failures = append(r.status.Failures, reportFile(f))
+		}
+	}
+	r.mu.Unlock()
+
+	if r.onFinish != nil {
+		r.onFinish(trigger, summary, err)
+	}
+}
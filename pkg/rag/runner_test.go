@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newRunnerTestService(t *testing.T, dir, vault string) *Service {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{vault}
+	cfg.RAG.DataDir = dir
+	cfg.RAG.Embedding.APIBase = "http://127.0.0.1:1"
+	cfg.RAG.Embedding.Model = "m"
+	s, err := NewService(cfg, dir)
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+	return s
+}
+
+func TestIndexRunnerRecordsFailedRun(t *testing.T) {
+	dir := t.TempDir()
+	s := newRunnerTestService(t, dir, filepath.Join(dir, "missing"))
+	finished := make(chan string, 1)
+	runner := NewIndexRunner(context.Background(), s, func(trigger string, summary *IndexSummary, err error) {
+		if err == nil {
+			t.Error("expected an error for a missing vault")
+		}
+		finished <- trigger
+	})
+
+	if !runner.Trigger(IndexTriggerAdmin) {
+		t.Fatal("Trigger() = false on an idle runner")
+	}
+	runner.Wait()
+	if got := <-finished; got != IndexTriggerAdmin {
+		t.Errorf("onFinish trigger = %q, want %q", got, IndexTriggerAdmin)
+	}
+
+	status := runner.Status()
+	if status.Running || status.Trigger != IndexTriggerAdmin || status.Error == "" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.FinishedAt.Before(status.StartedAt) {
+		t.Errorf("finished %v before start %v", status.FinishedAt, status.StartedAt)
+	}
+	if _, err := LoadIndexReport(dir); err != nil {
+		t.Errorf("failed run should still write a report: %v", err)
+	}
+}
+
+func TestIndexRunnerShutdown(t *testing.T) {
+	dir := t.TempDir()
+	runner := NewIndexRunner(context.Background(), newRunnerTestService(t, dir, dir), nil)
+	if err := runner.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	if runner.Trigger(IndexTriggerAdmin) {
+		t.Error("Trigger() started a run after Shutdown")
+	}
+}
+
+func TestIndexStopSavesState(t *testing.T) {
+	dir := t.TempDir()
+	vault := filepath.Join(dir, "vault")
+	if err := os.MkdirAll(vault, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vault, "a.md"), []byte("# A\n\nbody"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newRunnerTestService(t, dir, vault)
+	stop := make(chan struct{})
+	close(stop)
+
+	summary, err := s.Index(context.Background(), IndexOptions{Stop: stop})
+	if err != nil {
+		t.Fatalf("Index() error: %v", err)
+	}
+	if !summary.Stopped || summary.IndexedFiles != 0 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if _, err := s.newBackendIndexer(s.backends()[0]).loadState(); err != nil {
+		t.Errorf("stopped run should save its state: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// SearchMany runs several queries at once. Queries that share a language
+// backend are embedded together, in as few requests as the batch size
+// allows; each is then searched and ranked like Search. The returned slice
+// is aligned with queries; blank queries yield nil results.
+func (s *Service) SearchMany(ctx context.Context, queries []string) ([][]SearchResult, error) {
+	ctx, cancel := s.searchContext(ctx)
+	defer cancel()
+	s.refreshState(ctx)
+	out := make([][]SearchResult, len(queries))
+	type group struct {
+		backend   *backend
+		pending   []*retrieval
+		positions []int
+	}
+	var groups []*group
+	byLanguage := make(map[string]*group)
+	hooked := make([]string, len(queries))
+	for idx, q := range queries {
+		q, filter := s.beforeSearch(ctx, q, SearchFilter{})
+		hooked[idx] = q
+		r, err := s.prepareRetrieval(ctx, q, filter)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			continue
+		}
+		g, ok := byLanguage[r.backend.language]
+		if !ok {
+			g = &group{backend: r.backend}
+			byLanguage[r.backend.language] = g
+			groups = append(groups, g)
+		}
+		g.pending = append(g.pending, r)
+		g.positions = append(g.positions, idx)
+	}
+
+	for _, g := range groups {
+		texts := make([]string, len(g.pending))
+		for idx, r := range g.pending {
+			texts[idx] = r.query
+		}
+		vectors, err := embedQueries(ctx, g.backend.embedder, texts)
+		if err != nil {
+			return nil, err
+		}
+		for idx, r := range g.pending {
+			results, err := s.searchVector(ctx, r, vectors[idx], nil)
+			if err != nil {
+				return nil, err
+			}
+			pos := g.positions[idx]
+			out[pos] = s.afterSearch(ctx, hooked[pos], results)
+		}
+	}
+	return out, nil
+}
+
+// embedQueries embeds texts in as few requests as the batch size allows.
+func embedQueries(ctx context.Context, embedder Embedder, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	batchSize := embedder.BatchSize()
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		embeddings, err := embedder.EmbedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddings) != end-start {
+			return nil, fmt.Errorf("embedding result size mismatch")
+		}
+		for _, emb := range embeddings {
+			if len(emb) == 0 {
+				return nil, fmt.Errorf("embedding returned empty vector")
+			}
+			vectors = append(vectors, emb)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSearchManyRanksLikeSearch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.TopK = 5
+	cfg.RAG.QueryLog = true
+	cfg.RAG.Ensemble.TopK = 3
+	cfg.RAG.Ensemble.Collections = []config.RagEnsembleCollectionConfig{{Name: "memory", Weight: 0.5}}
+	vault := &resultStore{results: []SearchResult{
+		{ID: "v1", Path: "a.md", Score: 0.8},
+		{ID: "v2", Path: "b.md", Score: 0.6},
+	}}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+	s.ensemble[0].store = &resultStore{results: []SearchResult{{ID: "m1", Path: "2024-05-01.md", Score: 0.9}}}
+
+	ctx := context.Background()
+	want, err := s.Search(ctx, "what did we decide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := s.SearchMany(ctx, []string{"what did we decide", "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 || sets[1] != nil {
+		t.Fatalf("SearchMany() = %+v, want one result set and nil for the blank query", sets)
+	}
+	if !reflect.DeepEqual(sets[0], want) {
+		t.Errorf("SearchMany() = %+v, want the results of Search %+v", sets[0], want)
+	}
+	entries, err := readQueryLog(s.storage, time.Time{})
+	if err != nil || len(entries) != 2 {
+		t.Errorf("query log has %d entries (%v), want Search and SearchMany logged", len(entries), err)
+	}
+}
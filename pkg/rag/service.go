@@ -2,37 +2,237 @@ package rag
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/config"
 )
 
+// Service is safe for concurrent use. Index runs, including the stale and
+// lazy reindexing done by searches, are serialized; searches run in
+// parallel with them and with each other. While a full reindex recreates a
+// collection, searches on it wait for the new, empty collection rather than
+// failing, and then see it fill up as files are indexed.
 type Service struct {
-	cfg       config.RagConfig
-	workspace string
-	embedder  *EmbeddingClient
-	qdrant    *QdrantClient
+	cfg config.RagConfig
+	// dataDir holds the mirrors of remote vaults, and the other
+	// bookkeeping unless SetStorage replaced storage.
+	dataDir  string
+	storage  Storage
+	embedder Embedder
+	store    VectorStore
+	// log receives the service's messages; see WithLogger.
+	log Logger
+	// now is the clock set by WithClock.
+	now func() time.Time
+	// httpClient is set by WithHTTPClient, and nil to use the clients
+	// built from the rag config.
+	httpClient *http.Client
+	// routes are per-language backends; see config.RagLanguageRouteConfig.
+	routes []*backend
+	// remotes are mirrored into vault roots before each index run.
+	remotes []*remoteVault
+	// ensemble are the collections of rag.ensemble, searched along with the
+	// vault's.
+	ensemble []*ensembleMember
+
+	indexMu sync.Mutex
+	// answersMu serializes appends to the answers note.
+	answersMu sync.Mutex
+	// queryLogMu serializes appends to the query log, auditMu to the audit
+	// log.
+	queryLogMu sync.Mutex
+	auditMu    sync.Mutex
+	// routeLogMu serializes appends to the route log.
+	routeLogMu sync.Mutex
+	// feedbackMu serializes updates of the feedback marks.
+	feedbackMu sync.Mutex
+	// summarizer writes the summary levels of rag.hierarchical.
+	summarizer Summarizer
+
+	// verified holds the collections whose metadata matched on first search.
+	verified sync.Map
+	// statePulledAt is when PullState last ran, in Unix nanoseconds.
+	statePulledAt atomic.Int64
+
+	hooksMu sync.RWMutex
+	hooks   []Hooks
+
+	// spelling holds the dictionary of rag.spelling.
+	spelling spellChecker
+	// synonyms expands rag.synonyms in queries; nil without synonyms.
+	synonyms *synonymExpander
+
+	// cutter truncates snippets at rag.snippet_boundary.
+	cutter snippetCutter
+	// guard enforces rag.guardrails; see Authorize.
+	guard *guard
+	// user is the key of a per-user knowledge base, "" for the shared one.
+	user string
+
+	// format is chosen by SetTargetModel.
+	formatMu sync.RWMutex
+	format   contextFormat
 }
 
-func NewService(cfg *config.Config, workspace string) (*Service, error) {
+// NewService builds the RAG service from cfg.RAG. The options replace its
+// logger, HTTP client, vector store, embedder or clock.
+func NewService(cfg *config.Config, workspace string, opts ...Option) (*Service, error) {
 	if !cfg.RAG.Enabled {
-		return nil, fmt.Errorf("rag is disabled")
+		return nil, ErrDisabled
+	}
+	if cfg.RAG.LocalOnly {
+		if err := checkLocalOnly(cfg.RAG); err != nil {
+			return nil, err
+		}
+	}
+	o := serviceOptions{log: defaultLogger{}, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	breakerCfg := cfg.RAG.CircuitBreaker
+	cooldown := secondsOrDefault(breakerCfg.CooldownSeconds, 30)
+	embedder := o.embedder
+	if embedder == nil {
+		client, err := newEmbeddingClient(cfg.RAG.Embedding, cfg.RAG.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		client.breaker = newCircuitBreaker("embedding", breakerCfg.FailureThreshold, cooldown)
+		embedder = client
+	}
+	store := o.store
+	if store == nil {
+		qdrant, err := newQdrantClient(cfg.RAG.VectorDB, cfg.RAG.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		qdrant.breaker = newCircuitBreaker("qdrant", breakerCfg.FailureThreshold, cooldown)
+		store = qdrant
+	}
+	dataDir := filepath.Join(workspace, "rag")
+	if workspace == "" {
+		dataDir = filepath.Join(config.DefaultDataWorkspace(), "rag")
+	}
+	if cfg.RAG.DataDir != "" {
+		dataDir = config.ExpandPath(cfg.RAG.DataDir)
+	}
+	// Remote vaults are indexed from their local copies, which become
+	// additional vault roots.
+	ragCfg := cfg.RAG
+	remotes, remoteRoots, err := newRemoteVaults(ragCfg.RemoteVaults, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(remoteRoots) > 0 {
+		ragCfg.VaultPath = append(append(config.VaultPaths{}, ragCfg.VaultPath...), remoteRoots...)
+	}
+	var routes []*backend
+	for _, route := range cfg.RAG.LanguageRoutes {
+		if strings.TrimSpace(route.Language) == "" {
+			return nil, fmt.Errorf("rag.language_routes: language is required")
+		}
+		b, err := newRouteBackend(ragCfg, route)
+		if err != nil {
+			return nil, fmt.Errorf("rag.language_routes[%s]: %w", route.Language, err)
+		}
+		routes = append(routes, b)
+	}
+	ensemble, err := newEnsemble(ragCfg)
+	if err != nil {
+		return nil, err
+	}
+	injection, err := normalizeInjection(cfg.RAG.Injection)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := normalizeSources(cfg.RAG.Sources)
+	if err != nil {
+		return nil, err
+	}
+	noHit, err := normalizeNoHit(cfg.RAG.NoHit, cfg.RAG.FallbackToLLM)
+	if err != nil {
+		return nil, err
+	}
+	router, err := normalizeRouter(cfg.RAG.Router)
+	if err != nil {
+		return nil, err
+	}
+	cutter, err := newSnippetCutter(cfg.RAG.SnippetBoundary, cfg.RAG.SnippetStops)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSnippetMetadata(cfg.RAG.SnippetMetadata); err != nil {
+		return nil, err
+	}
+	if err := validateFormatProfiles(cfg.RAG.FormatProfiles); err != nil {
+		return nil, err
+	}
+	if err := validatePresets(cfg.RAG.Presets); err != nil {
+		return nil, err
 	}
-	embedder, err := NewEmbeddingClient(cfg.RAG.Embedding)
+	if err := validateSpelling(cfg.RAG.Spelling); err != nil {
+		return nil, err
+	}
+	synonyms, err := newSynonymExpander(cfg.RAG.Synonyms)
 	if err != nil {
 		return nil, err
 	}
-	qdrant, err := NewQdrantClient(cfg.RAG.VectorDB)
+	if err := validateTranscription(cfg.RAG.Transcription); err != nil {
+		return nil, err
+	}
+	anon, err := newAnonymizer(cfg.RAG.Anonymize)
 	if err != nil {
 		return nil, err
 	}
-	return &Service{
-		cfg:       cfg.RAG,
-		workspace: workspace,
-		embedder:  embedder,
-		qdrant:    qdrant,
-	}, nil
+	s := &Service{
+		cfg:      ragCfg,
+		dataDir:  dataDir,
+		storage:  NewLocalStorage(dataDir),
+		embedder: embedder,
+		store:    store,
+		log:      o.log,
+		now:      o.now,
+		routes:   routes,
+		remotes:  remotes,
+		ensemble: ensemble,
+		cutter:   cutter,
+		synonyms: synonyms,
+		guard:    newGuard(cfg.RAG.Guardrails, o.now),
+	}
+	s.cfg.Injection = injection
+	s.cfg.Sources = sources
+	s.cfg.NoHit = noHit
+	s.cfg.Router = router
+	s.format = s.defaultFormat()
+	if anon != nil {
+		anon.storage = func() Storage { return s.storage }
+		for _, b := range s.backends() {
+			if e, ok := b.embedder.(*EmbeddingClient); ok && !isLocalEndpoint(b.cfg.Embedding.APIBase) {
+				e.anonymizer = anon
+			}
+		}
+		for _, m := range s.ensemble {
+			if e, ok := m.embedder.(*EmbeddingClient); ok && !isLocalEndpoint(e.apiBase) {
+				e.anonymizer = anon
+			}
+		}
+	}
+	if o.httpClient != nil {
+		s.setHTTPClient(o.httpClient)
+	}
+	if p := newCommandPostProcessor(cfg.RAG.PostProcess); p != nil {
+		p.log = s.log
+		s.AddHooks(p)
+	}
+	return s, nil
 }
 
 func (s *Service) Config() config.RagConfig {
@@ -40,66 +240,441 @@ func (s *Service) Config() config.RagConfig {
 }
 
 func (s *Service) TriggerDecision(message string) TriggerDecision {
-	return DecideTrigger(message, s.cfg.Trigger)
+	d := DecideTrigger(message, s.cfg.Trigger)
+	d.CleanedMessage, d.Pins = parsePins(d.CleanedMessage)
+	if d.ShouldSearch {
+		d.NoHit = s.noHitOutcome()
+	}
+	return d
 }
 
 func (s *Service) Search(ctx context.Context, query string) ([]SearchResult, error) {
-	query = strings.TrimSpace(query)
+	return s.search(ctx, query, SearchFilter{})
+}
+
+// SearchFiltered is Search restricted by filter. Inline filter terms in the
+// query (see parseSearchFilter) fill in fields the filter leaves unset.
+func (s *Service) SearchFiltered(ctx context.Context, query string, filter SearchFilter) ([]SearchResult, error) {
+	return s.search(ctx, query, filter)
+}
+
+// search runs the retrieval pipeline wrapped in the registered hooks.
+func (s *Service) search(ctx context.Context, query string, filter SearchFilter) ([]SearchResult, error) {
+	query, filter = s.beforeSearch(ctx, query, filter)
+	results, err := s.retrieve(ctx, query, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.afterSearch(ctx, query, results), nil
+}
+
+// searchContext bounds one search by search_timeout_ms. The deadline sits on
+// top of the caller's context, so a cancelled chat message still aborts the
+// embedding and Qdrant calls right away.
+func (s *Service) searchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.SearchTimeoutMs <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(s.cfg.SearchTimeoutMs)*time.Millisecond)
+}
+
+// retrieve runs the retrieval pipeline. onPartial, when set, receives each
+// usable result set as soon as it exists so callers with a deadline can fall
+// back to it if later steps do not finish in time.
+func (s *Service) retrieve(ctx context.Context, query string, filter SearchFilter, onPartial func([]SearchResult)) ([]SearchResult, error) {
+	ctx, cancel := s.searchContext(ctx)
+	defer cancel()
+	s.refreshState(ctx)
+	r, err := s.prepareRetrieval(ctx, query, filter)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	vector, err := embedQuery(ctx, r.backend.embedder, r.query)
+	if err != nil {
+		return nil, err
+	}
+	return s.searchVector(ctx, r, vector, onPartial)
+}
+
+// retrieval is one query on its way through the retrieval pipeline. Search,
+// SearchWithBudget, SearchMany and SearchPage share the steps before and
+// after the query is embedded, so they rank alike.
+type retrieval struct {
+	// logged is the query as asked, for the query log; query is rewritten.
+	logged       string
+	query        string
+	filter       SearchFilter
+	params       searchParams
+	dateDetected bool
+	backend      *backend
+	// limit and offset select a window of candidates for SearchPage, which
+	// keeps the window as the store returns it instead of grouping results
+	// by document. A limit of 0 searches the top candidates.
+	limit  int
+	offset int
+}
+
+// prepareRetrieval runs the steps before the query is embedded. It returns
+// nil when the query is empty once inline filter terms are removed.
+func (s *Service) prepareRetrieval(ctx context.Context, query string, filter SearchFilter) (*retrieval, error) {
+	query, filter = s.applyInlineFilter(query, filter)
 	if query == "" {
 		return nil, nil
 	}
-	embeddings, err := s.embedder.EmbedBatch(ctx, []string{query})
+	params, err := s.searchParams(filter.Preset)
+	if err != nil {
+		return nil, err
+	}
+	r := &retrieval{logged: query, params: params}
+	query = s.rewriteQuery(query)
+	// A date found in the question narrows the search, but is dropped again
+	// if no dated note matches so undated notes can still answer.
+	if s.cfg.DateAware && filter.Dates.IsZero() {
+		if dates, ok := parseDateRange(query, s.now()); ok {
+			filter.Dates = dates
+			r.dateDetected = true
+		}
+	}
+	if s.cfg.LazyIndex {
+		if err := s.indexReferencedNotes(ctx, query); err != nil && !errors.Is(err, ErrIndexBusy) && ctx.Err() == nil {
+			s.log.Warn("Lazy index of referenced notes failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	b := s.backendFor(query)
+	if err := s.verifyCollection(ctx, b); err != nil {
+		return nil, err
+	}
+	r.query, r.filter, r.backend = query, filter, b
+	return r, nil
+}
+
+// searchVector runs the steps after the query is embedded as vector and logs
+// the search. onPartial is as for retrieve.
+func (s *Service) searchVector(ctx context.Context, r *retrieval, vector []float64, onPartial func([]SearchResult)) (results []SearchResult, err error) {
+	var nearMisses []SearchResult
+	defer func() {
+		// Later pages of a query are not logged again.
+		if err == nil && r.offset == 0 {
+			s.logQuery(r.logged, results, nearMisses)
+		}
+	}()
+	storeQuery := StoreQuery{
+		Vector:        vector,
+		Limit:         r.limit,
+		Offset:        r.offset,
+		MinSimilarity: r.params.minSimilarity,
+		Filter:        r.filter,
+	}
+	if storeQuery.Limit <= 0 {
+		storeQuery.Limit = r.params.storeLimit()
+	}
+	if len(s.ensemble) > 0 && r.offset > 0 {
+		// Fusion ranks across collections, so a later page is cut from the
+		// fused matches of every collection up to its end.
+		storeQuery.Limit, storeQuery.Offset = r.offset+r.limit, 0
+	}
+	results, nearMisses, err = s.searchNearMisses(ctx, r.backend, storeQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 && r.dateDetected {
+		storeQuery.Filter.Dates = DateRange{}
+		results, err = s.searchChunks(ctx, r.backend, storeQuery)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(results) == 0 {
+		if results, err = s.retryNoHit(ctx, r.backend, r.query, storeQuery); err != nil {
+			return nil, err
+		}
+	}
+	if onPartial != nil {
+		onPartial(s.rankResults(r, append([]SearchResult(nil), results...)))
+	}
+	results = s.rankResults(r, s.fuseWindow(ctx, r, storeQuery, results))
+	if !s.cfg.StaleCheck {
+		return results, nil
+	}
+
+	stale := s.markStale(results)
+	if len(stale) == 0 || !s.cfg.ReindexStale {
+		return results, nil
+	}
+	if onPartial != nil {
+		onPartial(results)
+	}
+	if err := s.reindexPaths(ctx, stale); errors.Is(err, ErrIndexBusy) {
+		return results, nil
+	} else if err != nil {
+		s.log.Warn("Stale reindex failed", map[string]interface{}{
+			"paths": stale,
+			"error": err.Error(),
+		})
+		return results, nil
+	}
+	refreshed, err := s.searchChunks(ctx, r.backend, storeQuery)
+	if err != nil {
+		return results, nil
+	}
+	return s.rankResults(r, s.fuseWindow(ctx, r, storeQuery, refreshed)), nil
+}
+
+// fuseWindow is fuseEnsemble for the window of r: a later SearchPage was
+// searched from the first match, see searchVector, and is cut out of the
+// fused results here.
+func (s *Service) fuseWindow(ctx context.Context, r *retrieval, storeQuery StoreQuery, results []SearchResult) []SearchResult {
+	fused := s.fuseEnsemble(ctx, r.query, r.backend, storeQuery, results)
+	if storeQuery.Offset == r.offset {
+		return fused
+	}
+	if len(fused) <= r.offset {
+		return nil
+	}
+	return fused[r.offset:]
+}
+
+// rankResults applies the feedback boosts and, outside SearchPage, groups
+// the results by document.
+func (s *Service) rankResults(r *retrieval, results []SearchResult) []SearchResult {
+	results = s.applyFeedback(results)
+	if r.limit > 0 {
+		return results
+	}
+	return r.params.groupByDocument(results)
+}
+
+// MoreLikeThis returns chunks similar to an already retrieved chunk, for
+// related-notes and "expand on this source" follow-ups.
+func (s *Service) MoreLikeThis(ctx context.Context, chunkID string) ([]SearchResult, error) {
+	chunkID = strings.TrimSpace(chunkID)
+	if chunkID == "" {
+		return nil, nil
+	}
+	params, _ := s.searchParams("")
+	// The chunk lives in exactly one backend's collection.
+	var results []SearchResult
+	var err error
+	for _, b := range s.backends() {
+		results, err = b.store.Recommend(ctx, []string{chunkID}, params.storeLimit(), params.minSimilarity)
+		if err == nil && len(results) > 0 {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
-		return nil, fmt.Errorf("embedding returned empty vector")
+	results = params.groupByDocument(results)
+	if s.cfg.StaleCheck {
+		s.markStale(results)
 	}
-	return s.qdrant.Search(ctx, embeddings[0], s.cfg.TopK, s.cfg.MinSimilarity)
+	return results, nil
 }
 
+// Index brings the index up to date with the vault and writes a report of
+// the run to IndexReportPath.
 func (s *Service) Index(ctx context.Context, opts IndexOptions) (*IndexSummary, error) {
-	indexer := newIndexer(s.cfg, s.workspace, s.embedder, s.qdrant)
-	return indexer.run(ctx, opts)
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	started := time.Now()
+	callsBefore := s.apiCallCounts()
+	// The report always lists every file; the caller only gets the list
+	// when it asked for it.
+	runOpts := opts
+	runOpts.Detail = true
+	summary, err := s.index(ctx, runOpts)
+
+	report := newIndexReport(s.cfg, opts, started, summary, err)
+	report.APICalls = s.apiCallCounts().since(callsBefore)
+	if saveErr := saveIndexReport(s.storage, report); saveErr != nil {
+		s.log.Warn("Failed to write index report", map[string]interface{}{
+			"error": saveErr.Error(),
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Detail {
+		summary.Files = nil
+	}
+	return summary, nil
+}
+
+func (s *Service) index(ctx context.Context, opts IndexOptions) (*IndexSummary, error) {
+	s.syncRemoteVaults(ctx)
+	// Another device may have indexed into the collection since this one did.
+	if err := s.PullState(ctx); err != nil {
+		s.log.Warn("Failed to pull shared index state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	var total *IndexSummary
+	for _, b := range s.backends() {
+		if total != nil && total.Stopped {
+			break
+		}
+		summary, err := s.newBackendIndexer(b).run(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if total == nil {
+			total = summary
+			continue
+		}
+		total.IndexedFiles += summary.IndexedFiles
+		total.UpdatedFiles += summary.UpdatedFiles
+		total.RemovedFiles += summary.RemovedFiles
+		total.SkippedFiles += summary.SkippedFiles
+		total.Chunks += summary.Chunks
+		total.FailedFiles += summary.FailedFiles
+		total.Files = append(total.Files, summary.Files...)
+		total.Failures = append(total.Failures, summary.Failures...)
+		total.Stopped = summary.Stopped
+		if total.FullReindexReason == "" && summary.FullReindexReason != "" {
+			total.FullReindexReason = b.language + ": " + summary.FullReindexReason
+		}
+	}
+	return total, nil
+}
+
+// CheckReady reports whether the service can answer searches: every backend
+// has a built index and its vector store is reachable.
+func (s *Service) CheckReady(ctx context.Context) error {
+	if err := s.PullState(ctx); err != nil {
+		s.log.Warn("Failed to pull shared index state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	for _, b := range s.backends() {
+		if _, err := s.newBackendIndexer(b).loadState(); err != nil {
+			return ErrIndexNotBuilt
+		}
+		if err := b.store.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// reindexPaths refreshes paths for a search. It does not wait for an index
+// run in progress, which could keep the search waiting for minutes.
+func (s *Service) reindexPaths(ctx context.Context, paths []string) error {
+	if !s.indexMu.TryLock() {
+		return ErrIndexBusy
+	}
+	defer s.indexMu.Unlock()
+	for _, b := range s.backends() {
+		if err := s.newBackendIndexer(b).reindexPaths(ctx, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	contextHeader = "## Knowledge Base Notes\n" +
+		"Use the notes below to answer the question. If the notes do not contain the answer, say so explicitly.\n\n"
+	contextFooter   = "When you answer, cite sources like [1], [2] and include a Sources section listing the cited entries.\n"
+	truncatedMarker = "...(truncated)"
+)
+
+// FormatContext renders results as prompt context in the format chosen by
+// SetTargetModel and rag.injection.format, which may cap the number of
+// results included.
 func (s *Service) FormatContext(results []SearchResult) string {
+	return s.formatContext(s.contextFormat(), results)
+}
+
+func (s *Service) formatContext(f contextFormat, results []SearchResult) string {
+	results = f.limit(results)
 	if len(results) == 0 {
 		return ""
 	}
-	var sb strings.Builder
-	sb.WriteString("## Knowledge Base Notes\n")
-	sb.WriteString("Use the notes below to answer the question. If the notes do not contain the answer, say so explicitly.\n\n")
+	f.guidance = s.contextGuidance(results)
+	entries := make([]string, len(results))
 	for idx, r := range results {
-		label := idx + 1
-		sb.WriteString(fmt.Sprintf("[%d] %s\n", label, formatSource(r)))
-		snippet := strings.TrimSpace(r.Content)
-		if s.cfg.SnippetMaxChars > 0 && len(snippet) > s.cfg.SnippetMaxChars {
-			snippet = snippet[:s.cfg.SnippetMaxChars] + "...(truncated)"
-		}
-		sb.WriteString(snippet)
-		sb.WriteString("\n\n")
+		entries[idx] = f.entry(idx+1, r, f.snippet(r))
+	}
+	return s.contextBuilt(results, f.render(entries))
+}
+
+// snippet is the result text as shown in the context, cut to
+// snippetMaxChars at the configured boundary. A chunk that starts
+// mid-sentence gets a leading ellipsis.
+func (f contextFormat) snippet(r SearchResult) string {
+	snippet := strings.TrimSpace(r.Content)
+	if r.Pinned {
+		// Pinned notes were cut to rag.pinned.max_tokens when read.
+		return snippet
+	}
+	if f.snippetMaxChars > 0 && utf8.RuneCountInString(snippet) > f.snippetMaxChars {
+		snippet = f.cutter.cut(snippet, f.snippetMaxChars) + truncatedMarker
+	}
+	if f.cutter.boundary != SnippetBoundaryNone && r.StartLine > 1 && startsMidSentence(snippet) {
+		snippet = leadingEllipsis + snippet
+	}
+	return snippet
+}
+
+func (f contextFormat) entry(label int, r SearchResult, snippet string) string {
+	if f.json {
+		return jsonContextEntry(label, r, snippet, f.sourceMeta(r))
 	}
-	sb.WriteString("When you answer, cite sources like [1], [2] and include a Sources section listing the cited entries.\n")
-	return sb.String()
+	return fmt.Sprintf("[%d] %s%s\n%s\n\n", label, FormatSource(r), f.sourceMeta(r).suffix(), snippet)
+}
+
+func (f contextFormat) render(entries []string) string {
+	if f.json {
+		return renderJSONContext(entries, f.guidance)
+	}
+	guidance := ""
+	if f.guidance != "" {
+		guidance = f.guidance + "\n\n"
+	}
+	return f.header + guidance + strings.Join(entries, "") + f.footer
 }
 
 func (s *Service) FormatSources(results []SearchResult) string {
 	if len(results) == 0 {
 		return ""
 	}
-	var sb strings.Builder
-	sb.WriteString("Sources:\n")
-	for idx, r := range results {
-		label := idx + 1
-		sb.WriteString(fmt.Sprintf("[%d] %s\n", label, formatSource(r)))
+	labels := make([]int, len(results))
+	for idx := range results {
+		labels[idx] = idx + 1
 	}
-	return strings.TrimSpace(sb.String())
+	return s.formatSourceLabels(results, labels)
 }
 
-func formatSource(r SearchResult) string {
+// FormatSource renders a result as a citation label: path, heading and lines,
+// or the time span for a chunk of an audio transcript. A summary of
+// rag.hierarchical is labeled with its title and the notes it covers.
+func FormatSource(r SearchResult) string {
+	if r.SummaryLevel > 0 {
+		return fmt.Sprintf("%s (summary of %s)", r.Heading, summarySourcesLabel(r.SummaryOf))
+	}
+	span := fmt.Sprintf("L%d-L%d", r.StartLine, r.EndLine)
+	if r.AudioEnd > 0 {
+		// Times are what a listener can look up in the recording.
+		span = "@" + formatTimestamp(float64(r.AudioStart)) + "-" + formatTimestamp(float64(r.AudioEnd))
+	}
+	var source string
 	if r.Heading != "" {
-		return fmt.Sprintf("%s#%s L%d-L%d", r.Path, r.Heading, r.StartLine, r.EndLine)
+		source = fmt.Sprintf("%s#%s %s", r.Path, r.Heading, span)
+	} else {
+		source = fmt.Sprintf("%s %s", r.Path, span)
+	}
+	if r.Stale {
+		source += " (modified since indexing)"
+	}
+	if r.Pinned {
+		source += " (pinned)"
+	}
+	if r.Namespace != "" {
+		source = r.Namespace + ": " + source
 	}
-	return fmt.Sprintf("%s L%d-L%d", r.Path, r.StartLine, r.EndLine)
+	return source
 }
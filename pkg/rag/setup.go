@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// VaultStats summarizes the notes a config would index.
+type VaultStats struct {
+	Notes int
+	Bytes int64
+}
+
+// ScanVault counts the notes under cfg.VaultPath that match the include and
+// exclude patterns.
+func ScanVault(cfg config.RagConfig) (VaultStats, error) {
+	var stats VaultStats
+	v, err := newVault(cfg.VaultPath)
+	if err != nil {
+		return stats, err
+	}
+	v.formats = noteFormatsOf(cfg)
+	if err := v.check(); err != nil {
+		return stats, err
+	}
+	files, err := v.list(cfg.IncludePatterns, cfg.ExcludePatterns)
+	if err != nil {
+		return stats, err
+	}
+	for _, f := range files {
+		info, err := os.Stat(ioPath(f.AbsPath))
+		if err != nil {
+			continue
+		}
+		stats.Notes++
+		stats.Bytes += info.Size()
+	}
+	return stats, nil
+}
+
+// SuggestChunking picks chunk_size and chunk_overlap for a vault. Small
+// vaults keep the defaults; larger ones get bigger chunks so the number of
+// vectors, and with it embedding cost and store size, grows more slowly.
+func SuggestChunking(stats VaultStats) (chunkSize, chunkOverlap int) {
+	switch {
+	case stats.Bytes < 5<<20:
+		return 800, 120
+	case stats.Bytes < 50<<20:
+		return 1000, 150
+	default:
+		return 1500, 200
+	}
+}
+
+// ProbeEmbedding embeds a short text with cfg and returns the vector size,
+// to check the endpoint, credentials and model before saving them.
+func ProbeEmbedding(ctx context.Context, cfg config.RagEmbeddingConfig) (int, error) {
+	client, err := NewEmbeddingClient(cfg)
+	if err != nil {
+		return 0, err
+	}
+	vectors, err := client.EmbedBatch(ctx, []string{"picoclaw"})
+	if err != nil {
+		return 0, err
+	}
+	if len(vectors) == 0 || len(vectors[0]) == 0 {
+		return 0, fmt.Errorf("embedding response has no vector")
+	}
+	return len(vectors[0]), nil
+}
+
+// ProbeVectorDB checks that the vector store in cfg is reachable.
+func ProbeVectorDB(ctx context.Context, cfg config.RagVectorDBConfig) error {
+	client, err := NewQdrantClient(cfg)
+	if err != nil {
+		return err
+	}
+	return client.Ping(ctx)
+}
@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestScanVault(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"a.md":          "hello",
+		"sub/b.md":      "world!",
+		"skip/c.md":     "ignored",
+		"not-a-note.go": "package x",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.RagConfig{
+		VaultPath:       config.VaultPaths{dir},
+		ExcludePatterns: []string{"skip/**"},
+	}
+	stats, err := ScanVault(cfg)
+	if err != nil {
+		t.Fatalf("ScanVault() error: %v", err)
+	}
+	if stats.Notes != 2 || stats.Bytes != 11 {
+		t.Errorf("ScanVault() = %+v, want 2 notes, 11 bytes", stats)
+	}
+}
+
+func TestSuggestChunking(t *testing.T) {
+	tests := []struct {
+		bytes       int64
+		wantSize    int
+		wantOverlap int
+	}{
+		{0, 800, 120},
+		{4 << 20, 800, 120},
+		{20 << 20, 1000, 150},
+		{200 << 20, 1500, 200},
+	}
+	for _, tt := range tests {
+		size, overlap := SuggestChunking(VaultStats{Bytes: tt.bytes})
+		if size != tt.wantSize || overlap != tt.wantOverlap {
+			t.Errorf("SuggestChunking(%d bytes) = %d/%d, want %d/%d", tt.bytes, size, overlap, tt.wantSize, tt.wantOverlap)
+		}
+	}
+}
+
+func TestProbeEmbedding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1,0.2,0.3]}]}`))
+	}))
+	defer srv.Close()
+
+	dim, err := ProbeEmbedding(context.Background(), config.RagEmbeddingConfig{APIBase: srv.URL, Model: "m"})
+	if err != nil {
+		t.Fatalf("ProbeEmbedding() error: %v", err)
+	}
+	if dim != 3 {
+		t.Errorf("ProbeEmbedding() = %d, want 3", dim)
+	}
+}
@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const statePayloadKey = "picoclaw_index_state"
+
+// statePointID is the ID of the point holding the shared index state.
+var statePointID = hashPointID("picoclaw:index_state", 0, 0)
+
+// sharedStateRefresh is how often searches look for a newer shared state.
+const sharedStateRefresh = 5 * time.Minute
+
+// stateStore is implemented by vector stores that can keep a copy of the
+// index state, so a device that only queries the index does not need the
+// indexing device's workspace. See config.RagConfig.SharedState.
+type stateStore interface {
+	// readState returns nil when no state has been stored yet.
+	readState(ctx context.Context) (*indexState, error)
+	writeState(ctx context.Context, state *indexState) error
+}
+
+var _ stateStore = (*QdrantClient)(nil)
+
+func (c *QdrantClient) readState(ctx context.Context) (*indexState, error) {
+	payload, err := c.pointPayload(ctx, statePointID)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := payload[statePayloadKey]
+	if !ok {
+		return nil, nil
+	}
+	var data string
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode shared index state: %w", err)
+	}
+	var state indexState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("failed to decode shared index state: %w", err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]int64{}
+	}
+	if state.OtherLanguage == nil {
+		state.OtherLanguage = map[string]int64{}
+	}
+	return &state, nil
+}
+
+// writeState stores state as a JSON string on a point with a zero vector,
+// like the collection metadata.
+func (c *QdrantClient) writeState(ctx context.Context, state *indexState) error {
+	if state.EmbeddingDimension <= 0 {
+		return fmt.Errorf("invalid vector dimension: %d", state.EmbeddingDimension)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return c.Upsert(ctx, []QdrantPoint{{
+		ID:     statePointID,
+		Vector: make([]float64, state.EmbeddingDimension),
+		Payload: map[string]interface{}{
+			statePayloadKey:   string(data),
+			"chunker_version": state.ChunkerVersion,
+		},
+	}})
+}
+
+// pushState uploads the index state after a run when rag.shared_state is
+// on. Failing to upload does not fail the run.
+func (i *indexer) pushState(ctx context.Context, state *indexState) {
+	ss, ok := i.store.(stateStore)
+	if !ok || !i.cfg.SharedState || state.EmbeddingDimension <= 0 {
+		return
+	}
+	if err := ss.writeState(ctx, state); err != nil {
+		i.log.Warn("Failed to upload shared index state", map[string]interface{}{
+			"collection": i.store.Collection(),
+			"error":      err.Error(),
+		})
+	}
+}
+
+// PullState replaces each backend's local index state with the copy stored
+// in its collection when that copy is newer, so a device that only queries
+// the index knows what the indexing device built. It does nothing unless
+// rag.shared_state is on.
+func (s *Service) PullState(ctx context.Context) error {
+	if !s.cfg.SharedState {
+		return nil
+	}
+	s.statePulledAt.Store(time.Now().UnixNano())
+	for _, b := range s.backends() {
+		ss, ok := b.store.(stateStore)
+		if !ok {
+			continue
+		}
+		remote, err := ss.readState(ctx)
+		if errors.Is(err, ErrCollectionMissing) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fetching shared index state of %s: %w", b.store.Collection(), err)
+		}
+		if remote == nil {
+			continue
+		}
+		idx := s.newBackendIndexer(b)
+		if local, err := idx.loadState(); err == nil && !stateNewer(remote, local) {
+			continue
+		}
+		if err := writeIndexState(idx.storage, idx.stateName(), remote, idx.log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshState pulls the shared state for a search at most every
+// sharedStateRefresh.
+func (s *Service) refreshState(ctx context.Context) {
+	if !s.cfg.SharedState || time.Since(time.Unix(0, s.statePulledAt.Load())) < sharedStateRefresh {
+		return
+	}
+	if err := s.PullState(ctx); err != nil && ctx.Err() == nil {
+		s.log.Warn("Failed to pull shared index state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// stateNewer reports whether a was saved after b.
+func stateNewer(a, b *indexState) bool {
+	ta, errA := time.Parse(time.RFC3339, a.UpdatedAt)
+	tb, errB := time.Parse(time.RFC3339, b.UpdatedAt)
+	if errA != nil {
+		return false
+	}
+	return errB != nil || ta.After(tb)
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestSharedStatePushAndPull(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		points = map[string]QdrantPoint{}
+	)
+	client := newTestQdrant(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req struct {
+			Points []QdrantPoint `json:"points"`
+			IDs    []string      `json:"ids"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Method == http.MethodPut {
+			for _, p := range req.Points {
+				points[p.ID] = p
+			}
+			w.Write([]byte(`{"result":true}`))
+			return
+		}
+		var result []map[string]interface{}
+		for _, id := range req.IDs {
+			if p, ok := points[id]; ok {
+				result = append(result, map[string]interface{}{"id": id, "payload": p.Payload})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	})
+
+	desktop := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	desktop.cfg.SharedState = true
+	idx := desktop.newBackendIndexer(&backend{cfg: desktop.cfg, embedder: desktop.embedder, store: client})
+	idx.pushState(t.Context(), &indexState{
+		UpdatedAt:          "2024-05-01T10:00:00Z",
+		Collection:         "notes",
+		EmbeddingDimension: 3,
+		Files:              map[string]int64{"a.md": 42},
+	})
+	if !isMetadataPayload(points[statePointID].Payload) {
+		t.Error("the shared state point should be kept out of search results")
+	}
+
+	board := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	board.store = client
+	if err := board.PullState(t.Context()); err != nil {
+		t.Fatalf("PullState() with shared_state off error: %v", err)
+	}
+	if _, err := loadIndexState(board.storage, "index_state.json", defaultLogger{}); err == nil {
+		t.Fatal("PullState() wrote a state with shared_state off")
+	}
+
+	board.cfg.SharedState = true
+	if err := board.PullState(t.Context()); err != nil {
+		t.Fatalf("PullState() error: %v", err)
+	}
+	state, err := loadIndexState(board.storage, "index_state.json", defaultLogger{})
+	if err != nil || state.Files["a.md"] != 42 || state.UpdatedAt != "2024-05-01T10:00:00Z" {
+		t.Fatalf("pulled state = %+v, %v", state, err)
+	}
+
+	state.UpdatedAt = "2024-06-01T10:00:00Z"
+	state.Files["b.md"] = 7
+	if err := writeIndexState(board.storage, "index_state.json", state, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := board.PullState(t.Context()); err != nil {
+		t.Fatalf("PullState() error: %v", err)
+	}
+	if state, _ := loadIndexState(board.storage, "index_state.json", defaultLogger{}); state.Files["b.md"] != 7 {
+		t.Error("an older shared state replaced a newer local one")
+	}
+}
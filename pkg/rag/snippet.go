@@ -0,0 +1,133 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet boundaries, set with rag.snippet_boundary, choose where a snippet
+// longer than its allowance is cut.
+const (
+	// SnippetBoundarySentence cuts after the last sentence that fits.
+	SnippetBoundarySentence = "sentence"
+	// SnippetBoundaryParagraph cuts after the last paragraph that fits, or
+	// after a sentence when no paragraph ends late enough.
+	SnippetBoundaryParagraph = "paragraph"
+	// SnippetBoundaryNone cuts at the allowance, mid-word if need be.
+	SnippetBoundaryNone = "none"
+)
+
+// leadingEllipsis marks a snippet whose chunk starts mid-sentence, so the
+// model does not read the fragment as a complete statement.
+const leadingEllipsis = "..."
+
+// defaultSnippetStops end a sentence. Stops ending in ASCII punctuation only
+// count before whitespace, so "3.14" or "e.g" do not end one.
+var defaultSnippetStops = []string{".", "!", "?", "。", "！", "？", "…"}
+
+// snippetCutter truncates snippets at a boundary.
+type snippetCutter struct {
+	boundary string
+	stops    []string
+}
+
+var defaultSnippetCutter = snippetCutter{boundary: SnippetBoundarySentence, stops: defaultSnippetStops}
+
+func newSnippetCutter(boundary string, stops []string) (snippetCutter, error) {
+	switch boundary {
+	case "":
+		boundary = SnippetBoundarySentence
+	case SnippetBoundarySentence, SnippetBoundaryParagraph, SnippetBoundaryNone:
+	default:
+		return snippetCutter{}, fmt.Errorf("rag.snippet_boundary: unknown boundary %q", boundary)
+	}
+	c := snippetCutter{boundary: boundary, stops: append([]string(nil), defaultSnippetStops...)}
+	for _, stop := range stops {
+		if stop != "" {
+			c.stops = append(c.stops, stop)
+		}
+	}
+	return c, nil
+}
+
+// truncateSnippet cuts text to at most maxChars runes, preferring to end at a
+// line break or sentence end in the second half of the allowance.
+func truncateSnippet(text string, maxChars int) string {
+	return defaultSnippetCutter.cut(text, maxChars)
+}
+
+// cut truncates text to at most maxChars runes at the cutter's boundary. A
+// paragraph end counts in the last two thirds of the allowance, a line break
+// or sentence end in the second half; with neither, text is cut at maxChars.
+func (c snippetCutter) cut(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	cut := string(runes[:maxChars])
+	if c.boundary == SnippetBoundaryParagraph {
+		if idx := strings.LastIndex(cut, "\n\n"); idx > 0 && idx >= len(cut)/3 {
+			return strings.TrimSpace(cut[:idx])
+		}
+	}
+	if c.boundary != SnippetBoundaryNone {
+		if end := c.sentenceEnd(cut, runes[maxChars]); end > 0 && end >= len(cut)/2 {
+			return strings.TrimSpace(cut[:end])
+		}
+	}
+	return strings.TrimSpace(cut)
+}
+
+// sentenceEnd returns the byte offset just past the last line break or
+// sentence stop in cut, or -1. next is the rune following cut in the text.
+func (c snippetCutter) sentenceEnd(cut string, next rune) int {
+	best := strings.LastIndex(cut, "\n")
+	if best >= 0 {
+		best++
+	}
+	for _, stop := range c.stops {
+		limit := len(cut)
+		for limit > best {
+			idx := strings.LastIndex(cut[:limit], stop)
+			if idx < 0 {
+				break
+			}
+			end := idx + len(stop)
+			if end > best && endsSentence(stop, cut[end:], next) {
+				best = end
+				break
+			}
+			limit = idx
+		}
+	}
+	return best
+}
+
+// endsSentence reports whether stop, followed by rest and then next, ends a
+// sentence.
+func endsSentence(stop, rest string, next rune) bool {
+	last, _ := utf8.DecodeLastRuneInString(stop)
+	if last >= utf8.RuneSelf {
+		return true
+	}
+	follower := next
+	if rest != "" {
+		follower, _ = utf8.DecodeRuneInString(rest)
+	}
+	return unicode.IsSpace(follower)
+}
+
+// startsMidSentence reports whether a chunk's text continues a sentence
+// begun in the lines before it, which happens when a paragraph wraps over
+// several lines and the chunk starts on one of the later ones. A lowercase
+// word counts, a single letter such as a variable name does not.
+func startsMidSentence(text string) bool {
+	first, size := utf8.DecodeRuneInString(text)
+	if strings.ContainsRune(",;:)]", first) {
+		return true
+	}
+	second, _ := utf8.DecodeRuneInString(text[size:])
+	return unicode.IsLower(first) && unicode.IsLetter(second)
+}
@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippetCutterBoundaries(t *testing.T) {
+	text := "First paragraph ends here.\n\nPi is 3.14 and rising. Second sentence runs on and on without end"
+	tests := []struct {
+		boundary string
+		stops    []string
+		max      int
+		want     string
+	}{
+		{SnippetBoundarySentence, nil, 60, "First paragraph ends here.\n\nPi is 3.14 and rising."},
+		{SnippetBoundarySentence, nil, 33, "First paragraph ends here."},
+		{SnippetBoundaryParagraph, nil, 60, "First paragraph ends here."},
+		{SnippetBoundaryNone, nil, 60, "First paragraph ends here.\n\nPi is 3.14 and rising. Second se"},
+		{SnippetBoundarySentence, []string{" on"}, 85, "First paragraph ends here.\n\nPi is 3.14 and rising. Second sentence runs on and on"},
+		{SnippetBoundarySentence, nil, 200, text},
+	}
+	for _, tt := range tests {
+		c, err := newSnippetCutter(tt.boundary, tt.stops)
+		if err != nil {
+			t.Fatalf("newSnippetCutter(%q) error: %v", tt.boundary, err)
+		}
+		if got := c.cut(text, tt.max); got != tt.want {
+			t.Errorf("%s cut(%d) = %q, want %q", tt.boundary, tt.max, got, tt.want)
+		}
+	}
+	if got := truncateSnippet("Zahl 3.14159 ist ungefähr pi", 10); got != "Zahl 3.141" {
+		t.Errorf("truncateSnippet() cut at a decimal point: %q", got)
+	}
+	if _, err := newSnippetCutter("word", nil); err == nil {
+		t.Error("expected an error for an unknown boundary")
+	}
+}
+
+func TestSnippetLeadingEllipsis(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	f := s.contextFormat()
+	if got := f.snippet(SearchResult{StartLine: 12, Content: "and then the rollout finished."}); got != "...and then the rollout finished." {
+		t.Errorf("snippet() = %q", got)
+	}
+	if got := f.snippet(SearchResult{StartLine: 1, Content: "lowercase title line"}); got != "lowercase title line" {
+		t.Errorf("snippet() of the first chunk = %q", got)
+	}
+	f.snippetMaxChars = 20
+	if got := f.snippet(SearchResult{StartLine: 3, Content: "Überall grün. Noch mehr Text folgt"}); got != "Überall grün."+truncatedMarker {
+		t.Errorf("snippet() = %q", got)
+	}
+	f.cutter.boundary = SnippetBoundaryNone
+	if got := f.snippet(SearchResult{StartLine: 3, Content: "and more"}); strings.HasPrefix(got, leadingEllipsis) {
+		t.Errorf("snippet() with boundary none = %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Snippet metadata fields, listed in rag.snippet_metadata, are shown on the
+// source line of each result in the context so the model can tell how
+// recent a note is and where it comes from.
+const (
+	// SnippetMetaModified is the date the note was last modified.
+	SnippetMetaModified = "modified"
+	// SnippetMetaTags are the note's frontmatter tags.
+	SnippetMetaTags = "tags"
+	// SnippetMetaVault is the vault the note is in.
+	SnippetMetaVault = "vault"
+)
+
+func validateSnippetMetadata(fields []string) error {
+	for _, field := range fields {
+		switch field {
+		case SnippetMetaModified, SnippetMetaTags, SnippetMetaVault:
+		default:
+			return fmt.Errorf("rag.snippet_metadata: unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// sourceMeta holds the metadata of a result as shown in the context; fields
+// not configured or not known are empty.
+type sourceMeta struct {
+	Modified string
+	Tags     []string
+	Vault    string
+}
+
+// sourceMeta collects the configured metadata of r.
+func (f contextFormat) sourceMeta(r SearchResult) sourceMeta {
+	var m sourceMeta
+	for _, field := range f.metadata {
+		switch field {
+		case SnippetMetaModified:
+			if !r.ModTime.IsZero() {
+				m.Modified = r.ModTime.Format("2006-01-02")
+			}
+		case SnippetMetaTags:
+			m.Tags = r.Tags
+		case SnippetMetaVault:
+			m.Vault = f.vaultName(r.Path)
+		}
+	}
+	return m
+}
+
+// vaultName is the name of the vault holding path: its prefix, or the
+// directory name when there is a single vault.
+func (f contextFormat) vaultName(path string) string {
+	if f.vault == nil {
+		return ""
+	}
+	root, _, ok := f.vault.locate(path)
+	if !ok {
+		return ""
+	}
+	if root.prefix != "" {
+		return root.prefix
+	}
+	return filepath.Base(root.path)
+}
+
+// suffix renders the metadata for the source line, e.g.
+// " (modified 2021-04-03; tags: work, api)".
+func (m sourceMeta) suffix() string {
+	var parts []string
+	if m.Modified != "" {
+		parts = append(parts, "modified "+m.Modified)
+	}
+	if len(m.Tags) > 0 {
+		parts = append(parts, "tags: "+strings.Join(m.Tags, ", "))
+	}
+	if m.Vault != "" {
+		parts = append(parts, "vault: "+m.Vault)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, "; ") + ")"
+}
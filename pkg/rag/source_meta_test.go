@@ -0,0 +1,37 @@
+package rag
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatContextSourceMetadata(t *testing.T) {
+	dir := t.TempDir()
+	s := newRunnerTestService(t, t.TempDir(), filepath.Join(dir, "brain"))
+	results := []SearchResult{
+		{Path: "a.md", StartLine: 1, EndLine: 4, Content: "alpha", ModTime: time.Date(2021, 4, 3, 8, 0, 0, 0, time.Local), Tags: []string{"work", "api"}},
+		{Path: "b.md", StartLine: 1, EndLine: 2, Content: "beta"},
+	}
+	text := s.FormatContext(results)
+	if !strings.Contains(text, "[1] a.md L1-L4 (modified 2021-04-03; tags: work, api)\nalpha") || !strings.Contains(text, "[2] b.md L1-L2\nbeta") {
+		t.Errorf("FormatContext() source lines:\n%s", text)
+	}
+
+	s.cfg.SnippetMetadata = []string{SnippetMetaVault}
+	s.SetTargetModel("")
+	if text := s.FormatContext(results); !strings.Contains(text, "[1] a.md L1-L4 (vault: brain)\n") {
+		t.Errorf("FormatContext() with vault:\n%s", text)
+	}
+
+	s.cfg.SnippetMetadata = nil
+	s.SetTargetModel("")
+	if text := s.FormatContext(results); !strings.Contains(text, "[1] a.md L1-L4\nalpha") {
+		t.Errorf("FormatContext() without metadata:\n%s", text)
+	}
+
+	if err := validateSnippetMetadata([]string{"author"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
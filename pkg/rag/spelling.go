@@ -0,0 +1,279 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// vocabularyFile holds the word counts of the vault for rag.spelling. It is
+// rebuilt by index runs that change notes.
+const vocabularyFile = "vocabulary.json"
+
+// maxVocabularyWordLen skips tokens that are more likely hashes or URLs than
+// words.
+const maxVocabularyWordLen = 30
+
+type vocabulary struct {
+	Words map[string]int `json:"words"`
+}
+
+func validateSpelling(cfg config.RagSpellingConfig) error {
+	if cfg.MaxEditDistance < 0 || cfg.MaxEditDistance > 2 {
+		return fmt.Errorf("rag.spelling.max_edit_distance must be 0, 1 or 2")
+	}
+	return nil
+}
+
+// spellWords calls fn for every word of text a spelling dictionary can hold:
+// runs of letters outside the CJK scripts, which are not written with spaces.
+// start and end are byte offsets into text.
+func spellWords(text string, fn func(word string, start, end int)) {
+	start := -1
+	for idx, r := range text {
+		if unicode.IsLetter(r) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			if start < 0 {
+				start = idx
+			}
+			continue
+		}
+		if start >= 0 {
+			fn(text[start:idx], start, idx)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fn(text[start:], start, len(text))
+	}
+}
+
+// buildVocabulary counts the words of files and saves them for the query
+// spelling correction.
+func (i *indexer) buildVocabulary(files []fileEntry) error {
+	vocab := vocabulary{Words: make(map[string]int)}
+	for _, f := range files {
+		if isAudioFile(f.AbsPath) {
+			continue
+		}
+		data, err := readNote(ioPath(f.AbsPath), nil)
+		if err != nil {
+			continue
+		}
+		spellWords(normalizeText(string(data)), func(word string, _, _ int) {
+			if n := utf8.RuneCountInString(word); n > 1 && n <= maxVocabularyWordLen {
+				vocab.Words[strings.ToLower(word)]++
+			}
+		})
+	}
+	data, err := json.Marshal(vocab)
+	if err != nil {
+		return err
+	}
+	return i.storage.WriteFile(vocabularyFile, data)
+}
+
+// spellDictionary looks up corrections symspell-style: every word is indexed
+// under the strings left by deleting up to maxDistance of its letters, so a
+// misspelling finds its candidates through its own deletes without scanning
+// the vocabulary.
+type spellDictionary struct {
+	words       []string
+	counts      []int
+	known       map[string]bool
+	deletes     map[string][]int32
+	maxDistance int
+}
+
+func newSpellDictionary(vocab vocabulary, maxDistance int) *spellDictionary {
+	d := &spellDictionary{
+		known:       make(map[string]bool, len(vocab.Words)),
+		deletes:     make(map[string][]int32),
+		maxDistance: maxDistance,
+	}
+	for word, count := range vocab.Words {
+		d.known[word] = true
+		id := int32(len(d.words))
+		d.words = append(d.words, word)
+		d.counts = append(d.counts, count)
+		for del := range wordDeletes(word, maxDistance) {
+			d.deletes[del] = append(d.deletes[del], id)
+		}
+	}
+	return d
+}
+
+// wordDeletes returns word and every string made by deleting up to distance
+// of its runes.
+func wordDeletes(word string, distance int) map[string]bool {
+	out := map[string]bool{word: true}
+	frontier := []string{word}
+	for step := 0; step < distance; step++ {
+		var next []string
+		for _, w := range frontier {
+			runes := []rune(w)
+			if len(runes) <= 1 {
+				continue
+			}
+			for idx := range runes {
+				del := string(runes[:idx]) + string(runes[idx+1:])
+				if !out[del] {
+					out[del] = true
+					next = append(next, del)
+				}
+			}
+		}
+		frontier = next
+	}
+	return out
+}
+
+// correct returns the closest known word to a lowercase word, preferring the
+// smaller edit distance and then the more frequent word, or "" when there is
+// none within maxDistance.
+func (d *spellDictionary) correct(word string) string {
+	best, bestDistance, bestCount := "", d.maxDistance+1, 0
+	seen := make(map[int32]bool)
+	for del := range wordDeletes(word, d.maxDistance) {
+		for _, id := range d.deletes[del] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			candidate := d.words[id]
+			dist := editDistance(word, candidate, d.maxDistance)
+			if dist < bestDistance || (dist == bestDistance && d.counts[id] > bestCount) ||
+				(dist == bestDistance && d.counts[id] == bestCount && candidate < best) {
+				best, bestDistance, bestCount = candidate, dist, d.counts[id]
+			}
+		}
+	}
+	if bestDistance > d.maxDistance {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent runes. It stops
+// early and returns limit+1 once the distance exceeds limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > limit || -diff > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// spellChecker keeps the dictionary of the vocabulary file loaded, reloading
+// it when an index run rewrites the file.
+type spellChecker struct {
+	mu      sync.Mutex
+	modTime time.Time
+	dict    *spellDictionary
+}
+
+func (c *spellChecker) dictionary(st Storage, log Logger, maxDistance int) *spellDictionary {
+	info, err := st.Stat(vocabularyFile)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dict != nil && info.ModTime().Equal(c.modTime) {
+		return c.dict
+	}
+	data, err := st.ReadFile(vocabularyFile)
+	if err != nil {
+		return c.dict
+	}
+	var vocab vocabulary
+	if err := json.Unmarshal(data, &vocab); err != nil {
+		log.Warn("Failed to read the spelling vocabulary", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return c.dict
+	}
+	c.dict = newSpellDictionary(vocab, maxDistance)
+	c.modTime = info.ModTime()
+	return c.dict
+}
+
+// correctSpelling normalizes query and replaces its words that are not in the
+// vault's vocabulary with the closest word that is, when rag.spelling is
+// enabled for the query's language. Words shorter than min_word_length are left alone,
+// since short words have too many neighbours to correct reliably.
+func (s *Service) correctSpelling(query string) string {
+	cfg := s.cfg.Spelling
+	if !cfg.Enabled || cfg.MaxEditDistance <= 0 {
+		return query
+	}
+	if len(cfg.Languages) > 0 && !slices.Contains(cfg.Languages, detectLanguage(query)) {
+		return query
+	}
+	query = normalizeText(query)
+	dict := s.spelling.dictionary(s.storage, s.log, cfg.MaxEditDistance)
+	if dict == nil {
+		return query
+	}
+	var out strings.Builder
+	last := 0
+	spellWords(query, func(word string, start, end int) {
+		lower := strings.ToLower(word)
+		if utf8.RuneCountInString(word) < cfg.MinWordLength || dict.known[lower] || s.synonyms.has(lower) {
+			return
+		}
+		fixed := dict.correct(lower)
+		if fixed == "" {
+			return
+		}
+		if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+			r, size := utf8.DecodeRuneInString(fixed)
+			fixed = string(unicode.ToUpper(r)) + fixed[size:]
+		}
+		out.WriteString(query[last:start])
+		out.WriteString(fixed)
+		last = end
+	})
+	if last == 0 {
+		return query
+	}
+	out.WriteString(query[last:])
+	corrected := out.String()
+	s.log.Info("Corrected query spelling", map[string]interface{}{
+		"query":     query,
+		"corrected": corrected,
+	})
+	return corrected
+}
@@ -0,0 +1,69 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kubernetes", "kubernetes", 2, 0},
+		{"teh", "the", 2, 1},
+		{"kubernets", "kubernetes", 2, 1},
+		{"sepsis", "sepis", 2, 1},
+		{"café", "cafe", 2, 1},
+		{"cat", "dogs", 2, 3},
+		{"a", "abcdef", 2, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSpellDictionaryCorrect(t *testing.T) {
+	d := newSpellDictionary(vocabulary{Words: map[string]int{"deploy": 9, "deplay": 1, "kubernetes": 4, "cluster": 3}}, 2)
+	tests := map[string]string{
+		"deplyo":    "deploy",
+		"kubernets": "kubernetes",
+		"clsuter":   "cluster",
+		"zebra":     "",
+	}
+	for word, want := range tests {
+		if got := d.correct(word); got != want {
+			t.Errorf("correct(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestCorrectSpellingUsesVaultVocabulary(t *testing.T) {
+	vault := t.TempDir()
+	os.WriteFile(filepath.Join(vault, "ops.md"), []byte("# Kubernetes\nHow we deploy the cluster. Kubernetes upgrades.\n部署集群"), 0o644)
+	cfg := config.DefaultConfig().RAG
+	cfg.Spelling.Enabled = true
+	storage := NewMemoryStorage()
+	idx := newIndexer(cfg, storage, &EmbeddingClient{batchSize: 16}, nil)
+	if err := idx.buildVocabulary([]fileEntry{{RelPath: "ops.md", AbsPath: filepath.Join(vault, "ops.md")}}); err != nil {
+		t.Fatalf("buildVocabulary() error: %v", err)
+	}
+
+	s := &Service{cfg: cfg, storage: storage, log: defaultLogger{}}
+	if got := s.correctSpelling("Kubernets deplyo steps for the clustr"); got != "Kubernetes deploy steps for the cluster" {
+		t.Errorf("correctSpelling() = %q", got)
+	}
+	if got := s.correctSpelling("如何部署集群"); got != "如何部署集群" {
+		t.Errorf("correctSpelling() of a language not enabled = %q", got)
+	}
+	s.cfg.Spelling.Enabled = false
+	if got := s.correctSpelling("Kubernets"); got != "Kubernets" {
+		t.Errorf("correctSpelling() when disabled = %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package rag
+
+// markStale compares the file hash stored with each result against the note
+// currently on disk and flags results whose source has changed or vanished.
+// It returns the distinct stale paths in result order.
+func (s *Service) markStale(results []SearchResult) []string {
+	v, err := newVault(s.cfg.VaultPath)
+	if err != nil {
+		return nil
+	}
+	audio := newTranscripts(s.cfg.Transcription, s.storage).withService(s)
+	current := make(map[string]string)
+	seen := make(map[string]bool)
+	var stale []string
+	for idx := range results {
+		r := &results[idx]
+		if r.fileHash == "" || r.Namespace != "" {
+			// Indexed before file hashes were stored, or from an ensemble
+			// collection, whose paths are not vault files; nothing to
+			// compare on disk.
+			continue
+		}
+		hash, ok := current[r.Path]
+		if !ok {
+			if absPath, ok := v.abs(r.Path); ok {
+				if data, err := readNote(ioPath(absPath), audio); err == nil {
+					hash = hashContent([]byte(normalizeText(string(data))))
+				}
+			}
+			current[r.Path] = hash
+		}
+		if hash == r.fileHash {
+			continue
+		}
+		r.Stale = true
+		if !seen[r.Path] {
+			seen[r.Path] = true
+			stale = append(stale, r.Path)
+		}
+	}
+	return stale
+}
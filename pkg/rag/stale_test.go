@@ -0,0 +1,55 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSearchMarksStaleResults(t *testing.T) {
+	vaultDir := t.TempDir()
+	for name, content := range map[string]string{"same.md": "unchanged", "edited.md": "new text"} {
+		if err := os.WriteFile(filepath.Join(vaultDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{vaultDir}
+	cfg.RAG.StaleCheck = true
+	cfg.RAG.ReindexStale = false
+	store := &resultStore{results: []SearchResult{
+		{ID: "1", Path: "same.md", Score: 0.9, fileHash: hashContent([]byte("unchanged"))},
+		{ID: "2", Path: "edited.md", Score: 0.8, fileHash: hashContent([]byte("old text"))},
+		{ID: "3", Path: "edited.md", Score: 0.7, fileHash: hashContent([]byte("old text"))},
+		{ID: "4", Path: "deleted.md", Score: 0.6, fileHash: hashContent([]byte("gone"))},
+		{ID: "5", Path: "legacy.md", Score: 0.5},
+	}}
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+
+	results, err := s.Search(context.Background(), "notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := make(map[string]bool)
+	for _, r := range results {
+		stale[r.ID] = r.Stale
+	}
+	want := map[string]bool{"1": false, "2": true, "3": true, "4": true, "5": false}
+	if !reflect.DeepEqual(stale, want) {
+		t.Errorf("stale flags = %v, want %v", stale, want)
+	}
+
+	paths := s.markStale(append([]SearchResult(nil), store.results...))
+	if !reflect.DeepEqual(paths, []string{"edited.md", "deleted.md"}) {
+		t.Errorf("markStale() = %v, want each stale path once, in result order", paths)
+	}
+}
@@ -2,26 +2,108 @@ package rag
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
-	"path/filepath"
-	"time"
+	"strings"
 )
 
+// chunkerVersion must be bumped whenever chunking or text normalization
+// changes in a way that alters chunk boundaries, content or hashes, or when
+// the stored payload gains fields that search depends on, so that existing
+// indexes are rebuilt on the next run.
+const chunkerVersion = 6
+
+// stateBackupSuffix names the copy of the previous index state.
+const stateBackupSuffix = ".bak"
+
 type indexState struct {
 	Version            int              `json:"version"`
 	UpdatedAt          string           `json:"updated_at"`
 	Collection         string           `json:"collection"`
+	ChunkerVersion     int              `json:"chunker_version"`
 	EmbeddingModel     string           `json:"embedding_model"`
 	EmbeddingDimension int              `json:"embedding_dimension"`
 	ChunkSize          int              `json:"chunk_size"`
 	ChunkOverlap       int              `json:"chunk_overlap"`
+	MinChunkChars      int              `json:"min_chunk_chars"`
 	IncludePatterns    []string         `json:"include_patterns"`
 	ExcludePatterns    []string         `json:"exclude_patterns"`
 	Files              map[string]int64 `json:"files"`
+	// Chunks is the number of chunks written for each file in Files. Files
+	// indexed before it was recorded are missing.
+	Chunks map[string]int `json:"chunks,omitempty"`
+	// RoutedLanguages are the languages owned by language routes when the
+	// index was built. Files in other backends' languages are tracked in
+	// OtherLanguage so unchanged ones are not re-read on every run.
+	RoutedLanguages []string         `json:"routed_languages,omitempty"`
+	OtherLanguage   map[string]int64 `json:"other_language,omitempty"`
+	// BoilerplateRules and BoilerplateLines record what was stripped from
+	// the indexed chunks; a change forces a full reindex.
+	BoilerplateRules []string `json:"boilerplate_rules,omitempty"`
+	BoilerplateLines []string `json:"boilerplate_lines,omitempty"`
+	// Summaries records the settings the summary levels were built with, ""
+	// when there are none. SummariesStale is set when notes changed without
+	// the summaries being rebuilt.
+	Summaries      string `json:"summaries,omitempty"`
+	SummariesStale bool   `json:"summaries_stale,omitempty"`
+	// Documents is set when every note has its rag.two_stage point.
+	Documents bool `json:"documents,omitempty"`
+	// Synonyms identifies the rag.synonyms added to the embedded text; see
+	// indexSynonymsKey.
+	Synonyms string `json:"synonyms,omitempty"`
+	// Shards is the number of shards Files, Chunks and OtherLanguage are
+	// stored in when the vault is large, 0 when they are in this file; see
+	// stateFormatFor.
+	Shards int `json:"shards,omitempty"`
+	// VaultMounts maps the vault folders on encrypted or FUSE mounts to the
+	// mount type; see checkMassDelete.
+	VaultMounts map[string]string `json:"vault_mounts,omitempty"`
+	// IDs maps notes to their document IDs, which stay the same when a note
+	// is renamed or moved; see assignDocID. Moved maps the paths notes had
+	// before such a move to their IDs.
+	IDs   map[string]string `json:"ids,omitempty"`
+	Moved map[string]string `json:"moved,omitempty"`
+}
+
+// trackFile records that path, modified at mtime, is indexed as chunks
+// chunks.
+func (s *indexState) trackFile(path string, mtime int64, chunks int) {
+	s.Files[path] = mtime
+	if s.Chunks == nil {
+		s.Chunks = map[string]int{}
+	}
+	s.Chunks[path] = chunks
+}
+
+// untrackFile forgets path.
+func (s *indexState) untrackFile(path string) {
+	delete(s.Files, path)
+	delete(s.Chunks, path)
 }
 
-func loadIndexState(path string) (*indexState, error) {
-	data, err := os.ReadFile(path)
+// loadIndexState reads the state stored as name. If it is there but cannot
+// be read or parsed, the backup writeIndexState keeps of the previous state is
+// used instead: files changed since are indexed again, which is much cheaper
+// than the full reindex a lost state would cause.
+func loadIndexState(st Storage, name string, log Logger) (*indexState, error) {
+	state, err := readIndexState(st, name, log)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return state, err
+	}
+	backup, backupErr := readIndexState(st, name+stateBackupSuffix, log)
+	if backupErr != nil {
+		return nil, err
+	}
+	log.Warn("Index state unreadable, using the backup", map[string]interface{}{
+		"state": name,
+		"error": err.Error(),
+	})
+	return backup, nil
+}
+
+// readIndexState reads the state stored as name, or the backup of one.
+func readIndexState(st Storage, name string, log Logger) (*indexState, error) {
+	data, err := st.ReadFile(name)
 	if err != nil {
 		return nil, err
 	}
@@ -32,17 +114,64 @@ func loadIndexState(path string) (*indexState, error) {
 	if state.Files == nil {
 		state.Files = map[string]int64{}
 	}
+	if state.OtherLanguage == nil {
+		state.OtherLanguage = map[string]int64{}
+	}
+	main := strings.TrimSuffix(name, stateBackupSuffix)
+	if err := stateFormatOf(&state).readFiles(st, main, &state, log); err != nil {
+		return nil, err
+	}
 	return &state, nil
 }
 
-func saveIndexState(path string, state *indexState) error {
-	state.UpdatedAt = time.Now().Format(time.RFC3339)
-	data, err := json.MarshalIndent(state, "", "  ")
+// writeIndexState saves state as is, keeping its UpdatedAt, in the format
+// stateFormatFor picks; a state in the other format is migrated. The
+// previous state is kept as a backup next to it first.
+func writeIndexState(st Storage, name string, state *indexState, log Logger) error {
+	if err := backupState(st, name, name+stateBackupSuffix, log); err != nil {
+		log.Warn("Failed to back up the index state", map[string]interface{}{
+			"state": name,
+			"error": err.Error(),
+		})
+	}
+	return stateFormatFor(state).write(st, name, state)
+}
+
+// removeIndexState deletes the state stored as name with its backup and
+// shards.
+func removeIndexState(st Storage, name string) error {
+	for _, n := range []string{name, name + stateBackupSuffix, stateShardDir(name)} {
+		if err := st.RemoveAll(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupState replaces backup with the current state stored as name, without
+// a moment where name is missing. The backup is always a single file, shards
+// included, as the shards of name change with the next write. It does nothing
+// when name does not exist or does not parse, so a corrupt state never
+// replaces a good backup.
+func backupState(st Storage, name, backup string, log Logger) error {
+	data, err := st.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return nil
+	}
+	state, err := readIndexState(st, name, log)
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+	state.Shards = 0
+	data, err = json.MarshalIndent(state, "", "  ")
+	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return st.WriteFile(backup, data)
 }
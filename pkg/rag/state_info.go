@@ -0,0 +1,68 @@
+package rag
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// IndexState summarizes how one index was built, as recorded by its last
+// index run.
+type IndexState struct {
+	// Language is the language of the rag.language_routes entry the index
+	// belongs to, "" for the default index.
+	Language           string
+	Collection         string
+	EmbeddingModel     string
+	EmbeddingDimension int
+	ChunkerVersion     int
+	ChunkSize          int
+	ChunkOverlap       int
+	IncludePatterns    []string
+	ExcludePatterns    []string
+	// Files is the number of notes the index tracks. The default index
+	// also counts the notes owned by language routes.
+	Files     int
+	UpdatedAt time.Time
+	// Hierarchical is set when the index has summary levels, and
+	// SummariesStale when notes changed after they were built.
+	Hierarchical   bool
+	SummariesStale bool
+}
+
+// State returns the saved state of the default index followed by that of
+// each language route, without contacting the embedding API or the vector
+// store. It returns ErrIndexNotBuilt when no index run has completed yet;
+// routes that were never indexed are left out.
+func (s *Service) State() ([]IndexState, error) {
+	var out []IndexState
+	for _, b := range s.backends() {
+		state, err := s.newBackendIndexer(b).loadState()
+		if errors.Is(err, os.ErrNotExist) {
+			if b.language == "" {
+				return nil, ErrIndexNotBuilt
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		updated, _ := time.Parse(time.RFC3339, state.UpdatedAt)
+		out = append(out, IndexState{
+			Language:           b.language,
+			Collection:         state.Collection,
+			EmbeddingModel:     state.EmbeddingModel,
+			EmbeddingDimension: state.EmbeddingDimension,
+			ChunkerVersion:     state.ChunkerVersion,
+			ChunkSize:          state.ChunkSize,
+			ChunkOverlap:       state.ChunkOverlap,
+			IncludePatterns:    append([]string(nil), state.IncludePatterns...),
+			ExcludePatterns:    append([]string(nil), state.ExcludePatterns...),
+			Files:              len(state.Files),
+			UpdatedAt:          updated,
+			Hierarchical:       state.Summaries != "",
+			SummariesStale:     state.SummariesStale,
+		})
+	}
+	return out, nil
+}
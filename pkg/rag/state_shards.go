@@ -0,0 +1,196 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"strings"
+)
+
+// stateShardThreshold is the number of tracked files above which the index
+// state is split into shards. Below it a single indented file is simpler to
+// read and diff.
+const stateShardThreshold = 10000
+
+// stateShards is how many shards a large state is split into. Files are
+// assigned by a hash of their path, so an index run that changes a few
+// notes rewrites a few shards instead of the whole state.
+const stateShards = 64
+
+// stateFormat reads and writes the per-file maps of an indexState, which
+// are what grows with the vault. The rest of the state is always stored as
+// the state's name.
+type stateFormat interface {
+	// readFiles fills in the file maps of state, whose header was stored
+	// as name.
+	readFiles(st Storage, name string, state *indexState, log Logger) error
+	// write saves state as name.
+	write(st Storage, name string, state *indexState) error
+}
+
+// stateFormatOf returns the format a state read from disk was saved in.
+func stateFormatOf(header *indexState) stateFormat {
+	if header.Shards > 0 {
+		return shardedState{shards: header.Shards}
+	}
+	return singleFileState{}
+}
+
+// stateFormatFor picks the format to save state in.
+func stateFormatFor(state *indexState) stateFormat {
+	if len(state.Files)+len(state.OtherLanguage) > stateShardThreshold {
+		return shardedState{shards: stateShards}
+	}
+	return singleFileState{}
+}
+
+// singleFileState keeps everything in one JSON file.
+type singleFileState struct{}
+
+func (singleFileState) readFiles(Storage, string, *indexState, Logger) error { return nil }
+
+func (singleFileState) write(st Storage, name string, state *indexState) error {
+	header := *state
+	header.Shards = 0
+	data, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := st.WriteFile(name, data); err != nil {
+		return err
+	}
+	// A state that shrank below the threshold leaves its shards behind.
+	return st.RemoveAll(stateShardDir(name))
+}
+
+// shardedState writes the file maps as compact JSON shards under a name
+// next to the state's, then the header. Each shard is replaced atomically and only
+// when its content changed. Every shard records files that were indexed when
+// it was written, so a crash between shard writes leaves a state that at
+// worst indexes some files again.
+type shardedState struct {
+	shards int
+}
+
+type stateShard struct {
+	Files         map[string]int64  `json:"files,omitempty"`
+	Chunks        map[string]int    `json:"chunks,omitempty"`
+	OtherLanguage map[string]int64  `json:"other_language,omitempty"`
+	IDs           map[string]string `json:"ids,omitempty"`
+}
+
+func stateShardDir(name string) string {
+	return strings.TrimSuffix(name, ".json") + ".shards"
+}
+
+func stateShardPath(dir string, idx int) string {
+	return path.Join(dir, fmt.Sprintf("%03d.json", idx))
+}
+
+func stateShardOf(path string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func (f shardedState) readFiles(st Storage, name string, state *indexState, log Logger) error {
+	dir := stateShardDir(name)
+	for idx := 0; idx < state.Shards; idx++ {
+		data, err := st.ReadFile(stateShardPath(dir, idx))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		var shard stateShard
+		if err == nil {
+			err = json.Unmarshal(data, &shard)
+		}
+		if err != nil {
+			// The files of a lost shard are indexed again on the next run.
+			log.Warn("Index state shard unreadable, skipping it", map[string]interface{}{
+				"shard": stateShardPath(dir, idx),
+				"error": err.Error(),
+			})
+			continue
+		}
+		for p, mtime := range shard.Files {
+			state.Files[p] = mtime
+		}
+		for p, chunks := range shard.Chunks {
+			if state.Chunks == nil {
+				state.Chunks = map[string]int{}
+			}
+			state.Chunks[p] = chunks
+		}
+		for p, mtime := range shard.OtherLanguage {
+			state.OtherLanguage[p] = mtime
+		}
+		for p, id := range shard.IDs {
+			if state.IDs == nil {
+				state.IDs = map[string]string{}
+			}
+			state.IDs[p] = id
+		}
+	}
+	return nil
+}
+
+func (f shardedState) write(st Storage, name string, state *indexState) error {
+	shards := make([]stateShard, f.shards)
+	for p, mtime := range state.Files {
+		s := &shards[stateShardOf(p, f.shards)]
+		if s.Files == nil {
+			s.Files = make(map[string]int64)
+		}
+		s.Files[p] = mtime
+	}
+	for p, chunks := range state.Chunks {
+		s := &shards[stateShardOf(p, f.shards)]
+		if s.Chunks == nil {
+			s.Chunks = make(map[string]int)
+		}
+		s.Chunks[p] = chunks
+	}
+	for p, mtime := range state.OtherLanguage {
+		s := &shards[stateShardOf(p, f.shards)]
+		if s.OtherLanguage == nil {
+			s.OtherLanguage = make(map[string]int64)
+		}
+		s.OtherLanguage[p] = mtime
+	}
+	for p, id := range state.IDs {
+		s := &shards[stateShardOf(p, f.shards)]
+		if s.IDs == nil {
+			s.IDs = make(map[string]string)
+		}
+		s.IDs[p] = id
+	}
+	dir := stateShardDir(name)
+	for idx, shard := range shards {
+		data, err := json.Marshal(shard)
+		if err != nil {
+			return err
+		}
+		shardPath := stateShardPath(dir, idx)
+		if old, err := st.ReadFile(shardPath); err == nil && string(old) == string(data) {
+			continue
+		}
+		if err := st.WriteFile(shardPath, data); err != nil {
+			return err
+		}
+	}
+
+	header := *state
+	header.Shards = f.shards
+	header.Files = map[string]int64{}
+	header.Chunks = nil
+	header.OtherLanguage = nil
+	header.IDs = nil
+	data, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.WriteFile(name, data)
+}
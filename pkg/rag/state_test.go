@@ -0,0 +1,106 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteIndexStateKeepsBackup(t *testing.T) {
+	dir := t.TempDir()
+	st, name := NewLocalStorage(dir), "index_state.json"
+	path := filepath.Join(dir, name)
+	if err := writeIndexState(st, name, &indexState{Collection: "first"}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + stateBackupSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup written for the first state: %v", err)
+	}
+	if err := writeIndexState(st, name, &indexState{Collection: "second"}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	if state, err := loadIndexState(st, name, defaultLogger{}); err != nil || state.Collection != "second" {
+		t.Fatalf("loadIndexState(, defaultLogger{}) = %+v, %v", state, err)
+	}
+
+	// A write cut short by a crash leaves a truncated file.
+	os.WriteFile(path, []byte(`{"collection": "thi`), 0o644)
+	state, err := loadIndexState(st, name, defaultLogger{})
+	if err != nil || state.Collection != "first" || state.Files == nil {
+		t.Errorf("loadIndexState(, defaultLogger{}) of a corrupt state = %+v, %v", state, err)
+	}
+	// The corrupt file must not replace the good backup.
+	if err := writeIndexState(st, name, &indexState{Collection: "third"}, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if backup, _ := readIndexState(st, name+stateBackupSuffix, defaultLogger{}); backup == nil || backup.Collection != "first" {
+		t.Errorf("backup after a corrupt state = %+v", backup)
+	}
+
+	os.Remove(path)
+	if _, err := loadIndexState(st, name, defaultLogger{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("loadIndexState(, defaultLogger{}) of a missing state error = %v", err)
+	}
+}
+
+func TestIndexStateShardsLargeVaults(t *testing.T) {
+	dataDir := t.TempDir()
+	st, name := NewLocalStorage(dataDir), "index_state.json"
+	path := filepath.Join(dataDir, name)
+	state := &indexState{Collection: "notes", Files: map[string]int64{}, OtherLanguage: map[string]int64{"zh/a.md": 7}}
+	for idx := 0; idx <= stateShardThreshold; idx++ {
+		state.Files[fmt.Sprintf("notes/%05d.md", idx)] = int64(idx)
+	}
+	if err := writeIndexState(st, name, state, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	header, err := os.ReadFile(path)
+	if err != nil || len(header) > 1000 {
+		t.Fatalf("header is %d bytes, %v", len(header), err)
+	}
+	loaded, err := loadIndexState(st, name, defaultLogger{})
+	if err != nil || loaded.Shards != stateShards || len(loaded.Files) != stateShardThreshold+1 ||
+		loaded.Files["notes/00042.md"] != 42 || loaded.OtherLanguage["zh/a.md"] != 7 {
+		t.Fatalf("loaded sharded state: %d files, shards %d, %v", len(loaded.Files), loaded.Shards, err)
+	}
+
+	// A change rewrites only the shard holding the file.
+	dir := filepath.Join(dataDir, stateShardDir(name))
+	changed := stateShardOf("notes/00042.md", stateShards)
+	other := (changed + 1) % stateShards
+	os.Chtimes(filepath.Join(dir, fmt.Sprintf("%03d.json", other)), time.Unix(1, 0), time.Unix(1, 0))
+	loaded.Files["notes/00042.md"] = 99
+	if err := writeIndexState(st, name, loaded, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, fmt.Sprintf("%03d.json", other))); !info.ModTime().Equal(time.Unix(1, 0)) {
+		t.Error("unchanged shard was rewritten")
+	}
+	if again, _ := loadIndexState(st, name, defaultLogger{}); again.Files["notes/00042.md"] != 99 {
+		t.Errorf("changed mtime = %d", again.Files["notes/00042.md"])
+	}
+
+	// Shrinking below the threshold migrates back to a single file.
+	small := &indexState{Collection: "notes", Files: map[string]int64{"a.md": 1}}
+	if err := writeIndexState(st, name, small, defaultLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("shards left after migrating back: %v", err)
+	}
+	if loaded, _ := loadIndexState(st, name, defaultLogger{}); loaded.Shards != 0 || len(loaded.Files) != 1 {
+		t.Errorf("loaded single-file state = %+v", loaded)
+	}
+	// The backup of the sharded state holds its files without the shards.
+	os.WriteFile(path, []byte(`{"collection": "no`), 0o644)
+	if backup, err := loadIndexState(st, name, defaultLogger{}); err != nil || backup.Shards != 0 ||
+		len(backup.Files) != stateShardThreshold+1 || backup.Files["notes/00042.md"] != 99 {
+		t.Errorf("backup of the sharded state: %d files, shards %d, %v", len(backup.Files), backup.Shards, err)
+	}
+}
@@ -0,0 +1,196 @@
+package rag
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage holds the service's bookkeeping: index state, index reports,
+// caches such as transcripts and summaries, and the query log. Names are
+// slash-separated paths such as "index_state.json" or "transcripts/<hash>.md".
+// The default keeps them as files in the RAG data directory; embedded users
+// can set their own with Service.SetStorage. The notes, including the
+// mirrors of remote vaults, are always read from the file system.
+type Storage interface {
+	// ReadFile returns an error matching fs.ErrNotExist when name is
+	// missing.
+	ReadFile(name string) ([]byte, error)
+	// WriteFile replaces name so that it holds either the old or the new
+	// data, even after a crash.
+	WriteFile(name string, data []byte) error
+	// AppendFile adds data to the end of name, creating it if needed.
+	AppendFile(name string, data []byte) error
+	Stat(name string) (fs.FileInfo, error)
+	Rename(oldName, newName string) error
+	// RemoveAll removes name and everything under it; a missing name is
+	// not an error.
+	RemoveAll(name string) error
+}
+
+// SetStorage replaces where the service keeps its bookkeeping, by default the
+// RAG data directory. Call it before the first index run or search; what is
+// in the old storage is not copied.
+func (s *Service) SetStorage(st Storage) {
+	s.storage = st
+}
+
+// NewLocalStorage keeps the bookkeeping in files under dir.
+func NewLocalStorage(dir string) Storage {
+	return localStorage{dir: dir}
+}
+
+type localStorage struct {
+	dir string
+}
+
+func (l localStorage) path(name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(name))
+}
+
+func (l localStorage) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(l.path(name))
+}
+
+func (l localStorage) WriteFile(name string, data []byte) error {
+	return writeFileAtomic(l.path(name), data)
+}
+
+// writePrivateFile is st.WriteFile for files holding personal data, which
+// the default storage keeps readable by their owner only, like the query log.
+func writePrivateFile(st Storage, name string, data []byte) error {
+	if l, ok := st.(localStorage); ok {
+		return writeFileAtomicPerm(l.path(name), data, 0o600)
+	}
+	return st.WriteFile(name, data)
+}
+
+func (l localStorage) AppendFile(name string, data []byte) error {
+	p := l.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l localStorage) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(l.path(name))
+}
+
+func (l localStorage) Rename(oldName, newName string) error {
+	return os.Rename(l.path(oldName), l.path(newName))
+}
+
+func (l localStorage) RemoveAll(name string) error {
+	return os.RemoveAll(l.path(name))
+}
+
+// NewMemoryStorage keeps the bookkeeping in memory, for tests and for
+// services that should leave nothing on disk.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{files: make(map[string]*memoryFile)}
+}
+
+type memoryStorage struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+}
+
+type memoryFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+func (m *memoryStorage) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *memoryStorage) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	m.files[name] = &memoryFile{name: path.Base(name), data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (m *memoryStorage) AppendFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	f, ok := m.files[name]
+	if !ok {
+		f = &memoryFile{name: path.Base(name)}
+		m.files[name] = f
+	}
+	f.data = append(f.data, data...)
+	f.modTime = time.Now()
+	return nil
+}
+
+func (m *memoryStorage) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memoryFileInfo{name: f.name, size: int64(len(f.data)), modTime: f.modTime}, nil
+}
+
+func (m *memoryStorage) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldName, newName = path.Clean(oldName), path.Clean(newName)
+	f, ok := m.files[oldName]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldName)
+	f.name = path.Base(newName)
+	m.files[newName] = f
+	return nil
+}
+
+func (m *memoryStorage) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	for n := range m.files {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			delete(m.files, n)
+		}
+	}
+	return nil
+}
+
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) Mode() fs.FileMode  { return 0o600 }
+func (i memoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i memoryFileInfo) IsDir() bool        { return false }
+func (i memoryFileInfo) Sys() interface{}   { return nil }
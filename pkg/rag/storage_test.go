@@ -0,0 +1,69 @@
+package rag
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	st := NewMemoryStorage()
+	if _, err := st.ReadFile("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile() of a missing name error = %v", err)
+	}
+	if _, err := st.Stat("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat() of a missing name error = %v", err)
+	}
+
+	st.AppendFile("log.jsonl", []byte("a\n"))
+	st.AppendFile("log.jsonl", []byte("b\n"))
+	if info, err := st.Stat("log.jsonl"); err != nil || info.Size() != 4 || info.Name() != "log.jsonl" {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if err := st.Rename("log.jsonl", "log.jsonl.1"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := st.ReadFile("log.jsonl.1"); err != nil || string(data) != "a\nb\n" {
+		t.Errorf("ReadFile() after Rename() = %q, %v", data, err)
+	}
+
+	st.WriteFile("transcripts/a.md", []byte("a"))
+	st.WriteFile("transcripts/b.md", []byte("b"))
+	st.WriteFile("transcripts.json", []byte("{}"))
+	if err := st.RemoveAll("transcripts"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ReadFile("transcripts/a.md"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RemoveAll() kept transcripts/a.md: %v", err)
+	}
+	if _, err := st.ReadFile("transcripts.json"); err != nil {
+		t.Errorf("RemoveAll() removed a sibling: %v", err)
+	}
+	if err := st.RemoveAll("missing"); err != nil {
+		t.Errorf("RemoveAll() of a missing name error = %v", err)
+	}
+}
+
+func TestServiceWithMemoryStorage(t *testing.T) {
+	s := newRunnerTestService(t, t.TempDir(), t.TempDir())
+	st := NewMemoryStorage()
+	s.SetStorage(st)
+
+	idx := s.newBackendIndexer(s.backends()[0])
+	if err := idx.saveState(&indexState{Collection: "notes", Files: map[string]int64{"a.md": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := idx.loadState()
+	if err != nil || state.Files["a.md"] != 1 {
+		t.Fatalf("loadState() = %+v, %v", state, err)
+	}
+	if _, err := st.ReadFile(idx.stateName()); err != nil {
+		t.Errorf("state not kept in the storage: %v", err)
+	}
+	if err := saveIndexReport(s.storage, &IndexReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndexReport(s.dataDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("report written to the data directory: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package rag
+
+import "context"
+
+// VectorStore is the subset of vector database operations used by indexing
+// and retrieval. QdrantClient is the default implementation.
+type VectorStore interface {
+	Collection() string
+	EnsureCollection(ctx context.Context, dimension int, recreate bool) error
+	Upsert(ctx context.Context, points []QdrantPoint) error
+	DeleteByPath(ctx context.Context, path string) error
+	Search(ctx context.Context, query StoreQuery) ([]SearchResult, error)
+	// SearchBatch runs several searches in a single round trip. The result
+	// slice is aligned with queries.
+	SearchBatch(ctx context.Context, queries []StoreQuery) ([][]SearchResult, error)
+	// Recommend returns points similar to the given point IDs, excluding them.
+	Recommend(ctx context.Context, positiveIDs []string, limit int, minSimilarity float64) ([]SearchResult, error)
+	// Ping checks that the store is reachable.
+	Ping(ctx context.Context) error
+}
+
+// StoreQuery is a single nearest-neighbour lookup against a VectorStore.
+type StoreQuery struct {
+	Vector        []float64
+	Limit         int
+	Offset        int
+	MinSimilarity float64
+	Filter        SearchFilter
+	// Documents searches the per-note vectors of rag.two_stage instead of
+	// the chunks.
+	Documents bool
+}
+
+var _ VectorStore = (*QdrantClient)(nil)
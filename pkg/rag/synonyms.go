@@ -0,0 +1,128 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// synonymExpander adds the rag.synonyms expansion after each shorthand term
+// in a text, e.g. "k8s upgrade" becomes "k8s (kubernetes) upgrade", so the
+// embedding carries both forms.
+type synonymExpander struct {
+	re         *regexp.Regexp
+	expansions map[string]string
+}
+
+func newSynonymExpander(synonyms map[string]string) (*synonymExpander, error) {
+	if len(synonyms) == 0 {
+		return nil, nil
+	}
+	e := &synonymExpander{expansions: make(map[string]string, len(synonyms))}
+	terms := make([]string, 0, len(synonyms))
+	for term, expansion := range synonyms {
+		term, expansion = strings.TrimSpace(term), strings.TrimSpace(expansion)
+		if term == "" || expansion == "" {
+			return nil, fmt.Errorf("rag.synonyms: %q needs both a term and an expansion", term)
+		}
+		e.expansions[strings.ToLower(term)] = expansion
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	// Longer terms first, so "k8s api" wins over "k8s".
+	sort.Slice(terms, func(a, b int) bool {
+		if len(terms[a]) != len(terms[b]) {
+			return len(terms[a]) > len(terms[b])
+		}
+		return terms[a] < terms[b]
+	})
+	e.re = regexp.MustCompile(`(?i)` + strings.Join(terms, "|"))
+	return e, nil
+}
+
+// expand returns text with the expansion of a term added after its first
+// occurrence. Terms only match whole words, except at edges written in a
+// script without spaces, and a term whose expansion already appears in the
+// text is left alone.
+func (e *synonymExpander) expand(text string) string {
+	if e == nil {
+		return text
+	}
+	lower := strings.ToLower(text)
+	done := make(map[string]bool)
+	var out strings.Builder
+	last := 0
+	for _, m := range e.re.FindAllStringIndex(text, -1) {
+		start, end := m[0], m[1]
+		if !wordEdge(text, start, true) || !wordEdge(text, end, false) {
+			continue
+		}
+		expansion := e.expansions[strings.ToLower(text[start:end])]
+		if expansion == "" || done[expansion] || strings.Contains(lower, strings.ToLower(expansion)) {
+			continue
+		}
+		done[expansion] = true
+		out.WriteString(text[last:end])
+		out.WriteString(" (" + expansion + ")")
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// has reports whether a lowercase term is defined.
+func (e *synonymExpander) has(term string) bool {
+	if e == nil {
+		return false
+	}
+	_, ok := e.expansions[term]
+	return ok
+}
+
+// rewriteQuery fixes typos (rag.spelling) and then adds the rag.synonyms
+// expansions to a query before it is embedded. Shorthand terms are never
+// spell-corrected.
+func (s *Service) rewriteQuery(query string) string {
+	return s.synonyms.expand(s.correctSpelling(query))
+}
+
+// wordEdge reports whether a match may start (or end) at offset: the runes
+// on either side must not both be letters or digits of a spaced script.
+func wordEdge(text string, offset int, start bool) bool {
+	if offset == 0 || offset == len(text) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:offset])
+	after, _ := utf8.DecodeRuneInString(text[offset:])
+	inner, outer := after, before
+	if !start {
+		inner, outer = before, after
+	}
+	return !isSpacedWordRune(inner) || !isSpacedWordRune(outer)
+}
+
+func isSpacedWordRune(r rune) bool {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// indexSynonymsKey identifies the synonyms applied to indexed text, or is ""
+// when rag.synonyms_in_index is off. A change forces a full reindex.
+func indexSynonymsKey(cfg map[string]string, inIndex bool) string {
+	if !inIndex || len(cfg) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(cfg))
+	for term, expansion := range cfg {
+		pairs = append(pairs, strings.ToLower(strings.TrimSpace(term))+"="+strings.TrimSpace(expansion))
+	}
+	sort.Strings(pairs)
+	return hashContent([]byte(strings.Join(pairs, "\n")))
+}
@@ -0,0 +1,44 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSynonymExpander(t *testing.T) {
+	e, err := newSynonymExpander(map[string]string{"k8s": "kubernetes", "PR": "pull request", "k8s api": "kubernetes API server", "医保": "医疗保险"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"how do I upgrade k8s?":          "how do I upgrade k8s (kubernetes)?",
+		"K8S API limits":                 "K8S API (kubernetes API server) limits",
+		"review the pr and the PR notes": "review the pr (pull request) and the PR notes",
+		"april sprint":                   "april sprint",
+		"kubernetes vs k8s":              "kubernetes vs k8s",
+		"今年医保报销":                         "今年医保 (医疗保险)报销",
+	}
+	for in, want := range tests {
+		if got := e.expand(in); got != want {
+			t.Errorf("expand(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := newSynonymExpander(map[string]string{"k8s": " "}); err == nil {
+		t.Error("expected an error for an empty expansion")
+	}
+}
+
+func TestReindexReasonSynonyms(t *testing.T) {
+	cfg := config.DefaultConfig().RAG
+	state := &indexState{ChunkerVersion: chunkerVersion, EmbeddingModel: "m", ChunkSize: cfg.ChunkSize, ChunkOverlap: cfg.ChunkOverlap,
+		MinChunkChars: cfg.MinChunkChars, IncludePatterns: cfg.IncludePatterns, ExcludePatterns: cfg.ExcludePatterns, Collection: "notes"}
+	cfg.Synonyms = map[string]string{"k8s": "kubernetes"}
+	if reason := reindexReason(state, cfg, "m", "notes"); reason != "" {
+		t.Errorf("query-only synonyms should not reindex, got %q", reason)
+	}
+	cfg.SynonymsInIndex = true
+	if reason := reindexReason(state, cfg, "m", "notes"); reason != "synonyms changed" {
+		t.Errorf("reindexReason() = %q", reason)
+	}
+}
@@ -0,0 +1,254 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// errNotTranscribed is returned when an audio note is read without a
+// transcript, either because transcription is off or it has not run yet.
+var errNotTranscribed = errors.New("audio note has not been transcribed")
+
+var audioExtensions = map[string]bool{
+	".mp3": true, ".m4a": true, ".wav": true, ".ogg": true, ".oga": true,
+	".opus": true, ".webm": true, ".flac": true, ".mpga": true,
+}
+
+func isAudioFile(name string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// transcripts turns audio notes into markdown transcripts, one line per
+// segment prefixed with its time span, e.g. "[01:05-01:12] text". Transcripts
+// are cached in storage by the SHA-256 of the audio, so an unchanged recording
+// is never sent twice, even after it is moved or renamed.
+type transcripts struct {
+	cfg        config.RagTranscriptionConfig
+	storage    Storage
+	httpClient *http.Client
+	log        Logger
+}
+
+// newTranscripts returns nil when transcription is off.
+func newTranscripts(cfg config.RagTranscriptionConfig, storage Storage) *transcripts {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &transcripts{
+		cfg:        cfg,
+		storage:    storage,
+		httpClient: newHTTPClient(10*time.Second, 10*time.Second, defaultHTTPTuning),
+		log:        defaultLogger{},
+	}
+}
+
+// withService points t, which may be nil, at the logger and HTTP client of s.
+func (t *transcripts) withService(s *Service) *transcripts {
+	if t == nil {
+		return nil
+	}
+	t.log = s.log
+	if s.httpClient != nil {
+		t.httpClient = s.httpClient
+	}
+	return t
+}
+
+func validateTranscription(cfg config.RagTranscriptionConfig) error {
+	if cfg.Enabled && cfg.APIBase == "" {
+		return fmt.Errorf("rag.transcription.api_base is required")
+	}
+	return nil
+}
+
+// cacheName returns the name the transcript of the audio file at path is
+// stored as.
+func (t *transcripts) cacheName(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "transcripts/" + hex.EncodeToString(h.Sum(nil)) + ".md", nil
+}
+
+// read returns the cached transcript of the audio file at path.
+func (t *transcripts) read(path string) ([]byte, error) {
+	if t == nil {
+		return nil, errNotTranscribed
+	}
+	cached, err := t.cacheName(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.storage.ReadFile(cached)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotTranscribed
+	}
+	return data, err
+}
+
+// ensure transcribes the audio file at path unless its transcript is cached.
+func (t *transcripts) ensure(ctx context.Context, path string) error {
+	cached, err := t.cacheName(path)
+	if err != nil {
+		return err
+	}
+	if _, err := t.storage.Stat(cached); err == nil {
+		return nil
+	}
+	start := time.Now()
+	result, err := t.transcribe(ctx, path)
+	if err != nil {
+		return err
+	}
+	t.log.Info("Transcribed audio note", map[string]interface{}{
+		"path":     path,
+		"segments": len(result.Segments),
+		"elapsed":  time.Since(start).String(),
+	})
+	return t.storage.WriteFile(cached, []byte(transcriptMarkdown(path, result)))
+}
+
+type transcription struct {
+	Text     string `json:"text"`
+	Segments []struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+}
+
+// transcribe sends the file to the /audio/transcriptions endpoint and asks
+// for segment timestamps.
+func (t *transcripts) transcribe(ctx context.Context, path string) (*transcription, error) {
+	audio, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	part.Write(audio)
+	fields := [][2]string{
+		{"model", t.cfg.Model},
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+	}
+	if t.cfg.Language != "" {
+		fields = append(fields, [2]string{"language", t.cfg.Language})
+	}
+	for _, f := range fields {
+		if err := writer.WriteField(f[0], f[1]); err != nil {
+			return nil, fmt.Errorf("failed to write %s field: %w", f[0], err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, secondsOrDefault(t.cfg.TimeoutSeconds, 300))
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, "POST", strings.TrimRight(t.cfg.APIBase, "/")+"/audio/transcriptions", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcription request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if t.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.APIKey)
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcription response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderError("transcription", resp, data)
+	}
+	var result transcription
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse transcription response: %w", err)
+	}
+	return &result, nil
+}
+
+// transcriptMarkdown renders a transcript under a heading named after the
+// recording. Servers that return no segments get the text without times.
+func transcriptMarkdown(path string, result *transcription) string {
+	var sb strings.Builder
+	sb.WriteString("# " + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "\n\n")
+	if len(result.Segments) == 0 {
+		sb.WriteString(strings.TrimSpace(result.Text) + "\n")
+		return sb.String()
+	}
+	for _, seg := range result.Segments {
+		text := strings.Join(strings.Fields(seg.Text), " ")
+		if text == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("[%s-%s] %s\n", formatTimestamp(seg.Start), formatTimestamp(seg.End), text))
+	}
+	return sb.String()
+}
+
+// formatTimestamp renders seconds as m:ss, or h:mm:ss from an hour on.
+func formatTimestamp(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+var transcriptLine = regexp.MustCompile(`(?m)^\[([0-9:]+)-([0-9:]+)\] `)
+
+// transcriptSpan returns the time span, in seconds, of the transcript lines
+// in a chunk.
+func transcriptSpan(content string) (start, end int, ok bool) {
+	matches := transcriptLine.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return 0, 0, false
+	}
+	start, okStart := parseTimestamp(matches[0][1])
+	end, okEnd := parseTimestamp(matches[len(matches)-1][2])
+	return start, end, okStart && okEnd
+}
+
+func parseTimestamp(s string) (int, bool) {
+	total := 0
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+		total = total*60 + n
+	}
+	return total, true
+}
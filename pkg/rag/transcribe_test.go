@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestTranscriptsCacheByContent(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer k" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.FormValue("model") != "whisper-1" || r.FormValue("response_format") != "verbose_json" || r.FormValue("language") != "de" {
+			t.Errorf("form = %v", r.Form)
+		}
+		if _, header, err := r.FormFile("file"); err != nil || header.Filename != "memo.m4a" {
+			t.Errorf("file = %v, %v", header, err)
+		}
+		fmt.Fprint(w, `{"text":"x","segments":[{"start":0,"end":4.2,"text":" Buy milk. "},{"start":65,"end":3725,"text":"Call  Ann."}]}`)
+	}))
+	defer srv.Close()
+
+	dataDir := t.TempDir()
+	audio := newTranscripts(config.RagTranscriptionConfig{
+		Enabled: true, APIBase: srv.URL + "/v1/", APIKey: "k", Model: "whisper-1", Language: "de",
+	}, NewLocalStorage(dataDir))
+	vault := t.TempDir()
+	memo := filepath.Join(vault, "memo.m4a")
+	os.WriteFile(memo, []byte("audio bytes"), 0644)
+
+	if _, err := readNote(memo, audio); !errors.Is(err, errNotTranscribed) {
+		t.Errorf("readNote() before transcription error = %v", err)
+	}
+	if err := audio.ensure(t.Context(), memo); err != nil {
+		t.Fatalf("ensure() error: %v", err)
+	}
+	// The same recording under another name reuses the transcript.
+	copied := filepath.Join(vault, "copy.m4a")
+	os.WriteFile(copied, []byte("audio bytes"), 0644)
+	if err := audio.ensure(t.Context(), copied); err != nil || calls != 1 {
+		t.Errorf("ensure() of a copy = %v after %d calls, want the cached transcript", err, calls)
+	}
+
+	got, err := readNote(memo, audio)
+	if err != nil {
+		t.Fatalf("readNote() error: %v", err)
+	}
+	want := "# memo\n\n[00:00-00:04] Buy milk.\n[01:05-1:02:05] Call Ann.\n"
+	if string(got) != want {
+		t.Errorf("transcript = %q, want %q", got, want)
+	}
+	if start, end, ok := transcriptSpan(string(got)); !ok || start != 0 || end != 3725 {
+		t.Errorf("transcriptSpan() = %d, %d, %v", start, end, ok)
+	}
+	if _, err := readNote(memo, nil); !errors.Is(err, errNotTranscribed) {
+		t.Errorf("readNote() without transcription error = %v", err)
+	}
+}
+
+func TestAudioNotesListedWhenTranscribing(t *testing.T) {
+	if isNoteFile("memo.MP3", noteFormats{}) || !isNoteFile("memo.MP3", noteFormats{Audio: true}) {
+		t.Error("audio files should be listed only with transcription enabled")
+	}
+	r := SearchResult{Path: "memo.m4a", Heading: "memo", StartLine: 3, EndLine: 4, AudioStart: 65, AudioEnd: 130}
+	if got := FormatSource(r); got != "memo.m4a#memo @01:05-02:10" {
+		t.Errorf("FormatSource() = %q", got)
+	}
+	if err := validateTranscription(config.RagTranscriptionConfig{Enabled: true}); err == nil {
+		t.Error("validateTranscription() accepted a missing api_base")
+	}
+}
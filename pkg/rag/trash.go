@@ -0,0 +1,268 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+const (
+	trashDir       = "trash"
+	trashIndexFile = trashDir + "/index.json"
+	// trashUpsertBatch is the number of points restored per request.
+	trashUpsertBatch = 128
+)
+
+// Reasons points went to the trash.
+const (
+	TrashRemoved = "removed"
+	TrashChanged = "changed"
+)
+
+// TrashEntry describes the points of a note kept in the trash of
+// rag.trash. Only the latest deletion of each note is kept.
+type TrashEntry struct {
+	Path       string    `json:"path"`
+	Collection string    `json:"collection"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	// Reason is TrashRemoved when the note left the vault and TrashChanged
+	// when it was indexed again.
+	Reason string `json:"reason"`
+	// MTime is the note's modification time when the points were written.
+	MTime  int64 `json:"mtime"`
+	Points int   `json:"points"`
+	// File names the storage file holding the points.
+	File string `json:"file"`
+}
+
+type trashFile struct {
+	Entry  TrashEntry    `json:"entry"`
+	Points []QdrantPoint `json:"points"`
+}
+
+// pathPointReader is implemented by vector stores whose points can be read
+// back, which the trash needs; others delete without it.
+type pathPointReader interface {
+	pointsByPath(ctx context.Context, path string) ([]QdrantPoint, error)
+}
+
+// pointsByPath returns every point of a note, with its vector.
+func (c *QdrantClient) pointsByPath(ctx context.Context, path string) ([]QdrantPoint, error) {
+	filter := map[string]interface{}{
+		"must": []map[string]interface{}{
+			{
+				"key": "path",
+				"match": map[string]interface{}{
+					"value": path,
+				},
+			},
+		},
+	}
+	var points []QdrantPoint
+	var offset interface{}
+	for {
+		page, next, err := c.scroll(ctx, filter, offset, 256)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, page...)
+		if next == nil {
+			return points, nil
+		}
+		offset = next
+	}
+}
+
+// deletePath removes the points of a note from the store. Under rag.trash
+// the points of a note the index tracks are first copied to the trash; when
+// that fails the note is deleted anyway, as a failed trash must not stop
+// the index from following the vault.
+func (i *indexer) deletePath(ctx context.Context, state *indexState, path, reason string) error {
+	if mtime, ok := state.Files[path]; ok && i.cfg.Trash.Enabled {
+		if err := i.trashPath(ctx, path, mtime, reason); err != nil {
+			i.log.Warn("Failed to move deleted points to the trash", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		}
+	}
+	return i.store.DeleteByPath(ctx, path)
+}
+
+func (i *indexer) trashPath(ctx context.Context, path string, mtime int64, reason string) error {
+	reader, ok := i.store.(pathPointReader)
+	if !ok {
+		return nil
+	}
+	points, err := reader.pointsByPath(ctx, path)
+	if err != nil || len(points) == 0 {
+		return err
+	}
+	collection := i.store.Collection()
+	entry := TrashEntry{
+		Path:       path,
+		Collection: collection,
+		DeletedAt:  i.now().UTC(),
+		Reason:     reason,
+		MTime:      mtime,
+		Points:     len(points),
+		File:       trashDir + "/" + hashContent([]byte(collection + "\x00" + path))[:16] + ".json",
+	}
+	data, err := json.Marshal(trashFile{Entry: entry, Points: points})
+	if err != nil {
+		return err
+	}
+	if err := i.storage.WriteFile(entry.File, data); err != nil {
+		return err
+	}
+
+	entries, err := loadTrash(i.storage)
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Collection == collection && e.Path == path {
+			continue
+		}
+		if trashExpired(e, i.cfg.Trash.RetentionDays, i.now()) {
+			_ = i.storage.RemoveAll(e.File)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return saveTrash(i.storage, append(kept, entry))
+}
+
+// trashExpired reports whether an entry is older than retention_days; 0
+// keeps entries until the note is deleted again.
+func trashExpired(e TrashEntry, days int, now time.Time) bool {
+	return days > 0 && now.Sub(e.DeletedAt) > time.Duration(days)*24*time.Hour
+}
+
+func loadTrash(st Storage) ([]TrashEntry, error) {
+	data, err := st.ReadFile(trashIndexFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", trashIndexFile, err)
+	}
+	return entries, nil
+}
+
+func saveTrash(st Storage, entries []TrashEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.WriteFile(trashIndexFile, data)
+}
+
+// Trash lists the notes whose points can still be restored with
+// UndoDelete, most recently deleted first.
+func (s *Service) Trash() ([]TrashEntry, error) {
+	entries, err := loadTrash(s.storage)
+	if err != nil {
+		return nil, err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !trashExpired(e, s.cfg.Trash.RetentionDays, s.now()) {
+			kept = append(kept, e)
+		}
+	}
+	sort.Slice(kept, func(a, b int) bool {
+		return kept[a].DeletedAt.After(kept[b].DeletedAt)
+	})
+	return kept, nil
+}
+
+// UndoDelete puts the trashed points of a note back in place of whatever the
+// index holds for it now, without embedding anything, and returns how many
+// points were restored. The index state records the note as it was when
+// the points were written: if the note is back in the vault unchanged, the
+// next index run keeps the points; if it differs, the run indexes it again;
+// if it is still missing, the run removes it again.
+func (s *Service) UndoDelete(ctx context.Context, path string) (int, error) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	entries, err := loadTrash(s.storage)
+	if err != nil {
+		return 0, err
+	}
+	restored := 0
+	var done []string
+	kept := entries[:0]
+	for _, e := range entries {
+		b := s.backendForCollection(e.Collection)
+		if e.Path != path || b == nil || trashExpired(e, s.cfg.Trash.RetentionDays, s.now()) {
+			kept = append(kept, e)
+			continue
+		}
+		n, err := s.newBackendIndexer(b).restoreTrash(ctx, e)
+		if err != nil {
+			return restored, err
+		}
+		restored += n
+		done = append(done, e.File)
+	}
+	if restored == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNotInTrash, path)
+	}
+	if err := saveTrash(s.storage, kept); err != nil {
+		return restored, err
+	}
+	for _, name := range done {
+		_ = s.storage.RemoveAll(name)
+	}
+	return restored, nil
+}
+
+func (s *Service) backendForCollection(name string) *backend {
+	for _, b := range s.backends() {
+		if b.store.Collection() == name {
+			return b
+		}
+	}
+	return nil
+}
+
+func (i *indexer) restoreTrash(ctx context.Context, e TrashEntry) (int, error) {
+	data, err := i.storage.ReadFile(e.File)
+	if err != nil {
+		return 0, err
+	}
+	var trashed trashFile
+	if err := json.Unmarshal(data, &trashed); err != nil {
+		return 0, fmt.Errorf("parse %s: %w", e.File, err)
+	}
+	state, err := i.loadState()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrIndexNotBuilt, err)
+	}
+	if err := i.store.DeleteByPath(ctx, e.Path); err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(trashed.Points); start += trashUpsertBatch {
+		end := min(start+trashUpsertBatch, len(trashed.Points))
+		if err := i.store.Upsert(ctx, trashed.Points[start:end]); err != nil {
+			return 0, err
+		}
+	}
+	state.trackFile(e.Path, e.MTime, len(trashed.Points))
+	delete(state.OtherLanguage, e.Path)
+	if err := i.saveState(state); err != nil {
+		return 0, err
+	}
+	return len(trashed.Points), nil
+}
@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// pathStore keeps points by note path and can read them back.
+type pathStore struct {
+	VectorStore
+	points map[string][]QdrantPoint
+}
+
+func (s *pathStore) Collection() string { return "notes" }
+func (s *pathStore) DeleteByPath(_ context.Context, path string) error {
+	delete(s.points, path)
+	return nil
+}
+func (s *pathStore) Upsert(_ context.Context, points []QdrantPoint) error {
+	for _, p := range points {
+		path := p.Payload["path"].(string)
+		s.points[path] = append(s.points[path], p)
+	}
+	return nil
+}
+func (s *pathStore) pointsByPath(_ context.Context, path string) ([]QdrantPoint, error) {
+	return s.points[path], nil
+}
+
+func TestTrashAndUndoDelete(t *testing.T) {
+	store := &pathStore{points: map[string][]QdrantPoint{}}
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.VaultPath = config.VaultPaths{t.TempDir()}
+	cfg.RAG.Trash.Enabled = true
+	s, err := NewService(cfg, t.TempDir(), WithEmbedder(fixedEmbedder{}), WithVectorStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetStorage(NewMemoryStorage())
+	ctx := context.Background()
+	store.Upsert(ctx, []QdrantPoint{
+		{ID: "1", Vector: []float64{1, 0}, Payload: map[string]interface{}{"path": "a.md", "content": "alpha"}},
+		{ID: "2", Vector: []float64{0, 1}, Payload: map[string]interface{}{"path": "a.md", "content": "beta"}},
+	})
+
+	i := s.newBackendIndexer(s.backends()[0])
+	state := &indexState{Files: map[string]int64{"a.md": 42}, OtherLanguage: map[string]int64{}}
+	if err := i.deletePath(ctx, state, "a.md", TrashRemoved); err != nil {
+		t.Fatal(err)
+	}
+	state.untrackFile("a.md")
+	if err := i.saveState(state); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.points["a.md"]) != 0 {
+		t.Fatal("points not deleted")
+	}
+
+	entries, err := s.Trash()
+	if err != nil || len(entries) != 1 || entries[0].Points != 2 || entries[0].Reason != TrashRemoved {
+		t.Fatalf("Trash() = %+v, %v", entries, err)
+	}
+	restored, err := s.UndoDelete(ctx, "a.md")
+	if err != nil || restored != 2 {
+		t.Fatalf("UndoDelete() = %d, %v", restored, err)
+	}
+	if len(store.points["a.md"]) != 2 || store.points["a.md"][1].Vector[1] != 1 {
+		t.Errorf("restored points = %+v", store.points["a.md"])
+	}
+	state, _ = i.loadState()
+	if state.Files["a.md"] != 42 || state.Chunks["a.md"] != 2 {
+		t.Errorf("state after undo: mtime %d, chunks %d", state.Files["a.md"], state.Chunks["a.md"])
+	}
+	if _, err := s.UndoDelete(ctx, "a.md"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("second UndoDelete() = %v", err)
+	}
+
+	// Notes the index does not track, or deleted with the trash off, are
+	// not kept.
+	i.deletePath(ctx, state, "b.md", TrashRemoved)
+	i.cfg.Trash.Enabled = false
+	i.deletePath(ctx, state, "a.md", TrashChanged)
+	if entries, _ := s.Trash(); len(entries) != 0 {
+		t.Errorf("Trash() = %+v", entries)
+	}
+}
+
+func TestTrashExpired(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	e := TrashEntry{DeletedAt: now.Add(-8 * 24 * time.Hour)}
+	if !trashExpired(e, 7, now) || trashExpired(e, 9, now) || trashExpired(e, 0, now) {
+		t.Error("trashExpired() does not follow retention_days")
+	}
+}
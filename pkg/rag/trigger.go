@@ -1,7 +1,9 @@
 package rag
 
 import (
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/config"
 )
@@ -12,6 +14,55 @@ type TriggerDecision struct {
 	Forced         bool
 	Skipped        bool
 	MatchedKeyword string
+	// Filter scopes the search, e.g. to the tags named in a tag trigger.
+	Filter SearchFilter
+	// NoHit is what to do when the search finds nothing, after the retry of
+	// rag.no_hit.behavior if any: NoHitSilent (answer without notes) or
+	// NoHitNotifyUser (say nothing was found). Service.TriggerDecision sets
+	// it when ShouldSearch is.
+	NoHit string
+	// Pins are the notes named by pin: terms, removed from CleanedMessage,
+	// to include along with those of rag.pinned (see Service.Pinned).
+	Pins []string
+	// Directives come from a force prefix such as "kb/en:" and apply to the
+	// answer rather than the search.
+	Directives ResponseDirectives
+	// Route is where rag.router sent the message, RouteVault, RouteWeb or
+	// RouteDirect, and RouteMethod and RouteReason how it decided. They are
+	// set by Service.Route with the router on.
+	Route       string
+	RouteMethod string
+	RouteReason string
+}
+
+// ResponseDirectives shape the answer to a message.
+type ResponseDirectives struct {
+	// Language is the code of the language to answer in, e.g. "en",
+	// whatever the language of the question or the notes.
+	Language string
+}
+
+// languageNames names the languages of the common response directives.
+var languageNames = map[string]string{
+	"en": "English", "zh": "Chinese", "ja": "Japanese", "ko": "Korean", "ru": "Russian",
+	"de": "German", "fr": "French", "es": "Spanish", "pt": "Portuguese", "it": "Italian",
+}
+
+// Instruction returns the directives as an instruction for the model, or ""
+// when there are none.
+func (d ResponseDirectives) Instruction() string {
+	if d.Language == "" {
+		return ""
+	}
+	base, _, _ := strings.Cut(d.Language, "-")
+	name := languageNames[base]
+	switch {
+	case name == "":
+		name = "the language with code " + d.Language
+	case base != d.Language:
+		name += " (" + d.Language + ")"
+	}
+	return "Answer in " + name + ", even if the notes or the question are in another language."
 }
 
 func DecideTrigger(message string, cfg config.RagTriggerConfig) TriggerDecision {
@@ -20,6 +71,30 @@ func DecideTrigger(message string, cfg config.RagTriggerConfig) TriggerDecision
 		return TriggerDecision{CleanedMessage: message}
 	}
 
+	if tags, clean, ok := matchTagTrigger(trimmed, cfg.TagPrefix); ok {
+		return TriggerDecision{
+			CleanedMessage: clean,
+			ShouldSearch:   true,
+			Forced:         true,
+			Filter:         SearchFilter{Tags: tags},
+		}
+	}
+	if preset, clean, ok := matchScopedTrigger(trimmed, cfg.PresetPrefix); ok {
+		return TriggerDecision{
+			CleanedMessage: clean,
+			ShouldSearch:   true,
+			Forced:         true,
+			Filter:         SearchFilter{Preset: preset},
+		}
+	}
+	if directives, clean, ok := matchDirectivePrefix(trimmed, cfg.ForcePrefixes); ok {
+		return TriggerDecision{
+			CleanedMessage: clean,
+			ShouldSearch:   true,
+			Forced:         true,
+			Directives:     directives,
+		}
+	}
 	if prefix, ok := matchPrefix(trimmed, cfg.ForcePrefixes); ok {
 		clean := strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
 		return TriggerDecision{
@@ -66,6 +141,59 @@ func matchPrefix(message string, prefixes []string) (string, bool) {
 	return "", false
 }
 
+// matchDirectivePrefix parses a force prefix that carries response
+// directives before its colon, e.g. "kb/en: question" for the prefix "kb:".
+// Only prefixes ending in a colon take directives.
+func matchDirectivePrefix(message string, prefixes []string) (ResponseDirectives, string, bool) {
+	for _, prefix := range prefixes {
+		stem := strings.TrimRight(prefix, ":：")
+		if stem == "" || stem == prefix {
+			continue
+		}
+		scope, clean, ok := matchScopedTrigger(message, stem+"/")
+		if ok && languageCode.MatchString(scope) {
+			return ResponseDirectives{Language: strings.ToLower(scope)}, clean, true
+		}
+	}
+	return ResponseDirectives{}, "", false
+}
+
+// languageCode matches a language code such as "en" or "zh-TW".
+var languageCode = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// matchTagTrigger parses "<prefix>tag1#tag2: question".
+func matchTagTrigger(message, prefix string) ([]string, string, bool) {
+	scope, clean, ok := matchScopedTrigger(message, prefix)
+	if !ok {
+		return nil, "", false
+	}
+	var tags []string
+	for _, tag := range strings.Split(scope, "#") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, "", false
+	}
+	return tags, clean, true
+}
+
+// matchScopedTrigger parses "<prefix>scope: question". The scope ends at the
+// first ASCII or full-width colon and must not contain spaces.
+func matchScopedTrigger(message, prefix string) (string, string, bool) {
+	if prefix == "" || !strings.HasPrefix(message, prefix) {
+		return "", "", false
+	}
+	rest := message[len(prefix):]
+	end := strings.IndexAny(rest, ":：")
+	if end <= 0 || strings.ContainsAny(rest[:end], " \t\n") {
+		return "", "", false
+	}
+	_, size := utf8.DecodeRuneInString(rest[end:])
+	return rest[:end], strings.TrimSpace(rest[end+size:]), true
+}
+
 func matchKeyword(message string, keywords []string) string {
 	if len(keywords) == 0 {
 		return ""
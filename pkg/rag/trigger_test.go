@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestDecideTriggerTagPrefix(t *testing.T) {
+	cfg := config.RagTriggerConfig{TagPrefix: "kb#"}
+	tests := []struct {
+		message string
+		search  bool
+		tags    []string
+		clean   string
+	}{
+		{"kb#projectX: what is the status?", true, []string{"projectX"}, "what is the status?"},
+		{"kb#a#b：进展如何", true, []string{"a", "b"}, "进展如何"},
+		{"kb#: question", false, nil, "kb#: question"},
+		{"kb# projectX: question", false, nil, "kb# projectX: question"},
+		{"projectX: question", false, nil, "projectX: question"},
+	}
+	for _, tt := range tests {
+		d := DecideTrigger(tt.message, cfg)
+		if d.ShouldSearch != tt.search || !reflect.DeepEqual(d.Filter.Tags, tt.tags) || d.CleanedMessage != tt.clean {
+			t.Errorf("DecideTrigger(%q) = %+v", tt.message, d)
+		}
+	}
+}
+
+func TestDecideTriggerResponseDirectives(t *testing.T) {
+	cfg := config.RagTriggerConfig{ForcePrefixes: []string{"笔记:", "笔记：", "kb:", "ask "}}
+	tests := []struct {
+		message  string
+		search   bool
+		language string
+		clean    string
+	}{
+		{"kb/en: 复查的间隔是多少？", true, "en", "复查的间隔是多少？"},
+		{"笔记/zh-TW：reading list", true, "zh-tw", "reading list"},
+		{"kb: no directive", true, "", "no directive"},
+		{"kb/english please: question", false, "", "kb/english please: question"},
+		{"ask/en: question", false, "", "ask/en: question"},
+	}
+	for _, tt := range tests {
+		d := DecideTrigger(tt.message, cfg)
+		if d.ShouldSearch != tt.search || d.Directives.Language != tt.language || d.CleanedMessage != tt.clean {
+			t.Errorf("DecideTrigger(%q) = %+v", tt.message, d)
+		}
+	}
+	if got := (ResponseDirectives{Language: "en"}).Instruction(); got != "Answer in English, even if the notes or the question are in another language." {
+		t.Errorf("Instruction() = %q", got)
+	}
+	if got := (ResponseDirectives{Language: "zh-tw"}).Instruction(); got != "Answer in Chinese (zh-tw), even if the notes or the question are in another language." {
+		t.Errorf("Instruction() with a region = %q", got)
+	}
+	if got := (ResponseDirectives{}).Instruction(); got != "" {
+		t.Errorf("Instruction() without directives = %q", got)
+	}
+}
@@ -0,0 +1,273 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// TuneOptions controls RunTune. Zero fields use the defaults.
+type TuneOptions struct {
+	// SampleNotes is how many notes are chunked and embedded per setting.
+	SampleNotes int
+	// EvalSet is used instead of queries generated from the sampled notes.
+	// The notes it expects are always part of the sample.
+	EvalSet    []EvalCase
+	ChunkSizes []int
+	// OverlapRatios are fractions of the chunk size.
+	OverlapRatios []float64
+}
+
+// TuneResult scores one chunk_size/chunk_overlap combination.
+type TuneResult struct {
+	ChunkSize    int
+	ChunkOverlap int
+	Chunks       int
+	Metrics      EvalMetrics
+}
+
+type TuneReport struct {
+	Notes     int
+	Cases     int
+	Generated bool
+	Results   []TuneResult
+	Best      TuneResult
+}
+
+type tuneNote struct {
+	path string
+	text string
+}
+
+// RunTune chunks a sample of the vault with several settings, embeds the
+// chunks with the configured model and ranks them in memory against an eval
+// set, so no vector store is touched. Identical chunks are embedded once
+// across settings.
+func RunTune(ctx context.Context, cfg config.RagConfig, opts TuneOptions, progress func(string)) (*TuneReport, error) {
+	if opts.SampleNotes <= 0 {
+		opts.SampleNotes = 50
+	}
+	if len(opts.ChunkSizes) == 0 {
+		opts.ChunkSizes = []int{400, 800, 1200, 1600}
+	}
+	if len(opts.OverlapRatios) == 0 {
+		opts.OverlapRatios = []float64{0, 0.1, 0.2}
+	}
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	embedder, err := newEmbeddingClient(cfg.Embedding, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := sampleTuneNotes(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, fmt.Errorf("no notes to sample in the vault")
+	}
+
+	report := &TuneReport{Notes: len(notes)}
+	cases := opts.EvalSet
+	if len(cases) == 0 {
+		report.Generated = true
+		for _, n := range notes {
+			if q, ok := evalQueryFromNote(n.text); ok {
+				cases = append(cases, EvalCase{Query: q, Paths: []string{n.path}})
+			}
+		}
+		if len(cases) == 0 {
+			return nil, fmt.Errorf("could not derive queries from the sampled notes; pass an eval set")
+		}
+	}
+	report.Cases = len(cases)
+
+	cache := make(map[string][]float64)
+	queries := make([]string, len(cases))
+	for idx, c := range cases {
+		queries[idx] = c.Query
+	}
+	progress(fmt.Sprintf("embedding %d queries", len(queries)))
+	queryVectors, err := embedCached(ctx, embedder, cache, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	k := cfg.TopK
+	if k <= 0 {
+		k = 6
+	}
+	for _, size := range opts.ChunkSizes {
+		for _, ratio := range opts.OverlapRatios {
+			overlap := int(float64(size) * ratio)
+			progress(fmt.Sprintf("chunk_size %d, chunk_overlap %d", size, overlap))
+			c := newChunker(size, overlap)
+			c.minChunkChars = cfg.MinChunkChars
+			var chunks []chunk
+			for _, n := range notes {
+				chunks = append(chunks, c.chunk(n.path, n.text)...)
+			}
+			texts := make([]string, len(chunks))
+			for idx, ch := range chunks {
+				texts[idx] = ch.Content
+			}
+			vectors, err := embedCached(ctx, embedder, cache, texts)
+			if err != nil {
+				return report, err
+			}
+			rankings := make([][]string, len(cases))
+			for idx := range cases {
+				rankings[idx] = rankPaths(queryVectors[idx], chunks, vectors)
+			}
+			report.Results = append(report.Results, TuneResult{
+				ChunkSize:    size,
+				ChunkOverlap: overlap,
+				Chunks:       len(chunks),
+				Metrics:      scoreRankings(cases, rankings, k),
+			})
+		}
+	}
+
+	report.Best = report.Results[0]
+	for _, r := range report.Results[1:] {
+		if betterTuneResult(r, report.Best) {
+			report.Best = r
+		}
+	}
+	return report, nil
+}
+
+// betterTuneResult orders by MRR, then recall, then fewer chunks.
+func betterTuneResult(a, b TuneResult) bool {
+	const eps = 1e-9
+	if math.Abs(a.Metrics.MRR-b.Metrics.MRR) > eps {
+		return a.Metrics.MRR > b.Metrics.MRR
+	}
+	if math.Abs(a.Metrics.RecallAtK-b.Metrics.RecallAtK) > eps {
+		return a.Metrics.RecallAtK > b.Metrics.RecallAtK
+	}
+	return a.Chunks < b.Chunks
+}
+
+// sampleTuneNotes picks notes evenly spread over the vault listing, plus
+// every note the eval set expects.
+func sampleTuneNotes(cfg config.RagConfig, opts TuneOptions) ([]tuneNote, error) {
+	v, err := newVault(cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	v.formats = noteFormatsOf(cfg)
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+	files, err := v.list(cfg.IncludePatterns, cfg.ExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[string]bool)
+	for _, c := range opts.EvalSet {
+		for _, p := range c.Paths {
+			expected[p] = true
+		}
+	}
+	step := 1
+	if len(files) > opts.SampleNotes {
+		step = len(files) / opts.SampleNotes
+	}
+	var notes []tuneNote
+	sampled := 0
+	for idx, f := range files {
+		pick := idx%step == 0 && sampled < opts.SampleNotes
+		if !pick && !expected[f.RelPath] {
+			continue
+		}
+		content, err := readNote(ioPath(f.AbsPath), nil)
+		if err != nil {
+			continue
+		}
+		if pick {
+			sampled++
+		}
+		notes = append(notes, tuneNote{path: f.RelPath, text: normalizeText(string(content))})
+	}
+	return notes, nil
+}
+
+// embedCached embeds texts not yet in cache and returns vectors aligned with
+// texts.
+func embedCached(ctx context.Context, embedder Embedder, cache map[string][]float64, texts []string) ([][]float64, error) {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, t := range texts {
+		if _, ok := cache[t]; !ok && !seen[t] {
+			seen[t] = true
+			missing = append(missing, t)
+		}
+	}
+	size := embedder.BatchSize()
+	for start := 0; start < len(missing); start += size {
+		end := start + size
+		if end > len(missing) {
+			end = len(missing)
+		}
+		vectors, err := embedder.EmbedBatch(ctx, missing[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != end-start {
+			return nil, fmt.Errorf("embedding result size mismatch")
+		}
+		for idx, v := range vectors {
+			cache[missing[start+idx]] = v
+		}
+	}
+	out := make([][]float64, len(texts))
+	for idx, t := range texts {
+		out[idx] = cache[t]
+	}
+	return out, nil
+}
+
+// rankPaths orders note paths by their best chunk's cosine similarity to
+// query.
+func rankPaths(query []float64, chunks []chunk, vectors [][]float64) []string {
+	best := make(map[string]float64)
+	for idx, ch := range chunks {
+		score := cosineSimilarity(query, vectors[idx])
+		if prev, ok := best[ch.Path]; !ok || score > prev {
+			best[ch.Path] = score
+		}
+	}
+	paths := make([]string, 0, len(best))
+	for p := range best {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(a, b int) bool {
+		if best[paths[a]] != best[paths[b]] {
+			return best[paths[a]] > best[paths[b]]
+		}
+		return paths[a] < paths[b]
+	})
+	return paths
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for idx := range a {
+		dot += a[idx] * b[idx]
+		na += a[idx] * a[idx]
+		nb += b[idx] * b[idx]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,24 @@
+package rag
+
+import "testing"
+
+func TestRankPathsUsesBestChunk(t *testing.T) {
+	chunks := []chunk{{Path: "a.md"}, {Path: "b.md"}, {Path: "a.md"}}
+	vectors := [][]float64{{0, 1}, {0.7, 0.7}, {1, 0}}
+	got := rankPaths([]float64{1, 0}, chunks, vectors)
+	if len(got) != 2 || got[0] != "a.md" || got[1] != "b.md" {
+		t.Errorf("rankPaths() = %v, want [a.md b.md]", got)
+	}
+}
+
+func TestBetterTuneResult(t *testing.T) {
+	a := TuneResult{Chunks: 10, Metrics: EvalMetrics{MRR: 0.5, RecallAtK: 0.8}}
+	b := TuneResult{Chunks: 20, Metrics: EvalMetrics{MRR: 0.5, RecallAtK: 0.8}}
+	if !betterTuneResult(a, b) {
+		t.Error("with equal metrics, fewer chunks should win")
+	}
+	c := TuneResult{Chunks: 50, Metrics: EvalMetrics{MRR: 0.6}}
+	if !betterTuneResult(c, a) {
+		t.Error("higher MRR should win")
+	}
+}
@@ -1,12 +1,53 @@
 package rag
 
+import "time"
+
 type SearchResult struct {
-	Path      string
-	Heading   string
+	// ID is the vector store point ID of the chunk, usable with MoreLikeThis.
+	ID   string
+	Path string
+	// DocID is the note's document ID, which stays the same when the note
+	// is renamed or moved. It is empty for points indexed before it was
+	// stored.
+	DocID string
+	// Heading is the " > "-joined heading path, for display.
+	Heading string
+	// HeadingPath lists the enclosing headings from outermost to innermost.
+	// It is empty for chunks before the first heading and for points indexed
+	// before heading paths were stored.
+	HeadingPath  []string
+	HeadingLevel int
+	// Anchor is the slug of the innermost heading, for linking to the
+	// section as "path#anchor"; unlike line numbers it survives edits
+	// elsewhere in the note.
+	Anchor    string
 	StartLine int
 	EndLine   int
-	Content   string
-	Score     float64
+	// AudioStart and AudioEnd give the span, in seconds, of a chunk of an
+	// audio note's transcript. AudioEnd is 0 for every other chunk.
+	AudioStart int
+	AudioEnd   int
+	Content    string
+	Score      float64
+	// ModTime is when the note was last modified before it was indexed.
+	ModTime time.Time
+	// Tags are the note's frontmatter tags.
+	Tags []string
+	// Stale is set when the note changed on disk after it was indexed, so the
+	// line numbers and content may no longer match the file.
+	Stale bool
+	// SummaryLevel is 1 or more for a summary of rag.hierarchical, whose
+	// Content covers the notes in SummaryOf rather than a note at Path.
+	SummaryLevel int
+	SummaryOf    []string
+	// Pinned is set on notes of rag.pinned or a pin: term, which are included
+	// whole regardless of similarity and have no Score.
+	Pinned bool
+	// Namespace is the name of the rag.ensemble collection the chunk came
+	// from, or empty for the vault's own. Its Path is not in the vault.
+	Namespace string
+
+	fileHash string
 }
 
 type IndexSummary struct {
@@ -16,8 +57,49 @@ type IndexSummary struct {
 	RemovedFiles int
 	SkippedFiles int
 	Chunks       int
+	FailedFiles  int
+	// FullReindexReason is set when every file was re-embedded, e.g. because
+	// the chunker version or chunk settings changed.
+	FullReindexReason string
+	// Files has one entry per file when IndexOptions.Detail is set.
+	Files []IndexFileResult
+	// Failures lists files that could not be indexed. It is only non-empty
+	// when IndexOptions.ContinueOnError is set; otherwise the first failure
+	// aborts the run.
+	Failures []IndexFileResult
+	// Stopped is set when IndexOptions.Stop ended the run early.
+	Stopped bool
+}
+
+// Index file actions reported in IndexFileResult.Action.
+const (
+	IndexActionIndexed = "indexed"
+	IndexActionUpdated = "updated"
+	IndexActionRemoved = "removed"
+	IndexActionSkipped = "skipped"
+	IndexActionFailed  = "failed"
+)
+
+type IndexFileResult struct {
+	Path     string
+	Action   string
+	Chunks   int
+	Duration time.Duration
+	Error    string
 }
 
 type IndexOptions struct {
 	ReindexAll bool
+	// Detail records a per-file entry in IndexSummary.Files.
+	Detail bool
+	// ContinueOnError records per-file failures in IndexSummary.Failures
+	// and keeps going instead of aborting the run. Failures that would
+	// affect every file, such as an unavailable backend, still abort.
+	ContinueOnError bool
+	// Stop ends the run early when closed: the file in progress is finished
+	// and the state saved, so the next run resumes where this one stopped.
+	Stop <-chan struct{}
+	// AllowMassDelete removes the notes missing from the vault even when
+	// they are more than rag.safety.max_removed_fraction of the index.
+	AllowMassDelete bool
 }
@@ -0,0 +1,128 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// UserKey names the knowledge base of one chat user under rag.per_user:
+// the channel and sender ID joined by "_", with anything but letters,
+// digits, "-" and "_" replaced so the key is safe as a directory and
+// collection name. Compound sender IDs such as "123456|username" use their
+// first part so a renamed account keeps its knowledge base.
+func UserKey(channel, senderID string) string {
+	id, _, _ := strings.Cut(senderID, "|")
+	return sanitizeUserKey(channel + "_" + id)
+}
+
+// ParseUserKey accepts a user as "channel:sender_id", as given on the
+// command line, or as an existing key.
+func ParseUserKey(user string) (string, error) {
+	if channel, id, ok := strings.Cut(user, ":"); ok {
+		if channel == "" || id == "" {
+			return "", fmt.Errorf("invalid user %q: want channel:sender_id", user)
+		}
+		return UserKey(channel, id), nil
+	}
+	if user == "" {
+		return "", fmt.Errorf("user is required")
+	}
+	return sanitizeUserKey(user), nil
+}
+
+func sanitizeUserKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// UserVaultRoot returns the directory holding the per-user vaults.
+func UserVaultRoot(cfg *config.Config, workspace string) string {
+	if root := cfg.RAG.PerUser.VaultRoot; root != "" {
+		return config.ExpandPath(root)
+	}
+	return filepath.Join(workspace, "vaults")
+}
+
+// UserConfig returns a copy of cfg whose knowledge base is the one of user, a
+// key from UserKey: the vault "<vault root>/<user>", the index state in
+// "<rag data dir>/users/<user>" and collections suffixed with the user.
+// Remote vaults are shared sources and are left out.
+func UserConfig(cfg *config.Config, workspace, user string) *config.Config {
+	ragCfg := cfg.RAG
+	dataDir := filepath.Join(workspace, "rag")
+	if workspace == "" {
+		dataDir = filepath.Join(config.DefaultDataWorkspace(), "rag")
+	}
+	if ragCfg.DataDir != "" {
+		dataDir = config.ExpandPath(ragCfg.DataDir)
+	}
+	ragCfg.VaultPath = config.VaultPaths{filepath.Join(UserVaultRoot(cfg, workspace), user)}
+	ragCfg.DataDir = filepath.Join(dataDir, "users", user)
+	ragCfg.VectorDB.Collection = ragCfg.VectorDB.Collection + "_" + user
+	ragCfg.RemoteVaults = nil
+	ragCfg.LanguageRoutes = make([]config.RagLanguageRouteConfig, len(cfg.RAG.LanguageRoutes))
+	for idx, route := range cfg.RAG.LanguageRoutes {
+		// Routes without a collection derive theirs from the base one,
+		// which already carries the user.
+		if route.Collection != "" {
+			route.Collection += "_" + user
+		}
+		ragCfg.LanguageRoutes[idx] = route
+	}
+	return &config.Config{Agents: cfg.Agents, RAG: ragCfg}
+}
+
+// UserServices builds and keeps one Service per user for rag.per_user.
+type UserServices struct {
+	cfg       *config.Config
+	workspace string
+	opts      []Option
+
+	mu       sync.Mutex
+	services map[string]*Service
+}
+
+// NewUserServices returns the per-user services of cfg, built on first use
+// with opts. It returns ErrDisabled unless rag and rag.per_user are enabled.
+func NewUserServices(cfg *config.Config, workspace string, opts ...Option) (*UserServices, error) {
+	if !cfg.RAG.Enabled || !cfg.RAG.PerUser.Enabled {
+		return nil, ErrDisabled
+	}
+	return &UserServices{
+		cfg:       cfg,
+		workspace: workspace,
+		opts:      opts,
+		services:  make(map[string]*Service),
+	}, nil
+}
+
+// For returns the service of user, a key from UserKey, creating the user's
+// vault directory the first time.
+func (u *UserServices) For(user string) (*Service, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if s, ok := u.services[user]; ok {
+		return s, nil
+	}
+	cfg := UserConfig(u.cfg, u.workspace, user)
+	if err := os.MkdirAll(cfg.RAG.VaultPath[0], 0755); err != nil {
+		return nil, fmt.Errorf("create vault of %s: %w", user, err)
+	}
+	s, err := NewService(cfg, u.workspace, u.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge base of %s: %w", user, err)
+	}
+	s.user = user
+	u.services[user] = s
+	return s, nil
+}
@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestUserKey(t *testing.T) {
+	tests := []struct {
+		channel, sender, want string
+	}{
+		{"telegram", "123456|alice", "telegram_123456"},
+		{"discord", "987", "discord_987"},
+		{"slack", "U1/../x", "slack_U1____x"},
+	}
+	for _, tt := range tests {
+		if got := UserKey(tt.channel, tt.sender); got != tt.want {
+			t.Errorf("UserKey(%q, %q) = %q, want %q", tt.channel, tt.sender, got, tt.want)
+		}
+	}
+	if got, err := ParseUserKey("telegram:123"); err != nil || got != "telegram_123" {
+		t.Errorf("ParseUserKey() = %q, %v", got, err)
+	}
+	if _, err := ParseUserKey("telegram:"); err == nil {
+		t.Error("ParseUserKey() accepted an empty sender ID")
+	}
+}
+
+func TestUserServices(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.RAG.Enabled = true
+	cfg.RAG.PerUser.Enabled = true
+	cfg.RAG.VectorDB.Collection = "notes"
+
+	users, err := NewUserServices(cfg, workspace, WithEmbedder(fixedEmbedder{}), WithVectorStore(oneResultStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := users.For("telegram_1")
+	if err != nil {
+		t.Fatalf("For() error: %v", err)
+	}
+	if again, _ := users.For("telegram_1"); again != s {
+		t.Error("For() built a second service for the same user")
+	}
+	vault := filepath.Join(workspace, "vaults", "telegram_1")
+	if info, err := os.Stat(vault); err != nil || !info.IsDir() {
+		t.Errorf("user vault not created: %v", err)
+	}
+	got := s.Config()
+	if len(got.VaultPath) != 1 || got.VaultPath[0] != vault {
+		t.Errorf("VaultPath = %v, want [%s]", got.VaultPath, vault)
+	}
+	if want := filepath.Join(workspace, "rag", "users", "telegram_1"); s.dataDir != want {
+		t.Errorf("data dir = %q, want %q", s.dataDir, want)
+	}
+	if got.VectorDB.Collection != "notes_telegram_1" {
+		t.Errorf("collection = %q", got.VectorDB.Collection)
+	}
+
+	cfg.RAG.PerUser.Enabled = false
+	if _, err := NewUserServices(cfg, workspace); err != ErrDisabled {
+		t.Errorf("NewUserServices() without per_user error = %v, want ErrDisabled", err)
+	}
+}
+
+func TestUserConfigRoutesAndRemotes(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RAG.VectorDB.Collection = "notes"
+	cfg.RAG.PerUser.VaultRoot = "/srv/vaults"
+	cfg.RAG.LanguageRoutes = []config.RagLanguageRouteConfig{
+		{Language: "zh", Collection: "notes_cn"},
+		{Language: "de"},
+	}
+	cfg.RAG.RemoteVaults = []config.RagRemoteVaultConfig{{Name: "team"}}
+
+	got := UserConfig(cfg, t.TempDir(), "discord_7").RAG
+	if want := filepath.Join("/srv/vaults", "discord_7"); got.VaultPath[0] != want {
+		t.Errorf("VaultPath = %v, want [%s]", got.VaultPath, want)
+	}
+	if got.LanguageRoutes[0].Collection != "notes_cn_discord_7" || got.LanguageRoutes[1].Collection != "" {
+		t.Errorf("route collections = %+v", got.LanguageRoutes)
+	}
+	if len(got.RemoteVaults) != 0 {
+		t.Errorf("remote vaults kept: %+v", got.RemoteVaults)
+	}
+	if cfg.RAG.LanguageRoutes[0].Collection != "notes_cn" {
+		t.Error("UserConfig() changed the shared config")
+	}
+}
@@ -0,0 +1,122 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// vault maps logical note paths to files on disk. With a single root the
+// logical path is relative to that root, as it always was. With several
+// roots every logical path starts with the root's prefix, e.g.
+// "work/projects/a.md", so notes with the same relative path in different
+// roots stay distinct in the index, the state file and DeleteByPath.
+type vault struct {
+	roots []vaultRoot
+	// formats selects the file types listed besides markdown notes.
+	formats noteFormats
+}
+
+type vaultRoot struct {
+	prefix string
+	path   string
+}
+
+// newVault parses rag.vault_path entries. An entry is either a directory or
+// "name=directory"; without a name the directory's base name is the prefix.
+func newVault(paths []string) (*vault, error) {
+	v := &vault{}
+	seen := make(map[string]bool)
+	for _, entry := range paths {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, dir, named := strings.Cut(entry, "=")
+		if !named {
+			dir = entry
+		}
+		dir = filepath.Clean(config.ExpandPath(strings.TrimSpace(dir)))
+		prefix := strings.TrimSpace(name)
+		if !named {
+			prefix = filepath.Base(dir)
+		}
+		if prefix == "" || strings.ContainsAny(prefix, `/\`) {
+			return nil, fmt.Errorf("rag.vault_path: invalid prefix %q", prefix)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("rag.vault_path: duplicate prefix %q, use name=path to disambiguate", prefix)
+		}
+		seen[prefix] = true
+		v.roots = append(v.roots, vaultRoot{prefix: prefix, path: dir})
+	}
+	if len(v.roots) == 0 {
+		return nil, fmt.Errorf("rag.vault_path is required")
+	}
+	if len(v.roots) == 1 {
+		v.roots[0].prefix = ""
+	}
+	return v, nil
+}
+
+// check verifies that every root exists.
+func (v *vault) check() error {
+	for _, root := range v.roots {
+		info, err := os.Stat(ioPath(root.path))
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("%w: %s", ErrVaultNotFound, root.path)
+		}
+	}
+	return nil
+}
+
+// abs returns the file path for a logical note path.
+func (v *vault) abs(rel string) (string, bool) {
+	root, inner, ok := v.locate(rel)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(root.path, filepath.FromSlash(inner)), true
+}
+
+// locate returns the root holding a logical note path and the slash-separated
+// path inside that root.
+func (v *vault) locate(rel string) (vaultRoot, string, bool) {
+	for _, root := range v.roots {
+		if root.prefix == "" {
+			return root, rel, true
+		}
+		if inner, ok := strings.CutPrefix(rel, root.prefix+"/"); ok {
+			return root, inner, true
+		}
+	}
+	return vaultRoot{}, "", false
+}
+
+// list walks every root. Include and exclude patterns match the path inside
+// each root; with several roots an exclude pattern may also match the
+// prefixed path, e.g. "personal/**".
+func (v *vault) list(includePatterns, excludePatterns []string) ([]fileEntry, error) {
+	excludeRegex := compilePatterns(excludePatterns)
+	var all []fileEntry
+	for _, root := range v.roots {
+		files, err := listNoteFiles(root.path, v.formats, includePatterns, excludePatterns)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if root.prefix != "" {
+				f.RelPath = path.Join(root.prefix, f.RelPath)
+				if matchesAny(f.RelPath, excludeRegex) {
+					continue
+				}
+			}
+			all = append(all, f)
+		}
+	}
+	return all, nil
+}
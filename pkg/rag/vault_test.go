@@ -0,0 +1,62 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestVaultMultipleRoots(t *testing.T) {
+	base := t.TempDir()
+	for _, rel := range []string{"work/a.md", "personal/a.md", "personal/.obsidian/x.md", "personal/private/p.md"} {
+		path := filepath.Join(base, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# note"), 0644)
+	}
+
+	v, err := newVault([]string{filepath.Join(base, "work"), "home=" + filepath.Join(base, "personal")})
+	if err != nil {
+		t.Fatalf("newVault() error: %v", err)
+	}
+	files, err := v.list(nil, []string{".obsidian/**", "home/private/**"})
+	if err != nil {
+		t.Fatalf("list() error: %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.RelPath)
+	}
+	sort.Strings(got)
+	want := []string{"home/a.md", "work/a.md"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("list() = %v, want %v", got, want)
+	}
+
+	abs, ok := v.abs("home/a.md")
+	if !ok || abs != filepath.Join(base, "personal", "a.md") {
+		t.Errorf("abs(home/a.md) = %q, %v", abs, ok)
+	}
+	if _, ok := v.abs("gone/a.md"); ok {
+		t.Error("abs should reject unknown prefixes")
+	}
+}
+
+func TestVaultSingleRootHasNoPrefix(t *testing.T) {
+	v, err := newVault([]string{"/vault"})
+	if err != nil {
+		t.Fatalf("newVault() error: %v", err)
+	}
+	if abs, _ := v.abs("notes/a.md"); abs != filepath.Join("/vault", "notes", "a.md") {
+		t.Errorf("abs = %q", abs)
+	}
+}
+
+func TestVaultDuplicatePrefix(t *testing.T) {
+	if _, err := newVault([]string{"/a/notes", "/b/notes"}); err == nil {
+		t.Error("expected error for duplicate prefix")
+	}
+	if _, err := newVault(nil); err == nil {
+		t.Error("expected error for empty vault_path")
+	}
+}